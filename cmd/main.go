@@ -2,13 +2,16 @@ package main
 
 import (
 	"log"
-	"os"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/joho/godotenv"
 
+	"backend/config"
 	"backend/internal/database"
 	"backend/internal/router"
+	"backend/internal/scheduler"
+	"backend/internal/services"
 )
 
 func main() {
@@ -16,21 +19,23 @@ func main() {
 		log.Print("No .env file found, using environment variables or defaults")
 	}
 
-	timezone := os.Getenv("SERVER_TIMEZONE")
-	if timezone == "" {
-		timezone = "UTC"
-		log.Print("SERVER_TIMEZONE not set, defaulting to UTC")
-	}
-	loc, err := time.LoadLocation(timezone)
-	log.Print("Setting server timezone to ", timezone)
-	if err != nil {
-		log.Print("Failed to load timezone ", timezone, ", defaulting to UTC")
-		loc = time.UTC
-	}
-	time.Local = loc
-
 	database.InitDB()
 
+	// Tareas en segundo plano, con varias replicas solo una ejecuta cada tarea a la vez
+	emailService := services.NewEmailService(database.DB)
+	recordatoriosService := services.NewRecordatoriosService(database.DB, emailService, config.GetDefaultLocation())
+	notificacionesMatchService := services.NewNotificacionesMatchService(database.DB, emailService)
+	vencimientosService := services.NewVencimientosContratosService(database.DB, emailService, config.GetDefaultLocation())
+	adeudosService := services.NewAdeudosRentaService(database.DB, emailService, config.GetDefaultLocation())
+	comisionesService := services.NewComisionesService(database.DB, emailService, config.GetDefaultLocation())
+	tareas := scheduler.New(database.DB)
+	tareas.Registrar("recordatorios_citas", time.Minute, recordatoriosService.Ejecutar)
+	tareas.Registrar("notificaciones_matches", time.Minute, notificacionesMatchService.Ejecutar)
+	tareas.Registrar("vencimientos_contratos", time.Hour, vencimientosService.Ejecutar)
+	tareas.Registrar("adeudos_rentas", time.Hour, adeudosService.Ejecutar)
+	tareas.Registrar("estados_propietarios", time.Hour, comisionesService.Ejecutar)
+	tareas.Start()
+
 	ginRouter := router.SetupRouter()
 
 	ginRouter.Run(":8080")
@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -26,6 +29,58 @@ func GetConfig() *Config {
 }
 
 func (c *Config) GetDSN() string {
-	return fmt.Sprintf("%s:%s@%s(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+	// Las fechas se guardan y se leen en UTC sin importar la zona del servidor o de MySQL
+	return fmt.Sprintf("%s:%s@%s(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC&time_zone=%%27%%2B00%%3A00%%27",
 		c.User, c.Password, c.Net, c.Addr, c.DBPort, c.DBName)
 }
+
+// GetDefaultLocation regresa la zona horaria de los agentes que no han configurado la suya.
+// Se lee de DEFAULT_TIMEZONE (o SERVER_TIMEZONE por compatibilidad), si no hay o no es valida se usa UTC
+func GetDefaultLocation() *time.Location {
+	zona := os.Getenv("DEFAULT_TIMEZONE")
+	if zona == "" {
+		zona = os.Getenv("SERVER_TIMEZONE")
+	}
+	if zona == "" {
+		log.Print("DEFAULT_TIMEZONE not set, defaulting to UTC")
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(zona)
+	if err != nil {
+		log.Print("Failed to load timezone ", zona, ", defaulting to UTC")
+		return time.UTC
+	}
+	return loc
+}
+
+// StorageConfig indica donde se guardan los archivos que se suben a la API
+type StorageConfig struct {
+	Driver    string
+	LocalPath string
+}
+
+func GetStorageConfig() *StorageConfig {
+	cfg := &StorageConfig{
+		Driver:    os.Getenv("STORAGE_DRIVER"),
+		LocalPath: os.Getenv("STORAGE_LOCAL_PATH"),
+	}
+	if cfg.Driver == "" {
+		cfg.Driver = "local"
+	}
+	if cfg.LocalPath == "" {
+		cfg.LocalPath = "./uploads"
+	}
+	return cfg
+}
+
+// GetTrustedProxies regresa los proxies (IP o CIDR) de los que se aceptan X-Forwarded-For y X-Real-IP para la IP
+// del cliente. Se lee de TRUSTED_PROXIES separado por comas, si no hay se usa la IP de la conexion
+func GetTrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
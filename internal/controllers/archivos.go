@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+
+	"backend/internal/models"
+	"backend/internal/services"
+	"backend/internal/storage"
+)
+
+// Margen para los demas campos del formulario multipart ademas del archivo
+const formOverheadBytes = 1 << 20
+
+// limitUpload limita el cuerpo de la petición al tamaño maximo del archivo, se debe llamar antes de leer el formulario
+func limitUpload(c *gin.Context, tipo services.TipoArchivo) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, tipo.MaxBytes+formOverheadBytes)
+}
+
+// saveUpload guarda el campo "archivo" del formulario, responde el error y regresa false si no es valido
+func saveUpload(c *gin.Context, archivos *services.ArchivosService, tipo services.TipoArchivo) (*models.Archivo, bool) {
+	header, err := c.FormFile("archivo")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "El archivo excede el tamaño permitido"})
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Falta el archivo", "details": err.Error()})
+		return nil, false
+	}
+
+	archivo, err := archivos.Save(header, tipo)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrFileTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "El archivo excede el tamaño permitido"})
+		case errors.Is(err, services.ErrUnsupportedFileType):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Tipo de archivo no permitido", "permitidos": tipo.MIMEs})
+		case errors.Is(err, services.ErrEmptyFile):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo está vacío"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar el archivo"})
+		}
+		return nil, false
+	}
+	return archivo, true
+}
+
+// serveArchivo manda el archivo al cliente sin cargarlo completo en memoria
+func serveArchivo(c *gin.Context, archivos *services.ArchivosService, archivo *models.Archivo) {
+	etag := `"` + archivo.Checksum + `"`
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	reader, err := archivos.Open(archivo.Ruta)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Archivo no encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al leer el archivo"})
+		return
+	}
+	defer reader.Close()
+
+	nombre := archivo.NombreOriginal
+	if nombre == "" {
+		nombre = path.Base(archivo.Ruta)
+	}
+
+	// El middleware del router pone JSON por defecto, DataFromReader no sobreescribe un Content-Type existente
+	c.Header("Content-Type", archivo.TipoMIME)
+	c.DataFromReader(http.StatusOK, archivo.TamanoBytes, archivo.TipoMIME, reader, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("inline", map[string]string{"filename": nombre}),
+		"ETag":                etag,
+	})
+}
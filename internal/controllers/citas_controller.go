@@ -3,22 +3,27 @@ package controllers
 import (
 	"backend/internal/models"
 	"backend/internal/services"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // UserController is the controller for the User model
 type CitasController struct {
-	CitasService *services.CitasService
+	CitasService         *services.CitasService
+	AuthorizationService *services.AuthorizationService
 }
 
 // NewUserController is the constructor for the UserController
-func NewCitasController(citasService *services.CitasService) *CitasController {
+func NewCitasController(citasService *services.CitasService, authorizationService *services.AuthorizationService) *CitasController {
 	return &CitasController{
-		CitasService: citasService,
+		CitasService:         citasService,
+		AuthorizationService: authorizationService,
 	}
 }
 
@@ -30,15 +35,21 @@ func (ctrl *CitasController) GetAllCitas(c *gin.Context) {
 	// 	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 	// 	return
 	// }
-
-	citas, err := ctrl.CitasService.GetAllCitasUser(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve citas"})
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(services.ClaimsFromContext(c), id)) {
+		return
+	}
+	page, ok := bindPage(c)
+	if !ok {
 		return
 	}
 
-	if citas == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No citas found"})
+	citas, err := ctrl.CitasService.GetAllCitasUser(id, page)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve citas"})
 		return
 	}
 
@@ -60,9 +71,15 @@ func (ctrl *CitasController) GetAllCitasDay(c *gin.Context) {
 	// 	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid day"})
 	// 	return
 	// }
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(services.ClaimsFromContext(c), id)) {
+		return
+	}
 
 	citas, err := ctrl.CitasService.GetAllCitasUserDay(id, day)
 	if err != nil {
+		if abortCitaError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve citas"})
 		return
 	}
@@ -76,6 +93,39 @@ func (ctrl *CitasController) GetAllCitasDay(c *gin.Context) {
 	c.JSON(http.StatusOK, citas)
 }
 
+// GET /citas/mes/:id/:anio/:mes
+// Citas del agente en el mes, el mes se toma en la zona horaria del agente
+func (ctrl *CitasController) GetAllCitasMonth(c *gin.Context) {
+	id := c.Param("id")
+	anio, err := strconv.Atoi(c.Param("anio"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return
+	}
+	mes, err := strconv.Atoi(c.Param("mes"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month"})
+		return
+	}
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(services.ClaimsFromContext(c), id)) {
+		return
+	}
+
+	citas, err := ctrl.CitasService.GetAllCitasUserMonth(id, anio, mes)
+	if err != nil {
+		if abortCitaError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve citas"})
+		return
+	}
+	if citas == nil {
+		citas = []*models.CitaMenu{}
+	}
+
+	c.JSON(http.StatusOK, citas)
+}
+
 // GET /cita/:id
 func (ctrl *CitasController) GetCita(c *gin.Context) {
 	idParam := c.Param("id")
@@ -112,9 +162,21 @@ func (ctrl *CitasController) InsertCita(c *gin.Context) {
 
 	// fmt.Printf("Request payload after binding: %+v\n", request)
 
+	// Los agentes solo pueden agendar citas a su nombre
+	claims := services.ClaimsFromContext(c)
+	if cita.IdUsuario == "" && claims != nil {
+		cita.IdUsuario = claims.Email
+	}
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(claims, cita.IdUsuario)) {
+		return
+	}
+
 	id, err := ctrl.CitasService.InsertCita(&cita)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create propiedad", "details": err.Error()})
+		if abortCitaError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create cita", "details": err.Error()})
 		return
 	}
 	log.Printf("Created cita with ID: %d", id)
@@ -137,7 +199,22 @@ func (ctrl *CitasController) UpdateCita(c *gin.Context) {
 		return
 	}
 
+	claims := services.ClaimsFromContext(c)
+	if cita.IdUsuario == "" && claims != nil {
+		cita.IdUsuario = claims.Email
+	}
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(claims, cita.IdUsuario)) {
+		return
+	}
+
 	if err := ctrl.CitasService.UpdateCita(&cita, id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cita not found"})
+			return
+		}
+		if abortCitaError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cita"})
 		return
 	}
@@ -155,9 +232,260 @@ func (ctrl *CitasController) DeleteCita(c *gin.Context) {
 	}
 
 	if err := ctrl.CitasService.DeleteCita(id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cita not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cita"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Cita deleted"})
 }
+
+// PUT /citas/update/:id/ocurrencia
+// Edita una ocurrencia de la serie :id, alcance "esta" solo esa ocurrencia y "siguientes" esa y las que siguen
+func (ctrl *CitasController) UpdateOcurrencia(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cita ID"})
+		return
+	}
+	var edicion models.EdicionOcurrencia
+	if err := c.ShouldBindJSON(&edicion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	claims := services.ClaimsFromContext(c)
+	if edicion.Cita.IdUsuario == "" && claims != nil {
+		edicion.Cita.IdUsuario = claims.Email
+	}
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(claims, edicion.Cita.IdUsuario)) {
+		return
+	}
+
+	if _, err := ctrl.CitasService.UpdateOcurrencia(id, &edicion); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cita not found"})
+			return
+		}
+		if abortCitaError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ocurrencia"})
+		return
+	}
+
+	c.JSON(http.StatusOK, edicion.Cita)
+}
+
+// DELETE /citas/eliminar/:id/ocurrencia?ocurrencia=2024-12-16T16:00:00Z&alcance=esta
+// Cancela una ocurrencia de la serie :id, o esa y las que siguen con alcance=siguientes
+func (ctrl *CitasController) DeleteOcurrencia(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cita ID"})
+		return
+	}
+	ocurrencia, err := time.Parse(time.RFC3339, c.Query("ocurrencia"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ocurrencia must be RFC 3339"})
+		return
+	}
+	alcance := c.DefaultQuery("alcance", services.AlcanceEsta)
+
+	if err := ctrl.CitasService.DeleteOcurrencia(id, ocurrencia, alcance); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cita not found"})
+			return
+		}
+		if abortCitaError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ocurrencia"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ocurrencia deleted"})
+}
+
+// PUT /citas/resultado/:id
+// Registra el resultado de la visita y las notas del agente, también sirve para corregirlo
+func (ctrl *CitasController) RegistrarResultado(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cita ID"})
+		return
+	}
+	var resultado models.ResultadoCita
+	if err := c.ShouldBindJSON(&resultado); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if err := ctrl.CitasService.RegistrarResultado(id, &resultado, services.EmailFromContext(c)); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cita not found"})
+			return
+		}
+		if abortCitaError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save resultado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resultado)
+}
+
+// abortCitaError responde los errores de validación de agenda, regresa false si el error es otro
+func abortCitaError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrInvalidCita):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cita", "details": err.Error()})
+	case errors.Is(err, services.ErrCitaConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "The agent or the prospecto already has a cita at that time", "details": err.Error()})
+	case errors.Is(err, services.ErrOutsideWorkingHours):
+		c.JSON(http.StatusConflict, gin.H{"error": "The cita is outside the agent working hours", "details": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
+
+// GET /citas/disponibilidad?usuario=&desde=yyyy-mm-dd&hasta=yyyy-mm-dd&duracion=60
+// Espacios libres del agente, si no se manda usuario se usa el del token. desde y hasta también aceptan RFC 3339
+func (ctrl *CitasController) GetDisponibilidad(c *gin.Context) {
+	usuario := c.Query("usuario")
+	if usuario == "" {
+		usuario = services.EmailFromContext(c)
+	}
+	duracion := 0
+	if value := c.Query("duracion"); value != "" {
+		var err error
+		if duracion, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid duracion"})
+			return
+		}
+	}
+
+	espacios, err := ctrl.CitasService.GetDisponibilidad(usuario, c.Query("desde"), c.Query("hasta"), duracion)
+	if err != nil {
+		if abortCitaError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve disponibilidad"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usuario": usuario, "espacios": espacios})
+}
+
+// GET /citas/horario/:usuario
+func (ctrl *CitasController) GetHorario(c *gin.Context) {
+	horario, err := ctrl.CitasService.GetHorario(c.Param("usuario"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve horario"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usuario": c.Param("usuario"), "zona_horaria": horario.ZonaHoraria, "bloques": horario.Bloques})
+}
+
+// PUT /citas/horario/:usuario
+// Reemplaza el horario de trabajo del agente, los agentes solo pueden cambiar el suyo
+func (ctrl *CitasController) SetHorario(c *gin.Context) {
+	usuario := c.Param("usuario")
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(services.ClaimsFromContext(c), usuario)) {
+		return
+	}
+
+	var horario models.HorarioSemanal
+	if err := c.ShouldBindJSON(&horario); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	if err := ctrl.CitasService.SetHorario(usuario, &horario); err != nil {
+		if errors.Is(err, services.ErrInvalidHorario) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid horario", "details": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update horario"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usuario": usuario, "zona_horaria": horario.ZonaHoraria, "bloques": horario.Bloques})
+}
+
+// POST /citas/calendario/:usuario
+// Genera la URL secreta del feed ICS del agente, la URL anterior deja de funcionar
+func (ctrl *CitasController) GenerarTokenCalendario(c *gin.Context) {
+	usuario := c.Param("usuario")
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(services.ClaimsFromContext(c), usuario)) {
+		return
+	}
+
+	token, err := ctrl.CitasService.GenerarTokenCalendario(usuario)
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate calendar token"})
+		return
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	path := "/api/v1/calendario/" + token + ".ics"
+	c.JSON(http.StatusCreated, gin.H{"usuario": usuario, "url": scheme + "://" + c.Request.Host + path, "path": path})
+}
+
+// DELETE /citas/calendario/:usuario
+func (ctrl *CitasController) RevocarTokenCalendario(c *gin.Context) {
+	usuario := c.Param("usuario")
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(services.ClaimsFromContext(c), usuario)) {
+		return
+	}
+
+	if err := ctrl.CitasService.RevocarTokenCalendario(usuario); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke calendar token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar token revoked"})
+}
+
+// GET /calendario/:token
+// Feed ICS del agente, no usa JWT porque Google Calendar y Outlook no mandan headers, el token de la URL es la credencial
+func (ctrl *CitasController) GetCalendario(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	ics, err := ctrl.CitasService.GetCalendario(token)
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Calendar not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve calendar"})
+		return
+	}
+
+	// El middleware del router pone JSON por defecto, Data no sobreescribe un Content-Type existente
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", `inline; filename="citas.ics"`)
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", ics)
+}
@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"backend/internal/models"
+	"backend/internal/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ComisionesController struct {
+	Service *services.ComisionesService
+}
+
+// Constructor para ComisionesController
+func NewComisionesController(service *services.ComisionesService) *ComisionesController {
+	return &ComisionesController{
+		Service: service,
+	}
+}
+
+// abortComisionError responde los errores de las comisiones y los estados de cuenta, regresa false si es otro error
+func abortComisionError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrInvalidComision):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comisión inválida", "details": err.Error()})
+	case errors.Is(err, services.ErrInvalidFilter):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Filtro inválido", "details": err.Error()})
+	case errors.Is(err, services.ErrInvalidContacto):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de contacto inválidos", "details": err.Error()})
+	case errors.Is(err, services.ErrEmailNotConfigured):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "El envío de correos no está configurado"})
+	case errors.Is(err, services.ErrEnvioEstado):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "No se pudo enviar el correo", "details": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
+
+// GET /comisiones/reglas
+// Reglas de comisión generales y por tipo de propiedad
+func (controller *ComisionesController) GetReglas(c *gin.Context) {
+	reglas, err := controller.Service.GetReglas()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, reglas)
+}
+
+// PUT /comisiones/reglas
+// Crea o reemplaza la regla general o la de un tipo de propiedad
+func (controller *ComisionesController) GuardarRegla(c *gin.Context) {
+	var regla models.ReglaComision
+	if err := c.ShouldBindJSON(&regla); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	guardada, err := controller.Service.GuardarRegla(&regla, services.EmailFromContext(c))
+	if err != nil {
+		if abortComisionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, guardada)
+}
+
+// DELETE /comisiones/reglas/:id
+func (controller *ComisionesController) DeleteRegla(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	if err := controller.Service.DeleteRegla(id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Regla no encontrada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Regla eliminada"})
+}
+
+// GET /comisiones/contratos/:id
+// Comisión de un contrato y su reparto entre agentes
+func (controller *ComisionesController) GetComisionContrato(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	comision, err := controller.Service.GetComisionContrato(id)
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Contrato no encontrado"})
+			return
+		}
+		if abortComisionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, comision)
+}
+
+// PUT /comisiones/contratos/:id
+// Cambia la regla propia del contrato y el agente que lo cerró
+func (controller *ComisionesController) SetComisionContrato(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	var cambio models.CambioComisionContrato
+	if err := c.ShouldBindJSON(&cambio); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	comision, err := controller.Service.SetComisionContrato(id, &cambio, services.EmailFromContext(c))
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Contrato no encontrado"})
+			return
+		}
+		if abortComisionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, comision)
+}
+
+// DELETE /comisiones/contratos/:id
+// Quita la regla propia del contrato
+func (controller *ComisionesController) DeleteComisionContrato(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	if err := controller.Service.DeleteComisionContrato(id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Contrato no encontrado"})
+			return
+		}
+		if abortComisionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Regla del contrato eliminada"})
+}
+
+// GET /comisiones/agentes?anio=&mes=&usuario=
+// Lo que le toca a cada agente de las comisiones del mes
+func (controller *ComisionesController) GetComisionesAgentes(c *gin.Context) {
+	var filtro models.FiltroPeriodo
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Filtro inválido", "details": err.Error()})
+		return
+	}
+
+	reporte, err := controller.Service.GetComisionesAgentes(&filtro)
+	if err != nil {
+		if abortComisionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, reporte)
+}
+
+// estadoPropietario lee el id y el periodo y arma el estado de cuenta, si algo falla ya respondió
+func (controller *ComisionesController) estadoPropietario(c *gin.Context) *models.EstadoPropietario {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return nil
+	}
+	var filtro models.FiltroPeriodo
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Filtro inválido", "details": err.Error()})
+		return nil
+	}
+
+	estado, err := controller.Service.GetEstadoPropietario(id, &filtro)
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Propietario no encontrado"})
+			return nil
+		}
+		if abortComisionError(c, err) {
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return nil
+	}
+	return estado
+}
+
+// GET /propietarios/:id/estado-cuenta?anio=&mes=
+// Estado de cuenta mensual del propietario, sin año ni mes es el mes pasado
+func (controller *ComisionesController) GetEstadoPropietario(c *gin.Context) {
+	if estado := controller.estadoPropietario(c); estado != nil {
+		c.JSON(http.StatusOK, estado)
+	}
+}
+
+// GET /propietarios/:id/estado-cuenta/pdf?anio=&mes=
+func (controller *ComisionesController) DownloadEstadoPropietarioPDF(c *gin.Context) {
+	estado := controller.estadoPropietario(c)
+	if estado == nil {
+		return
+	}
+	pdf, err := services.PDFEstadoPropietario(estado)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", `attachment; filename="estado-cuenta-`+strconv.Itoa(estado.IDPropietario)+"-"+estado.Periodo+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// GET /propietarios/:id/estado-cuenta/csv?anio=&mes=
+func (controller *ComisionesController) DownloadEstadoPropietarioCSV(c *gin.Context) {
+	estado := controller.estadoPropietario(c)
+	if estado == nil {
+		return
+	}
+	tabla, err := services.CSVEstadoPropietario(estado)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="estado-cuenta-`+strconv.Itoa(estado.IDPropietario)+"-"+estado.Periodo+`.csv"`)
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", tabla)
+}
+
+// POST /propietarios/:id/estado-cuenta/enviar?anio=&mes=
+// Manda el estado de cuenta en PDF y CSV al correo del propietario
+func (controller *ComisionesController) EnviarEstadoPropietario(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	var filtro models.FiltroPeriodo
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Filtro inválido", "details": err.Error()})
+		return
+	}
+
+	estado, err := controller.Service.EnviarEstadoPropietario(id, &filtro)
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Propietario no encontrado"})
+			return
+		}
+		if abortComisionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Estado de cuenta enviado", "correo": estado.Correo, "periodo": estado.Periodo})
+}
@@ -3,21 +3,27 @@ package controllers
 import (
 	"backend/internal/models"
 	"backend/internal/services"
+	"errors"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ContratosController struct {
-	Service *services.ContratosService
+	Service              *services.ContratosService
+	ArchivosService      *services.ArchivosService
+	AuthorizationService *services.AuthorizationService
 }
 
 // Constructor para ContratosController
-func NewContratosController(service *services.ContratosService) *ContratosController {
+func NewContratosController(service *services.ContratosService, archivosService *services.ArchivosService, authorizationService *services.AuthorizationService) *ContratosController {
 	return &ContratosController{
-		Service: service,
+		Service:              service,
+		ArchivosService:      archivosService,
+		AuthorizationService: authorizationService,
 	}
 }
 
@@ -44,14 +50,18 @@ func (controller *ContratosController) GetContrato(c *gin.Context) {
 }
 
 func (controller *ContratosController) GetContratos(c *gin.Context) {
-	contratos, err := controller.Service.GetContratos()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve contratos"})
+	page, ok := bindPage(c)
+	if !ok {
 		return
 	}
 
-	if contratos == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No contratos found"})
+	contratos, err := controller.Service.GetContratos(page)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve contratos"})
 		return
 	}
 
@@ -84,8 +94,16 @@ func (controller *ContratosController) CreateContrato(c *gin.Context) {
 		return
 	}
 
+	// Solo el dueño de la propiedad puede registrarle contratos
+	if services.AbortIfDenied(c, controller.AuthorizationService.CanModify(services.ClaimsFromContext(c), services.ResourcePropiedad, contrato.IDPropiedad)) {
+		return
+	}
+
 	id, err := controller.Service.InsertContrato(&contrato)
 	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
 		log.Println("Error insertando contrato:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
 		return
@@ -108,14 +126,27 @@ func (controller *ContratosController) UpdateContrato(c *gin.Context) {
 		return
 	}
 
+	// La ruta ya valido el contrato, aqui se valida la propiedad a la que queda ligado
+	if services.AbortIfDenied(c, controller.AuthorizationService.CanModify(services.ClaimsFromContext(c), services.ResourcePropiedad, contrato.IDPropiedad)) {
+		return
+	}
+
 	err = controller.Service.UpdateContrato(&contrato, id)
 	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
 		log.Println("Error actualizando contrato:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
 		return
 	}
 
-	c.JSON(http.StatusOK, contrato)
+	actualizado, err := controller.Service.GetContrato(id)
+	if err != nil || actualizado == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, actualizado)
 }
 
 // Elimina un contrato por ID
@@ -126,12 +157,791 @@ func (controller *ContratosController) DeleteContrato(c *gin.Context) {
 		return
 	}
 
+	archivo, err := controller.Service.GetArchivoContrato(id)
+	if err != nil {
+		log.Println("Error recuperando PDF del contrato:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+
 	err = controller.Service.DeleteContrato(id)
 	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
 		log.Println("Error eliminando contrato:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
 		return
 	}
 
+	if archivo != nil {
+		controller.ArchivosService.Remove(archivo.Ruta)
+	}
+
 	c.JSON(http.StatusNoContent, nil)
 }
+
+// Sube el PDF de un contrato, reemplaza al anterior si ya tenia uno
+func (controller *ContratosController) UploadContratoPDF(c *gin.Context) {
+	limitUpload(c, services.ArchivoContrato)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	archivo, ok := saveUpload(c, controller.ArchivosService, services.ArchivoContrato)
+	if !ok {
+		return
+	}
+
+	anterior, err := controller.Service.SetArchivoContrato(id, archivo)
+	if err != nil {
+		controller.ArchivosService.Remove(archivo.Ruta)
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Contrato no encontrado"})
+			return
+		}
+		log.Println("Error guardando PDF del contrato:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	if anterior != nil {
+		controller.ArchivosService.Remove(anterior.Ruta)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id_contrato": id, "ruta_pdf": archivo.Ruta, "archivo": archivo})
+}
+
+// Descarga el PDF de un contrato
+func (controller *ContratosController) DownloadContratoPDF(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	archivo, err := controller.Service.GetArchivoContrato(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	if archivo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "El contrato no tiene un PDF subido"})
+		return
+	}
+
+	serveArchivo(c, controller.ArchivosService, archivo)
+}
+
+// abortContratoError responde los errores de validación de contratos, plantillas y generación, regresa false si es otro error
+func abortContratoError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrResourceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contrato no encontrado"})
+	case errors.Is(err, services.ErrInvalidContrato):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Contrato inválido", "details": err.Error()})
+	case errors.Is(err, services.ErrInvalidContacto):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de contacto inválidos", "details": err.Error()})
+	case errors.Is(err, services.ErrEstadoContrato):
+		c.JSON(http.StatusConflict, gin.H{"error": "El estado del contrato no permite el cambio", "details": err.Error()})
+	case errors.Is(err, services.ErrInvalidFilter):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Filtro inválido", "details": err.Error()})
+	case errors.Is(err, services.ErrInvalidPlantilla):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Plantilla inválida", "details": err.Error()})
+	case errors.Is(err, services.ErrInvalidGeneracion):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No se puede generar el contrato", "details": err.Error()})
+	case errors.Is(err, services.ErrInvalidCobranza):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Movimiento inválido", "details": err.Error()})
+	case errors.Is(err, services.ErrContratoSinPlantilla):
+		c.JSON(http.StatusConflict, gin.H{"error": "El contrato no se generó con una plantilla"})
+	default:
+		return false
+	}
+	return true
+}
+
+// GET /contratos/plantillas/variables
+// Marcadores que se pueden usar en el texto de una plantilla
+func (controller *ContratosController) GetVariablesPlantilla(c *gin.Context) {
+	c.JSON(http.StatusOK, controller.Service.GetVariablesPlantilla())
+}
+
+// GET /contratos/plantillas
+func (controller *ContratosController) GetPlantillas(c *gin.Context) {
+	plantillas, err := controller.Service.GetPlantillas()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, plantillas)
+}
+
+// GET /contratos/plantillas/:id
+func (controller *ContratosController) GetPlantilla(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	plantilla, err := controller.Service.GetPlantilla(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	if plantilla == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plantilla no encontrada"})
+		return
+	}
+	c.JSON(http.StatusOK, plantilla)
+}
+
+// GET /contratos/plantillas/:id/versiones/:version
+func (controller *ContratosController) GetVersionPlantilla(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Versión inválida"})
+		return
+	}
+
+	v, err := controller.Service.GetVersionPlantilla(id, version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	if v == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Versión no encontrada"})
+		return
+	}
+	c.JSON(http.StatusOK, v)
+}
+
+// POST /contratos/plantillas
+// Crea la plantilla, el contenido queda como versión 1
+func (controller *ContratosController) CreatePlantilla(c *gin.Context) {
+	var plantilla models.PlantillaContrato
+	if err := c.ShouldBindJSON(&plantilla); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	if _, err := controller.Service.CreatePlantilla(&plantilla, services.EmailFromContext(c)); err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusCreated, plantilla)
+}
+
+// PUT /contratos/plantillas/:id
+// Renombra o desactiva la plantilla, el texto se cambia agregando una versión
+func (controller *ContratosController) UpdatePlantilla(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var cambio models.CambioPlantilla
+	if err := c.ShouldBindJSON(&cambio); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	if err := controller.Service.UpdatePlantilla(id, &cambio); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Plantilla no encontrada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+
+	plantilla, err := controller.Service.GetPlantilla(id)
+	if err != nil || plantilla == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, plantilla)
+}
+
+// POST /contratos/plantillas/:id/versiones
+// Agrega una versión nueva del texto, los contratos generados con las anteriores no cambian
+func (controller *ContratosController) CreateVersionPlantilla(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var nueva models.NuevaVersionPlantilla
+	if err := c.ShouldBindJSON(&nueva); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	version, err := controller.Service.CreateVersionPlantilla(id, &nueva, services.EmailFromContext(c))
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Plantilla no encontrada"})
+			return
+		}
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusCreated, version)
+}
+
+// POST /contratos/:id/generar
+// Llena la plantilla con los datos de la propiedad, el propietario y el prospecto y guarda el PDF como el del contrato
+func (controller *ContratosController) GenerarContrato(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var req models.GenerarContrato
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	generacion, pdf, err := controller.Service.PrepararContrato(id, &req, services.EmailFromContext(c))
+	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+
+	archivo, err := controller.ArchivosService.SaveGenerado(services.ArchivoContrato, "contrato-"+strconv.Itoa(id)+".pdf", "application/pdf", pdf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar el archivo"})
+		return
+	}
+	anterior, err := controller.Service.GuardarGeneracion(generacion, archivo)
+	if err != nil {
+		controller.ArchivosService.Remove(archivo.Ruta)
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	if anterior != nil {
+		controller.ArchivosService.Remove(anterior.Ruta)
+	}
+
+	c.JSON(http.StatusCreated, generacion)
+}
+
+// POST /contratos/:id/regenerar
+// Vuelve a armar el PDF con la versión de plantilla y los datos con los que se generó, queda idéntico al original
+func (controller *ContratosController) RegenerarContrato(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	generacion, pdf, err := controller.Service.RegenerarContrato(id)
+	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+
+	archivo, err := controller.ArchivosService.SaveGenerado(services.ArchivoContrato, "contrato-"+strconv.Itoa(id)+".pdf", "application/pdf", pdf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar el archivo"})
+		return
+	}
+	anterior, err := controller.Service.SetArchivoContrato(id, archivo)
+	if err != nil {
+		controller.ArchivosService.Remove(archivo.Ruta)
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	if anterior != nil {
+		controller.ArchivosService.Remove(anterior.Ruta)
+	}
+
+	generacion.Archivo = archivo
+	c.JSON(http.StatusOK, generacion)
+}
+
+// GET /contratos/:id/generacion
+// Versión de plantilla y datos con los que se generó el PDF del contrato
+func (controller *ContratosController) GetGeneracion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	generacion, err := controller.Service.GetGeneracion(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	if generacion == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "El contrato no se generó con una plantilla"})
+		return
+	}
+	c.JSON(http.StatusOK, generacion)
+}
+
+// PUT /contratos/:id/partes
+// Reemplaza el propietario, el cliente y el fiador del contrato mientras es borrador
+func (controller *ContratosController) SetPartes(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var partes []*models.ParteContrato
+	if err := c.ShouldBindJSON(&partes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	guardadas, err := controller.Service.SetPartes(id, partes)
+	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, guardadas)
+}
+
+// PUT /contratos/:id/estado
+// Firma un borrador o rescinde un contrato firmado o vigente
+func (controller *ContratosController) CambiarEstado(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var cambio models.CambioEstadoContrato
+	if err := c.ShouldBindJSON(&cambio); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	contrato, err := controller.Service.CambiarEstado(id, &cambio)
+	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, contrato)
+}
+
+// GET /contratos/por-vencer?dias=60&usuario=
+// Contratos firmados o vigentes que terminan en los próximos días
+func (controller *ContratosController) GetPorVencer(c *gin.Context) {
+	var filtro models.FiltroPorVencer
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Filtro inválido", "details": err.Error()})
+		return
+	}
+
+	contratos, err := controller.Service.GetPorVencer(&filtro)
+	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, contratos)
+}
+
+// urlFirma es la dirección del frontend a la que se le agrega el token del enlace de firma. Sale de FIRMA_URL y
+// no del Host de la petición, que lo manda el cliente; si no está configurada responde 500 y regresa false
+func urlFirma(c *gin.Context) (string, bool) {
+	base := os.Getenv("FIRMA_URL")
+	if base == "" {
+		log.Print("FIRMA_URL not set, signing links cannot be sent")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "La firma electrónica no está configurada"})
+		return "", false
+	}
+	return base, true
+}
+
+// guardarFirmado arma el PDF con la constancia de firmas y lo liga al contrato
+func (controller *ContratosController) guardarFirmado(id int) (*models.Archivo, error) {
+	pdf, err := controller.Service.PDFFirmado(id)
+	if err != nil {
+		return nil, err
+	}
+	archivo, err := controller.ArchivosService.SaveGenerado(services.ArchivoContrato, "contrato-"+strconv.Itoa(id)+"-firmado.pdf", "application/pdf", pdf)
+	if err != nil {
+		return nil, err
+	}
+	anterior, err := controller.Service.GuardarFirmado(id, archivo)
+	if err != nil {
+		controller.ArchivosService.Remove(archivo.Ruta)
+		return nil, err
+	}
+	if anterior != nil {
+		controller.ArchivosService.Remove(anterior.Ruta)
+	}
+	return archivo, nil
+}
+
+// POST /contratos/:id/firmas
+// Manda a cada parte por correo su enlace para firmar el PDF generado
+func (controller *ContratosController) EnviarAFirma(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	base, ok := urlFirma(c)
+	if !ok {
+		return
+	}
+	firmas, err := controller.Service.EnviarAFirma(id, base)
+	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusCreated, firmas)
+}
+
+// POST /contratos/:id/firmas/:id_firma/reenviar
+// Manda un enlace nuevo a una parte que no ha firmado
+func (controller *ContratosController) ReenviarFirma(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	idFirma, err := strconv.Atoi(c.Param("id_firma"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de firma inválido"})
+		return
+	}
+
+	base, ok := urlFirma(c)
+	if !ok {
+		return
+	}
+	firma, err := controller.Service.ReenviarFirma(id, idFirma, base)
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Firma no encontrada"})
+			return
+		}
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, firma)
+}
+
+// DELETE /contratos/:id/firmas
+// Cancela la ronda de firmas del borrador
+func (controller *ContratosController) CancelarFirmas(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	if err := controller.Service.CancelarFirmas(id, services.EmailFromContext(c)); err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Firmas canceladas"})
+}
+
+// GET /contratos/:id/firmas
+// Solicitudes de firma y bitácora con IP, navegador, hora y SHA-256 del documento
+func (controller *ContratosController) GetFirmas(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	auditoria, err := controller.Service.GetFirmas(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	if auditoria == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contrato no encontrado"})
+		return
+	}
+	c.JSON(http.StatusOK, auditoria)
+}
+
+// GET /contratos/:id/pdf-firmado
+// Descarga el PDF final con la constancia de firmas, si no se pudo guardar al firmar se arma en ese momento
+func (controller *ContratosController) DownloadContratoFirmado(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	archivo, err := controller.Service.GetArchivoFirmado(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	if archivo == nil {
+		if archivo, err = controller.guardarFirmado(id); err != nil {
+			if abortContratoError(c, err) {
+				return
+			}
+			log.Println("Error guardando PDF firmado:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+			return
+		}
+	}
+
+	serveArchivo(c, controller.ArchivosService, archivo)
+}
+
+// abortFirmaError responde los errores de los enlaces de firma, regresa false si es otro error
+func abortFirmaError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrResourceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Enlace de firma no encontrado"})
+	case errors.Is(err, services.ErrFirmaNoDisponible):
+		c.JSON(http.StatusGone, gin.H{"error": "El enlace ya no es válido", "details": err.Error()})
+	case errors.Is(err, services.ErrInvalidFirma):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Firma inválida", "details": err.Error()})
+	default:
+		return abortContratoError(c, err)
+	}
+	return true
+}
+
+// GET /firmas/:token
+// Datos del contrato que ve la parte al abrir su enlace, no usa JWT porque el token de la URL es la credencial
+func (controller *ContratosController) GetSolicitudFirma(c *gin.Context) {
+	solicitud, err := controller.Service.GetSolicitudFirma(c.Param("token"), c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if abortFirmaError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, solicitud)
+}
+
+// GET /firmas/:token/pdf
+// PDF que la parte revisa antes de firmar
+func (controller *ContratosController) GetDocumentoFirma(c *gin.Context) {
+	archivo, err := controller.Service.GetDocumentoFirma(c.Param("token"))
+	if err != nil {
+		if abortFirmaError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	serveArchivo(c, controller.ArchivosService, archivo)
+}
+
+// POST /firmas/:token
+// Registra la firma de la parte, el enlace deja de funcionar. Con la última firma se arma el PDF final.
+func (controller *ContratosController) Firmar(c *gin.Context) {
+	var req models.FirmarContrato
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	id, completo, err := controller.Service.Firmar(c.Param("token"), &req, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if abortFirmaError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+
+	// La firma ya quedó, si el PDF final falla se vuelve a intentar al descargarlo
+	if completo {
+		if _, err := controller.guardarFirmado(id); err != nil {
+			log.Printf("Contrato %d: no se pudo guardar el PDF firmado: %v", id, err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"id_contrato": id, "firmado": completo})
+}
+
+// GET /contratos/:id/estado-cuenta?desde=&hasta=
+// Estado de cuenta de un contrato de renta
+func (controller *ContratosController) GetEstadoCuenta(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	var filtro models.FiltroEstadoCuenta
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Filtro inválido", "details": err.Error()})
+		return
+	}
+
+	estado, err := controller.Service.GetEstadoCuenta(id, &filtro)
+	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, estado)
+}
+
+// POST /contratos/:id/pagos
+// Registra un pago del inquilino
+func (controller *ContratosController) RegistrarPago(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	var pago models.PagoRenta
+	if err := c.ShouldBindJSON(&pago); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	registrado, err := controller.Service.RegistrarPago(id, &pago, services.EmailFromContext(c))
+	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusCreated, registrado)
+}
+
+// POST /contratos/:id/pagos/:id_pago/cancelar
+// Cancela un pago registrado por error
+func (controller *ContratosController) CancelarPago(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	idPago, err := strconv.Atoi(c.Param("id_pago"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de pago inválido"})
+		return
+	}
+	var cancelacion models.Cancelacion
+	if err := c.ShouldBindJSON(&cancelacion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	if err := controller.Service.CancelarPago(id, idPago, cancelacion.Motivo, services.EmailFromContext(c)); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pago no encontrado"})
+			return
+		}
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Pago cancelado"})
+}
+
+// POST /contratos/:id/cargos/:id_cargo/condonar
+// Condona un recargo por pago tardío
+func (controller *ContratosController) CondonarRecargo(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	idCargo, err := strconv.Atoi(c.Param("id_cargo"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de cargo inválido"})
+		return
+	}
+	var cancelacion models.Cancelacion
+	if err := c.ShouldBindJSON(&cancelacion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	if err := controller.Service.CondonarRecargo(id, idCargo, cancelacion.Motivo, services.EmailFromContext(c)); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cargo no encontrado"})
+			return
+		}
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Recargo condonado"})
+}
+
+// GET /contratos/cartera-vencida?usuario=&minimo_dias=
+// Contratos de renta con pagos vencidos y el saldo por antigüedad
+func (controller *ContratosController) GetCarteraVencida(c *gin.Context) {
+	var filtro models.FiltroCarteraVencida
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Filtro inválido", "details": err.Error()})
+		return
+	}
+
+	cartera, err := controller.Service.GetCarteraVencida(&filtro)
+	if err != nil {
+		if abortContratoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, cartera)
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/internal/models"
 	"backend/internal/services"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -13,12 +14,16 @@ import (
 // DocumentosAnexosController es el controlador para el modelo Documentos_Anexos
 type DocumentosAnexosController struct {
 	DocumentosAnexosService *services.DocumentosAnexosService
+	ArchivosService         *services.ArchivosService
+	AuthorizationService    *services.AuthorizationService
 }
 
 // NewDocumentosAnexosController es el constructor para DocumentosAnexosController
-func NewDocumentosAnexosController(service *services.DocumentosAnexosService) *DocumentosAnexosController {
+func NewDocumentosAnexosController(service *services.DocumentosAnexosService, archivosService *services.ArchivosService, authorizationService *services.AuthorizationService) *DocumentosAnexosController {
 	return &DocumentosAnexosController{
 		DocumentosAnexosService: service,
+		ArchivosService:         archivosService,
+		AuthorizationService:    authorizationService,
 	}
 }
 
@@ -54,14 +59,18 @@ func (ctrl *DocumentosAnexosController) GetDocumentosByPropiedad(c *gin.Context)
 		return
 	}
 
-	documentos, err := ctrl.DocumentosAnexosService.GetDocumentosByPropiedad(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los documentos anexos"})
+	page, ok := bindPage(c)
+	if !ok {
 		return
 	}
 
-	if len(documentos) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No se encontraron documentos anexos para la propiedad"})
+	documentos, err := ctrl.DocumentosAnexosService.GetDocumentosByPropiedad(id, page)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parámetros de paginación inválidos", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los documentos anexos"})
 		return
 	}
 
@@ -76,6 +85,11 @@ func (ctrl *DocumentosAnexosController) InsertDocumentoAnexo(c *gin.Context) {
 		return
 	}
 
+	// Solo el dueño de la propiedad puede anexarle documentos
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanModify(services.ClaimsFromContext(c), services.ResourcePropiedad, documento.IDPropiedad)) {
+		return
+	}
+
 	id, err := ctrl.DocumentosAnexosService.InsertDocumentoAnexo(&documento)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al insertar el documento anexo", "details": err.Error()})
@@ -86,7 +100,7 @@ func (ctrl *DocumentosAnexosController) InsertDocumentoAnexo(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"id_documento_anexo": id})
 }
 
-// PUT /documentos-anexos/:id
+// PUT /documentos_anexos/update/:id
 func (ctrl *DocumentosAnexosController) UpdateDocumentoAnexo(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
@@ -101,7 +115,18 @@ func (ctrl *DocumentosAnexosController) UpdateDocumentoAnexo(c *gin.Context) {
 		return
 	}
 
+	// El documento tiene que ser de una propiedad del agente y solo se puede pasar a otra suya
+	claims := services.ClaimsFromContext(c)
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanModify(claims, services.ResourceDocumentoAnexo, id)) ||
+		services.AbortIfDenied(c, ctrl.AuthorizationService.CanModify(claims, services.ResourcePropiedad, documento.IDPropiedad)) {
+		return
+	}
+
 	if err := ctrl.DocumentosAnexosService.UpdateDocumentoAnexo(&documento, id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Documento anexo no encontrado"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar el documento anexo", "details": err.Error()})
 		return
 	}
@@ -118,10 +143,80 @@ func (ctrl *DocumentosAnexosController) DeleteDocumentoAnexo(c *gin.Context) {
 		return
 	}
 
+	archivo, err := ctrl.DocumentosAnexosService.GetArchivoDocumentoAnexo(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el documento anexo"})
+		return
+	}
+
 	if err := ctrl.DocumentosAnexosService.DeleteDocumentoAnexo(id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Documento anexo no encontrado"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar el documento anexo", "details": err.Error()})
 		return
 	}
 
+	if archivo != nil {
+		ctrl.ArchivosService.Remove(archivo.Ruta)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Documento anexo eliminado correctamente"})
 }
+
+// POST /documentos-anexos/upload
+// Formulario multipart con archivo, id_propiedad y descripcion_documento_anexo
+func (ctrl *DocumentosAnexosController) UploadDocumentoAnexo(c *gin.Context) {
+	limitUpload(c, services.ArchivoDocumento)
+
+	idPropiedad, err := strconv.Atoi(c.PostForm("id_propiedad"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de propiedad inválido"})
+		return
+	}
+
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanModify(services.ClaimsFromContext(c), services.ResourcePropiedad, idPropiedad)) {
+		return
+	}
+
+	archivo, ok := saveUpload(c, ctrl.ArchivosService, services.ArchivoDocumento)
+	if !ok {
+		return
+	}
+
+	documento := models.DocumentoAnexo{
+		DescripcionDocumento: c.PostForm("descripcion_documento_anexo"),
+		IDPropiedad:          idPropiedad,
+	}
+	id, err := ctrl.DocumentosAnexosService.InsertDocumentoAnexoArchivo(&documento, archivo)
+	if err != nil {
+		ctrl.ArchivosService.Remove(archivo.Ruta)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al insertar el documento anexo", "details": err.Error()})
+		return
+	}
+
+	log.Printf("Documento anexo subido con ID: %d", id)
+	c.JSON(http.StatusCreated, gin.H{"id_documento_anexo": id, "ruta_documento": archivo.Ruta, "archivo": archivo})
+}
+
+// GET /documentos-anexos/archivo/:id
+func (ctrl *DocumentosAnexosController) DownloadDocumentoAnexo(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de documento anexo inválido"})
+		return
+	}
+
+	archivo, err := ctrl.DocumentosAnexosService.GetArchivoDocumentoAnexo(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el documento anexo"})
+		return
+	}
+	if archivo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "El documento anexo no tiene un archivo subido"})
+		return
+	}
+
+	serveArchivo(c, ctrl.ArchivosService, archivo)
+}
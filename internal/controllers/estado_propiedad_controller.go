@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/internal/models"
 	"backend/internal/services"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,11 +13,13 @@ import (
 
 type EstadoPropiedadController struct {
 	EstadoPropiedadService *services.EstadoPropiedadService
+	AuthorizationService   *services.AuthorizationService
 }
 
-func NewEstadoPropiedadController(estadoPropiedadService *services.EstadoPropiedadService) *EstadoPropiedadController {
+func NewEstadoPropiedadController(estadoPropiedadService *services.EstadoPropiedadService, authorizationService *services.AuthorizationService) *EstadoPropiedadController {
 	return &EstadoPropiedadController{
 		EstadoPropiedadService: estadoPropiedadService,
+		AuthorizationService:   authorizationService,
 	}
 }
 
@@ -51,8 +54,23 @@ func (ctrl *EstadoPropiedadController) CreateEstadoPropiedad(c *gin.Context) {
 		return
 	}
 
-	id, err := ctrl.EstadoPropiedadService.CreateEstadoPropiedad(&estadoPropiedad)
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanModify(services.ClaimsFromContext(c), services.ResourcePropiedad, estadoPropiedad.IDPropiedad)) {
+		return
+	}
+
+	id, err := ctrl.EstadoPropiedadService.CreateEstadoPropiedad(&estadoPropiedad, services.EmailFromContext(c))
 	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrResourceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No propiedad found"})
+			return
+		case errors.Is(err, services.ErrInvalidEstado):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid estado", "details": err.Error()})
+			return
+		case errors.Is(err, services.ErrEstadoExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "The propiedad already has an estado, use PUT /propiedades/:id/estado to change it"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert estado propiedad"})
 		return
 	}
@@ -61,25 +79,6 @@ func (ctrl *EstadoPropiedadController) CreateEstadoPropiedad(c *gin.Context) {
 	c.JSON(http.StatusCreated, estadoPropiedad)
 }
 
-// PUT /Update/EstadoPropiedad/:id
-// Function that updates the state of the property
-// func (ctrl *EstadoPropiedadController) UpdateEstadoPropiedad(c *gin.Context) {
-// 	var estadoPropiedad models.EstadoPropiedades
-// 	if err := c.ShouldBindJSON(&estadoPropiedad); err != nil {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-// 		return
-// 	}
-
-// 	err := ctrl.EstadoPropiedadService.UpdateEstadoPropiedad(&estadoPropiedad)
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update estado propiedad"})
-// 		return
-// 	}
-// 	log.Printf("Updated estado propiedad with ID: %d", estadoPropiedad.IDEstadoPropiedades)
-
-// 	c.JSON(http.StatusOK, estadoPropiedad)
-// }
-
 // DELETE /eliminar/estadoPropiedad
 // Function that deletes a EstadoPropiedad from the database
 func (ctrl *EstadoPropiedadController) DeleteEstadoPropiedad(c *gin.Context) {
@@ -92,6 +91,10 @@ func (ctrl *EstadoPropiedadController) DeleteEstadoPropiedad(c *gin.Context) {
 
 	err = ctrl.EstadoPropiedadService.DeleteEstadoPropiedad(id)
 	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No estado propiedad found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete estado propiedad"})
 		return
 	}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/internal/models"
 	"backend/internal/services"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,13 +13,19 @@ import (
 
 // ImagenesController es el controlador para el modelo Imagenes
 type ImagenesController struct {
-	ImagenesService *services.ImagenesService
+	ImagenesService      *services.ImagenesService
+	ArchivosService      *services.ArchivosService
+	VariantesService     *services.VariantesService
+	AuthorizationService *services.AuthorizationService
 }
 
 // NewImagenesController es el constructor para ImagenesController
-func NewImagenesController(imagenesService *services.ImagenesService) *ImagenesController {
+func NewImagenesController(imagenesService *services.ImagenesService, archivosService *services.ArchivosService, variantesService *services.VariantesService, authorizationService *services.AuthorizationService) *ImagenesController {
 	return &ImagenesController{
-		ImagenesService: imagenesService,
+		ImagenesService:      imagenesService,
+		ArchivosService:      archivosService,
+		VariantesService:     variantesService,
+		AuthorizationService: authorizationService,
 	}
 }
 
@@ -76,14 +83,18 @@ func (ctrl *ImagenesController) GetImagenesByPropiedad(c *gin.Context) {
 		return
 	}
 
-	imagenes, err := ctrl.ImagenesService.GetImagenesByPropiedad(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las imágenes"})
+	page, ok := bindPage(c)
+	if !ok {
 		return
 	}
 
-	if len(imagenes) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No se encontraron imágenes para la propiedad"})
+	imagenes, err := ctrl.ImagenesService.GetImagenesByPropiedad(id, page)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parámetros de paginación inválidos", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las imágenes"})
 		return
 	}
 
@@ -98,8 +109,17 @@ func (ctrl *ImagenesController) InsertImagen(c *gin.Context) {
 		return
 	}
 
+	// Solo el dueño de la propiedad puede agregarle imágenes
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanModify(services.ClaimsFromContext(c), services.ResourcePropiedad, imagen.IDPropiedad)) {
+		return
+	}
+
 	id, err := ctrl.ImagenesService.InsertImagen(&imagen)
 	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Propiedad no encontrada"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al insertar la imagen", "details": err.Error()})
 		return
 	}
@@ -108,7 +128,7 @@ func (ctrl *ImagenesController) InsertImagen(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"id_imagen": id})
 }
 
-// PUT /imagenes/:id
+// PUT /imagenes/update/:id
 func (ctrl *ImagenesController) UpdateImagen(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
@@ -123,7 +143,18 @@ func (ctrl *ImagenesController) UpdateImagen(c *gin.Context) {
 		return
 	}
 
+	// La imagen tiene que ser de una propiedad del agente, no basta con la propiedad que manda el cliente
+	claims := services.ClaimsFromContext(c)
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanModify(claims, services.ResourceImagen, id)) ||
+		services.AbortIfDenied(c, ctrl.AuthorizationService.CanModify(claims, services.ResourcePropiedad, imagen.IDPropiedad)) {
+		return
+	}
+
 	if err := ctrl.ImagenesService.UpdateImagen(&imagen, id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Imagen no encontrada"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar la imagen", "details": err.Error()})
 		return
 	}
@@ -140,10 +171,168 @@ func (ctrl *ImagenesController) DeleteImagen(c *gin.Context) {
 		return
 	}
 
+	rutas, err := ctrl.ImagenesService.GetRutasArchivos(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la imagen"})
+		return
+	}
+
 	if err := ctrl.ImagenesService.DeleteImagen(id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Imagen no encontrada"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar la imagen", "details": err.Error()})
 		return
 	}
 
+	for _, ruta := range rutas {
+		ctrl.ArchivosService.Remove(ruta)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Imagen eliminada correctamente"})
 }
+
+// PUT /imagenes/:id/principal
+// Deja la imagen como la única principal, la anterior deja de serlo en la misma transacción
+func (ctrl *ImagenesController) SetImagenPrincipal(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de imagen inválido"})
+		return
+	}
+
+	if err := ctrl.ImagenesService.SetImagenPrincipal(id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Imagen no encontrada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cambiar la imagen principal", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Imagen principal actualizada correctamente"})
+}
+
+// PUT /imagenes/propiedad/:id/orden
+// Recibe {"ids": [...]} con todas las imágenes del propiedad en el orden de la galería
+func (ctrl *ImagenesController) ReordenarImagenes(c *gin.Context) {
+	idPropiedad, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de propiedad inválido"})
+		return
+	}
+
+	var orden models.OrdenImagenes
+	if err := c.ShouldBindJSON(&orden); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	if err := ctrl.ImagenesService.ReordenarImagenes(idPropiedad, orden.IDs); err != nil {
+		if errors.Is(err, services.ErrInvalidImageOrder) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Orden de imágenes inválido", "details": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Propiedad no encontrada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al reordenar las imágenes", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Imágenes reordenadas correctamente"})
+}
+
+// POST /imagenes/upload
+// Formulario multipart con archivo, id_propiedad, descripcion_imagen y principal.
+// Las variantes se generan en segundo plano y aparecen despues en el listado de imagenes.
+func (ctrl *ImagenesController) UploadImagen(c *gin.Context) {
+	limitUpload(c, services.ArchivoImagen)
+
+	idPropiedad, err := strconv.Atoi(c.PostForm("id_propiedad"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de propiedad inválido"})
+		return
+	}
+	principal := false
+	if value := c.PostForm("principal"); value != "" {
+		if principal, err = strconv.ParseBool(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El campo principal debe ser true o false"})
+			return
+		}
+	}
+
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanModify(services.ClaimsFromContext(c), services.ResourcePropiedad, idPropiedad)) {
+		return
+	}
+
+	archivo, ok := saveUpload(c, ctrl.ArchivosService, services.ArchivoImagen)
+	if !ok {
+		return
+	}
+
+	imagen := models.Imagen{
+		Descripcion: c.PostForm("descripcion_imagen"),
+		Principal:   principal,
+		IDPropiedad: idPropiedad,
+	}
+	id, err := ctrl.ImagenesService.InsertImagenArchivo(&imagen, archivo)
+	if err != nil {
+		ctrl.ArchivosService.Remove(archivo.Ruta)
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Propiedad no encontrada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al insertar la imagen", "details": err.Error()})
+		return
+	}
+
+	ctrl.VariantesService.EncolarImagen(id)
+
+	log.Printf("Imagen subida con ID: %d", id)
+	c.JSON(http.StatusCreated, gin.H{"id_imagen": id, "ruta_imagen": archivo.Ruta, "archivo": archivo})
+}
+
+// GET /imagenes/archivo/:id
+func (ctrl *ImagenesController) DownloadImagen(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de imagen inválido"})
+		return
+	}
+
+	archivo, err := ctrl.ImagenesService.GetArchivoImagen(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la imagen"})
+		return
+	}
+	if archivo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "La imagen no tiene un archivo subido"})
+		return
+	}
+
+	serveArchivo(c, ctrl.ArchivosService, archivo)
+}
+
+// GET /imagenes/archivo/:id/:variante
+func (ctrl *ImagenesController) DownloadVariante(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de imagen inválido"})
+		return
+	}
+
+	archivo, err := ctrl.ImagenesService.GetArchivoVariante(id, c.Param("variante"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la imagen"})
+		return
+	}
+	if archivo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variante no encontrada"})
+		return
+	}
+
+	serveArchivo(c, ctrl.ArchivosService, archivo)
+}
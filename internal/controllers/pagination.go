@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"backend/internal/models"
+)
+
+// bindPage lee limit, offset y cursor del query string, responde 400 y regresa false si no son validos
+func bindPage(c *gin.Context) (*models.PageRequest, bool) {
+	var page models.PageRequest
+	if err := c.ShouldBindQuery(&page); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters", "details": err.Error()})
+		return nil, false
+	}
+	return &page, true
+}
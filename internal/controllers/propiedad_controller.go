@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/internal/models"
 	"backend/internal/services"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -14,59 +15,68 @@ import (
 type Propiedad_Controller struct {
 	PropiedadService       *services.PropiedadService
 	EstadoPropiedadService *services.EstadoPropiedadService
+	CitasService           *services.CitasService
+	ProspectoService       *services.ProspectoService
+	AuthorizationService   *services.AuthorizationService
 }
 
 // NewUserController is the constructor for the UserController
-func NewPropiedadController(propiedadService *services.PropiedadService, estadoPropiedadService *services.EstadoPropiedadService) *Propiedad_Controller {
+func NewPropiedadController(propiedadService *services.PropiedadService, estadoPropiedadService *services.EstadoPropiedadService, citasService *services.CitasService, prospectoService *services.ProspectoService, authorizationService *services.AuthorizationService) *Propiedad_Controller {
 	return &Propiedad_Controller{
 		PropiedadService:       propiedadService,
 		EstadoPropiedadService: estadoPropiedadService,
+		CitasService:           citasService,
+		ProspectoService:       prospectoService,
+		AuthorizationService:   authorizationService,
 	}
 }
 
 // GET /all/propiedades/
 func (ctrl *Propiedad_Controller) GetAllPropiedades(c *gin.Context) {
-	propiedades, err := ctrl.PropiedadService.GetAllPropiedades()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve propiedades"})
+	page, ok := bindPage(c)
+	if !ok {
 		return
 	}
 
-	if propiedades == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No propiedades found"})
+	propiedades, err := ctrl.PropiedadService.GetAllPropiedades(page)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve propiedades"})
 		return
 	}
 
 	c.JSON(http.StatusOK, propiedades)
 }
 
-func (ctrl *Propiedad_Controller) GetAllPropiedadesByPrice(c *gin.Context) {
-	propiedades, err := ctrl.PropiedadService.GetAllPropiedadesByPrice()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve propiedades"})
+// GET /propiedades/search
+func (ctrl *Propiedad_Controller) SearchPropiedades(c *gin.Context) {
+	var filtro models.PropiedadFiltro
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search filters", "details": err.Error()})
 		return
 	}
-
-	if propiedades == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No propiedades found"})
+	page, ok := bindPage(c)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, propiedades)
-}
-
-func (ctrl *Propiedad_Controller) GetAllPropiedadesByBedrooms(c *gin.Context) {
-	propiedades, err := ctrl.PropiedadService.GetAllPropiedadesByBedrooms()
+	propiedades, err := ctrl.PropiedadService.SearchPropiedades(&filtro, page)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search filters", "details": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidPage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters", "details": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve propiedades"})
 		return
 	}
 
-	if propiedades == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No propiedades found"})
-		return
-	}
-
 	c.JSON(http.StatusOK, propiedades)
 }
 
@@ -113,8 +123,21 @@ func (ctrl *Propiedad_Controller) CreatePropiedad(c *gin.Context) {
 	// Print the request payload after binding
 	fmt.Printf("Request payload after binding: %+v\n", request)
 
-	IDPropiedad, IDEstadoPropiedad, err := ctrl.PropiedadService.InsertPropiedad(&request.Propiedad, &request.EstadoPropiedades)
+	// Los agentes solo pueden dar de alta propiedades a su nombre
+	claims := services.ClaimsFromContext(c)
+	if request.Propiedad.IDUsuario == "" && claims != nil {
+		request.Propiedad.IDUsuario = claims.Email
+	}
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(claims, request.Propiedad.IDUsuario)) {
+		return
+	}
+
+	IDPropiedad, IDEstadoPropiedad, err := ctrl.PropiedadService.InsertPropiedad(&request.Propiedad, &request.EstadoPropiedades, services.EmailFromContext(c))
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidEstado) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid estado", "details": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create propiedad", "details": err.Error()})
 		return
 	}
@@ -122,6 +145,35 @@ func (ctrl *Propiedad_Controller) CreatePropiedad(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"id_propiedad": IDPropiedad, "id_estado_propiedades": IDEstadoPropiedad})
 }
 
+// POST /propiedades/create/completa
+// Crea la propiedad con su estado inicial, imágenes y documentos anexos, si algo falla no se guarda nada
+func (ctrl *Propiedad_Controller) CreatePropiedadCompleta(c *gin.Context) {
+	var request models.PropiedadCompleta
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	claims := services.ClaimsFromContext(c)
+	if request.Propiedad.IDUsuario == "" && claims != nil {
+		request.Propiedad.IDUsuario = claims.Email
+	}
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(claims, request.Propiedad.IDUsuario)) {
+		return
+	}
+
+	if err := ctrl.PropiedadService.CreatePropiedadCompleta(&request, services.EmailFromContext(c)); err != nil {
+		if errors.Is(err, services.ErrInvalidEstado) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid estado", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create propiedad", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, request)
+}
+
 // PUT /propiedad/:id
 func (ctrl *Propiedad_Controller) UpdatePropiedad(c *gin.Context) {
 	idParam := c.Param("id")
@@ -137,8 +189,21 @@ func (ctrl *Propiedad_Controller) UpdatePropiedad(c *gin.Context) {
 		return
 	}
 
+	// La ruta ya valido que la propiedad es del usuario, aqui se evita que un agente la pase a otro
+	claims := services.ClaimsFromContext(c)
+	if propiedad.IDUsuario == "" && claims != nil {
+		propiedad.IDUsuario = claims.Email
+	}
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(claims, propiedad.IDUsuario)) {
+		return
+	}
+
 	err = ctrl.PropiedadService.UpdatePropiedad(&propiedad, id)
 	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No propiedad found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update propiedad"})
 		return
 	}
@@ -155,17 +220,132 @@ func (ctrl *Propiedad_Controller) DeletePropiedad(c *gin.Context) {
 		return
 	}
 
-	err = ctrl.EstadoPropiedadService.DeleteEstadoPropiedad(id)
+	err = ctrl.PropiedadService.DeletePropiedad(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete estado_propiedad"})
+		switch {
+		case errors.Is(err, services.ErrResourceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No propiedad found"})
+		case errors.Is(err, services.ErrPropiedadConRegistros):
+			c.JSON(http.StatusConflict, gin.H{"error": "The propiedad still has images, documents or contracts", "details": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete propiedad"})
+		}
 		return
 	}
 
-	err = ctrl.PropiedadService.DeletePropiedad(id)
+	c.JSON(http.StatusOK, gin.H{"message": "Propiedad and Estado deleted"})
+}
+
+// PUT /propiedades/:id/estado
+// Cambia el estado de la propiedad siguiendo disponible -> apartada -> vendida/rentada, una renta regresa a disponible
+func (ctrl *Propiedad_Controller) CambiarEstado(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete propiedad"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid propiedad ID"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Propiedad and Estado deleted"})
+	var cambio models.CambioEstadoPropiedad
+	if err := c.ShouldBindJSON(&cambio); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	estado, err := ctrl.EstadoPropiedadService.CambiarEstado(id, &cambio, services.EmailFromContext(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrResourceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No estado propiedad found"})
+		case errors.Is(err, services.ErrInvalidEstado):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid estado", "details": err.Error()})
+		case errors.Is(err, services.ErrInvalidTransition):
+			c.JSON(http.StatusConflict, gin.H{"error": "Invalid estado transition", "details": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update estado propiedad"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, estado)
+}
+
+// GET /propiedades/:id/historial
+// Regresa los cambios de estado de la propiedad con quien los hizo y cuando
+func (ctrl *Propiedad_Controller) GetHistorial(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid propiedad ID"})
+		return
+	}
+
+	historial, err := ctrl.EstadoPropiedadService.GetHistorial(id)
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No propiedad found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve historial"})
+		return
+	}
+
+	c.JSON(http.StatusOK, historial)
+}
+
+// GET /propiedades/:id/visitas
+// Citas en las que se mostró la propiedad con su resultado, de la mas reciente a la mas antigua
+func (ctrl *Propiedad_Controller) GetVisitas(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid propiedad ID"})
+		return
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	visitas, err := ctrl.CitasService.GetVisitasPropiedad(id, page)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrResourceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No propiedad found"})
+		case errors.Is(err, services.ErrInvalidPage):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters", "details": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve visitas"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, visitas)
+}
+
+// GET /propiedades/:id/interesados?minimo=60&limite=20
+// Prospectos abiertos a los que les puede interesar la propiedad, con su puntaje
+func (ctrl *Propiedad_Controller) GetInteresados(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid propiedad ID"})
+		return
+	}
+	var filtro models.FiltroMatches
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+		return
+	}
+
+	interesados, err := ctrl.ProspectoService.GetInteresados(id, &filtro)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrResourceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No propiedad found"})
+		case errors.Is(err, services.ErrInvalidFilter):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve interesados"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, interesados)
 }
@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/internal/services"
 	"backend/internal/models"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -54,9 +55,181 @@ func (ctrl *PropietarioController) CreatePropietario(c *gin.Context) {
 
 	idPropietario, err := ctrl.PropietarioService.CreatePropietario(&propietario)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidContacto) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contact data", "details": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create propietario"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"id_propietario": idPropietario})
+}
+
+// GET /propietarios/duplicados?id=&minimo=70
+// Pares de propietarios que parecen la misma persona
+func (ctrl *PropietarioController) GetDuplicados(c *gin.Context) {
+	var filtro models.FiltroDuplicados
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+		return
+	}
+
+	duplicados, err := ctrl.PropietarioService.GetDuplicados(&filtro)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve duplicados"})
+		return
+	}
+
+	c.JSON(http.StatusOK, duplicados)
+}
+
+// POST /propietarios/fusionar
+// Pasa las propiedades del duplicado al propietario que se conserva y borra el duplicado
+func (ctrl *PropietarioController) Fusionar(c *gin.Context) {
+	var fusion models.Fusion
+	if err := c.ShouldBindJSON(&fusion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	propietario, err := ctrl.PropietarioService.Fusionar(&fusion)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrResourceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No propietario found"})
+		case errors.Is(err, services.ErrInvalidContacto):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge propietarios"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, propietario)
+}
+
+// GET /propietarios/all
+func (ctrl *PropietarioController) GetAllPropietarios(c *gin.Context) {
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	propietarios, err := ctrl.PropietarioService.GetAllPropietarios(page)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve propietarios"})
+		return
+	}
+
+	c.JSON(http.StatusOK, propietarios)
+}
+
+// GET /propietarios/search?q=&con_propiedades=
+func (ctrl *PropietarioController) SearchPropietarios(c *gin.Context) {
+	var filtro models.PropietarioFiltro
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+		return
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	propietarios, err := ctrl.PropietarioService.SearchPropietarios(&filtro, page)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve propietarios"})
+		return
+	}
+
+	c.JSON(http.StatusOK, propietarios)
+}
+
+// PUT /propietarios/update/:id
+func (ctrl *PropietarioController) UpdatePropietario(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid propietario ID"})
+		return
+	}
+
+	var propietario models.Propietario
+	if err := c.ShouldBindJSON(&propietario); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid propietario data", "details": err.Error()})
+		return
+	}
+	propietario.IDPropietario = id
+
+	if err := ctrl.PropietarioService.UpdatePropietario(&propietario); err != nil {
+		switch {
+		case errors.Is(err, services.ErrResourceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No propietario found"})
+		case errors.Is(err, services.ErrInvalidContacto):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contact data", "details": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update propietario"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, propietario)
+}
+
+// DELETE /propietarios/eliminar/:id
+// Responde 409 si el propietario todavía tiene propiedades
+func (ctrl *PropietarioController) DeletePropietario(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid propietario ID"})
+		return
+	}
+
+	if err := ctrl.PropietarioService.DeletePropietario(id); err != nil {
+		switch {
+		case errors.Is(err, services.ErrResourceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No propietario found"})
+		case errors.Is(err, services.ErrPropietarioConPropiedades):
+			c.JSON(http.StatusConflict, gin.H{"error": "The propietario still has propiedades", "details": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete propietario"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Propietario deleted"})
+}
+
+// GET /propietarios/:id/propiedades
+// Propiedades del propietario con su estado actual
+func (ctrl *PropietarioController) GetPortafolio(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid propietario ID"})
+		return
+	}
+
+	portafolio, err := ctrl.PropietarioService.GetPortafolio(id)
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No propietario found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve propiedades"})
+		return
+	}
+
+	c.JSON(http.StatusOK, portafolio)
 }
\ No newline at end of file
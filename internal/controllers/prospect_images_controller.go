@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/internal/models"
 	"backend/internal/services"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -13,12 +14,16 @@ import (
 // ImagenesController es el controlador para el modelo Imagenes
 type ImagenesProspectoController struct {
 	ImagenesProspectoService *services.ImagenesProspectoService
+	ArchivosService          *services.ArchivosService
+	VariantesService         *services.VariantesService
 }
 
 // NewImagenesController es el constructor para ImagenesController
-func NewImagenesProspectoController(imagenesProspectoService *services.ImagenesProspectoService) *ImagenesProspectoController {
+func NewImagenesProspectoController(imagenesProspectoService *services.ImagenesProspectoService, archivosService *services.ArchivosService, variantesService *services.VariantesService) *ImagenesProspectoController {
 	return &ImagenesProspectoController{
 		ImagenesProspectoService: imagenesProspectoService,
+		ArchivosService:          archivosService,
+		VariantesService:         variantesService,
 	}
 }
 
@@ -100,6 +105,10 @@ func (ctrl *ImagenesProspectoController) InsertImagen(c *gin.Context) {
 
 	id, err := ctrl.ImagenesProspectoService.InsertImagen(&imagen)
 	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Prospecto no encontrado"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al insertar la imagen", "details": err.Error()})
 		return
 	}
@@ -108,7 +117,7 @@ func (ctrl *ImagenesProspectoController) InsertImagen(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"id_imagen": id})
 }
 
-// PUT /imagenes/:id
+// PUT /imagenesProspecto/update/:id
 func (ctrl *ImagenesProspectoController) UpdateImagen(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
@@ -124,6 +133,10 @@ func (ctrl *ImagenesProspectoController) UpdateImagen(c *gin.Context) {
 	}
 
 	if err := ctrl.ImagenesProspectoService.UpdateImagen(&imagen, id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Imagen no encontrada"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar la imagen", "details": err.Error()})
 		return
 	}
@@ -140,10 +153,162 @@ func (ctrl *ImagenesProspectoController) DeleteImagen(c *gin.Context) {
 		return
 	}
 
+	rutas, err := ctrl.ImagenesProspectoService.GetRutasArchivos(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la imagen"})
+		return
+	}
+
 	if err := ctrl.ImagenesProspectoService.DeleteImagen(id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Imagen no encontrada"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar la imagen", "details": err.Error()})
 		return
 	}
 
+	for _, ruta := range rutas {
+		ctrl.ArchivosService.Remove(ruta)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Imagen eliminada correctamente"})
 }
+
+// PUT /imagenesProspecto/:id/principal
+// Deja la imagen como la única principal, la anterior deja de serlo en la misma transacción
+func (ctrl *ImagenesProspectoController) SetImagenPrincipal(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de imagen inválido"})
+		return
+	}
+
+	if err := ctrl.ImagenesProspectoService.SetImagenPrincipal(id); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Imagen no encontrada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cambiar la imagen principal", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Imagen principal actualizada correctamente"})
+}
+
+// PUT /imagenesProspecto/prospecto/:id/orden
+// Recibe {"ids": [...]} con todas las imágenes del prospecto en el orden de la galería
+func (ctrl *ImagenesProspectoController) ReordenarImagenes(c *gin.Context) {
+	idProspecto, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de prospecto inválido"})
+		return
+	}
+
+	var orden models.OrdenImagenes
+	if err := c.ShouldBindJSON(&orden); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de entrada inválidos", "details": err.Error()})
+		return
+	}
+
+	if err := ctrl.ImagenesProspectoService.ReordenarImagenes(idProspecto, orden.IDs); err != nil {
+		if errors.Is(err, services.ErrInvalidImageOrder) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Orden de imágenes inválido", "details": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Prospecto no encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al reordenar las imágenes", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Imágenes reordenadas correctamente"})
+}
+
+// POST /imagenesProspecto/upload
+// Formulario multipart con archivo, id_prospecto, descripcion_imagen y principal
+func (ctrl *ImagenesProspectoController) UploadImagen(c *gin.Context) {
+	limitUpload(c, services.ArchivoImagenProspecto)
+
+	idProspecto, err := strconv.Atoi(c.PostForm("id_prospecto"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de prospecto inválido"})
+		return
+	}
+	principal := false
+	if value := c.PostForm("principal"); value != "" {
+		if principal, err = strconv.ParseBool(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El campo principal debe ser true o false"})
+			return
+		}
+	}
+
+	archivo, ok := saveUpload(c, ctrl.ArchivosService, services.ArchivoImagenProspecto)
+	if !ok {
+		return
+	}
+
+	imagen := models.ImagenProspecto{
+		Descripcion: c.PostForm("descripcion_imagen"),
+		Principal:   principal,
+		IDProspecto: idProspecto,
+	}
+	id, err := ctrl.ImagenesProspectoService.InsertImagenArchivo(&imagen, archivo)
+	if err != nil {
+		ctrl.ArchivosService.Remove(archivo.Ruta)
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Prospecto no encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al insertar la imagen", "details": err.Error()})
+		return
+	}
+	ctrl.VariantesService.EncolarImagenProspecto(id)
+
+	log.Printf("Imagen de prospecto subida con ID: %d", id)
+	c.JSON(http.StatusCreated, gin.H{"id_imagen": id, "ruta_imagen": archivo.Ruta, "archivo": archivo})
+}
+
+// GET /imagenesProspecto/archivo/:id
+func (ctrl *ImagenesProspectoController) DownloadImagen(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de imagen inválido"})
+		return
+	}
+
+	archivo, err := ctrl.ImagenesProspectoService.GetArchivoImagen(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la imagen"})
+		return
+	}
+	if archivo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "La imagen no tiene un archivo subido"})
+		return
+	}
+
+	serveArchivo(c, ctrl.ArchivosService, archivo)
+}
+
+// GET /imagenesProspecto/archivo/:id/:variante
+func (ctrl *ImagenesProspectoController) DownloadVariante(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de imagen inválido"})
+		return
+	}
+
+	archivo, err := ctrl.ImagenesProspectoService.GetArchivoVariante(id, c.Param("variante"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la imagen"})
+		return
+	}
+	if archivo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variante no encontrada"})
+		return
+	}
+
+	serveArchivo(c, ctrl.ArchivosService, archivo)
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/internal/models"
 	"backend/internal/services"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,13 +13,15 @@ import (
 
 // UserController is the controller for the User model
 type ProspectoController struct {
-	ProspectoService *services.ProspectoService
+	ProspectoService     *services.ProspectoService
+	AuthorizationService *services.AuthorizationService
 }
 
 // NewUserController is the constructor for the UserController
-func NewProspectoController(prospectoService *services.ProspectoService) *ProspectoController {
+func NewProspectoController(prospectoService *services.ProspectoService, authorizationService *services.AuthorizationService) *ProspectoController {
 	return &ProspectoController{
-		ProspectoService: prospectoService,
+		ProspectoService:     prospectoService,
+		AuthorizationService: authorizationService,
 	}
 }
 
@@ -57,8 +60,18 @@ func (ctrl *ProspectoController) InsertProspecto(c *gin.Context) {
 
 	// fmt.Printf("Request payload after binding: %+v\n", request)
 
+	// Si no se manda agente el prospecto queda asignado a quien lo registra
+	if prospecto.Usuario == "" {
+		prospecto.Usuario = services.EmailFromContext(c)
+	}
+	if services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(services.ClaimsFromContext(c), prospecto.Usuario)) {
+		return
+	}
 	id, err := ctrl.ProspectoService.InsertProspecto(&prospecto)
 	if err != nil {
+		if abortProspectoError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create propiedad", "details": err.Error()})
 		return
 	}
@@ -85,11 +98,280 @@ func (ctrl *ProspectoController) UpdateProspecto(c *gin.Context) {
 
 	// fmt.Printf("Request payload after binding: %+v\n", request)
 
-	err = ctrl.ProspectoService.UpdateProspecto(&prospecto, id)
+	// La ruta ya valido que el prospecto es del usuario, aqui se evita que un agente se lo pase a otro
+	if prospecto.Usuario != "" && services.AbortIfDenied(c, ctrl.AuthorizationService.CanActAs(services.ClaimsFromContext(c), prospecto.Usuario)) {
+		return
+	}
+	err = ctrl.ProspectoService.UpdateProspecto(&prospecto, id, services.EmailFromContext(c))
 	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No prospecto found"})
+			return
+		}
+		if abortProspectoError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create propiedad", "details": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, prospecto)
 }
+
+// abortProspectoError responde los errores de validación del pipeline, regresa false si el error es otro
+func abortProspectoError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrInvalidProspecto):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prospecto", "details": err.Error()})
+	case errors.Is(err, services.ErrInvalidContacto):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contact data", "details": err.Error()})
+	case errors.Is(err, services.ErrEtapaExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "The etapa already exists"})
+	case errors.Is(err, services.ErrInvalidFilter):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+	case errors.Is(err, services.ErrInvalidPage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters", "details": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
+
+// GET /prospectos/pipeline?usuario=&origen=&limite=50
+// Tablero de prospectos agrupado por etapa
+func (ctrl *ProspectoController) GetPipeline(c *gin.Context) {
+	var filtro models.FiltroPipeline
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+		return
+	}
+
+	pipeline, err := ctrl.ProspectoService.GetPipeline(&filtro)
+	if err != nil {
+		if abortProspectoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pipeline"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pipeline)
+}
+
+// GET /prospectos/etapas
+func (ctrl *ProspectoController) GetEtapas(c *gin.Context) {
+	etapas, err := ctrl.ProspectoService.GetEtapas()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve etapas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, etapas)
+}
+
+// POST /prospectos/etapas
+func (ctrl *ProspectoController) CreateEtapa(c *gin.Context) {
+	var etapa models.EtapaProspecto
+	if err := c.ShouldBindJSON(&etapa); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	if err := ctrl.ProspectoService.CreateEtapa(&etapa); err != nil {
+		if abortProspectoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create etapa"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, etapa)
+}
+
+// PUT /prospectos/etapas/:clave
+func (ctrl *ProspectoController) UpdateEtapa(c *gin.Context) {
+	var etapa models.EtapaProspecto
+	// La clave viene en la ruta
+	etapa.Clave = c.Param("clave")
+	if err := c.ShouldBindJSON(&etapa); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	if err := ctrl.ProspectoService.UpdateEtapa(c.Param("clave"), &etapa); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No etapa found"})
+			return
+		}
+		if abortProspectoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update etapa"})
+		return
+	}
+
+	c.JSON(http.StatusOK, etapa)
+}
+
+// PUT /prospectos/:id/etapa
+// Mueve al prospecto a otra etapa, el cambio queda en la línea de tiempo
+func (ctrl *ProspectoController) CambiarEtapa(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prospecto ID"})
+		return
+	}
+	var cambio models.CambioEtapaProspecto
+	if err := c.ShouldBindJSON(&cambio); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	if err := ctrl.ProspectoService.CambiarEtapa(id, &cambio, services.EmailFromContext(c)); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No prospecto found"})
+			return
+		}
+		if abortProspectoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update etapa"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cambio)
+}
+
+// GET /prospectos/:id/actividades?limit=&offset=
+// Línea de tiempo del prospecto: notas, llamadas, correos, cambios de etapa y citas
+func (ctrl *ProspectoController) GetActividades(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prospecto ID"})
+		return
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	actividades, err := ctrl.ProspectoService.GetActividades(id, page)
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No prospecto found"})
+			return
+		}
+		if abortProspectoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve actividades"})
+		return
+	}
+
+	c.JSON(http.StatusOK, actividades)
+}
+
+// POST /prospectos/:id/actividades
+func (ctrl *ProspectoController) RegistrarActividad(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prospecto ID"})
+		return
+	}
+	var nueva models.NuevaActividad
+	if err := c.ShouldBindJSON(&nueva); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	actividad, err := ctrl.ProspectoService.RegistrarActividad(id, &nueva, services.EmailFromContext(c))
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No prospecto found"})
+			return
+		}
+		if abortProspectoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create actividad"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, actividad)
+}
+
+// GET /prospectos/:id/matches?minimo=60&limite=20
+// Propiedades disponibles que cumplen los criterios del prospecto con su puntaje
+func (ctrl *ProspectoController) GetMatches(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prospecto ID"})
+		return
+	}
+	var filtro models.FiltroMatches
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+		return
+	}
+
+	matches, err := ctrl.ProspectoService.GetMatches(id, &filtro)
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No prospecto found"})
+			return
+		}
+		if abortProspectoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve matches"})
+		return
+	}
+
+	c.JSON(http.StatusOK, matches)
+}
+
+// GET /prospectos/duplicados?id=&minimo=70
+// Pares de prospectos que parecen la misma persona
+func (ctrl *ProspectoController) GetDuplicados(c *gin.Context) {
+	var filtro models.FiltroDuplicados
+	if err := c.ShouldBindQuery(&filtro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+		return
+	}
+
+	duplicados, err := ctrl.ProspectoService.GetDuplicados(&filtro)
+	if err != nil {
+		if abortProspectoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve duplicados"})
+		return
+	}
+
+	c.JSON(http.StatusOK, duplicados)
+}
+
+// POST /prospectos/fusionar
+// Pasa las citas, imágenes y actividades del duplicado al prospecto que se conserva y borra el duplicado
+func (ctrl *ProspectoController) Fusionar(c *gin.Context) {
+	var fusion models.Fusion
+	if err := c.ShouldBindJSON(&fusion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	prospecto, err := ctrl.ProspectoService.Fusionar(&fusion, services.EmailFromContext(c))
+	if err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No prospecto found"})
+			return
+		}
+		if abortProspectoError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge prospectos"})
+		return
+	}
+
+	c.JSON(http.StatusOK, prospecto)
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -59,7 +60,7 @@ func (ctrl *UserController) Login(c *gin.Context) {
 		return
 	}
 
-	user, token, err := ctrl.UserService.Login(loginData.Email, loginData.Password)
+	user, token, refreshToken, err := ctrl.UserService.Login(loginData.Email, loginData.Password, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
 		log.Println("Login error:", err)
 		if err.Error() == "no such user found" {
@@ -72,10 +73,78 @@ func (ctrl *UserController) Login(c *gin.Context) {
 		return
 	}
 
-	c.SetCookie("JWTtoken", token, 3600, "/", "", false, true)
+	setAuthCookies(c, token, refreshToken)
 	c.JSON(http.StatusOK, user)
 }
 
+// POST /refresh
+// Exchanges the refresh token cookie for a new pair of tokens
+func (ctrl *UserController) Refresh(c *gin.Context) {
+	refreshToken, _ := c.Cookie("RefreshToken")
+
+	user, token, newRefreshToken, err := ctrl.UserService.Refresh(refreshToken)
+	if err != nil {
+		log.Println("Refresh error:", err)
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) || errors.Is(err, services.ErrSessionRevoked) {
+			clearAuthCookies(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token", "message": "Please login again"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		}
+		return
+	}
+
+	setAuthCookies(c, token, newRefreshToken)
+	c.JSON(http.StatusOK, user)
+}
+
+// POST /logout
+// Revokes the current session and clears the cookies
+func (ctrl *UserController) Logout(c *gin.Context) {
+	refreshToken, _ := c.Cookie("RefreshToken")
+	accessToken, _ := c.Cookie("JWTtoken")
+
+	err := ctrl.UserService.Logout(refreshToken, accessToken)
+	clearAuthCookies(c)
+	if err != nil && !errors.Is(err, services.ErrInvalidRefreshToken) {
+		log.Println("Logout error:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// POST /users/revoke-sessions/:id
+// Revokes every open session of a user, used to lock out an agent immediately
+func (ctrl *UserController) RevokeSessions(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		log.Println("Error converting user ID:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	revoked, err := ctrl.UserService.RevokeUserSessions(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "sesiones_revocadas": revoked})
+}
+
+func setAuthCookies(c *gin.Context, token string, refreshToken string) {
+	c.SetCookie("JWTtoken", token, int(services.AccessTokenDuration.Seconds()), "/", "", false, true)
+	c.SetCookie("RefreshToken", refreshToken, int(services.RefreshTokenDuration.Seconds()), "/api/v1", "", false, true)
+}
+
+func clearAuthCookies(c *gin.Context) {
+	c.SetCookie("JWTtoken", "", -1, "/", "", false, true)
+	c.SetCookie("RefreshToken", "", -1, "/api/v1", "", false, true)
+}
+
 // POST /create
 func (ctrl *UserController) CreateUser(c *gin.Context){
 	user := models.User{}
@@ -2,29 +2,65 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 )
 
-type Db_Utilities struct {
-	db *sql.DB
+// ErrNotFound se regresa cuando el registro que se quiere modificar no existe
+var ErrNotFound = errors.New("resource not found")
+
+// Execer lo cumplen *sql.DB y *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
-func NewDbUtilities(db *sql.DB) *Db_Utilities {
-	return &Db_Utilities{
-		db: db,
+// Insert ejecuta un INSERT y regresa el id que genero la columna AUTO_INCREMENT
+func Insert(db Execer, query string, args ...interface{}) (int, error) {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
 	}
+	return int(id), nil
 }
 
-func (dbu *Db_Utilities) GetLastId(table string, idName string) (int, error) {
-	var lastId sql.NullInt64 // Usamos sql.NullInt64 para manejar NULL
-	query := fmt.Sprintf("SELECT MAX(%s) FROM %s", idName, table)
-	err := dbu.db.QueryRow(query).Scan(&lastId)
+// RowExists indica si existe el registro con ese id, la fila queda bloqueada hasta que termine la transacción
+// para que nadie la borre entre la validación y el UPDATE/DELETE. table e idName siempre son constantes del servicio.
+func RowExists(tx *sql.Tx, table string, idName string, id int) (bool, error) {
+	var found int
+	query := fmt.Sprintf("SELECT 1 FROM %s WHERE %s = ? FOR UPDATE", table, idName)
+	err := tx.QueryRow(query, id).Scan(&found)
 	if err != nil {
-		return 0, err
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ExecExisting valida dentro de una transacción que el registro exista y despues ejecuta query,
+// regresa ErrNotFound si no existe. Sirve para los UPDATE y DELETE por id.
+func ExecExisting(db *sql.DB, table string, idName string, id int, query string, args ...interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	exists, err := RowExists(tx, table, idName, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
 	}
 
-	if lastId.Valid { // Comprobamos si el valor no es NULL
-		return int(lastId.Int64), nil
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
 	}
-	return 0, nil // Si es NULL, retornamos 0
+	return tx.Commit()
 }
@@ -0,0 +1,10 @@
+package models
+
+// Archivo son los datos del archivo que se subio al storage para una imagen, contrato o documento anexo
+type Archivo struct {
+	Ruta           string `json:"ruta"`
+	NombreOriginal string `json:"nombre_original"`
+	TipoMIME       string `json:"tipo_mime"`
+	TamanoBytes    int64  `json:"tamano_bytes"`
+	Checksum       string `json:"checksum_sha256"`
+}
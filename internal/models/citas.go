@@ -1,22 +1,121 @@
 package models
 
+import "time"
+
 type Cita struct {
-	IDCita      int    `json:"id_citas"`         // Clave primaria
-	Titulo      string `json:"titulo_cita"`      // Título de la cita
-	FechaCita   string `json:"fecha_cita"`       // Fecha de la cita
-	HoraCita    int    `json:"hora_cita"`        // Hora de la cita
-	Descripcion string `json:"descripcion_cita"` // Descripción de la cita
-	IdUsuario   string `json:"usuario"`          // Clave foránea que referencia a Usuarios
-	IdCliente   int    `json:"id_cliente"`       // Clave foránea que referencia a Clientes
+	IDCita      int       `json:"id_citas"`         // Clave primaria
+	Titulo      string    `json:"titulo_cita"`      // Título de la cita
+	Inicio      time.Time `json:"inicio"`           // Inicio en RFC 3339 con zona, se guarda y se responde en UTC
+	Fin         time.Time `json:"fin"`              // Fin en RFC 3339, si no se manda se calcula con duracion_minutos
+	Duracion    int       `json:"duracion_minutos"` // Duración en minutos, 60 si no se manda fin
+	Descripcion string    `json:"descripcion_cita"` // Descripción de la cita
+	IdUsuario   string    `json:"usuario"`          // Clave foránea que referencia a Usuarios
+	IdCliente   int       `json:"id_cliente"`       // Clave foránea que referencia a Clientes
+	// Si se manda la cita es una serie, inicio y fin son los de la primera ocurrencia
+	Recurrencia *Recurrencia `json:"recurrencia,omitempty"`
+	// Propiedades que se muestran, en el orden del recorrido. Al actualizar, si no se manda se conservan las que tenía
+	Propiedades []int `json:"propiedades,omitempty"`
+	// Solo en las respuestas, el resultado de la visita si ya se registró
+	Resultado *ResultadoCita `json:"resultado,omitempty"`
+	// Solo en las respuestas, el inicio y fin en la zona horaria del agente
+	HoraAgente *HoraAgente `json:"hora_agente,omitempty"`
+	// Solo en las respuestas, si la cita es una ocurrencia editada aparte de su serie
+	IDCitaSerie *int       `json:"id_cita_serie,omitempty"`
+	Ocurrencia  *time.Time `json:"ocurrencia,omitempty"` // Inicio original de la ocurrencia que reemplaza
+}
+
+// Recurrencia al estilo RRULE (RFC 5545), se manda conteo o hasta pero no los dos
+type Recurrencia struct {
+	Frecuencia  string      `json:"frecuencia" binding:"required"` // "diaria", "semanal" o "mensual"
+	Intervalo   int         `json:"intervalo"`                     // Cada cuantos días, semanas o meses, 1 por defecto
+	Conteo      int         `json:"conteo,omitempty"`              // Número de ocurrencias
+	Hasta       *time.Time  `json:"hasta,omitempty"`               // Ultimo inicio posible en RFC 3339
+	Excepciones []time.Time `json:"excepciones,omitempty"`         // Inicios de las ocurrencias que no se hacen
+	RRule       string      `json:"rrule,omitempty"`               // Solo en las respuestas, la regla en formato RFC 5545
+}
+
+// EdicionOcurrencia es el cuerpo para editar una ocurrencia de una serie, alcance es "esta" o "siguientes"
+type EdicionOcurrencia struct {
+	Ocurrencia time.Time `json:"ocurrencia" binding:"required"` // Inicio original de la ocurrencia en RFC 3339
+	Alcance    string    `json:"alcance" binding:"required"`
+	Cita       Cita      `json:"cita" binding:"required"`
+}
+
+// ResultadoCita es lo que pasó en la visita: "interesado", "no_interesado", "oferta" o "no_asistio".
+// Cada propiedad del recorrido puede tener su propio resultado, si no se manda toma el de la cita.
+type ResultadoCita struct {
+	Resultado     string               `json:"resultado" binding:"required"`
+	Notas         string               `json:"notas"`
+	Propiedades   []ResultadoPropiedad `json:"propiedades,omitempty"`
+	RegistradoEn  *time.Time           `json:"registrado_en,omitempty"`  // Solo en las respuestas
+	RegistradoPor string               `json:"registrado_por,omitempty"` // Solo en las respuestas, correo del usuario
+}
+
+type ResultadoPropiedad struct {
+	IDPropiedad int    `json:"id_propiedad" binding:"required"`
+	Resultado   string `json:"resultado"`
+	Notas       string `json:"notas"`
+}
 
+// VisitaPropiedad es una cita en la que se mostró la propiedad, con su resultado
+type VisitaPropiedad struct {
+	IDCita        int        `json:"id_citas"`
+	Titulo        string     `json:"titulo"`
+	Inicio        time.Time  `json:"inicio"`
+	Fin           time.Time  `json:"fin"`
+	Recurrente    bool       `json:"recurrente"` // La cita es una serie, inicio es el de la primera ocurrencia
+	Usuario       string     `json:"usuario"`
+	IDCliente     int        `json:"id_cliente"`
+	NombreCliente string     `json:"nombre_cliente"`
+	Resultado     string     `json:"resultado,omitempty"` // Vacío si todavía no se registra
+	Notas         string     `json:"notas,omitempty"`
+	RegistradoEn  *time.Time `json:"registrado_en,omitempty"`
+}
+
+// VisitasPropiedad es el listado de visitas de una propiedad con el conteo de cada resultado
+type VisitasPropiedad struct {
+	*Page[*VisitaPropiedad]
+	Resumen map[string]int `json:"resumen"` // Visitas por resultado, "pendiente" las que no tienen
 }
 
 type CitaMenu struct {
-	IDCita                 int    `json:"id_citas"`                 // Clave primaria
-	Titulo                 string `json:"titulo"`                   // Título de la cita
-	FechaCita              string `json:"fecha_cita"`               // Fecha de la cita
-	HoraCita               int    `json:"hora_cita"`                // Hora de la cita
-	NombreCliente          string `json:"nombre_cliente"`           // Nombre del cliente
-	ApellidoPaternoCliente string `json:"apellido_paterno_cliente"` // Apellido paterno del cliente
-	ApellidoMaternoCliente string `json:"apellido_materno_cliente"` // Apellido materno del cliente
+	IDCita                 int         `json:"id_citas"`                 // Clave primaria
+	Titulo                 string      `json:"titulo"`                   // Título de la cita
+	Inicio                 time.Time   `json:"inicio"`                   // Inicio en UTC
+	Fin                    time.Time   `json:"fin"`                      // Fin en UTC
+	Duracion               int         `json:"duracion_minutos"`         // Duración en minutos
+	HoraAgente             *HoraAgente `json:"hora_agente,omitempty"`    // Inicio y fin en la zona del agente
+	Recurrente             bool        `json:"recurrente"`               // Es una ocurrencia de una serie, id_citas es el de la serie
+	Ocurrencia             *time.Time  `json:"ocurrencia,omitempty"`     // Inicio de la ocurrencia, se manda para editarla o cancelarla
+	NombreCliente          string      `json:"nombre_cliente"`           // Nombre del cliente
+	ApellidoPaternoCliente string      `json:"apellido_paterno_cliente"` // Apellido paterno del cliente
+	ApellidoMaternoCliente string      `json:"apellido_materno_cliente"` // Apellido materno del cliente
+}
+
+// HoraAgente es un horario expresado en la zona horaria del agente, en RFC 3339 con su offset
+type HoraAgente struct {
+	ZonaHoraria string `json:"zona_horaria"` // Zona IANA, por ejemplo "America/Monterrey"
+	Inicio      string `json:"inicio"`
+	Fin         string `json:"fin"`
+}
+
+// HorarioAgente es un bloque de trabajo de un agente, puede tener varios en el mismo día
+type HorarioAgente struct {
+	DiaSemana  int    `json:"dia_semana"`  // 0 domingo, 1 lunes ... 6 sábado
+	HoraInicio string `json:"hora_inicio"` // Formato 24 horas "09:00" en la zona del agente
+	HoraFin    string `json:"hora_fin"`    // Formato 24 horas "18:00" en la zona del agente
+}
+
+// HorarioSemanal es el horario de trabajo y la zona horaria de un agente, PUT /citas/horario/:usuario reemplaza todos los bloques
+type HorarioSemanal struct {
+	ZonaHoraria string          `json:"zona_horaria"` // Vacío usa la zona por defecto del servidor
+	Bloques     []HorarioAgente `json:"bloques" binding:"required"`
+}
+
+// EspacioDisponible es un horario libre del agente, inicio y duracion_minutos se pueden mandar tal cual para crear la cita
+type EspacioDisponible struct {
+	Inicio     time.Time  `json:"inicio"`
+	Fin        time.Time  `json:"fin"`
+	Duracion   int        `json:"duracion_minutos"`
+	HoraAgente HoraAgente `json:"hora_agente"`
 }
@@ -0,0 +1,112 @@
+package models
+
+import "time"
+
+// ReglaComision dice cuánto cobra la inmobiliaria: en las ventas un porcentaje del precio y en las rentas un número de
+// meses de renta, que se retiene de lo que se cobra al inquilino. La regla de un contrato gana a la de su tipo de
+// propiedad y esa a la general (sin tipo de propiedad).
+type ReglaComision struct {
+	IDRegla            int       `json:"id_regla"`
+	IDContrato         *int      `json:"id_contrato,omitempty"`       // Solo en las respuestas, se cambia con PUT /comisiones/contratos/:id
+	IDTipoPropiedad    *int      `json:"id_tipo_propiedad,omitempty"` // Sin tipo es la regla general
+	TipoTransaccion    string    `json:"tipo_transaccion" binding:"required"`
+	Porcentaje         *float64  `json:"porcentaje,omitempty"`          // Ventas: porcentaje del precio
+	Meses              *float64  `json:"meses,omitempty"`               // Rentas: meses de renta
+	PorcentajeCaptador *float64  `json:"porcentaje_captador,omitempty"` // Parte del agente de la propiedad, 50 si no se manda; el resto es del que cerró
+	ActualizadoPor     string    `json:"actualizado_por,omitempty"`     // Solo en las respuestas
+	ActualizadoEn      time.Time `json:"actualizado_en"`                // Solo en las respuestas
+}
+
+// CambioComisionContrato es el cuerpo de PUT /comisiones/contratos/:id. Con porcentaje o meses se guarda la regla
+// del contrato; agente_cierre vacío quita al agente que cerró y nil lo conserva.
+type CambioComisionContrato struct {
+	Porcentaje         *float64 `json:"porcentaje"`
+	Meses              *float64 `json:"meses"`
+	PorcentajeCaptador *float64 `json:"porcentaje_captador"`
+	AgenteCierre       *string  `json:"agente_cierre"`
+}
+
+// ComisionContrato es la comisión de un contrato con la regla que le toca y cómo se reparte entre los agentes
+type ComisionContrato struct {
+	IDContrato     int            `json:"id_contrato"`
+	Tipo           string         `json:"tipo"`
+	AgenteCaptador string         `json:"agente_captador"`         // El agente de la propiedad
+	AgenteCierre   string         `json:"agente_cierre,omitempty"` // Si no hay, el captador también cerró
+	Origen         string         `json:"origen,omitempty"`        // contrato, tipo_propiedad o general; vacío si no hay regla
+	Regla          *ReglaComision `json:"regla,omitempty"`
+	Total          float64        `json:"total"`
+	Retenida       float64        `json:"retenida"` // Rentas: lo que ya se retuvo de la renta cobrada. Ventas: el total si ya se firmó
+	Captador       float64        `json:"captador"` // Parte del total para el agente de la propiedad
+	Cierre         float64        `json:"cierre"`   // Parte del total para el agente que cerró
+}
+
+// FiltroPeriodo es el mes de un estado de cuenta o reporte, sin año ni mes es el mes pasado
+type FiltroPeriodo struct {
+	Anio    *int   `form:"anio"`
+	Mes     *int   `form:"mes"`
+	Usuario string `form:"usuario"` // Solo en el reporte de comisiones de agentes
+}
+
+// EstadoPropietario es el estado de cuenta mensual de un propietario: lo que se cobró de renta de cada propiedad,
+// la comisión que retuvo la inmobiliaria y lo que se le entrega, más las ventas que se firmaron en el mes
+type EstadoPropietario struct {
+	IDPropietario int                 `json:"id_propietario"`
+	Propietario   string              `json:"propietario"`
+	Correo        string              `json:"correo,omitempty"`
+	Periodo       string              `json:"periodo"` // YYYY-MM
+	Desde         string              `json:"desde"`
+	Hasta         string              `json:"hasta"`
+	Rentas        []*RentaPropietario `json:"rentas"`
+	Ventas        []*VentaPropietario `json:"ventas"`
+	TotalCobrado  float64             `json:"total_cobrado"`
+	TotalComision float64             `json:"total_comision"`
+	TotalNeto     float64             `json:"total_neto"`
+}
+
+// RentaPropietario es el renglón de una propiedad rentada en el estado de cuenta del propietario
+type RentaPropietario struct {
+	IDPropiedad     int     `json:"id_propiedad"`
+	TituloPropiedad string  `json:"titulo_propiedad"`
+	Contratos       []int   `json:"contratos"`
+	Inquilino       string  `json:"inquilino,omitempty"`
+	RentaCobrada    float64 `json:"renta_cobrada"`
+	Recargos        float64 `json:"recargos"`
+	Comision        float64 `json:"comision"`
+	Neto            float64 `json:"neto"`
+	SaldoVencido    float64 `json:"saldo_vencido"` // Lo que debía el inquilino al cerrar el mes
+}
+
+// VentaPropietario es una venta firmada en el mes
+type VentaPropietario struct {
+	IDContrato      int     `json:"id_contrato"`
+	IDPropiedad     int     `json:"id_propiedad"`
+	TituloPropiedad string  `json:"titulo_propiedad"`
+	FechaFirma      string  `json:"fecha_firma"`
+	Precio          float64 `json:"precio"`
+	Comision        float64 `json:"comision"`
+	Neto            float64 `json:"neto"`
+}
+
+// ReporteComisiones es la respuesta de GET /comisiones/agentes, lo que le toca a cada agente en el mes
+type ReporteComisiones struct {
+	Periodo string            `json:"periodo"`
+	Total   float64           `json:"total"`
+	Agentes []*ComisionAgente `json:"agentes"`
+}
+
+// ComisionAgente suma lo que le toca a un agente por captar y por cerrar
+type ComisionAgente struct {
+	Usuario string             `json:"usuario"`
+	Total   float64            `json:"total"`
+	Detalle []*DetalleComision `json:"detalle"`
+}
+
+// DetalleComision es la parte de un agente en la comisión de un contrato
+type DetalleComision struct {
+	IDContrato      int     `json:"id_contrato"`
+	Tipo            string  `json:"tipo"`
+	TituloPropiedad string  `json:"titulo_propiedad"`
+	Rol             string  `json:"rol"`      // captador o cierre, captador_cierre si fue el mismo agente
+	Comision        float64 `json:"comision"` // Comisión del contrato en el mes
+	Monto           float64 `json:"monto"`    // Lo que le toca al agente
+}
@@ -1,18 +1,315 @@
 package models
 
+import "time"
+
 // Contrato representa la estructura de la tabla Contratos.
+// Al actualizar, los términos que no se mandan (nil) se conservan; ya firmado el contrato no cambian.
 type Contrato struct {
-	IDContrato          int    `json:"id_contrato"`
-	TituloContrato      string `json:"titulo_contrato"`
-	DescripcionContrato string `json:"descripcion_contrato,omitempty"`
-	Tipo                string `json:"tipo,omitempty"`
-	RutaPDF             string `json:"ruta_pdf,omitempty"`
-	IDPropiedad         int    `json:"id_propiedad"`
+	IDContrato          int              `json:"id_contrato"`
+	TituloContrato      string           `json:"titulo_contrato"`
+	DescripcionContrato string           `json:"descripcion_contrato,omitempty"`
+	Tipo                string           `json:"tipo,omitempty"` // "renta" o "venta"
+	RutaPDF             string           `json:"ruta_pdf,omitempty"`
+	IDPropiedad         int              `json:"id_propiedad"`
+	Estado              string           `json:"estado,omitempty"`       // Solo en las respuestas, cambia con PUT /contratos/:id/estado
+	FechaInicio         *string          `json:"fecha_inicio,omitempty"` // YYYY-MM-DD
+	FechaFin            *string          `json:"fecha_fin,omitempty"`    // YYYY-MM-DD, obligatoria en las rentas
+	Monto               *float64         `json:"monto,omitempty"`        // Renta mensual o precio de venta
+	Deposito            *float64         `json:"deposito,omitempty"`
+	DiasGracia          *int             `json:"dias_gracia,omitempty"`        // Días después del vencimiento de la renta antes del recargo, 5 si no se manda
+	RecargoFijo         *float64         `json:"recargo_fijo,omitempty"`       // Recargo por pago tardío, se suma al porcentaje
+	RecargoPorcentaje   *float64         `json:"recargo_porcentaje,omitempty"` // Porcentaje de la renta del mes
+	Partes              []*ParteContrato `json:"partes,omitempty"`             // Solo en las respuestas, se cambian con PUT /contratos/:id/partes
 }
 
 type ContratoMenu struct {
-	IDContrato      int    `json:"id_contrato"`
-	TituloContrato  string `json:"titulo_contrato"`
-	Tipo            string `json:"tipo,omitempty"`
-	TituloPropiedad string `json:"titulo_propiedad"`
+	IDContrato      int     `json:"id_contrato"`
+	TituloContrato  string  `json:"titulo_contrato"`
+	Tipo            string  `json:"tipo,omitempty"`
+	TituloPropiedad string  `json:"titulo_propiedad"`
+	Estado          string  `json:"estado"`
+	FechaFin        *string `json:"fecha_fin,omitempty"`
+}
+
+// ParteContrato es una persona que firma el contrato. Rol es "propietario", "cliente" (arrendatario o comprador)
+// o "fiador". El nombre y el contacto se copian del propietario o prospecto ligado si no se mandan.
+type ParteContrato struct {
+	IDParte       int    `json:"id_parte"`
+	Rol           string `json:"rol" binding:"required"`
+	IDPropietario *int   `json:"id_propietario,omitempty"` // Solo en el rol propietario
+	IDCliente     *int   `json:"id_cliente,omitempty"`     // Solo en el rol cliente
+	Nombre        string `json:"nombre"`
+	Correo        string `json:"correo,omitempty"`
+	Telefono      string `json:"telefono,omitempty"`
+}
+
+// CambioEstadoContrato es el cuerpo de PUT /contratos/:id/estado
+type CambioEstadoContrato struct {
+	Estado string `json:"estado" binding:"required"`
+	Motivo string `json:"motivo"` // Obligatorio al rescindir
+}
+
+// ContratoPorVencer es un contrato firmado o vigente que termina pronto
+type ContratoPorVencer struct {
+	ContratoMenu
+	IDPropiedad   int    `json:"id_propiedad"`
+	Usuario       string `json:"usuario"` // Agente de la propiedad, es a quien se le avisa
+	Cliente       string `json:"cliente,omitempty"`
+	DiasRestantes int    `json:"dias_restantes"`
+}
+
+// FiltroPorVencer son los filtros de GET /contratos/por-vencer
+type FiltroPorVencer struct {
+	Dias    *int   `form:"dias"` // 60 si no se manda
+	Usuario string `form:"usuario"`
+}
+
+// PlantillaContrato es un machote de contrato de renta o venta. El texto vive en sus versiones, que no se
+// modifican nunca para poder regenerar idéntico cualquier contrato que se hizo con ellas.
+type PlantillaContrato struct {
+	IDPlantilla   int                 `json:"id_plantilla"`
+	Nombre        string              `json:"nombre" binding:"required"`
+	Tipo          string              `json:"tipo" binding:"required"` // "renta" o "venta", no cambia
+	Activa        bool                `json:"activa"`                  // Solo en las respuestas, una plantilla inactiva no genera contratos nuevos
+	UltimaVersion int                 `json:"ultima_version"`          // Solo en las respuestas
+	Contenido     string              `json:"contenido,omitempty"`     // Solo al crear, es el texto de la versión 1
+	Versiones     []*VersionPlantilla `json:"versiones,omitempty"`     // Solo en GET /contratos/plantillas/:id, sin el texto
+}
+
+// CambioPlantilla es el cuerpo de PUT /contratos/plantillas/:id, los campos que no se mandan se conservan
+type CambioPlantilla struct {
+	Nombre string `json:"nombre"`
+	Activa *bool  `json:"activa"`
+}
+
+// VersionPlantilla es el texto de una plantilla con sus marcadores {{variable}}
+type VersionPlantilla struct {
+	IDVersion   int       `json:"id_version"`
+	IDPlantilla int       `json:"id_plantilla"`
+	Version     int       `json:"version"`
+	Contenido   string    `json:"contenido,omitempty"`
+	Nota        string    `json:"nota,omitempty"` // Qué cambió respecto a la versión anterior
+	CreadoPor   string    `json:"creado_por,omitempty"`
+	CreadoEn    time.Time `json:"creado_en"`
+}
+
+// NuevaVersionPlantilla es el cuerpo de POST /contratos/plantillas/:id/versiones
+type NuevaVersionPlantilla struct {
+	Contenido string `json:"contenido" binding:"required"`
+	Nota      string `json:"nota"`
+}
+
+// VariablePlantilla es un marcador que se puede usar en el texto de una plantilla
+type VariablePlantilla struct {
+	Nombre      string `json:"nombre"`
+	Descripcion string `json:"descripcion"`
+}
+
+// GenerarContrato es el cuerpo de POST /contratos/:id/generar
+type GenerarContrato struct {
+	IDPlantilla int      `json:"id_plantilla" binding:"required"`
+	Version     *int     `json:"version"`      // La última si no se manda
+	IDCliente   *int     `json:"id_cliente"`   // Prospecto que renta o compra
+	Precio      *float64 `json:"precio"`       // El de la propiedad si no se manda
+	FechaInicio string   `json:"fecha_inicio"` // YYYY-MM-DD
+	FechaFin    string   `json:"fecha_fin"`    // YYYY-MM-DD
+	Clausulas   []string `json:"clausulas"`    // Se numeran en el orden en que vienen
+}
+
+// GeneracionContrato indica con qué versión de plantilla y qué datos se generó el PDF del contrato
+type GeneracionContrato struct {
+	IDContrato         int               `json:"id_contrato"`
+	Tipo               string            `json:"tipo"` // El de la plantilla, "renta" o "venta"
+	IDPlantilla        int               `json:"id_plantilla"`
+	IDVersionPlantilla int               `json:"id_version_plantilla"`
+	Version            int               `json:"version"`
+	IDCliente          *int              `json:"id_cliente,omitempty"`
+	Datos              map[string]string `json:"datos"` // El valor de cada variable tal como quedó en el PDF
+	GeneradoPor        string            `json:"generado_por,omitempty"`
+	GeneradoEn         time.Time         `json:"generado_en"`
+	Archivo            *Archivo          `json:"archivo,omitempty"`
+}
+
+// FirmaContrato es la solicitud de firma electrónica de una parte con lo que se registró al firmar.
+// El enlace se manda por correo y solo se guarda el hash de su token.
+type FirmaContrato struct {
+	IDFirma           int        `json:"id_firma"`
+	IDContrato        int        `json:"id_contrato"`
+	IDParte           *int       `json:"id_parte,omitempty"`
+	Rol               string     `json:"rol"`
+	Nombre            string     `json:"nombre"`
+	Correo            string     `json:"correo"`
+	Estado            string     `json:"estado"`             // pendiente, firmada o cancelada
+	ChecksumDocumento string     `json:"checksum_documento"` // SHA-256 del PDF que se manda a firmar
+	EnviadoEn         time.Time  `json:"enviado_en"`
+	ExpiraEn          time.Time  `json:"expira_en"`
+	FirmadoEn         *time.Time `json:"firmado_en,omitempty"`
+	TipoFirma         string     `json:"tipo_firma,omitempty"` // escrita o dibujada
+	FirmaTexto        string     `json:"firma_texto,omitempty"`
+	IP                string     `json:"ip,omitempty"`
+	UserAgent         string     `json:"user_agent,omitempty"`
+	Enviado           *bool      `json:"enviado,omitempty"` // Solo al mandar el enlace, false si no salió el correo
+}
+
+// EventoFirma es un renglón de la bitácora de firmas del contrato
+type EventoFirma struct {
+	IDEvento          int       `json:"id_evento"`
+	IDFirma           *int      `json:"id_firma,omitempty"`
+	Evento            string    `json:"evento"` // enviada, reenviada, vista, firmada, cancelada o completada
+	IP                string    `json:"ip,omitempty"`
+	UserAgent         string    `json:"user_agent,omitempty"`
+	ChecksumDocumento string    `json:"checksum_documento,omitempty"`
+	Detalle           string    `json:"detalle,omitempty"`
+	CreadoEn          time.Time `json:"creado_en"`
+}
+
+// AuditoriaFirmas es la respuesta de GET /contratos/:id/firmas
+type AuditoriaFirmas struct {
+	IDContrato int              `json:"id_contrato"`
+	Estado     string           `json:"estado"`
+	Firmas     []*FirmaContrato `json:"firmas"`
+	Eventos    []*EventoFirma   `json:"eventos"`
+	Firmado    *Archivo         `json:"firmado,omitempty"` // PDF final con la constancia de firmas
+}
+
+// SolicitudFirma es lo que ve la parte al abrir su enlace
+type SolicitudFirma struct {
+	IDContrato        int             `json:"id_contrato"`
+	TituloContrato    string          `json:"titulo_contrato"`
+	Rol               string          `json:"rol"`
+	Nombre            string          `json:"nombre"`
+	ChecksumDocumento string          `json:"checksum_documento"`
+	ExpiraEn          time.Time       `json:"expira_en"`
+	Partes            []ParteFirmante `json:"partes"`
+}
+
+// ParteFirmante indica si una de las partes ya firmó
+type ParteFirmante struct {
+	Rol     string `json:"rol"`
+	Nombre  string `json:"nombre"`
+	Firmada bool   `json:"firmada"`
+}
+
+// FirmarContrato es el cuerpo de POST /firmas/:token. La firma escrita lleva el nombre tal como se teclea y la
+// dibujada una imagen PNG en base64 (puede venir como data URL). Acepto confirma que se revisó el documento.
+type FirmarContrato struct {
+	Tipo   string `json:"tipo" binding:"required"`
+	Nombre string `json:"nombre"`
+	Imagen string `json:"imagen"`
+	Acepto bool   `json:"acepto" binding:"required"`
+}
+
+// CargoRenta es un cargo de la cobranza de un contrato de renta: la renta de cada mes, el depósito o un recargo por
+// pago tardío. Pagado, Saldo y Estado salen de aplicar los pagos a los cargos del más antiguo al más nuevo.
+type CargoRenta struct {
+	IDCargo           int        `json:"id_cargo"`
+	Tipo              string     `json:"tipo"`    // renta, deposito o recargo
+	Periodo           string     `json:"periodo"` // YYYY-MM-DD, inicio del mes de renta que cubre o al que se le cobra el recargo
+	Concepto          string     `json:"concepto"`
+	Monto             float64    `json:"monto"`
+	FechaVencimiento  string     `json:"fecha_vencimiento"` // YYYY-MM-DD
+	Pagado            float64    `json:"pagado"`
+	Saldo             float64    `json:"saldo"`
+	Estado            string     `json:"estado"` // pagado, parcial, pendiente, vencido o condonado
+	CondonadoEn       *time.Time `json:"condonado_en,omitempty"`
+	MotivoCondonacion string     `json:"motivo_condonacion,omitempty"`
+}
+
+// PagoRenta es un pago del inquilino. Metodo es efectivo, transferencia o tarjeta; las transferencias y los pagos con
+// tarjeta llevan la referencia o el número de autorización. Un pago no se borra, se cancela con un motivo.
+type PagoRenta struct {
+	IDPago            int        `json:"id_pago"`
+	Fecha             string     `json:"fecha"` // YYYY-MM-DD, hoy si no se manda
+	Monto             float64    `json:"monto" binding:"required"`
+	Metodo            string     `json:"metodo" binding:"required"`
+	Referencia        string     `json:"referencia,omitempty"`
+	Notas             string     `json:"notas,omitempty"`
+	RegistradoPor     string     `json:"registrado_por,omitempty"` // Solo en las respuestas
+	CreadoEn          time.Time  `json:"creado_en"`                // Solo en las respuestas
+	CanceladoEn       *time.Time `json:"cancelado_en,omitempty"`
+	CanceladoPor      string     `json:"cancelado_por,omitempty"`
+	MotivoCancelacion string     `json:"motivo_cancelacion,omitempty"`
+}
+
+// Cancelacion es el cuerpo para cancelar un pago o condonar un recargo
+type Cancelacion struct {
+	Motivo string `json:"motivo" binding:"required"`
+}
+
+// MovimientoCuenta es un renglón del estado de cuenta, Saldo es el acumulado después del movimiento
+type MovimientoCuenta struct {
+	Fecha    string  `json:"fecha"`
+	IDCargo  *int    `json:"id_cargo,omitempty"`
+	IDPago   *int    `json:"id_pago,omitempty"`
+	Concepto string  `json:"concepto"`
+	Cargo    float64 `json:"cargo"`
+	Abono    float64 `json:"abono"`
+	Saldo    float64 `json:"saldo"`
+}
+
+// EstadoCuentaContrato es la respuesta de GET /contratos/:id/estado-cuenta. Los movimientos son los del periodo,
+// los cargos y pagos son todos los del contrato. Un saldo negativo es saldo a favor del inquilino.
+type EstadoCuentaContrato struct {
+	IDContrato        int                 `json:"id_contrato"`
+	TituloContrato    string              `json:"titulo_contrato"`
+	Estado            string              `json:"estado"`
+	Inquilino         string              `json:"inquilino,omitempty"`
+	Renta             *float64            `json:"renta,omitempty"`
+	Desde             string              `json:"desde,omitempty"`
+	Hasta             string              `json:"hasta"`
+	SaldoInicial      float64             `json:"saldo_inicial"`
+	TotalCargos       float64             `json:"total_cargos"`
+	TotalPagos        float64             `json:"total_pagos"`
+	SaldoFinal        float64             `json:"saldo_final"`
+	SaldoVencido      float64             `json:"saldo_vencido"` // Cargos ya vencidos que no se han pagado, a la fecha de hoy
+	DiasAtraso        int                 `json:"dias_atraso"`   // Desde el cargo vencido más antiguo sin pagar
+	DepositoRequerido float64             `json:"deposito_requerido"`
+	DepositoPagado    float64             `json:"deposito_pagado"`
+	Movimientos       []*MovimientoCuenta `json:"movimientos"`
+	Cargos            []*CargoRenta       `json:"cargos"`
+	Pagos             []*PagoRenta        `json:"pagos"`
+}
+
+// FiltroEstadoCuenta son los filtros de GET /contratos/:id/estado-cuenta, sin fechas es desde el inicio hasta hoy
+type FiltroEstadoCuenta struct {
+	Desde string `form:"desde"` // YYYY-MM-DD
+	Hasta string `form:"hasta"` // YYYY-MM-DD
+}
+
+// AdeudoContrato es un contrato con saldo vencido en la cartera vencida
+type AdeudoContrato struct {
+	IDContrato      int     `json:"id_contrato"`
+	TituloContrato  string  `json:"titulo_contrato"`
+	Estado          string  `json:"estado"`
+	IDPropiedad     int     `json:"id_propiedad"`
+	TituloPropiedad string  `json:"titulo_propiedad"`
+	Usuario         string  `json:"usuario"` // Agente de la propiedad
+	Inquilino       string  `json:"inquilino,omitempty"`
+	Telefono        string  `json:"telefono,omitempty"`
+	Correo          string  `json:"correo,omitempty"`
+	SaldoVencido    float64 `json:"saldo_vencido"`
+	SaldoTotal      float64 `json:"saldo_total"`
+	CargosVencidos  int     `json:"cargos_vencidos"`
+	VencidoDesde    string  `json:"vencido_desde"` // Vencimiento del cargo más antiguo sin pagar
+	DiasAtraso      int     `json:"dias_atraso"`
+}
+
+// RangoAtraso suma el saldo vencido de los cargos por días de atraso
+type RangoAtraso struct {
+	Rango string  `json:"rango"` // 1-30, 31-60, 61-90 o 90+
+	Monto float64 `json:"monto"`
+}
+
+// CarteraVencida es la respuesta de GET /contratos/cartera-vencida, los contratos van del más atrasado al menos
+type CarteraVencida struct {
+	Fecha        string            `json:"fecha"`
+	SaldoVencido float64           `json:"saldo_vencido"`
+	Rangos       []*RangoAtraso    `json:"rangos"`
+	Contratos    []*AdeudoContrato `json:"contratos"`
+}
+
+// FiltroCarteraVencida son los filtros de GET /contratos/cartera-vencida
+type FiltroCarteraVencida struct {
+	Usuario    string `form:"usuario"`
+	MinimoDias *int   `form:"minimo_dias"` // Solo los contratos con al menos esos días de atraso
 }
@@ -0,0 +1,28 @@
+package models
+
+// ContactoDuplicado es un prospecto o propietario dentro de un par de posibles duplicados
+type ContactoDuplicado struct {
+	ID       int    `json:"id"` // id_cliente o id_propietario
+	Nombre   string `json:"nombre"`
+	Telefono string `json:"telefono"`
+	Correo   string `json:"correo"`
+}
+
+// ParDuplicados son dos registros que parecen la misma persona
+type ParDuplicados struct {
+	Registros []ContactoDuplicado `json:"registros"` // Siempre dos, el de menor id primero
+	Similitud int                 `json:"similitud"` // 0 a 100
+	Motivos   []string            `json:"motivos"`   // "correo", "telefono" y/o "nombre"
+}
+
+// FiltroDuplicados son los filtros de GET /prospectos/duplicados y GET /propietarios/duplicados
+type FiltroDuplicados struct {
+	ID     *int `form:"id"`     // Solo los duplicados de este registro
+	Minimo *int `form:"minimo"` // Similitud mínima, 70 por defecto
+}
+
+// Fusion es el cuerpo de POST /prospectos/fusionar y POST /propietarios/fusionar
+type Fusion struct {
+	IDConservar int `json:"id_conservar" binding:"required"` // Registro que se queda
+	IDDuplicado int `json:"id_duplicado" binding:"required"` // Registro que se borra, lo que tenía pasa al que se queda
+}
@@ -2,12 +2,32 @@ package models
 
 import (
 	"database/sql"
+	"time"
 )
 
 type EstadoPropiedades struct {
 	IDEstadoPropiedades int          `json:"id_estado_propiedades"` // Clave primaria
 	TipoTransaccion     string       `json:"tipo_transaccion"`      // Tipo de transacción ('venta', 'renta')
-	Estado              string       `json:"estado"`                // Estado de la propiedad ('disponible', 'vendida', 'rentada')
-	FechaTransaccion    sql.NullTime `json:"fecha_cambio_estado"`   // Fecha en que cambió el estado de la propiedad
+	Estado              string       `json:"estado"`                // Estado de la propiedad ('disponible', 'apartada', 'vendida', 'rentada')
+	FechaTransaccion    sql.NullTime `json:"fecha_cambio_estado"`   // Fecha en que cambió el estado de la propiedad, la pone el servidor
 	IDPropiedad         int          `json:"id_propiedad"`          // Clave foránea
 }
+
+// CambioEstadoPropiedad es el cuerpo de PUT /propiedades/:id/estado
+type CambioEstadoPropiedad struct {
+	Estado          string `json:"estado" binding:"required"`
+	TipoTransaccion string `json:"tipo_transaccion"` // Solo se puede cambiar mientras la propiedad esta disponible
+	Comentario      string `json:"comentario"`       // Por ejemplo quien rentó o compró la propiedad
+}
+
+// HistorialEstadoPropiedad es un cambio de estado registrado, el historial nunca se modifica
+type HistorialEstadoPropiedad struct {
+	IDHistorial     int       `json:"id_historial"`
+	IDPropiedad     int       `json:"id_propiedad"`
+	EstadoAnterior  *string   `json:"estado_anterior"` // nil en el estado inicial
+	EstadoNuevo     string    `json:"estado_nuevo"`
+	TipoTransaccion string    `json:"tipo_transaccion"`
+	Usuario         string    `json:"usuario"` // Correo de quien hizo el cambio
+	Comentario      *string   `json:"comentario"`
+	FechaCambio     time.Time `json:"fecha_cambio"`
+}
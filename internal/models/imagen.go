@@ -5,5 +5,23 @@ type Imagen struct {
 	RutaImagen  string `json:"ruta_imagen"`
 	Descripcion string `json:"descripcion_imagen"`
 	Principal   bool   `json:"principal"`
+	Posicion    int    `json:"posicion"`
 	IDPropiedad int    `json:"id_propiedad"`
+	// Se llenan cuando el worker termina de procesar la imagen subida
+	Placeholder string           `json:"placeholder,omitempty"`
+	Variantes   []VarianteImagen `json:"variantes,omitempty"`
+}
+
+// VarianteImagen es una version redimensionada de una imagen subida
+type VarianteImagen struct {
+	Nombre  string `json:"nombre"`  // small, medium o large
+	Formato string `json:"formato"` // jpg o webp
+	Ancho   int    `json:"ancho"`
+	Alto    int    `json:"alto"`
+	URL     string `json:"url"`
+}
+
+// OrdenImagenes es el cuerpo para reordenar una galeria, trae los ids de todas las imagenes en el orden deseado
+type OrdenImagenes struct {
+	IDs []int `json:"ids" binding:"required"`
 }
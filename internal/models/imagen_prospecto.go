@@ -5,5 +5,9 @@ type ImagenProspecto struct {
 	RutaImagen  string `json:"ruta_imagen"`
 	Descripcion string `json:"descripcion_imagen"`
 	Principal   bool   `json:"principal"`
+	Posicion    int    `json:"posicion"`
 	IDProspecto int    `json:"id_prospecto"`
+	// Se llenan cuando el worker termina de procesar la imagen subida
+	Placeholder string           `json:"placeholder,omitempty"`
+	Variantes   []VarianteImagen `json:"variantes,omitempty"`
 }
@@ -0,0 +1,18 @@
+package models
+
+// PageRequest contiene los parametros de paginacion que llegan en el query string de los listados.
+// Si viene cursor se usa paginacion por llave (keyset) y se ignora offset.
+type PageRequest struct {
+	Limit  int    `form:"limit"`  // Numero maximo de elementos por pagina
+	Offset int    `form:"offset"` // Numero de elementos a saltar
+	Cursor string `form:"cursor"` // Cursor opaco regresado en next_cursor de la pagina anterior
+}
+
+// Page es el sobre que regresan los endpoints de listado
+type Page[T any] struct {
+	Data       []T    `json:"data"`                  // Elementos de la pagina
+	Total      int    `json:"total"`                 // Total de elementos que cumplen el filtro, sin paginar
+	Limit      int    `json:"limit"`                 // Limite aplicado
+	Offset     int    `json:"offset"`                // Offset aplicado, 0 cuando se pagina por cursor
+	NextCursor string `json:"next_cursor,omitempty"` // Cursor para pedir la siguiente pagina, vacio si es la ultima
+}
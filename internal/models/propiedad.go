@@ -36,3 +36,30 @@ type MenuPropiedades struct {
 	TipoTransaccion string  `json:"tipo_transaccion"` // Tipo de transacción ('venta', 'renta')
 	Estado          string  `json:"estado"`           // Estado de la propiedad ('disponible', 'vendida', 'rentada')
 }
+
+// PropiedadFiltro contiene los filtros opcionales de la busqueda de propiedades, se llena desde el query string
+type PropiedadFiltro struct {
+	PrecioMin       *float64 `form:"precio_min"`        // Precio minimo
+	PrecioMax       *float64 `form:"precio_max"`        // Precio maximo
+	MinRecamaras    *int     `form:"min_recamaras"`     // Numero minimo de recámaras
+	MinBanos        *int     `form:"min_banos"`         // Numero minimo de baños
+	Ciudad          string   `form:"ciudad"`            // Ciudad
+	Colonia         string   `form:"colonia"`           // Colonia
+	IDTipoPropiedad *int     `form:"id_tipo_propiedad"` // Tipo de propiedad
+	TipoTransaccion string   `form:"tipo_transaccion"`  // Tipo de transacción ('venta', 'renta')
+	Estado          string   `form:"estado"`            // Estado de la propiedad ('disponible', 'vendida', 'rentada')
+	Gas             []string `form:"gas"`               // Valores requeridos de la columna gas
+	Comodidades     []string `form:"comodidades"`       // Valores requeridos de la columna comodidades
+	Extras          []string `form:"extras"`            // Valores requeridos de la columna extras
+	Utilidades      []string `form:"utilidades"`        // Valores requeridos de la columna utilidades
+	OrdenarPor      string   `form:"sort"`              // Campo por el que se ordena ('precio', 'num_recamaras', 'num_banos', 'fecha_alta', 'id_propiedad')
+	Orden           string   `form:"order"`             // Dirección del orden ('asc', 'desc')
+}
+
+// PropiedadCompleta es la peticion para dar de alta una propiedad con su estado inicial, imágenes y documentos en una sola transacción
+type PropiedadCompleta struct {
+	Propiedad         Propiedad         `json:"propiedad"`
+	EstadoPropiedades EstadoPropiedades `json:"estado_propiedades"`
+	Imagenes          []Imagen          `json:"imagenes"`
+	DocumentosAnexos  []DocumentoAnexo  `json:"documentos_anexos"`
+}
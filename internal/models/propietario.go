@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Propietario struct {
 	IDPropietario int    `json:"id_propietario"` // Clave primaria
 	Nombre        string `json:"nombre"`         // Nombre del propietario
@@ -7,4 +9,36 @@ type Propietario struct {
 	ApellidoM     string `json:"apellido_m"`     // Apellido materno
 	Telefono      string `json:"telefono"`       // Teléfono de contacto
 	Correo        string `json:"correo"`         // Correo electrónico
-}
\ No newline at end of file
+}
+
+// PropietarioFiltro son los filtros de GET /propietarios/search, todos opcionales
+type PropietarioFiltro struct {
+	Q              string `form:"q"`               // Busca en el nombre completo, el correo y el teléfono
+	ConPropiedades *bool  `form:"con_propiedades"` // true solo los que tienen propiedades, false solo los que no tienen
+}
+
+// PropietarioListado es un propietario del listado con el número de propiedades que tiene
+type PropietarioListado struct {
+	Propietario
+	NumPropiedades int `json:"num_propiedades"`
+}
+
+// PropiedadPortafolio es una propiedad del propietario con su estado actual
+type PropiedadPortafolio struct {
+	IDPropiedad       int        `json:"id_propiedad"`
+	Titulo            string     `json:"titulo"`
+	Direccion         string     `json:"direccion"`
+	Colonia           string     `json:"colonia"`
+	Ciudad            string     `json:"ciudad"`
+	Precio            float64    `json:"precio"`
+	TipoTransaccion   string     `json:"tipo_transaccion"`
+	Estado            string     `json:"estado"` // "sin_estado" si la propiedad no tiene estado registrado
+	FechaCambioEstado *time.Time `json:"fecha_cambio_estado,omitempty"`
+}
+
+// PortafolioPropietario es la respuesta de GET /propietarios/:id/propiedades
+type PortafolioPropietario struct {
+	Propietario Propietario            `json:"propietario"`
+	Propiedades []*PropiedadPortafolio `json:"propiedades"`
+	Resumen     map[string]int         `json:"resumen"` // Número de propiedades por estado
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Prospecto struct {
 	IdCliente int    `json:"id_cliente"`                 // Clave primaria
 	Nombre    string `json:"nombre_prospecto"`           // Nombre del propietario
@@ -7,4 +9,120 @@ type Prospecto struct {
 	ApellidoM string `json:"apellido_materno_prospecto"` // Apellido materno
 	Telefono  string `json:"telefono_prospecto"`         // Teléfono de contacto
 	Correo    string `json:"correo_prospecto"`           // Correo electrónico
+	// Clave de la etapa del pipeline, al crear es la primera etapa abierta si no se manda.
+	// Después solo cambia con PUT /prospectos/:id/etapa para que quede en la línea de tiempo.
+	Etapa   string `json:"etapa"`
+	Usuario string `json:"usuario"` // Agente asignado, al actualizar vacío conserva el que tenía
+	Origen  string `json:"origen"`  // "portal", "referido", "visita_directa" u "otro"
+	// Presupuesto y lo que busca, al actualizar si no se manda se conserva
+	Criterios  *CriteriosBusqueda `json:"criterios,omitempty"`
+	FechaAlta  *time.Time         `json:"fecha_alta,omitempty"`  // Solo en las respuestas
+	EtapaDesde *time.Time         `json:"etapa_desde,omitempty"` // Solo en las respuestas, cuando entró a la etapa
+}
+
+// CriteriosBusqueda es el presupuesto y lo que busca el prospecto, todos los campos son opcionales
+type CriteriosBusqueda struct {
+	TipoTransaccion string   `json:"tipo_transaccion,omitempty"` // "venta" o "renta"
+	IDTipoPropiedad *int     `json:"id_tipo_propiedad,omitempty"`
+	Ciudad          string   `json:"ciudad,omitempty"`
+	Colonia         string   `json:"colonia,omitempty"`
+	PresupuestoMin  *float64 `json:"presupuesto_min,omitempty"`
+	PresupuestoMax  *float64 `json:"presupuesto_max,omitempty"`
+	RecamarasMin    *int     `json:"num_recamaras_min,omitempty"`
+	BanosMin        *int     `json:"num_banos_min,omitempty"`
+	Extras          []string `json:"extras,omitempty"` // Extras que debe tener la propiedad ('alberca', 'jardin', ...)
+}
+
+// EtapaProspecto es una columna del pipeline, tipo es "abierta", "ganada" o "perdida"
+type EtapaProspecto struct {
+	Clave  string `json:"clave" binding:"required"` // Letras minúsculas, números, "-" y "_", no cambia
+	Nombre string `json:"nombre" binding:"required"`
+	Orden  int    `json:"orden"`
+	Tipo   string `json:"tipo" binding:"required"`
+	Activa *bool  `json:"activa"` // Una etapa inactiva no recibe prospectos nuevos, true si no se manda
+}
+
+// CambioEtapaProspecto es el cuerpo de PUT /prospectos/:id/etapa
+type CambioEtapaProspecto struct {
+	Etapa      string `json:"etapa" binding:"required"`
+	Comentario string `json:"comentario"` // Por ejemplo el motivo de un cierre perdido
+}
+
+// ActividadProspecto es un evento de la línea de tiempo del prospecto. Tipo es "nota", "llamada", "correo",
+// "etapa", "asignacion" o "cita"; los correos incluyen las invitaciones y recordatorios que mandó el sistema.
+type ActividadProspecto struct {
+	IDActividad *int      `json:"id_actividad,omitempty"` // Solo las actividades registradas, no las citas ni los recordatorios
+	Tipo        string    `json:"tipo"`
+	Fecha       time.Time `json:"fecha"`
+	Titulo      string    `json:"titulo"`
+	Descripcion string    `json:"descripcion,omitempty"`
+	Usuario     string    `json:"usuario,omitempty"` // Quién la registró, vacío si la hizo el sistema
+	IDCita      *int      `json:"id_citas,omitempty"`
+}
+
+// NuevaActividad es el cuerpo de POST /prospectos/:id/actividades, tipo es "nota", "llamada" o "correo"
+type NuevaActividad struct {
+	Tipo        string     `json:"tipo" binding:"required"`
+	Titulo      string     `json:"titulo"`
+	Descripcion string     `json:"descripcion" binding:"required"`
+	Fecha       *time.Time `json:"fecha"` // Cuándo pasó, ahora si no se manda
+}
+
+// ColumnaPipeline es una etapa del tablero con sus prospectos
+type ColumnaPipeline struct {
+	Etapa      EtapaProspecto       `json:"etapa"`
+	Total      int                  `json:"total"`      // Prospectos en la etapa, aunque no vengan todos
+	Prospectos []*ProspectoPipeline `json:"prospectos"` // Los que llevan menos tiempo en la etapa primero
+}
+
+// ProspectoPipeline es la tarjeta del prospecto en el tablero
+type ProspectoPipeline struct {
+	IdCliente      int        `json:"id_cliente"`
+	Nombre         string     `json:"nombre"`
+	Telefono       string     `json:"telefono_prospecto"`
+	Correo         string     `json:"correo_prospecto"`
+	Usuario        string     `json:"usuario"`
+	Origen         string     `json:"origen"`
+	PresupuestoMax *float64   `json:"presupuesto_max,omitempty"`
+	EtapaDesde     time.Time  `json:"etapa_desde"`
+	ProximaCita    *time.Time `json:"proxima_cita,omitempty"`
+}
+
+// FiltroPipeline son los filtros de GET /prospectos/pipeline
+type FiltroPipeline struct {
+	Usuario string `form:"usuario"` // Agente asignado
+	Origen  string `form:"origen"`
+	Limite  int    `form:"limite"` // Prospectos por columna, 50 por defecto
+}
+
+// PuntajeMatch es qué tan bien cumple una propiedad los criterios de un prospecto
+type PuntajeMatch struct {
+	Puntaje    int      `json:"puntaje"`     // 0 a 100, solo cuentan los criterios que el prospecto llenó
+	Coincide   []string `json:"coincide"`    // Criterios que cumple
+	NoCoincide []string `json:"no_coincide"` // Criterios que no cumple o que cumple a medias
+}
+
+// MatchPropiedad es una propiedad disponible que le puede interesar a un prospecto
+type MatchPropiedad struct {
+	Propiedad MenuPropiedades `json:"propiedad"`
+	Ciudad    string          `json:"ciudad"`
+	Colonia   string          `json:"colonia"`
+	PuntajeMatch
+}
+
+// InteresadoPropiedad es un prospecto abierto al que le puede interesar una propiedad
+type InteresadoPropiedad struct {
+	IdCliente int    `json:"id_cliente"`
+	Nombre    string `json:"nombre"`
+	Telefono  string `json:"telefono_prospecto"`
+	Correo    string `json:"correo_prospecto"`
+	Usuario   string `json:"usuario"` // Agente asignado
+	Etapa     string `json:"etapa"`
+	PuntajeMatch
+}
+
+// FiltroMatches son los filtros de GET /prospectos/:id/matches y GET /propiedades/:id/interesados
+type FiltroMatches struct {
+	Minimo *int `form:"minimo"` // Puntaje mínimo, 60 por defecto
+	Limite int  `form:"limite"` // 20 por defecto, máximo 100
 }
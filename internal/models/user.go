@@ -24,9 +24,11 @@ type UserLoginData struct {
 }
 
 type JWTClaims struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Role     string `json:"rol"`
+	UserID    int    `json:"uid"`
+	SessionID int    `json:"sid"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Role      string `json:"rol"`
 	jwt.RegisteredClaims
 }
 
@@ -1,50 +1,72 @@
 package router
 
 import (
+	"log"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
+	"backend/config"
 	"backend/internal/controllers"
 	"backend/internal/database"
 	"backend/internal/services"
+	"backend/internal/storage"
 )
 
 func SetupRouter() *gin.Engine {
 	router := gin.Default()
+	if err := router.SetTrustedProxies(config.GetTrustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
+	store, err := storage.New(config.GetStorageConfig())
+	if err != nil {
+		log.Fatal("Failed to initialize file storage:", err)
+	}
 
 	// Initialize services
+	zonaDefault := config.GetDefaultLocation()
 	emailService := services.NewEmailService(database.DB)
-	userService := services.NewUserService(database.DB, emailService)
+	sessionService := services.NewSessionService(database.DB)
+	userService := services.NewUserService(database.DB, emailService, sessionService)
 	propiedadService := services.NewPropiedadService(database.DB)
 	propietarioService := services.NewPropietarioService(database.DB)
 	tipoPropiedadService := services.NewTipoPropiedadService(database.DB)
-	citasService := services.NewCitasService(database.DB)
+	citasService := services.NewCitasService(database.DB, zonaDefault, emailService)
 	prospectoService := services.NewProspectoService(database.DB)
 	imagenesService := services.NewImagenesService(database.DB)
 	imagenesProspectoService := services.NewImagenesProspectoService(database.DB)
-	contratoService := services.NewContratosService(database.DB)
+	contratoService := services.NewContratosService(database.DB, zonaDefault, emailService)
 	documentosAnexosService := services.NewDocumentosAnexosService(database.DB)
 	estadoPropiedadService := services.NewEstadoPropiedadService(database.DB)
+	authorizationService := services.NewAuthorizationService(database.DB)
+	archivosService := services.NewArchivosService(store)
+	variantesService := services.NewVariantesService(database.DB, archivosService)
+	comisionesService := services.NewComisionesService(database.DB, emailService, zonaDefault)
 
 	// Initialize controllers
 	userController := controllers.NewUserController(userService)
-	propiedadController := controllers.NewPropiedadController(propiedadService, estadoPropiedadService)
-	estadoPropiedadController := controllers.NewEstadoPropiedadController(estadoPropiedadService)
+	propiedadController := controllers.NewPropiedadController(propiedadService, estadoPropiedadService, citasService, prospectoService, authorizationService)
+	estadoPropiedadController := controllers.NewEstadoPropiedadController(estadoPropiedadService, authorizationService)
 	propietarioController := controllers.NewPropietarioController(propietarioService)
 	tipoPropiedadController := controllers.NewTipoPropiedadController(tipoPropiedadService)
-	citasController := controllers.NewCitasController(citasService)
-	prospectoController := controllers.NewProspectoController(prospectoService)
-	imagenesController := controllers.NewImagenesController(imagenesService)
-	imagenesProspectoController := controllers.NewImagenesProspectoController(imagenesProspectoService)
-	contratosController := controllers.NewContratosController(contratoService)
-	documentosAnexosController := controllers.NewDocumentosAnexosController(documentosAnexosService)
+	citasController := controllers.NewCitasController(citasService, authorizationService)
+	prospectoController := controllers.NewProspectoController(prospectoService, authorizationService)
+	imagenesController := controllers.NewImagenesController(imagenesService, archivosService, variantesService, authorizationService)
+	imagenesProspectoController := controllers.NewImagenesProspectoController(imagenesProspectoService, archivosService, variantesService)
+	contratosController := controllers.NewContratosController(contratoService, archivosService, authorizationService)
+	documentosAnexosController := controllers.NewDocumentosAnexosController(documentosAnexosService, archivosService, authorizationService)
 	verificarEmailController := controllers.NewVerificarEmailController(emailService)
+	comisionesController := controllers.NewComisionesController(comisionesService)
+
+	// Workers en segundo plano
+	variantesService.Start()
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "ETag"},
 		AllowCredentials: true,
 	}))
 
@@ -56,19 +78,23 @@ func SetupRouter() *gin.Engine {
 	router.RemoveExtraSlash = true
 
 	v1 := router.Group("/api/v1")
+	auth := services.JwtAuthorization(sessionService)
 
 	authRoutes(v1, userController)
-	userRoutes(v1, userController)
-	propiedadRoutes(v1, propiedadController)
-	propietarioRoutes(v1, propietarioController)
-	tipoPropiedadRoutes(v1, tipoPropiedadController)
-	estadoPropiedadRoutes(v1, estadoPropiedadController)
-	prospectoRoutes(v1, prospectoController)
-	imagenesProspectoRoutes(v1, imagenesProspectoController)
-	citasRoutes(v1, citasController)
-	contratosRoutes(v1, contratosController)
-	imagenesRoutes(v1, imagenesController)
-	documentosAnexosRoutes(v1, documentosAnexosController)
+	userRoutes(v1, userController, auth, authorizationService)
+	propiedadRoutes(v1, propiedadController, auth, authorizationService)
+	propietarioRoutes(v1, propietarioController, comisionesController, auth, authorizationService)
+	tipoPropiedadRoutes(v1, tipoPropiedadController, auth, authorizationService)
+	estadoPropiedadRoutes(v1, estadoPropiedadController, auth, authorizationService)
+	prospectoRoutes(v1, prospectoController, auth, authorizationService)
+	imagenesProspectoRoutes(v1, imagenesProspectoController, auth, authorizationService)
+	citasRoutes(v1, citasController, auth, authorizationService)
+	calendarioRoutes(v1, citasController)
+	contratosRoutes(v1, contratosController, auth, authorizationService)
+	comisionesRoutes(v1, comisionesController, auth, authorizationService)
+	firmasRoutes(v1, contratosController)
+	imagenesRoutes(v1, imagenesController, auth, authorizationService)
+	documentosAnexosRoutes(v1, documentosAnexosController, auth, authorizationService)
 	verificarEmailRoutes(v1, verificarEmailController)
 
 	return router
@@ -76,16 +102,19 @@ func SetupRouter() *gin.Engine {
 
 func authRoutes(group *gin.RouterGroup, userController *controllers.UserController) {
 	group.POST("/login", userController.Login)
+	group.POST("/refresh", userController.Refresh)
+	group.POST("/logout", userController.Logout)
 }
 
-func userRoutes(group *gin.RouterGroup, userController *controllers.UserController) {
+func userRoutes(group *gin.RouterGroup, userController *controllers.UserController, auth gin.HandlerFunc, policy *services.AuthorizationService) {
 	group.POST("/users/create", userController.CreateUser)
 	users := group.Group("/users")
-	users.Use(services.JwtAuthorization())
-	users.Use(services.ValidateUserAdmin())
+	users.Use(auth)
+	users.Use(policy.RequireAdmin())
 	{
 		users.GET("/:id", userController.GetUser)
 		users.POST("/set-password/:id", userController.SetPasswordUser)
+		users.POST("/revoke-sessions/:id", userController.RevokeSessions)
 	}
 }
 
@@ -94,107 +123,218 @@ func verificarEmailRoutes(group *gin.RouterGroup, verificarEmailController *cont
 	group.POST("/reenviar-codigo-verificacion", verificarEmailController.ReenviarCodigoVerificacion)
 }
 
-func propiedadRoutes(group *gin.RouterGroup, propiedadController *controllers.Propiedad_Controller) {
+func propiedadRoutes(group *gin.RouterGroup, propiedadController *controllers.Propiedad_Controller, auth gin.HandlerFunc, policy *services.AuthorizationService) {
 	propiedades := group.Group("/propiedades")
-	propiedades.Use(services.JwtAuthorization())
+	propiedades.Use(auth)
+	propiedades.Use(policy.RequireRole(services.RoleAdmin, services.RoleAgente))
 	{
 		propiedades.GET("/all", propiedadController.GetAllPropiedades)
-		propiedades.GET("/all/propiedadesByPrice", propiedadController.GetAllPropiedadesByPrice)
-		propiedades.GET("/all/propiedadesByBedrooms", propiedadController.GetAllPropiedadesByBedrooms)
+		propiedades.GET("/search", propiedadController.SearchPropiedades)
 		propiedades.GET("/:id", propiedadController.GetPropiedad)
 		propiedades.POST("/create", propiedadController.CreatePropiedad)
-		propiedades.PUT("/update/:id", propiedadController.UpdatePropiedad)
-		propiedades.DELETE("/eliminar/:id", propiedadController.DeletePropiedad)
+		propiedades.POST("/create/completa", propiedadController.CreatePropiedadCompleta)
+		propiedades.PUT("/update/:id", policy.RequireOwner(services.ResourcePropiedad, "id"), propiedadController.UpdatePropiedad)
+		propiedades.DELETE("/eliminar/:id", policy.RequireOwner(services.ResourcePropiedad, "id"), propiedadController.DeletePropiedad)
+		propiedades.PUT("/:id/estado", policy.RequireOwner(services.ResourcePropiedad, "id"), propiedadController.CambiarEstado)
+		propiedades.GET("/:id/historial", propiedadController.GetHistorial)
+		propiedades.GET("/:id/visitas", propiedadController.GetVisitas)
+		propiedades.GET("/:id/interesados", propiedadController.GetInteresados)
 	}
 }
 
-func propietarioRoutes(group *gin.RouterGroup, propietarioController *controllers.PropietarioController) {
+func propietarioRoutes(group *gin.RouterGroup, propietarioController *controllers.PropietarioController, comisionesController *controllers.ComisionesController, auth gin.HandlerFunc, policy *services.AuthorizationService) {
 	propietarios := group.Group("/propietarios")
-	propietarios.Use(services.JwtAuthorization())
+	propietarios.Use(auth)
+	propietarios.Use(policy.RequireRole(services.RoleAdmin, services.RoleAgente))
 	{
+		propietarios.GET("/all", propietarioController.GetAllPropietarios)
+		propietarios.GET("/search", propietarioController.SearchPropietarios)
 		propietarios.GET("/:id", propietarioController.GetPropietario)
+		propietarios.GET("/:id/propiedades", propietarioController.GetPortafolio)
 		propietarios.POST("/create", propietarioController.CreatePropietario)
+		propietarios.PUT("/update/:id", propietarioController.UpdatePropietario)
+		propietarios.DELETE("/eliminar/:id", policy.RequireAdmin(), propietarioController.DeletePropietario)
+		propietarios.GET("/duplicados", propietarioController.GetDuplicados)
+		propietarios.POST("/fusionar", policy.RequireAdmin(), propietarioController.Fusionar)
+		propietarios.GET("/:id/estado-cuenta", policy.RequireAdmin(), comisionesController.GetEstadoPropietario)
+		propietarios.GET("/:id/estado-cuenta/pdf", policy.RequireAdmin(), comisionesController.DownloadEstadoPropietarioPDF)
+		propietarios.GET("/:id/estado-cuenta/csv", policy.RequireAdmin(), comisionesController.DownloadEstadoPropietarioCSV)
+		propietarios.POST("/:id/estado-cuenta/enviar", policy.RequireAdmin(), comisionesController.EnviarEstadoPropietario)
 	}
 }
 
-func prospectoRoutes(group *gin.RouterGroup, prospectoController *controllers.ProspectoController) {
+func prospectoRoutes(group *gin.RouterGroup, prospectoController *controllers.ProspectoController, auth gin.HandlerFunc, policy *services.AuthorizationService) {
 	prospectos := group.Group("/prospectos")
-	prospectos.Use(services.JwtAuthorization())
+	prospectos.Use(auth)
+	prospectos.Use(policy.RequireRole(services.RoleAdmin, services.RoleAgente))
 	{
 		prospectos.GET("/:id", prospectoController.GetProspecto)
 		prospectos.POST("/create", prospectoController.InsertProspecto)
-		prospectos.PUT("/update/:id", prospectoController.UpdateProspecto)
+		prospectos.PUT("/update/:id", policy.RequireOwner(services.ResourceProspecto, "id"), prospectoController.UpdateProspecto)
+		prospectos.GET("/pipeline", prospectoController.GetPipeline)
+		prospectos.GET("/duplicados", prospectoController.GetDuplicados)
+		prospectos.POST("/fusionar", policy.RequireAdmin(), prospectoController.Fusionar)
+		prospectos.GET("/etapas", prospectoController.GetEtapas)
+		prospectos.POST("/etapas", policy.RequireAdmin(), prospectoController.CreateEtapa)
+		prospectos.PUT("/etapas/:clave", policy.RequireAdmin(), prospectoController.UpdateEtapa)
+		prospectos.PUT("/:id/etapa", policy.RequireOwner(services.ResourceProspecto, "id"), prospectoController.CambiarEtapa)
+		prospectos.GET("/:id/matches", prospectoController.GetMatches)
+		prospectos.GET("/:id/actividades", prospectoController.GetActividades)
+		prospectos.POST("/:id/actividades", policy.RequireOwner(services.ResourceProspecto, "id"), prospectoController.RegistrarActividad)
 	}
 }
 
-func tipoPropiedadRoutes(group *gin.RouterGroup, tipoPropiedadController *controllers.TipoPropiedadController) {
+func tipoPropiedadRoutes(group *gin.RouterGroup, tipoPropiedadController *controllers.TipoPropiedadController, auth gin.HandlerFunc, policy *services.AuthorizationService) {
 	tipos := group.Group("/tipopropiedad")
-	tipos.Use(services.JwtAuthorization())
+	tipos.Use(auth)
+	tipos.Use(policy.RequireRole(services.RoleAdmin, services.RoleAgente))
 	{
 		tipos.GET("/:id", tipoPropiedadController.GetTipoPropiedad)
-		tipos.POST("/create", tipoPropiedadController.CreateTipoPropiedad)
+		tipos.POST("/create", policy.RequireAdmin(), tipoPropiedadController.CreateTipoPropiedad)
 	}
 }
 
-func estadoPropiedadRoutes(group *gin.RouterGroup, estadoPropiedadController *controllers.EstadoPropiedadController) {
+func estadoPropiedadRoutes(group *gin.RouterGroup, estadoPropiedadController *controllers.EstadoPropiedadController, auth gin.HandlerFunc, policy *services.AuthorizationService) {
 	estados := group.Group("/estadopropiedad")
-	estados.Use(services.JwtAuthorization())
+	estados.Use(auth)
+	estados.Use(policy.RequireRole(services.RoleAdmin, services.RoleAgente))
 	{
 		estados.GET("/:id", estadoPropiedadController.GetEstadoPropiedad)
 		estados.POST("/create", estadoPropiedadController.CreateEstadoPropiedad)
-		estados.DELETE("/eliminar/:id", estadoPropiedadController.DeleteEstadoPropiedad)
+		estados.DELETE("/eliminar/:id", policy.RequireAdmin(), estadoPropiedadController.DeleteEstadoPropiedad)
 	}
 }
-func imagenesProspectoRoutes(group *gin.RouterGroup, imagenesProspectoController *controllers.ImagenesProspectoController) {
+func imagenesProspectoRoutes(group *gin.RouterGroup, imagenesProspectoController *controllers.ImagenesProspectoController, auth gin.HandlerFunc, policy *services.AuthorizationService) {
 	imagenes := group.Group("/imagenesProspecto")
-	imagenes.Use(services.JwtAuthorization())
+	imagenes.Use(auth)
+	imagenes.Use(policy.RequireRole(services.RoleAdmin, services.RoleAgente))
 	{
 		imagenes.GET("/principal/:id", imagenesProspectoController.GetImagenPrincipal)
 		imagenes.GET("/prospecto/:id", imagenesProspectoController.GetImagenesByProspecto)
 		imagenes.POST("/create", imagenesProspectoController.InsertImagen)
+		imagenes.POST("/upload", imagenesProspectoController.UploadImagen)
+		imagenes.GET("/archivo/:id", policy.RequireOwner(services.ResourceImagenProspecto, "id"), imagenesProspectoController.DownloadImagen)
+		imagenes.GET("/archivo/:id/:variante", policy.RequireOwner(services.ResourceImagenProspecto, "id"), imagenesProspectoController.DownloadVariante)
+		imagenes.PUT("/update/:id", policy.RequireOwner(services.ResourceImagenProspecto, "id"), imagenesProspectoController.UpdateImagen)
+		imagenes.PUT("/:id/principal", policy.RequireOwner(services.ResourceImagenProspecto, "id"), imagenesProspectoController.SetImagenPrincipal)
+		imagenes.PUT("/prospecto/:id/orden", policy.RequireOwner(services.ResourceProspecto, "id"), imagenesProspectoController.ReordenarImagenes)
+		imagenes.DELETE("/eliminar/:id", policy.RequireOwner(services.ResourceImagenProspecto, "id"), imagenesProspectoController.DeleteImagen)
 	}
 }
-func citasRoutes(group *gin.RouterGroup, citasController *controllers.CitasController) {
+func citasRoutes(group *gin.RouterGroup, citasController *controllers.CitasController, auth gin.HandlerFunc, policy *services.AuthorizationService) {
 	citas := group.Group("/citas")
-	citas.Use(services.JwtAuthorization())
+	citas.Use(auth)
+	citas.Use(policy.RequireRole(services.RoleAdmin, services.RoleAgente))
 	{
 		citas.GET("/all/:id", citasController.GetAllCitas)
-		citas.GET("/:id", citasController.GetCita)
+		citas.GET("/disponibilidad", citasController.GetDisponibilidad)
+		citas.GET("/horario/:usuario", citasController.GetHorario)
+		citas.PUT("/horario/:usuario", citasController.SetHorario)
+		citas.POST("/calendario/:usuario", citasController.GenerarTokenCalendario)
+		citas.DELETE("/calendario/:usuario", citasController.RevocarTokenCalendario)
+		citas.GET("/:id", policy.RequireOwner(services.ResourceCita, "id"), citasController.GetCita)
 		citas.GET("/all/:id/:day", citasController.GetAllCitasDay)
+		citas.GET("/mes/:id/:anio/:mes", citasController.GetAllCitasMonth)
 		citas.POST("/create", citasController.InsertCita)
-		citas.PUT("/update/:id", citasController.UpdateCita)
-		citas.DELETE("/eliminar/:id", citasController.DeleteCita)
+		citas.PUT("/update/:id", policy.RequireOwner(services.ResourceCita, "id"), citasController.UpdateCita)
+		citas.DELETE("/eliminar/:id", policy.RequireOwner(services.ResourceCita, "id"), citasController.DeleteCita)
+		citas.PUT("/resultado/:id", policy.RequireOwner(services.ResourceCita, "id"), citasController.RegistrarResultado)
+		citas.PUT("/update/:id/ocurrencia", policy.RequireOwner(services.ResourceCita, "id"), citasController.UpdateOcurrencia)
+		citas.DELETE("/eliminar/:id/ocurrencia", policy.RequireOwner(services.ResourceCita, "id"), citasController.DeleteOcurrencia)
 	}
 }
-func contratosRoutes(group *gin.RouterGroup, contratosController *controllers.ContratosController) {
+
+// El feed ICS es publico, la credencial es el token secreto de la URL
+func calendarioRoutes(group *gin.RouterGroup, citasController *controllers.CitasController) {
+	group.GET("/calendario/:token", citasController.GetCalendario)
+}
+// Las partes firman sin cuenta, la credencial es el token de un solo uso que les llega por correo
+func firmasRoutes(group *gin.RouterGroup, contratosController *controllers.ContratosController) {
+	group.GET("/firmas/:token", contratosController.GetSolicitudFirma)
+	group.GET("/firmas/:token/pdf", contratosController.GetDocumentoFirma)
+	group.POST("/firmas/:token", contratosController.Firmar)
+}
+func contratosRoutes(group *gin.RouterGroup, contratosController *controllers.ContratosController, auth gin.HandlerFunc, policy *services.AuthorizationService) {
 	contratos := group.Group("/contratos")
-	contratos.Use(services.JwtAuthorization())
+	contratos.Use(auth)
+	contratos.Use(policy.RequireRole(services.RoleAdmin, services.RoleAgente))
 	{
 		contratos.GET("/:id", contratosController.GetContrato)
 		contratos.GET("/all", contratosController.GetContratos)
 		contratos.GET("/propiedad/:id_propiedad", contratosController.GetContratosByPropiedad)
 		contratos.POST("/", contratosController.CreateContrato)
-		contratos.PUT("/:id", contratosController.UpdateContrato)
-		contratos.DELETE("/:id", contratosController.DeleteContrato)
+		contratos.PUT("/:id", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.UpdateContrato)
+		contratos.DELETE("/:id", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.DeleteContrato)
+		contratos.POST("/:id/pdf", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.UploadContratoPDF)
+		contratos.GET("/:id/pdf", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.DownloadContratoPDF)
+		contratos.POST("/:id/generar", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.GenerarContrato)
+		contratos.POST("/:id/regenerar", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.RegenerarContrato)
+		contratos.GET("/:id/generacion", contratosController.GetGeneracion)
+		contratos.PUT("/:id/partes", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.SetPartes)
+		contratos.PUT("/:id/estado", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.CambiarEstado)
+		contratos.GET("/por-vencer", contratosController.GetPorVencer)
+		contratos.POST("/:id/firmas", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.EnviarAFirma)
+		contratos.POST("/:id/firmas/:id_firma/reenviar", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.ReenviarFirma)
+		contratos.DELETE("/:id/firmas", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.CancelarFirmas)
+		contratos.GET("/:id/firmas", contratosController.GetFirmas)
+		contratos.GET("/:id/pdf-firmado", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.DownloadContratoFirmado)
+		contratos.GET("/:id/estado-cuenta", contratosController.GetEstadoCuenta)
+		contratos.POST("/:id/pagos", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.RegistrarPago)
+		contratos.POST("/:id/pagos/:id_pago/cancelar", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.CancelarPago)
+		contratos.POST("/:id/cargos/:id_cargo/condonar", policy.RequireOwner(services.ResourceContrato, "id"), contratosController.CondonarRecargo)
+		contratos.GET("/cartera-vencida", contratosController.GetCarteraVencida)
+
+		contratos.GET("/plantillas", contratosController.GetPlantillas)
+		contratos.GET("/plantillas/variables", contratosController.GetVariablesPlantilla)
+		contratos.GET("/plantillas/:id", contratosController.GetPlantilla)
+		contratos.GET("/plantillas/:id/versiones/:version", contratosController.GetVersionPlantilla)
+		contratos.POST("/plantillas", policy.RequireAdmin(), contratosController.CreatePlantilla)
+		contratos.PUT("/plantillas/:id", policy.RequireAdmin(), contratosController.UpdatePlantilla)
+		contratos.POST("/plantillas/:id/versiones", policy.RequireAdmin(), contratosController.CreateVersionPlantilla)
+	}
+}
+func comisionesRoutes(group *gin.RouterGroup, comisionesController *controllers.ComisionesController, auth gin.HandlerFunc, policy *services.AuthorizationService) {
+	comisiones := group.Group("/comisiones")
+	comisiones.Use(auth)
+	comisiones.Use(policy.RequireRole(services.RoleAdmin, services.RoleAgente))
+	{
+		comisiones.GET("/reglas", comisionesController.GetReglas)
+		comisiones.PUT("/reglas", policy.RequireAdmin(), comisionesController.GuardarRegla)
+		comisiones.DELETE("/reglas/:id", policy.RequireAdmin(), comisionesController.DeleteRegla)
+		comisiones.GET("/contratos/:id", comisionesController.GetComisionContrato)
+		comisiones.PUT("/contratos/:id", policy.RequireAdmin(), comisionesController.SetComisionContrato)
+		comisiones.DELETE("/contratos/:id", policy.RequireAdmin(), comisionesController.DeleteComisionContrato)
+		comisiones.GET("/agentes", comisionesController.GetComisionesAgentes)
 	}
 }
-func imagenesRoutes(group *gin.RouterGroup, imagenesController *controllers.ImagenesController) {
+func imagenesRoutes(group *gin.RouterGroup, imagenesController *controllers.ImagenesController, auth gin.HandlerFunc, policy *services.AuthorizationService) {
 	imagenes := group.Group("/imagenes")
-	imagenes.Use(services.JwtAuthorization())
+	imagenes.Use(auth)
+	imagenes.Use(policy.RequireRole(services.RoleAdmin, services.RoleAgente))
 	{
 		imagenes.GET("/all/propiedad/:id", imagenesController.GetImagenesByPropiedad)
 		imagenes.GET("/all/principal/:id", imagenesController.GetImagenPrincipal)
 		imagenes.POST("/create", imagenesController.InsertImagen)
-		imagenes.DELETE("/eliminar/:id", imagenesController.DeleteImagen)
+		imagenes.POST("/upload", imagenesController.UploadImagen)
+		imagenes.GET("/archivo/:id", policy.RequireOwner(services.ResourceImagen, "id"), imagenesController.DownloadImagen)
+		imagenes.GET("/archivo/:id/:variante", policy.RequireOwner(services.ResourceImagen, "id"), imagenesController.DownloadVariante)
+		imagenes.PUT("/update/:id", policy.RequireOwner(services.ResourceImagen, "id"), imagenesController.UpdateImagen)
+		imagenes.DELETE("/eliminar/:id", policy.RequireOwner(services.ResourceImagen, "id"), imagenesController.DeleteImagen)
+		imagenes.PUT("/:id/principal", policy.RequireOwner(services.ResourceImagen, "id"), imagenesController.SetImagenPrincipal)
+		imagenes.PUT("/propiedad/:id/orden", policy.RequireOwner(services.ResourcePropiedad, "id"), imagenesController.ReordenarImagenes)
 	}
 }
 
-func documentosAnexosRoutes(group *gin.RouterGroup, documentosAnexosController *controllers.DocumentosAnexosController){
+func documentosAnexosRoutes(group *gin.RouterGroup, documentosAnexosController *controllers.DocumentosAnexosController, auth gin.HandlerFunc, policy *services.AuthorizationService) {
 	documentos := group.Group("/documentos_anexos")
-	documentos.Use(services.JwtAuthorization())
+	documentos.Use(auth)
+	documentos.Use(policy.RequireRole(services.RoleAdmin, services.RoleAgente))
 	{
 		documentos.GET("/all/propiedad/:id", documentosAnexosController.GetDocumentosByPropiedad)
 		documentos.GET("/:id", documentosAnexosController.GetDocumentoAnexo)
 		documentos.POST("/create", documentosAnexosController.InsertDocumentoAnexo)
+		documentos.POST("/upload", documentosAnexosController.UploadDocumentoAnexo)
+		documentos.PUT("/update/:id", policy.RequireOwner(services.ResourceDocumentoAnexo, "id"), documentosAnexosController.UpdateDocumentoAnexo)
+		documentos.GET("/archivo/:id", policy.RequireOwner(services.ResourceDocumentoAnexo, "id"), documentosAnexosController.DownloadDocumentoAnexo)
 	}
 }
\ No newline at end of file
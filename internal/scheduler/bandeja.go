@@ -0,0 +1,109 @@
+package scheduler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ErrCancelado lo regresa un envío que ya no se debe mandar, el registro queda en 'cancelado'
+var ErrCancelado = errors.New("envio cancelado")
+
+// Bandeja es una tabla de correos que mandan las tareas. Cada registro pasa de 'pendiente' a 'enviando' cuando una
+// replica lo reclama y de ahí a 'enviado'; si el envío falla vuelve a 'pendiente' hasta agotar los intentos y queda en
+// 'fallido'. La tabla necesita las columnas estado, intentos, reclamado_en, enviado_en y ultimo_error.
+type Bandeja struct {
+	DB        *sql.DB
+	Tabla     string
+	ColumnaID string
+	// ColumnaCorreo guarda a quién se mandó, vacía si la tabla no la tiene
+	ColumnaCorreo string
+	// Intentos es cuántas veces se intenta un registro antes de marcarlo fallido
+	Intentos int
+	// Expira es cuánto puede quedarse un registro en 'enviando' antes de volver a 'pendiente'
+	Expira time.Duration
+	// SinIntento indica los errores que no cuentan como intento, por ejemplo sin SMTP configurado
+	SinIntento func(error) bool
+}
+
+// Liberar regresa a 'pendiente' lo que se quedó en 'enviando' por un reinicio, cada tarea lo llama al empezar
+func (b *Bandeja) Liberar() error {
+	query := "UPDATE " + b.Tabla + " SET estado = 'pendiente' WHERE estado = 'enviando' AND reclamado_en < ?"
+	if _, err := b.DB.Exec(query, time.Now().UTC().Add(-b.Expira)); err != nil {
+		log.Printf("Error releasing %s: %v", b.Tabla, err)
+		return err
+	}
+	return nil
+}
+
+// reclamar pasa el registro a 'enviando', regresa false si otra replica ya lo reclamó
+func (b *Bandeja) reclamar(id int) bool {
+	query := "UPDATE " + b.Tabla + " SET estado = 'enviando', reclamado_en = ? WHERE " + b.ColumnaID + " = ? AND estado = 'pendiente'"
+	result, err := b.DB.Exec(query, time.Now().UTC(), id)
+	if err != nil {
+		log.Printf("Error claiming %s: %v", b.Tabla, err)
+		return false
+	}
+	rows, err := result.RowsAffected()
+	return err == nil && rows == 1
+}
+
+// terminar deja los registros reclamados según cómo salió el envío
+func (b *Bandeja) terminar(ids []int, correo string, err error) {
+	// Los ids son enteros que salieron de la base, no hay nada que escapar
+	lista := make([]string, len(ids))
+	for i, id := range ids {
+		lista[i] = fmt.Sprint(id)
+	}
+	enLista := " WHERE " + b.ColumnaID + " IN (" + strings.Join(lista, ",") + ")"
+
+	var query string
+	var args []interface{}
+	switch {
+	case err == nil:
+		query = "UPDATE " + b.Tabla + " SET estado = 'enviado', enviado_en = ?"
+		args = append(args, time.Now().UTC())
+		if b.ColumnaCorreo != "" && correo != "" {
+			query += ", " + b.ColumnaCorreo + " = ?"
+			args = append(args, correo)
+		}
+	case errors.Is(err, ErrCancelado):
+		query = "UPDATE " + b.Tabla + " SET estado = 'cancelado'"
+	case b.SinIntento != nil && b.SinIntento(err):
+		log.Printf("%s %s: %v", b.Tabla, strings.Join(lista, ","), err)
+		query = "UPDATE " + b.Tabla + " SET estado = 'pendiente'"
+	default:
+		log.Printf("%s %s: %v", b.Tabla, strings.Join(lista, ","), err)
+		query = "UPDATE " + b.Tabla + ` SET intentos = intentos + 1, ultimo_error = ?,
+			estado = IF(intentos >= ?, 'fallido', 'pendiente')`
+		mensaje := err.Error()
+		if len(mensaje) > 255 {
+			mensaje = mensaje[:255]
+		}
+		args = append(args, mensaje, b.Intentos)
+	}
+	if _, err := b.DB.Exec(query+enLista, args...); err != nil {
+		log.Printf("Error updating %s: %v", b.Tabla, err)
+	}
+}
+
+// Enviar reclama los registros y, si quedó alguno, los manda juntos con enviar, que regresa a qué correo se mandaron.
+// Los que otra replica ya reclamó se quedan fuera.
+func Enviar[T any](b *Bandeja, registros []T, id func(T) int, enviar func(reclamados []T) (string, error)) {
+	var reclamados []T
+	var ids []int
+	for _, r := range registros {
+		if b.reclamar(id(r)) {
+			reclamados = append(reclamados, r)
+			ids = append(ids, id(r))
+		}
+	}
+	if len(reclamados) == 0 {
+		return
+	}
+	correo, err := enviar(reclamados)
+	b.terminar(ids, correo, err)
+}
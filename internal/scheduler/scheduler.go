@@ -0,0 +1,129 @@
+// Package scheduler ejecuta tareas periodicas en segundo plano. Cada tarea tiene un lease en la tabla
+// Tareas_Programadas, asi aunque haya varias replicas de la API solo una la ejecuta a la vez.
+package scheduler
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Tarea es un trabajo que se repite cada Intervalo
+type Tarea struct {
+	Nombre    string
+	Intervalo time.Duration
+	Ejecutar  func() error
+}
+
+type Scheduler struct {
+	DB *sql.DB
+	// Duenio identifica a esta replica en los leases
+	Duenio string
+	tareas []Tarea
+}
+
+// Constructor para Scheduler
+func New(db *sql.DB) *Scheduler {
+	return &Scheduler{
+		DB:     db,
+		Duenio: identificador(),
+	}
+}
+
+// Registrar agrega una tarea, se tiene que llamar antes de Start
+func (s *Scheduler) Registrar(nombre string, intervalo time.Duration, ejecutar func() error) {
+	s.tareas = append(s.tareas, Tarea{Nombre: nombre, Intervalo: intervalo, Ejecutar: ejecutar})
+}
+
+// Start arranca una goroutine por tarea, la primera ejecución es inmediata
+func (s *Scheduler) Start() {
+	for _, tarea := range s.tareas {
+		log.Printf("Scheduler: tarea %s cada %s (replica %s)", tarea.Nombre, tarea.Intervalo, s.Duenio)
+		go s.run(tarea)
+	}
+}
+
+func (s *Scheduler) run(tarea Tarea) {
+	ticker := time.NewTicker(tarea.Intervalo)
+	defer ticker.Stop()
+	for {
+		s.ejecutar(tarea)
+		<-ticker.C
+	}
+}
+
+// ejecutar corre la tarea si esta replica tiene el lease. El lease dura dos intervalos, si la replica se cae
+// otra lo toma cuando vence.
+func (s *Scheduler) ejecutar(tarea Tarea) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Scheduler: la tarea %s falló: %v", tarea.Nombre, r)
+		}
+	}()
+
+	ok, err := s.tomarLease(tarea.Nombre, 2*tarea.Intervalo)
+	if err != nil {
+		log.Printf("Scheduler: no se pudo tomar el lease de %s: %v", tarea.Nombre, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	if err := tarea.Ejecutar(); err != nil {
+		log.Printf("Scheduler: la tarea %s regresó un error: %v", tarea.Nombre, err)
+		return
+	}
+	if _, err := s.DB.Exec("UPDATE Tareas_Programadas SET ultima_ejecucion = ? WHERE nombre = ? AND duenio = ?",
+		time.Now().UTC(), tarea.Nombre, s.Duenio); err != nil {
+		log.Printf("Scheduler: no se pudo registrar la ejecución de %s: %v", tarea.Nombre, err)
+	}
+}
+
+// tomarLease regresa true si esta replica ya tenia el lease de la tarea o si el de otra replica ya venció
+func (s *Scheduler) tomarLease(nombre string, duracion time.Duration) (bool, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	ahora := time.Now().UTC()
+	if _, err := tx.Exec("INSERT IGNORE INTO Tareas_Programadas (nombre, duenio, lease_hasta) VALUES (?, '', ?)", nombre, ahora); err != nil {
+		return false, err
+	}
+
+	var duenio string
+	var leaseHasta time.Time
+	err = tx.QueryRow("SELECT duenio, lease_hasta FROM Tareas_Programadas WHERE nombre = ? FOR UPDATE", nombre).Scan(&duenio, &leaseHasta)
+	if err != nil {
+		return false, err
+	}
+	if duenio != s.Duenio && leaseHasta.After(ahora) {
+		return false, nil
+	}
+
+	if _, err := tx.Exec("UPDATE Tareas_Programadas SET duenio = ?, lease_hasta = ? WHERE nombre = ?", s.Duenio, ahora.Add(duracion), nombre); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// identificador regresa hostname-pid-aleatorio, en Docker el hostname es el id del contenedor
+func identificador() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "api"
+	}
+	raw := make([]byte, 4)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(raw))
+}
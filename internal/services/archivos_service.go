@@ -0,0 +1,209 @@
+package services
+
+import (
+	"backend/internal/models"
+	"backend/internal/storage"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrFileTooLarge        = errors.New("file too large")
+	ErrUnsupportedFileType = errors.New("unsupported file type")
+	ErrEmptyFile           = errors.New("empty file")
+)
+
+// Con QuitarGPS se borra la ubicación del EXIF de las fotos (JPEG, PNG y WebP) antes de guardarlas.
+// Con QuitarGPS se borra la ubicación del EXIF de las fotos JPEG antes de guardarlas.
+type TipoArchivo struct {
+	Carpeta   string
+	MaxBytes  int64
+	MIMEs     []string
+	QuitarGPS bool
+}
+
+var (
+	ArchivoImagen          = TipoArchivo{Carpeta: "imagenes", MaxBytes: 10 << 20, MIMEs: []string{"image/jpeg", "image/png", "image/webp"}, QuitarGPS: true}
+	ArchivoImagenProspecto = TipoArchivo{Carpeta: "prospectos", MaxBytes: 10 << 20, MIMEs: []string{"image/jpeg", "image/png", "image/webp"}, QuitarGPS: true}
+	ArchivoContrato        = TipoArchivo{Carpeta: "contratos", MaxBytes: 20 << 20, MIMEs: []string{"application/pdf"}}
+	ArchivoDocumento       = TipoArchivo{Carpeta: "documentos", MaxBytes: 20 << 20, MIMEs: []string{"application/pdf", "image/jpeg", "image/png"}, QuitarGPS: true}
+)
+
+var extensionesMIME = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+type ArchivosService struct {
+	Storage storage.Storage
+}
+
+// Constructor para ArchivosService
+func NewArchivosService(store storage.Storage) *ArchivosService {
+	return &ArchivosService{
+		Storage: store,
+	}
+}
+
+// Save valida el archivo subido y lo guarda en el storage, regresa la ruta y el checksum para guardarlos en la base de datos.
+// El tipo MIME se detecta con el contenido del archivo, no con lo que diga el cliente.
+func (service *ArchivosService) Save(header *multipart.FileHeader, tipo TipoArchivo) (*models.Archivo, error) {
+	if header.Size > tipo.MaxBytes {
+		return nil, ErrFileTooLarge
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		log.Println("Error abriendo archivo subido:", err)
+		return nil, err
+	}
+	defer file.Close()
+
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return nil, ErrEmptyFile
+		}
+		log.Println("Error leyendo archivo subido:", err)
+		return nil, err
+	}
+	sniff = sniff[:n]
+
+	mimeType := http.DetectContentType(sniff)
+	if !slices.Contains(tipo.MIMEs, mimeType) {
+		return nil, ErrUnsupportedFileType
+	}
+
+	nombre, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+	archivo := &models.Archivo{
+		Ruta:           tipo.Carpeta + "/" + nombre + extensionesMIME[mimeType],
+		NombreOriginal: filepath.Base(header.Filename),
+		TipoMIME:       mimeType,
+	}
+
+	// Se lee un byte de mas para detectar archivos que mienten sobre su tamaño
+	body := io.LimitReader(io.MultiReader(bytes.NewReader(sniff), file), tipo.MaxBytes+1)
+	if tipo.QuitarGPS && strings.HasPrefix(mimeType, "image/") {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			log.Println("Error leyendo archivo subido:", err)
+			return nil, err
+		}
+		if int64(len(data)) > tipo.MaxBytes {
+			return nil, ErrFileTooLarge
+		}
+		body = bytes.NewReader(stripGPS(mimeType, data))
+	}
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	if err := service.Storage.Put(archivo.Ruta, io.TeeReader(body, io.MultiWriter(hash, counter))); err != nil {
+		log.Println("Error guardando archivo:", err)
+		return nil, err
+	}
+	if counter.n > tipo.MaxBytes {
+		service.Remove(archivo.Ruta)
+		return nil, ErrFileTooLarge
+	}
+
+	archivo.TamanoBytes = counter.n
+	archivo.Checksum = hex.EncodeToString(hash.Sum(nil))
+	return archivo, nil
+}
+
+// SaveBytes guarda contenido generado por la API (por ejemplo las variantes de una imagen) en la ruta indicada
+func (service *ArchivosService) SaveBytes(ruta string, tipoMIME string, data []byte) (*models.Archivo, error) {
+	if err := service.Storage.Put(ruta, bytes.NewReader(data)); err != nil {
+		log.Println("Error guardando archivo:", err)
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return &models.Archivo{
+		Ruta:        ruta,
+		TipoMIME:    tipoMIME,
+		TamanoBytes: int64(len(data)),
+		Checksum:    hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// SaveGenerado guarda un archivo que arma la API (por ejemplo el PDF de un contrato) con un nombre aleatorio en la carpeta del tipo
+func (service *ArchivosService) SaveGenerado(tipo TipoArchivo, nombreOriginal string, tipoMIME string, data []byte) (*models.Archivo, error) {
+	nombre, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+	archivo, err := service.SaveBytes(tipo.Carpeta+"/"+nombre+extensionesMIME[tipoMIME], tipoMIME, data)
+	if err != nil {
+		return nil, err
+	}
+	archivo.NombreOriginal = nombreOriginal
+	return archivo, nil
+}
+
+// Open regresa el contenido del archivo guardado en ruta
+func (service *ArchivosService) Open(ruta string) (io.ReadCloser, error) {
+	return service.Storage.Get(ruta)
+}
+
+// Remove borra el archivo, si falla solo se registra porque el registro en la base de datos ya no lo usa
+func (service *ArchivosService) Remove(ruta string) {
+	if err := service.Storage.Delete(ruta); err != nil {
+		log.Println("Error eliminando archivo", ruta+":", err)
+	}
+}
+
+// queryRower lo cumplen *sql.DB y *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// getArchivo recupera los datos del archivo subido de un registro, regresa nil si no existe
+// o si su ruta se capturo a mano antes de que existiera la subida de archivos (no tiene checksum)
+func getArchivo(db queryRower, query string, id int) (*models.Archivo, error) {
+	var archivo models.Archivo
+	var nombre sql.NullString
+	err := db.QueryRow(query, id).Scan(&archivo.Ruta, &nombre, &archivo.TipoMIME, &archivo.TamanoBytes, &archivo.Checksum)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Println("Error recuperando archivo:", err)
+		return nil, err
+	}
+	archivo.NombreOriginal = nombre.String
+	return &archivo, nil
+}
+
+func randomName() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"backend/internal/database"
+	"backend/internal/models"
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleAgente = "agente"
+)
+
+// Recursos que tienen dueño, el dueño es el usuario (correo) guardado en la columna usuario de Propiedades, Citas o Prospecto.
+// Contratos, imagenes y documentos heredan el dueño de su propiedad, y las imagenes de prospecto el de su prospecto.
+const (
+	ResourcePropiedad       = "propiedad"
+	ResourceCita            = "cita"
+	ResourceContrato        = "contrato"
+	ResourceImagen          = "imagen"
+	ResourceDocumentoAnexo  = "documento_anexo"
+	ResourceProspecto       = "prospecto"
+	ResourceImagenProspecto = "imagen_prospecto"
+)
+
+var (
+	ErrForbidden        = errors.New("forbidden")
+	ErrResourceNotFound = database.ErrNotFound
+)
+
+// Consulta que regresa el dueño de cada recurso a partir de su id
+var resourceOwnerQueries = map[string]string{
+	ResourcePropiedad: "SELECT usuario FROM Propiedades WHERE id_propiedad = ?",
+	ResourceCita:      "SELECT usuario FROM Citas WHERE id_citas = ?",
+	ResourceContrato: `SELECT Propiedades.usuario FROM Contratos
+		INNER JOIN Propiedades ON Propiedades.id_propiedad = Contratos.id_propiedad WHERE Contratos.id_contrato = ?`,
+	ResourceImagen: `SELECT Propiedades.usuario FROM Imagenes
+		INNER JOIN Propiedades ON Propiedades.id_propiedad = Imagenes.id_propiedad WHERE Imagenes.id_imagen = ?`,
+	ResourceDocumentoAnexo: `SELECT Propiedades.usuario FROM Documentos_Anexos
+		INNER JOIN Propiedades ON Propiedades.id_propiedad = Documentos_Anexos.id_propiedad WHERE Documentos_Anexos.id_documento_anexo = ?`,
+	ResourceProspecto: "SELECT usuario FROM Prospecto WHERE id_cliente = ?",
+	ResourceImagenProspecto: `SELECT Prospecto.usuario FROM ImagenesProspecto
+		INNER JOIN Prospecto ON Prospecto.id_cliente = ImagenesProspecto.id_prospecto WHERE ImagenesProspecto.id_imagen = ?`,
+}
+
+// AuthorizationService es la capa de politicas: los admin pueden todo y los agentes solo sus propios registros
+type AuthorizationService struct {
+	DB *sql.DB
+}
+
+// Constructor for the AuthorizationService
+func NewAuthorizationService(db *sql.DB) *AuthorizationService {
+	return &AuthorizationService{
+		DB: db,
+	}
+}
+
+// Regresa nil si el usuario puede modificar el recurso, ErrForbidden si no es suyo o ErrResourceNotFound si no existe
+func (service *AuthorizationService) CanModify(claims *models.JWTClaims, resource string, id int) error {
+	if claims == nil {
+		return ErrForbidden
+	}
+
+	query, ok := resourceOwnerQueries[resource]
+	if !ok {
+		log.Println("Unknown resource in authorization policy:", resource)
+		return ErrForbidden
+	}
+
+	var owner sql.NullString
+	err := service.DB.QueryRow(query, id).Scan(&owner)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrResourceNotFound
+		}
+		log.Println("Error fetching resource owner:", err)
+		return err
+	}
+
+	if IsAdmin(claims) {
+		return nil
+	}
+	if claims.Role == RoleAgente && owner.Valid && owner.String == claims.Email {
+		return nil
+	}
+	log.Printf("User %s is not allowed to modify %s %d", claims.Email, resource, id)
+	return ErrForbidden
+}
+
+// Regresa nil si el usuario puede actuar a nombre del dueño indicado, los agentes solo a su nombre
+func (service *AuthorizationService) CanActAs(claims *models.JWTClaims, owner string) error {
+	if claims == nil {
+		return ErrForbidden
+	}
+	if IsAdmin(claims) || (claims.Role == RoleAgente && owner == claims.Email) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// Middleware que exige que el usuario sea dueño del recurso cuyo id viene en el parametro param
+func (service *AuthorizationService) RequireOwner(resource string, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param(param))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + resource + " ID"})
+			c.Abort()
+			return
+		}
+
+		if !AbortIfDenied(c, service.CanModify(ClaimsFromContext(c), resource, id)) {
+			c.Next()
+		}
+	}
+}
+
+// Middleware que exige que el usuario tenga alguno de los roles indicados
+func (service *AuthorizationService) RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := ClaimsFromContext(c)
+		if claims == nil || !slices.Contains(roles, claims.Role) {
+			AbortIfDenied(c, ErrForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Middleware que exige que el usuario tenga rol admin
+func (service *AuthorizationService) RequireAdmin() gin.HandlerFunc {
+	return service.RequireRole(RoleAdmin)
+}
+
+// Recupera los claims que JwtAuthorization dejo en el contexto
+func ClaimsFromContext(c *gin.Context) *models.JWTClaims {
+	value, ok := c.Get("claims")
+	if !ok {
+		return nil
+	}
+	claims, _ := value.(*models.JWTClaims)
+	return claims
+}
+
+// EmailFromContext regresa el correo del usuario autenticado, se guarda como autor de los cambios
+func EmailFromContext(c *gin.Context) string {
+	if claims := ClaimsFromContext(c); claims != nil {
+		return claims.Email
+	}
+	return ""
+}
+
+func IsAdmin(claims *models.JWTClaims) bool {
+	return claims != nil && claims.Role == RoleAdmin
+}
+
+// Responde 403, 404 o 500 segun el error de la politica y aborta la peticion, regresa true si aborto
+func AbortIfDenied(c *gin.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	switch {
+	case errors.Is(err, ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"message": "You do not have permission to access this resource",
+		})
+	case errors.Is(err, ErrResourceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+	}
+	c.Abort()
+	return true
+}
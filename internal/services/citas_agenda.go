@@ -0,0 +1,438 @@
+package services
+
+import (
+	"backend/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrInvalidCita         = errors.New("invalid cita")
+	ErrCitaConflict        = errors.New("cita conflicts with another cita")
+	ErrOutsideWorkingHours = errors.New("cita is outside the agent working hours")
+	ErrInvalidHorario      = errors.New("invalid working hours")
+)
+
+const (
+	duracionCitaDefault = 60
+	duracionCitaMaxima  = 8 * 60
+	// Los espacios libres empiezan cada pasoDisponibilidad minutos desde el inicio del bloque de trabajo
+	pasoDisponibilidad    = 30
+	diasDisponibilidadMax = 31
+	formatoFecha          = "2006-01-02"
+)
+
+// horarioDefault aplica a los agentes que no han configurado su horario: lunes a viernes de 9:00 a 18:00
+var horarioDefault = []models.HorarioAgente{
+	{DiaSemana: 1, HoraInicio: "09:00", HoraFin: "18:00"},
+	{DiaSemana: 2, HoraInicio: "09:00", HoraFin: "18:00"},
+	{DiaSemana: 3, HoraInicio: "09:00", HoraFin: "18:00"},
+	{DiaSemana: 4, HoraInicio: "09:00", HoraFin: "18:00"},
+	{DiaSemana: 5, HoraInicio: "09:00", HoraFin: "18:00"},
+}
+
+// intervalo es el tiempo que ocupa una cita
+type intervalo struct {
+	IDCita int
+	Inicio time.Time
+	Fin    time.Time
+}
+
+func (i intervalo) seTraslapa(inicio, fin time.Time) bool {
+	return i.Inicio.Before(fin) && inicio.Before(i.Fin)
+}
+
+// queryer lo cumplen *sql.DB y *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// horaAgente expresa el intervalo en la zona horaria del agente
+func horaAgente(inicio, fin time.Time, loc *time.Location) *models.HoraAgente {
+	return &models.HoraAgente{
+		ZonaHoraria: loc.String(),
+		Inicio:      inicio.In(loc).Format(time.RFC3339),
+		Fin:         fin.In(loc).Format(time.RFC3339),
+	}
+}
+
+// normalizarCita valida inicio, fin y duración de la cita, los deja en UTC y calcula el que falte
+func normalizarCita(cita *models.Cita) error {
+	if cita.Inicio.IsZero() {
+		return fmt.Errorf("%w: inicio es obligatorio en formato RFC 3339, por ejemplo 2024-12-16T10:00:00-06:00", ErrInvalidCita)
+	}
+	cita.Inicio = cita.Inicio.UTC().Truncate(time.Minute)
+	if cita.Fin.IsZero() {
+		if cita.Duracion == 0 {
+			cita.Duracion = duracionCitaDefault
+		}
+		cita.Fin = cita.Inicio.Add(time.Duration(cita.Duracion) * time.Minute)
+	}
+	cita.Fin = cita.Fin.UTC().Truncate(time.Minute)
+	cita.Duracion = int(cita.Fin.Sub(cita.Inicio) / time.Minute)
+	if cita.Duracion <= 0 || cita.Duracion > duracionCitaMaxima {
+		return fmt.Errorf("%w: la cita debe durar entre 1 y %d minutos", ErrInvalidCita, duracionCitaMaxima)
+	}
+	return nil
+}
+
+// minutosDelDia convierte "09:00" (o "09:00:00" como lo regresa MySQL) a minutos desde la medianoche
+func minutosDelDia(hora string) (int, bool) {
+	if len(hora) > 5 {
+		hora = hora[:5]
+	}
+	t, err := time.Parse("15:04", hora)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// validarHorario revisa la zona horaria y que cada bloque tenga un día valido y termine despues de empezar
+func validarHorario(horario *models.HorarioSemanal) error {
+	if horario.ZonaHoraria != "" {
+		if _, err := time.LoadLocation(horario.ZonaHoraria); err != nil {
+			return fmt.Errorf("%w: zona_horaria debe ser una zona IANA, por ejemplo America/Mexico_City", ErrInvalidHorario)
+		}
+	}
+	for _, bloque := range horario.Bloques {
+		if bloque.DiaSemana < 0 || bloque.DiaSemana > 6 {
+			return fmt.Errorf("%w: dia_semana debe estar entre 0 (domingo) y 6 (sábado)", ErrInvalidHorario)
+		}
+		inicio, ok := minutosDelDia(bloque.HoraInicio)
+		if !ok {
+			return fmt.Errorf("%w: hora_inicio debe tener el formato HH:MM", ErrInvalidHorario)
+		}
+		fin, ok := minutosDelDia(bloque.HoraFin)
+		if !ok {
+			return fmt.Errorf("%w: hora_fin debe tener el formato HH:MM", ErrInvalidHorario)
+		}
+		if fin <= inicio {
+			return fmt.Errorf("%w: hora_fin debe ser despues de hora_inicio", ErrInvalidHorario)
+		}
+	}
+	return nil
+}
+
+// zonaAgente regresa la zona horaria configurada del agente o la zona por defecto si no tiene
+func (service *CitasService) zonaAgente(db queryRower, usuario string) (*time.Location, error) {
+	var zona sql.NullString
+	err := db.QueryRow("SELECT zona_horaria FROM Usuarios WHERE usuario = ?", usuario).Scan(&zona)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Error fetching zona horaria:", err)
+		return nil, err
+	}
+	if !zona.Valid || zona.String == "" {
+		return service.ZonaDefault, nil
+	}
+	loc, err := time.LoadLocation(zona.String)
+	if err != nil {
+		log.Println("Zona horaria invalida para", usuario, zona.String)
+		return service.ZonaDefault, nil
+	}
+	return loc, nil
+}
+
+// cargarHorario regresa los bloques de trabajo del agente o el horario por defecto si no tiene
+func cargarHorario(db queryer, usuario string) ([]models.HorarioAgente, error) {
+	query := "SELECT dia_semana, hora_inicio, hora_fin FROM Horarios_Agente WHERE usuario = ? ORDER BY dia_semana, hora_inicio"
+	rows, err := db.Query(query, usuario)
+	if err != nil {
+		log.Println("Error fetching horario:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bloques []models.HorarioAgente
+	for rows.Next() {
+		var bloque models.HorarioAgente
+		if err := rows.Scan(&bloque.DiaSemana, &bloque.HoraInicio, &bloque.HoraFin); err != nil {
+			log.Println("Error scanning horario:", err)
+			return nil, err
+		}
+		// MySQL regresa los TIME como "09:00:00"
+		if len(bloque.HoraInicio) > 5 {
+			bloque.HoraInicio = bloque.HoraInicio[:5]
+		}
+		if len(bloque.HoraFin) > 5 {
+			bloque.HoraFin = bloque.HoraFin[:5]
+		}
+		bloques = append(bloques, bloque)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	if len(bloques) == 0 {
+		return horarioDefault, nil
+	}
+	return bloques, nil
+}
+
+// bloquesDelDia regresa los bloques del horario que aplican en la fecha como intervalos, dia ya debe estar en la zona del agente
+func bloquesDelDia(bloques []models.HorarioAgente, dia time.Time) []intervalo {
+	var resultado []intervalo
+	for _, bloque := range bloques {
+		if bloque.DiaSemana != int(dia.Weekday()) {
+			continue
+		}
+		inicio, _ := minutosDelDia(bloque.HoraInicio)
+		fin, _ := minutosDelDia(bloque.HoraFin)
+		// time.Date respeta los cambios de horario de verano de la zona
+		resultado = append(resultado, intervalo{
+			Inicio: time.Date(dia.Year(), dia.Month(), dia.Day(), inicio/60, inicio%60, 0, 0, dia.Location()),
+			Fin:    time.Date(dia.Year(), dia.Month(), dia.Day(), fin/60, fin%60, 0, 0, dia.Location()),
+		})
+	}
+	return resultado
+}
+
+// dentroDeHorario indica si la cita cabe completa en alguno de los bloques de trabajo de su día en la zona del agente
+func dentroDeHorario(bloques []models.HorarioAgente, cita intervalo, loc *time.Location) bool {
+	for _, bloque := range bloquesDelDia(bloques, cita.Inicio.In(loc)) {
+		if !cita.Inicio.Before(bloque.Inicio) && !cita.Fin.After(bloque.Fin) {
+			return true
+		}
+	}
+	return false
+}
+
+// citasOcupadas regresa las citas del agente o del prospecto que se empalman con [desde, hasta), sin contar la cita excluir.
+// Las series se expanden en sus ocurrencias.
+func citasOcupadas(db queryer, zonaDefault *time.Location, usuario string, idCliente int, desde, hasta time.Time, excluir int) ([]intervalo, error) {
+	query := `SELECT id_citas, inicio, fin FROM Citas
+		WHERE (usuario = ? OR id_cliente = ?) AND frecuencia IS NULL AND inicio < ? AND fin > ? AND id_citas <> ?`
+	rows, err := db.Query(query, usuario, idCliente, hasta, desde, excluir)
+	if err != nil {
+		log.Println("Error fetching citas:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ocupadas []intervalo
+	for rows.Next() {
+		var ocupada intervalo
+		if err := rows.Scan(&ocupada.IDCita, &ocupada.Inicio, &ocupada.Fin); err != nil {
+			log.Println("Error scanning cita:", err)
+			return nil, err
+		}
+		ocupadas = append(ocupadas, ocupada)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+
+	series, err := cargarSeries(db, zonaDefault, "(Citas.usuario = ? OR Citas.id_cliente = ?) AND Citas.inicio < ? AND Citas.fin_serie > ? AND Citas.id_citas <> ?",
+		usuario, idCliente, hasta, desde, excluir)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range series {
+		ocupadas = append(ocupadas, s.ocurrencias(desde, hasta)...)
+	}
+	return ocupadas, nil
+}
+
+// reservarCita valida la cita y revisa dentro de la transacción que quepa en el horario del agente y que ni el agente
+// ni el prospecto tengan otra cita a la misma hora. El agente y el prospecto quedan bloqueados hasta el commit,
+// asi dos reservaciones al mismo tiempo no pueden tomar el mismo espacio. Si la cita es recurrente se revisan todas
+// sus ocurrencias y se regresa la serie.
+func (service *CitasService) reservarCita(tx *sql.Tx, cita *models.Cita, excluir int) (*serie, error) {
+	if err := normalizarCita(cita); err != nil {
+		return nil, err
+	}
+
+	var found int
+	err := tx.QueryRow("SELECT 1 FROM Usuarios WHERE usuario = ? FOR UPDATE", cita.IdUsuario).Scan(&found)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: el agente %s no existe", ErrInvalidCita, cita.IdUsuario)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow("SELECT 1 FROM Prospecto WHERE id_cliente = ? FOR UPDATE", cita.IdCliente).Scan(&found)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: el prospecto %d no existe", ErrInvalidCita, cita.IdCliente)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := service.zonaAgente(tx, cita.IdUsuario)
+	if err != nil {
+		return nil, err
+	}
+	bloques, err := cargarHorario(tx, cita.IdUsuario)
+	if err != nil {
+		return nil, err
+	}
+	cita.HoraAgente = horaAgente(cita.Inicio, cita.Fin, loc)
+
+	if cita.Recurrencia != nil {
+		s, err := nuevaSerie(cita, loc)
+		if err != nil {
+			return nil, err
+		}
+		s.IDCita = excluir
+		if err := service.validarSerie(tx, s, cita, bloques, excluir); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	if !dentroDeHorario(bloques, intervalo{Inicio: cita.Inicio, Fin: cita.Fin}, loc) {
+		return nil, ErrOutsideWorkingHours
+	}
+	ocupadas, err := citasOcupadas(tx, service.ZonaDefault, cita.IdUsuario, cita.IdCliente, cita.Inicio, cita.Fin, excluir)
+	if err != nil {
+		return nil, err
+	}
+	if len(ocupadas) > 0 {
+		return nil, fmt.Errorf("%w: se empalma con la cita %d", ErrCitaConflict, ocupadas[0].IDCita)
+	}
+	return nil, nil
+}
+
+// GET /citas/horario/:usuario
+// GetHorario regresa la zona horaria y los bloques de trabajo del agente, si no ha configurado ninguno regresa los valores por defecto
+func (service *CitasService) GetHorario(usuario string) (*models.HorarioSemanal, error) {
+	loc, err := service.zonaAgente(service.DB, usuario)
+	if err != nil {
+		return nil, err
+	}
+	bloques, err := cargarHorario(service.DB, usuario)
+	if err != nil {
+		return nil, err
+	}
+	return &models.HorarioSemanal{ZonaHoraria: loc.String(), Bloques: bloques}, nil
+}
+
+// PUT /citas/horario/:usuario
+// SetHorario guarda la zona horaria y reemplaza todos los bloques de trabajo del agente, una lista vacía regresa al horario por defecto
+func (service *CitasService) SetHorario(usuario string, horario *models.HorarioSemanal) error {
+	if err := validarHorario(horario); err != nil {
+		return err
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRow("SELECT 1 FROM Usuarios WHERE usuario = ? FOR UPDATE", usuario).Scan(&found)
+	if err == sql.ErrNoRows {
+		return ErrResourceNotFound
+	}
+	if err != nil {
+		log.Println("Error checking usuario:", err)
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE Usuarios SET zona_horaria = NULLIF(?, '') WHERE usuario = ?", horario.ZonaHoraria, usuario); err != nil {
+		log.Println("Error updating zona horaria:", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM Horarios_Agente WHERE usuario = ?", usuario); err != nil {
+		log.Println("Error deleting horario:", err)
+		return err
+	}
+	for _, bloque := range horario.Bloques {
+		query := "INSERT INTO Horarios_Agente (usuario, dia_semana, hora_inicio, hora_fin) VALUES (?, ?, ?, ?)"
+		if _, err := tx.Exec(query, usuario, bloque.DiaSemana, bloque.HoraInicio, bloque.HoraFin); err != nil {
+			log.Println("Error inserting horario:", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// limiteRango interpreta desde/hasta de la disponibilidad: una fecha yyyy-mm-dd es un día completo en la zona del agente,
+// tambien se acepta un instante en RFC 3339
+func limiteRango(valor string, loc *time.Location, esFin bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, valor); err == nil {
+		return t, true
+	}
+	dia, err := time.ParseInLocation(formatoFecha, valor, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if esFin {
+		return dia.AddDate(0, 0, 1), true
+	}
+	return dia, true
+}
+
+// GET /citas/disponibilidad
+// GetDisponibilidad regresa los espacios libres del agente entre desde y hasta para citas de la duración indicada.
+// Solo se regresan espacios dentro de su horario, que no se empalman con sus citas y que todavía no pasan.
+func (service *CitasService) GetDisponibilidad(usuario string, desde string, hasta string, duracion int) ([]models.EspacioDisponible, error) {
+	loc, err := service.zonaAgente(service.DB, usuario)
+	if err != nil {
+		return nil, err
+	}
+	inicio, ok := limiteRango(desde, loc, false)
+	if !ok {
+		return nil, fmt.Errorf("%w: desde debe ser yyyy-mm-dd o RFC 3339", ErrInvalidCita)
+	}
+	fin, ok := limiteRango(hasta, loc, true)
+	if !ok {
+		return nil, fmt.Errorf("%w: hasta debe ser yyyy-mm-dd o RFC 3339", ErrInvalidCita)
+	}
+	if !fin.After(inicio) || fin.Sub(inicio) > diasDisponibilidadMax*24*time.Hour {
+		return nil, fmt.Errorf("%w: el rango debe ser de 1 a %d días", ErrInvalidCita, diasDisponibilidadMax)
+	}
+	if duracion == 0 {
+		duracion = duracionCitaDefault
+	}
+	if duracion < 0 || duracion > duracionCitaMaxima {
+		return nil, fmt.Errorf("%w: duracion debe estar entre 1 y %d minutos", ErrInvalidCita, duracionCitaMaxima)
+	}
+
+	bloques, err := cargarHorario(service.DB, usuario)
+	if err != nil {
+		return nil, err
+	}
+	// El id_cliente 0 no existe, solo cuentan las citas del agente
+	ocupadas, err := citasOcupadas(service.DB, service.ZonaDefault, usuario, 0, inicio, fin, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ahora := time.Now()
+	largo := time.Duration(duracion) * time.Minute
+	espacios := []models.EspacioDisponible{}
+	local := inicio.In(loc)
+	for dia := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc); dia.Before(fin); dia = dia.AddDate(0, 0, 1) {
+		for _, bloque := range bloquesDelDia(bloques, dia) {
+			for t := bloque.Inicio; !t.Add(largo).After(bloque.Fin); t = t.Add(pasoDisponibilidad * time.Minute) {
+				termina := t.Add(largo)
+				if t.Before(inicio) || termina.After(fin) || t.Before(ahora) || ocupado(ocupadas, t, termina) {
+					continue
+				}
+				espacios = append(espacios, models.EspacioDisponible{
+					Inicio:     t.UTC(),
+					Fin:        termina.UTC(),
+					Duracion:   duracion,
+					HoraAgente: *horaAgente(t, termina, loc),
+				})
+			}
+		}
+	}
+	return espacios, nil
+}
+
+func ocupado(ocupadas []intervalo, inicio, fin time.Time) bool {
+	for _, cita := range ocupadas {
+		if cita.seTraslapa(inicio, fin) {
+			return true
+		}
+	}
+	return false
+}
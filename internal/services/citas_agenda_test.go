@@ -0,0 +1,138 @@
+package services
+
+import (
+	"backend/internal/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNormalizarCita(t *testing.T) {
+	mexico := time.FixedZone("-06:00", -6*3600)
+	inicio := time.Date(2024, 12, 16, 10, 0, 30, 0, mexico)
+	tests := []struct {
+		nombre   string
+		cita     models.Cita
+		inicio   time.Time
+		fin      time.Time
+		duracion int
+		invalida bool
+	}{
+		{"sin fin ni duración dura 60 minutos", models.Cita{Inicio: inicio},
+			time.Date(2024, 12, 16, 16, 0, 0, 0, time.UTC), time.Date(2024, 12, 16, 17, 0, 0, 0, time.UTC), 60, false},
+		{"con duración", models.Cita{Inicio: inicio, Duracion: 90},
+			time.Date(2024, 12, 16, 16, 0, 0, 0, time.UTC), time.Date(2024, 12, 16, 17, 30, 0, 0, time.UTC), 90, false},
+		{"el fin gana a la duración", models.Cita{Inicio: inicio, Fin: inicio.Add(30 * time.Minute), Duracion: 90},
+			time.Date(2024, 12, 16, 16, 0, 0, 0, time.UTC), time.Date(2024, 12, 16, 16, 30, 0, 0, time.UTC), 30, false},
+		{"sin inicio", models.Cita{Duracion: 60}, time.Time{}, time.Time{}, 0, true},
+		{"fin antes del inicio", models.Cita{Inicio: inicio, Fin: inicio.Add(-time.Hour)}, time.Time{}, time.Time{}, 0, true},
+		{"más de 8 horas", models.Cita{Inicio: inicio, Duracion: 8*60 + 1}, time.Time{}, time.Time{}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			cita := tt.cita
+			err := normalizarCita(&cita)
+			if tt.invalida {
+				if !errors.Is(err, ErrInvalidCita) {
+					t.Fatalf("error = %v, se esperaba ErrInvalidCita", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cita.Inicio.Equal(tt.inicio) || cita.Inicio.Location() != time.UTC {
+				t.Errorf("inicio = %v, se esperaba %v en UTC", cita.Inicio, tt.inicio)
+			}
+			if !cita.Fin.Equal(tt.fin) || cita.Fin.Location() != time.UTC {
+				t.Errorf("fin = %v, se esperaba %v en UTC", cita.Fin, tt.fin)
+			}
+			if cita.Duracion != tt.duracion {
+				t.Errorf("duración = %d, se esperaba %d", cita.Duracion, tt.duracion)
+			}
+		})
+	}
+}
+
+func TestDentroDeHorario(t *testing.T) {
+	nuevaYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("sin base de zonas horarias:", err)
+	}
+	cita := func(inicio string, minutos int) intervalo {
+		i, err := time.Parse(time.RFC3339, inicio)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return intervalo{Inicio: i, Fin: i.Add(time.Duration(minutos) * time.Minute)}
+	}
+	tests := []struct {
+		nombre string
+		cita   intervalo
+		dentro bool
+	}{
+		// Lunes 9:00 en Nueva York es 14:00 UTC en invierno y 13:00 UTC en verano
+		{"inicio del horario en invierno", cita("2024-12-16T14:00:00Z", 60), true},
+		{"antes del horario en invierno", cita("2024-12-16T13:30:00Z", 60), false},
+		{"inicio del horario en verano", cita("2024-07-15T13:00:00Z", 60), true},
+		{"la misma hora UTC en verano ya no es antes", cita("2024-07-15T13:30:00Z", 60), true},
+		{"termina justo al final", cita("2024-12-16T22:00:00Z", 60), true},
+		{"se pasa del final", cita("2024-12-16T22:30:00Z", 60), false},
+		{"domingo", cita("2024-12-15T15:00:00Z", 60), false},
+		// Viernes 20:00 en Nueva York ya es sábado en UTC
+		{"el día es el de la zona del agente", cita("2024-12-14T01:00:00Z", 30), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			if got := dentroDeHorario(horarioDefault, tt.cita, nuevaYork); got != tt.dentro {
+				t.Errorf("dentroDeHorario = %v, se esperaba %v", got, tt.dentro)
+			}
+		})
+	}
+}
+
+func TestLimiteRango(t *testing.T) {
+	mexico := time.FixedZone("-06:00", -6*3600)
+	tests := []struct {
+		nombre string
+		valor  string
+		esFin  bool
+		want   time.Time
+		ok     bool
+	}{
+		{"fecha de inicio es la medianoche del agente", "2024-12-16", false, time.Date(2024, 12, 16, 6, 0, 0, 0, time.UTC), true},
+		{"fecha de fin incluye todo el día", "2024-12-16", true, time.Date(2024, 12, 17, 6, 0, 0, 0, time.UTC), true},
+		{"instante RFC 3339", "2024-12-16T10:00:00Z", true, time.Date(2024, 12, 16, 10, 0, 0, 0, time.UTC), true},
+		{"formato inválido", "16/12/2024", false, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			got, ok := limiteRango(tt.valor, mexico, tt.esFin)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("limiteRango = %v, %v; se esperaba %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidarHorario(t *testing.T) {
+	tests := []struct {
+		nombre string
+		bloque models.HorarioAgente
+		valido bool
+	}{
+		{"bloque válido", models.HorarioAgente{DiaSemana: 1, HoraInicio: "09:00", HoraFin: "14:00"}, true},
+		{"como lo regresa MySQL", models.HorarioAgente{DiaSemana: 6, HoraInicio: "09:00:00", HoraFin: "14:00:00"}, true},
+		{"día fuera de rango", models.HorarioAgente{DiaSemana: 7, HoraInicio: "09:00", HoraFin: "14:00"}, false},
+		{"hora inválida", models.HorarioAgente{DiaSemana: 1, HoraInicio: "9am", HoraFin: "14:00"}, false},
+		{"termina antes de empezar", models.HorarioAgente{DiaSemana: 1, HoraInicio: "14:00", HoraFin: "09:00"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			err := validarHorario(&models.HorarioSemanal{Bloques: []models.HorarioAgente{tt.bloque}})
+			if (err == nil) != tt.valido {
+				t.Errorf("validarHorario = %v, se esperaba válido = %v", err, tt.valido)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+)
+
+// Días hacia atrás que se incluyen en el feed, las citas futuras van todas
+const diasFeedCalendario = 90
+
+// invitacionCita son los datos que se necesitan para mandar la invitación de una cita al prospecto
+type invitacionCita struct {
+	IDCita          int
+	Titulo          string
+	Descripcion     string
+	Inicio          time.Time
+	Fin             time.Time
+	Secuencia       int
+	Usuario         string
+	NombreUsuario   string
+	NombreProspecto string
+	CorreoProspecto string
+	// Serie si la cita es recurrente
+	Serie *serie
+	// Si la cita es una ocurrencia editada aparte: la serie, el inicio original y la zona de la serie
+	IDSerie    int
+	Ocurrencia time.Time
+	ZonaSerie  *time.Location
+}
+
+func (inv *invitacionCita) evento(cancelado bool) eventoICS {
+	evento := eventoICS{
+		UID:             uidCita(inv.IDCita),
+		Secuencia:       inv.Secuencia,
+		Inicio:          inv.Inicio,
+		Fin:             inv.Fin,
+		Titulo:          inv.Titulo,
+		Descripcion:     inv.Descripcion,
+		Organizador:     inv.Usuario,
+		NombreOrg:       inv.NombreUsuario,
+		Asistente:       inv.CorreoProspecto,
+		NombreAsistente: inv.NombreProspecto,
+		Cancelado:       cancelado,
+	}
+	if inv.Serie != nil {
+		evento.RRule = inv.Serie.rrule()
+		evento.ExDates = inv.Serie.excepciones()
+		evento.Zona = inv.Serie.Zona
+	}
+	if inv.IDSerie > 0 {
+		ocurrencia := inv.Ocurrencia
+		evento.UID = uidCita(inv.IDSerie)
+		evento.RecurrenceID = &ocurrencia
+		evento.Zona = inv.ZonaSerie
+	}
+	return evento
+}
+
+// ocurrencia regresa la invitación de una sola ocurrencia de la serie, para cancelarla sin tocar las demás
+func (inv *invitacionCita) ocurrencia(inicio time.Time) *invitacionCita {
+	copia := *inv
+	copia.Inicio, copia.Fin = inicio, inicio.Add(inv.Serie.duracion())
+	copia.IDSerie, copia.Ocurrencia, copia.ZonaSerie = inv.IDCita, inicio, inv.Serie.Zona
+	copia.Serie = nil
+	return &copia
+}
+
+// cargarInvitacion regresa los datos de la cita con su prospecto, agente y serie, nil si la cita no existe
+func (service *CitasService) cargarInvitacion(db consultor, id int) (*invitacionCita, error) {
+	var inv invitacionCita
+	var recurrente bool
+	var idSerie sql.NullInt64
+	var ocurrencia sql.NullTime
+	var titulo, descripcion, nombreUsuario, nombre, apellido, correo, zonaSerie sql.NullString
+	query := `SELECT Citas.id_citas, Citas.titulo_cita, Citas.descripcion_cita, Citas.inicio, Citas.fin, Citas.secuencia, Citas.usuario,
+			Usuarios.nombre_usuario, Prospecto.nombre_prospecto, Prospecto.apellido_paterno_prospecto, Prospecto.correo_prospecto,
+			Citas.frecuencia IS NOT NULL, Citas.id_cita_serie, Citas.ocurrencia, Serie.zona_serie
+		FROM Citas
+		INNER JOIN Prospecto ON Prospecto.id_cliente = Citas.id_cliente
+		LEFT JOIN Usuarios ON Usuarios.usuario = Citas.usuario
+		LEFT JOIN Citas AS Serie ON Serie.id_citas = Citas.id_cita_serie
+		WHERE Citas.id_citas = ?`
+	err := db.QueryRow(query, id).Scan(&inv.IDCita, &titulo, &descripcion, &inv.Inicio, &inv.Fin, &inv.Secuencia, &inv.Usuario,
+		&nombreUsuario, &nombre, &apellido, &correo, &recurrente, &idSerie, &ocurrencia, &zonaSerie)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Println("Error fetching invitacion:", err)
+		return nil, err
+	}
+	inv.Titulo = titulo.String
+	inv.Descripcion = descripcion.String
+	inv.NombreUsuario = nombreUsuario.String
+	inv.NombreProspecto = strings.TrimSpace(nombre.String + " " + apellido.String)
+	inv.CorreoProspecto = strings.TrimSpace(correo.String)
+	if idSerie.Valid {
+		inv.IDSerie = int(idSerie.Int64)
+		inv.Ocurrencia = ocurrencia.Time
+		inv.ZonaSerie = zonaDeSerie(zonaSerie.String, service.ZonaDefault)
+	}
+	if recurrente {
+		if inv.Serie, err = cargarSerie(db, service.ZonaDefault, id); err != nil {
+			return nil, err
+		}
+	}
+	return &inv, nil
+}
+
+// enviarInvitacion manda al prospecto la invitación (REQUEST) o la cancelación (CANCEL) en segundo plano,
+// un error de correo no revierte la cita, solo se registra en el log
+func (service *CitasService) enviarInvitacion(inv *invitacionCita, metodo string) {
+	if inv == nil || service.Email == nil {
+		return
+	}
+	if inv.CorreoProspecto == "" {
+		log.Printf("Cita %d: el prospecto no tiene correo, no se manda la invitación", inv.IDCita)
+		return
+	}
+
+	loc, err := service.zonaAgente(service.DB, inv.Usuario)
+	if err != nil {
+		loc = service.ZonaDefault
+	}
+	cancelado := metodo == MetodoICSCancel
+	ics := generarICS(metodo, "", []eventoICS{inv.evento(cancelado)}, time.Now())
+
+	hora := inv.Inicio.In(loc).Format("02/01/2006 15:04") + " (" + loc.String() + ")"
+	asunto := "Invitación: " + inv.Titulo
+	cuerpo := "<p>Tienes una cita programada.</p>"
+	if cancelado {
+		asunto = "Cancelada: " + inv.Titulo
+		cuerpo = "<p>La siguiente cita fue cancelada.</p>"
+	}
+	cuerpo = fmt.Sprintf("<html><body>%s<p><b>%s</b><br>%s</p><p>%s</p></body></html>",
+		cuerpo, html.EscapeString(inv.Titulo), html.EscapeString(hora), html.EscapeString(inv.Descripcion))
+
+	go func() {
+		if err := service.Email.SendCalendarInvite(inv.CorreoProspecto, asunto, cuerpo, ics, metodo); err != nil {
+			log.Printf("Cita %d: no se pudo mandar la invitación %s: %v", inv.IDCita, metodo, err)
+		}
+	}()
+}
+
+// POST /citas/calendario/:usuario
+// GenerarTokenCalendario crea un token nuevo para el feed del agente, el anterior deja de funcionar.
+// Solo se guarda el hash, el token se regresa una sola vez.
+func (service *CitasService) GenerarTokenCalendario(usuario string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		log.Println("Error generating calendar token:", err)
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	result, err := service.DB.Exec("UPDATE Usuarios SET token_calendario = ? WHERE usuario = ?", hashToken(token), usuario)
+	if err != nil {
+		log.Println("Error saving calendar token:", err)
+		return "", err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if rows == 0 {
+		return "", ErrResourceNotFound
+	}
+	return token, nil
+}
+
+// DELETE /citas/calendario/:usuario
+// RevocarTokenCalendario desactiva el feed del agente
+func (service *CitasService) RevocarTokenCalendario(usuario string) error {
+	var found int
+	err := service.DB.QueryRow("SELECT 1 FROM Usuarios WHERE usuario = ?", usuario).Scan(&found)
+	if err == sql.ErrNoRows {
+		return ErrResourceNotFound
+	}
+	if err != nil {
+		log.Println("Error checking usuario:", err)
+		return err
+	}
+	if _, err := service.DB.Exec("UPDATE Usuarios SET token_calendario = NULL WHERE usuario = ?", usuario); err != nil {
+		log.Println("Error revoking calendar token:", err)
+		return err
+	}
+	return nil
+}
+
+// GET /calendario/:token
+// GetCalendario regresa el feed ICS de las citas del agente dueño del token, ErrResourceNotFound si el token no existe
+func (service *CitasService) GetCalendario(token string) ([]byte, error) {
+	var usuario string
+	var nombre sql.NullString
+	err := service.DB.QueryRow("SELECT usuario, nombre_usuario FROM Usuarios WHERE token_calendario = ?", hashToken(token)).Scan(&usuario, &nombre)
+	if err == sql.ErrNoRows {
+		return nil, ErrResourceNotFound
+	}
+	if err != nil {
+		log.Println("Error fetching calendar token:", err)
+		return nil, err
+	}
+
+	desde := time.Now().AddDate(0, 0, -diasFeedCalendario)
+	series, err := cargarSeries(service.DB, service.ZonaDefault, "Citas.usuario = ? AND Citas.fin_serie >= ?", usuario, desde)
+	if err != nil {
+		return nil, err
+	}
+	porID := map[int]*serie{}
+	for _, s := range series {
+		porID[s.IDCita] = s
+	}
+
+	// Las series van como un solo evento con RRULE y las ocurrencias editadas con RECURRENCE-ID
+	query := `SELECT Citas.id_citas, Citas.titulo_cita, Citas.descripcion_cita, Citas.inicio, Citas.fin, Citas.secuencia,
+			Prospecto.nombre_prospecto, Prospecto.apellido_paterno_prospecto, Prospecto.correo_prospecto,
+			Citas.id_cita_serie, Citas.ocurrencia, Serie.zona_serie
+		FROM Citas
+		INNER JOIN Prospecto ON Prospecto.id_cliente = Citas.id_cliente
+		LEFT JOIN Citas AS Serie ON Serie.id_citas = Citas.id_cita_serie
+		WHERE Citas.usuario = ? AND COALESCE(Citas.fin_serie, Citas.fin) >= ?
+		ORDER BY Citas.inicio`
+	rows, err := service.DB.Query(query, usuario, desde)
+	if err != nil {
+		log.Println("Error fetching citas:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var eventos []eventoICS
+	for rows.Next() {
+		inv := invitacionCita{Usuario: usuario, NombreUsuario: nombre.String}
+		var titulo, descripcion, nombreProspecto, apellido, correo, zonaSerie sql.NullString
+		var idSerie sql.NullInt64
+		var ocurrencia sql.NullTime
+		err := rows.Scan(&inv.IDCita, &titulo, &descripcion, &inv.Inicio, &inv.Fin, &inv.Secuencia, &nombreProspecto, &apellido, &correo,
+			&idSerie, &ocurrencia, &zonaSerie)
+		if err != nil {
+			log.Println("Error scanning cita:", err)
+			return nil, err
+		}
+		inv.Serie = porID[inv.IDCita]
+		if idSerie.Valid {
+			inv.IDSerie = int(idSerie.Int64)
+			inv.Ocurrencia = ocurrencia.Time
+			inv.ZonaSerie = zonaDeSerie(zonaSerie.String, service.ZonaDefault)
+		}
+		inv.Titulo = titulo.String
+		inv.NombreProspecto = strings.TrimSpace(nombreProspecto.String + " " + apellido.String)
+		inv.CorreoProspecto = strings.TrimSpace(correo.String)
+		inv.Descripcion = strings.TrimSpace("Prospecto: " + inv.NombreProspecto + "\n" + descripcion.String)
+		// El feed es solo para el agente, no se invita al prospecto desde ahí
+		evento := inv.evento(false)
+		evento.Asistente = ""
+		eventos = append(eventos, evento)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return generarICS(MetodoICSPublish, "Citas "+usuario, eventos, time.Now()), nil
+}
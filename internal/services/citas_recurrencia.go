@@ -0,0 +1,409 @@
+package services
+
+import (
+	"backend/internal/models"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Frecuencias de las series de citas
+const (
+	FrecuenciaDiaria  = "diaria"
+	FrecuenciaSemanal = "semanal"
+	FrecuenciaMensual = "mensual"
+)
+
+// Alcance de una edición o cancelación sobre una serie
+const (
+	AlcanceEsta       = "esta"
+	AlcanceSiguientes = "siguientes"
+)
+
+const (
+	maxOcurrenciasSerie = 730
+	duracionMaximaSerie = 2 * 365 * 24 * time.Hour
+	// En las series mensuales se saltan los meses sin ese día (31 de febrero), por eso hay mas iteraciones que ocurrencias
+	maxIteracionesSerie = 2000
+)
+
+var frecuenciasRRule = map[string]string{
+	FrecuenciaDiaria:  "DAILY",
+	FrecuenciaSemanal: "WEEKLY",
+	FrecuenciaMensual: "MONTHLY",
+}
+
+// serie es una cita recurrente. Las ocurrencias se calculan en la zona del agente para que una cita semanal
+// a las 10:00 siga a las 10:00 aunque cambie el horario de verano.
+type serie struct {
+	IDCita     int
+	Inicio     time.Time
+	Fin        time.Time
+	Frecuencia string
+	Intervalo  int
+	Conteo     int
+	Hasta      time.Time
+	Zona       *time.Location
+	// Inicios (unix) de las ocurrencias que no se hacen
+	Excepciones map[int64]bool
+}
+
+func (s *serie) duracion() time.Duration {
+	return s.Fin.Sub(s.Inicio)
+}
+
+// recorrer llama fn con el inicio en UTC de cada ocurrencia de la regla, incluyendo las excepciones, hasta que fn regresa false
+func (s *serie) recorrer(fn func(inicio time.Time) bool) {
+	local := s.Inicio.In(s.Zona)
+	y, m, d := local.Date()
+	hh, mm := local.Hour(), local.Minute()
+	intervalo := s.Intervalo
+	if intervalo < 1 {
+		intervalo = 1
+	}
+
+	conteo := 0
+	for n := 0; n < maxIteracionesSerie; n++ {
+		var t time.Time
+		switch s.Frecuencia {
+		case FrecuenciaDiaria:
+			t = time.Date(y, m, d+n*intervalo, hh, mm, 0, 0, s.Zona)
+		case FrecuenciaSemanal:
+			t = time.Date(y, m, d+7*n*intervalo, hh, mm, 0, 0, s.Zona)
+		case FrecuenciaMensual:
+			t = time.Date(y, m+time.Month(n*intervalo), d, hh, mm, 0, 0, s.Zona)
+			// RFC 5545: un día que no existe en el mes no genera ocurrencia
+			if t.Day() != d {
+				continue
+			}
+		default:
+			return
+		}
+		if !s.Hasta.IsZero() && t.After(s.Hasta) {
+			return
+		}
+		conteo++
+		if s.Conteo > 0 && conteo > s.Conteo {
+			return
+		}
+		if conteo > maxOcurrenciasSerie || !fn(t.UTC()) {
+			return
+		}
+	}
+}
+
+func (s *serie) exceptuada(inicio time.Time) bool {
+	return s.Excepciones[inicio.Unix()]
+}
+
+// ocurrencias regresa las ocurrencias que no son excepción y se empalman con [desde, hasta)
+func (s *serie) ocurrencias(desde, hasta time.Time) []intervalo {
+	var resultado []intervalo
+	duracion := s.duracion()
+	s.recorrer(func(inicio time.Time) bool {
+		if !inicio.Before(hasta) {
+			return false
+		}
+		if inicio.Add(duracion).After(desde) && !s.exceptuada(inicio) {
+			resultado = append(resultado, intervalo{IDCita: s.IDCita, Inicio: inicio, Fin: inicio.Add(duracion)})
+		}
+		return true
+	})
+	return resultado
+}
+
+// todas regresa todas las ocurrencias que no son excepción
+func (s *serie) todas() []intervalo {
+	return s.ocurrencias(s.Inicio, s.finSerie().Add(time.Minute))
+}
+
+// contiene indica si la regla genera una ocurrencia que empieza en inicio, sin contar las excepciones
+func (s *serie) contiene(inicio time.Time) bool {
+	encontrada := false
+	s.recorrer(func(t time.Time) bool {
+		if t.Equal(inicio) {
+			encontrada = true
+		}
+		return t.Before(inicio)
+	})
+	return encontrada
+}
+
+// antesDe cuenta las ocurrencias de la regla, incluyendo excepciones, que empiezan antes de inicio
+func (s *serie) antesDe(inicio time.Time) int {
+	n := 0
+	s.recorrer(func(t time.Time) bool {
+		if !t.Before(inicio) {
+			return false
+		}
+		n++
+		return true
+	})
+	return n
+}
+
+// finSerie es el fin de la ultima ocurrencia de la regla, se guarda en Citas.fin_serie para filtrar por rango
+func (s *serie) finSerie() time.Time {
+	ultima := s.Inicio
+	s.recorrer(func(t time.Time) bool {
+		ultima = t
+		return true
+	})
+	return ultima.Add(s.duracion())
+}
+
+// rrule regresa la regla en formato RFC 5545, UNTIL va en UTC como pide la RFC cuando DTSTART lleva TZID
+func (s *serie) rrule() string {
+	regla := "FREQ=" + frecuenciasRRule[s.Frecuencia]
+	if s.Intervalo > 1 {
+		regla += fmt.Sprintf(";INTERVAL=%d", s.Intervalo)
+	}
+	if s.Conteo > 0 {
+		regla += fmt.Sprintf(";COUNT=%d", s.Conteo)
+	} else if !s.Hasta.IsZero() {
+		regla += ";UNTIL=" + s.Hasta.UTC().Format(formatoICS)
+	}
+	return regla
+}
+
+// excepciones regresa las excepciones ordenadas
+func (s *serie) excepciones() []time.Time {
+	var resultado []time.Time
+	for unix := range s.Excepciones {
+		resultado = append(resultado, time.Unix(unix, 0).UTC())
+	}
+	sort.Slice(resultado, func(i, j int) bool { return resultado[i].Before(resultado[j]) })
+	return resultado
+}
+
+// recurrencia regresa la serie como la ve la API
+func (s *serie) recurrencia() *models.Recurrencia {
+	rec := &models.Recurrencia{
+		Frecuencia:  s.Frecuencia,
+		Intervalo:   s.Intervalo,
+		Conteo:      s.Conteo,
+		Excepciones: s.excepciones(),
+		RRule:       s.rrule(),
+	}
+	if !s.Hasta.IsZero() {
+		hasta := s.Hasta
+		rec.Hasta = &hasta
+	}
+	return rec
+}
+
+// nuevaSerie valida la recurrencia de la cita, que ya debe estar normalizada, y arma la serie en la zona del agente.
+// Las excepciones que no caen en una ocurrencia se descartan.
+func nuevaSerie(cita *models.Cita, loc *time.Location) (*serie, error) {
+	rec := cita.Recurrencia
+	if _, ok := frecuenciasRRule[rec.Frecuencia]; !ok {
+		return nil, fmt.Errorf("%w: frecuencia debe ser diaria, semanal o mensual", ErrInvalidCita)
+	}
+	if rec.Intervalo == 0 {
+		rec.Intervalo = 1
+	}
+	if rec.Intervalo < 1 || rec.Intervalo > 365 {
+		return nil, fmt.Errorf("%w: intervalo debe estar entre 1 y 365", ErrInvalidCita)
+	}
+	if (rec.Conteo > 0) == (rec.Hasta != nil) {
+		return nil, fmt.Errorf("%w: la recurrencia lleva conteo o hasta, pero no los dos", ErrInvalidCita)
+	}
+	if rec.Conteo < 0 || rec.Conteo > maxOcurrenciasSerie {
+		return nil, fmt.Errorf("%w: conteo debe estar entre 1 y %d", ErrInvalidCita, maxOcurrenciasSerie)
+	}
+
+	s := &serie{
+		IDCita:      cita.IDCita,
+		Inicio:      cita.Inicio,
+		Fin:         cita.Fin,
+		Frecuencia:  rec.Frecuencia,
+		Intervalo:   rec.Intervalo,
+		Conteo:      rec.Conteo,
+		Zona:        loc,
+		Excepciones: map[int64]bool{},
+	}
+	if rec.Hasta != nil {
+		s.Hasta = rec.Hasta.UTC()
+		if s.Hasta.Before(s.Inicio) {
+			return nil, fmt.Errorf("%w: hasta debe ser despues del inicio", ErrInvalidCita)
+		}
+	}
+	if s.finSerie().Sub(s.Inicio) > duracionMaximaSerie {
+		return nil, fmt.Errorf("%w: una serie puede durar maximo 2 años", ErrInvalidCita)
+	}
+	for _, excepcion := range rec.Excepciones {
+		excepcion = excepcion.UTC().Truncate(time.Minute)
+		if s.contiene(excepcion) {
+			s.Excepciones[excepcion.Unix()] = true
+		}
+	}
+	if len(s.todas()) == 0 {
+		return nil, fmt.Errorf("%w: la serie no tiene ocurrencias", ErrInvalidCita)
+	}
+	rec.Excepciones = s.excepciones()
+	rec.RRule = s.rrule()
+	return s, nil
+}
+
+// consultor es una conexión o transacción de la que se leen las series
+type consultor interface {
+	queryer
+	queryRower
+}
+
+// zonaDeSerie carga la zona guardada en zona_serie, la zona por defecto si está vacía o no existe
+func zonaDeSerie(nombre string, zonaDefault *time.Location) *time.Location {
+	if nombre != "" {
+		if loc, err := time.LoadLocation(nombre); err == nil {
+			return loc
+		}
+	}
+	return zonaDefault
+}
+
+// columnasSerie son las columnas de Citas que lee scanSerie
+const columnasSerie = "Citas.id_citas, Citas.inicio, Citas.fin, Citas.frecuencia, Citas.intervalo, Citas.conteo, Citas.hasta, Citas.zona_serie"
+
+func scanSerie(rows *sql.Rows, zonaDefault *time.Location) (*serie, error) {
+	var s serie
+	var conteo sql.NullInt64
+	var hasta sql.NullTime
+	var zona sql.NullString
+	if err := rows.Scan(&s.IDCita, &s.Inicio, &s.Fin, &s.Frecuencia, &s.Intervalo, &conteo, &hasta, &zona); err != nil {
+		return nil, err
+	}
+	s.Conteo = int(conteo.Int64)
+	if hasta.Valid {
+		s.Hasta = hasta.Time
+	}
+	s.Zona = zonaDeSerie(zona.String, zonaDefault)
+	s.Excepciones = map[int64]bool{}
+	return &s, nil
+}
+
+// cargarSeries regresa las series de Citas que cumplen la condición, con sus excepciones
+func cargarSeries(db queryer, zonaDefault *time.Location, condicion string, args ...interface{}) ([]*serie, error) {
+	query := "SELECT " + columnasSerie + " FROM Citas WHERE Citas.frecuencia IS NOT NULL AND " + condicion
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching series:", err)
+		return nil, err
+	}
+	var series []*serie
+	porID := map[int]*serie{}
+	for rows.Next() {
+		s, err := scanSerie(rows, zonaDefault)
+		if err != nil {
+			rows.Close()
+			log.Println("Error scanning serie:", err)
+			return nil, err
+		}
+		series = append(series, s)
+		porID[s.IDCita] = s
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	if len(series) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, 0, len(series))
+	ids := make([]interface{}, 0, len(series))
+	for _, s := range series {
+		placeholders = append(placeholders, "?")
+		ids = append(ids, s.IDCita)
+	}
+	rows, err = db.Query("SELECT id_cita, ocurrencia FROM Excepciones_Cita WHERE id_cita IN ("+strings.Join(placeholders, ", ")+")", ids...)
+	if err != nil {
+		log.Println("Error fetching excepciones:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var ocurrencia time.Time
+		if err := rows.Scan(&id, &ocurrencia); err != nil {
+			log.Println("Error scanning excepcion:", err)
+			return nil, err
+		}
+		porID[id].Excepciones[ocurrencia.Unix()] = true
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return series, nil
+}
+
+// cargarSerie regresa la serie de la cita, nil si la cita no existe o no es recurrente
+func cargarSerie(db queryer, zonaDefault *time.Location, id int) (*serie, error) {
+	series, err := cargarSeries(db, zonaDefault, "Citas.id_citas = ?", id)
+	if err != nil || len(series) == 0 {
+		return nil, err
+	}
+	return series[0], nil
+}
+
+// valoresSerie regresa las columnas de la serie para INSERT y UPDATE, NULL si la cita no es recurrente:
+// frecuencia, intervalo, conteo, hasta, zona_serie y fin_serie
+func valoresSerie(s *serie) []interface{} {
+	if s == nil {
+		return []interface{}{nil, 1, nil, nil, nil, nil}
+	}
+	var conteo, hasta interface{}
+	if s.Conteo > 0 {
+		conteo = s.Conteo
+	}
+	if !s.Hasta.IsZero() {
+		hasta = s.Hasta
+	}
+	return []interface{}{s.Frecuencia, s.Intervalo, conteo, hasta, s.Zona.String(), s.finSerie()}
+}
+
+// guardarExcepciones reemplaza las excepciones de la serie
+func guardarExcepciones(tx *sql.Tx, id int, s *serie) error {
+	if _, err := tx.Exec("DELETE FROM Excepciones_Cita WHERE id_cita = ?", id); err != nil {
+		log.Println("Error deleting excepciones:", err)
+		return err
+	}
+	if s == nil {
+		return nil
+	}
+	for _, excepcion := range s.excepciones() {
+		if _, err := tx.Exec("INSERT INTO Excepciones_Cita (id_cita, ocurrencia) VALUES (?, ?)", id, excepcion); err != nil {
+			log.Println("Error inserting excepcion:", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// validarSerie revisa que todas las ocurrencias caigan en el horario del agente y no se empalmen con otras citas
+func (service *CitasService) validarSerie(tx *sql.Tx, s *serie, cita *models.Cita, bloques []models.HorarioAgente, excluir int) error {
+	ocurrencias := s.todas()
+	for _, ocurrencia := range ocurrencias {
+		if !dentroDeHorario(bloques, ocurrencia, s.Zona) {
+			return fmt.Errorf("%w: la ocurrencia del %s", ErrOutsideWorkingHours, ocurrencia.Inicio.In(s.Zona).Format("2006-01-02 15:04"))
+		}
+	}
+
+	ocupadas, err := citasOcupadas(tx, service.ZonaDefault, cita.IdUsuario, cita.IdCliente, ocurrencias[0].Inicio, ocurrencias[len(ocurrencias)-1].Fin, excluir)
+	if err != nil {
+		return err
+	}
+	for _, ocurrencia := range ocurrencias {
+		for _, ocupada := range ocupadas {
+			if ocupada.seTraslapa(ocurrencia.Inicio, ocurrencia.Fin) {
+				return fmt.Errorf("%w: la ocurrencia del %s se empalma con la cita %d", ErrCitaConflict,
+					ocurrencia.Inicio.In(s.Zona).Format("2006-01-02 15:04"), ocupada.IDCita)
+			}
+		}
+	}
+	return nil
+}
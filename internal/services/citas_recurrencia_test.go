@@ -0,0 +1,137 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func fechaUTC(t *testing.T, valor string) time.Time {
+	t.Helper()
+	fecha, err := time.Parse(time.RFC3339, valor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fecha.UTC()
+}
+
+func TestSerieOcurrencias(t *testing.T) {
+	nuevaYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("sin base de zonas horarias:", err)
+	}
+	tests := []struct {
+		nombre string
+		serie  serie
+		want   []string
+	}{
+		{"diaria con conteo",
+			serie{Inicio: fechaUTC(t, "2024-12-16T16:00:00Z"), Frecuencia: FrecuenciaDiaria, Conteo: 3, Zona: time.UTC},
+			[]string{"2024-12-16T16:00:00Z", "2024-12-17T16:00:00Z", "2024-12-18T16:00:00Z"}},
+		{"cada dos días hasta una fecha",
+			serie{Inicio: fechaUTC(t, "2024-12-16T16:00:00Z"), Frecuencia: FrecuenciaDiaria, Intervalo: 2,
+				Hasta: fechaUTC(t, "2024-12-20T16:00:00Z"), Zona: time.UTC},
+			[]string{"2024-12-16T16:00:00Z", "2024-12-18T16:00:00Z", "2024-12-20T16:00:00Z"}},
+		{"semanal conserva la hora local con el horario de verano",
+			serie{Inicio: fechaUTC(t, "2024-10-28T14:00:00Z"), Frecuencia: FrecuenciaSemanal, Conteo: 2, Zona: nuevaYork},
+			[]string{"2024-10-28T14:00:00Z", "2024-11-04T15:00:00Z"}},
+		{"mensual el 31 se salta los meses sin ese día",
+			serie{Inicio: fechaUTC(t, "2025-01-31T16:00:00Z"), Frecuencia: FrecuenciaMensual, Conteo: 3, Zona: time.UTC},
+			[]string{"2025-01-31T16:00:00Z", "2025-03-31T16:00:00Z", "2025-05-31T16:00:00Z"}},
+		{"las excepciones cuentan para el conteo pero no salen",
+			serie{Inicio: fechaUTC(t, "2024-12-16T16:00:00Z"), Frecuencia: FrecuenciaDiaria, Conteo: 3, Zona: time.UTC,
+				Excepciones: map[int64]bool{fechaUTC(t, "2024-12-17T16:00:00Z").Unix(): true}},
+			[]string{"2024-12-16T16:00:00Z", "2024-12-18T16:00:00Z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			tt.serie.Fin = tt.serie.Inicio.Add(time.Hour)
+			got := tt.serie.todas()
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d ocurrencias, se esperaban %d: %v", len(got), len(tt.want), got)
+			}
+			for i, ocurrencia := range got {
+				if want := fechaUTC(t, tt.want[i]); !ocurrencia.Inicio.Equal(want) || !ocurrencia.Fin.Equal(want.Add(time.Hour)) {
+					t.Errorf("ocurrencia %d = %v - %v, se esperaba %v", i, ocurrencia.Inicio, ocurrencia.Fin, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSerieOcurrenciasEnRango(t *testing.T) {
+	s := serie{Inicio: fechaUTC(t, "2024-12-16T16:00:00Z"), Fin: fechaUTC(t, "2024-12-16T17:00:00Z"),
+		Frecuencia: FrecuenciaDiaria, Conteo: 10, Zona: time.UTC}
+	// La que empezó a las 16:00 del 17 sigue en curso a las 16:30, la del 19 empieza justo al final y no cuenta
+	got := s.ocurrencias(fechaUTC(t, "2024-12-17T16:30:00Z"), fechaUTC(t, "2024-12-19T16:00:00Z"))
+	if len(got) != 2 || !got[0].Inicio.Equal(fechaUTC(t, "2024-12-17T16:00:00Z")) || !got[1].Inicio.Equal(fechaUTC(t, "2024-12-18T16:00:00Z")) {
+		t.Errorf("ocurrencias = %v", got)
+	}
+}
+
+func TestSerieRRule(t *testing.T) {
+	tests := []struct {
+		nombre string
+		serie  serie
+		want   string
+	}{
+		{"diaria", serie{Frecuencia: FrecuenciaDiaria, Intervalo: 1, Conteo: 5}, "FREQ=DAILY;COUNT=5"},
+		{"semanal con intervalo", serie{Frecuencia: FrecuenciaSemanal, Intervalo: 2, Conteo: 3}, "FREQ=WEEKLY;INTERVAL=2;COUNT=3"},
+		{"mensual hasta", serie{Frecuencia: FrecuenciaMensual, Intervalo: 1, Hasta: fechaUTC(t, "2025-06-30T05:59:00-06:00")},
+			"FREQ=MONTHLY;UNTIL=20250630T115900Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			if got := tt.serie.rrule(); got != tt.want {
+				t.Errorf("rrule = %q, se esperaba %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeriePorRecordar(t *testing.T) {
+	ahora := fechaUTC(t, "2024-12-16T15:00:00Z")
+	diaria := func(excepciones ...string) *serie {
+		s := &serie{Inicio: fechaUTC(t, "2024-12-14T16:00:00Z"), Fin: fechaUTC(t, "2024-12-14T17:00:00Z"),
+			Frecuencia: FrecuenciaDiaria, Conteo: 10, Zona: time.UTC, Excepciones: map[int64]bool{}}
+		for _, e := range excepciones {
+			s.Excepciones[fechaUTC(t, e).Unix()] = true
+		}
+		return s
+	}
+	tests := []struct {
+		nombre   string
+		serie    *serie
+		editadas []string
+		want     []ocurrenciaPorRecordar
+	}{
+		// A las 15:00 la de hoy a las 16:00 está a una hora y la de mañana a 25 horas
+		{"solo las ocurrencias dentro de cada ventana", diaria(), nil,
+			[]ocurrenciaPorRecordar{{Tipo: Recordatorio1h, Antes: time.Hour, Inicio: fechaUTC(t, "2024-12-16T16:00:00Z")}}},
+		{"la cancelada no lleva", diaria("2024-12-16T16:00:00Z"), nil, nil},
+		{"la editada aparte no lleva", diaria(), []string{"2024-12-16T16:00:00Z"}, nil},
+		{"el de 24 horas de la siguiente semana",
+			&serie{Inicio: fechaUTC(t, "2024-12-10T14:00:00Z"), Fin: fechaUTC(t, "2024-12-10T15:00:00Z"),
+				Frecuencia: FrecuenciaSemanal, Hasta: fechaUTC(t, "2025-01-31T00:00:00Z"), Zona: time.UTC},
+			nil,
+			[]ocurrenciaPorRecordar{{Tipo: Recordatorio24h, Antes: 24 * time.Hour, Inicio: fechaUTC(t, "2024-12-17T14:00:00Z")}}},
+		{"la serie todavía no llega", &serie{Inicio: fechaUTC(t, "2024-12-20T16:00:00Z"), Fin: fechaUTC(t, "2024-12-20T17:00:00Z"),
+			Frecuencia: FrecuenciaDiaria, Conteo: 3, Zona: time.UTC}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			editadas := map[int64]bool{}
+			for _, e := range tt.editadas {
+				editadas[fechaUTC(t, e).Unix()] = true
+			}
+			got := tt.serie.porRecordar(ahora, editadas)
+			if len(got) != len(tt.want) {
+				t.Fatalf("porRecordar = %v, se esperaba %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Tipo != tt.want[i].Tipo || got[i].Antes != tt.want[i].Antes || !got[i].Inicio.Equal(tt.want[i].Inicio) {
+					t.Errorf("recordatorio %d = %+v, se esperaba %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
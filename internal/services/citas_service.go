@@ -4,137 +4,208 @@ import (
 	"backend/internal/database"
 	"backend/internal/models"
 	"database/sql"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"time"
 )
 
 type CitasService struct {
 	DB *sql.DB
+	// ZonaDefault es la zona horaria de los agentes que no han configurado la suya
+	ZonaDefault *time.Location
+	// Email manda las invitaciones ICS al prospecto, si es nil no se mandan
+	Email *EmailService
 }
 
 // Constructor for the CitasService
-func NewCitasService(db *sql.DB) *CitasService {
+func NewCitasService(db *sql.DB, zonaDefault *time.Location, email *EmailService) *CitasService {
+	if zonaDefault == nil {
+		zonaDefault = time.UTC
+	}
 	return &CitasService{
-		DB: db,
+		DB:          db,
+		ZonaDefault: zonaDefault,
+		Email:       email,
 	}
 }
 
-// Funcion que recupera todas las citas de la base de datos
-func (service *CitasService) GetAllCitasUser(IdUsuario string) ([]*models.CitaMenu, error) {
-	var citas []*models.CitaMenu
-	query := "SELECT id_citas, titulo_cita, fecha_cita, hora_cita, nombre_prospecto, apellido_paterno_prospecto, apellido_materno_prospecto FROM Citas, Prospecto where usuario = ? and Prospecto.id_cliente = Citas.id_cliente"
-	rows, err := service.DB.Query(query, IdUsuario)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Println("No rows found")
-			return nil, nil
-		}
-		log.Println("Error fetching all citas:", err)
-		return nil, err
-	}
-	defer rows.Close()
+const selectCitaMenu = "SELECT id_citas, titulo_cita, inicio, fin, frecuencia IS NOT NULL, nombre_prospecto, apellido_paterno_prospecto, apellido_materno_prospecto"
 
+// scanCitasMenu lee las filas de selectCitaMenu y agrega la hora en la zona del agente
+func scanCitasMenu(rows *sql.Rows, loc *time.Location) ([]*models.CitaMenu, error) {
+	var citas []*models.CitaMenu
 	for rows.Next() {
 		var cita models.CitaMenu
-		err := rows.Scan(&cita.IDCita, &cita.Titulo, &cita.FechaCita, &cita.HoraCita, &cita.NombreCliente, &cita.ApellidoPaternoCliente, &cita.ApellidoMaternoCliente)
+		err := rows.Scan(&cita.IDCita, &cita.Titulo, &cita.Inicio, &cita.Fin, &cita.Recurrente, &cita.NombreCliente, &cita.ApellidoPaternoCliente, &cita.ApellidoMaternoCliente)
 		if err != nil {
 			log.Println("Error scanning cita:", err)
 			return nil, err
 		}
+		cita.Duracion = int(cita.Fin.Sub(cita.Inicio) / time.Minute)
+		cita.HoraAgente = horaAgente(cita.Inicio, cita.Fin, loc)
 		citas = append(citas, &cita)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		log.Println("Error with rows:", err)
 		return nil, err
 	}
 	return citas, nil
 }
 
-func (service *CitasService) GetAllCitasUserDay(IdUsuario string, day string) ([]*models.CitaMenu, error) {
-	var citas []*models.CitaMenu
-	query := `
-		SELECT id_citas, titulo_cita, fecha_cita, hora_cita, nombre_prospecto, apellido_paterno_prospecto, apellido_materno_prospecto
-		FROM Citas
-		INNER JOIN Prospecto ON Prospecto.id_cliente = Citas.id_cliente
-		WHERE usuario = ? AND fecha_cita = ?
-	`
-	rows, err := service.DB.Query(query, IdUsuario, day)
+// Funcion que recupera todas las citas de la base de datos
+func (service *CitasService) GetAllCitasUser(IdUsuario string, page *models.PageRequest) (*models.Page[*models.CitaMenu], error) {
+	cursor, err := normalizePage(page)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := service.zonaAgente(service.DB, IdUsuario)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Println("No rows found")
-			return nil, nil
-		}
-		log.Println("Error fetching all citas:", err)
 		return nil, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var cita models.CitaMenu
-		err := rows.Scan(&cita.IDCita, &cita.Titulo, &cita.FechaCita, &cita.HoraCita, &cita.NombreCliente, &cita.ApellidoPaternoCliente, &cita.ApellidoMaternoCliente)
+	from := " FROM Citas INNER JOIN Prospecto ON Prospecto.id_cliente = Citas.id_cliente"
+	conditions := []string{"usuario = ?"}
+	args := []interface{}{IdUsuario}
+	total, err := countRows(service.DB, "SELECT COUNT(*)"+from+whereClause(conditions), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	order := pageOrder{ID: "Citas.id_citas"}
+	if cursor != nil {
+		condition, cursorArgs, err := keysetCondition(cursor, order)
 		if err != nil {
-			log.Println("Error scanning cita:", err)
 			return nil, err
 		}
-		citas = append(citas, &cita)
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
 	}
+	limit, limitArgs := limitClause(page)
+	args = append(args, limitArgs...)
 
-	if err = rows.Err(); err != nil {
-		log.Println("Error with rows:", err)
+	query := selectCitaMenu + from + whereClause(conditions) + " ORDER BY Citas.id_citas" + limit
+	rows, err := service.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching all citas:", err)
 		return nil, err
 	}
-	return citas, nil
+	defer rows.Close()
+
+	citas, err := scanCitasMenu(rows, loc)
+	if err != nil {
+		return nil, err
+	}
+	return buildPage(citas, total, page, order, func(cita *models.CitaMenu) (int, interface{}) {
+		return cita.IDCita, nil
+	}), nil
 }
 
-func (service *CitasService) GetAllCitasUserMonth(IdUsuario int, Mes int) ([]*models.CitaMenu, error) {
-	var citas []*models.CitaMenu
-	// Modificación de la consulta para filtrar por mes, asumiendo que fecha_cita es un string en formato 'yyyy-mm-dd'
-	query := `
-		SELECT id_citas, titulo_cita, fecha_cita, hora_cita, nombre_prospecto, 
-		       apellido_paterno_prospecto, apellido_materno_prospecto 
+// citasEnRango regresa las citas del agente que empiezan en [desde, hasta) ordenadas por hora,
+// las series se expanden en las ocurrencias que caen en el rango
+func (service *CitasService) citasEnRango(IdUsuario string, desde, hasta time.Time, loc *time.Location) ([]*models.CitaMenu, error) {
+	desde, hasta = desde.UTC(), hasta.UTC()
+	from := `
 		FROM Citas
-		JOIN Prospecto ON Prospecto.id_cliente = Citas.id_cliente
-		WHERE id_usuario = ? 
-		AND MONTH(STR_TO_DATE(fecha_cita, '%Y-%m-%d')) = ?`
-
-	// Ejecutamos la consulta, pasando el ID del usuario y el mes
-	rows, err := service.DB.Query(query, IdUsuario, Mes)
+		INNER JOIN Prospecto ON Prospecto.id_cliente = Citas.id_cliente`
+	query := selectCitaMenu + from + " WHERE usuario = ? AND frecuencia IS NULL AND inicio >= ? AND inicio < ?"
+	rows, err := service.DB.Query(query, IdUsuario, desde, hasta)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Println("No rows found")
-			return nil, nil
-		}
 		log.Println("Error fetching all citas:", err)
 		return nil, err
 	}
-	defer rows.Close()
+	citas, err := scanCitasMenu(rows, loc)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
 
-	// Recorremos las filas devueltas por la consulta
-	for rows.Next() {
-		var cita models.CitaMenu
-		err := rows.Scan(&cita.IDCita, &cita.Titulo, &cita.FechaCita, &cita.HoraCita,
-			&cita.NombreCliente, &cita.ApellidoPaternoCliente, &cita.ApellidoMaternoCliente)
+	series, err := cargarSeries(service.DB, service.ZonaDefault, "Citas.usuario = ? AND Citas.inicio < ? AND Citas.fin_serie > ?", IdUsuario, hasta, desde)
+	if err != nil {
+		return nil, err
+	}
+	ocurrencias := map[int][]intervalo{}
+	var ids []interface{}
+	var placeholders []string
+	for _, s := range series {
+		for _, ocurrencia := range s.ocurrencias(desde, hasta) {
+			if !ocurrencia.Inicio.Before(desde) {
+				ocurrencias[s.IDCita] = append(ocurrencias[s.IDCita], ocurrencia)
+			}
+		}
+		if len(ocurrencias[s.IDCita]) > 0 {
+			ids = append(ids, s.IDCita)
+			placeholders = append(placeholders, "?")
+		}
+	}
+
+	if len(ids) > 0 {
+		rows, err := service.DB.Query(selectCitaMenu+from+" WHERE id_citas IN ("+strings.Join(placeholders, ", ")+")", ids...)
 		if err != nil {
-			log.Println("Error scanning cita:", err)
+			log.Println("Error fetching series:", err)
 			return nil, err
 		}
-		citas = append(citas, &cita)
+		plantillas, err := scanCitasMenu(rows, loc)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, plantilla := range plantillas {
+			for _, ocurrencia := range ocurrencias[plantilla.IDCita] {
+				cita := *plantilla
+				inicio := ocurrencia.Inicio
+				cita.Inicio, cita.Fin, cita.Ocurrencia = ocurrencia.Inicio, ocurrencia.Fin, &inicio
+				cita.HoraAgente = horaAgente(cita.Inicio, cita.Fin, loc)
+				citas = append(citas, &cita)
+			}
+		}
 	}
 
-	// Verificamos si hubo algún error mientras leíamos las filas
-	if err = rows.Err(); err != nil {
-		log.Println("Error with rows:", err)
+	sort.SliceStable(citas, func(i, j int) bool {
+		if !citas[i].Inicio.Equal(citas[j].Inicio) {
+			return citas[i].Inicio.Before(citas[j].Inicio)
+		}
+		return citas[i].IDCita < citas[j].IDCita
+	})
+	return citas, nil
+}
+
+// Citas del agente en el día yyyy-mm-dd, el día se toma en la zona horaria del agente
+func (service *CitasService) GetAllCitasUserDay(IdUsuario string, day string) ([]*models.CitaMenu, error) {
+	loc, err := service.zonaAgente(service.DB, IdUsuario)
+	if err != nil {
 		return nil, err
 	}
+	desde, err := time.ParseInLocation(formatoFecha, day, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: el día debe tener el formato yyyy-mm-dd", ErrInvalidCita)
+	}
+	return service.citasEnRango(IdUsuario, desde, desde.AddDate(0, 0, 1), loc)
+}
 
-	return citas, nil
+// Citas del agente en el mes, el mes se toma en la zona horaria del agente
+func (service *CitasService) GetAllCitasUserMonth(IdUsuario string, anio int, mes int) ([]*models.CitaMenu, error) {
+	if mes < 1 || mes > 12 || anio < 1 {
+		return nil, fmt.Errorf("%w: el mes debe estar entre 1 y 12", ErrInvalidCita)
+	}
+	loc, err := service.zonaAgente(service.DB, IdUsuario)
+	if err != nil {
+		return nil, err
+	}
+	desde := time.Date(anio, time.Month(mes), 1, 0, 0, 0, 0, loc)
+	return service.citasEnRango(IdUsuario, desde, desde.AddDate(0, 1, 0), loc)
 }
 
 func (service *CitasService) GetCita(id int) (*models.Cita, error) {
 	var cita models.Cita
-	query := "SELECT * FROM Citas WHERE id_citas = ?"
+	var recurrente bool
+	var idSerie sql.NullInt64
+	var ocurrencia sql.NullTime
+	query := "SELECT id_citas, titulo_cita, inicio, fin, descripcion_cita, usuario, id_cliente, frecuencia IS NOT NULL, id_cita_serie, ocurrencia FROM Citas WHERE id_citas = ?"
 	row := service.DB.QueryRow(query, id)
-	err := row.Scan(&cita.IDCita, &cita.Titulo, &cita.FechaCita, &cita.HoraCita, &cita.Descripcion, &cita.IdUsuario, &cita.IdCliente)
+	err := row.Scan(&cita.IDCita, &cita.Titulo, &cita.Inicio, &cita.Fin, &cita.Descripcion, &cita.IdUsuario, &cita.IdCliente, &recurrente, &idSerie, &ocurrencia)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Println("No rows found")
@@ -143,139 +214,502 @@ func (service *CitasService) GetCita(id int) (*models.Cita, error) {
 		log.Println("Error fetching cita:", err)
 		return nil, err
 	}
+	loc, err := service.zonaAgente(service.DB, cita.IdUsuario)
+	if err != nil {
+		return nil, err
+	}
+	cita.Duracion = int(cita.Fin.Sub(cita.Inicio) / time.Minute)
+	cita.HoraAgente = horaAgente(cita.Inicio, cita.Fin, loc)
+	if recurrente {
+		s, err := cargarSerie(service.DB, service.ZonaDefault, id)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			cita.Recurrencia = s.recurrencia()
+		}
+	}
+	if idSerie.Valid {
+		serie := int(idSerie.Int64)
+		cita.IDCitaSerie = &serie
+		cita.Ocurrencia = &ocurrencia.Time
+	}
+	if cita.Propiedades, err = propiedadesCita(service.DB, id); err != nil {
+		return nil, err
+	}
+	if cita.Resultado, err = cargarResultado(service.DB, id); err != nil {
+		return nil, err
+	}
 	return &cita, nil
 }
 
-// Funcion que inserta una cita en la base de datos
-// func (service *CitasService) InsertCita(cita *models.Cita, prospecto *models.Prospecto) (int, int, error) {
-// 	utils := database.NewDbUtilities(service.DB)
-// 	lastId, err := utils.GetLastId("Citas", "id_citas")
-// 	if err != nil {
-// 		log.Println("Error getting last Id:", err)
-// 		return 0, 0, err
-// 	}
-// 	cita.IDCita = lastId + 1
-// 	prospecto.IdCliente = cita.IDCita
-// 	cita.IdCliente = prospecto.IdCliente
-
-// 	query := "INSERT INTO Prospecto (id_cliente, nombre_prospecto, apellido_paterno_prospecto, apellido_materno_prospecto, telefono_prospecto, correo_prospecto) VALUES (?, ?, ?, ?, ?, ?)"
-// 	result, err := service.DB.Exec(query, prospecto.IdCliente, prospecto.Nombre, prospecto.ApellidoP, prospecto.ApellidoM, prospecto.Telefono, prospecto.Correo)
-
-// 	if err != nil {
-// 		log.Println("Error inserting prospecto:", err)
-// 		return 0, 0, err
-// 	}
-// 	rows, err := result.RowsAffected()
-// 	if err != nil {
-// 		log.Println("Error getting rows affected:", err)
-// 		return 0, 0, err
-// 	}
-// 	if rows != 1 {
-// 		log.Println("Error inserting prospecto: no rows affected")
-// 		return 0, 0, err
-// 	}
-// 	query = "INSERT INTO Citas (id_citas, titulo_cita, fecha_cita, hora_cita, descripcion_cita, id_usuario, id_cliente) VALUES (?, ?, ?, ?, ?, ?, ?)"
-// 	result, err = service.DB.Exec(query, cita.IDCita, cita.Titulo, cita.FechaCita, cita.HoraCita, cita.Descripcion, cita.IdUsuario, cita.IdCliente)
-// 	if err != nil {
-// 		log.Println("Error inserting cita:", err)
-// 		return 0, 0, err
-// 	}
-// 	rows, err = result.RowsAffected()
-// 	if err != nil {
-// 		log.Println("Error getting rows affected:", err)
-// 		return 0, 0, err
-// 	}
-// 	if rows != 1 {
-// 		log.Println("Error inserting cita, no rows affected")
-// 		return 0, 0, err
-// 	}
-// 	return cita.IDCita, prospecto.IdCliente, nil
-// }
-
+// Funcion que inserta una cita, regresa ErrCitaConflict si el agente o el prospecto ya tienen otra cita a esa hora.
+// Si trae recurrencia se guarda una sola fila con la regla y se validan todas las ocurrencias.
 func (service *CitasService) InsertCita(cita *models.Cita) (int, error) {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Citas", "id_citas")
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error getting last Id:", err)
+		log.Println("Error starting transaction:", err)
 		return 0, err
 	}
-	cita.IDCita = lastId + 1
-	cita.IdCliente = cita.IDCita
+	defer tx.Rollback()
 
-	query := "INSERT INTO Citas(id_citas, titulo_cita, fecha_cita, hora_cita, descripcion_cita, usuario, id_cliente) VALUES(?,?,?,?,?,?,?)"
-	result, err := service.DB.Exec(query, cita.IDCita, cita.Titulo, cita.FechaCita, cita.HoraCita, cita.Descripcion, cita.IdUsuario, cita.IdCliente)
+	id, err := service.insertarCita(tx, cita, nil, nil)
 	if err != nil {
 		log.Println("Error inserting cita:", err)
 		return 0, err
 	}
-	rows, err := result.RowsAffected()
+	inv, err := service.cargarInvitacion(tx, id)
 	if err != nil {
-		log.Println("Error getting rows affected:", err)
 		return 0, err
 	}
-	if rows != 1 {
-		log.Println("Error inserting cita, no rows affected")
+	if err := tx.Commit(); err != nil {
+		log.Println("Error inserting cita:", err)
 		return 0, err
 	}
+	service.enviarInvitacion(inv, MetodoICSRequest)
+	cita.IDCita = id
 	return cita.IDCita, nil
 }
 
-// Funcion que actualiza una cita en la base de datos
+// insertarCita valida e inserta la cita en la transacción. Con idSerie la cita es una ocurrencia editada de esa serie
+// que reemplaza a la que empezaba en ocurrencia.
+func (service *CitasService) insertarCita(tx *sql.Tx, cita *models.Cita, idSerie *int, ocurrencia *time.Time) (int, error) {
+	s, err := service.reservarCita(tx, cita, 0)
+	if err != nil {
+		return 0, err
+	}
+	args := []interface{}{cita.Titulo, cita.Inicio, cita.Fin, cita.Descripcion, cita.IdUsuario, cita.IdCliente}
+	args = append(args, valoresSerie(s)...)
+	args = append(args, idSerie, ocurrencia)
+	query := `INSERT INTO Citas(titulo_cita, inicio, fin, descripcion_cita, usuario, id_cliente,
+		frecuencia, intervalo, conteo, hasta, zona_serie, fin_serie, id_cita_serie, ocurrencia) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+	id, err := database.Insert(tx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	if err := guardarExcepciones(tx, id, s); err != nil {
+		return 0, err
+	}
+	if err := guardarPropiedades(tx, id, cita.Propiedades); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Funcion que actualiza una cita en la base de datos, valida el horario y los empalmes igual que InsertCita.
+// En una serie cambia todas las ocurrencias, las que se editaron aparte se quedan como están.
 func (service *CitasService) UpdateCita(cita *models.Cita, id int) error {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Citas", "id_citas")
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error getting last ID:", err)
+		log.Println("Error starting transaction:", err)
 		return err
 	}
-	if id <= 0 || id > lastId {
-		log.Println("Invalid cita ID:", id)
+	defer tx.Rollback()
+
+	exists, err := database.RowExists(tx, "Citas", "id_citas", id)
+	if err != nil {
+		log.Println("Error updating cita:", err)
 		return err
 	}
-	query := "UPDATE Citas SET titulo_cita=?, fecha_cita=?, hora_cita=?, descripcion_cita=?, usuario=?, id_cliente=? WHERE id_citas=?"
-	result, err := service.DB.Exec(query, cita.Titulo, cita.FechaCita, cita.HoraCita, cita.Descripcion, cita.IdUsuario, cita.IdCliente, id)
+	if !exists {
+		return ErrResourceNotFound
+	}
+	anterior, err := service.cargarInvitacion(tx, id)
 	if err != nil {
+		return err
+	}
+	if cita.Recurrencia != nil {
+		if anterior.IDSerie > 0 {
+			return fmt.Errorf("%w: una ocurrencia editada no puede tener recurrencia", ErrInvalidCita)
+		}
+		// Las ocurrencias editadas aparte siguen siendo excepciones de la serie
+		editadas, err := ocurrenciasEditadas(tx, id)
+		if err != nil {
+			return err
+		}
+		cita.Recurrencia.Excepciones = append(cita.Recurrencia.Excepciones, editadas...)
+	}
+	s, err := service.reservarCita(tx, cita, id)
+	if err != nil {
+		log.Println("Error updating cita:", err)
+		return err
+	}
+
+	// secuencia sube en cada cambio para que los calendarios reemplacen la versión anterior de la invitación
+	args := []interface{}{cita.Titulo, cita.Inicio, cita.Fin, cita.Descripcion, cita.IdUsuario, cita.IdCliente}
+	args = append(args, valoresSerie(s)...)
+	args = append(args, id)
+	query := `UPDATE Citas SET titulo_cita=?, inicio=?, fin=?, descripcion_cita=?, usuario=?, id_cliente=?,
+		frecuencia=?, intervalo=?, conteo=?, hasta=?, zona_serie=?, fin_serie=?, secuencia=secuencia+1 WHERE id_citas=?`
+	if _, err := tx.Exec(query, args...); err != nil {
 		log.Println("Error updating cita:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
+	if err := guardarExcepciones(tx, id, s); err != nil {
+		return err
+	}
+	if cita.Propiedades != nil {
+		if err := guardarPropiedades(tx, id, cita.Propiedades); err != nil {
+			return err
+		}
+	}
+	inv, err := service.cargarInvitacion(tx, id)
 	if err != nil {
-		log.Println("Error getting rows affected:", err)
 		return err
 	}
-	if rows == 0 {
-		log.Println("Error updating cita, no rows affected")
+	if err := tx.Commit(); err != nil {
+		log.Println("Error updating cita:", err)
 		return err
 	}
+	// Si cambió el prospecto, al anterior se le cancela la invitación
+	if anterior != nil && inv != nil && anterior.CorreoProspecto != inv.CorreoProspecto {
+		anterior.Secuencia = inv.Secuencia
+		service.enviarInvitacion(anterior, MetodoICSCancel)
+	}
+	service.enviarInvitacion(inv, MetodoICSRequest)
+	cita.IDCita = id
 	return nil
 }
 
-// Funcion que elimina una cita de la base de datos
+// ocurrenciasEditadas regresa los inicios originales de las ocurrencias de la serie que se editaron aparte
+func ocurrenciasEditadas(db queryer, id int) ([]time.Time, error) {
+	rows, err := db.Query("SELECT ocurrencia FROM Citas WHERE id_cita_serie = ?", id)
+	if err != nil {
+		log.Println("Error fetching ocurrencias:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var ocurrencias []time.Time
+	for rows.Next() {
+		var ocurrencia time.Time
+		if err := rows.Scan(&ocurrencia); err != nil {
+			log.Println("Error scanning ocurrencia:", err)
+			return nil, err
+		}
+		ocurrencias = append(ocurrencias, ocurrencia)
+	}
+	return ocurrencias, rows.Err()
+}
+
+// borrarEditadasDesde borra las ocurrencias editadas aparte cuya ocurrencia original es desde o despues,
+// regresa sus invitaciones para cancelarlas
+func (service *CitasService) borrarEditadasDesde(tx *sql.Tx, id int, desde time.Time) ([]*invitacionCita, error) {
+	rows, err := tx.Query("SELECT id_citas FROM Citas WHERE id_cita_serie = ? AND ocurrencia >= ?", id, desde)
+	if err != nil {
+		log.Println("Error fetching ocurrencias:", err)
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var editada int
+		if err := rows.Scan(&editada); err != nil {
+			rows.Close()
+			log.Println("Error scanning ocurrencia:", err)
+			return nil, err
+		}
+		ids = append(ids, editada)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+
+	var canceladas []*invitacionCita
+	for _, editada := range ids {
+		inv, err := service.cargarInvitacion(tx, editada)
+		if err != nil {
+			return nil, err
+		}
+		if inv != nil {
+			inv.Secuencia++
+			canceladas = append(canceladas, inv)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM Citas WHERE id_cita_serie = ? AND ocurrencia >= ?", id, desde); err != nil {
+		log.Println("Error deleting ocurrencias:", err)
+		return nil, err
+	}
+	return canceladas, nil
+}
+
+// bloquearSerie bloquea la serie en la transacción y revisa que la ocurrencia exista y no esté cancelada
+func (service *CitasService) bloquearSerie(tx *sql.Tx, id int, ocurrencia time.Time, alcance string) (*serie, error) {
+	if alcance != AlcanceEsta && alcance != AlcanceSiguientes {
+		return nil, fmt.Errorf("%w: alcance debe ser esta o siguientes", ErrInvalidCita)
+	}
+	exists, err := database.RowExists(tx, "Citas", "id_citas", id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrResourceNotFound
+	}
+	s, err := cargarSerie(tx, service.ZonaDefault, id)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, fmt.Errorf("%w: la cita no es recurrente", ErrInvalidCita)
+	}
+	if !s.contiene(ocurrencia) || s.exceptuada(ocurrencia) {
+		return nil, fmt.Errorf("%w: la serie no tiene una ocurrencia que empiece en %s", ErrInvalidCita, ocurrencia.Format(time.RFC3339))
+	}
+	return s, nil
+}
+
+// cortarSerie termina la serie antes de la ocurrencia y quita las excepciones que ya no aplican
+func cortarSerie(tx *sql.Tx, s *serie, ocurrencia time.Time) error {
+	s.Conteo = 0
+	s.Hasta = ocurrencia.Add(-time.Minute)
+	query := "UPDATE Citas SET conteo = NULL, hasta = ?, fin_serie = ?, secuencia = secuencia + 1 WHERE id_citas = ?"
+	if _, err := tx.Exec(query, s.Hasta, s.finSerie(), s.IDCita); err != nil {
+		log.Println("Error updating serie:", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM Excepciones_Cita WHERE id_cita = ? AND ocurrencia >= ?", s.IDCita, ocurrencia); err != nil {
+		log.Println("Error deleting excepciones:", err)
+		return err
+	}
+	return nil
+}
+
+// PUT /citas/update/:id/ocurrencia
+// UpdateOcurrencia edita una ocurrencia de la serie. Con alcance "esta" la ocurrencia pasa a ser una cita aparte
+// ligada a la serie; con "siguientes" la serie se corta y desde esa ocurrencia empieza una serie nueva.
+// Regresa el id de la cita creada, o el de la serie si se editó desde la primera ocurrencia.
+func (service *CitasService) UpdateOcurrencia(id int, edicion *models.EdicionOcurrencia) (int, error) {
+	ocurrencia := edicion.Ocurrencia.UTC().Truncate(time.Minute)
+	cita := &edicion.Cita
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	s, err := service.bloquearSerie(tx, id, ocurrencia, edicion.Alcance)
+	if err != nil {
+		return 0, err
+	}
+	anterior, err := service.cargarInvitacion(tx, id)
+	if err != nil {
+		return 0, err
+	}
+	// Si no se mandan, la ocurrencia o la serie nueva muestran las mismas propiedades
+	if cita.Propiedades == nil {
+		if cita.Propiedades, err = propiedadesCita(tx, id); err != nil {
+			return 0, err
+		}
+	}
+
+	if edicion.Alcance == AlcanceEsta {
+		if cita.Recurrencia != nil {
+			return 0, fmt.Errorf("%w: una ocurrencia editada no puede tener recurrencia", ErrInvalidCita)
+		}
+		// La excepción va antes de validar para que la ocurrencia original no choque con la nueva
+		if _, err := tx.Exec("INSERT INTO Excepciones_Cita (id_cita, ocurrencia) VALUES (?, ?)", id, ocurrencia); err != nil {
+			log.Println("Error inserting excepcion:", err)
+			return 0, err
+		}
+		nueva, err := service.insertarCita(tx, cita, &id, &ocurrencia)
+		if err != nil {
+			log.Println("Error updating ocurrencia:", err)
+			return 0, err
+		}
+		// La ocurrencia conserva el UID de la serie, su secuencia debe ser mayor a la que ya tienen los calendarios
+		if _, err := tx.Exec("UPDATE Citas SET secuencia = ? WHERE id_citas = ?", anterior.Secuencia+1, nueva); err != nil {
+			log.Println("Error updating ocurrencia:", err)
+			return 0, err
+		}
+		inv, err := service.cargarInvitacion(tx, nueva)
+		if err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			log.Println("Error updating ocurrencia:", err)
+			return 0, err
+		}
+		if inv != nil && anterior.CorreoProspecto != inv.CorreoProspecto {
+			cancelada := anterior.ocurrencia(ocurrencia)
+			cancelada.Secuencia = inv.Secuencia
+			service.enviarInvitacion(cancelada, MetodoICSCancel)
+		}
+		service.enviarInvitacion(inv, MetodoICSRequest)
+		cita.IDCita = nueva
+		return nueva, nil
+	}
+
+	// Sin recurrencia en el cuerpo la serie nueva sigue la regla de la original desde la ocurrencia.
+	// Las excepciones de ocurrencias editadas aparte no pasan, esas ediciones se descartan.
+	editadas, err := ocurrenciasEditadas(tx, id)
+	if err != nil {
+		return 0, err
+	}
+	descartadas := map[int64]bool{}
+	for _, editada := range editadas {
+		descartadas[editada.Unix()] = true
+	}
+	if cita.Recurrencia == nil {
+		rec := &models.Recurrencia{Frecuencia: s.Frecuencia, Intervalo: s.Intervalo}
+		desplazamiento := cita.Inicio.Sub(ocurrencia)
+		if s.Conteo > 0 {
+			rec.Conteo = s.Conteo - s.antesDe(ocurrencia)
+		} else {
+			hasta := s.Hasta.Add(desplazamiento)
+			rec.Hasta = &hasta
+		}
+		for _, excepcion := range s.excepciones() {
+			if !excepcion.Before(ocurrencia) && !descartadas[excepcion.Unix()] {
+				rec.Excepciones = append(rec.Excepciones, excepcion.Add(desplazamiento))
+			}
+		}
+		cita.Recurrencia = rec
+	}
+
+	// Desde la primera ocurrencia es editar toda la serie
+	if ocurrencia.Equal(s.Inicio) {
+		tx.Rollback()
+		if err := service.UpdateCita(cita, id); err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+
+	// Como en los calendarios, editar esta y las siguientes descarta las ediciones sueltas desde el corte
+	canceladas, err := service.borrarEditadasDesde(tx, id, ocurrencia)
+	if err != nil {
+		return 0, err
+	}
+	if err := cortarSerie(tx, s, ocurrencia); err != nil {
+		return 0, err
+	}
+	nueva, err := service.insertarCita(tx, cita, nil, nil)
+	if err != nil {
+		log.Println("Error updating ocurrencia:", err)
+		return 0, err
+	}
+	original, err := service.cargarInvitacion(tx, id)
+	if err != nil {
+		return 0, err
+	}
+	inv, err := service.cargarInvitacion(tx, nueva)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error updating ocurrencia:", err)
+		return 0, err
+	}
+	service.enviarInvitacion(original, MetodoICSRequest)
+	for _, cancelada := range canceladas {
+		service.enviarInvitacion(cancelada, MetodoICSCancel)
+	}
+	service.enviarInvitacion(inv, MetodoICSRequest)
+	cita.IDCita = nueva
+	return nueva, nil
+}
+
+// Funcion que elimina una cita de la base de datos y le manda la cancelación al prospecto.
+// Si es una serie se borran también sus excepciones y las ocurrencias editadas aparte.
 func (service *CitasService) DeleteCita(id int) error {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Citas", "id_citas")
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error getting last ID:", err)
+		log.Println("Error starting transaction:", err)
 		return err
 	}
-	if id <= 0 || id > lastId {
-		log.Println("Invalid propiedad ID:", id)
+	defer tx.Rollback()
+
+	exists, err := database.RowExists(tx, "Citas", "id_citas", id)
+	if err != nil {
+		log.Println("Error deleting cita:", err)
 		return err
 	}
-	query := "DELETE FROM Citas WHERE id_citas = ?"
-	result, err := service.DB.Exec(query, id)
+	if !exists {
+		return ErrResourceNotFound
+	}
+	inv, err := service.cargarInvitacion(tx, id)
 	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		"DELETE FROM Excepciones_Cita WHERE id_cita = ?",
+		"DELETE FROM Citas WHERE id_cita_serie = ?",
+		"DELETE FROM Citas WHERE id_citas = ?",
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			log.Println("Error deleting cita:", err)
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
 		log.Println("Error deleting cita:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
+	inv.Secuencia++
+	service.enviarInvitacion(inv, MetodoICSCancel)
+	return nil
+}
+
+// DELETE /citas/eliminar/:id/ocurrencia
+// DeleteOcurrencia cancela una ocurrencia de la serie ("esta") o esa y las que siguen ("siguientes")
+func (service *CitasService) DeleteOcurrencia(id int, ocurrencia time.Time, alcance string) error {
+	ocurrencia = ocurrencia.UTC().Truncate(time.Minute)
+
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error getting rows affected:", err)
+		log.Println("Error starting transaction:", err)
 		return err
 	}
-	if rows == 0 {
-		log.Println("Error deleting cita, no rows affected")
+	defer tx.Rollback()
+
+	s, err := service.bloquearSerie(tx, id, ocurrencia, alcance)
+	if err != nil {
 		return err
 	}
+	if alcance == AlcanceSiguientes && ocurrencia.Equal(s.Inicio) {
+		tx.Rollback()
+		return service.DeleteCita(id)
+	}
+
+	var canceladas []*invitacionCita
+	if alcance == AlcanceEsta {
+		if _, err := tx.Exec("INSERT INTO Excepciones_Cita (id_cita, ocurrencia) VALUES (?, ?)", id, ocurrencia); err != nil {
+			log.Println("Error inserting excepcion:", err)
+			return err
+		}
+		if _, err := tx.Exec("UPDATE Citas SET secuencia = secuencia + 1 WHERE id_citas = ?", id); err != nil {
+			log.Println("Error updating serie:", err)
+			return err
+		}
+	} else {
+		canceladas, err = service.borrarEditadasDesde(tx, id, ocurrencia)
+		if err != nil {
+			return err
+		}
+		if err := cortarSerie(tx, s, ocurrencia); err != nil {
+			return err
+		}
+	}
+	inv, err := service.cargarInvitacion(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error deleting ocurrencia:", err)
+		return err
+	}
+
+	if alcance == AlcanceEsta {
+		cancelada := inv.ocurrencia(ocurrencia)
+		service.enviarInvitacion(cancelada, MetodoICSCancel)
+		return nil
+	}
+	// La serie cortada se vuelve a mandar con su UNTIL nuevo
+	service.enviarInvitacion(inv, MetodoICSRequest)
+	for _, cancelada := range canceladas {
+		service.enviarInvitacion(cancelada, MetodoICSCancel)
+	}
 	return nil
 }
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"backend/internal/models"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Resultados de una visita
+const (
+	ResultadoInteresado   = "interesado"
+	ResultadoNoInteresado = "no_interesado"
+	ResultadoOferta       = "oferta"
+	ResultadoNoAsistio    = "no_asistio"
+)
+
+// Una cita con propiedades es un recorrido, este es el maximo de propiedades
+const maxPropiedadesCita = 10
+
+var resultadosVisita = []string{ResultadoInteresado, ResultadoNoInteresado, ResultadoOferta, ResultadoNoAsistio}
+
+func resultadoValido(resultado string) bool {
+	for _, r := range resultadosVisita {
+		if r == resultado {
+			return true
+		}
+	}
+	return false
+}
+
+// nullIfEmpty guarda NULL en lugar de un texto vacío
+func nullIfEmpty(texto string) interface{} {
+	if strings.TrimSpace(texto) == "" {
+		return nil
+	}
+	return texto
+}
+
+// guardarPropiedades reemplaza las propiedades de la cita, el orden de la lista es el orden del recorrido.
+// Los resultados que ya tenían las propiedades que se quedan no se pierden.
+func guardarPropiedades(tx *sql.Tx, id int, propiedades []int) error {
+	if len(propiedades) > maxPropiedadesCita {
+		return fmt.Errorf("%w: una cita puede tener maximo %d propiedades", ErrInvalidCita, maxPropiedadesCita)
+	}
+	vistas := map[int]bool{}
+	args := []interface{}{id}
+	var placeholders []string
+	for _, propiedad := range propiedades {
+		if vistas[propiedad] {
+			return fmt.Errorf("%w: la propiedad %d está repetida", ErrInvalidCita, propiedad)
+		}
+		vistas[propiedad] = true
+		var found int
+		err := tx.QueryRow("SELECT 1 FROM Propiedades WHERE id_propiedad = ?", propiedad).Scan(&found)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: la propiedad %d no existe", ErrInvalidCita, propiedad)
+		}
+		if err != nil {
+			log.Println("Error checking propiedad:", err)
+			return err
+		}
+		args = append(args, propiedad)
+		placeholders = append(placeholders, "?")
+	}
+
+	query := "DELETE FROM Citas_Propiedades WHERE id_cita = ?"
+	if len(placeholders) > 0 {
+		query += " AND id_propiedad NOT IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		log.Println("Error deleting propiedades de cita:", err)
+		return err
+	}
+	for orden, propiedad := range propiedades {
+		query := `INSERT INTO Citas_Propiedades (id_cita, id_propiedad, orden) VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE orden = VALUES(orden)`
+		if _, err := tx.Exec(query, id, propiedad, orden); err != nil {
+			log.Println("Error inserting propiedad de cita:", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// propiedadesCita regresa las propiedades de la cita en el orden del recorrido
+func propiedadesCita(db queryer, id int) ([]int, error) {
+	rows, err := db.Query("SELECT id_propiedad FROM Citas_Propiedades WHERE id_cita = ? ORDER BY orden", id)
+	if err != nil {
+		log.Println("Error fetching propiedades de cita:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var propiedades []int
+	for rows.Next() {
+		var propiedad int
+		if err := rows.Scan(&propiedad); err != nil {
+			log.Println("Error scanning propiedad de cita:", err)
+			return nil, err
+		}
+		propiedades = append(propiedades, propiedad)
+	}
+	return propiedades, rows.Err()
+}
+
+// cargarResultado regresa el resultado de la visita con el de cada propiedad, nil si no se ha registrado
+func cargarResultado(db *sql.DB, id int) (*models.ResultadoCita, error) {
+	var resultado, notas, registradoPor sql.NullString
+	var registradoEn sql.NullTime
+	query := "SELECT resultado, notas_resultado, resultado_registrado_en, resultado_registrado_por FROM Citas WHERE id_citas = ?"
+	if err := db.QueryRow(query, id).Scan(&resultado, &notas, &registradoEn, &registradoPor); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Println("Error fetching resultado:", err)
+		return nil, err
+	}
+	if !resultado.Valid {
+		return nil, nil
+	}
+	r := &models.ResultadoCita{Resultado: resultado.String, Notas: notas.String, RegistradoPor: registradoPor.String}
+	if registradoEn.Valid {
+		r.RegistradoEn = &registradoEn.Time
+	}
+
+	rows, err := db.Query(`SELECT id_propiedad, resultado, notas FROM Citas_Propiedades
+		WHERE id_cita = ? AND (resultado IS NOT NULL OR notas IS NOT NULL) ORDER BY orden`, id)
+	if err != nil {
+		log.Println("Error fetching resultados de propiedades:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var propiedad models.ResultadoPropiedad
+		var resultadoPropiedad, notasPropiedad sql.NullString
+		if err := rows.Scan(&propiedad.IDPropiedad, &resultadoPropiedad, &notasPropiedad); err != nil {
+			log.Println("Error scanning resultado de propiedad:", err)
+			return nil, err
+		}
+		propiedad.Resultado = resultadoPropiedad.String
+		propiedad.Notas = notasPropiedad.String
+		r.Propiedades = append(r.Propiedades, propiedad)
+	}
+	return r, rows.Err()
+}
+
+// PUT /citas/resultado/:id
+// RegistrarResultado guarda el resultado de la visita y las notas del agente, se puede corregir las veces que sea.
+// Las series no tienen resultado, cada visita se registra en su ocurrencia editada.
+func (service *CitasService) RegistrarResultado(id int, resultado *models.ResultadoCita, usuario string) error {
+	if !resultadoValido(resultado.Resultado) {
+		return fmt.Errorf("%w: resultado debe ser uno de %s", ErrInvalidCita, strings.Join(resultadosVisita, ", "))
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var inicio time.Time
+	var recurrente bool
+	err = tx.QueryRow("SELECT inicio, frecuencia IS NOT NULL FROM Citas WHERE id_citas = ? FOR UPDATE", id).Scan(&inicio, &recurrente)
+	if err == sql.ErrNoRows {
+		return ErrResourceNotFound
+	}
+	if err != nil {
+		log.Println("Error fetching cita:", err)
+		return err
+	}
+	if recurrente {
+		return fmt.Errorf("%w: la cita es una serie, el resultado se registra editando la ocurrencia", ErrInvalidCita)
+	}
+	if inicio.After(time.Now()) {
+		return fmt.Errorf("%w: la cita todavía no empieza", ErrInvalidCita)
+	}
+
+	propiedades, err := propiedadesCita(tx, id)
+	if err != nil {
+		return err
+	}
+	enCita := map[int]bool{}
+	for _, propiedad := range propiedades {
+		enCita[propiedad] = true
+	}
+	for _, propiedad := range resultado.Propiedades {
+		if !enCita[propiedad.IDPropiedad] {
+			return fmt.Errorf("%w: la propiedad %d no está en la cita", ErrInvalidCita, propiedad.IDPropiedad)
+		}
+		if propiedad.Resultado != "" && !resultadoValido(propiedad.Resultado) {
+			return fmt.Errorf("%w: resultado de la propiedad %d debe ser uno de %s", ErrInvalidCita, propiedad.IDPropiedad, strings.Join(resultadosVisita, ", "))
+		}
+	}
+
+	query := `UPDATE Citas SET resultado = ?, notas_resultado = ?, resultado_registrado_en = ?, resultado_registrado_por = ?
+		WHERE id_citas = ?`
+	if _, err := tx.Exec(query, resultado.Resultado, nullIfEmpty(resultado.Notas), time.Now().UTC(), usuario, id); err != nil {
+		log.Println("Error updating resultado:", err)
+		return err
+	}
+	// Las propiedades que no se mandan toman el resultado de la cita
+	if _, err := tx.Exec("UPDATE Citas_Propiedades SET resultado = NULL, notas = NULL WHERE id_cita = ?", id); err != nil {
+		log.Println("Error updating resultados de propiedades:", err)
+		return err
+	}
+	for _, propiedad := range resultado.Propiedades {
+		query := "UPDATE Citas_Propiedades SET resultado = ?, notas = ? WHERE id_cita = ? AND id_propiedad = ?"
+		if _, err := tx.Exec(query, nullIfEmpty(propiedad.Resultado), nullIfEmpty(propiedad.Notas), id, propiedad.IDPropiedad); err != nil {
+			log.Println("Error updating resultado de propiedad:", err)
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error updating resultado:", err)
+		return err
+	}
+	return nil
+}
+
+// GET /propiedades/:id/visitas
+// GetVisitasPropiedad regresa las citas en las que se mostró la propiedad, de la mas reciente a la mas antigua,
+// con el resultado de la propiedad o el de la cita y el conteo de cada resultado
+func (service *CitasService) GetVisitasPropiedad(idPropiedad int, page *models.PageRequest) (*models.VisitasPropiedad, error) {
+	cursor, err := normalizePage(page)
+	if err != nil {
+		return nil, err
+	}
+	var found int
+	err = service.DB.QueryRow("SELECT 1 FROM Propiedades WHERE id_propiedad = ?", idPropiedad).Scan(&found)
+	if err == sql.ErrNoRows {
+		return nil, ErrResourceNotFound
+	}
+	if err != nil {
+		log.Println("Error checking propiedad:", err)
+		return nil, err
+	}
+
+	from := `
+		FROM Citas_Propiedades
+		INNER JOIN Citas ON Citas.id_citas = Citas_Propiedades.id_cita
+		INNER JOIN Prospecto ON Prospecto.id_cliente = Citas.id_cliente`
+	conditions := []string{"Citas_Propiedades.id_propiedad = ?"}
+	args := []interface{}{idPropiedad}
+
+	resumen := map[string]int{}
+	rows, err := service.DB.Query("SELECT COALESCE(Citas_Propiedades.resultado, Citas.resultado, 'pendiente'), COUNT(*)"+
+		from+whereClause(conditions)+" GROUP BY 1", args...)
+	if err != nil {
+		log.Println("Error counting visitas:", err)
+		return nil, err
+	}
+	total := 0
+	for rows.Next() {
+		var resultado string
+		var n int
+		if err := rows.Scan(&resultado, &n); err != nil {
+			rows.Close()
+			log.Println("Error scanning resumen:", err)
+			return nil, err
+		}
+		resumen[resultado] = n
+		total += n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+
+	order := pageOrder{Column: "Citas.inicio", ID: "Citas.id_citas", Desc: true}
+	if cursor != nil {
+		condition, cursorArgs, err := keysetCondition(cursor, order)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+	limit, limitArgs := limitClause(page)
+	args = append(args, limitArgs...)
+
+	query := `SELECT Citas.id_citas, Citas.titulo_cita, Citas.inicio, Citas.fin, Citas.frecuencia IS NOT NULL, Citas.usuario, Citas.id_cliente,
+			Prospecto.nombre_prospecto, Prospecto.apellido_paterno_prospecto,
+			COALESCE(Citas_Propiedades.resultado, Citas.resultado), COALESCE(Citas_Propiedades.notas, Citas.notas_resultado),
+			Citas.resultado_registrado_en` +
+		from + whereClause(conditions) + " ORDER BY Citas.inicio DESC, Citas.id_citas DESC" + limit
+	rows, err = service.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching visitas:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visitas []*models.VisitaPropiedad
+	for rows.Next() {
+		var visita models.VisitaPropiedad
+		var titulo, nombre, apellido, resultado, notas sql.NullString
+		var registradoEn sql.NullTime
+		err := rows.Scan(&visita.IDCita, &titulo, &visita.Inicio, &visita.Fin, &visita.Recurrente, &visita.Usuario, &visita.IDCliente,
+			&nombre, &apellido, &resultado, &notas, &registradoEn)
+		if err != nil {
+			log.Println("Error scanning visita:", err)
+			return nil, err
+		}
+		visita.Titulo = titulo.String
+		visita.NombreCliente = strings.TrimSpace(nombre.String + " " + apellido.String)
+		visita.Resultado = resultado.String
+		visita.Notas = notas.String
+		if registradoEn.Valid {
+			visita.RegistradoEn = &registradoEn.Time
+		}
+		visitas = append(visitas, &visita)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+
+	return &models.VisitasPropiedad{
+		Page: buildPage(visitas, total, page, order, func(visita *models.VisitaPropiedad) (int, interface{}) {
+			return visita.IDCita, visita.Inicio.Format("2006-01-02 15:04:05")
+		}),
+		Resumen: resumen,
+	}, nil
+}
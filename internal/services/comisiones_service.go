@@ -0,0 +1,550 @@
+package services
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Parte de la comisión para el agente de la propiedad cuando la regla no dice otra cosa
+	porcentajeCaptadorDefault = 50.0
+	mesesComisionMaximo       = 12.0
+)
+
+// Roles de un agente en la comisión de un contrato
+const (
+	RolCaptador       = "captador"
+	RolCierre         = "cierre"
+	RolCaptadorCierre = "captador_cierre"
+)
+
+// Origen de la regla de comisión que le toca a un contrato
+const (
+	OrigenContrato      = "contrato"
+	OrigenTipoPropiedad = "tipo_propiedad"
+	OrigenGeneral       = "general"
+)
+
+var ErrInvalidComision = errors.New("invalid commission rule")
+
+// ComisionesService maneja las reglas de comisión, el reparto entre agentes y los estados de cuenta de los propietarios
+type ComisionesService struct {
+	DB          *sql.DB
+	Email       *EmailService
+	ZonaDefault *time.Location
+}
+
+// Constructor para ComisionesService
+func NewComisionesService(db *sql.DB, email *EmailService, zonaDefault *time.Location) *ComisionesService {
+	return &ComisionesService{
+		DB:          db,
+		Email:       email,
+		ZonaDefault: zonaDefault,
+	}
+}
+
+// claveRegla identifica la regla en la tabla: hay una por contrato, una por tipo de propiedad y transacción y una general
+// por transacción. Así el INSERT ... ON DUPLICATE KEY UPDATE reemplaza la anterior.
+func claveRegla(idContrato, idTipoPropiedad *int, tipo string) string {
+	switch {
+	case idContrato != nil:
+		return fmt.Sprintf("contrato:%d", *idContrato)
+	case idTipoPropiedad != nil:
+		return fmt.Sprintf("tipo:%d:%s", *idTipoPropiedad, tipo)
+	}
+	return "general:" + tipo
+}
+
+const columnasRegla = `id_regla, id_contrato, id_tipo_propiedad, tipo_transaccion, porcentaje, meses, porcentaje_captador,
+	actualizado_por, actualizado_en`
+
+func scanRegla(row fila) (*models.ReglaComision, error) {
+	var regla models.ReglaComision
+	var idContrato, idTipo sql.NullInt64
+	var porcentaje, meses sql.NullFloat64
+	var captador float64
+	var actualizadoPor sql.NullString
+	err := row.Scan(&regla.IDRegla, &idContrato, &idTipo, &regla.TipoTransaccion, &porcentaje, &meses, &captador,
+		&actualizadoPor, &regla.ActualizadoEn)
+	if err != nil {
+		return nil, err
+	}
+	if idContrato.Valid {
+		id := int(idContrato.Int64)
+		regla.IDContrato = &id
+	}
+	if idTipo.Valid {
+		id := int(idTipo.Int64)
+		regla.IDTipoPropiedad = &id
+	}
+	if porcentaje.Valid {
+		regla.Porcentaje = &porcentaje.Float64
+	}
+	if meses.Valid {
+		regla.Meses = &meses.Float64
+	}
+	regla.PorcentajeCaptador = &captador
+	regla.ActualizadoPor = actualizadoPor.String
+	return &regla, nil
+}
+
+// validarRegla revisa que la regla tenga lo que pide su transacción: las ventas un porcentaje y las rentas meses
+func validarRegla(regla *models.ReglaComision) error {
+	switch regla.TipoTransaccion {
+	case TransaccionVenta:
+		if regla.Meses != nil {
+			return fmt.Errorf("%w: las ventas se cobran con porcentaje, no con meses", ErrInvalidComision)
+		}
+		if regla.Porcentaje == nil || *regla.Porcentaje <= 0 || *regla.Porcentaje > 100 {
+			return fmt.Errorf("%w: porcentaje debe ser mayor a 0 y hasta 100", ErrInvalidComision)
+		}
+	case TransaccionRenta:
+		if regla.Porcentaje != nil {
+			return fmt.Errorf("%w: las rentas se cobran en meses, no con porcentaje", ErrInvalidComision)
+		}
+		if regla.Meses == nil || *regla.Meses <= 0 || *regla.Meses > mesesComisionMaximo {
+			return fmt.Errorf("%w: meses debe ser mayor a 0 y hasta %.0f", ErrInvalidComision, mesesComisionMaximo)
+		}
+	default:
+		return fmt.Errorf("%w: tipo_transaccion debe ser %s o %s", ErrInvalidComision, TransaccionVenta, TransaccionRenta)
+	}
+	if regla.PorcentajeCaptador == nil {
+		captador := porcentajeCaptadorDefault
+		regla.PorcentajeCaptador = &captador
+	}
+	if *regla.PorcentajeCaptador < 0 || *regla.PorcentajeCaptador > 100 {
+		return fmt.Errorf("%w: porcentaje_captador debe estar entre 0 y 100", ErrInvalidComision)
+	}
+	return nil
+}
+
+// guardarRegla crea la regla o reemplaza la que tenga la misma clave, regresa su id
+func guardarRegla(db database.Execer, regla *models.ReglaComision, usuario string) (int, error) {
+	query := `INSERT INTO Reglas_Comision (clave, id_contrato, id_tipo_propiedad, tipo_transaccion, porcentaje, meses,
+			porcentaje_captador, actualizado_por, actualizado_en)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id_regla = LAST_INSERT_ID(id_regla), tipo_transaccion = VALUES(tipo_transaccion),
+			porcentaje = VALUES(porcentaje), meses = VALUES(meses), porcentaje_captador = VALUES(porcentaje_captador),
+			actualizado_por = VALUES(actualizado_por), actualizado_en = VALUES(actualizado_en)`
+	id, err := database.Insert(db, query, claveRegla(regla.IDContrato, regla.IDTipoPropiedad, regla.TipoTransaccion),
+		regla.IDContrato, regla.IDTipoPropiedad, regla.TipoTransaccion, regla.Porcentaje, regla.Meses, *regla.PorcentajeCaptador,
+		nullIfEmpty(usuario), time.Now().UTC())
+	if err != nil {
+		log.Println("Error saving regla de comision:", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// getReglas regresa las reglas que cumplen la condición por su clave
+func getReglas(db queryer, condicion string, args ...interface{}) (map[string]*models.ReglaComision, error) {
+	rows, err := db.Query("SELECT "+columnasRegla+" FROM Reglas_Comision WHERE "+condicion, args...)
+	if err != nil {
+		log.Println("Error fetching reglas de comision:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	reglas := map[string]*models.ReglaComision{}
+	for rows.Next() {
+		regla, err := scanRegla(rows)
+		if err != nil {
+			log.Println("Error scanning regla de comision:", err)
+			return nil, err
+		}
+		reglas[claveRegla(regla.IDContrato, regla.IDTipoPropiedad, regla.TipoTransaccion)] = regla
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return reglas, nil
+}
+
+// reglaAplicable busca la regla del contrato, luego la de su tipo de propiedad y al final la general
+func reglaAplicable(reglas map[string]*models.ReglaComision, cuenta *cuentaRenta) (*models.ReglaComision, string) {
+	id := cuenta.IDContrato
+	if regla, ok := reglas[claveRegla(&id, nil, cuenta.Tipo)]; ok {
+		return regla, OrigenContrato
+	}
+	tipo := cuenta.IDTipoPropiedad
+	if regla, ok := reglas[claveRegla(nil, &tipo, cuenta.Tipo)]; ok {
+		return regla, OrigenTipoPropiedad
+	}
+	if regla, ok := reglas[claveRegla(nil, nil, cuenta.Tipo)]; ok {
+		return regla, OrigenGeneral
+	}
+	return nil, ""
+}
+
+// comisionTotal es la comisión completa del contrato en centavos: meses de renta o porcentaje del precio de venta
+func comisionTotal(regla *models.ReglaComision, cuenta *cuentaRenta) int64 {
+	if regla == nil || cuenta.Monto == nil {
+		return 0
+	}
+	switch {
+	case cuenta.Tipo == TransaccionRenta && regla.Meses != nil:
+		return centavos(*cuenta.Monto * *regla.Meses)
+	case cuenta.Tipo == TransaccionVenta && regla.Porcentaje != nil:
+		return centavos(*cuenta.Monto * *regla.Porcentaje / 100)
+	}
+	return 0
+}
+
+// repartir divide la comisión entre el agente de la propiedad y el que cerró, el centavo que sobra es del que cerró
+func repartir(total int64, regla *models.ReglaComision) (captador, cierre int64) {
+	porcentaje := porcentajeCaptadorDefault
+	if regla != nil && regla.PorcentajeCaptador != nil {
+		porcentaje = *regla.PorcentajeCaptador
+	}
+	captador = centavos(pesos(total) * porcentaje / 100)
+	return captador, total - captador
+}
+
+// rentaCobrada suma lo que se aplicó a las rentas con pagos de antes de la fecha (sin fecha es todo).
+// La comisión se retiene solo de las rentas: el depósito se guarda y los recargos son del propietario.
+func rentaCobrada(aplicaciones []aplicacionPago, antesDe string) int64 {
+	var total int64
+	for _, a := range aplicaciones {
+		if a.Tipo == CargoRenta && (antesDe == "" || a.Fecha < antesDe) {
+			total += a.Centavos
+		}
+	}
+	return total
+}
+
+// GET /comisiones/reglas
+// Funcion que regresa las reglas generales y por tipo de propiedad, las de contrato salen en cada contrato
+func (service *ComisionesService) GetReglas() ([]*models.ReglaComision, error) {
+	reglas, err := getReglas(service.DB, "id_contrato IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	lista := []*models.ReglaComision{}
+	for _, regla := range reglas {
+		lista = append(lista, regla)
+	}
+	sort.Slice(lista, func(i, j int) bool {
+		a, b := lista[i], lista[j]
+		if (a.IDTipoPropiedad == nil) != (b.IDTipoPropiedad == nil) {
+			return a.IDTipoPropiedad == nil
+		}
+		if a.IDTipoPropiedad != nil && *a.IDTipoPropiedad != *b.IDTipoPropiedad {
+			return *a.IDTipoPropiedad < *b.IDTipoPropiedad
+		}
+		return a.TipoTransaccion < b.TipoTransaccion
+	})
+	return lista, nil
+}
+
+// PUT /comisiones/reglas
+// Funcion que crea o reemplaza la regla general o la de un tipo de propiedad para una transacción
+func (service *ComisionesService) GuardarRegla(regla *models.ReglaComision, usuario string) (*models.ReglaComision, error) {
+	regla.IDContrato = nil
+	if err := validarRegla(regla); err != nil {
+		return nil, err
+	}
+	if regla.IDTipoPropiedad != nil {
+		var existe bool
+		err := service.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM Tipo_Propiedad WHERE id_tipo_propiedad = ?)", *regla.IDTipoPropiedad).Scan(&existe)
+		if err != nil {
+			log.Println("Error checking tipo de propiedad:", err)
+			return nil, err
+		}
+		if !existe {
+			return nil, fmt.Errorf("%w: el tipo de propiedad no existe", ErrInvalidComision)
+		}
+	}
+
+	id, err := guardarRegla(service.DB, regla, usuario)
+	if err != nil {
+		return nil, err
+	}
+	guardada, err := scanRegla(service.DB.QueryRow("SELECT "+columnasRegla+" FROM Reglas_Comision WHERE id_regla = ?", id))
+	if err != nil {
+		log.Println("Error fetching regla de comision:", err)
+		return nil, err
+	}
+	return guardada, nil
+}
+
+// DELETE /comisiones/reglas/:id
+// Funcion que borra una regla general o de tipo de propiedad, los contratos usan la que sigue
+func (service *ComisionesService) DeleteRegla(id int) error {
+	result, err := service.DB.Exec("DELETE FROM Reglas_Comision WHERE id_regla = ? AND id_contrato IS NULL", id)
+	if err != nil {
+		log.Println("Error deleting regla de comision:", err)
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return ErrResourceNotFound
+	}
+	return nil
+}
+
+// getCuentaComision recupera un contrato de renta o venta con sus cargos y pagos
+func (service *ComisionesService) getCuentaComision(id int) (*cuentaRenta, error) {
+	cuentas, err := getCuentas(service.DB, "Contratos.id_contrato = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(cuentas) == 0 {
+		return nil, ErrResourceNotFound
+	}
+	if cuentas[0].Tipo != TransaccionRenta && cuentas[0].Tipo != TransaccionVenta {
+		return nil, fmt.Errorf("%w: solo los contratos de renta o venta llevan comisión", ErrInvalidComision)
+	}
+	return cuentas[0], nil
+}
+
+// GET /comisiones/contratos/:id
+// Funcion que regresa la comisión del contrato, la regla de donde sale, lo que ya se retuvo y el reparto entre agentes
+func (service *ComisionesService) GetComisionContrato(id int) (*models.ComisionContrato, error) {
+	cuenta, err := service.getCuentaComision(id)
+	if err != nil {
+		return nil, err
+	}
+	reglas, err := getReglas(service.DB, "id_contrato = ? OR id_contrato IS NULL", id)
+	if err != nil {
+		return nil, err
+	}
+	regla, origen := reglaAplicable(reglas, cuenta)
+	total := comisionTotal(regla, cuenta)
+
+	var retenida int64
+	if cuenta.Tipo == TransaccionRenta {
+		retenida = min(rentaCobrada(asignarPagos(cuenta.Cargos, cuenta.Pagos), ""), total)
+	} else if cuenta.FirmadoEn.Valid && cuenta.Estado != EstadoContratoRescindido {
+		retenida = total
+	}
+	captador, cierre := repartir(total, regla)
+	return &models.ComisionContrato{IDContrato: cuenta.IDContrato, Tipo: cuenta.Tipo, AgenteCaptador: cuenta.Usuario,
+		AgenteCierre: cuenta.AgenteCierre, Origen: origen, Regla: regla, Total: pesos(total), Retenida: pesos(retenida),
+		Captador: pesos(captador), Cierre: pesos(cierre)}, nil
+}
+
+// PUT /comisiones/contratos/:id
+// Funcion que cambia la regla de comisión del contrato y el agente que lo cerró
+func (service *ComisionesService) SetComisionContrato(id int, cambio *models.CambioComisionContrato, usuario string) (*models.ComisionContrato, error) {
+	cuenta, err := service.getCuentaComision(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var regla *models.ReglaComision
+	if cambio.Porcentaje != nil || cambio.Meses != nil || cambio.PorcentajeCaptador != nil {
+		regla = &models.ReglaComision{IDContrato: &id, TipoTransaccion: cuenta.Tipo, Porcentaje: cambio.Porcentaje,
+			Meses: cambio.Meses, PorcentajeCaptador: cambio.PorcentajeCaptador}
+		if err := validarRegla(regla); err != nil {
+			return nil, err
+		}
+	}
+	var agente string
+	if cambio.AgenteCierre != nil {
+		agente = strings.TrimSpace(*cambio.AgenteCierre)
+		if agente != "" {
+			var existe bool
+			err := service.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM Usuarios WHERE usuario = ? AND borrado_en IS NULL)", agente).Scan(&existe)
+			if err != nil {
+				log.Println("Error checking usuario:", err)
+				return nil, err
+			}
+			if !existe {
+				return nil, fmt.Errorf("%w: agente_cierre no es un usuario", ErrInvalidComision)
+			}
+		}
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if regla != nil {
+		if _, err := guardarRegla(tx, regla, usuario); err != nil {
+			return nil, err
+		}
+	}
+	if cambio.AgenteCierre != nil {
+		if _, err := tx.Exec("UPDATE Contratos SET agente_cierre = ? WHERE id_contrato = ?", nullIfEmpty(agente), id); err != nil {
+			log.Println("Error updating agente de cierre:", err)
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		return nil, err
+	}
+	return service.GetComisionContrato(id)
+}
+
+// DELETE /comisiones/contratos/:id
+// Funcion que quita la regla propia del contrato, vuelve a usar la de su tipo de propiedad o la general
+func (service *ComisionesService) DeleteComisionContrato(id int) error {
+	if _, err := service.getCuentaComision(id); err != nil {
+		return err
+	}
+	if _, err := service.DB.Exec("DELETE FROM Reglas_Comision WHERE id_contrato = ?", id); err != nil {
+		log.Println("Error deleting regla de comision:", err)
+		return err
+	}
+	return nil
+}
+
+// periodoMes es el mes del filtro, o el mes pasado en la zona del negocio si no trae año y mes
+func periodoMes(filtro *models.FiltroPeriodo, zona *time.Location) (periodo, desde, hasta string, err error) {
+	var inicio time.Time
+	switch {
+	case filtro.Anio == nil && filtro.Mes == nil:
+		y, m, _ := time.Now().In(zona).Date()
+		inicio = time.Date(y, m-1, 1, 0, 0, 0, 0, time.UTC)
+	case filtro.Anio == nil || filtro.Mes == nil:
+		return "", "", "", fmt.Errorf("%w: anio y mes van juntos", ErrInvalidFilter)
+	case *filtro.Anio < 2000 || *filtro.Anio > 2100 || *filtro.Mes < 1 || *filtro.Mes > 12:
+		return "", "", "", fmt.Errorf("%w: anio debe estar entre 2000 y 2100 y mes entre 1 y 12", ErrInvalidFilter)
+	default:
+		inicio = time.Date(*filtro.Anio, time.Month(*filtro.Mes), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return inicio.Format("2006-01"), inicio.Format(formatoFecha), inicio.AddDate(0, 1, -1).Format(formatoFecha), nil
+}
+
+// comisionPeriodo es lo que se cobró y se retuvo de un contrato en un mes
+type comisionPeriodo struct {
+	Cuenta   *cuentaRenta
+	Regla    *models.ReglaComision
+	Cobrado  int64 // Rentas: renta cobrada. Ventas: precio
+	Recargos int64
+	Comision int64 // Lo que se retuvo en el mes
+	Vencido  int64 // Rentas: lo que debía el inquilino al cerrar el mes
+	Firma    string
+}
+
+// comisionesPeriodo calcula el mes de los contratos de renta y venta que cumplen la condición (sobre Contratos y
+// Propiedades). Las rentas entran si estuvieron vigentes en el mes o se cobró algo; las ventas si se firmaron en el mes.
+func (service *ComisionesService) comisionesPeriodo(desde, hasta, condicion string, args ...interface{}) ([]*comisionPeriodo, error) {
+	condicion = "Contratos.tipo IN (?, ?) AND Contratos.estado <> ? AND " + condicion
+	args = append([]interface{}{TransaccionRenta, TransaccionVenta, EstadoContratoBorrador}, args...)
+	cuentas, err := getCuentas(service.DB, condicion, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(cuentas) == 0 {
+		return nil, nil
+	}
+	reglas, err := getReglas(service.DB, "1 = 1")
+	if err != nil {
+		return nil, err
+	}
+
+	var periodos []*comisionPeriodo
+	siguiente := sumarDias(hasta, 1)
+	for _, cuenta := range cuentas {
+		regla, _ := reglaAplicable(reglas, cuenta)
+		total := comisionTotal(regla, cuenta)
+		p := &comisionPeriodo{Cuenta: cuenta, Regla: regla}
+
+		if cuenta.Tipo == TransaccionVenta {
+			if !cuenta.FirmadoEn.Valid || cuenta.Estado == EstadoContratoRescindido {
+				continue
+			}
+			p.Firma = cuenta.FirmadoEn.Time.In(service.ZonaDefault).Format(formatoFecha)
+			if p.Firma < desde || p.Firma > hasta {
+				continue
+			}
+			if cuenta.Monto != nil {
+				p.Cobrado = centavos(*cuenta.Monto)
+			}
+			p.Comision = total
+			periodos = append(periodos, p)
+			continue
+		}
+
+		aplicaciones := asignarPagos(cuenta.Cargos, cuenta.Pagos)
+		antes := rentaCobrada(aplicaciones, desde)
+		p.Cobrado = rentaCobrada(aplicaciones, siguiente) - antes
+		for _, a := range aplicaciones {
+			if a.Tipo == CargoRecargo && a.Fecha >= desde && a.Fecha <= hasta {
+				p.Recargos += a.Centavos
+			}
+		}
+		// La comisión se retiene de las primeras rentas que se cobran hasta completar los meses de la regla
+		p.Comision = min(antes+p.Cobrado, total) - min(antes, total)
+		aplicarPagos(cuenta.Cargos, cuenta.Pagos, siguiente, hasta)
+		vencido, _, _ := resumenAtraso(cuenta.Cargos)
+		p.Vencido = centavos(vencido)
+
+		vigente := cuenta.Inicio != nil && *cuenta.Inicio <= hasta && (cuenta.Fin == nil || *cuenta.Fin >= desde) &&
+			(!cuenta.RescindidoEn.Valid || cuenta.RescindidoEn.Time.In(service.ZonaDefault).Format(formatoFecha) >= desde)
+		if !vigente && p.Cobrado == 0 && p.Recargos == 0 {
+			continue
+		}
+		periodos = append(periodos, p)
+	}
+	return periodos, nil
+}
+
+// GET /comisiones/agentes?anio=&mes=&usuario=
+// Funcion que reparte las comisiones del mes entre el agente de cada propiedad y el que cerró el contrato
+func (service *ComisionesService) GetComisionesAgentes(filtro *models.FiltroPeriodo) (*models.ReporteComisiones, error) {
+	periodo, desde, hasta, err := periodoMes(filtro, service.ZonaDefault)
+	if err != nil {
+		return nil, err
+	}
+	condicion, args := "1 = 1", []interface{}{}
+	if filtro.Usuario != "" {
+		condicion = "(Propiedades.usuario = ? OR Contratos.agente_cierre = ?)"
+		args = append(args, filtro.Usuario, filtro.Usuario)
+	}
+	periodos, err := service.comisionesPeriodo(desde, hasta, condicion, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	reporte := models.ReporteComisiones{Periodo: periodo, Agentes: []*models.ComisionAgente{}}
+	porAgente := map[string]*models.ComisionAgente{}
+	montos := map[string]int64{}
+	var total int64
+	agregar := func(usuario, rol string, p *comisionPeriodo, monto int64) {
+		if usuario == "" || (filtro.Usuario != "" && usuario != filtro.Usuario) {
+			return
+		}
+		agente, ok := porAgente[usuario]
+		if !ok {
+			agente = &models.ComisionAgente{Usuario: usuario, Detalle: []*models.DetalleComision{}}
+			porAgente[usuario] = agente
+			reporte.Agentes = append(reporte.Agentes, agente)
+		}
+		montos[usuario] += monto
+		total += monto
+		agente.Detalle = append(agente.Detalle, &models.DetalleComision{IDContrato: p.Cuenta.IDContrato, Tipo: p.Cuenta.Tipo,
+			TituloPropiedad: p.Cuenta.Propiedad, Rol: rol, Comision: pesos(p.Comision), Monto: pesos(monto)})
+	}
+	for _, p := range periodos {
+		if p.Comision == 0 {
+			continue
+		}
+		captador, cierre := repartir(p.Comision, p.Regla)
+		agenteCierre := primeroNoVacio(p.Cuenta.AgenteCierre, p.Cuenta.Usuario)
+		if agenteCierre == p.Cuenta.Usuario {
+			agregar(p.Cuenta.Usuario, RolCaptadorCierre, p, p.Comision)
+			continue
+		}
+		agregar(p.Cuenta.Usuario, RolCaptador, p, captador)
+		agregar(agenteCierre, RolCierre, p, cierre)
+	}
+	for usuario, agente := range porAgente {
+		agente.Total = pesos(montos[usuario])
+	}
+	sort.SliceStable(reporte.Agentes, func(i, j int) bool { return reporte.Agentes[i].Total > reporte.Agentes[j].Total })
+	reporte.Total = pesos(total)
+	return &reporte, nil
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"backend/internal/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func numero(valor float64) *float64 {
+	return &valor
+}
+
+func entero(valor int) *int {
+	return &valor
+}
+
+func TestReglaAplicable(t *testing.T) {
+	contrato := &models.ReglaComision{IDContrato: entero(7), TipoTransaccion: TransaccionRenta, Meses: numero(2)}
+	tipo := &models.ReglaComision{IDTipoPropiedad: entero(3), TipoTransaccion: TransaccionRenta, Meses: numero(1.5)}
+	general := &models.ReglaComision{TipoTransaccion: TransaccionRenta, Meses: numero(1)}
+	venta := &models.ReglaComision{TipoTransaccion: TransaccionVenta, Porcentaje: numero(5)}
+	todas := func(reglas ...*models.ReglaComision) map[string]*models.ReglaComision {
+		mapa := map[string]*models.ReglaComision{}
+		for _, regla := range reglas {
+			mapa[claveRegla(regla.IDContrato, regla.IDTipoPropiedad, regla.TipoTransaccion)] = regla
+		}
+		return mapa
+	}
+	renta := &cuentaRenta{IDContrato: 7, Tipo: TransaccionRenta, IDTipoPropiedad: 3}
+	tests := []struct {
+		nombre string
+		reglas map[string]*models.ReglaComision
+		cuenta *cuentaRenta
+		want   *models.ReglaComision
+		origen string
+	}{
+		{"la del contrato gana", todas(contrato, tipo, general), renta, contrato, OrigenContrato},
+		{"luego la del tipo de propiedad", todas(tipo, general), renta, tipo, OrigenTipoPropiedad},
+		{"al final la general", todas(general, venta), renta, general, OrigenGeneral},
+		{"la de otro tipo no aplica", todas(tipo, general), &cuentaRenta{IDContrato: 8, Tipo: TransaccionRenta, IDTipoPropiedad: 4},
+			general, OrigenGeneral},
+		{"la de otra transacción no aplica", todas(tipo, general), &cuentaRenta{IDContrato: 7, Tipo: TransaccionVenta, IDTipoPropiedad: 3},
+			nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			got, origen := reglaAplicable(tt.reglas, tt.cuenta)
+			if got != tt.want || origen != tt.origen {
+				t.Errorf("reglaAplicable = %+v, %q; se esperaba %+v, %q", got, origen, tt.want, tt.origen)
+			}
+		})
+	}
+}
+
+func TestComisionTotal(t *testing.T) {
+	tests := []struct {
+		nombre string
+		regla  *models.ReglaComision
+		cuenta *cuentaRenta
+		want   int64
+	}{
+		{"renta en meses", &models.ReglaComision{Meses: numero(1.5)}, &cuentaRenta{Tipo: TransaccionRenta, Monto: numero(8000)}, 1200000},
+		{"venta en porcentaje", &models.ReglaComision{Porcentaje: numero(5)}, &cuentaRenta{Tipo: TransaccionVenta, Monto: numero(2500000)}, 12500000},
+		{"porcentaje con centavos", &models.ReglaComision{Porcentaje: numero(3)}, &cuentaRenta{Tipo: TransaccionVenta, Monto: numero(1234567.89)}, 3703704},
+		{"una renta con regla de porcentaje no cobra", &models.ReglaComision{Porcentaje: numero(5)}, &cuentaRenta{Tipo: TransaccionRenta, Monto: numero(8000)}, 0},
+		{"sin regla", nil, &cuentaRenta{Tipo: TransaccionRenta, Monto: numero(8000)}, 0},
+		{"sin monto", &models.ReglaComision{Meses: numero(1)}, &cuentaRenta{Tipo: TransaccionRenta}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			if got := comisionTotal(tt.regla, tt.cuenta); got != tt.want {
+				t.Errorf("comisionTotal = %d, se esperaba %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepartir(t *testing.T) {
+	tests := []struct {
+		nombre   string
+		total    int64
+		regla    *models.ReglaComision
+		captador int64
+		cierre   int64
+	}{
+		{"mitad por defecto", 1000000, &models.ReglaComision{}, 500000, 500000},
+		{"sin regla también es mitad", 1000000, nil, 500000, 500000},
+		{"el centavo que sobra es del que cerró", 1001, nil, 501, 500},
+		{"porcentaje del captador", 1000000, &models.ReglaComision{PorcentajeCaptador: numero(30)}, 300000, 700000},
+		{"todo para el captador", 1000000, &models.ReglaComision{PorcentajeCaptador: numero(100)}, 1000000, 0},
+		{"tercios", 100, &models.ReglaComision{PorcentajeCaptador: numero(100.0 / 3)}, 33, 67},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			captador, cierre := repartir(tt.total, tt.regla)
+			if captador != tt.captador || cierre != tt.cierre {
+				t.Errorf("repartir = %d, %d; se esperaba %d, %d", captador, cierre, tt.captador, tt.cierre)
+			}
+			if captador+cierre != tt.total {
+				t.Errorf("el reparto suma %d, se esperaba %d", captador+cierre, tt.total)
+			}
+		})
+	}
+}
+
+func TestPeriodoMes(t *testing.T) {
+	tests := []struct {
+		nombre   string
+		filtro   models.FiltroPeriodo
+		periodo  string
+		desde    string
+		hasta    string
+		invalido bool
+	}{
+		{"febrero bisiesto", models.FiltroPeriodo{Anio: entero(2024), Mes: entero(2)}, "2024-02", "2024-02-01", "2024-02-29", false},
+		{"diciembre", models.FiltroPeriodo{Anio: entero(2025), Mes: entero(12)}, "2025-12", "2025-12-01", "2025-12-31", false},
+		{"solo el año", models.FiltroPeriodo{Anio: entero(2025)}, "", "", "", true},
+		{"mes fuera de rango", models.FiltroPeriodo{Anio: entero(2025), Mes: entero(13)}, "", "", "", true},
+		{"año fuera de rango", models.FiltroPeriodo{Anio: entero(1999), Mes: entero(1)}, "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			periodo, desde, hasta, err := periodoMes(&tt.filtro, time.UTC)
+			if tt.invalido {
+				if !errors.Is(err, ErrInvalidFilter) {
+					t.Fatalf("error = %v, se esperaba ErrInvalidFilter", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if periodo != tt.periodo || desde != tt.desde || hasta != tt.hasta {
+				t.Errorf("periodoMes = %s %s %s, se esperaba %s %s %s", periodo, desde, hasta, tt.periodo, tt.desde, tt.hasta)
+			}
+		})
+	}
+
+	// Sin año ni mes es el mes pasado en la zona del negocio
+	zona := time.FixedZone("-06:00", -6*3600)
+	y, m, _ := time.Now().In(zona).Date()
+	want := time.Date(y, m-1, 1, 0, 0, 0, 0, time.UTC).Format("2006-01")
+	if periodo, _, _, err := periodoMes(&models.FiltroPeriodo{}, zona); err != nil || periodo != want {
+		t.Errorf("sin filtro = %s, %v; se esperaba %s", periodo, err, want)
+	}
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"backend/internal/models"
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidContacto se regresa cuando el teléfono o el correo de un prospecto o propietario no son validos
+var ErrInvalidContacto = errors.New("invalid contact data")
+
+// Motivos por los que dos registros parecen la misma persona
+const (
+	MotivoDuplicadoCorreo   = "correo"
+	MotivoDuplicadoTelefono = "telefono"
+	MotivoDuplicadoNombre   = "nombre"
+)
+
+const (
+	similitudDuplicadoDefault = 70
+	duplicadosMax             = 200
+	// Dos nombres con menos parecido que esto no se reportan aunque compartan una palabra
+	parecidoNombreMinimo = 0.8
+)
+
+// normalizarTelefono deja el teléfono en E.164. Los números sin código de país se toman como de México y se aceptan
+// con los prefijos viejos (044, 045, 01 y el 1 de celulares después del 52); un número con + de otro país solo se
+// valida por longitud. Un teléfono vacío se queda vacío.
+func normalizarTelefono(telefono string) (string, error) {
+	telefono = strings.TrimSpace(telefono)
+	if telefono == "" {
+		return "", nil
+	}
+	var digitos strings.Builder
+	for _, r := range telefono {
+		switch {
+		case r >= '0' && r <= '9':
+			digitos.WriteRune(r)
+		case strings.ContainsRune(" -.()/+", r):
+		default:
+			return "", fmt.Errorf("%w: el teléfono %q tiene caracteres no validos", ErrInvalidContacto, telefono)
+		}
+	}
+	numero := digitos.String()
+
+	internacional := strings.HasPrefix(telefono, "+") || strings.HasPrefix(numero, "00")
+	numero = strings.TrimPrefix(numero, "00")
+	if internacional && !strings.HasPrefix(numero, "52") {
+		if len(numero) < 8 || len(numero) > 15 {
+			return "", fmt.Errorf("%w: el teléfono %q no es valido", ErrInvalidContacto, telefono)
+		}
+		return "+" + numero, nil
+	}
+
+	switch {
+	case internacional && len(numero) == 13 && strings.HasPrefix(numero, "521"):
+		numero = numero[3:]
+	case internacional:
+		numero = strings.TrimPrefix(numero, "52")
+	case len(numero) == 12 && strings.HasPrefix(numero, "52"):
+		numero = numero[2:]
+	case len(numero) == 13 && strings.HasPrefix(numero, "521"):
+		numero = numero[3:]
+	case len(numero) == 13 && (strings.HasPrefix(numero, "044") || strings.HasPrefix(numero, "045")):
+		numero = numero[3:]
+	case len(numero) == 12 && strings.HasPrefix(numero, "01"):
+		numero = numero[2:]
+	}
+	// Los números de México son de 10 dígitos y no empiezan con 0 ni 1
+	if len(numero) != 10 || numero[0] == '0' || numero[0] == '1' {
+		return "", fmt.Errorf("%w: el teléfono %q debe ser de 10 dígitos", ErrInvalidContacto, telefono)
+	}
+	return "+52" + numero, nil
+}
+
+// normalizarCorreo quita espacios y pasa el correo a minúsculas, un correo vacío se queda vacío
+func normalizarCorreo(correo string) (string, error) {
+	correo = strings.ToLower(strings.TrimSpace(correo))
+	if correo == "" {
+		return "", nil
+	}
+	direccion, err := mail.ParseAddress(correo)
+	if err != nil || direccion.Address != correo || !strings.Contains(correo[strings.LastIndex(correo, "@"):], ".") {
+		return "", fmt.Errorf("%w: el correo %q no es valido", ErrInvalidContacto, correo)
+	}
+	return correo, nil
+}
+
+// normalizarContacto normaliza el teléfono y el correo en su lugar
+func normalizarContacto(telefono, correo *string) error {
+	var err error
+	if *telefono, err = normalizarTelefono(*telefono); err != nil {
+		return err
+	}
+	*correo, err = normalizarCorreo(*correo)
+	return err
+}
+
+// contacto es un prospecto o propietario que se compara para buscar duplicados
+type contacto struct {
+	ID       int
+	Nombre   string
+	Telefono string
+	Correo   string
+}
+
+// claveTelefono compara teléfonos capturados antes de la normalización, si no es valido usa los últimos 10 dígitos
+func claveTelefono(telefono string) string {
+	if normalizado, err := normalizarTelefono(telefono); err == nil {
+		return normalizado
+	}
+	digitos := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, telefono)
+	if len(digitos) < 10 {
+		// Un número incompleto como 555-1234 no alcanza para decir que es la misma persona
+		return ""
+	}
+	return "+52" + digitos[len(digitos)-10:]
+}
+
+// distancia es la distancia de Levenshtein entre dos textos
+func distancia(a, b []rune) int {
+	anterior := make([]int, len(b)+1)
+	actual := make([]int, len(b)+1)
+	for j := range anterior {
+		anterior[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		actual[0] = i
+		for j := 1; j <= len(b); j++ {
+			costo := 1
+			if a[i-1] == b[j-1] {
+				costo = 0
+			}
+			actual[j] = min(anterior[j]+1, actual[j-1]+1, anterior[j-1]+costo)
+		}
+		anterior, actual = actual, anterior
+	}
+	return anterior[len(b)]
+}
+
+// parecido es de 0 a 1, 1 si los textos son iguales
+func parecido(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	largo := max(len(ra), len(rb))
+	if largo == 0 {
+		return 0
+	}
+	return 1 - float64(distancia(ra, rb))/float64(largo)
+}
+
+// parecidoNombre compara los nombres normalizados tal cual y con las palabras ordenadas,
+// así "Garcia Lopez Carlos" y "Carlos Garcia Lopez" quedan iguales
+func parecidoNombre(a, b []string) float64 {
+	ordenadoA := append([]string(nil), a...)
+	ordenadoB := append([]string(nil), b...)
+	sort.Strings(ordenadoA)
+	sort.Strings(ordenadoB)
+	return max(parecido(strings.Join(a, " "), strings.Join(b, " ")),
+		parecido(strings.Join(ordenadoA, " "), strings.Join(ordenadoB, " ")))
+}
+
+// buscarDuplicados regresa los pares de registros que parecen la misma persona, de más a menos parecidos.
+// El correo y el teléfono se comparan ya normalizados; los nombres solo se comparan entre registros que comparten
+// alguna palabra del nombre para no comparar todos contra todos. Si id no es nil solo regresa los pares de ese registro.
+func buscarDuplicados(contactos []contacto, id *int, minimo int) []*models.ParDuplicados {
+	type par struct {
+		i, j      int
+		similitud int
+		motivos   []string
+	}
+	pares := map[[2]int]*par{}
+	var orden [][2]int
+	agregar := func(i, j int, motivo string, similitud int) {
+		if i > j {
+			i, j = j, i
+		}
+		if id != nil && contactos[i].ID != *id && contactos[j].ID != *id {
+			return
+		}
+		clave := [2]int{i, j}
+		p, ok := pares[clave]
+		if !ok {
+			p = &par{i: i, j: j}
+			pares[clave] = p
+			orden = append(orden, clave)
+		}
+		for _, m := range p.motivos {
+			if m == motivo {
+				return
+			}
+		}
+		p.motivos = append(p.motivos, motivo)
+		if len(p.motivos) > 1 {
+			// Coincidir en más de una cosa sube la similitud
+			p.similitud = min(100, max(p.similitud, similitud)+5)
+		} else {
+			p.similitud = similitud
+		}
+	}
+
+	porCorreo := map[string][]int{}
+	porTelefono := map[string][]int{}
+	porPalabra := map[string][]int{}
+	nombres := make([][]string, len(contactos))
+	for i, c := range contactos {
+		if correo := strings.ToLower(strings.TrimSpace(c.Correo)); correo != "" {
+			porCorreo[correo] = append(porCorreo[correo], i)
+		}
+		if telefono := claveTelefono(c.Telefono); telefono != "" {
+			porTelefono[telefono] = append(porTelefono[telefono], i)
+		}
+		nombres[i] = strings.Fields(normalizarTexto(c.Nombre))
+		for _, palabra := range nombres[i] {
+			if len(palabra) >= 3 {
+				porPalabra[palabra] = append(porPalabra[palabra], i)
+			}
+		}
+	}
+
+	for _, grupo := range porCorreo {
+		for a := 0; a < len(grupo); a++ {
+			for b := a + 1; b < len(grupo); b++ {
+				agregar(grupo[a], grupo[b], MotivoDuplicadoCorreo, 100)
+			}
+		}
+	}
+	for _, grupo := range porTelefono {
+		for a := 0; a < len(grupo); a++ {
+			for b := a + 1; b < len(grupo); b++ {
+				agregar(grupo[a], grupo[b], MotivoDuplicadoTelefono, 95)
+			}
+		}
+	}
+	comparados := map[[2]int]bool{}
+	for _, grupo := range porPalabra {
+		for a := 0; a < len(grupo); a++ {
+			for b := a + 1; b < len(grupo); b++ {
+				i, j := grupo[a], grupo[b]
+				if i == j || comparados[[2]int{i, j}] {
+					continue
+				}
+				comparados[[2]int{i, j}] = true
+				if p := parecidoNombre(nombres[i], nombres[j]); p >= parecidoNombreMinimo {
+					agregar(i, j, MotivoDuplicadoNombre, int(math.Round(p*90)))
+				}
+			}
+		}
+	}
+
+	resultado := []*models.ParDuplicados{}
+	for _, clave := range orden {
+		p := pares[clave]
+		if p.similitud < minimo {
+			continue
+		}
+		registros := []models.ContactoDuplicado{}
+		for _, k := range []int{p.i, p.j} {
+			c := contactos[k]
+			registros = append(registros, models.ContactoDuplicado{ID: c.ID, Nombre: c.Nombre, Telefono: c.Telefono, Correo: c.Correo})
+		}
+		resultado = append(resultado, &models.ParDuplicados{Registros: registros, Similitud: p.similitud, Motivos: p.motivos})
+	}
+	sort.SliceStable(resultado, func(a, b int) bool {
+		if resultado[a].Similitud != resultado[b].Similitud {
+			return resultado[a].Similitud > resultado[b].Similitud
+		}
+		return resultado[a].Registros[0].ID < resultado[b].Registros[0].ID
+	})
+	if len(resultado) > duplicadosMax {
+		resultado = resultado[:duplicadosMax]
+	}
+	return resultado
+}
+
+// normalizarFiltroDuplicados valida la similitud mínima, 70 por defecto
+func normalizarFiltroDuplicados(filtro *models.FiltroDuplicados) (int, error) {
+	minimo := similitudDuplicadoDefault
+	if filtro.Minimo != nil {
+		minimo = *filtro.Minimo
+	}
+	if minimo < 0 || minimo > 100 {
+		return 0, fmt.Errorf("%w: minimo debe estar entre 0 y 100", ErrInvalidFilter)
+	}
+	return minimo, nil
+}
+
+// primeroNoVacio se usa al fusionar, el registro que se conserva se queda con sus datos y solo llena los que le faltan
+func primeroNoVacio(valores ...string) string {
+	for _, v := range valores {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
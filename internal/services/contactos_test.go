@@ -0,0 +1,132 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestNormalizarTelefono(t *testing.T) {
+	tests := []struct {
+		telefono string
+		want     string
+		invalido bool
+	}{
+		{"55 1234 5678", "+525512345678", false},
+		{"(55) 1234-5678", "+525512345678", false},
+		{"+52 55 1234 5678", "+525512345678", false},
+		{"+52 1 55 1234 5678", "+525512345678", false},
+		{"52 1 55 1234 5678", "+525512345678", false},
+		{"52 55 1234 5678", "+525512345678", false},
+		{"0052 55 1234 5678", "+525512345678", false},
+		{"044 55 1234 5678", "+525512345678", false},
+		{"045 222 123 4567", "+522221234567", false},
+		{"01 222 123 4567", "+522221234567", false},
+		{"+1 212 555 0100", "+12125550100", false},
+		{"0044 20 7946 0958", "+442079460958", false},
+		{"  ", "", false},
+		{"555-1234", "", true},
+		{"1234567890", "", true},
+		{"0 55 1234 5678", "", true},
+		{"+52 1 55 1234 567", "", true},
+		{"+1 234", "", true},
+		{"55 1234 5678 ext 1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.telefono, func(t *testing.T) {
+			got, err := normalizarTelefono(tt.telefono)
+			if tt.invalido {
+				if !errors.Is(err, ErrInvalidContacto) {
+					t.Fatalf("normalizarTelefono = %q, %v; se esperaba ErrInvalidContacto", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("normalizarTelefono = %q, %v; se esperaba %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizarCorreo(t *testing.T) {
+	tests := []struct {
+		correo   string
+		want     string
+		invalido bool
+	}{
+		{" Ana.Lopez@Correo.COM ", "ana.lopez@correo.com", false},
+		{"", "", false},
+		{"ana@correo", "", true},
+		{"Ana <ana@correo.com>", "", true},
+		{"ana", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizarCorreo(tt.correo)
+		if tt.invalido != errors.Is(err, ErrInvalidContacto) || got != tt.want {
+			t.Errorf("normalizarCorreo(%q) = %q, %v; se esperaba %q", tt.correo, got, err, tt.want)
+		}
+	}
+}
+
+func TestBuscarDuplicados(t *testing.T) {
+	contactos := []contacto{
+		{ID: 1, Nombre: "Carlos García López", Telefono: "55 1234 5678", Correo: "carlos@correo.com"},
+		// Mismo correo con otras mayúsculas y el teléfono con el 1 de celular
+		{ID: 2, Nombre: "Carlos Garcia Lopez", Telefono: "+52 1 55 1234 5678", Correo: "CARLOS@correo.com"},
+		// Los apellidos primero
+		{ID: 3, Nombre: "López García Carlos"},
+		// Un teléfono incompleto no cuenta, y comparte "lopez" con los de arriba sin parecerse
+		{ID: 4, Nombre: "Mario Lopez", Telefono: "555-1234"},
+		{ID: 5, Nombre: "Ana Ramírez", Telefono: "044 55 9876 5432"},
+		// Mismo teléfono capturado en otro formato, nombre distinto
+		{ID: 6, Nombre: "Ana Torres", Telefono: "55 9876 5432"},
+		{ID: 7, Nombre: "Mario Lopes", Telefono: "555-1234"},
+	}
+	resumen := func(pares []*parDuplicadosResumen) []string {
+		var out []string
+		for _, p := range pares {
+			out = append(out, p.String())
+		}
+		return out
+	}
+	id3 := 3
+	tests := []struct {
+		nombre string
+		id     *int
+		minimo int
+		want   []string
+	}{
+		{"todos los pares", nil, 70, []string{
+			"1-2 100 [correo telefono nombre]",
+			"5-6 95 [telefono]",
+			"1-3 90 [nombre]",
+			"2-3 90 [nombre]",
+			"4-7 82 [nombre]",
+		}},
+		{"solo los de un registro", &id3, 70, []string{"1-3 90 [nombre]", "2-3 90 [nombre]"}},
+		{"similitud mínima", nil, 91, []string{"1-2 100 [correo telefono nombre]", "5-6 95 [telefono]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			var pares []*parDuplicadosResumen
+			for _, p := range buscarDuplicados(contactos, tt.id, tt.minimo) {
+				pares = append(pares, &parDuplicadosResumen{p.Registros[0].ID, p.Registros[1].ID, p.Similitud, p.Motivos})
+			}
+			if got := resumen(pares); !slices.Equal(got, tt.want) {
+				t.Errorf("buscarDuplicados = %q, se esperaba %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// parDuplicadosResumen deja un par en una línea para compararlo en las pruebas
+type parDuplicadosResumen struct {
+	a, b      int
+	similitud int
+	motivos   []string
+}
+
+func (p *parDuplicadosResumen) String() string {
+	return fmt.Sprintf("%d-%d %d %v", p.a, p.b, p.similitud, p.motivos)
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"backend/internal/scheduler"
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+)
+
+const intentosAvisoAdeudo = 5
+
+// AdeudosRentaService genera los cargos de los contratos de renta (rentas, depósito y recargos) y le manda al inquilino
+// un aviso de adeudo por cada cargo que pasa los días de gracia sin pagarse completo. Cada cargo se avisa una sola vez.
+type AdeudosRentaService struct {
+	DB          *sql.DB
+	Email       *EmailService
+	ZonaDefault *time.Location
+}
+
+// Constructor para AdeudosRentaService
+func NewAdeudosRentaService(db *sql.DB, email *EmailService, zonaDefault *time.Location) *AdeudosRentaService {
+	return &AdeudosRentaService{
+		DB:          db,
+		Email:       email,
+		ZonaDefault: zonaDefault,
+	}
+}
+
+// Ejecutar pone al día los cargos de cada contrato de renta y manda los avisos, lo llama el scheduler cada hora
+func (service *AdeudosRentaService) Ejecutar() error {
+	// Los que se quedaron en 'enviando' por un reinicio se vuelven a mandar
+	if err := service.bandeja().Liberar(); err != nil {
+		return err
+	}
+
+	cuentas, err := getCuentas(service.DB, "Contratos.tipo = ? AND Contratos.estado <> ? AND Contratos.fecha_inicio IS NOT NULL AND Contratos.monto IS NOT NULL",
+		TransaccionRenta, EstadoContratoBorrador)
+	if err != nil {
+		return err
+	}
+	hoy := hoyContrato(service.ZonaDefault)
+	for _, cuenta := range cuentas {
+		if err := generarCargos(service.DB, cuenta, hoy, service.ZonaDefault); err != nil {
+			return err
+		}
+		aplicarPagos(cuenta.Cargos, cuenta.Pagos, hoy, "")
+		if err := service.programar(cuenta, hoy); err != nil {
+			return err
+		}
+		service.enviar(cuenta)
+	}
+	return nil
+}
+
+// programar encola un aviso por cada renta o depósito que sigue sin pagarse después de los días de gracia
+// y cancela los pendientes de los cargos que ya se pagaron
+func (service *AdeudosRentaService) programar(cuenta *cuentaRenta, hoy string) error {
+	var ids []string
+	for _, cargo := range cuenta.Cargos {
+		if cargo.Tipo == CargoRecargo || cargo.Saldo <= 0 || hoy <= sumarDias(cargo.FechaVencimiento, cuenta.DiasGracia) {
+			continue
+		}
+		ids = append(ids, fmt.Sprint(cargo.IDCargo))
+	}
+
+	// Los ids son enteros que salieron de la base, no hay nada que escapar
+	query := "UPDATE Avisos_Adeudo SET estado = 'cancelado' WHERE id_contrato = ? AND estado = 'pendiente'"
+	if len(ids) > 0 {
+		query += " AND id_cargo NOT IN (" + strings.Join(ids, ",") + ")"
+	}
+	if _, err := service.DB.Exec(query, cuenta.IDContrato); err != nil {
+		log.Println("Error cancelling avisos de adeudo:", err)
+		return err
+	}
+	// Sin correo del inquilino no hay a quién avisar, el adeudo sale en la cartera vencida
+	if cuenta.Correo == "" {
+		return nil
+	}
+	for _, id := range ids {
+		query := `INSERT IGNORE INTO Avisos_Adeudo (id_cargo, id_contrato, estado, intentos, creado_en)
+			VALUES (?, ?, 'pendiente', 0, ?)`
+		if _, err := service.DB.Exec(query, id, cuenta.IDContrato, time.Now().UTC()); err != nil {
+			log.Println("Error scheduling aviso de adeudo:", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// enviar reclama los avisos pendientes del contrato y le manda al inquilino un solo correo con todo lo que debe
+func (service *AdeudosRentaService) enviar(cuenta *cuentaRenta) {
+	rows, err := service.DB.Query("SELECT id_aviso FROM Avisos_Adeudo WHERE id_contrato = ? AND estado = 'pendiente'", cuenta.IDContrato)
+	if err != nil {
+		log.Println("Error fetching avisos de adeudo:", err)
+		return
+	}
+	var pendientes []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Println("Error scanning aviso de adeudo:", err)
+			return
+		}
+		pendientes = append(pendientes, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return
+	}
+	if len(pendientes) == 0 || cuenta.Correo == "" {
+		return
+	}
+
+	scheduler.Enviar(service.bandeja(), pendientes, func(id int) int { return id }, func([]int) (string, error) {
+		asunto, cuerpo := mensajeAdeudo(cuenta)
+		return cuenta.Correo, service.Email.SendHTML(cuenta.Correo, asunto, cuerpo)
+	})
+}
+
+func (service *AdeudosRentaService) bandeja() *scheduler.Bandeja {
+	return bandejaCorreos(service.DB, "Avisos_Adeudo", "id_aviso", "correo", intentosAvisoAdeudo)
+}
+
+// mensajeAdeudo arma el correo con los cargos vencidos del contrato (después de aplicarPagos) y el total
+func mensajeAdeudo(cuenta *cuentaRenta) (string, string) {
+	var filas strings.Builder
+	for _, cargo := range cuenta.Cargos {
+		if cargo.Estado != "vencido" {
+			continue
+		}
+		fmt.Fprintf(&filas, "<tr><td>%s</td><td>%s</td><td>$%.2f</td><td>$%.2f</td></tr>",
+			html.EscapeString(cargo.Concepto), cargo.FechaVencimiento, cargo.Monto, cargo.Saldo)
+	}
+	vencido, _, _ := resumenAtraso(cuenta.Cargos)
+
+	contacto := ""
+	if cuenta.Usuario != "" {
+		contacto = " con tu agente (" + html.EscapeString(cuenta.Usuario) + ")"
+	}
+	asunto := "Aviso de adeudo: " + cuenta.Titulo
+	cuerpo := fmt.Sprintf(`<html><body><p>Hola %s,</p>
+<p>Del contrato %s de %s tienes estos pagos vencidos:</p>
+<table border="1" cellpadding="4" cellspacing="0"><tr><th>Concepto</th><th>Venció</th><th>Monto</th><th>Saldo</th></tr>%s</table>
+<p>Total vencido: <b>$%.2f</b></p>
+<p>Si ya pagaste, comunícate%s para que se registre tu pago.</p>
+</body></html>`, html.EscapeString(cuenta.Inquilino), html.EscapeString(cuenta.Titulo), html.EscapeString(cuenta.Propiedad),
+		filas.String(), vencido, contacto)
+	return asunto, cuerpo
+}
@@ -0,0 +1,416 @@
+package services
+
+import (
+	"backend/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Estados del contrato. Borrador y firmado se cambian a mano (o al firmar todas las partes),
+// vigente y vencido los pone el scheduler según las fechas.
+const (
+	EstadoContratoBorrador   = "borrador"
+	EstadoContratoFirmado    = "firmado"
+	EstadoContratoVigente    = "vigente"
+	EstadoContratoVencido    = "vencido"
+	EstadoContratoRescindido = "rescindido"
+)
+
+// Roles de las partes del contrato
+const (
+	ParteContratoPropietario = "propietario"
+	ParteContratoCliente     = "cliente"
+	ParteContratoFiador      = "fiador"
+)
+
+var (
+	ErrInvalidContrato = errors.New("invalid contrato")
+	ErrEstadoContrato  = errors.New("contract state does not allow the change")
+)
+
+const (
+	// Se avisa al agente de los contratos que terminan en los próximos días
+	diasAvisoVencimiento = 60
+	diasPorVencerMaximo  = 365
+)
+
+// cambiaTermino indica si se mandó un término distinto al guardado, nil es que no se mandó
+func cambiaTermino[T comparable](nuevo, actual *T) bool {
+	return nuevo != nil && (actual == nil || *nuevo != *actual)
+}
+
+// validarTerminos revisa el formato de las fechas y que los importes tengan sentido, una fecha vacía cuenta como no mandada
+func validarTerminos(contrato *models.Contrato) error {
+	fechas := map[string]**string{"fecha_inicio": &contrato.FechaInicio, "fecha_fin": &contrato.FechaFin}
+	for _, campo := range []string{"fecha_inicio", "fecha_fin"} {
+		fecha := fechas[campo]
+		if *fecha == nil {
+			continue
+		}
+		valor := strings.TrimSpace(**fecha)
+		if valor == "" {
+			*fecha = nil
+			continue
+		}
+		if _, err := time.Parse(formatoFecha, valor); err != nil {
+			return fmt.Errorf("%w: %s debe tener el formato YYYY-MM-DD", ErrInvalidContrato, campo)
+		}
+		*fecha = &valor
+	}
+	if contrato.FechaInicio != nil && contrato.FechaFin != nil && *contrato.FechaFin <= *contrato.FechaInicio {
+		return fmt.Errorf("%w: fecha_fin debe ser después de fecha_inicio", ErrInvalidContrato)
+	}
+	if contrato.Monto != nil && *contrato.Monto <= 0 {
+		return fmt.Errorf("%w: monto debe ser mayor a 0", ErrInvalidContrato)
+	}
+	if contrato.Deposito != nil && *contrato.Deposito < 0 {
+		return fmt.Errorf("%w: deposito no puede ser negativo", ErrInvalidContrato)
+	}
+	if contrato.DiasGracia != nil && (*contrato.DiasGracia < 0 || *contrato.DiasGracia > diasGraciaMaximo) {
+		return fmt.Errorf("%w: dias_gracia debe estar entre 0 y %d", ErrInvalidContrato, diasGraciaMaximo)
+	}
+	if contrato.RecargoFijo != nil && *contrato.RecargoFijo < 0 {
+		return fmt.Errorf("%w: recargo_fijo no puede ser negativo", ErrInvalidContrato)
+	}
+	if contrato.RecargoPorcentaje != nil && (*contrato.RecargoPorcentaje < 0 || *contrato.RecargoPorcentaje > 100) {
+		return fmt.Errorf("%w: recargo_porcentaje debe estar entre 0 y 100", ErrInvalidContrato)
+	}
+	return nil
+}
+
+// validarParaFirma revisa que el contrato tenga todo lo que se firma: tipo, partes y términos
+func validarParaFirma(contrato *models.Contrato, partes []*models.ParteContrato) error {
+	var faltan []string
+	if contrato.Tipo != TransaccionRenta && contrato.Tipo != TransaccionVenta {
+		faltan = append(faltan, "tipo (renta o venta)")
+	}
+	if contrato.FechaInicio == nil {
+		faltan = append(faltan, "fecha_inicio")
+	}
+	if contrato.FechaFin == nil && contrato.Tipo == TransaccionRenta {
+		faltan = append(faltan, "fecha_fin")
+	}
+	if contrato.Monto == nil {
+		faltan = append(faltan, "monto")
+	}
+	for _, rol := range []string{ParteContratoPropietario, ParteContratoCliente} {
+		if !slices.ContainsFunc(partes, func(p *models.ParteContrato) bool { return p.Rol == rol }) {
+			faltan = append(faltan, "parte "+rol)
+		}
+	}
+	if len(faltan) > 0 {
+		return fmt.Errorf("%w: para firmar falta %s", ErrEstadoContrato, strings.Join(faltan, ", "))
+	}
+	if contrato.FechaFin != nil && *contrato.FechaFin <= *contrato.FechaInicio {
+		return fmt.Errorf("%w: fecha_fin debe ser después de fecha_inicio", ErrInvalidContrato)
+	}
+	return nil
+}
+
+// estadoPorFechas es el estado de un contrato firmado según el día de hoy (YYYY-MM-DD)
+func estadoPorFechas(inicio, fin *string, hoy string) string {
+	switch {
+	case fin != nil && *fin < hoy:
+		return EstadoContratoVencido
+	case inicio != nil && *inicio <= hoy:
+		return EstadoContratoVigente
+	}
+	return EstadoContratoFirmado
+}
+
+// hoyContrato es la fecha de hoy en la zona del negocio, las fechas de los contratos no tienen hora
+func hoyContrato(zona *time.Location) string {
+	return time.Now().In(zona).Format(formatoFecha)
+}
+
+// getPartes regresa las partes del contrato en orden de rol: propietario, cliente y fiador
+func getPartes(db queryer, id int) ([]*models.ParteContrato, error) {
+	query := `SELECT id_parte, rol, id_propietario, id_cliente, nombre, correo, telefono
+		FROM Partes_Contrato WHERE id_contrato = ? ORDER BY FIELD(rol, 'propietario', 'cliente', 'fiador'), id_parte`
+	rows, err := db.Query(query, id)
+	if err != nil {
+		log.Println("Error fetching partes del contrato:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	partes := []*models.ParteContrato{}
+	for rows.Next() {
+		var p models.ParteContrato
+		var idPropietario, idCliente sql.NullInt64
+		var correo, telefono sql.NullString
+		if err := rows.Scan(&p.IDParte, &p.Rol, &idPropietario, &idCliente, &p.Nombre, &correo, &telefono); err != nil {
+			log.Println("Error scanning parte del contrato:", err)
+			return nil, err
+		}
+		if idPropietario.Valid {
+			v := int(idPropietario.Int64)
+			p.IDPropietario = &v
+		}
+		if idCliente.Valid {
+			v := int(idCliente.Int64)
+			p.IDCliente = &v
+		}
+		p.Correo, p.Telefono = correo.String, telefono.String
+		partes = append(partes, &p)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return partes, nil
+}
+
+// completarParte valida la parte y llena el nombre y el contacto que no se mandaron con los del propietario o prospecto ligado
+func completarParte(tx *sql.Tx, parte *models.ParteContrato, idPropietarioPropiedad sql.NullInt64) error {
+	var nombre, apellidoP, apellidoM, telefono, correo sql.NullString
+	var query string
+	var id int
+	switch parte.Rol {
+	case ParteContratoPropietario:
+		if parte.IDCliente != nil {
+			return fmt.Errorf("%w: el propietario no lleva id_cliente", ErrInvalidContrato)
+		}
+		// Sin datos se toma el propietario de la propiedad
+		if parte.IDPropietario == nil && strings.TrimSpace(parte.Nombre) == "" && idPropietarioPropiedad.Valid {
+			v := int(idPropietarioPropiedad.Int64)
+			parte.IDPropietario = &v
+		}
+		if parte.IDPropietario != nil {
+			id = *parte.IDPropietario
+			query = `SELECT nombre_propietario, apellido_paterno_propietario, apellido_materno_propietario, telefono_propietario, correo_propietario
+				FROM Propietario WHERE id_propietario = ?`
+		}
+	case ParteContratoCliente:
+		if parte.IDPropietario != nil {
+			return fmt.Errorf("%w: el cliente no lleva id_propietario", ErrInvalidContrato)
+		}
+		if parte.IDCliente != nil {
+			id = *parte.IDCliente
+			query = `SELECT nombre_prospecto, apellido_paterno_prospecto, apellido_materno_prospecto, telefono_prospecto, correo_prospecto
+				FROM Prospecto WHERE id_cliente = ?`
+		}
+	case ParteContratoFiador:
+		if parte.IDPropietario != nil || parte.IDCliente != nil {
+			return fmt.Errorf("%w: el fiador no se liga a un propietario ni a un prospecto", ErrInvalidContrato)
+		}
+	default:
+		return fmt.Errorf("%w: rol debe ser propietario, cliente o fiador", ErrInvalidContrato)
+	}
+
+	if query != "" {
+		if err := tx.QueryRow(query, id).Scan(&nombre, &apellidoP, &apellidoM, &telefono, &correo); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("%w: el %s %d no existe", ErrInvalidContrato, parte.Rol, id)
+			}
+			log.Println("Error fetching parte del contrato:", err)
+			return err
+		}
+		parte.Nombre = primeroNoVacio(strings.TrimSpace(parte.Nombre), nombreCompleto(nombre.String, apellidoP.String, apellidoM.String))
+		parte.Telefono = primeroNoVacio(parte.Telefono, telefono.String)
+		parte.Correo = primeroNoVacio(parte.Correo, correo.String)
+	}
+	parte.Nombre = strings.TrimSpace(parte.Nombre)
+	if parte.Nombre == "" {
+		return fmt.Errorf("%w: el %s necesita nombre", ErrInvalidContrato, parte.Rol)
+	}
+	return normalizarContacto(&parte.Telefono, &parte.Correo)
+}
+
+// PUT /contratos/:id/partes
+// Funcion que reemplaza las partes del contrato, solo mientras es borrador. Hay a lo más una parte por rol.
+func (service *ContratosService) SetPartes(id int, partes []*models.ParteContrato) ([]*models.ParteContrato, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error iniciando transacción:", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var estado string
+	var idPropietario sql.NullInt64
+	query := `SELECT Contratos.estado, Propiedades.id_propietario FROM Contratos
+		INNER JOIN Propiedades ON Propiedades.id_propiedad = Contratos.id_propiedad
+		WHERE Contratos.id_contrato = ? FOR UPDATE`
+	if err := tx.QueryRow(query, id).Scan(&estado, &idPropietario); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		log.Println("Error recuperando el contrato:", err)
+		return nil, err
+	}
+	if estado != EstadoContratoBorrador {
+		return nil, fmt.Errorf("%w: el contrato está %s, sus partes ya no cambian", ErrEstadoContrato, estado)
+	}
+	if err := verificarSinFirmas(tx, id); err != nil {
+		return nil, err
+	}
+
+	roles := map[string]bool{}
+	for _, parte := range partes {
+		if parte == nil {
+			return nil, fmt.Errorf("%w: parte vacía", ErrInvalidContrato)
+		}
+		if roles[parte.Rol] {
+			return nil, fmt.Errorf("%w: solo puede haber un %s", ErrInvalidContrato, parte.Rol)
+		}
+		roles[parte.Rol] = true
+		if err := completarParte(tx, parte, idPropietario); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM Partes_Contrato WHERE id_contrato = ?", id); err != nil {
+		log.Println("Error eliminando partes del contrato:", err)
+		return nil, err
+	}
+	for _, parte := range partes {
+		query := `INSERT INTO Partes_Contrato (id_contrato, rol, id_propietario, id_cliente, nombre, correo, telefono)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`
+		_, err := tx.Exec(query, id, parte.Rol, parte.IDPropietario, parte.IDCliente, parte.Nombre, nullIfEmpty(parte.Correo), nullIfEmpty(parte.Telefono))
+		if err != nil {
+			log.Println("Error insertando parte del contrato:", err)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error confirmando transacción:", err)
+		return nil, err
+	}
+	return getPartes(service.DB, id)
+}
+
+// firmarContrato pasa a firmado (o directo a vigente o vencido según las fechas) un borrador bloqueado en la transacción
+func firmarContrato(tx *sql.Tx, contrato *models.Contrato, hoy string) error {
+	partes, err := getPartes(tx, contrato.IDContrato)
+	if err != nil {
+		return err
+	}
+	if err := validarParaFirma(contrato, partes); err != nil {
+		return err
+	}
+	contrato.Estado = estadoPorFechas(contrato.FechaInicio, contrato.FechaFin, hoy)
+	query := "UPDATE Contratos SET estado = ?, firmado_en = ? WHERE id_contrato = ?"
+	if _, err := tx.Exec(query, contrato.Estado, time.Now().UTC(), contrato.IDContrato); err != nil {
+		log.Println("Error firmando contrato:", err)
+		return err
+	}
+	return nil
+}
+
+// PUT /contratos/:id/estado
+// Funcion que firma un borrador o rescinde un contrato firmado o vigente. Vigente y vencido no se ponen a mano,
+// los pone el scheduler con las fechas del contrato.
+func (service *ContratosService) CambiarEstado(id int, cambio *models.CambioEstadoContrato) (*models.Contrato, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error iniciando transacción:", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	contrato, err := scanContrato(tx.QueryRow("SELECT "+columnasContrato+" FROM Contratos WHERE id_contrato = ? FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		log.Println("Error recuperando el contrato:", err)
+		return nil, err
+	}
+
+	switch cambio.Estado {
+	case EstadoContratoFirmado:
+		if contrato.Estado != EstadoContratoBorrador {
+			return nil, fmt.Errorf("%w: solo se firma un borrador y el contrato está %s", ErrEstadoContrato, contrato.Estado)
+		}
+		// Si se mandó a firmar en línea, pasa a firmado cuando firma la última parte
+		if err := verificarSinFirmas(tx, id); err != nil {
+			return nil, err
+		}
+		if err := firmarContrato(tx, contrato, hoyContrato(service.ZonaDefault)); err != nil {
+			return nil, err
+		}
+	case EstadoContratoRescindido:
+		if contrato.Estado != EstadoContratoFirmado && contrato.Estado != EstadoContratoVigente {
+			return nil, fmt.Errorf("%w: solo se rescinde un contrato firmado o vigente y está %s", ErrEstadoContrato, contrato.Estado)
+		}
+		motivo := strings.TrimSpace(cambio.Motivo)
+		if motivo == "" {
+			return nil, fmt.Errorf("%w: motivo es obligatorio al rescindir", ErrInvalidContrato)
+		}
+		query := "UPDATE Contratos SET estado = ?, rescindido_en = ?, motivo_rescision = ? WHERE id_contrato = ?"
+		if _, err := tx.Exec(query, EstadoContratoRescindido, time.Now().UTC(), truncate(motivo, 255), id); err != nil {
+			log.Println("Error rescindiendo contrato:", err)
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: estado debe ser firmado o rescindido, vigente y vencido cambian solos con las fechas", ErrInvalidContrato)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error confirmando transacción:", err)
+		return nil, err
+	}
+	return service.GetContrato(id)
+}
+
+// GET /contratos/por-vencer?dias=60&usuario=
+// Funcion que regresa los contratos firmados o vigentes que terminan en los próximos días, del que vence primero al último
+func (service *ContratosService) GetPorVencer(filtro *models.FiltroPorVencer) ([]*models.ContratoPorVencer, error) {
+	dias := diasAvisoVencimiento
+	if filtro.Dias != nil {
+		dias = *filtro.Dias
+	}
+	if dias < 0 || dias > diasPorVencerMaximo {
+		return nil, fmt.Errorf("%w: dias debe estar entre 0 y %d", ErrInvalidFilter, diasPorVencerMaximo)
+	}
+
+	hoy := hoyContrato(service.ZonaDefault)
+	conditions := []string{"Contratos.estado IN (?, ?)", "Contratos.fecha_fin BETWEEN ? AND ? + INTERVAL ? DAY"}
+	args := []interface{}{EstadoContratoFirmado, EstadoContratoVigente, hoy, hoy, dias}
+	if filtro.Usuario != "" {
+		conditions = append(conditions, "Propiedades.usuario = ?")
+		args = append(args, filtro.Usuario)
+	}
+	query := `SELECT Contratos.id_contrato, Contratos.titulo_contrato, Contratos.tipo, Propiedades.titulo, Contratos.estado, Contratos.fecha_fin,
+			Contratos.id_propiedad, Propiedades.usuario,
+			(SELECT Partes_Contrato.nombre FROM Partes_Contrato WHERE Partes_Contrato.id_contrato = Contratos.id_contrato AND Partes_Contrato.rol = 'cliente')
+		FROM Contratos
+		INNER JOIN Propiedades ON Propiedades.id_propiedad = Contratos.id_propiedad` + whereClause(conditions) +
+		" ORDER BY Contratos.fecha_fin, Contratos.id_contrato"
+	rows, err := service.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching contratos por vencer:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	inicioHoy, _ := time.Parse(formatoFecha, hoy)
+	contratos := []*models.ContratoPorVencer{}
+	for rows.Next() {
+		var c models.ContratoPorVencer
+		var titulo, tipo, tituloPropiedad, usuario, cliente sql.NullString
+		var fin time.Time
+		err := rows.Scan(&c.IDContrato, &titulo, &tipo, &tituloPropiedad, &c.Estado, &fin, &c.IDPropiedad, &usuario, &cliente)
+		if err != nil {
+			log.Println("Error scanning contrato por vencer:", err)
+			return nil, err
+		}
+		c.TituloContrato, c.Tipo, c.TituloPropiedad = titulo.String, tipo.String, tituloPropiedad.String
+		c.FechaFin = fechaContrato(sql.NullTime{Time: fin, Valid: true})
+		c.Usuario, c.Cliente = usuario.String, cliente.String
+		c.DiasRestantes = int(fin.Sub(inicioHoy).Hours() / 24)
+		contratos = append(contratos, &c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return contratos, nil
+}
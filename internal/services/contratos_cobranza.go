@@ -0,0 +1,759 @@
+package services
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tipos de cargo de la cobranza de rentas
+const (
+	CargoRenta    = "renta"
+	CargoDeposito = "deposito"
+	CargoRecargo  = "recargo"
+)
+
+// Formas de pago que se registran
+const (
+	PagoEfectivo      = "efectivo"
+	PagoTransferencia = "transferencia"
+	PagoTarjeta       = "tarjeta"
+)
+
+const (
+	// Días después del vencimiento de la renta antes de cobrar el recargo y mandar el aviso de adeudo
+	diasGraciaDefault = 5
+	diasGraciaMaximo  = 31
+)
+
+var ErrInvalidCobranza = errors.New("invalid ledger entry")
+
+// rangosAtraso son los cortes de la antigüedad de la cartera vencida, de 30 en 30 días de atraso
+var rangosAtraso = []string{"1-30", "31-60", "61-90", "90+"}
+
+// centavos evita los errores de redondeo de float64 al sumar importes
+func centavos(monto float64) int64 {
+	return int64(math.Round(monto * 100))
+}
+
+func pesos(centavos int64) float64 {
+	return float64(centavos) / 100
+}
+
+// agregarMeses suma meses a la fecha sin brincarse al mes siguiente: el 31 de enero más un mes es el 28 o 29 de febrero
+func agregarMeses(fecha time.Time, meses int) time.Time {
+	y, m, d := fecha.Date()
+	primero := time.Date(y, m+time.Month(meses), 1, 0, 0, 0, 0, time.UTC)
+	ultimo := primero.AddDate(0, 1, -1).Day()
+	return time.Date(primero.Year(), primero.Month(), min(d, ultimo), 0, 0, 0, 0, time.UTC)
+}
+
+// sumarDias suma días a una fecha YYYY-MM-DD
+func sumarDias(fecha string, dias int) string {
+	t, _ := time.Parse(formatoFecha, fecha)
+	return t.AddDate(0, 0, dias).Format(formatoFecha)
+}
+
+// diasEntre es el número de días de la fecha desde a la fecha hasta (YYYY-MM-DD)
+func diasEntre(desde, hasta string) int {
+	d, _ := time.Parse(formatoFecha, desde)
+	h, _ := time.Parse(formatoFecha, hasta)
+	return int(h.Sub(d).Hours() / 24)
+}
+
+// cuentaRenta son los términos de un contrato de renta con sus cargos y pagos
+type cuentaRenta struct {
+	IDContrato        int
+	Titulo            string
+	Tipo              string
+	Estado            string
+	Inicio            *string
+	Fin               *string
+	Monto             *float64
+	Deposito          float64
+	DiasGracia        int
+	RecargoFijo       float64
+	RecargoPorcentaje float64
+	FirmadoEn         sql.NullTime
+	RescindidoEn      sql.NullTime
+	CobranzaDesde     *string
+	IDPropiedad       int
+	IDTipoPropiedad   int
+	IDPropietario     int
+	Propiedad         string
+	Usuario           string
+	AgenteCierre      string
+	Inquilino         string
+	Telefono          string
+	Correo            string
+	Cargos            []*models.CargoRenta
+	Pagos             []*models.PagoRenta
+}
+
+// getCuentas recupera los contratos que cumplen la condición (sobre Contratos y Propiedades) con sus cargos y pagos
+func getCuentas(db queryer, condicion string, args ...interface{}) ([]*cuentaRenta, error) {
+	query := `SELECT Contratos.id_contrato, Contratos.titulo_contrato, Contratos.tipo, Contratos.estado, Contratos.fecha_inicio,
+			Contratos.fecha_fin, Contratos.monto, Contratos.deposito, Contratos.dias_gracia, Contratos.recargo_fijo,
+			Contratos.recargo_porcentaje, Contratos.firmado_en, Contratos.rescindido_en, Contratos.cobranza_desde, Contratos.id_propiedad,
+			Propiedades.id_tipo_propiedad, Propiedades.id_propietario, Propiedades.titulo, Propiedades.usuario, Contratos.agente_cierre,
+			Partes_Contrato.nombre, Partes_Contrato.telefono, Partes_Contrato.correo
+		FROM Contratos
+		INNER JOIN Propiedades ON Propiedades.id_propiedad = Contratos.id_propiedad
+		LEFT JOIN Partes_Contrato ON Partes_Contrato.id_contrato = Contratos.id_contrato AND Partes_Contrato.rol = 'cliente'
+		WHERE ` + condicion + " ORDER BY Contratos.id_contrato"
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching cuentas de renta:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cuentas []*cuentaRenta
+	for rows.Next() {
+		var c cuentaRenta
+		var titulo, tipo, propiedad, usuario, cierre, inquilino, telefono, correo sql.NullString
+		var inicio, fin, desde sql.NullTime
+		var monto, deposito, recargoFijo, recargoPorcentaje sql.NullFloat64
+		var diasGracia sql.NullInt64
+		err := rows.Scan(&c.IDContrato, &titulo, &tipo, &c.Estado, &inicio, &fin, &monto, &deposito, &diasGracia, &recargoFijo,
+			&recargoPorcentaje, &c.FirmadoEn, &c.RescindidoEn, &desde, &c.IDPropiedad, &c.IDTipoPropiedad, &c.IDPropietario, &propiedad, &usuario, &cierre,
+			&inquilino, &telefono, &correo)
+		if err != nil {
+			log.Println("Error scanning cuenta de renta:", err)
+			return nil, err
+		}
+		c.Titulo, c.Tipo, c.Propiedad, c.Usuario = titulo.String, tipo.String, propiedad.String, usuario.String
+		c.AgenteCierre = cierre.String
+		c.Inquilino, c.Telefono, c.Correo = inquilino.String, telefono.String, correo.String
+		c.Inicio, c.Fin, c.CobranzaDesde = fechaContrato(inicio), fechaContrato(fin), fechaContrato(desde)
+		if monto.Valid {
+			c.Monto = &monto.Float64
+		}
+		c.Deposito, c.RecargoFijo, c.RecargoPorcentaje = deposito.Float64, recargoFijo.Float64, recargoPorcentaje.Float64
+		c.DiasGracia = diasGraciaDefault
+		if diasGracia.Valid {
+			c.DiasGracia = int(diasGracia.Int64)
+		}
+		c.Cargos, c.Pagos = []*models.CargoRenta{}, []*models.PagoRenta{}
+		cuentas = append(cuentas, &c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	if len(cuentas) == 0 {
+		return cuentas, nil
+	}
+
+	porID := map[int]*cuentaRenta{}
+	for _, c := range cuentas {
+		porID[c.IDContrato] = c
+	}
+	cargos, err := getCargos(db, condicion, args...)
+	if err != nil {
+		return nil, err
+	}
+	for id, lista := range cargos {
+		if c, ok := porID[id]; ok {
+			c.Cargos = lista
+		}
+	}
+	pagos, err := getPagos(db, condicion, args...)
+	if err != nil {
+		return nil, err
+	}
+	for id, lista := range pagos {
+		if c, ok := porID[id]; ok {
+			c.Pagos = lista
+		}
+	}
+	return cuentas, nil
+}
+
+// getCargos regresa los cargos de los contratos que cumplen la condición, en el orden en el que se les aplican los pagos
+func getCargos(db queryer, condicion string, args ...interface{}) (map[int][]*models.CargoRenta, error) {
+	query := `SELECT Cargos_Renta.id_contrato, Cargos_Renta.id_cargo, Cargos_Renta.tipo, Cargos_Renta.periodo, Cargos_Renta.concepto,
+			Cargos_Renta.monto, Cargos_Renta.fecha_vencimiento, Cargos_Renta.condonado_en, Cargos_Renta.motivo_condonacion
+		FROM Cargos_Renta
+		INNER JOIN Contratos ON Contratos.id_contrato = Cargos_Renta.id_contrato
+		INNER JOIN Propiedades ON Propiedades.id_propiedad = Contratos.id_propiedad
+		WHERE ` + condicion + `
+		ORDER BY Cargos_Renta.id_contrato, Cargos_Renta.fecha_vencimiento, FIELD(Cargos_Renta.tipo, 'deposito', 'renta', 'recargo'),
+			Cargos_Renta.id_cargo`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching cargos de renta:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	cargos := map[int][]*models.CargoRenta{}
+	for rows.Next() {
+		var idContrato int
+		var cargo models.CargoRenta
+		var periodo, vencimiento time.Time
+		var condonado sql.NullTime
+		var motivo sql.NullString
+		err := rows.Scan(&idContrato, &cargo.IDCargo, &cargo.Tipo, &periodo, &cargo.Concepto, &cargo.Monto, &vencimiento, &condonado, &motivo)
+		if err != nil {
+			log.Println("Error scanning cargo de renta:", err)
+			return nil, err
+		}
+		cargo.Periodo, cargo.FechaVencimiento = periodo.Format(formatoFecha), vencimiento.Format(formatoFecha)
+		if condonado.Valid {
+			cargo.CondonadoEn = &condonado.Time
+		}
+		cargo.MotivoCondonacion = motivo.String
+		cargos[idContrato] = append(cargos[idContrato], &cargo)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return cargos, nil
+}
+
+// getPagos regresa los pagos de los contratos que cumplen la condición, del más antiguo al más nuevo
+func getPagos(db queryer, condicion string, args ...interface{}) (map[int][]*models.PagoRenta, error) {
+	query := `SELECT Pagos_Renta.id_contrato, Pagos_Renta.id_pago, Pagos_Renta.fecha, Pagos_Renta.monto, Pagos_Renta.metodo,
+			Pagos_Renta.referencia, Pagos_Renta.notas, Pagos_Renta.registrado_por, Pagos_Renta.creado_en, Pagos_Renta.cancelado_en,
+			Pagos_Renta.cancelado_por, Pagos_Renta.motivo_cancelacion
+		FROM Pagos_Renta
+		INNER JOIN Contratos ON Contratos.id_contrato = Pagos_Renta.id_contrato
+		INNER JOIN Propiedades ON Propiedades.id_propiedad = Contratos.id_propiedad
+		WHERE ` + condicion + `
+		ORDER BY Pagos_Renta.id_contrato, Pagos_Renta.fecha, Pagos_Renta.id_pago`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching pagos de renta:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	pagos := map[int][]*models.PagoRenta{}
+	for rows.Next() {
+		var idContrato int
+		var pago models.PagoRenta
+		var fecha time.Time
+		var referencia, notas, registradoPor, canceladoPor, motivo sql.NullString
+		var cancelado sql.NullTime
+		err := rows.Scan(&idContrato, &pago.IDPago, &fecha, &pago.Monto, &pago.Metodo, &referencia, &notas, &registradoPor,
+			&pago.CreadoEn, &cancelado, &canceladoPor, &motivo)
+		if err != nil {
+			log.Println("Error scanning pago de renta:", err)
+			return nil, err
+		}
+		pago.Fecha = fecha.Format(formatoFecha)
+		pago.Referencia, pago.Notas, pago.RegistradoPor = referencia.String, notas.String, registradoPor.String
+		if cancelado.Valid {
+			pago.CanceladoEn = &cancelado.Time
+		}
+		pago.CanceladoPor, pago.MotivoCancelacion = canceladoPor.String, motivo.String
+		pagos[idContrato] = append(pagos[idContrato], &pago)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return pagos, nil
+}
+
+// aplicarPagos reparte los pagos no cancelados con fecha hasta el corte ("" son todos) entre los cargos, del que vence
+// primero al último, y llena lo pagado, el saldo y el estado de cada cargo a la fecha de hoy. Regresa el saldo a favor.
+func aplicarPagos(cargos []*models.CargoRenta, pagos []*models.PagoRenta, hoy, corte string) float64 {
+	var disponible int64
+	for _, pago := range pagos {
+		if pago.CanceladoEn == nil && (corte == "" || pago.Fecha <= corte) {
+			disponible += centavos(pago.Monto)
+		}
+	}
+	for _, cargo := range cargos {
+		if cargo.CondonadoEn != nil {
+			cargo.Pagado, cargo.Saldo, cargo.Estado = 0, 0, "condonado"
+			continue
+		}
+		monto := centavos(cargo.Monto)
+		pagado := min(monto, disponible)
+		disponible -= pagado
+		cargo.Pagado, cargo.Saldo = pesos(pagado), pesos(monto-pagado)
+		switch {
+		case pagado == monto:
+			cargo.Estado = "pagado"
+		case cargo.FechaVencimiento < hoy:
+			cargo.Estado = "vencido"
+		case pagado > 0:
+			cargo.Estado = "parcial"
+		default:
+			cargo.Estado = "pendiente"
+		}
+	}
+	return pesos(disponible)
+}
+
+// saldoAlCorte aplica los pagos hechos hasta el corte y regresa lo que le quedó por pagar al cargo. El cargo se busca
+// por id porque la lista se vuelve a leer de la base cada vez que se agrega un recargo.
+func saldoAlCorte(cargos []*models.CargoRenta, pagos []*models.PagoRenta, idCargo int, hoy, corte string) float64 {
+	aplicarPagos(cargos, pagos, hoy, corte)
+	for _, cargo := range cargos {
+		if cargo.IDCargo == idCargo {
+			return cargo.Saldo
+		}
+	}
+	return 0
+}
+
+// aplicacionPago es la parte de un pago que se le aplicó a un cargo
+type aplicacionPago struct {
+	Fecha    string // Fecha del pago
+	Tipo     string // Tipo del cargo
+	Centavos int64
+}
+
+// asignarPagos reparte los pagos igual que aplicarPagos pero regresa qué parte de cada pago cubrió cada cargo,
+// así se sabe en qué fecha se cobró cada renta
+func asignarPagos(cargos []*models.CargoRenta, pagos []*models.PagoRenta) []aplicacionPago {
+	var aplicaciones []aplicacionPago
+	i := 0
+	var pendiente int64
+	for _, pago := range pagos {
+		if pago.CanceladoEn != nil {
+			continue
+		}
+		disponible := centavos(pago.Monto)
+		for disponible > 0 && i < len(cargos) {
+			cargo := cargos[i]
+			if cargo.CondonadoEn != nil {
+				i++
+				continue
+			}
+			if pendiente == 0 {
+				pendiente = centavos(cargo.Monto)
+			}
+			parte := min(disponible, pendiente)
+			aplicaciones = append(aplicaciones, aplicacionPago{Fecha: pago.Fecha, Tipo: cargo.Tipo, Centavos: parte})
+			disponible -= parte
+			pendiente -= parte
+			if pendiente == 0 {
+				i++
+			}
+		}
+	}
+	return aplicaciones
+}
+
+// resumenAtraso suma el saldo de los cargos ya vencidos (después de aplicarPagos) y regresa el vencimiento del más antiguo
+func resumenAtraso(cargos []*models.CargoRenta) (vencido float64, cuantos int, desde string) {
+	var total int64
+	for _, cargo := range cargos {
+		if cargo.Estado != "vencido" {
+			continue
+		}
+		total += centavos(cargo.Saldo)
+		cuantos++
+		if desde == "" || cargo.FechaVencimiento < desde {
+			desde = cargo.FechaVencimiento
+		}
+	}
+	return pesos(total), cuantos, desde
+}
+
+// limiteCargos es el último día en el que empieza un periodo que se cobra: hoy, el fin del contrato o el día antes de rescindirlo
+func (cuenta *cuentaRenta) limiteCargos(hoy string, zona *time.Location) string {
+	limite := hoy
+	if cuenta.Fin != nil && *cuenta.Fin < limite {
+		limite = *cuenta.Fin
+	}
+	if cuenta.RescindidoEn.Valid {
+		rescision := sumarDias(cuenta.RescindidoEn.Time.In(zona).Format(formatoFecha), -1)
+		if rescision < limite {
+			limite = rescision
+		}
+	}
+	return limite
+}
+
+// generarCargos agrega el depósito y las rentas de los periodos que ya empezaron, y los recargos de las rentas que no se
+// pagaron completas dentro de los días de gracia. El índice único de contrato, tipo y periodo evita duplicarlos.
+func generarCargos(db *sql.DB, cuenta *cuentaRenta, hoy string, zona *time.Location) error {
+	if cuenta.Tipo != TransaccionRenta || cuenta.Estado == EstadoContratoBorrador || cuenta.Inicio == nil || cuenta.Monto == nil {
+		return nil
+	}
+	existentes := map[string]bool{}
+	for _, cargo := range cuenta.Cargos {
+		existentes[cargo.Tipo+cargo.Periodo] = true
+	}
+	// Los contratos que ya estaban firmados cuando empezó la cobranza se cobran desde ese día
+	desde := *cuenta.Inicio
+	if cuenta.CobranzaDesde != nil && *cuenta.CobranzaDesde > desde {
+		desde = *cuenta.CobranzaDesde
+	}
+
+	insertar := func(tipo, periodo, concepto string, monto float64, vencimiento string) error {
+		if existentes[tipo+periodo] {
+			return nil
+		}
+		query := `INSERT IGNORE INTO Cargos_Renta (id_contrato, tipo, periodo, concepto, monto, fecha_vencimiento, creado_en)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`
+		if _, err := db.Exec(query, cuenta.IDContrato, tipo, periodo, concepto, monto, vencimiento, time.Now().UTC()); err != nil {
+			log.Println("Error insertando cargo de renta:", err)
+			return err
+		}
+		existentes[tipo+periodo] = true
+		return nil
+	}
+
+	nuevos := false
+	if cuenta.Deposito > 0 && *cuenta.Inicio >= desde && !existentes[CargoDeposito+*cuenta.Inicio] {
+		if err := insertar(CargoDeposito, *cuenta.Inicio, "Depósito en garantía", cuenta.Deposito, *cuenta.Inicio); err != nil {
+			return err
+		}
+		nuevos = true
+	}
+	inicio, _ := time.Parse(formatoFecha, *cuenta.Inicio)
+	limite := cuenta.limiteCargos(hoy, zona)
+	for k := 0; ; k++ {
+		periodo := agregarMeses(inicio, k).Format(formatoFecha)
+		if periodo > limite {
+			break
+		}
+		if periodo < desde || existentes[CargoRenta+periodo] {
+			continue
+		}
+		finPeriodo := agregarMeses(inicio, k+1).AddDate(0, 0, -1).Format(formatoFecha)
+		if cuenta.Fin != nil && *cuenta.Fin < finPeriodo {
+			finPeriodo = *cuenta.Fin
+		}
+		concepto := fmt.Sprintf("Renta del %s al %s", periodo, finPeriodo)
+		if err := insertar(CargoRenta, periodo, concepto, *cuenta.Monto, periodo); err != nil {
+			return err
+		}
+		nuevos = true
+	}
+	if nuevos {
+		if err := cuenta.recargarCargos(db); err != nil {
+			return err
+		}
+	}
+
+	recargo := pesos(centavos(cuenta.RecargoFijo + *cuenta.Monto*cuenta.RecargoPorcentaje/100))
+	if recargo <= 0 {
+		return nil
+	}
+	for _, cargo := range slices.Clone(cuenta.Cargos) {
+		if cargo.Tipo != CargoRenta || cargo.CondonadoEn != nil || existentes[CargoRecargo+cargo.Periodo] {
+			continue
+		}
+		limiteGracia := sumarDias(cargo.FechaVencimiento, cuenta.DiasGracia)
+		if hoy <= limiteGracia {
+			continue
+		}
+		// Solo cuentan los pagos hechos dentro de la gracia, aunque se hayan registrado después
+		if saldoAlCorte(cuenta.Cargos, cuenta.Pagos, cargo.IDCargo, hoy, limiteGracia) <= 0 {
+			continue
+		}
+		concepto := "Recargo por pago tardío de la renta del " + cargo.Periodo
+		if err := insertar(CargoRecargo, cargo.Periodo, concepto, recargo, sumarDias(limiteGracia, 1)); err != nil {
+			return err
+		}
+		// El recargo nuevo también se paga antes que las rentas siguientes
+		if err := cuenta.recargarCargos(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cuenta *cuentaRenta) recargarCargos(db queryer) error {
+	cargos, err := getCargos(db, "Contratos.id_contrato = ?", cuenta.IDContrato)
+	if err != nil {
+		return err
+	}
+	cuenta.Cargos = cargos[cuenta.IDContrato]
+	return nil
+}
+
+// getCuentaRenta recupera un contrato de renta con sus cargos y pagos
+func (service *ContratosService) getCuentaRenta(id int) (*cuentaRenta, error) {
+	cuentas, err := getCuentas(service.DB, "Contratos.id_contrato = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(cuentas) == 0 {
+		return nil, ErrResourceNotFound
+	}
+	if cuentas[0].Tipo != TransaccionRenta {
+		return nil, fmt.Errorf("%w: solo los contratos de renta llevan cobranza", ErrInvalidContrato)
+	}
+	return cuentas[0], nil
+}
+
+// GET /contratos/:id/estado-cuenta?desde=&hasta=
+// Funcion que regresa los cargos y pagos del contrato con el saldo acumulado, el saldo vencido y el depósito
+func (service *ContratosService) GetEstadoCuenta(id int, filtro *models.FiltroEstadoCuenta) (*models.EstadoCuentaContrato, error) {
+	hoy := hoyContrato(service.ZonaDefault)
+	desde, hasta := strings.TrimSpace(filtro.Desde), strings.TrimSpace(filtro.Hasta)
+	if hasta == "" {
+		hasta = hoy
+	}
+	for _, fecha := range []string{desde, hasta} {
+		if _, err := time.Parse(formatoFecha, fecha); fecha != "" && err != nil {
+			return nil, fmt.Errorf("%w: desde y hasta deben tener el formato YYYY-MM-DD", ErrInvalidFilter)
+		}
+	}
+	if desde != "" && desde > hasta {
+		return nil, fmt.Errorf("%w: desde debe ser antes de hasta", ErrInvalidFilter)
+	}
+
+	cuenta, err := service.getCuentaRenta(id)
+	if err != nil {
+		return nil, err
+	}
+	aplicarPagos(cuenta.Cargos, cuenta.Pagos, hoy, "")
+
+	estado := models.EstadoCuentaContrato{IDContrato: cuenta.IDContrato, TituloContrato: cuenta.Titulo, Estado: cuenta.Estado,
+		Inquilino: cuenta.Inquilino, Renta: cuenta.Monto, Desde: desde, Hasta: hasta, Movimientos: []*models.MovimientoCuenta{},
+		Cargos: cuenta.Cargos, Pagos: cuenta.Pagos}
+
+	var movimientos []*models.MovimientoCuenta
+	var deposito, depositoPagado int64
+	for _, cargo := range cuenta.Cargos {
+		if cargo.CondonadoEn != nil {
+			continue
+		}
+		if cargo.Tipo == CargoDeposito {
+			deposito += centavos(cargo.Monto)
+			depositoPagado += centavos(cargo.Pagado)
+		}
+		movimientos = append(movimientos, &models.MovimientoCuenta{Fecha: cargo.FechaVencimiento, IDCargo: &cargo.IDCargo,
+			Concepto: cargo.Concepto, Cargo: cargo.Monto})
+	}
+	for _, pago := range cuenta.Pagos {
+		if pago.CanceladoEn != nil {
+			continue
+		}
+		concepto := "Pago en " + pago.Metodo
+		if pago.Referencia != "" {
+			concepto += " (" + pago.Referencia + ")"
+		}
+		movimientos = append(movimientos, &models.MovimientoCuenta{Fecha: pago.Fecha, IDPago: &pago.IDPago, Concepto: concepto,
+			Abono: pago.Monto})
+	}
+	// El mismo día van primero los cargos
+	sort.SliceStable(movimientos, func(i, j int) bool { return movimientos[i].Fecha < movimientos[j].Fecha })
+
+	var saldo, cargos, abonos int64
+	for _, m := range movimientos {
+		if m.Fecha > hasta {
+			break
+		}
+		saldo += centavos(m.Cargo) - centavos(m.Abono)
+		m.Saldo = pesos(saldo)
+		if desde != "" && m.Fecha < desde {
+			estado.SaldoInicial = m.Saldo
+			continue
+		}
+		cargos += centavos(m.Cargo)
+		abonos += centavos(m.Abono)
+		estado.Movimientos = append(estado.Movimientos, m)
+	}
+	estado.TotalCargos, estado.TotalPagos, estado.SaldoFinal = pesos(cargos), pesos(abonos), pesos(saldo)
+	estado.DepositoRequerido, estado.DepositoPagado = pesos(deposito), pesos(depositoPagado)
+
+	var vencidoDesde string
+	estado.SaldoVencido, _, vencidoDesde = resumenAtraso(cuenta.Cargos)
+	if vencidoDesde != "" {
+		estado.DiasAtraso = diasEntre(vencidoDesde, hoy)
+	}
+	return &estado, nil
+}
+
+// POST /contratos/:id/pagos
+// Funcion que registra un pago del inquilino de un contrato de renta firmado
+func (service *ContratosService) RegistrarPago(id int, pago *models.PagoRenta, usuario string) (*models.PagoRenta, error) {
+	hoy := hoyContrato(service.ZonaDefault)
+	pago.Fecha = strings.TrimSpace(pago.Fecha)
+	if pago.Fecha == "" {
+		pago.Fecha = hoy
+	}
+	if _, err := time.Parse(formatoFecha, pago.Fecha); err != nil {
+		return nil, fmt.Errorf("%w: fecha debe tener el formato YYYY-MM-DD", ErrInvalidCobranza)
+	}
+	if pago.Fecha > hoy {
+		return nil, fmt.Errorf("%w: no se registran pagos con fecha futura", ErrInvalidCobranza)
+	}
+	pago.Monto = pesos(centavos(pago.Monto))
+	if pago.Monto <= 0 {
+		return nil, fmt.Errorf("%w: monto debe ser mayor a 0", ErrInvalidCobranza)
+	}
+	if !slices.Contains([]string{PagoEfectivo, PagoTransferencia, PagoTarjeta}, pago.Metodo) {
+		return nil, fmt.Errorf("%w: metodo debe ser efectivo, transferencia o tarjeta", ErrInvalidCobranza)
+	}
+	pago.Referencia = strings.TrimSpace(pago.Referencia)
+	if pago.Referencia == "" && pago.Metodo != PagoEfectivo {
+		return nil, fmt.Errorf("%w: los pagos con %s llevan referencia", ErrInvalidCobranza, pago.Metodo)
+	}
+	if len(pago.Referencia) > 100 {
+		return nil, fmt.Errorf("%w: referencia debe tener a lo más 100 caracteres", ErrInvalidCobranza)
+	}
+	pago.Notas = truncate(strings.TrimSpace(pago.Notas), 255)
+
+	var tipo sql.NullString
+	var estado string
+	err := service.DB.QueryRow("SELECT tipo, estado FROM Contratos WHERE id_contrato = ?", id).Scan(&tipo, &estado)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		log.Println("Error recuperando el contrato:", err)
+		return nil, err
+	}
+	if tipo.String != TransaccionRenta {
+		return nil, fmt.Errorf("%w: solo los contratos de renta llevan cobranza", ErrInvalidContrato)
+	}
+	if estado == EstadoContratoBorrador {
+		return nil, fmt.Errorf("%w: el contrato todavía es borrador", ErrEstadoContrato)
+	}
+
+	pago.RegistradoPor, pago.CreadoEn = usuario, time.Now().UTC().Truncate(time.Second)
+	pago.CanceladoEn, pago.CanceladoPor, pago.MotivoCancelacion = nil, "", ""
+	query := `INSERT INTO Pagos_Renta (id_contrato, fecha, monto, metodo, referencia, notas, registrado_por, creado_en)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	pago.IDPago, err = database.Insert(service.DB, query, id, pago.Fecha, pago.Monto, pago.Metodo, nullIfEmpty(pago.Referencia),
+		nullIfEmpty(pago.Notas), nullIfEmpty(usuario), pago.CreadoEn)
+	if err != nil {
+		log.Println("Error insertando pago de renta:", err)
+		return nil, err
+	}
+	return pago, nil
+}
+
+// POST /contratos/:id/pagos/:id_pago/cancelar
+// Funcion que cancela un pago registrado por error, el pago se queda en el estado de cuenta marcado como cancelado
+func (service *ContratosService) CancelarPago(id, idPago int, motivo, usuario string) error {
+	motivo = strings.TrimSpace(motivo)
+	if motivo == "" {
+		return fmt.Errorf("%w: motivo es obligatorio", ErrInvalidCobranza)
+	}
+	query := `UPDATE Pagos_Renta SET cancelado_en = ?, cancelado_por = ?, motivo_cancelacion = ?
+		WHERE id_pago = ? AND id_contrato = ? AND cancelado_en IS NULL`
+	result, err := service.DB.Exec(query, time.Now().UTC(), nullIfEmpty(usuario), truncate(motivo, 255), idPago, id)
+	if err != nil {
+		log.Println("Error cancelando pago de renta:", err)
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 1 {
+		return nil
+	}
+
+	var cancelado sql.NullTime
+	err = service.DB.QueryRow("SELECT cancelado_en FROM Pagos_Renta WHERE id_pago = ? AND id_contrato = ?", idPago, id).Scan(&cancelado)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrResourceNotFound
+		}
+		log.Println("Error recuperando pago de renta:", err)
+		return err
+	}
+	return fmt.Errorf("%w: el pago ya estaba cancelado", ErrInvalidCobranza)
+}
+
+// POST /contratos/:id/cargos/:id_cargo/condonar
+// Funcion que perdona un recargo por pago tardío, no se vuelve a cobrar para ese periodo
+func (service *ContratosService) CondonarRecargo(id, idCargo int, motivo, usuario string) error {
+	motivo = strings.TrimSpace(motivo)
+	if motivo == "" {
+		return fmt.Errorf("%w: motivo es obligatorio", ErrInvalidCobranza)
+	}
+	var tipo string
+	var condonado sql.NullTime
+	query := "SELECT tipo, condonado_en FROM Cargos_Renta WHERE id_cargo = ? AND id_contrato = ?"
+	if err := service.DB.QueryRow(query, idCargo, id).Scan(&tipo, &condonado); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrResourceNotFound
+		}
+		log.Println("Error recuperando cargo de renta:", err)
+		return err
+	}
+	if tipo != CargoRecargo {
+		return fmt.Errorf("%w: solo se condonan recargos", ErrInvalidCobranza)
+	}
+	if condonado.Valid {
+		return fmt.Errorf("%w: el recargo ya estaba condonado", ErrInvalidCobranza)
+	}
+	query = "UPDATE Cargos_Renta SET condonado_en = ?, condonado_por = ?, motivo_condonacion = ? WHERE id_cargo = ? AND condonado_en IS NULL"
+	if _, err := service.DB.Exec(query, time.Now().UTC(), nullIfEmpty(usuario), truncate(motivo, 255), idCargo); err != nil {
+		log.Println("Error condonando recargo:", err)
+		return err
+	}
+	return nil
+}
+
+// GET /contratos/cartera-vencida?usuario=&minimo_dias=
+// Funcion que regresa los contratos de renta con saldo vencido, del más atrasado al menos, y el saldo por antigüedad
+func (service *ContratosService) GetCarteraVencida(filtro *models.FiltroCarteraVencida) (*models.CarteraVencida, error) {
+	minimo := 1
+	if filtro.MinimoDias != nil {
+		minimo = *filtro.MinimoDias
+	}
+	if minimo < 0 {
+		return nil, fmt.Errorf("%w: minimo_dias no puede ser negativo", ErrInvalidFilter)
+	}
+
+	condicion := "Contratos.tipo = ? AND Contratos.estado <> ?"
+	args := []interface{}{TransaccionRenta, EstadoContratoBorrador}
+	if filtro.Usuario != "" {
+		condicion += " AND Propiedades.usuario = ?"
+		args = append(args, filtro.Usuario)
+	}
+	cuentas, err := getCuentas(service.DB, condicion, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	hoy := hoyContrato(service.ZonaDefault)
+	cartera := models.CarteraVencida{Fecha: hoy, Contratos: []*models.AdeudoContrato{}}
+	rangos := make([]int64, len(rangosAtraso))
+	var total int64
+	for _, cuenta := range cuentas {
+		favor := aplicarPagos(cuenta.Cargos, cuenta.Pagos, hoy, "")
+		vencido, cuantos, desde := resumenAtraso(cuenta.Cargos)
+		if cuantos == 0 || diasEntre(desde, hoy) < minimo {
+			continue
+		}
+		var saldo int64
+		for _, cargo := range cuenta.Cargos {
+			saldo += centavos(cargo.Saldo)
+			if cargo.Estado != "vencido" {
+				continue
+			}
+			i := min((diasEntre(cargo.FechaVencimiento, hoy)-1)/30, len(rangosAtraso)-1)
+			rangos[i] += centavos(cargo.Saldo)
+		}
+		total += centavos(vencido)
+		cartera.Contratos = append(cartera.Contratos, &models.AdeudoContrato{IDContrato: cuenta.IDContrato, TituloContrato: cuenta.Titulo,
+			Estado: cuenta.Estado, IDPropiedad: cuenta.IDPropiedad, TituloPropiedad: cuenta.Propiedad, Usuario: cuenta.Usuario,
+			Inquilino: cuenta.Inquilino, Telefono: cuenta.Telefono, Correo: cuenta.Correo, SaldoVencido: vencido,
+			SaldoTotal: pesos(saldo - centavos(favor)), CargosVencidos: cuantos, VencidoDesde: desde, DiasAtraso: diasEntre(desde, hoy)})
+	}
+	sort.SliceStable(cartera.Contratos, func(i, j int) bool {
+		a, b := cartera.Contratos[i], cartera.Contratos[j]
+		if a.DiasAtraso != b.DiasAtraso {
+			return a.DiasAtraso > b.DiasAtraso
+		}
+		return a.SaldoVencido > b.SaldoVencido
+	})
+
+	cartera.SaldoVencido = pesos(total)
+	for i, r := range rangosAtraso {
+		cartera.Rangos = append(cartera.Rangos, &models.RangoAtraso{Rango: r, Monto: pesos(rangos[i])})
+	}
+	return &cartera, nil
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"backend/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func cargoRenta(id int, tipo string, monto float64, vencimiento string) *models.CargoRenta {
+	return &models.CargoRenta{IDCargo: id, Tipo: tipo, Periodo: vencimiento, Monto: monto, FechaVencimiento: vencimiento}
+}
+
+func pagoRenta(fecha string, monto float64) *models.PagoRenta {
+	return &models.PagoRenta{Fecha: fecha, Monto: monto, Metodo: PagoEfectivo}
+}
+
+func TestAplicarPagos(t *testing.T) {
+	cancelado := time.Date(2025, 2, 10, 0, 0, 0, 0, time.UTC)
+	type resultado struct {
+		pagado float64
+		saldo  float64
+		estado string
+	}
+	tests := []struct {
+		nombre string
+		cargos []*models.CargoRenta
+		pagos  []*models.PagoRenta
+		hoy    string
+		corte  string
+		want   []resultado
+		aFavor float64
+	}{
+		{"del que vence primero al último",
+			[]*models.CargoRenta{cargoRenta(1, CargoDeposito, 8000, "2025-01-01"), cargoRenta(2, CargoRenta, 8000, "2025-01-01"),
+				cargoRenta(3, CargoRenta, 8000, "2025-02-01")},
+			[]*models.PagoRenta{pagoRenta("2025-01-01", 10000), pagoRenta("2025-01-20", 3000)},
+			"2025-01-25", "",
+			[]resultado{{8000, 0, "pagado"}, {5000, 3000, "vencido"}, {0, 8000, "pendiente"}}, 0},
+		{"parcial antes de vencer",
+			[]*models.CargoRenta{cargoRenta(1, CargoRenta, 8000, "2025-02-01")},
+			[]*models.PagoRenta{pagoRenta("2025-01-30", 3000)},
+			"2025-01-31", "",
+			[]resultado{{3000, 5000, "parcial"}}, 0},
+		{"lo que sobra queda a favor",
+			[]*models.CargoRenta{cargoRenta(1, CargoRenta, 8000, "2025-01-01")},
+			[]*models.PagoRenta{pagoRenta("2025-01-01", 8000.10)},
+			"2025-01-02", "",
+			[]resultado{{8000, 0, "pagado"}}, 0.10},
+		{"los condonados y los pagos cancelados no cuentan",
+			[]*models.CargoRenta{{IDCargo: 1, Tipo: CargoRecargo, Monto: 500, FechaVencimiento: "2025-01-07", CondonadoEn: &cancelado},
+				cargoRenta(2, CargoRenta, 8000, "2025-02-01")},
+			[]*models.PagoRenta{pagoRenta("2025-02-01", 8000), {Fecha: "2025-02-02", Monto: 8000, CanceladoEn: &cancelado}},
+			"2025-02-05", "",
+			[]resultado{{0, 0, "condonado"}, {8000, 0, "pagado"}}, 0},
+		{"los pagos después del corte no cuentan",
+			[]*models.CargoRenta{cargoRenta(1, CargoRenta, 8000, "2025-01-01")},
+			[]*models.PagoRenta{pagoRenta("2025-01-06", 4000), pagoRenta("2025-01-07", 4000)},
+			"2025-01-10", "2025-01-06",
+			[]resultado{{4000, 4000, "vencido"}}, 0},
+		{"centavos sin errores de redondeo",
+			[]*models.CargoRenta{cargoRenta(1, CargoRenta, 0.3, "2025-01-01")},
+			[]*models.PagoRenta{pagoRenta("2025-01-01", 0.1), pagoRenta("2025-01-01", 0.2)},
+			"2025-01-02", "",
+			[]resultado{{0.3, 0, "pagado"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			aFavor := aplicarPagos(tt.cargos, tt.pagos, tt.hoy, tt.corte)
+			for i, cargo := range tt.cargos {
+				got := resultado{cargo.Pagado, cargo.Saldo, cargo.Estado}
+				if got != tt.want[i] {
+					t.Errorf("cargo %d = %+v, se esperaba %+v", cargo.IDCargo, got, tt.want[i])
+				}
+			}
+			if aFavor != tt.aFavor {
+				t.Errorf("saldo a favor = %v, se esperaba %v", aFavor, tt.aFavor)
+			}
+		})
+	}
+}
+
+func TestAsignarPagos(t *testing.T) {
+	condonado := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	cargos := []*models.CargoRenta{
+		cargoRenta(1, CargoDeposito, 8000, "2025-01-01"),
+		{IDCargo: 2, Tipo: CargoRecargo, Monto: 400, FechaVencimiento: "2025-01-01", CondonadoEn: &condonado},
+		cargoRenta(3, CargoRenta, 8000, "2025-01-01"),
+		cargoRenta(4, CargoRenta, 8000, "2025-02-01"),
+	}
+	pagos := []*models.PagoRenta{
+		pagoRenta("2025-01-01", 12000),
+		{Fecha: "2025-01-15", Monto: 5000, CanceladoEn: &condonado},
+		pagoRenta("2025-02-03", 6000),
+	}
+	want := []aplicacionPago{
+		{Fecha: "2025-01-01", Tipo: CargoDeposito, Centavos: 800000},
+		{Fecha: "2025-01-01", Tipo: CargoRenta, Centavos: 400000},
+		{Fecha: "2025-02-03", Tipo: CargoRenta, Centavos: 400000},
+		{Fecha: "2025-02-03", Tipo: CargoRenta, Centavos: 200000},
+	}
+	if got := asignarPagos(cargos, pagos); !slices.Equal(got, want) {
+		t.Errorf("asignarPagos = %+v, se esperaba %+v", got, want)
+	}
+}
+
+func TestSaldoAlCorte(t *testing.T) {
+	// generarCargos recorre una copia de los cargos y los vuelve a leer al insertar un recargo; el saldo se debe tomar
+	// de la lista nueva, no del cargo de la copia que ya no se actualiza
+	copia := []*models.CargoRenta{cargoRenta(1, CargoRenta, 8000, "2025-01-01"), cargoRenta(2, CargoRenta, 8000, "2025-02-01")}
+	pagos := []*models.PagoRenta{pagoRenta("2025-01-03", 8000), pagoRenta("2025-02-10", 8000)}
+	if saldo := saldoAlCorte(copia, pagos, 1, "2025-02-10", "2025-01-06"); saldo != 0 {
+		t.Fatalf("saldo de enero = %v, se esperaba 0", saldo)
+	}
+
+	recargada := []*models.CargoRenta{cargoRenta(1, CargoRenta, 8000, "2025-01-01"), cargoRenta(2, CargoRenta, 8000, "2025-02-01")}
+	tests := []struct {
+		nombre string
+		id     int
+		corte  string
+		want   float64
+	}{
+		{"febrero sin pagos dentro de la gracia", 2, "2025-02-06", 8000},
+		{"febrero pagado dentro de la gracia", 2, "2025-02-10", 0},
+		{"un cargo que ya no está", 9, "2025-02-06", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			if got := saldoAlCorte(recargada, pagos, tt.id, "2025-02-12", tt.corte); got != tt.want {
+				t.Errorf("saldoAlCorte = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+	if copia[1].Saldo != 8000 {
+		t.Errorf("la copia no se debe tocar al aplicar sobre la lista recargada, saldo = %v", copia[1].Saldo)
+	}
+}
+
+func TestAgregarMeses(t *testing.T) {
+	tests := []struct {
+		fecha string
+		meses int
+		want  string
+	}{
+		{"2025-01-15", 1, "2025-02-15"},
+		{"2025-01-31", 1, "2025-02-28"},
+		{"2024-01-31", 1, "2024-02-29"},
+		{"2025-01-31", 2, "2025-03-31"},
+		{"2025-11-30", 3, "2026-02-28"},
+	}
+	for _, tt := range tests {
+		fecha, _ := time.Parse(formatoFecha, tt.fecha)
+		if got := agregarMeses(fecha, tt.meses).Format(formatoFecha); got != tt.want {
+			t.Errorf("agregarMeses(%s, %d) = %s, se esperaba %s", tt.fecha, tt.meses, got, tt.want)
+		}
+	}
+}
+
+func TestResumenAtraso(t *testing.T) {
+	cargos := []*models.CargoRenta{
+		{Saldo: 3000, Estado: "vencido", FechaVencimiento: "2025-02-01"},
+		{Saldo: 8000, Estado: "vencido", FechaVencimiento: "2025-01-01"},
+		{Saldo: 8000, Estado: "pendiente", FechaVencimiento: "2025-03-01"},
+		{Saldo: 0, Estado: "pagado", FechaVencimiento: "2024-12-01"},
+	}
+	vencido, cuantos, desde := resumenAtraso(cargos)
+	if vencido != 11000 || cuantos != 2 || desde != "2025-01-01" {
+		t.Errorf("resumenAtraso = %v, %d, %s", vencido, cuantos, desde)
+	}
+}
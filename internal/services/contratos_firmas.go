@@ -0,0 +1,805 @@
+package services
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"image/png"
+	"log"
+	"strings"
+	"time"
+)
+
+// Estados de la solicitud de firma de cada parte
+const (
+	FirmaPendiente = "pendiente"
+	FirmaFirmada   = "firmada"
+	FirmaCancelada = "cancelada"
+)
+
+// Tipos de firma que acepta POST /firmas/:token
+const (
+	FirmaEscrita  = "escrita"
+	FirmaDibujada = "dibujada"
+)
+
+const (
+	diasVigenciaFirma = 7
+	bytesMaximoFirma  = 200 << 10
+	anchoMaximoFirma  = 2000
+	altoMaximoFirma   = 1000
+)
+
+var (
+	ErrInvalidFirma      = errors.New("invalid signature")
+	ErrFirmaNoDisponible = errors.New("signing link is no longer valid")
+)
+
+// columnasFirma son las columnas que lee scanFirma
+const columnasFirma = `id_firma, id_contrato, id_parte, rol, nombre, correo, estado, checksum_documento, enviado_en, expira_en,
+	firmado_en, tipo_firma, firma_texto, ip, user_agent`
+
+func scanFirma(row fila) (*models.FirmaContrato, error) {
+	var f models.FirmaContrato
+	var idParte sql.NullInt64
+	var firmadoEn sql.NullTime
+	var tipo, texto, ip, userAgent sql.NullString
+	err := row.Scan(&f.IDFirma, &f.IDContrato, &idParte, &f.Rol, &f.Nombre, &f.Correo, &f.Estado, &f.ChecksumDocumento,
+		&f.EnviadoEn, &f.ExpiraEn, &firmadoEn, &tipo, &texto, &ip, &userAgent)
+	if err != nil {
+		return nil, err
+	}
+	if idParte.Valid {
+		v := int(idParte.Int64)
+		f.IDParte = &v
+	}
+	if firmadoEn.Valid {
+		f.FirmadoEn = &firmadoEn.Time
+	}
+	f.TipoFirma, f.FirmaTexto, f.IP, f.UserAgent = tipo.String, texto.String, ip.String, userAgent.String
+	return &f, nil
+}
+
+// verificarSinFirmas regresa ErrEstadoContrato si el borrador tiene una ronda de firmas en curso,
+// mientras tanto no cambian su PDF, sus términos ni sus partes
+func verificarSinFirmas(db queryRower, id int) error {
+	var enFirma bool
+	query := `SELECT EXISTS(SELECT 1 FROM Firmas_Contrato
+		INNER JOIN Contratos ON Contratos.id_contrato = Firmas_Contrato.id_contrato
+		WHERE Firmas_Contrato.id_contrato = ? AND Contratos.estado = ? AND Firmas_Contrato.estado IN (?, ?))`
+	if err := db.QueryRow(query, id, EstadoContratoBorrador, FirmaPendiente, FirmaFirmada).Scan(&enFirma); err != nil {
+		log.Println("Error verificando firmas del contrato:", err)
+		return err
+	}
+	if enFirma {
+		return fmt.Errorf("%w: el contrato se está firmando, primero cancela las firmas", ErrEstadoContrato)
+	}
+	return nil
+}
+
+// registrarEvento agrega un renglón a la bitácora de firmas
+func registrarEvento(db database.Execer, idContrato int, idFirma *int, evento, ip, userAgent, checksum, detalle string) error {
+	query := `INSERT INTO Eventos_Firma (id_contrato, id_firma, evento, ip, user_agent, checksum_documento, detalle, creado_en)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(query, idContrato, idFirma, evento, nullIfEmpty(ip), nullIfEmpty(truncate(userAgent, 255)), nullIfEmpty(checksum),
+		nullIfEmpty(truncate(detalle, 255)), time.Now().UTC())
+	if err != nil {
+		log.Println("Error registrando evento de firma:", err)
+	}
+	return err
+}
+
+// nuevoTokenFirma genera el token del enlace, en la base solo se guarda su hash
+func nuevoTokenFirma() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		log.Println("Error generating signing token:", err)
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// enviarEnlaceFirma manda el enlace a la parte, regresa false si el correo no salió (se puede reenviar)
+func (service *ContratosService) enviarEnlaceFirma(firma *models.FirmaContrato, titulo, token, urlBase string) bool {
+	if service.Email == nil {
+		return false
+	}
+	enlace := urlBase + token
+	asunto := "Firma del contrato " + titulo
+	cuerpo := fmt.Sprintf(`<html><body><p>Hola %s,</p>
+<p>Te enviamos el contrato <b>%s</b> para que lo revises y lo firmes como %s.</p>
+<p><a href="%s">Revisar y firmar el contrato</a></p>
+<p>El enlace es personal, solo sirve para una firma y vence el %s.</p></body></html>`,
+		html.EscapeString(firma.Nombre), html.EscapeString(titulo), html.EscapeString(firma.Rol), html.EscapeString(enlace),
+		html.EscapeString(firma.ExpiraEn.In(service.ZonaDefault).Format("2006-01-02 15:04")))
+	if err := service.Email.SendHTML(firma.Correo, asunto, cuerpo); err != nil {
+		log.Printf("Contrato %d: no se pudo mandar el enlace de firma a %s: %v", firma.IDContrato, firma.Correo, err)
+		return false
+	}
+	return true
+}
+
+// POST /contratos/:id/firmas
+// Funcion que manda a firmar el PDF generado del borrador: cada parte recibe por correo un enlace que vence en
+// 7 días. El PDF tiene que ser el que sale de la plantilla para poder agregarle después la constancia de firmas.
+func (service *ContratosService) EnviarAFirma(id int, urlBase string) ([]*models.FirmaContrato, error) {
+	_, pdf, err := service.RegenerarContrato(id)
+	if err != nil {
+		if errors.Is(err, ErrContratoSinPlantilla) {
+			return nil, fmt.Errorf("%w: para firmar en línea el PDF se genera con una plantilla", ErrContratoSinPlantilla)
+		}
+		return nil, err
+	}
+	suma := sha256.Sum256(pdf)
+	checksum := hex.EncodeToString(suma[:])
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error iniciando transacción:", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	contrato, err := scanContrato(tx.QueryRow("SELECT "+columnasContrato+" FROM Contratos WHERE id_contrato = ? FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		log.Println("Error recuperando el contrato:", err)
+		return nil, err
+	}
+	if contrato.Estado != EstadoContratoBorrador {
+		return nil, fmt.Errorf("%w: el contrato ya está %s", ErrEstadoContrato, contrato.Estado)
+	}
+	if err := verificarSinFirmas(tx, id); err != nil {
+		return nil, err
+	}
+	archivo, err := getArchivo(tx, contratoArchivoQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	if archivo == nil || archivo.Checksum != checksum {
+		return nil, fmt.Errorf("%w: el PDF del contrato no es el generado con la plantilla, vuelve a generarlo", ErrContratoSinPlantilla)
+	}
+	partes, err := getPartes(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validarParaFirma(contrato, partes); err != nil {
+		return nil, err
+	}
+	for _, parte := range partes {
+		if parte.Correo == "" {
+			return nil, fmt.Errorf("%w: el %s no tiene correo para mandarle el enlace", ErrInvalidContrato, parte.Rol)
+		}
+	}
+
+	ahora := time.Now().UTC().Truncate(time.Second)
+	firmas := make([]*models.FirmaContrato, 0, len(partes))
+	tokens := make([]string, 0, len(partes))
+	for _, parte := range partes {
+		token, err := nuevoTokenFirma()
+		if err != nil {
+			return nil, err
+		}
+		idParte := parte.IDParte
+		firma := &models.FirmaContrato{IDContrato: id, IDParte: &idParte, Rol: parte.Rol, Nombre: parte.Nombre, Correo: parte.Correo,
+			Estado: FirmaPendiente, ChecksumDocumento: checksum, EnviadoEn: ahora, ExpiraEn: ahora.AddDate(0, 0, diasVigenciaFirma)}
+		query := `INSERT INTO Firmas_Contrato (id_contrato, id_parte, rol, nombre, correo, token_hash, estado, checksum_documento, enviado_en, expira_en)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		firma.IDFirma, err = database.Insert(tx, query, id, idParte, firma.Rol, firma.Nombre, firma.Correo, hashToken(token),
+			FirmaPendiente, checksum, firma.EnviadoEn, firma.ExpiraEn)
+		if err != nil {
+			log.Println("Error insertando firma:", err)
+			return nil, err
+		}
+		if err := registrarEvento(tx, id, &firma.IDFirma, "enviada", "", "", checksum, firma.Correo); err != nil {
+			return nil, err
+		}
+		firmas = append(firmas, firma)
+		tokens = append(tokens, token)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error confirmando transacción:", err)
+		return nil, err
+	}
+
+	titulo := contrato.TituloContrato
+	if strings.TrimSpace(titulo) == "" {
+		titulo = fmt.Sprintf("Contrato %d", id)
+	}
+	for i, firma := range firmas {
+		enviado := service.enviarEnlaceFirma(firma, titulo, tokens[i], urlBase)
+		firma.Enviado = &enviado
+	}
+	return firmas, nil
+}
+
+// POST /contratos/:id/firmas/:id_firma/reenviar
+// Funcion que manda un enlace nuevo a una parte que no ha firmado, el anterior deja de funcionar
+func (service *ContratosService) ReenviarFirma(id, idFirma int, urlBase string) (*models.FirmaContrato, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error iniciando transacción:", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var estado string
+	var titulo sql.NullString
+	err = tx.QueryRow("SELECT estado, titulo_contrato FROM Contratos WHERE id_contrato = ? FOR UPDATE", id).Scan(&estado, &titulo)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		log.Println("Error recuperando el contrato:", err)
+		return nil, err
+	}
+	firma, err := scanFirma(tx.QueryRow("SELECT "+columnasFirma+" FROM Firmas_Contrato WHERE id_firma = ? AND id_contrato = ? FOR UPDATE", idFirma, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		log.Println("Error recuperando firma:", err)
+		return nil, err
+	}
+	if estado != EstadoContratoBorrador || firma.Estado != FirmaPendiente {
+		return nil, fmt.Errorf("%w: la firma del %s está %s", ErrEstadoContrato, firma.Rol, firma.Estado)
+	}
+
+	token, err := nuevoTokenFirma()
+	if err != nil {
+		return nil, err
+	}
+	ahora := time.Now().UTC().Truncate(time.Second)
+	firma.EnviadoEn, firma.ExpiraEn = ahora, ahora.AddDate(0, 0, diasVigenciaFirma)
+	query := "UPDATE Firmas_Contrato SET token_hash = ?, enviado_en = ?, expira_en = ? WHERE id_firma = ?"
+	if _, err := tx.Exec(query, hashToken(token), firma.EnviadoEn, firma.ExpiraEn, idFirma); err != nil {
+		log.Println("Error actualizando firma:", err)
+		return nil, err
+	}
+	if err := registrarEvento(tx, id, &idFirma, "reenviada", "", "", firma.ChecksumDocumento, firma.Correo); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error confirmando transacción:", err)
+		return nil, err
+	}
+
+	nombre := titulo.String
+	if strings.TrimSpace(nombre) == "" {
+		nombre = fmt.Sprintf("Contrato %d", id)
+	}
+	enviado := service.enviarEnlaceFirma(firma, nombre, token, urlBase)
+	firma.Enviado = &enviado
+	return firma, nil
+}
+
+// DELETE /contratos/:id/firmas
+// Funcion que cancela la ronda de firmas del borrador, los enlaces dejan de funcionar y las firmas que ya había
+// dejan de contar. Después se puede corregir el contrato y mandarlo otra vez.
+func (service *ContratosService) CancelarFirmas(id int, usuario string) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error iniciando transacción:", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var estado string
+	if err := tx.QueryRow("SELECT estado FROM Contratos WHERE id_contrato = ? FOR UPDATE", id).Scan(&estado); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrResourceNotFound
+		}
+		log.Println("Error recuperando el contrato:", err)
+		return err
+	}
+	if estado != EstadoContratoBorrador {
+		return fmt.Errorf("%w: el contrato ya está %s", ErrEstadoContrato, estado)
+	}
+	result, err := tx.Exec("UPDATE Firmas_Contrato SET estado = ? WHERE id_contrato = ? AND estado IN (?, ?)",
+		FirmaCancelada, id, FirmaPendiente, FirmaFirmada)
+	if err != nil {
+		log.Println("Error cancelando firmas:", err)
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return fmt.Errorf("%w: el contrato no tiene firmas en curso", ErrEstadoContrato)
+	}
+	if err := registrarEvento(tx, id, nil, "cancelada", "", "", "", usuario); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error confirmando transacción:", err)
+		return err
+	}
+	return nil
+}
+
+// GET /contratos/:id/firmas
+// Funcion que regresa las solicitudes de firma del contrato y su bitácora, nil si el contrato no existe
+func (service *ContratosService) GetFirmas(id int) (*models.AuditoriaFirmas, error) {
+	auditoria := models.AuditoriaFirmas{IDContrato: id, Firmas: []*models.FirmaContrato{}, Eventos: []*models.EventoFirma{}}
+	if err := service.DB.QueryRow("SELECT estado FROM Contratos WHERE id_contrato = ?", id).Scan(&auditoria.Estado); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Println("Error recuperando el contrato:", err)
+		return nil, err
+	}
+
+	rows, err := service.DB.Query("SELECT "+columnasFirma+" FROM Firmas_Contrato WHERE id_contrato = ? ORDER BY id_firma", id)
+	if err != nil {
+		log.Println("Error fetching firmas:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		firma, err := scanFirma(rows)
+		if err != nil {
+			log.Println("Error scanning firma:", err)
+			return nil, err
+		}
+		auditoria.Firmas = append(auditoria.Firmas, firma)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+
+	if auditoria.Eventos, err = getEventosFirma(service.DB, id); err != nil {
+		return nil, err
+	}
+	if auditoria.Firmado, err = service.GetArchivoFirmado(id); err != nil {
+		return nil, err
+	}
+	return &auditoria, nil
+}
+
+func getEventosFirma(db queryer, id int) ([]*models.EventoFirma, error) {
+	query := `SELECT id_evento, id_firma, evento, ip, user_agent, checksum_documento, detalle, creado_en
+		FROM Eventos_Firma WHERE id_contrato = ? ORDER BY creado_en, id_evento`
+	rows, err := db.Query(query, id)
+	if err != nil {
+		log.Println("Error fetching eventos de firma:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	eventos := []*models.EventoFirma{}
+	for rows.Next() {
+		var e models.EventoFirma
+		var idFirma sql.NullInt64
+		var ip, userAgent, checksum, detalle sql.NullString
+		if err := rows.Scan(&e.IDEvento, &idFirma, &e.Evento, &ip, &userAgent, &checksum, &detalle, &e.CreadoEn); err != nil {
+			log.Println("Error scanning evento de firma:", err)
+			return nil, err
+		}
+		if idFirma.Valid {
+			v := int(idFirma.Int64)
+			e.IDFirma = &v
+		}
+		e.IP, e.UserAgent, e.ChecksumDocumento, e.Detalle = ip.String, userAgent.String, checksum.String, detalle.String
+		eventos = append(eventos, &e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return eventos, nil
+}
+
+// firmaPorToken regresa la solicitud del enlace si todavía se puede firmar: ErrResourceNotFound si el token no existe
+// y ErrFirmaNoDisponible si ya se usó, se canceló o venció
+func firmaPorToken(db queryRower, token string, bloquear bool) (*models.FirmaContrato, error) {
+	query := "SELECT " + columnasFirma + " FROM Firmas_Contrato WHERE token_hash = ?"
+	if bloquear {
+		query += " FOR UPDATE"
+	}
+	firma, err := scanFirma(db.QueryRow(query, hashToken(token)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		log.Println("Error recuperando firma:", err)
+		return nil, err
+	}
+	if err := firmaDisponible(firma, time.Now()); err != nil {
+		return nil, err
+	}
+	return firma, nil
+}
+
+// firmaDisponible regresa ErrFirmaNoDisponible si el enlace ya se usó, se canceló o venció a la hora dada
+func firmaDisponible(firma *models.FirmaContrato, ahora time.Time) error {
+	switch {
+	case firma.Estado == FirmaFirmada:
+		return fmt.Errorf("%w: el contrato ya se firmó con este enlace", ErrFirmaNoDisponible)
+	case firma.Estado == FirmaCancelada:
+		return fmt.Errorf("%w: la firma se canceló", ErrFirmaNoDisponible)
+	case !ahora.Before(firma.ExpiraEn):
+		return fmt.Errorf("%w: el enlace venció, pide que te lo reenvíen", ErrFirmaNoDisponible)
+	}
+	return nil
+}
+
+// documentoSinCambios regresa ErrFirmaNoDisponible si el PDF del contrato ya no es el que se mandó a firmar
+func documentoSinCambios(archivo *models.Archivo, checksum string) error {
+	if archivo == nil || archivo.Checksum != checksum {
+		return fmt.Errorf("%w: el documento cambió después de mandarse a firmar", ErrFirmaNoDisponible)
+	}
+	return nil
+}
+
+// firmasCompletas indica si ya firmaron todas las partes de la ronda, las canceladas son de rondas anteriores
+func firmasCompletas(estados []string) bool {
+	firmadas := 0
+	for _, estado := range estados {
+		switch estado {
+		case FirmaPendiente:
+			return false
+		case FirmaFirmada:
+			firmadas++
+		}
+	}
+	return firmadas > 0
+}
+
+// GET /firmas/:token
+// Funcion que regresa lo que ve la parte al abrir su enlace y lo anota en la bitácora
+func (service *ContratosService) GetSolicitudFirma(token, ip, userAgent string) (*models.SolicitudFirma, error) {
+	firma, err := firmaPorToken(service.DB, token, false)
+	if err != nil {
+		return nil, err
+	}
+
+	solicitud := models.SolicitudFirma{IDContrato: firma.IDContrato, Rol: firma.Rol, Nombre: firma.Nombre,
+		ChecksumDocumento: firma.ChecksumDocumento, ExpiraEn: firma.ExpiraEn, Partes: []models.ParteFirmante{}}
+	var titulo sql.NullString
+	if err := service.DB.QueryRow("SELECT titulo_contrato FROM Contratos WHERE id_contrato = ?", firma.IDContrato).Scan(&titulo); err != nil {
+		log.Println("Error recuperando el contrato:", err)
+		return nil, err
+	}
+	solicitud.TituloContrato = titulo.String
+
+	query := `SELECT rol, nombre, estado FROM Firmas_Contrato WHERE id_contrato = ? AND estado IN (?, ?)
+		ORDER BY FIELD(rol, 'propietario', 'cliente', 'fiador')`
+	rows, err := service.DB.Query(query, firma.IDContrato, FirmaPendiente, FirmaFirmada)
+	if err != nil {
+		log.Println("Error fetching firmas:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var parte models.ParteFirmante
+		var estado string
+		if err := rows.Scan(&parte.Rol, &parte.Nombre, &estado); err != nil {
+			log.Println("Error scanning firma:", err)
+			return nil, err
+		}
+		parte.Firmada = estado == FirmaFirmada
+		solicitud.Partes = append(solicitud.Partes, parte)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+
+	if err := registrarEvento(service.DB, firma.IDContrato, &firma.IDFirma, "vista", ip, userAgent, firma.ChecksumDocumento, ""); err != nil {
+		return nil, err
+	}
+	return &solicitud, nil
+}
+
+// GET /firmas/:token/pdf
+// Funcion que regresa el PDF que se va a firmar
+func (service *ContratosService) GetDocumentoFirma(token string) (*models.Archivo, error) {
+	firma, err := firmaPorToken(service.DB, token, false)
+	if err != nil {
+		return nil, err
+	}
+	archivo, err := service.GetArchivoContrato(firma.IDContrato)
+	if err != nil {
+		return nil, err
+	}
+	if err := documentoSinCambios(archivo, firma.ChecksumDocumento); err != nil {
+		return nil, err
+	}
+	return archivo, nil
+}
+
+// decodificarFirma revisa que la firma dibujada sea un PNG de tamaño razonable, acepta base64 solo o como data URL
+func decodificarFirma(imagen string) ([]byte, error) {
+	imagen = strings.TrimSpace(imagen)
+	if i := strings.Index(imagen, ","); strings.HasPrefix(imagen, "data:") && i > 0 {
+		if !strings.HasPrefix(imagen, "data:image/png;base64,") {
+			return nil, fmt.Errorf("%w: la imagen debe ser PNG", ErrInvalidFirma)
+		}
+		imagen = imagen[i+1:]
+	}
+	if base64.StdEncoding.DecodedLen(len(imagen)) > bytesMaximoFirma+3 {
+		return nil, fmt.Errorf("%w: la imagen no puede pasar de %d KB", ErrInvalidFirma, bytesMaximoFirma>>10)
+	}
+	datos, err := base64.StdEncoding.DecodeString(imagen)
+	if err != nil {
+		return nil, fmt.Errorf("%w: la imagen no es base64 válido", ErrInvalidFirma)
+	}
+	if len(datos) == 0 || len(datos) > bytesMaximoFirma {
+		return nil, fmt.Errorf("%w: la imagen no puede pasar de %d KB", ErrInvalidFirma, bytesMaximoFirma>>10)
+	}
+	config, err := png.DecodeConfig(bytes.NewReader(datos))
+	if err != nil {
+		return nil, fmt.Errorf("%w: la imagen debe ser PNG", ErrInvalidFirma)
+	}
+	if config.Width < 1 || config.Height < 1 || config.Width > anchoMaximoFirma || config.Height > altoMaximoFirma {
+		return nil, fmt.Errorf("%w: la imagen debe medir a lo más %dx%d pixeles", ErrInvalidFirma, anchoMaximoFirma, altoMaximoFirma)
+	}
+	if _, err := png.Decode(bytes.NewReader(datos)); err != nil {
+		return nil, fmt.Errorf("%w: la imagen PNG está dañada", ErrInvalidFirma)
+	}
+	return datos, nil
+}
+
+// POST /firmas/:token
+// Funcion que registra la firma de la parte con su IP, navegador y el SHA-256 del documento que firmó. Con la firma
+// de la última parte el contrato pasa a firmado (o directo a vigente o vencido según sus fechas) y regresa true.
+func (service *ContratosService) Firmar(token string, req *models.FirmarContrato, ip, userAgent string) (int, bool, error) {
+	var texto string
+	var imagen []byte
+	switch req.Tipo {
+	case FirmaEscrita:
+		texto = strings.Join(strings.Fields(req.Nombre), " ")
+		if texto == "" {
+			return 0, false, fmt.Errorf("%w: la firma escrita lleva el nombre", ErrInvalidFirma)
+		}
+		texto = truncate(texto, 150)
+	case FirmaDibujada:
+		var err error
+		if imagen, err = decodificarFirma(req.Imagen); err != nil {
+			return 0, false, err
+		}
+	default:
+		return 0, false, fmt.Errorf("%w: tipo debe ser escrita o dibujada", ErrInvalidFirma)
+	}
+
+	// Primero se ubica el contrato para bloquearlo antes que la firma, en el mismo orden que al cancelar
+	firma, err := firmaPorToken(service.DB, token, false)
+	if err != nil {
+		return 0, false, err
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error iniciando transacción:", err)
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	contrato, err := scanContrato(tx.QueryRow("SELECT "+columnasContrato+" FROM Contratos WHERE id_contrato = ? FOR UPDATE", firma.IDContrato))
+	if err != nil {
+		log.Println("Error recuperando el contrato:", err)
+		return 0, false, err
+	}
+	if firma, err = firmaPorToken(tx, token, true); err != nil {
+		return 0, false, err
+	}
+	if contrato.Estado != EstadoContratoBorrador {
+		return 0, false, fmt.Errorf("%w: el contrato ya está %s", ErrFirmaNoDisponible, contrato.Estado)
+	}
+	archivo, err := getArchivo(tx, contratoArchivoQuery, contrato.IDContrato)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := documentoSinCambios(archivo, firma.ChecksumDocumento); err != nil {
+		return 0, false, err
+	}
+
+	ahora := time.Now().UTC().Truncate(time.Second)
+	query := `UPDATE Firmas_Contrato SET estado = ?, firmado_en = ?, tipo_firma = ?, firma_texto = ?, firma_imagen = ?, ip = ?, user_agent = ?
+		WHERE id_firma = ?`
+	_, err = tx.Exec(query, FirmaFirmada, ahora, req.Tipo, nullIfEmpty(texto), imagen, nullIfEmpty(ip), nullIfEmpty(truncate(userAgent, 255)), firma.IDFirma)
+	if err != nil {
+		log.Println("Error guardando firma:", err)
+		return 0, false, err
+	}
+	if err := registrarEvento(tx, contrato.IDContrato, &firma.IDFirma, "firmada", ip, userAgent, firma.ChecksumDocumento, "Firma "+req.Tipo); err != nil {
+		return 0, false, err
+	}
+
+	rows, err := tx.Query("SELECT estado FROM Firmas_Contrato WHERE id_contrato = ?", contrato.IDContrato)
+	if err != nil {
+		log.Println("Error fetching firmas:", err)
+		return 0, false, err
+	}
+	var estados []string
+	for rows.Next() {
+		var estado string
+		if err := rows.Scan(&estado); err != nil {
+			rows.Close()
+			log.Println("Error scanning firma:", err)
+			return 0, false, err
+		}
+		estados = append(estados, estado)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return 0, false, err
+	}
+	completo := firmasCompletas(estados)
+	if completo {
+		if err := firmarContrato(tx, contrato, hoyContrato(service.ZonaDefault)); err != nil {
+			return 0, false, err
+		}
+		if err := registrarEvento(tx, contrato.IDContrato, nil, "completada", "", "", firma.ChecksumDocumento, "Estado "+contrato.Estado); err != nil {
+			return 0, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error confirmando transacción:", err)
+		return 0, false, err
+	}
+	return contrato.IDContrato, completo, nil
+}
+
+// formatoHoraFirma es como se escriben las horas en la constancia, siempre en UTC para que el PDF no dependa del servidor
+func formatoHoraFirma(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05") + " UTC"
+}
+
+// PDFFirmado arma el PDF final: el mismo texto que se firmó más las páginas de la constancia con la firma de cada parte
+// y la bitácora. Sale solo de lo guardado, así que se puede volver a armar idéntico.
+func (service *ContratosService) PDFFirmado(id int) ([]byte, error) {
+	var estado string
+	var titulo sql.NullString
+	err := service.DB.QueryRow("SELECT estado, titulo_contrato FROM Contratos WHERE id_contrato = ?", id).Scan(&estado, &titulo)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		log.Println("Error recuperando el contrato:", err)
+		return nil, err
+	}
+
+	query := "SELECT " + columnasFirma + ", firma_imagen FROM Firmas_Contrato WHERE id_contrato = ? AND estado = ? ORDER BY FIELD(rol, 'propietario', 'cliente', 'fiador')"
+	rows, err := service.DB.Query(query, id, FirmaFirmada)
+	if err != nil {
+		log.Println("Error fetching firmas:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var firmas []*models.FirmaContrato
+	imagenes := map[int][]byte{}
+	for rows.Next() {
+		var f models.FirmaContrato
+		var idParte sql.NullInt64
+		var firmadoEn sql.NullTime
+		var tipo, texto, ip, userAgent sql.NullString
+		var imagen []byte
+		err := rows.Scan(&f.IDFirma, &f.IDContrato, &idParte, &f.Rol, &f.Nombre, &f.Correo, &f.Estado, &f.ChecksumDocumento,
+			&f.EnviadoEn, &f.ExpiraEn, &firmadoEn, &tipo, &texto, &ip, &userAgent, &imagen)
+		if err != nil {
+			log.Println("Error scanning firma:", err)
+			return nil, err
+		}
+		f.FirmadoEn = &firmadoEn.Time
+		f.TipoFirma, f.FirmaTexto, f.IP, f.UserAgent = tipo.String, texto.String, ip.String, userAgent.String
+		firmas = append(firmas, &f)
+		imagenes[f.IDFirma] = imagen
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	if estado == EstadoContratoBorrador || len(firmas) == 0 {
+		return nil, fmt.Errorf("%w: el contrato no se firmó en línea", ErrEstadoContrato)
+	}
+
+	generacion, texto, err := service.textoGenerado(id)
+	if err != nil {
+		return nil, err
+	}
+	documento := documentoContrato(generacion.Datos["contrato.titulo"], texto)
+	original, err := documento.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	suma := sha256.Sum256(original)
+	checksum := hex.EncodeToString(suma[:])
+	if checksum != firmas[0].ChecksumDocumento {
+		return nil, fmt.Errorf("%w: el texto regenerado no coincide con el documento firmado", ErrContratoSinPlantilla)
+	}
+	eventos, err := getEventosFirma(service.DB, id)
+	if err != nil {
+		return nil, err
+	}
+
+	documento.nuevaPagina()
+	documento.encabezado("CONSTANCIA DE FIRMA ELECTRÓNICA")
+	documento.parrafo(fmt.Sprintf("Contrato número %d: %s", id, generacion.Datos["contrato.titulo"]), false)
+	documento.parrafo("SHA-256 del documento firmado:\n"+checksum, false)
+	for _, f := range firmas {
+		documento.parrafo(fmt.Sprintf("%s: %s", strings.ToUpper(f.Rol), f.Nombre), true)
+		documento.parrafo(fmt.Sprintf("Correo: %s\nFirmó: %s\nIP: %s\nNavegador: %s",
+			f.Correo, formatoHoraFirma(*f.FirmadoEn), f.IP, f.UserAgent), false)
+		if f.TipoFirma == FirmaDibujada {
+			img, err := png.Decode(bytes.NewReader(imagenes[f.IDFirma]))
+			if err != nil {
+				log.Println("Error decoding firma:", err)
+				return nil, err
+			}
+			if err := documento.imagen(img, 200, 80); err != nil {
+				return nil, err
+			}
+			documento.espacio(tamanoTextoPDF)
+		} else {
+			documento.parrafo("Firma escrita: "+f.FirmaTexto, true)
+		}
+	}
+
+	documento.encabezado("BITÁCORA")
+	for _, e := range eventos {
+		renglon := formatoHoraFirma(e.CreadoEn) + "  " + e.Evento
+		for _, f := range firmas {
+			if e.IDFirma != nil && *e.IDFirma == f.IDFirma {
+				renglon += " - " + f.Nombre
+			}
+		}
+		if e.IP != "" {
+			renglon += " - IP " + e.IP
+		}
+		documento.parrafo(renglon, false)
+	}
+	return documento.Bytes()
+}
+
+const contratoFirmadoQuery = `SELECT ruta_pdf_firmado, CONCAT('contrato-', id_contrato, '-firmado.pdf'), 'application/pdf', tamano_firmado, checksum_firmado
+	FROM Contratos WHERE id_contrato = ? AND checksum_firmado IS NOT NULL`
+
+// GuardarFirmado liga el PDF final al contrato, regresa el que tenía antes (o nil) para poder borrarlo
+func (service *ContratosService) GuardarFirmado(id int, archivo *models.Archivo) (*models.Archivo, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error iniciando transacción:", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exists, err := database.RowExists(tx, "Contratos", "id_contrato", id)
+	if err != nil {
+		log.Println("Error verificando contrato:", err)
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrResourceNotFound
+	}
+	anterior, err := getArchivo(tx, contratoFirmadoQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	query := "UPDATE Contratos SET ruta_pdf_firmado = ?, tamano_firmado = ?, checksum_firmado = ? WHERE id_contrato = ?"
+	if _, err := tx.Exec(query, archivo.Ruta, archivo.TamanoBytes, archivo.Checksum, id); err != nil {
+		log.Println("Error guardando PDF firmado:", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error confirmando transacción:", err)
+		return nil, err
+	}
+	return anterior, nil
+}
+
+// Recupera el PDF final con la constancia de firmas, nil si el contrato no se ha firmado en línea
+func (service *ContratosService) GetArchivoFirmado(id int) (*models.Archivo, error) {
+	return getArchivo(service.DB, contratoFirmadoQuery, id)
+}
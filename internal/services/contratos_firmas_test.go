@@ -0,0 +1,149 @@
+package services
+
+import (
+	"backend/internal/models"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNuevoTokenFirma(t *testing.T) {
+	a, err := nuevoTokenFirma()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := nuevoTokenFirma()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b || len(a) != 43 {
+		t.Errorf("nuevoTokenFirma = %q, %q; se esperaban dos tokens distintos de 43 caracteres", a, b)
+	}
+	// En la base solo queda el hash, y el mismo token siempre da el mismo
+	if hashToken(a) == a || hashToken(a) != hashToken(a) {
+		t.Errorf("hashToken(%q) = %q", a, hashToken(a))
+	}
+}
+
+func TestFirmaDisponible(t *testing.T) {
+	ahora := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		nombre     string
+		estado     string
+		expiraEn   time.Time
+		disponible bool
+	}{
+		{"pendiente y vigente", FirmaPendiente, ahora.Add(time.Minute), true},
+		{"ya se usó", FirmaFirmada, ahora.Add(time.Hour), false},
+		{"cancelada", FirmaCancelada, ahora.Add(time.Hour), false},
+		{"vence justo ahora", FirmaPendiente, ahora, false},
+		{"vencida", FirmaPendiente, ahora.AddDate(0, 0, -1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			err := firmaDisponible(&models.FirmaContrato{Estado: tt.estado, ExpiraEn: tt.expiraEn}, ahora)
+			if tt.disponible != (err == nil) || (err != nil && !errors.Is(err, ErrFirmaNoDisponible)) {
+				t.Errorf("firmaDisponible = %v, se esperaba disponible %v", err, tt.disponible)
+			}
+		})
+	}
+}
+
+func TestDocumentoSinCambios(t *testing.T) {
+	tests := []struct {
+		nombre  string
+		archivo *models.Archivo
+		igual   bool
+	}{
+		{"mismo checksum", &models.Archivo{Checksum: "abc123"}, true},
+		{"el PDF se regeneró", &models.Archivo{Checksum: "def456"}, false},
+		{"el PDF se borró", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			err := documentoSinCambios(tt.archivo, "abc123")
+			if tt.igual != (err == nil) || (err != nil && !errors.Is(err, ErrFirmaNoDisponible)) {
+				t.Errorf("documentoSinCambios = %v, se esperaba sin cambios %v", err, tt.igual)
+			}
+		})
+	}
+}
+
+func TestFirmasCompletas(t *testing.T) {
+	tests := []struct {
+		nombre  string
+		estados []string
+		want    bool
+	}{
+		{"falta una parte", []string{FirmaFirmada, FirmaPendiente, FirmaFirmada}, false},
+		{"firmó la última", []string{FirmaFirmada, FirmaFirmada, FirmaFirmada}, true},
+		{"con una ronda cancelada antes", []string{FirmaCancelada, FirmaCancelada, FirmaFirmada, FirmaFirmada}, true},
+		{"la ronda nueva sigue abierta", []string{FirmaCancelada, FirmaFirmada, FirmaPendiente}, false},
+		{"solo canceladas", []string{FirmaCancelada}, false},
+		{"sin firmas", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			if got := firmasCompletas(tt.estados); got != tt.want {
+				t.Errorf("firmasCompletas = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func codificarImagen(t *testing.T, ancho, alto int, formato string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	img := image.NewGray(image.Rect(0, 0, ancho, alto))
+	var err error
+	if formato == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestDecodificarFirma(t *testing.T) {
+	firma := codificarImagen(t, 300, 100, "png")
+	tests := []struct {
+		nombre string
+		imagen string
+		valida bool
+	}{
+		{"base64 solo", firma, true},
+		{"data URL", "data:image/png;base64," + firma, true},
+		{"tamaño máximo", codificarImagen(t, anchoMaximoFirma, altoMaximoFirma, "png"), true},
+		{"data URL de otro tipo", "data:image/jpeg;base64," + firma, false},
+		{"JPEG sin data URL", codificarImagen(t, 300, 100, "jpeg"), false},
+		{"muy ancha", codificarImagen(t, anchoMaximoFirma+1, 10, "png"), false},
+		{"muy alta", codificarImagen(t, 10, altoMaximoFirma+1, "png"), false},
+		{"pasa del límite de bytes", strings.Repeat("A", base64.StdEncoding.EncodedLen(bytesMaximoFirma+4)), false},
+		{"no es base64", "no-es-base64!", false},
+		{"vacía", "", false},
+		{"PNG cortado", firma[:len(firma)/2], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			datos, err := decodificarFirma(tt.imagen)
+			if tt.valida {
+				if err != nil || len(datos) == 0 {
+					t.Errorf("decodificarFirma = %d bytes, %v; se esperaba la imagen", len(datos), err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidFirma) {
+				t.Errorf("decodificarFirma = %v, se esperaba ErrInvalidFirma", err)
+			}
+		})
+	}
+}
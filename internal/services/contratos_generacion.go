@@ -0,0 +1,378 @@
+package services
+
+import (
+	"backend/internal/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ErrContratoSinPlantilla se regresa al regenerar un contrato cuyo PDF se subió a mano
+var ErrContratoSinPlantilla = errors.New("contract was not generated from a template")
+
+var mesesContrato = [...]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto",
+	"septiembre", "octubre", "noviembre", "diciembre"}
+
+// fechaLarga escribe la fecha como se pone en un contrato, por ejemplo "1 de marzo de 2026"
+func fechaLarga(t time.Time) string {
+	return fmt.Sprintf("%d de %s de %d", t.Day(), mesesContrato[t.Month()-1], t.Year())
+}
+
+// formatoMoneda escribe el importe con separador de miles y dos decimales, por ejemplo "$15,000.00"
+func formatoMoneda(importe float64) string {
+	texto := fmt.Sprintf("%.2f", importe)
+	signo := ""
+	if strings.HasPrefix(texto, "-") {
+		signo, texto = "-", texto[1:]
+	}
+	entero, decimales := texto[:len(texto)-3], texto[len(texto)-3:]
+	var miles []string
+	for len(entero) > 3 {
+		miles = append([]string{entero[len(entero)-3:]}, miles...)
+		entero = entero[:len(entero)-3]
+	}
+	miles = append([]string{entero}, miles...)
+	return signo + "$" + strings.Join(miles, ",") + decimales
+}
+
+// nombreCompleto junta nombre y apellidos sin dejar espacios de más
+func nombreCompleto(partes ...string) string {
+	return strings.Join(strings.Fields(strings.Join(partes, " ")), " ")
+}
+
+// unirNoVacios junta las partes que traen texto con el separador
+func unirNoVacios(separador string, partes ...string) string {
+	var llenas []string
+	for _, p := range partes {
+		if p = strings.TrimSpace(p); p != "" {
+			llenas = append(llenas, p)
+		}
+	}
+	return strings.Join(llenas, separador)
+}
+
+// versionGeneracion es la versión de plantilla con la que se genera un contrato
+type versionGeneracion struct {
+	models.VersionPlantilla
+	Tipo   string
+	Activa bool
+}
+
+func (service *ContratosService) versionParaGenerar(idPlantilla int, version *int) (*versionGeneracion, error) {
+	query := `SELECT Versiones_Plantilla.id_version, Versiones_Plantilla.version, Versiones_Plantilla.contenido,
+			Plantillas_Contrato.tipo, Plantillas_Contrato.activa
+		FROM Versiones_Plantilla
+		INNER JOIN Plantillas_Contrato ON Plantillas_Contrato.id_plantilla = Versiones_Plantilla.id_plantilla
+		WHERE Versiones_Plantilla.id_plantilla = ? AND (? IS NULL OR Versiones_Plantilla.version = ?)
+		ORDER BY Versiones_Plantilla.version DESC LIMIT 1`
+	v := versionGeneracion{}
+	v.IDPlantilla = idPlantilla
+	err := service.DB.QueryRow(query, idPlantilla, version, version).Scan(&v.IDVersion, &v.Version, &v.Contenido, &v.Tipo, &v.Activa)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: la plantilla o la versión no existe", ErrInvalidGeneracion)
+		}
+		log.Println("Error fetching version plantilla:", err)
+		return nil, err
+	}
+	return &v, nil
+}
+
+// datosContrato junta los valores de las variables con los datos actuales del contrato, sus partes, su propiedad,
+// el propietario y el prospecto. Lo que se manda en la petición tiene prioridad sobre los términos y las partes del
+// contrato, y las partes tienen prioridad sobre el propietario de la propiedad.
+func (service *ContratosService) datosContrato(id int, tipo string, req *models.GenerarContrato) (map[string]string, error) {
+	contrato, err := service.GetContrato(id)
+	if err != nil {
+		return nil, err
+	}
+	if contrato == nil {
+		return nil, ErrResourceNotFound
+	}
+	if contrato.Estado != EstadoContratoBorrador {
+		return nil, fmt.Errorf("%w: el contrato está %s, solo se genera el de un borrador", ErrEstadoContrato, contrato.Estado)
+	}
+	if contrato.Tipo != "" && contrato.Tipo != tipo {
+		return nil, fmt.Errorf("%w: el contrato es de %s y la plantilla es de %s", ErrInvalidGeneracion, contrato.Tipo, tipo)
+	}
+
+	var propiedad models.Propiedad
+	var propietario models.Propietario
+	var tituloProp, direccion, colonia, ciudad, nombre, apellidoP, apellidoM, telefono, correo, transaccion sql.NullString
+	query := `SELECT Propiedades.titulo, Propiedades.direccion, Propiedades.colonia, Propiedades.ciudad, Propiedades.precio,
+			Propietario.nombre_propietario, Propietario.apellido_paterno_propietario, Propietario.apellido_materno_propietario,
+			Propietario.telefono_propietario, Propietario.correo_propietario, Estado_Propiedades.tipo_transaccion
+		FROM Propiedades
+		LEFT JOIN Propietario ON Propietario.id_propietario = Propiedades.id_propietario
+		LEFT JOIN Estado_Propiedades ON Estado_Propiedades.id_propiedad = Propiedades.id_propiedad
+		WHERE Propiedades.id_propiedad = ?`
+	err = service.DB.QueryRow(query, contrato.IDPropiedad).Scan(&tituloProp, &direccion, &colonia, &ciudad, &propiedad.Precio,
+		&nombre, &apellidoP, &apellidoM, &telefono, &correo, &transaccion)
+	if err != nil {
+		log.Println("Error fetching propiedad del contrato:", err)
+		return nil, err
+	}
+	if transaccion.Valid && transaccion.String != tipo {
+		return nil, fmt.Errorf("%w: la propiedad está en %s y la plantilla es de %s", ErrInvalidGeneracion, transaccion.String, tipo)
+	}
+	propiedad.Titulo, propiedad.Direccion, propiedad.Colonia, propiedad.Ciudad = tituloProp.String, direccion.String, colonia.String, ciudad.String
+	propietario.Nombre, propietario.ApellidoP, propietario.ApellidoM = nombre.String, apellidoP.String, apellidoM.String
+	propietario.Telefono, propietario.Correo = telefono.String, correo.String
+
+	datos := map[string]string{
+		"contrato.titulo":      contrato.TituloContrato,
+		"contrato.numero":      fmt.Sprint(id),
+		"propietario.nombre":   nombreCompleto(propietario.Nombre, propietario.ApellidoP, propietario.ApellidoM),
+		"propietario.telefono": propietario.Telefono,
+		"propietario.correo":   propietario.Correo,
+		"propiedad.titulo":     propiedad.Titulo,
+		"propiedad.direccion":  propiedad.Direccion,
+		"propiedad.colonia":    propiedad.Colonia,
+		"propiedad.ciudad":     propiedad.Ciudad,
+		"propiedad.domicilio":  unirNoVacios(", ", propiedad.Direccion, propiedad.Colonia, propiedad.Ciudad),
+		"fecha":                fechaLarga(time.Now().In(service.ZonaDefault)),
+	}
+	if strings.TrimSpace(datos["contrato.titulo"]) == "" {
+		datos["contrato.titulo"] = fmt.Sprintf("Contrato %d", id)
+	}
+	for _, parte := range contrato.Partes {
+		datos[parte.Rol+".nombre"] = parte.Nombre
+		datos[parte.Rol+".telefono"] = parte.Telefono
+		datos[parte.Rol+".correo"] = parte.Correo
+	}
+
+	if req.IDCliente != nil {
+		var nombre, apellidoP, apellidoM, telefono, correo sql.NullString
+		query := `SELECT nombre_prospecto, apellido_paterno_prospecto, apellido_materno_prospecto, telefono_prospecto, correo_prospecto
+			FROM Prospecto WHERE id_cliente = ?`
+		err := service.DB.QueryRow(query, *req.IDCliente).Scan(&nombre, &apellidoP, &apellidoM, &telefono, &correo)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("%w: el prospecto %d no existe", ErrInvalidGeneracion, *req.IDCliente)
+			}
+			log.Println("Error fetching prospecto:", err)
+			return nil, err
+		}
+		datos["cliente.nombre"] = nombreCompleto(nombre.String, apellidoP.String, apellidoM.String)
+		datos["cliente.telefono"] = telefono.String
+		datos["cliente.correo"] = correo.String
+	} else {
+		// La generación queda ligada al prospecto de la parte cliente
+		for _, parte := range contrato.Partes {
+			if parte.Rol == ParteContratoCliente {
+				req.IDCliente = parte.IDCliente
+			}
+		}
+	}
+
+	precio := propiedad.Precio
+	if req.Precio != nil {
+		precio = *req.Precio
+	} else if contrato.Monto != nil {
+		precio = *contrato.Monto
+	}
+	if precio <= 0 {
+		return nil, fmt.Errorf("%w: precio debe ser mayor a 0", ErrInvalidGeneracion)
+	}
+	datos["precio"] = formatoMoneda(precio)
+	if contrato.Deposito != nil {
+		datos["deposito"] = formatoMoneda(*contrato.Deposito)
+	}
+
+	if strings.TrimSpace(req.FechaInicio) == "" && contrato.FechaInicio != nil {
+		req.FechaInicio = *contrato.FechaInicio
+	}
+	if strings.TrimSpace(req.FechaFin) == "" && contrato.FechaFin != nil {
+		req.FechaFin = *contrato.FechaFin
+	}
+
+	var inicio, fin time.Time
+	for _, f := range []struct {
+		campo string
+		valor string
+		fecha *time.Time
+	}{{"fecha_inicio", req.FechaInicio, &inicio}, {"fecha_fin", req.FechaFin, &fin}} {
+		if strings.TrimSpace(f.valor) == "" {
+			continue
+		}
+		t, err := time.Parse(formatoFecha, strings.TrimSpace(f.valor))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s debe tener el formato YYYY-MM-DD", ErrInvalidGeneracion, f.campo)
+		}
+		*f.fecha = t
+		datos[f.campo] = fechaLarga(t)
+	}
+	if !inicio.IsZero() && !fin.IsZero() && !fin.After(inicio) {
+		return nil, fmt.Errorf("%w: fecha_fin debe ser después de fecha_inicio", ErrInvalidGeneracion)
+	}
+
+	var clausulas []string
+	for _, c := range req.Clausulas {
+		if c = strings.TrimSpace(c); c != "" {
+			clausulas = append(clausulas, fmt.Sprintf("%d. %s", len(clausulas)+1, c))
+		}
+	}
+	datos["clausulas"] = strings.Join(clausulas, "\n\n")
+	return datos, nil
+}
+
+// PrepararContrato llena la plantilla con los datos del contrato y arma el PDF, todavía no guarda nada
+func (service *ContratosService) PrepararContrato(id int, req *models.GenerarContrato, usuario string) (*models.GeneracionContrato, []byte, error) {
+	version, err := service.versionParaGenerar(req.IDPlantilla, req.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !version.Activa {
+		return nil, nil, fmt.Errorf("%w: la plantilla está desactivada", ErrInvalidGeneracion)
+	}
+
+	datos, err := service.datosContrato(id, version.Tipo, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	texto, err := renderizarPlantilla(version.Contenido, datos)
+	if err != nil {
+		return nil, nil, err
+	}
+	pdf, err := pdfContrato(datos["contrato.titulo"], texto)
+	if err != nil {
+		log.Println("Error generating contrato PDF:", err)
+		return nil, nil, err
+	}
+
+	generacion := &models.GeneracionContrato{
+		IDContrato:         id,
+		Tipo:               version.Tipo,
+		IDPlantilla:        version.IDPlantilla,
+		IDVersionPlantilla: version.IDVersion,
+		Version:            version.Version,
+		IDCliente:          req.IDCliente,
+		Datos:              datos,
+		GeneradoPor:        usuario,
+		GeneradoEn:         time.Now().UTC(),
+	}
+	return generacion, pdf, nil
+}
+
+// GuardarGeneracion liga el PDF generado al contrato junto con la versión y los datos que se usaron,
+// regresa el archivo que tenía antes (o nil) para poder borrarlo
+func (service *ContratosService) GuardarGeneracion(generacion *models.GeneracionContrato, archivo *models.Archivo) (*models.Archivo, error) {
+	datos, err := json.Marshal(generacion.Datos)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error iniciando transacción:", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	anterior, err := service.setArchivoContrato(tx, generacion.IDContrato, archivo)
+	if err != nil {
+		return nil, err
+	}
+	query := `UPDATE Contratos SET tipo = ?, id_version_plantilla = ?, id_cliente = ?, datos_plantilla = ?, generado_por = ?, generado_en = ?
+		WHERE id_contrato = ?`
+	_, err = tx.Exec(query, generacion.Tipo, generacion.IDVersionPlantilla, generacion.IDCliente, string(datos),
+		nullIfEmpty(generacion.GeneradoPor), generacion.GeneradoEn, generacion.IDContrato)
+	if err != nil {
+		log.Println("Error guardando generación del contrato:", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error confirmando transacción:", err)
+		return nil, err
+	}
+	generacion.Archivo = archivo
+	return anterior, nil
+}
+
+// GET /contratos/:id/generacion
+// Funcion que regresa con qué plantilla y datos se generó el contrato, nil si su PDF no salió de una plantilla
+func (service *ContratosService) GetGeneracion(id int) (*models.GeneracionContrato, error) {
+	query := `SELECT Contratos.tipo, Versiones_Plantilla.id_plantilla, Versiones_Plantilla.id_version, Versiones_Plantilla.version,
+			Contratos.id_cliente, Contratos.datos_plantilla, Contratos.generado_por, Contratos.generado_en
+		FROM Contratos
+		INNER JOIN Versiones_Plantilla ON Versiones_Plantilla.id_version = Contratos.id_version_plantilla
+		WHERE Contratos.id_contrato = ?`
+	generacion := models.GeneracionContrato{IDContrato: id}
+	var tipo, generadoPor sql.NullString
+	var idCliente sql.NullInt64
+	var datos []byte
+	err := service.DB.QueryRow(query, id).Scan(&tipo, &generacion.IDPlantilla, &generacion.IDVersionPlantilla, &generacion.Version,
+		&idCliente, &datos, &generadoPor, &generacion.GeneradoEn)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Println("Error fetching generación del contrato:", err)
+		return nil, err
+	}
+	if err := json.Unmarshal(datos, &generacion.Datos); err != nil {
+		log.Println("Error reading datos_plantilla:", err)
+		return nil, err
+	}
+	generacion.Tipo, generacion.GeneradoPor = tipo.String, generadoPor.String
+	if idCliente.Valid {
+		cliente := int(idCliente.Int64)
+		generacion.IDCliente = &cliente
+	}
+	if generacion.Archivo, err = service.GetArchivoContrato(id); err != nil {
+		return nil, err
+	}
+	return &generacion, nil
+}
+
+// textoGenerado vuelve a llenar la versión de plantilla con los datos guardados al generar el contrato
+func (service *ContratosService) textoGenerado(id int) (*models.GeneracionContrato, string, error) {
+	generacion, err := service.GetGeneracion(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if generacion == nil {
+		contrato, err := service.GetContrato(id)
+		if err != nil {
+			return nil, "", err
+		}
+		if contrato == nil {
+			return nil, "", ErrResourceNotFound
+		}
+		return nil, "", ErrContratoSinPlantilla
+	}
+
+	version, err := scanVersionPlantilla(service.DB.QueryRow("SELECT "+columnasVersionPlantilla+" FROM Versiones_Plantilla WHERE id_version = ?",
+		generacion.IDVersionPlantilla))
+	if err != nil {
+		return nil, "", err
+	}
+	if version == nil {
+		return nil, "", ErrContratoSinPlantilla
+	}
+	texto, err := renderizarPlantilla(version.Contenido, generacion.Datos)
+	if err != nil {
+		return nil, "", err
+	}
+	return generacion, texto, nil
+}
+
+// RegenerarContrato vuelve a armar el PDF con la misma versión de plantilla y los mismos datos que se usaron
+// al generarlo, aunque la plantilla, la propiedad o las personas hayan cambiado después. El resultado es idéntico.
+func (service *ContratosService) RegenerarContrato(id int) (*models.GeneracionContrato, []byte, error) {
+	generacion, texto, err := service.textoGenerado(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	pdf, err := pdfContrato(generacion.Datos["contrato.titulo"], texto)
+	if err != nil {
+		log.Println("Error generating contrato PDF:", err)
+		return nil, nil, err
+	}
+	return generacion, pdf, nil
+}
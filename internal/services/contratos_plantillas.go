@@ -0,0 +1,354 @@
+package services
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidPlantilla  = errors.New("invalid contract template")
+	ErrInvalidGeneracion = errors.New("invalid contract generation")
+)
+
+// Un texto de plantilla no pasa de esto, la columna es MEDIUMTEXT pero un contrato real es mucho más corto
+const largoMaximoPlantilla = 200000
+
+// marcadorPlantilla es un {{variable}}, se permiten espacios dentro de las llaves
+var marcadorPlantilla = regexp.MustCompile(`\{\{\s*([a-z_.]+)\s*\}\}`)
+
+// separadorParrafos es una línea en blanco, puede traer espacios
+var separadorParrafos = regexp.MustCompile(`\n[ \t]*\n`)
+
+// variablesPlantilla son los marcadores que se llenan al generar un contrato
+var variablesPlantilla = []models.VariablePlantilla{
+	{Nombre: "contrato.titulo", Descripcion: "Título del contrato"},
+	{Nombre: "contrato.numero", Descripcion: "Número del contrato"},
+	{Nombre: "propietario.nombre", Descripcion: "Nombre completo del propietario"},
+	{Nombre: "propietario.telefono", Descripcion: "Teléfono del propietario"},
+	{Nombre: "propietario.correo", Descripcion: "Correo del propietario"},
+	{Nombre: "cliente.nombre", Descripcion: "Nombre completo del arrendatario o comprador"},
+	{Nombre: "cliente.telefono", Descripcion: "Teléfono del arrendatario o comprador"},
+	{Nombre: "cliente.correo", Descripcion: "Correo del arrendatario o comprador"},
+	{Nombre: "fiador.nombre", Descripcion: "Nombre completo del fiador"},
+	{Nombre: "fiador.telefono", Descripcion: "Teléfono del fiador"},
+	{Nombre: "fiador.correo", Descripcion: "Correo del fiador"},
+	{Nombre: "propiedad.titulo", Descripcion: "Título de la propiedad"},
+	{Nombre: "propiedad.direccion", Descripcion: "Calle y número de la propiedad"},
+	{Nombre: "propiedad.colonia", Descripcion: "Colonia de la propiedad"},
+	{Nombre: "propiedad.ciudad", Descripcion: "Ciudad de la propiedad"},
+	{Nombre: "propiedad.domicilio", Descripcion: "Dirección, colonia y ciudad juntas"},
+	{Nombre: "precio", Descripcion: "Renta mensual o precio de venta, por ejemplo $15,000.00"},
+	{Nombre: "deposito", Descripcion: "Depósito en garantía"},
+	{Nombre: "fecha_inicio", Descripcion: "Inicio del contrato, por ejemplo 1 de marzo de 2026"},
+	{Nombre: "fecha_fin", Descripcion: "Fin del contrato"},
+	{Nombre: "fecha", Descripcion: "Fecha en que se genera el contrato"},
+	{Nombre: "clausulas", Descripcion: "Cláusulas adicionales numeradas, una por párrafo"},
+}
+
+// variablesOpcionales pueden quedar vacías al generar, las demás que use la plantilla son obligatorias
+var variablesOpcionales = []string{"clausulas"}
+
+func variableValida(nombre string) bool {
+	for _, v := range variablesPlantilla {
+		if v.Nombre == nombre {
+			return true
+		}
+	}
+	return false
+}
+
+// validarContenidoPlantilla revisa que el texto no esté vacío y que solo use marcadores conocidos y bien escritos
+func validarContenidoPlantilla(contenido string) error {
+	if strings.TrimSpace(contenido) == "" {
+		return fmt.Errorf("%w: contenido no puede estar vacío", ErrInvalidPlantilla)
+	}
+	if len(contenido) > largoMaximoPlantilla {
+		return fmt.Errorf("%w: contenido no puede pasar de %d caracteres", ErrInvalidPlantilla, largoMaximoPlantilla)
+	}
+	var desconocidas []string
+	for _, m := range marcadorPlantilla.FindAllStringSubmatch(contenido, -1) {
+		if !variableValida(m[1]) && !slices.Contains(desconocidas, m[1]) {
+			desconocidas = append(desconocidas, m[1])
+		}
+	}
+	if len(desconocidas) > 0 {
+		return fmt.Errorf("%w: variables desconocidas: %s", ErrInvalidPlantilla, strings.Join(desconocidas, ", "))
+	}
+	if resto := marcadorPlantilla.ReplaceAllString(contenido, ""); strings.Contains(resto, "{{") || strings.Contains(resto, "}}") {
+		return fmt.Errorf("%w: hay un marcador mal escrito, deben ser como {{propiedad.direccion}}", ErrInvalidPlantilla)
+	}
+	return nil
+}
+
+func validarTipoPlantilla(tipo string) error {
+	if tipo != TransaccionRenta && tipo != TransaccionVenta {
+		return fmt.Errorf("%w: tipo debe ser renta o venta", ErrInvalidPlantilla)
+	}
+	return nil
+}
+
+// renderizarPlantilla llena los marcadores del texto, si alguno obligatorio no tiene valor regresa cuáles faltan
+func renderizarPlantilla(contenido string, datos map[string]string) (string, error) {
+	faltantes := map[string]bool{}
+	texto := marcadorPlantilla.ReplaceAllStringFunc(contenido, func(marcador string) string {
+		nombre := marcadorPlantilla.FindStringSubmatch(marcador)[1]
+		valor := strings.TrimSpace(datos[nombre])
+		if valor == "" && !slices.Contains(variablesOpcionales, nombre) {
+			faltantes[nombre] = true
+		}
+		return valor
+	})
+	if len(faltantes) > 0 {
+		var nombres []string
+		for nombre := range faltantes {
+			nombres = append(nombres, nombre)
+		}
+		sort.Strings(nombres)
+		return "", fmt.Errorf("%w: faltan datos para %s", ErrInvalidGeneracion, strings.Join(nombres, ", "))
+	}
+	return texto, nil
+}
+
+// pdfContrato acomoda el texto en el PDF: los párrafos se separan con una línea en blanco
+// y un párrafo que empieza con "# " es un título
+func pdfContrato(titulo, texto string) ([]byte, error) {
+	return documentoContrato(titulo, texto).Bytes()
+}
+
+// documentoContrato arma el documento sin cerrarlo, así se le puede agregar la constancia de firmas
+func documentoContrato(titulo, texto string) *documentoPDF {
+	documento := nuevoPDF(titulo)
+	texto = strings.ReplaceAll(texto, "\r\n", "\n")
+	for _, parrafo := range separadorParrafos.Split(texto, -1) {
+		parrafo = strings.Trim(parrafo, "\n")
+		if strings.TrimSpace(parrafo) == "" {
+			continue
+		}
+		if strings.HasPrefix(parrafo, "# ") {
+			documento.encabezado(strings.TrimSpace(parrafo[2:]))
+			continue
+		}
+		documento.parrafo(parrafo, false)
+	}
+	return documento
+}
+
+// GET /contratos/plantillas/variables
+func (service *ContratosService) GetVariablesPlantilla() []models.VariablePlantilla {
+	return variablesPlantilla
+}
+
+// GET /contratos/plantillas
+func (service *ContratosService) GetPlantillas() ([]*models.PlantillaContrato, error) {
+	query := `SELECT Plantillas_Contrato.id_plantilla, Plantillas_Contrato.nombre, Plantillas_Contrato.tipo, Plantillas_Contrato.activa,
+			(SELECT COALESCE(MAX(version), 0) FROM Versiones_Plantilla WHERE Versiones_Plantilla.id_plantilla = Plantillas_Contrato.id_plantilla)
+		FROM Plantillas_Contrato ORDER BY Plantillas_Contrato.tipo, Plantillas_Contrato.nombre`
+	rows, err := service.DB.Query(query)
+	if err != nil {
+		log.Println("Error fetching plantillas:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	plantillas := []*models.PlantillaContrato{}
+	for rows.Next() {
+		var p models.PlantillaContrato
+		if err := rows.Scan(&p.IDPlantilla, &p.Nombre, &p.Tipo, &p.Activa, &p.UltimaVersion); err != nil {
+			log.Println("Error scanning plantilla:", err)
+			return nil, err
+		}
+		plantillas = append(plantillas, &p)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return plantillas, nil
+}
+
+// GET /contratos/plantillas/:id
+// Funcion que regresa la plantilla con la lista de sus versiones, de la más nueva a la más vieja y sin el texto
+func (service *ContratosService) GetPlantilla(id int) (*models.PlantillaContrato, error) {
+	var p models.PlantillaContrato
+	err := service.DB.QueryRow("SELECT id_plantilla, nombre, tipo, activa FROM Plantillas_Contrato WHERE id_plantilla = ?", id).
+		Scan(&p.IDPlantilla, &p.Nombre, &p.Tipo, &p.Activa)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Println("Error fetching plantilla:", err)
+		return nil, err
+	}
+
+	query := `SELECT id_version, id_plantilla, version, nota, creado_por, creado_en
+		FROM Versiones_Plantilla WHERE id_plantilla = ? ORDER BY version DESC`
+	rows, err := service.DB.Query(query, id)
+	if err != nil {
+		log.Println("Error fetching versiones plantilla:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	p.Versiones = []*models.VersionPlantilla{}
+	for rows.Next() {
+		var v models.VersionPlantilla
+		var nota, creadoPor sql.NullString
+		if err := rows.Scan(&v.IDVersion, &v.IDPlantilla, &v.Version, &nota, &creadoPor, &v.CreadoEn); err != nil {
+			log.Println("Error scanning version plantilla:", err)
+			return nil, err
+		}
+		v.Nota, v.CreadoPor = nota.String, creadoPor.String
+		p.Versiones = append(p.Versiones, &v)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	if len(p.Versiones) > 0 {
+		p.UltimaVersion = p.Versiones[0].Version
+	}
+	return &p, nil
+}
+
+const columnasVersionPlantilla = "id_version, id_plantilla, version, contenido, nota, creado_por, creado_en"
+
+func scanVersionPlantilla(row *sql.Row) (*models.VersionPlantilla, error) {
+	var v models.VersionPlantilla
+	var nota, creadoPor sql.NullString
+	if err := row.Scan(&v.IDVersion, &v.IDPlantilla, &v.Version, &v.Contenido, &nota, &creadoPor, &v.CreadoEn); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Println("Error fetching version plantilla:", err)
+		return nil, err
+	}
+	v.Nota, v.CreadoPor = nota.String, creadoPor.String
+	return &v, nil
+}
+
+// GET /contratos/plantillas/:id/versiones/:version
+func (service *ContratosService) GetVersionPlantilla(id, version int) (*models.VersionPlantilla, error) {
+	query := "SELECT " + columnasVersionPlantilla + " FROM Versiones_Plantilla WHERE id_plantilla = ? AND version = ?"
+	return scanVersionPlantilla(service.DB.QueryRow(query, id, version))
+}
+
+// POST /contratos/plantillas
+// Funcion que crea la plantilla con su texto como versión 1
+func (service *ContratosService) CreatePlantilla(plantilla *models.PlantillaContrato, usuario string) (int, error) {
+	plantilla.Nombre = strings.TrimSpace(plantilla.Nombre)
+	if plantilla.Nombre == "" {
+		return 0, fmt.Errorf("%w: nombre no puede estar vacío", ErrInvalidPlantilla)
+	}
+	if err := validarTipoPlantilla(plantilla.Tipo); err != nil {
+		return 0, err
+	}
+	if err := validarContenidoPlantilla(plantilla.Contenido); err != nil {
+		return 0, err
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := database.Insert(tx, "INSERT INTO Plantillas_Contrato (nombre, tipo, activa) VALUES (?, ?, 1)", plantilla.Nombre, plantilla.Tipo)
+	if err != nil {
+		log.Println("Error inserting plantilla:", err)
+		return 0, err
+	}
+	query := "INSERT INTO Versiones_Plantilla (id_plantilla, version, contenido, creado_por, creado_en) VALUES (?, 1, ?, ?, ?)"
+	if _, err := tx.Exec(query, id, plantilla.Contenido, nullIfEmpty(usuario), time.Now().UTC()); err != nil {
+		log.Println("Error inserting version plantilla:", err)
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		return 0, err
+	}
+	plantilla.IDPlantilla = id
+	plantilla.Activa = true
+	plantilla.UltimaVersion = 1
+	return id, nil
+}
+
+// PUT /contratos/plantillas/:id
+// Funcion que cambia el nombre o desactiva la plantilla, el tipo y el texto no cambian aquí
+func (service *ContratosService) UpdatePlantilla(id int, cambio *models.CambioPlantilla) error {
+	query := "UPDATE Plantillas_Contrato SET nombre = COALESCE(?, nombre), activa = COALESCE(?, activa) WHERE id_plantilla = ?"
+	err := database.ExecExisting(service.DB, "Plantillas_Contrato", "id_plantilla", id, query, nullIfEmpty(cambio.Nombre), cambio.Activa, id)
+	if err != nil && !errors.Is(err, ErrResourceNotFound) {
+		log.Println("Error updating plantilla:", err)
+	}
+	return err
+}
+
+// POST /contratos/plantillas/:id/versiones
+// Funcion que agrega una versión con el texto nuevo, las anteriores se quedan como estaban
+func (service *ContratosService) CreateVersionPlantilla(id int, nueva *models.NuevaVersionPlantilla, usuario string) (*models.VersionPlantilla, error) {
+	if err := validarContenidoPlantilla(nueva.Contenido); err != nil {
+		return nil, err
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// El lock de la plantilla evita que dos versiones nuevas tomen el mismo número
+	exists, err := database.RowExists(tx, "Plantillas_Contrato", "id_plantilla", id)
+	if err != nil {
+		log.Println("Error checking plantilla:", err)
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrResourceNotFound
+	}
+
+	var ultima int
+	var contenido sql.NullString
+	err = tx.QueryRow("SELECT version, contenido FROM Versiones_Plantilla WHERE id_plantilla = ? ORDER BY version DESC LIMIT 1", id).
+		Scan(&ultima, &contenido)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Error fetching version plantilla:", err)
+		return nil, err
+	}
+	if contenido.Valid && contenido.String == nueva.Contenido {
+		return nil, fmt.Errorf("%w: el contenido es igual al de la versión %d", ErrInvalidPlantilla, ultima)
+	}
+
+	version := &models.VersionPlantilla{
+		IDPlantilla: id,
+		Version:     ultima + 1,
+		Contenido:   nueva.Contenido,
+		Nota:        strings.TrimSpace(nueva.Nota),
+		CreadoPor:   usuario,
+		CreadoEn:    time.Now().UTC(),
+	}
+	query := "INSERT INTO Versiones_Plantilla (id_plantilla, version, contenido, nota, creado_por, creado_en) VALUES (?, ?, ?, ?, ?, ?)"
+	version.IDVersion, err = database.Insert(tx, query, id, version.Version, version.Contenido, nullIfEmpty(version.Nota),
+		nullIfEmpty(usuario), version.CreadoEn)
+	if err != nil {
+		log.Println("Error inserting version plantilla:", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		return nil, err
+	}
+	return version, nil
+}
@@ -4,26 +4,77 @@ import (
 	"backend/internal/database"
 	"backend/internal/models"
 	"database/sql"
+	"fmt"
 	"log"
+	"time"
 )
 
 type ContratosService struct {
-	DB *sql.DB
+	DB          *sql.DB
+	ZonaDefault *time.Location // Zona en la que se escribe la fecha de los contratos generados
+	// Email manda los enlaces de firma a las partes, si es nil no se mandan
+	Email *EmailService
 }
 
 // Constructor para ContratosService
-func NewContratosService(db *sql.DB) *ContratosService {
+func NewContratosService(db *sql.DB, zonaDefault *time.Location, email *EmailService) *ContratosService {
 	return &ContratosService{
-		DB: db,
+		DB:          db,
+		ZonaDefault: zonaDefault,
+		Email:       email,
 	}
 }
 
-// Recupera un contrato por su ID
-func (service *ContratosService) GetContrato(id int) (*models.Contrato, error) {
+// columnasContrato son las columnas que lee scanContrato
+const columnasContrato = `Contratos.id_contrato, Contratos.titulo_contrato, Contratos.descripcion_contrato, Contratos.tipo, Contratos.ruta_pdf,
+	Contratos.id_propiedad, Contratos.estado, Contratos.fecha_inicio, Contratos.fecha_fin, Contratos.monto, Contratos.deposito,
+	Contratos.dias_gracia, Contratos.recargo_fijo, Contratos.recargo_porcentaje`
+
+func scanContrato(row fila) (*models.Contrato, error) {
 	var contrato models.Contrato
-	query := "SELECT id_contrato, titulo_contrato, descripcion_contrato, tipo, ruta_pdf, id_propiedad FROM Contratos WHERE id_contrato = ?"
-	row := service.DB.QueryRow(query, id)
-	err := row.Scan(&contrato.IDContrato, &contrato.TituloContrato, &contrato.DescripcionContrato, &contrato.Tipo, &contrato.RutaPDF, &contrato.IDPropiedad)
+	var titulo, descripcion, tipo, ruta sql.NullString
+	var inicio, fin sql.NullTime
+	var monto, deposito, recargoFijo, recargoPorcentaje sql.NullFloat64
+	var diasGracia sql.NullInt64
+	err := row.Scan(&contrato.IDContrato, &titulo, &descripcion, &tipo, &ruta, &contrato.IDPropiedad, &contrato.Estado,
+		&inicio, &fin, &monto, &deposito, &diasGracia, &recargoFijo, &recargoPorcentaje)
+	if err != nil {
+		return nil, err
+	}
+	contrato.TituloContrato, contrato.DescripcionContrato = titulo.String, descripcion.String
+	contrato.Tipo, contrato.RutaPDF = tipo.String, ruta.String
+	contrato.FechaInicio, contrato.FechaFin = fechaContrato(inicio), fechaContrato(fin)
+	if monto.Valid {
+		contrato.Monto = &monto.Float64
+	}
+	if deposito.Valid {
+		contrato.Deposito = &deposito.Float64
+	}
+	if diasGracia.Valid {
+		dias := int(diasGracia.Int64)
+		contrato.DiasGracia = &dias
+	}
+	if recargoFijo.Valid {
+		contrato.RecargoFijo = &recargoFijo.Float64
+	}
+	if recargoPorcentaje.Valid {
+		contrato.RecargoPorcentaje = &recargoPorcentaje.Float64
+	}
+	return &contrato, nil
+}
+
+// fechaContrato regresa la fecha como YYYY-MM-DD, nil si la columna es NULL
+func fechaContrato(fecha sql.NullTime) *string {
+	if !fecha.Valid {
+		return nil
+	}
+	texto := fecha.Time.Format(formatoFecha)
+	return &texto
+}
+
+// Recupera un contrato por su ID con sus partes
+func (service *ContratosService) GetContrato(id int) (*models.Contrato, error) {
+	contrato, err := scanContrato(service.DB.QueryRow("SELECT "+columnasContrato+" FROM Contratos WHERE id_contrato = ?", id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Println("No se encontró el contrato")
@@ -32,13 +83,41 @@ func (service *ContratosService) GetContrato(id int) (*models.Contrato, error) {
 		log.Println("Error recuperando el contrato:", err)
 		return nil, err
 	}
-	return &contrato, nil
+	if contrato.Partes, err = getPartes(service.DB, id); err != nil {
+		return nil, err
+	}
+	return contrato, nil
 }
 
-func (service *ContratosService) GetContratos() ([]*models.ContratoMenu, error) {
+func (service *ContratosService) GetContratos(page *models.PageRequest) (*models.Page[*models.ContratoMenu], error) {
+	cursor, err := normalizePage(page)
+	if err != nil {
+		return nil, err
+	}
+
+	from := " FROM Contratos INNER JOIN Propiedades ON Contratos.id_propiedad = Propiedades.id_propiedad"
+	total, err := countRows(service.DB, "SELECT COUNT(*)"+from)
+	if err != nil {
+		return nil, err
+	}
+
+	var conditions []string
+	var args []interface{}
+	order := pageOrder{ID: "Contratos.id_contrato"}
+	if cursor != nil {
+		condition, cursorArgs, err := keysetCondition(cursor, order)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+	limit, limitArgs := limitClause(page)
+	args = append(args, limitArgs...)
+
 	var contratos []*models.ContratoMenu
-	query := "SELECT id_contrato, titulo_contrato, tipo, titulo FROM Contratos, Propiedades WHERE Contratos.id_propiedad = Propiedades.id_propiedad"
-	rows, err := service.DB.Query(query)
+	query := "SELECT Contratos.id_contrato, Contratos.titulo_contrato, Contratos.tipo, Propiedades.titulo, Contratos.estado, Contratos.fecha_fin" + from + whereClause(conditions) + " ORDER BY Contratos.id_contrato" + limit
+	rows, err := service.DB.Query(query, args...)
 	if err != nil {
 		log.Println("Error recuperando contratos:", err)
 		return nil, err
@@ -47,11 +126,15 @@ func (service *ContratosService) GetContratos() ([]*models.ContratoMenu, error)
 
 	for rows.Next() {
 		var contrato models.ContratoMenu
-		err := rows.Scan(&contrato.IDContrato, &contrato.TituloContrato, &contrato.Tipo, &contrato.TituloPropiedad)
+		var titulo, tipo, tituloPropiedad sql.NullString
+		var fin sql.NullTime
+		err := rows.Scan(&contrato.IDContrato, &titulo, &tipo, &tituloPropiedad, &contrato.Estado, &fin)
 		if err != nil {
 			log.Println("Error procesando fila de contrato:", err)
 			return nil, err
 		}
+		contrato.TituloContrato, contrato.Tipo, contrato.TituloPropiedad = titulo.String, tipo.String, tituloPropiedad.String
+		contrato.FechaFin = fechaContrato(fin)
 		contratos = append(contratos, &contrato)
 	}
 
@@ -59,13 +142,15 @@ func (service *ContratosService) GetContratos() ([]*models.ContratoMenu, error)
 		log.Println("Error iterando filas:", err)
 		return nil, err
 	}
-	return contratos, nil
+	return buildPage(contratos, total, page, order, func(contrato *models.ContratoMenu) (int, interface{}) {
+		return contrato.IDContrato, nil
+	}), nil
 }
 
 // Recupera todos los contratos asociados a una propiedad
 func (service *ContratosService) GetContratosByPropiedad(idPropiedad int) ([]*models.Contrato, error) {
 	var contratos []*models.Contrato
-	query := "SELECT id_contrato, titulo_contrato, descripcion_contrato, tipo, ruta_pdf, id_propiedad FROM Contratos WHERE id_propiedad = ?"
+	query := "SELECT " + columnasContrato + " FROM Contratos WHERE id_propiedad = ?"
 	rows, err := service.DB.Query(query, idPropiedad)
 	if err != nil {
 		log.Println("Error recuperando contratos:", err)
@@ -74,13 +159,12 @@ func (service *ContratosService) GetContratosByPropiedad(idPropiedad int) ([]*mo
 	defer rows.Close()
 
 	for rows.Next() {
-		var contrato models.Contrato
-		err := rows.Scan(&contrato.IDContrato, &contrato.TituloContrato, &contrato.DescripcionContrato, &contrato.Tipo, &contrato.RutaPDF, &contrato.IDPropiedad)
+		contrato, err := scanContrato(rows)
 		if err != nil {
 			log.Println("Error procesando fila de contrato:", err)
 			return nil, err
 		}
-		contratos = append(contratos, &contrato)
+		contratos = append(contratos, contrato)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -90,77 +174,163 @@ func (service *ContratosService) GetContratosByPropiedad(idPropiedad int) ([]*mo
 	return contratos, nil
 }
 
-// Inserta un nuevo contrato en la base de datos
+// Inserta un nuevo contrato en la base de datos, empieza como borrador
 func (service *ContratosService) InsertContrato(contrato *models.Contrato) (int, error) {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Contratos", "id_contrato")
-	if err != nil {
-		log.Println("Error obteniendo último ID:", err)
+	if err := validarTerminos(contrato); err != nil {
 		return 0, err
 	}
-	contrato.IDContrato = lastId + 1
-
-	lastIdPropiedad, err := utils.GetLastId("Propiedades", "id_propiedad")
-	if err != nil {
-		log.Println("Error obteniendo último ID de propiedad:", err)
-		return 0, err
-	}
-	contrato.IDPropiedad = lastIdPropiedad
-
-	query := "INSERT INTO Contratos(id_contrato, titulo_contrato, descripcion_contrato, tipo, ruta_pdf, id_propiedad) VALUES(?,?,?,?,?,?)"
-	result, err := service.DB.Exec(query, contrato.IDContrato, contrato.TituloContrato, contrato.DescripcionContrato, contrato.Tipo, contrato.RutaPDF, contrato.IDPropiedad)
+	query := `INSERT INTO Contratos(titulo_contrato, descripcion_contrato, tipo, ruta_pdf, id_propiedad, estado, fecha_inicio, fecha_fin, monto, deposito,
+			dias_gracia, recargo_fijo, recargo_porcentaje)
+		VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?)`
+	id, err := database.Insert(service.DB, query, contrato.TituloContrato, contrato.DescripcionContrato, contrato.Tipo, contrato.RutaPDF,
+		contrato.IDPropiedad, EstadoContratoBorrador, contrato.FechaInicio, contrato.FechaFin, contrato.Monto, contrato.Deposito,
+		contrato.DiasGracia, contrato.RecargoFijo, contrato.RecargoPorcentaje)
 	if err != nil {
 		log.Println("Error insertando contrato:", err)
 		return 0, err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
-		return 0, err
-	}
-	if rows != 1 {
-		log.Println("Error insertando contrato, no se afectaron filas")
-		return 0, err
-	}
+	contrato.IDContrato = id
+	contrato.Estado = EstadoContratoBorrador
 	return contrato.IDContrato, nil
 }
 
-// Actualiza un contrato existente por su ID
+// Actualiza un contrato existente por su ID. Los términos que no se mandan se conservan y,
+// si el contrato ya no es borrador, mandar uno distinto regresa ErrEstadoContrato.
 func (service *ContratosService) UpdateContrato(contrato *models.Contrato, id int) error {
-	query := "UPDATE Contratos SET titulo_contrato = ?, descripcion_contrato = ?, tipo = ?, ruta_pdf = ?, id_propiedad = ? WHERE id_contrato = ?"
-	result, err := service.DB.Exec(query, contrato.TituloContrato, contrato.DescripcionContrato, contrato.Tipo, contrato.RutaPDF, contrato.IDPropiedad, id)
+	if err := validarTerminos(contrato); err != nil {
+		return err
+	}
+
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error actualizando contrato:", err)
+		log.Println("Error iniciando transacción:", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	actual, err := scanContrato(tx.QueryRow("SELECT "+columnasContrato+" FROM Contratos WHERE id_contrato = ? FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrResourceNotFound
+		}
+		log.Println("Error recuperando el contrato:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
+	if contrato.Tipo != actual.Tipo || contrato.IDPropiedad != actual.IDPropiedad || cambiaTermino(contrato.FechaInicio, actual.FechaInicio) ||
+		cambiaTermino(contrato.FechaFin, actual.FechaFin) || cambiaTermino(contrato.Monto, actual.Monto) || cambiaTermino(contrato.Deposito, actual.Deposito) ||
+		cambiaTermino(contrato.DiasGracia, actual.DiasGracia) || cambiaTermino(contrato.RecargoFijo, actual.RecargoFijo) ||
+		cambiaTermino(contrato.RecargoPorcentaje, actual.RecargoPorcentaje) {
+		if actual.Estado != EstadoContratoBorrador {
+			return fmt.Errorf("%w: el contrato está %s, sus términos ya no cambian", ErrEstadoContrato, actual.Estado)
+		}
+		if err := verificarSinFirmas(tx, id); err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE Contratos SET titulo_contrato = ?, descripcion_contrato = ?, tipo = ?, ruta_pdf = ?, id_propiedad = ?,
+			fecha_inicio = COALESCE(?, fecha_inicio), fecha_fin = COALESCE(?, fecha_fin), monto = COALESCE(?, monto), deposito = COALESCE(?, deposito),
+			dias_gracia = COALESCE(?, dias_gracia), recargo_fijo = COALESCE(?, recargo_fijo), recargo_porcentaje = COALESCE(?, recargo_porcentaje)
+		WHERE id_contrato = ?`
+	_, err = tx.Exec(query, contrato.TituloContrato, contrato.DescripcionContrato, contrato.Tipo, contrato.RutaPDF, contrato.IDPropiedad,
+		contrato.FechaInicio, contrato.FechaFin, contrato.Monto, contrato.Deposito, contrato.DiasGracia, contrato.RecargoFijo,
+		contrato.RecargoPorcentaje, id)
 	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
+		log.Println("Error actualizando contrato:", err)
 		return err
 	}
-	if rows == 0 {
-		log.Println("Error actualizando contrato, no se afectaron filas")
+	if err := tx.Commit(); err != nil {
+		log.Println("Error confirmando transacción:", err)
 		return err
 	}
 	return nil
 }
 
-// Elimina un contrato por su ID
+// Elimina un contrato por su ID, solo se pueden eliminar los borradores
 func (service *ContratosService) DeleteContrato(id int) error {
-	query := "DELETE FROM Contratos WHERE id_contrato = ?"
-	result, err := service.DB.Exec(query, id)
+	tx, err := service.DB.Begin()
 	if err != nil {
+		log.Println("Error iniciando transacción:", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var estado string
+	if err := tx.QueryRow("SELECT estado FROM Contratos WHERE id_contrato = ? FOR UPDATE", id).Scan(&estado); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrResourceNotFound
+		}
 		log.Println("Error eliminando contrato:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
+	if estado != EstadoContratoBorrador {
+		return fmt.Errorf("%w: el contrato está %s, solo se eliminan borradores", ErrEstadoContrato, estado)
+	}
+	if err := verificarSinFirmas(tx, id); err != nil {
 		return err
 	}
-	if rows == 0 {
-		log.Println("Error eliminando contrato, no se afectaron filas")
+	if _, err := tx.Exec("DELETE FROM Contratos WHERE id_contrato = ?", id); err != nil {
+		log.Println("Error eliminando contrato:", err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error confirmando transacción:", err)
 		return err
 	}
 	return nil
 }
+
+// Liga el PDF que se guardo en el storage al contrato, regresa el archivo que tenia antes (o nil) para poder borrarlo
+func (service *ContratosService) SetArchivoContrato(id int, archivo *models.Archivo) (*models.Archivo, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error iniciando transacción:", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	anterior, err := service.setArchivoContrato(tx, id, archivo)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error confirmando transacción:", err)
+		return nil, err
+	}
+	return anterior, nil
+}
+
+// setArchivoContrato actualiza las columnas del PDF dentro de la transacción, regresa ErrResourceNotFound si el contrato no existe
+func (service *ContratosService) setArchivoContrato(tx *sql.Tx, id int, archivo *models.Archivo) (*models.Archivo, error) {
+	exists, err := database.RowExists(tx, "Contratos", "id_contrato", id)
+	if err != nil {
+		log.Println("Error verificando contrato:", err)
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrResourceNotFound
+	}
+	if err := verificarSinFirmas(tx, id); err != nil {
+		return nil, err
+	}
+
+	anterior, err := getArchivo(tx, contratoArchivoQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	query := "UPDATE Contratos SET ruta_pdf = ?, nombre_archivo = ?, tipo_mime = ?, tamano_bytes = ?, checksum_sha256 = ? WHERE id_contrato = ?"
+	if _, err := tx.Exec(query, archivo.Ruta, archivo.NombreOriginal, archivo.TipoMIME, archivo.TamanoBytes, archivo.Checksum, id); err != nil {
+		log.Println("Error actualizando PDF del contrato:", err)
+		return nil, err
+	}
+
+	return anterior, nil
+}
+
+const contratoArchivoQuery = "SELECT ruta_pdf, nombre_archivo, tipo_mime, tamano_bytes, checksum_sha256 FROM Contratos WHERE id_contrato = ? AND checksum_sha256 IS NOT NULL"
+
+// Recupera el PDF de un contrato, regresa nil si el contrato no tiene un archivo subido
+func (service *ContratosService) GetArchivoContrato(id int) (*models.Archivo, error) {
+	return getArchivo(service.DB, contratoArchivoQuery, id)
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"backend/internal/scheduler"
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	avisosVencimientoPorRevision = 200
+	intentosAvisoVencimiento     = 5
+)
+
+// VencimientosContratosService mantiene el estado de los contratos firmados según sus fechas y le avisa al agente
+// responsable (el usuario de la propiedad) de los contratos que vencen en los próximos 60 días. Cada contrato se
+// avisa una vez por fecha de fin, si se cambia la fecha se vuelve a avisar.
+type VencimientosContratosService struct {
+	DB          *sql.DB
+	Email       *EmailService
+	ZonaDefault *time.Location
+}
+
+// Constructor para VencimientosContratosService
+func NewVencimientosContratosService(db *sql.DB, email *EmailService, zonaDefault *time.Location) *VencimientosContratosService {
+	return &VencimientosContratosService{
+		DB:          db,
+		Email:       email,
+		ZonaDefault: zonaDefault,
+	}
+}
+
+// Ejecutar actualiza los estados, encola los avisos nuevos y manda los pendientes, lo llama el scheduler cada hora
+func (service *VencimientosContratosService) Ejecutar() error {
+	hoy := hoyContrato(service.ZonaDefault)
+	if err := service.actualizarEstados(hoy); err != nil {
+		return err
+	}
+	if err := service.programar(hoy); err != nil {
+		return err
+	}
+	if err := service.cancelarObsoletos(); err != nil {
+		return err
+	}
+	return service.enviarPendientes()
+}
+
+// actualizarEstados pasa a vencido lo que ya terminó y a vigente lo firmado que ya empezó
+func (service *VencimientosContratosService) actualizarEstados(hoy string) error {
+	query := "UPDATE Contratos SET estado = ? WHERE estado IN (?, ?) AND fecha_fin < ?"
+	if _, err := service.DB.Exec(query, EstadoContratoVencido, EstadoContratoFirmado, EstadoContratoVigente, hoy); err != nil {
+		log.Println("Error updating contratos vencidos:", err)
+		return err
+	}
+	query = "UPDATE Contratos SET estado = ? WHERE estado = ? AND fecha_inicio <= ?"
+	if _, err := service.DB.Exec(query, EstadoContratoVigente, EstadoContratoFirmado, hoy); err != nil {
+		log.Println("Error updating contratos vigentes:", err)
+		return err
+	}
+	return nil
+}
+
+// programar encola un aviso por cada contrato firmado o vigente que vence en los próximos días,
+// el índice único de contrato y fecha de fin evita repetirlo
+func (service *VencimientosContratosService) programar(hoy string) error {
+	query := `INSERT IGNORE INTO Avisos_Vencimiento (id_contrato, fecha_fin, usuario, estado, intentos, creado_en)
+		SELECT Contratos.id_contrato, Contratos.fecha_fin, Propiedades.usuario, 'pendiente', 0, ?
+		FROM Contratos
+		INNER JOIN Propiedades ON Propiedades.id_propiedad = Contratos.id_propiedad
+		WHERE Contratos.estado IN (?, ?) AND Contratos.fecha_fin BETWEEN ? AND ? + INTERVAL ? DAY
+			AND COALESCE(Propiedades.usuario, '') <> ''`
+	_, err := service.DB.Exec(query, time.Now().UTC(), EstadoContratoFirmado, EstadoContratoVigente, hoy, hoy, diasAvisoVencimiento)
+	if err != nil {
+		log.Println("Error scheduling avisos de vencimiento:", err)
+		return err
+	}
+	return nil
+}
+
+// cancelarObsoletos cancela los avisos de contratos rescindidos, con otra fecha de fin o que cambiaron de agente.
+// También regresa a pendiente los que se quedaron en 'enviando' por un reinicio.
+func (service *VencimientosContratosService) cancelarObsoletos() error {
+	query := `UPDATE Avisos_Vencimiento
+		LEFT JOIN Contratos ON Contratos.id_contrato = Avisos_Vencimiento.id_contrato
+		LEFT JOIN Propiedades ON Propiedades.id_propiedad = Contratos.id_propiedad
+		SET Avisos_Vencimiento.estado = 'cancelado'
+		WHERE Avisos_Vencimiento.estado = 'pendiente'
+			AND (Contratos.id_contrato IS NULL OR Contratos.estado NOT IN (?, ?)
+				OR Contratos.fecha_fin IS NULL OR Contratos.fecha_fin <> Avisos_Vencimiento.fecha_fin
+				OR COALESCE(Propiedades.usuario, '') <> Avisos_Vencimiento.usuario)`
+	if _, err := service.DB.Exec(query, EstadoContratoFirmado, EstadoContratoVigente); err != nil {
+		log.Println("Error cancelling avisos de vencimiento:", err)
+		return err
+	}
+	return service.bandeja().Liberar()
+}
+
+// avisoVencimiento es un aviso pendiente con los datos del contrato
+type avisoVencimiento struct {
+	ID         int
+	Usuario    string
+	IDContrato int
+	Titulo     string
+	Tipo       string
+	FechaFin   time.Time
+	Propiedad  string
+	Cliente    string
+	Telefono   string
+}
+
+func (service *VencimientosContratosService) enviarPendientes() error {
+	query := `SELECT Avisos_Vencimiento.id_aviso, Avisos_Vencimiento.usuario, Contratos.id_contrato, Contratos.titulo_contrato,
+			Contratos.tipo, Avisos_Vencimiento.fecha_fin, Propiedades.titulo, Partes_Contrato.nombre, Partes_Contrato.telefono
+		FROM Avisos_Vencimiento
+		INNER JOIN Contratos ON Contratos.id_contrato = Avisos_Vencimiento.id_contrato
+		INNER JOIN Propiedades ON Propiedades.id_propiedad = Contratos.id_propiedad
+		LEFT JOIN Partes_Contrato ON Partes_Contrato.id_contrato = Contratos.id_contrato AND Partes_Contrato.rol = 'cliente'
+		WHERE Avisos_Vencimiento.estado = 'pendiente'
+		ORDER BY Avisos_Vencimiento.usuario, Avisos_Vencimiento.fecha_fin, Avisos_Vencimiento.id_aviso
+		LIMIT ?`
+	rows, err := service.DB.Query(query, avisosVencimientoPorRevision)
+	if err != nil {
+		log.Println("Error fetching avisos de vencimiento:", err)
+		return err
+	}
+
+	porAgente := map[string][]avisoVencimiento{}
+	var agentes []string
+	for rows.Next() {
+		var a avisoVencimiento
+		var titulo, tipo, propiedad, cliente, telefono sql.NullString
+		err := rows.Scan(&a.ID, &a.Usuario, &a.IDContrato, &titulo, &tipo, &a.FechaFin, &propiedad, &cliente, &telefono)
+		if err != nil {
+			rows.Close()
+			log.Println("Error scanning aviso de vencimiento:", err)
+			return err
+		}
+		a.Titulo = titulo.String
+		a.Tipo = tipo.String
+		a.Propiedad = propiedad.String
+		a.Cliente = cliente.String
+		a.Telefono = telefono.String
+		if _, ok := porAgente[a.Usuario]; !ok {
+			agentes = append(agentes, a.Usuario)
+		}
+		porAgente[a.Usuario] = append(porAgente[a.Usuario], a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return err
+	}
+
+	hoy, _ := time.Parse(formatoFecha, hoyContrato(service.ZonaDefault))
+	for _, agente := range agentes {
+		service.enviar(agente, porAgente[agente], hoy)
+	}
+	return nil
+}
+
+// enviar reclama los avisos del agente y se los manda en un solo correo, los que otra replica ya reclamó se quedan fuera
+func (service *VencimientosContratosService) enviar(agente string, pendientes []avisoVencimiento, hoy time.Time) {
+	id := func(a avisoVencimiento) int { return a.ID }
+	scheduler.Enviar(service.bandeja(), pendientes, id, func(reclamados []avisoVencimiento) (string, error) {
+		asunto, cuerpo := mensajeVencimientos(reclamados, hoy)
+		return agente, service.Email.SendHTML(agente, asunto, cuerpo)
+	})
+}
+
+func (service *VencimientosContratosService) bandeja() *scheduler.Bandeja {
+	return bandejaCorreos(service.DB, "Avisos_Vencimiento", "id_aviso", "", intentosAvisoVencimiento)
+}
+
+// mensajeVencimientos arma el correo con una fila por contrato, del que vence primero al último
+func mensajeVencimientos(avisos []avisoVencimiento, hoy time.Time) (string, string) {
+	var filas strings.Builder
+	for _, a := range avisos {
+		cliente := html.EscapeString(a.Cliente)
+		if a.Telefono != "" {
+			cliente += " (" + html.EscapeString(a.Telefono) + ")"
+		}
+		dias := int(a.FechaFin.Sub(hoy).Hours() / 24)
+		fmt.Fprintf(&filas, "<tr><td>#%d %s</td><td>%s</td><td>%s</td><td>%s</td><td>%s (%d días)</td></tr>",
+			a.IDContrato, html.EscapeString(a.Titulo), html.EscapeString(a.Tipo), html.EscapeString(a.Propiedad), cliente,
+			a.FechaFin.Format(formatoFecha), dias)
+	}
+
+	asunto := "Contratos por vencer"
+	if len(avisos) == 1 {
+		asunto = fmt.Sprintf("El contrato %s vence el %s", avisos[0].Titulo, avisos[0].FechaFin.Format(formatoFecha))
+	}
+	cuerpo := fmt.Sprintf(`<html><body><p>Estos contratos vencen en los próximos %d días, revisa si se van a renovar:</p>
+<table border="1" cellpadding="4" cellspacing="0"><tr><th>Contrato</th><th>Tipo</th><th>Propiedad</th><th>Cliente</th><th>Vence</th></tr>%s</table>
+</body></html>`, diasAvisoVencimiento, filas.String())
+	return asunto, cuerpo
+}
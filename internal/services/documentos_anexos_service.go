@@ -36,10 +36,35 @@ func (service *DocumentosAnexosService) GetDocumentoAnexo(id int) (*models.Docum
 }
 
 // Recupera todos los documentos anexos de una propiedad
-func (service *DocumentosAnexosService) GetDocumentosByPropiedad(idPropiedad int) ([]*models.DocumentoAnexo, error) {
+func (service *DocumentosAnexosService) GetDocumentosByPropiedad(idPropiedad int, page *models.PageRequest) (*models.Page[*models.DocumentoAnexo], error) {
+	cursor, err := normalizePage(page)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []string{"id_propiedad = ?"}
+	args := []interface{}{idPropiedad}
+	total, err := countRows(service.DB, "SELECT COUNT(*) FROM Documentos_Anexos"+whereClause(conditions), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	order := pageOrder{ID: "id_documento_anexo"}
+	if cursor != nil {
+		condition, cursorArgs, err := keysetCondition(cursor, order)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+	limit, limitArgs := limitClause(page)
+	args = append(args, limitArgs...)
+
 	var documentos []*models.DocumentoAnexo
-	query := "SELECT id_documento_anexo, ruta_documento, descripcion_documento_anexo, id_propiedad FROM Documentos_Anexos WHERE id_propiedad = ?"
-	rows, err := service.DB.Query(query, idPropiedad)
+	query := "SELECT id_documento_anexo, ruta_documento, descripcion_documento_anexo, id_propiedad FROM Documentos_Anexos" +
+		whereClause(conditions) + " ORDER BY id_documento_anexo" + limit
+	rows, err := service.DB.Query(query, args...)
 	if err != nil {
 		log.Println("Error recuperando documentos anexos:", err)
 		return nil, err
@@ -60,73 +85,77 @@ func (service *DocumentosAnexosService) GetDocumentosByPropiedad(idPropiedad int
 		log.Println("Error iterando filas:", err)
 		return nil, err
 	}
-	return documentos, nil
+	return buildPage(documentos, total, page, order, func(documento *models.DocumentoAnexo) (int, interface{}) {
+		return documento.IDDocumentoAnexo, nil
+	}), nil
 }
 
 // Inserta un nuevo documento anexo en la base de datos
 func (service *DocumentosAnexosService) InsertDocumentoAnexo(documento *models.DocumentoAnexo) (int, error) {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Documentos_Anexos", "id_documento_anexo")
+	query := "INSERT INTO Documentos_Anexos(ruta_documento, descripcion_documento_anexo, id_propiedad) VALUES(?, ?, ?)"
+	id, err := database.Insert(service.DB, query, documento.RutaDocumento, documento.DescripcionDocumento, documento.IDPropiedad)
 	if err != nil {
-		log.Println("Error obteniendo último ID:", err)
+		log.Println("Error insertando documento anexo:", err)
 		return 0, err
 	}
-	documento.IDDocumentoAnexo = lastId + 1
+	documento.IDDocumentoAnexo = id
+	return documento.IDDocumentoAnexo, nil
+}
 
-	query := "INSERT INTO Documentos_Anexos(id_documento_anexo, ruta_documento, descripcion_documento_anexo, id_propiedad) VALUES(?, ?, ?, ?)"
-	result, err := service.DB.Exec(query, documento.IDDocumentoAnexo, documento.RutaDocumento, documento.DescripcionDocumento, documento.IDPropiedad)
+// helper function que inserta un documento anexo dentro de una transacción y regresa el id generado por la base de datos
+func insertDocumentoAnexoTx(tx *sql.Tx, documento *models.DocumentoAnexo) (int, error) {
+	query := "INSERT INTO Documentos_Anexos(ruta_documento, descripcion_documento_anexo, id_propiedad) VALUES(?, ?, ?)"
+	result, err := tx.Exec(query, documento.RutaDocumento, documento.DescripcionDocumento, documento.IDPropiedad)
 	if err != nil {
 		log.Println("Error insertando documento anexo:", err)
 		return 0, err
 	}
-	rows, err := result.RowsAffected()
+	id, err := result.LastInsertId()
 	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
+		log.Println("Error obteniendo ID del documento anexo:", err)
 		return 0, err
 	}
-	if rows != 1 {
-		log.Println("Error insertando documento anexo, no se afectaron filas")
-		return 0, nil
-	}
-	return documento.IDDocumentoAnexo, nil
+	return int(id), nil
 }
 
-// Actualiza un documento anexo existente por su ID
+// Actualiza un documento anexo existente por su ID. La ruta no se cambia: es la llave del archivo en el storage.
 func (service *DocumentosAnexosService) UpdateDocumentoAnexo(documento *models.DocumentoAnexo, id int) error {
-	query := "UPDATE Documentos_Anexos SET ruta_documento = ?, descripcion_documento_anexo = ?, id_propiedad = ? WHERE id_documento_anexo = ?"
-	result, err := service.DB.Exec(query, documento.RutaDocumento, documento.DescripcionDocumento, documento.IDPropiedad, id)
+	query := "UPDATE Documentos_Anexos SET descripcion_documento_anexo = ?, id_propiedad = ? WHERE id_documento_anexo = ?"
+	err := database.ExecExisting(service.DB, "Documentos_Anexos", "id_documento_anexo", id, query, documento.DescripcionDocumento, documento.IDPropiedad, id)
 	if err != nil {
 		log.Println("Error actualizando documento anexo:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
-		return err
-	}
-	if rows == 0 {
-		log.Println("Error actualizando documento anexo, no se afectaron filas")
-		return nil
-	}
 	return nil
 }
 
 // Elimina un documento anexo por su ID
 func (service *DocumentosAnexosService) DeleteDocumentoAnexo(id int) error {
 	query := "DELETE FROM Documentos_Anexos WHERE id_documento_anexo = ?"
-	result, err := service.DB.Exec(query, id)
+	err := database.ExecExisting(service.DB, "Documentos_Anexos", "id_documento_anexo", id, query, id)
 	if err != nil {
 		log.Println("Error eliminando documento anexo:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
+	return nil
+}
+
+// Inserta un documento anexo cuyo archivo ya se guardo en el storage
+func (service *DocumentosAnexosService) InsertDocumentoAnexoArchivo(documento *models.DocumentoAnexo, archivo *models.Archivo) (int, error) {
+	documento.RutaDocumento = archivo.Ruta
+	query := "INSERT INTO Documentos_Anexos(ruta_documento, descripcion_documento_anexo, id_propiedad, nombre_archivo, tipo_mime, tamano_bytes, checksum_sha256) VALUES(?, ?, ?, ?, ?, ?, ?)"
+	id, err := database.Insert(service.DB, query, documento.RutaDocumento, documento.DescripcionDocumento, documento.IDPropiedad,
+		archivo.NombreOriginal, archivo.TipoMIME, archivo.TamanoBytes, archivo.Checksum)
 	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
-		return err
-	}
-	if rows == 0 {
-		log.Println("Error eliminando documento anexo, no se afectaron filas")
-		return nil
+		log.Println("Error insertando documento anexo:", err)
+		return 0, err
 	}
-	return nil
+	documento.IDDocumentoAnexo = id
+	return documento.IDDocumentoAnexo, nil
+}
+
+// Recupera el archivo de un documento anexo, regresa nil si el documento no tiene un archivo subido
+func (service *DocumentosAnexosService) GetArchivoDocumentoAnexo(id int) (*models.Archivo, error) {
+	query := "SELECT ruta_documento, nombre_archivo, tipo_mime, tamano_bytes, checksum_sha256 FROM Documentos_Anexos WHERE id_documento_anexo = ? AND checksum_sha256 IS NOT NULL"
+	return getArchivo(service.DB, query, id)
 }
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+
+	"github.com/wneessen/go-mail"
+)
+
+// ErrEmailNotConfigured se regresa cuando faltan SMTP_USER o SMTP_PASS
+var ErrEmailNotConfigured = errors.New("smtp is not configured")
+
+// nuevoClienteSMTP crea el cliente con las credenciales de SMTP_USER y SMTP_PASS, regresa también el remitente
+func nuevoClienteSMTP() (*mail.Client, string, error) {
+	smtpUser := os.Getenv("SMTP_USER")
+	smtpPass := os.Getenv("SMTP_PASS")
+	if smtpUser == "" || smtpPass == "" {
+		return nil, "", ErrEmailNotConfigured
+	}
+	client, err := mail.NewClient("smtp.gmail.com", mail.WithSMTPAuth(mail.SMTPAuthAutoDiscover),
+		mail.WithUsername(smtpUser), mail.WithPassword(smtpPass))
+	if err != nil {
+		return nil, "", err
+	}
+	return client, smtpUser, nil
+}
+
+// SendCalendarInvite manda un correo con la invitación iCalendar. El ICS va como parte text/calendar con el método,
+// que es lo que leen Gmail y Outlook para mostrar los botones de la invitación, y también como adjunto invite.ics.
+func (s *EmailService) SendCalendarInvite(toEmail string, subject string, html string, ics []byte, metodo string) error {
+	client, from, err := nuevoClienteSMTP()
+	if err != nil {
+		return err
+	}
+
+	message := mail.NewMsg()
+	if err := message.From(from); err != nil {
+		log.Println("Error setting From address:", err)
+		return err
+	}
+	if err := message.To(toEmail); err != nil {
+		log.Println("Error setting To address:", err)
+		return err
+	}
+	message.Subject(subject)
+	message.SetBodyString(mail.TypeTextHTML, html)
+	message.AddAlternativeString(mail.ContentType("text/calendar; method="+metodo), string(ics))
+	if err := message.AttachReader("invite.ics", bytes.NewReader(ics),
+		mail.WithFileContentType(mail.ContentType("application/ics"))); err != nil {
+		log.Println("Error attaching invite:", err)
+		return err
+	}
+
+	if err := client.DialAndSend(message); err != nil {
+		log.Println("Error sending invite:", err)
+		return err
+	}
+	log.Printf("Calendar %s sent to %s", metodo, toEmail)
+	return nil
+}
+
+// Adjunto es un archivo que va en el correo
+type Adjunto struct {
+	Nombre   string
+	TipoMIME string
+	Datos    []byte
+}
+
+// SendHTML manda un correo HTML simple, lo usan los recordatorios y avisos que manda el scheduler
+func (s *EmailService) SendHTML(toEmail string, subject string, html string) error {
+	return s.SendHTMLAdjuntos(toEmail, subject, html)
+}
+
+// SendHTMLAdjuntos manda un correo HTML con archivos adjuntos, por ejemplo los estados de cuenta en PDF y CSV
+func (s *EmailService) SendHTMLAdjuntos(toEmail string, subject string, html string, adjuntos ...Adjunto) error {
+	client, from, err := nuevoClienteSMTP()
+	if err != nil {
+		return err
+	}
+
+	message := mail.NewMsg()
+	if err := message.From(from); err != nil {
+		log.Println("Error setting From address:", err)
+		return err
+	}
+	if err := message.To(toEmail); err != nil {
+		log.Println("Error setting To address:", err)
+		return err
+	}
+	message.Subject(subject)
+	message.SetBodyString(mail.TypeTextHTML, html)
+	for _, adjunto := range adjuntos {
+		if err := message.AttachReader(adjunto.Nombre, bytes.NewReader(adjunto.Datos),
+			mail.WithFileContentType(mail.ContentType(adjunto.TipoMIME))); err != nil {
+			log.Println("Error attaching file:", err)
+			return err
+		}
+	}
+
+	if err := client.DialAndSend(message); err != nil {
+		log.Println("Error sending email:", err)
+		return err
+	}
+	return nil
+}
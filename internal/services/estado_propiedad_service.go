@@ -4,9 +4,72 @@ import (
 	"backend/internal/database"
 	"backend/internal/models"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"slices"
+	"time"
 )
 
+const (
+	EstadoDisponible = "disponible"
+	EstadoApartada   = "apartada"
+	EstadoVendida    = "vendida"
+	EstadoRentada    = "rentada"
+
+	TransaccionVenta = "venta"
+	TransaccionRenta = "renta"
+)
+
+var (
+	ErrInvalidEstado     = errors.New("invalid estado")
+	ErrInvalidTransition = errors.New("invalid estado transition")
+	ErrEstadoExists      = errors.New("propiedad already has an estado")
+)
+
+// transicionesEstado son los cambios permitidos desde cada estado. Una propiedad vendida ya no cambia,
+// una rentada regresa a disponible cuando termina la renta.
+var transicionesEstado = map[string][]string{
+	EstadoDisponible: {EstadoApartada},
+	EstadoApartada:   {EstadoDisponible, EstadoVendida, EstadoRentada},
+	EstadoRentada:    {EstadoDisponible},
+}
+
+// estadoFinal indica el estado en el que termina cada tipo de transacción
+var estadoFinal = map[string]string{
+	TransaccionVenta: EstadoVendida,
+	TransaccionRenta: EstadoRentada,
+}
+
+// validarEstado revisa que el estado y el tipo de transacción existan y sean compatibles, una propiedad en venta no puede quedar rentada
+func validarEstado(estado string, tipoTransaccion string) error {
+	if _, ok := estadoFinal[tipoTransaccion]; !ok {
+		return fmt.Errorf("%w: tipo_transaccion debe ser venta o renta", ErrInvalidEstado)
+	}
+	switch estado {
+	case EstadoDisponible, EstadoApartada:
+		return nil
+	case EstadoVendida, EstadoRentada:
+		if estadoFinal[tipoTransaccion] != estado {
+			return fmt.Errorf("%w: una propiedad en %s no puede quedar %s", ErrInvalidEstado, tipoTransaccion, estado)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: estado debe ser disponible, apartada, vendida o rentada", ErrInvalidEstado)
+}
+
+// validarEstadoInicial revisa el estado con el que se crea una propiedad, solo puede empezar disponible o apartada.
+// Vendida y rentada solo se alcanzan con CambiarEstado para que queden en el historial.
+func validarEstadoInicial(estado string, tipoTransaccion string) error {
+	if err := validarEstado(estado, tipoTransaccion); err != nil {
+		return err
+	}
+	if estado != EstadoDisponible && estado != EstadoApartada {
+		return fmt.Errorf("%w: una propiedad nueva empieza disponible o apartada", ErrInvalidEstado)
+	}
+	return nil
+}
+
 type EstadoPropiedadService struct {
 	DB *sql.DB
 }
@@ -22,7 +85,7 @@ func NewEstadoPropiedadService(db *sql.DB) *EstadoPropiedadService {
 // Funcion que recupera el estado de la propiedad dependiedo del id_tipo_propiedad que biene en el get/prpopiedad/:id
 func (service *EstadoPropiedadService) GetEstadoPropiedad(id int) (*models.EstadoPropiedades, error) {
 	var estado models.EstadoPropiedades
-	query := "SELECT * FROM Estado_Propiedades WHERE id_propiedad = ?"
+	query := "SELECT id_estado_propiedades, tipo_transaccion, estado, fecha_cambio_estado, id_propiedad FROM Estado_Propiedades WHERE id_propiedad = ?"
 	err := service.DB.QueryRow(query, id).Scan(&estado.IDEstadoPropiedades, &estado.TipoTransaccion, &estado.Estado, &estado.FechaTransaccion, &estado.IDPropiedad)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -37,79 +100,191 @@ func (service *EstadoPropiedadService) GetEstadoPropiedad(id int) (*models.Estad
 }
 
 // POST /estadoPropiedad/
-// Funcion que crea un nuevo estado de la propiedad
-func (service *EstadoPropiedadService) CreateEstadoPropiedad(estado *models.EstadoPropiedades) (int, error) {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Estado_Propiedades", "id_estado_propiedades")
+// Funcion que crea el estado inicial de la propiedad, cada propiedad tiene un solo estado y los cambios se hacen con CambiarEstado
+func (service *EstadoPropiedadService) CreateEstadoPropiedad(estado *models.EstadoPropiedades, usuario string) (int, error) {
+	tx, err := service.DB.Begin()
 	if err != nil {
+		log.Println("Error starting transaction:", err)
 		return 0, err
 	}
-	estado.IDEstadoPropiedades = lastId + 1
-	query := "INSERT INTO Estado_Propiedades (id_estado_propiedades, tipo_transaccion, estado, fecha_cambio_estado, id_propiedad) VALUES (?, ?, ?, ?, ?)"
-	result, err := service.DB.Exec(query, estado.IDEstadoPropiedades, estado.TipoTransaccion, estado.Estado, estado.FechaTransaccion, estado.IDPropiedad)
+	defer tx.Rollback()
+
+	exists, err := database.RowExists(tx, "Propiedades", "id_propiedad", estado.IDPropiedad)
 	if err != nil {
-		log.Println("Error inserting estado de la propiedad:", err)
+		log.Println("Error checking propiedad:", err)
+		return 0, err
+	}
+	if !exists {
+		return 0, ErrResourceNotFound
+	}
+	exists, err = database.RowExists(tx, "Estado_Propiedades", "id_propiedad", estado.IDPropiedad)
+	if err != nil {
+		log.Println("Error checking estado de la propiedad:", err)
 		return 0, err
 	}
-	rows, err := result.RowsAffected()
+	if exists {
+		return 0, ErrEstadoExists
+	}
+
+	estado.IDEstadoPropiedades, err = insertEstadoPropiedadTx(tx, estado, usuario)
 	if err != nil {
-		log.Println("Error getting rows affected:", err)
 		return 0, err
 	}
-	if rows != 1 {
-		log.Println("Error inserting estado: no rows affected")
+	if err := tx.Commit(); err != nil {
+		log.Println("Error inserting estado de la propiedad:", err)
 		return 0, err
 	}
 	return estado.IDEstadoPropiedades, nil
 }
 
-// PUT /estadoPropiedad/:id
-// Funcion que actualiza el estado de la propiedad
-func (service *EstadoPropiedadService) UpdateEstadoPropiedad(estado *models.EstadoPropiedades) error {
-	query := "UPDATE Estado_Propiedades SET tipo_transaccion = ?, estado = ?, fecha_transaccion = ?, id_propiedad = ? WHERE id_estado_propiedades = ?"
-	result, err := service.DB.Exec(query, estado.TipoTransaccion, estado.Estado, estado.FechaTransaccion, estado.IDPropiedad, estado.IDEstadoPropiedades)
-	if err != nil {
-		log.Println("Error updating estado de la propiedad:", err)
-		return err
+// helper function que inserta el estado inicial dentro de una transacción junto con su primer registro en el historial.
+// La fecha siempre es la del servidor, la que mande el cliente se ignora.
+func insertEstadoPropiedadTx(tx *sql.Tx, estado *models.EstadoPropiedades, usuario string) (int, error) {
+	if err := validarEstadoInicial(estado.Estado, estado.TipoTransaccion); err != nil {
+		return 0, err
 	}
-	rows, err := result.RowsAffected()
+	estado.FechaTransaccion = sql.NullTime{Time: time.Now(), Valid: true}
+
+	query := "INSERT INTO Estado_Propiedades (tipo_transaccion, estado, fecha_cambio_estado, id_propiedad) VALUES (?, ?, ?, ?)"
+	id, err := database.Insert(tx, query, estado.TipoTransaccion, estado.Estado, estado.FechaTransaccion, estado.IDPropiedad)
 	if err != nil {
-		log.Println("Error getting rows affected:", err)
-		return err
+		log.Println("Error inserting estado de la propiedad:", err)
+		return 0, err
 	}
-	if rows != 1 {
-		log.Println("Error updating estado: no rows affected")
-		return err
+	if err := insertHistorialTx(tx, estado, nil, usuario, ""); err != nil {
+		return 0, err
 	}
-	return nil
+	return id, nil
 }
 
-// DELETE /eliminar/estadoPropiedad
-// Function that deletes a EstadoPropiedad from the database
-func (service *EstadoPropiedadService) DeleteEstadoPropiedad(id int) error {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Estado_Propiedades", "id_estado_propiedades")
+// helper function que agrega un registro al historial, el historial solo se inserta nunca se actualiza ni se borra
+func insertHistorialTx(tx *sql.Tx, estado *models.EstadoPropiedades, anterior *string, usuario string, comentario string) error {
+	query := `INSERT INTO Historial_Estado_Propiedades (id_propiedad, estado_anterior, estado_nuevo, tipo_transaccion, usuario, comentario, fecha_cambio)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?)`
+	_, err := tx.Exec(query, estado.IDPropiedad, anterior, estado.Estado, estado.TipoTransaccion, usuario, comentario, estado.FechaTransaccion)
 	if err != nil {
-		log.Println("Error getting last ID:", err)
+		log.Println("Error inserting historial de estado:", err)
 		return err
 	}
-	if id <= 0 || id > lastId {
-		log.Println("Invalid estado ID:", id)
-		return err
+	return nil
+}
+
+// PUT /propiedades/:id/estado
+// CambiarEstado mueve la propiedad al nuevo estado si la transición es valida y lo registra en el historial.
+// El tipo de transacción solo se puede cambiar mientras la propiedad esta disponible.
+func (service *EstadoPropiedadService) CambiarEstado(idPropiedad int, cambio *models.CambioEstadoPropiedad, usuario string) (*models.EstadoPropiedades, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return nil, err
 	}
-	query := "DELETE FROM Estado_Propiedades WHERE id_estado_propiedades = ?"
-	result, err := service.DB.Exec(query, id)
+	defer tx.Rollback()
+
+	var estado models.EstadoPropiedades
+	query := "SELECT id_estado_propiedades, tipo_transaccion, estado, id_propiedad FROM Estado_Propiedades WHERE id_propiedad = ? FOR UPDATE"
+	err = tx.QueryRow(query, idPropiedad).Scan(&estado.IDEstadoPropiedades, &estado.TipoTransaccion, &estado.Estado, &estado.IDPropiedad)
 	if err != nil {
-		log.Println("Error deleting estado de la propiedad:", err)
-		return err
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		log.Println("Error fetching estado:", err)
+		return nil, err
+	}
+	anterior := estado.Estado
+
+	tipo := estado.TipoTransaccion
+	if cambio.TipoTransaccion != "" && cambio.TipoTransaccion != tipo {
+		if anterior != EstadoDisponible {
+			return nil, fmt.Errorf("%w: el tipo de transacción solo cambia con la propiedad disponible", ErrInvalidTransition)
+		}
+		tipo = cambio.TipoTransaccion
+	}
+	if err := validarEstado(cambio.Estado, tipo); err != nil {
+		return nil, err
+	}
+	if cambio.Estado == anterior && tipo == estado.TipoTransaccion {
+		return nil, fmt.Errorf("%w: la propiedad ya esta %s", ErrInvalidTransition, anterior)
+	}
+	if cambio.Estado != anterior && !slices.Contains(transicionesEstado[anterior], cambio.Estado) {
+		return nil, fmt.Errorf("%w: de %s a %s", ErrInvalidTransition, anterior, cambio.Estado)
+	}
+
+	estado.Estado = cambio.Estado
+	estado.TipoTransaccion = tipo
+	estado.FechaTransaccion = sql.NullTime{Time: time.Now(), Valid: true}
+	query = "UPDATE Estado_Propiedades SET tipo_transaccion = ?, estado = ?, fecha_cambio_estado = ? WHERE id_estado_propiedades = ?"
+	if _, err := tx.Exec(query, estado.TipoTransaccion, estado.Estado, estado.FechaTransaccion, estado.IDEstadoPropiedades); err != nil {
+		log.Println("Error updating estado de la propiedad:", err)
+		return nil, err
+	}
+	if err := insertHistorialTx(tx, &estado, &anterior, usuario, cambio.Comentario); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing estado de la propiedad:", err)
+		return nil, err
 	}
-	rows, err := result.RowsAffected()
+	return &estado, nil
+}
+
+// GET /propiedades/:id/historial
+// GetHistorial regresa los cambios de estado de la propiedad del mas antiguo al mas reciente, ErrResourceNotFound si
+// la propiedad no existe
+func (service *EstadoPropiedadService) GetHistorial(idPropiedad int) ([]*models.HistorialEstadoPropiedad, error) {
+	query := `SELECT id_historial, id_propiedad, estado_anterior, estado_nuevo, tipo_transaccion, usuario, comentario, fecha_cambio
+		FROM Historial_Estado_Propiedades WHERE id_propiedad = ? ORDER BY fecha_cambio, id_historial`
+	rows, err := service.DB.Query(query, idPropiedad)
 	if err != nil {
-		log.Println("Error getting rows affected:", err)
-		return err
+		log.Println("Error fetching historial:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	historial := []*models.HistorialEstadoPropiedad{}
+	for rows.Next() {
+		var registro models.HistorialEstadoPropiedad
+		var anterior, comentario sql.NullString
+		err := rows.Scan(&registro.IDHistorial, &registro.IDPropiedad, &anterior, &registro.EstadoNuevo, &registro.TipoTransaccion,
+			&registro.Usuario, &comentario, &registro.FechaCambio)
+		if err != nil {
+			log.Println("Error scanning historial:", err)
+			return nil, err
+		}
+		if anterior.Valid {
+			registro.EstadoAnterior = &anterior.String
+		}
+		if comentario.Valid {
+			registro.Comentario = &comentario.String
+		}
+		historial = append(historial, &registro)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating historial:", err)
+		return nil, err
+	}
+	// El historial se conserva al eliminar la propiedad, solo es 404 si tampoco tiene historial
+	if len(historial) == 0 {
+		var found int
+		err := service.DB.QueryRow("SELECT 1 FROM Propiedades WHERE id_propiedad = ?", idPropiedad).Scan(&found)
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		if err != nil {
+			log.Println("Error checking propiedad:", err)
+			return nil, err
+		}
 	}
-	if rows == 0 {
-		log.Println("Error deleting estado: no rows affected")
+	return historial, nil
+}
+
+// DELETE /eliminar/estadoPropiedad
+// Function that deletes a EstadoPropiedad from the database, solo los admin lo usan para corregir un estado mal capturado
+func (service *EstadoPropiedadService) DeleteEstadoPropiedad(id int) error {
+	query := "DELETE FROM Estado_Propiedades WHERE id_estado_propiedades = ?"
+	err := database.ExecExisting(service.DB, "Estado_Propiedades", "id_estado_propiedades", id, query, id)
+	if err != nil {
+		log.Println("Error deleting estado de la propiedad:", err)
 		return err
 	}
 	return nil
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidarEstadoInicial(t *testing.T) {
+	tests := []struct {
+		estado string
+		tipo   string
+		valido bool
+	}{
+		{EstadoDisponible, TransaccionVenta, true},
+		{EstadoApartada, TransaccionRenta, true},
+		{EstadoVendida, TransaccionVenta, false},
+		{EstadoRentada, TransaccionRenta, false},
+		{EstadoRentada, TransaccionVenta, false},
+		{"ocupada", TransaccionVenta, false},
+		{EstadoDisponible, "permuta", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.estado+" en "+tt.tipo, func(t *testing.T) {
+			err := validarEstadoInicial(tt.estado, tt.tipo)
+			if tt.valido && err != nil {
+				t.Errorf("validarEstadoInicial = %v, se esperaba válido", err)
+			}
+			if !tt.valido && !errors.Is(err, ErrInvalidEstado) {
+				t.Errorf("validarEstadoInicial = %v, se esperaba ErrInvalidEstado", err)
+			}
+		})
+	}
+}
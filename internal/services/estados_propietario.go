@@ -0,0 +1,316 @@
+package services
+
+import (
+	"backend/internal/models"
+	"backend/internal/scheduler"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const intentosEstadoPropietario = 5
+
+var ErrEnvioEstado = errors.New("statement email failed")
+
+// GET /propietarios/:id/estado-cuenta?anio=&mes=
+// Funcion que arma el estado de cuenta del mes del propietario: por cada propiedad rentada la renta cobrada, la comisión
+// retenida y lo que se le entrega; las ventas firmadas en el mes van aparte y no entran en los totales
+func (service *ComisionesService) GetEstadoPropietario(id int, filtro *models.FiltroPeriodo) (*models.EstadoPropietario, error) {
+	periodo, desde, hasta, err := periodoMes(filtro, service.ZonaDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	estado := models.EstadoPropietario{IDPropietario: id, Periodo: periodo, Desde: desde, Hasta: hasta,
+		Rentas: []*models.RentaPropietario{}, Ventas: []*models.VentaPropietario{}}
+	var nombre, apellidoP, apellidoM, correo sql.NullString
+	query := `SELECT nombre_propietario, apellido_paterno_propietario, apellido_materno_propietario, correo_propietario
+		FROM Propietario WHERE id_propietario = ?`
+	err = service.DB.QueryRow(query, id).Scan(&nombre, &apellidoP, &apellidoM, &correo)
+	if err == sql.ErrNoRows {
+		return nil, ErrResourceNotFound
+	}
+	if err != nil {
+		log.Println("Error fetching propietario:", err)
+		return nil, err
+	}
+	estado.Propietario = nombreCompleto(nombre.String, apellidoP.String, apellidoM.String)
+	estado.Correo = strings.TrimSpace(correo.String)
+
+	periodos, err := service.comisionesPeriodo(desde, hasta, "Propiedades.id_propietario = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	porPropiedad := map[int]*models.RentaPropietario{}
+	montos := map[int][4]int64{} // Cobrado, recargos, comisión y vencido de cada propiedad
+	var cobrado, comision int64
+	for _, p := range periodos {
+		cuenta := p.Cuenta
+		if cuenta.Tipo == TransaccionVenta {
+			estado.Ventas = append(estado.Ventas, &models.VentaPropietario{IDContrato: cuenta.IDContrato, IDPropiedad: cuenta.IDPropiedad,
+				TituloPropiedad: cuenta.Propiedad, FechaFirma: p.Firma, Precio: pesos(p.Cobrado), Comision: pesos(p.Comision),
+				Neto: pesos(p.Cobrado - p.Comision)})
+			continue
+		}
+		renta, ok := porPropiedad[cuenta.IDPropiedad]
+		if !ok {
+			renta = &models.RentaPropietario{IDPropiedad: cuenta.IDPropiedad, TituloPropiedad: cuenta.Propiedad}
+			porPropiedad[cuenta.IDPropiedad] = renta
+			estado.Rentas = append(estado.Rentas, renta)
+		}
+		// Los contratos vienen en orden de id, el inquilino que queda es el del contrato más nuevo
+		renta.Contratos = append(renta.Contratos, cuenta.IDContrato)
+		if cuenta.Inquilino != "" {
+			renta.Inquilino = cuenta.Inquilino
+		}
+		m := montos[cuenta.IDPropiedad]
+		m[0], m[1], m[2], m[3] = m[0]+p.Cobrado, m[1]+p.Recargos, m[2]+p.Comision, m[3]+p.Vencido
+		montos[cuenta.IDPropiedad] = m
+		cobrado += p.Cobrado + p.Recargos
+		comision += p.Comision
+	}
+	for id, renta := range porPropiedad {
+		m := montos[id]
+		renta.RentaCobrada, renta.Recargos, renta.Comision = pesos(m[0]), pesos(m[1]), pesos(m[2])
+		renta.Neto, renta.SaldoVencido = pesos(m[0]+m[1]-m[2]), pesos(m[3])
+	}
+	sort.SliceStable(estado.Rentas, func(i, j int) bool { return estado.Rentas[i].IDPropiedad < estado.Rentas[j].IDPropiedad })
+	estado.TotalCobrado, estado.TotalComision, estado.TotalNeto = pesos(cobrado), pesos(comision), pesos(cobrado-comision)
+	return &estado, nil
+}
+
+// nombreMes escribe el periodo YYYY-MM como "marzo de 2026"
+func nombreMes(periodo string) string {
+	t, err := time.Parse("2006-01", periodo)
+	if err != nil {
+		return periodo
+	}
+	return fmt.Sprintf("%s de %d", mesesContrato[t.Month()-1], t.Year())
+}
+
+// archivoEstado es el nombre de los archivos del estado de cuenta sin extensión
+func archivoEstado(estado *models.EstadoPropietario) string {
+	return fmt.Sprintf("estado-cuenta-%d-%s", estado.IDPropietario, estado.Periodo)
+}
+
+// PDFEstadoPropietario arma el estado de cuenta en PDF
+func PDFEstadoPropietario(estado *models.EstadoPropietario) ([]byte, error) {
+	desde, _ := time.Parse(formatoFecha, estado.Desde)
+	hasta, _ := time.Parse(formatoFecha, estado.Hasta)
+	pdf := nuevoPDF("Estado de cuenta " + estado.Periodo)
+	pdf.encabezado("Estado de cuenta de " + nombreMes(estado.Periodo))
+	pdf.parrafo(fmt.Sprintf("Propietario: %s\nPeriodo: del %s al %s", estado.Propietario, fechaLarga(desde), fechaLarga(hasta)), false)
+
+	if len(estado.Rentas) == 0 {
+		pdf.parrafo("No hubo rentas cobradas en el periodo.", false)
+	}
+	for _, renta := range estado.Rentas {
+		pdf.parrafo(renta.TituloPropiedad, true)
+		var contratos []string
+		for _, id := range renta.Contratos {
+			contratos = append(contratos, strconv.Itoa(id))
+		}
+		texto := "Contratos: " + strings.Join(contratos, ", ")
+		if renta.Inquilino != "" {
+			texto += "\nInquilino: " + renta.Inquilino
+		}
+		texto += fmt.Sprintf("\nRenta cobrada: %s\nRecargos cobrados: %s\nComisión retenida: %s\nNeto a entregar: %s",
+			formatoMoneda(renta.RentaCobrada), formatoMoneda(renta.Recargos), formatoMoneda(renta.Comision), formatoMoneda(renta.Neto))
+		if renta.SaldoVencido > 0 {
+			texto += "\nSaldo vencido del inquilino al cierre: " + formatoMoneda(renta.SaldoVencido)
+		}
+		pdf.parrafo(texto, false)
+	}
+	pdf.espacio(tamanoTextoPDF)
+	pdf.parrafo(fmt.Sprintf("Total cobrado: %s\nTotal de comisiones: %s\nTotal a entregar: %s",
+		formatoMoneda(estado.TotalCobrado), formatoMoneda(estado.TotalComision), formatoMoneda(estado.TotalNeto)), true)
+
+	if len(estado.Ventas) > 0 {
+		pdf.parrafo("Ventas firmadas en el periodo", true)
+		for _, venta := range estado.Ventas {
+			firma, _ := time.Parse(formatoFecha, venta.FechaFirma)
+			pdf.parrafo(fmt.Sprintf("%s (contrato %d)\nFirmada el %s\nPrecio: %s\nComisión: %s\nNeto: %s", venta.TituloPropiedad,
+				venta.IDContrato, fechaLarga(firma), formatoMoneda(venta.Precio), formatoMoneda(venta.Comision), formatoMoneda(venta.Neto)), false)
+		}
+	}
+	return pdf.Bytes()
+}
+
+// CSVEstadoPropietario arma el estado de cuenta en CSV, un renglón por propiedad rentada y por venta y al final el total
+func CSVEstadoPropietario(estado *models.EstadoPropietario) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	importe := func(monto float64) string { return strconv.FormatFloat(monto, 'f', 2, 64) }
+
+	renglones := [][]string{{"concepto", "id_propiedad", "propiedad", "contratos", "inquilino", "fecha_firma", "cobrado",
+		"recargos", "comision", "neto", "saldo_vencido"}}
+	var recargos int64
+	for _, renta := range estado.Rentas {
+		var contratos []string
+		for _, id := range renta.Contratos {
+			contratos = append(contratos, strconv.Itoa(id))
+		}
+		recargos += centavos(renta.Recargos)
+		renglones = append(renglones, []string{"renta", strconv.Itoa(renta.IDPropiedad), renta.TituloPropiedad,
+			strings.Join(contratos, " "), renta.Inquilino, "", importe(renta.RentaCobrada), importe(renta.Recargos),
+			importe(renta.Comision), importe(renta.Neto), importe(renta.SaldoVencido)})
+	}
+	for _, venta := range estado.Ventas {
+		renglones = append(renglones, []string{"venta", strconv.Itoa(venta.IDPropiedad), venta.TituloPropiedad,
+			strconv.Itoa(venta.IDContrato), "", venta.FechaFirma, importe(venta.Precio), "", importe(venta.Comision),
+			importe(venta.Neto), ""})
+	}
+	renglones = append(renglones, []string{"total", "", "", "", "", "", importe(estado.TotalCobrado - pesos(recargos)),
+		importe(pesos(recargos)), importe(estado.TotalComision), importe(estado.TotalNeto), ""})
+
+	if err := w.WriteAll(renglones); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mensajeEstado arma el correo del estado de cuenta, el detalle va en los adjuntos
+func mensajeEstado(estado *models.EstadoPropietario) (string, string) {
+	asunto := "Estado de cuenta de " + nombreMes(estado.Periodo)
+	cuerpo := fmt.Sprintf(`<html><body><p>Hola %s,</p>
+<p>Te mandamos el estado de cuenta de tus propiedades de %s.</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><td>Total cobrado</td><td>%s</td></tr>
+<tr><td>Comisiones</td><td>%s</td></tr>
+<tr><td>Total a entregar</td><td><b>%s</b></td></tr>
+</table>
+<p>El detalle por propiedad va adjunto en PDF y CSV.</p>
+</body></html>`, html.EscapeString(estado.Propietario), nombreMes(estado.Periodo), formatoMoneda(estado.TotalCobrado),
+		formatoMoneda(estado.TotalComision), formatoMoneda(estado.TotalNeto))
+	return asunto, cuerpo
+}
+
+// enviarEstado le manda al propietario el estado de cuenta con el PDF y el CSV adjuntos
+func (service *ComisionesService) enviarEstado(estado *models.EstadoPropietario) error {
+	pdf, err := PDFEstadoPropietario(estado)
+	if err != nil {
+		log.Println("Error building estado de cuenta PDF:", err)
+		return err
+	}
+	tabla, err := CSVEstadoPropietario(estado)
+	if err != nil {
+		log.Println("Error building estado de cuenta CSV:", err)
+		return err
+	}
+	asunto, cuerpo := mensajeEstado(estado)
+	nombre := archivoEstado(estado)
+	return service.Email.SendHTMLAdjuntos(estado.Correo, asunto, cuerpo,
+		Adjunto{Nombre: nombre + ".pdf", TipoMIME: "application/pdf", Datos: pdf},
+		Adjunto{Nombre: nombre + ".csv", TipoMIME: "text/csv", Datos: tabla})
+}
+
+// POST /propietarios/:id/estado-cuenta/enviar?anio=&mes=
+// Funcion que manda el estado de cuenta del mes al correo del propietario y lo marca como enviado
+func (service *ComisionesService) EnviarEstadoPropietario(id int, filtro *models.FiltroPeriodo) (*models.EstadoPropietario, error) {
+	estado, err := service.GetEstadoPropietario(id, filtro)
+	if err != nil {
+		return nil, err
+	}
+	if estado.Correo == "" {
+		return nil, fmt.Errorf("%w: el propietario no tiene correo", ErrInvalidContacto)
+	}
+	if err := service.enviarEstado(estado); err != nil {
+		if errors.Is(err, ErrEmailNotConfigured) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrEnvioEstado, err)
+	}
+
+	query := `INSERT INTO Envios_Estado_Propietario (id_propietario, periodo, correo, estado, intentos, creado_en, enviado_en)
+		VALUES (?, ?, ?, 'enviado', 0, ?, ?)
+		ON DUPLICATE KEY UPDATE estado = 'enviado', correo = VALUES(correo), enviado_en = VALUES(enviado_en), ultimo_error = NULL`
+	ahora := time.Now().UTC()
+	if _, err := service.DB.Exec(query, id, estado.Desde, estado.Correo, ahora, ahora); err != nil {
+		log.Println("Error saving envio de estado de cuenta:", err)
+	}
+	return estado, nil
+}
+
+// Ejecutar encola el estado de cuenta del mes pasado de cada propietario con correo y contratos, y manda los pendientes.
+// Lo llama el scheduler cada hora, cada propietario recibe un solo correo por mes.
+func (service *ComisionesService) Ejecutar() error {
+	// Los que se quedaron en 'enviando' por un reinicio se vuelven a mandar
+	if err := service.bandeja().Liberar(); err != nil {
+		return err
+	}
+
+	_, desde, _, err := periodoMes(&models.FiltroPeriodo{}, service.ZonaDefault)
+	if err != nil {
+		return err
+	}
+	query := `INSERT IGNORE INTO Envios_Estado_Propietario (id_propietario, periodo, estado, intentos, creado_en)
+		SELECT Propietario.id_propietario, ?, 'pendiente', 0, ?
+		FROM Propietario
+		WHERE Propietario.correo_propietario IS NOT NULL AND Propietario.correo_propietario <> ''
+			AND EXISTS (SELECT 1 FROM Contratos
+				INNER JOIN Propiedades ON Propiedades.id_propiedad = Contratos.id_propiedad
+				WHERE Propiedades.id_propietario = Propietario.id_propietario AND Contratos.tipo IN (?, ?) AND Contratos.estado <> ?)`
+	_, err = service.DB.Exec(query, desde, time.Now().UTC(), TransaccionRenta, TransaccionVenta, EstadoContratoBorrador)
+	if err != nil {
+		log.Println("Error scheduling estados de cuenta:", err)
+		return err
+	}
+
+	rows, err := service.DB.Query("SELECT id_envio, id_propietario, periodo FROM Envios_Estado_Propietario WHERE estado = 'pendiente'")
+	if err != nil {
+		log.Println("Error fetching envios de estado de cuenta:", err)
+		return err
+	}
+	type envio struct {
+		id, idPropietario int
+		periodo           time.Time
+	}
+	var pendientes []envio
+	for rows.Next() {
+		var e envio
+		if err := rows.Scan(&e.id, &e.idPropietario, &e.periodo); err != nil {
+			rows.Close()
+			log.Println("Error scanning envio de estado de cuenta:", err)
+			return err
+		}
+		pendientes = append(pendientes, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return err
+	}
+
+	id := func(e envio) int { return e.id }
+	for _, e := range pendientes {
+		anio, mes := e.periodo.Year(), int(e.periodo.Month())
+		scheduler.Enviar(service.bandeja(), []envio{e}, id, func([]envio) (string, error) {
+			return service.enviarPendiente(e.idPropietario, &models.FiltroPeriodo{Anio: &anio, Mes: &mes})
+		})
+	}
+	return nil
+}
+
+// enviarPendiente manda un estado de cuenta que ya se reclamó y regresa el correo; sin rentas ni ventas en el mes se cancela
+func (service *ComisionesService) enviarPendiente(idPropietario int, filtro *models.FiltroPeriodo) (string, error) {
+	estado, err := service.GetEstadoPropietario(idPropietario, filtro)
+	if err != nil {
+		return "", err
+	}
+	if estado.Correo == "" || (len(estado.Rentas) == 0 && len(estado.Ventas) == 0) {
+		return "", scheduler.ErrCancelado
+	}
+	return estado.Correo, service.enviarEstado(estado)
+}
+
+func (service *ComisionesService) bandeja() *scheduler.Bandeja {
+	return bandejaCorreos(service.DB, "Envios_Estado_Propietario", "id_envio", "correo", intentosEstadoPropietario)
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Métodos de iTIP (RFC 5546) que usa la API
+const (
+	MetodoICSPublish = "PUBLISH"
+	MetodoICSRequest = "REQUEST"
+	MetodoICSCancel  = "CANCEL"
+)
+
+const (
+	prodIDICS       = "-//InmoSoft//Citas//ES"
+	formatoICS      = "20060102T150405Z"
+	formatoLocalICS = "20060102T150405"
+	largoLineaICS   = 75
+)
+
+// eventoICS es un VEVENT, las horas se escriben en UTC salvo que tenga Zona
+type eventoICS struct {
+	UID             string
+	Secuencia       int
+	Inicio          time.Time
+	Fin             time.Time
+	Titulo          string
+	Descripcion     string
+	Organizador     string
+	NombreOrg       string
+	Asistente       string
+	NombreAsistente string
+	Cancelado       bool
+	// Solo en las series: la regla, las ocurrencias exceptuadas y la zona en que se repiten
+	RRule   string
+	ExDates []time.Time
+	// Solo en una ocurrencia editada aparte, el inicio original; el UID es el de la serie
+	RecurrenceID *time.Time
+	// Con Zona las horas van con TZID (nombre IANA) para que la serie respete el horario de verano
+	Zona *time.Location
+}
+
+// fechaICS escribe la propiedad con la hora en UTC, o en la zona con TZID
+func fechaICS(propiedad string, zona *time.Location, fechas ...time.Time) string {
+	valores := make([]string, len(fechas))
+	if zona == nil || zona == time.UTC {
+		for i, fecha := range fechas {
+			valores[i] = fecha.UTC().Format(formatoICS)
+		}
+		return propiedad + ":" + strings.Join(valores, ",")
+	}
+	for i, fecha := range fechas {
+		valores[i] = fecha.In(zona).Format(formatoLocalICS)
+	}
+	return propiedad + ";TZID=" + zona.String() + ":" + strings.Join(valores, ",")
+}
+
+// uidCita es el UID de la cita en todos los calendarios, no cambia aunque la cita se mueva o se cancele.
+// El dominio se toma de ICS_UID_DOMAIN y no debe cambiar una vez que se mandaron invitaciones.
+func uidCita(id int) string {
+	dominio := os.Getenv("ICS_UID_DOMAIN")
+	if dominio == "" {
+		dominio = "inmosoft.local"
+	}
+	return fmt.Sprintf("cita-%d@%s", id, dominio)
+}
+
+// generarICS arma un VCALENDAR con el método y los eventos indicados
+func generarICS(metodo string, nombre string, eventos []eventoICS, ahora time.Time) []byte {
+	var buf bytes.Buffer
+	linea := func(texto string) {
+		buf.WriteString(plegarLineaICS(texto))
+		buf.WriteString("\r\n")
+	}
+
+	linea("BEGIN:VCALENDAR")
+	linea("VERSION:2.0")
+	linea("PRODID:" + prodIDICS)
+	linea("CALSCALE:GREGORIAN")
+	linea("METHOD:" + metodo)
+	if nombre != "" {
+		linea("X-WR-CALNAME:" + escaparTextoICS(nombre))
+	}
+	for _, evento := range eventos {
+		linea("BEGIN:VEVENT")
+		linea("UID:" + evento.UID)
+		linea("SEQUENCE:" + fmt.Sprint(evento.Secuencia))
+		linea("DTSTAMP:" + ahora.UTC().Format(formatoICS))
+		linea(fechaICS("DTSTART", evento.Zona, evento.Inicio))
+		linea(fechaICS("DTEND", evento.Zona, evento.Fin))
+		if evento.RRule != "" {
+			linea("RRULE:" + evento.RRule)
+			if len(evento.ExDates) > 0 {
+				linea(fechaICS("EXDATE", evento.Zona, evento.ExDates...))
+			}
+		}
+		if evento.RecurrenceID != nil {
+			linea(fechaICS("RECURRENCE-ID", evento.Zona, *evento.RecurrenceID))
+		}
+		linea("SUMMARY:" + escaparTextoICS(evento.Titulo))
+		if evento.Descripcion != "" {
+			linea("DESCRIPTION:" + escaparTextoICS(evento.Descripcion))
+		}
+		if evento.Organizador != "" {
+			linea("ORGANIZER" + parametroCN(evento.NombreOrg) + ":mailto:" + evento.Organizador)
+		}
+		if evento.Asistente != "" {
+			linea("ATTENDEE" + parametroCN(evento.NombreAsistente) + ";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:" + evento.Asistente)
+		}
+		if evento.Cancelado {
+			linea("STATUS:CANCELLED")
+		} else {
+			linea("STATUS:CONFIRMED")
+		}
+		linea("TRANSP:OPAQUE")
+		linea("END:VEVENT")
+	}
+	linea("END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// escaparTextoICS escapa los caracteres especiales de un valor TEXT (RFC 5545 3.3.11)
+func escaparTextoICS(texto string) string {
+	texto = strings.ReplaceAll(texto, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", `\n`).Replace(texto)
+}
+
+// parametroCN regresa el parametro ;CN= con el nombre entre comillas, las comillas no se permiten dentro del valor
+func parametroCN(nombre string) string {
+	nombre = strings.TrimSpace(strings.NewReplacer(`"`, "", "\r", " ", "\n", " ").Replace(nombre))
+	if nombre == "" {
+		return ""
+	}
+	return `;CN="` + nombre + `"`
+}
+
+// plegarLineaICS corta las lineas de mas de 75 octetos sin partir caracteres UTF-8 (RFC 5545 3.1)
+func plegarLineaICS(linea string) string {
+	if len(linea) <= largoLineaICS {
+		return linea
+	}
+	var buf strings.Builder
+	limite := largoLineaICS
+	for len(linea) > limite {
+		corte := limite
+		for corte > 0 && !utf8.RuneStart(linea[corte]) {
+			corte--
+		}
+		buf.WriteString(linea[:corte])
+		buf.WriteString("\r\n ")
+		linea = linea[corte:]
+		// Las lineas de continuación empiezan con un espacio que cuenta en el limite
+		limite = largoLineaICS - 1
+	}
+	buf.WriteString(linea)
+	return buf.String()
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestPlegarLineaICS(t *testing.T) {
+	tests := []struct {
+		nombre string
+		linea  string
+		lineas int
+	}{
+		{"corta", "SUMMARY:Visita", 1},
+		{"exactamente 75 octetos", "SUMMARY:" + strings.Repeat("a", 67), 1},
+		{"76 octetos", "SUMMARY:" + strings.Repeat("a", 68), 2},
+		// 75 + 74 = 149 octetos caben en dos lineas, uno más necesita tres
+		{"llena dos lineas", strings.Repeat("a", 149), 2},
+		{"pasa a la tercera", strings.Repeat("a", 150), 3},
+		{"acentos en el corte", "DESCRIPTION:" + strings.Repeat("á", 100), 3},
+		{"emoji en el corte", "SUMMARY:" + strings.Repeat("x", 66) + "🏠🏠🏠", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			plegada := plegarLineaICS(tt.linea)
+			partes := strings.Split(plegada, "\r\n")
+			if len(partes) != tt.lineas {
+				t.Fatalf("%d lineas, se esperaban %d: %q", len(partes), tt.lineas, plegada)
+			}
+			var desplegada strings.Builder
+			for i, parte := range partes {
+				if len(parte) > largoLineaICS {
+					t.Errorf("la linea %d tiene %d octetos", i, len(parte))
+				}
+				if i > 0 {
+					if !strings.HasPrefix(parte, " ") {
+						t.Fatalf("la linea de continuación %d no empieza con espacio: %q", i, parte)
+					}
+					parte = parte[1:]
+				}
+				if !utf8.ValidString(parte) {
+					t.Errorf("la linea %d parte un caracter UTF-8: %q", i, parte)
+				}
+				desplegada.WriteString(parte)
+			}
+			if desplegada.String() != tt.linea {
+				t.Errorf("al desplegar queda %q, se esperaba %q", desplegada.String(), tt.linea)
+			}
+		})
+	}
+}
+
+func TestEscaparTextoICS(t *testing.T) {
+	tests := []struct {
+		texto string
+		want  string
+	}{
+		{"Visita", "Visita"},
+		{"Casa; jardín, alberca", `Casa\; jardín\, alberca`},
+		{`C:\ruta`, `C:\\ruta`},
+		{"línea 1\r\nlínea 2\nlínea 3", `línea 1\nlínea 2\nlínea 3`},
+	}
+	for _, tt := range tests {
+		if got := escaparTextoICS(tt.texto); got != tt.want {
+			t.Errorf("escaparTextoICS(%q) = %q, se esperaba %q", tt.texto, got, tt.want)
+		}
+	}
+}
+
+func TestFechaICS(t *testing.T) {
+	inicio := time.Date(2024, 12, 16, 16, 0, 0, 0, time.UTC)
+	if got := fechaICS("DTSTART", nil, inicio); got != "DTSTART:20241216T160000Z" {
+		t.Errorf("en UTC = %q", got)
+	}
+	mexico, err := time.LoadLocation("America/Mexico_City")
+	if err != nil {
+		t.Skip("sin base de zonas horarias:", err)
+	}
+	got := fechaICS("EXDATE", mexico, inicio, inicio.AddDate(0, 0, 7))
+	if want := "EXDATE;TZID=America/Mexico_City:20241216T100000,20241223T100000"; got != want {
+		t.Errorf("con zona = %q, se esperaba %q", got, want)
+	}
+}
+
+func TestParametroCN(t *testing.T) {
+	tests := []struct {
+		nombre string
+		want   string
+	}{
+		{"Ana López", `;CN="Ana López"`},
+		{`Ana "La Jefa"` + "\r\nLópez", `;CN="Ana La Jefa  López"`},
+		{"  ", ""},
+	}
+	for _, tt := range tests {
+		if got := parametroCN(tt.nombre); got != tt.want {
+			t.Errorf("parametroCN(%q) = %q, se esperaba %q", tt.nombre, got, tt.want)
+		}
+	}
+}
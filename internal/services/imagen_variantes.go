@@ -0,0 +1,344 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// tamaño de cada variante, es el ancho maximo en pixeles
+var tamanosVariantes = []struct {
+	Nombre string
+	Ancho  int
+}{
+	{"small", 320},
+	{"medium", 768},
+	{"large", 1280},
+}
+
+const (
+	anchoPlaceholder   = 16
+	calidadJPEG        = 82
+	calidadPlaceholder = 40
+	// Una imagen decodificada ocupa 4 bytes por pixel, 40 megapixeles son unos 160 MB
+	pixelesMaximoImagen = 40_000_000
+)
+
+// ErrImagenDemasiadoGrande se regresa cuando las dimensiones de la imagen pasan de pixelesMaximoImagen
+var ErrImagenDemasiadoGrande = errors.New("image dimensions too large")
+
+// varianteGenerada es una variante ya codificada lista para guardarse en el storage
+type varianteGenerada struct {
+	Nombre  string
+	Formato string
+	Ancho   int
+	Alto    int
+	Datos   []byte
+}
+
+// generarVariantes decodifica la imagen original y regresa sus variantes en JPEG y WebP junto con el placeholder.
+// La orientación EXIF se aplica a los pixeles porque las variantes se guardan sin metadatos.
+// Antes de decodificar se revisan las dimensiones del encabezado: un PNG o WebP de pocos KB puede declarar
+// dimensiones que al decodificarse ocupan gigabytes.
+func generarVariantes(original []byte) ([]varianteGenerada, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width < 1 || config.Height < 1 || int64(config.Width)*int64(config.Height) > pixelesMaximoImagen {
+		return nil, "", fmt.Errorf("%w: %dx%d", ErrImagenDemasiadoGrande, config.Width, config.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, "", err
+	}
+	orientacion := jpegOrientation(original)
+
+	var variantes []varianteGenerada
+	for _, tamano := range tamanosVariantes {
+		img := redimensionar(src, orientacion, tamano.Ancho, draw.CatmullRom)
+		size := img.Bounds().Size()
+
+		var jpg bytes.Buffer
+		if err := jpeg.Encode(&jpg, img, &jpeg.Options{Quality: calidadJPEG}); err != nil {
+			return nil, "", err
+		}
+		var webp bytes.Buffer
+		if err := nativewebp.Encode(&webp, img, nil); err != nil {
+			return nil, "", err
+		}
+		variantes = append(variantes,
+			varianteGenerada{Nombre: tamano.Nombre, Formato: "jpg", Ancho: size.X, Alto: size.Y, Datos: jpg.Bytes()},
+			varianteGenerada{Nombre: tamano.Nombre, Formato: "webp", Ancho: size.X, Alto: size.Y, Datos: webp.Bytes()},
+		)
+	}
+
+	// El placeholder es una imagen diminuta que el cliente estira mientras carga la variante real, al estirarla se ve borrosa
+	tiny := redimensionar(src, orientacion, anchoPlaceholder, draw.ApproxBiLinear)
+	var placeholder bytes.Buffer
+	if err := jpeg.Encode(&placeholder, tiny, &jpeg.Options{Quality: calidadPlaceholder}); err != nil {
+		return nil, "", err
+	}
+	return variantes, "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(placeholder.Bytes()), nil
+}
+
+// redimensionar escala src para que ya orientada mida maximo anchoMax de ancho, nunca la agranda
+func redimensionar(src image.Image, orientacion int, anchoMax int, scaler draw.Scaler) image.Image {
+	size := src.Bounds().Size()
+	rotada := orientacion >= 5
+	ancho, alto := size.X, size.Y
+	if rotada {
+		ancho, alto = alto, ancho
+	}
+	if ancho > anchoMax {
+		alto = max(1, alto*anchoMax/ancho)
+		ancho = anchoMax
+	}
+	// Se escala antes de rotar para mover menos pixeles
+	if rotada {
+		ancho, alto = alto, ancho
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, ancho, alto))
+	scaler.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+	return orientar(dst, orientacion)
+}
+
+// orientar aplica la orientación EXIF (2 a 8) a la imagen
+func orientar(src *image.RGBA, orientacion int) image.Image {
+	if orientacion < 2 || orientacion > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientacion >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientacion {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.SetRGBA(x, y, src.RGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
+
+const (
+	exifTagOrientation = 0x0112
+	exifTagGPSInfo     = 0x8825
+)
+
+// exifTIFF busca el segmento APP1 Exif de un JPEG y regresa el bloque TIFF que contiene los IFD
+func exifTIFF(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil
+		}
+		marker := data[pos+1]
+		// SOS: ya empiezan los datos de la imagen, no hay mas metadatos
+		if marker == 0xDA {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		segment := data[pos+4 : end]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return segment[6:]
+		}
+		pos = end
+	}
+	return nil
+}
+
+// ifdEntries recorre las entradas de un IFD y llama fn con el offset de cada entrada dentro del bloque TIFF
+func ifdEntries(tiff []byte, order binary.ByteOrder, offset uint32, fn func(entry int)) bool {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return false
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	start := int(offset) + 2
+	if start+count*12 > len(tiff) {
+		return false
+	}
+	for i := 0; i < count; i++ {
+		fn(start + i*12)
+	}
+	return true
+}
+
+func tiffByteOrder(tiff []byte) (binary.ByteOrder, uint32, bool) {
+	if len(tiff) < 8 {
+		return nil, 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	return order, order.Uint32(tiff[4:]), true
+}
+
+// jpegOrientation regresa la orientación EXIF del JPEG o 1 si no tiene
+func jpegOrientation(data []byte) int {
+	tiff := exifTIFF(data)
+	order, ifd0, ok := tiffByteOrder(tiff)
+	if !ok {
+		return 1
+	}
+	orientacion := 1
+	ifdEntries(tiff, order, ifd0, func(entry int) {
+		if order.Uint16(tiff[entry:]) == exifTagOrientation {
+			orientacion = int(order.Uint16(tiff[entry+8:]))
+		}
+	})
+	return orientacion
+}
+
+// tamaño en bytes de cada tipo de dato TIFF
+var tiffTypeSize = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// stripJPEGGPS borra en su lugar el IFD de GPS del EXIF de un JPEG, el resto de los metadatos
+// (orientación, camara) se conserva y el archivo mantiene su tamaño
+func stripJPEGGPS(data []byte) []byte {
+	tiff := exifTIFF(data)
+	order, ifd0, ok := tiffByteOrder(tiff)
+	if !ok {
+		return data
+	}
+
+	gpsEntry := -1
+	ifdEntries(tiff, order, ifd0, func(entry int) {
+		if order.Uint16(tiff[entry:]) == exifTagGPSInfo {
+			gpsEntry = entry
+		}
+	})
+	if gpsEntry < 0 {
+		return data
+	}
+	gpsOffset := order.Uint32(tiff[gpsEntry+8:])
+
+	// ifdEntries revisa los límites antes de tocar cualquier entrada
+	ok = gpsOffset != 0 && ifdEntries(tiff, order, gpsOffset, func(entry int) {
+		size := uint64(tiffTypeSize[order.Uint16(tiff[entry+2:])]) * uint64(order.Uint32(tiff[entry+4:]))
+		if size > 4 {
+			valueOffset := uint64(order.Uint32(tiff[entry+8:]))
+			if valueOffset+size <= uint64(len(tiff)) {
+				clear(tiff[valueOffset : valueOffset+size])
+			}
+		}
+		clear(tiff[entry : entry+12])
+	})
+	if ok {
+		// Un IFD con cero entradas sigue siendo valido para los lectores de EXIF
+		order.PutUint16(tiff[gpsOffset:], 0)
+		return data
+	}
+	// Si el IFD de GPS apunta fuera del bloque o está truncado no se puede limpiar, pero un lector más permisivo
+	// podría leer lo que alcance: se borra la entrada que apunta a él en el IFD0
+	clear(tiff[gpsEntry : gpsEntry+12])
+	return data
+}
+
+// stripPNGExif quita el chunk eXIf de un PNG; el resto de los chunks no cambia
+func stripPNGExif(data []byte) []byte {
+	const firma = "\x89PNG\r\n\x1a\n"
+	if len(data) < len(firma) || string(data[:len(firma)]) != firma {
+		return data
+	}
+	out := append([]byte(nil), data[:len(firma)]...)
+	pos := len(firma)
+	for pos+12 <= len(data) {
+		end := uint64(pos) + 12 + uint64(binary.BigEndian.Uint32(data[pos:]))
+		if end > uint64(len(data)) {
+			break
+		}
+		if string(data[pos+4:pos+8]) != "eXIf" {
+			out = append(out, data[pos:end]...)
+		}
+		pos = int(end)
+	}
+	// Lo que sobra después del último chunk completo (un archivo truncado) se copia igual
+	return append(out, data[pos:]...)
+}
+
+// stripWebPExif quita el chunk EXIF de un WebP y apaga su bandera en el chunk VP8X
+func stripWebPExif(data []byte) []byte {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return data
+	}
+	out := append([]byte(nil), data[:12]...)
+	pos := 12
+	for pos+8 <= len(data) {
+		size := uint64(binary.LittleEndian.Uint32(data[pos+4:]))
+		// Los chunks se rellenan a un número par de bytes
+		end := uint64(pos) + 8 + size + size%2
+		if end > uint64(len(data)) {
+			end = uint64(len(data))
+		}
+		switch string(data[pos : pos+4]) {
+		case "EXIF":
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = int(end)
+	}
+	out = append(out, data[pos:]...)
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out
+}
+
+// stripGPS borra la ubicación de una imagen subida según su tipo. En JPEG solo se borra el IFD de GPS para conservar
+// la orientación; en PNG y WebP la orientación no se usa y se quita el bloque EXIF completo.
+func stripGPS(mimeType string, data []byte) []byte {
+	switch mimeType {
+	case "image/jpeg":
+		return stripJPEGGPS(data)
+	case "image/png":
+		return stripPNGExif(data)
+	case "image/webp":
+		return stripWebPExif(data)
+	}
+	return data
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// jpegConExif arma un JPEG mínimo (sin imagen) con el bloque TIFF en un segmento APP1 Exif
+func jpegConExif(tiff []byte) []byte {
+	segmento := append([]byte("Exif\x00\x00"), tiff...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	data = binary.BigEndian.AppendUint16(data, uint16(len(segmento)+2))
+	data = append(data, segmento...)
+	return append(data, 0xFF, 0xD9)
+}
+
+// tiffConGPS arma un TIFF little endian con IFD0 (orientación y puntero a GPS) y un IFD de GPS con la latitud
+// (3 racionales fuera de la entrada). gpsIFD y latitud permiten apuntar a donde no hay nada.
+func tiffConGPS(gpsIFD, latitud uint32, entradasGPS uint16) []byte {
+	le := binary.LittleEndian
+	tiff := []byte("II*\x00")
+	tiff = le.AppendUint32(tiff, 8)
+	// IFD0 en 8: 2 entradas, 12 bytes cada una, y el siguiente IFD
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint16(tiff, exifTagOrientation)
+	tiff = le.AppendUint16(tiff, 3)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, 6)
+	tiff = le.AppendUint16(tiff, exifTagGPSInfo)
+	tiff = le.AppendUint16(tiff, 4)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, gpsIFD)
+	tiff = le.AppendUint32(tiff, 0)
+	// IFD de GPS en 38: la latitud (tipo 5, 3 valores = 24 bytes)
+	tiff = le.AppendUint16(tiff, entradasGPS)
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint16(tiff, 5)
+	tiff = le.AppendUint32(tiff, 3)
+	tiff = le.AppendUint32(tiff, latitud)
+	tiff = le.AppendUint32(tiff, 0)
+	// Valores de la latitud en 56
+	for i := 0; i < 24; i++ {
+		tiff = append(tiff, 0xAB)
+	}
+	return tiff
+}
+
+func TestStripJPEGGPS(t *testing.T) {
+	// Lo que puede pasar con el GPS: se limpia su IFD, se borra la entrada que apunta a él o no hay nada que leer
+	const (
+		limpiaIFD = iota
+		borraPuntero
+		sinCambios
+	)
+	tests := []struct {
+		nombre       string
+		data         []byte
+		resultado    int
+		borraValores bool
+	}{
+		{"GPS válido", jpegConExif(tiffConGPS(38, 56, 1)), limpiaIFD, true},
+		{"valores de la latitud fuera del bloque", jpegConExif(tiffConGPS(38, 0xFFFFFFF0, 1)), limpiaIFD, false},
+		{"IFD de GPS fuera del bloque", jpegConExif(tiffConGPS(65535, 56, 1)), borraPuntero, false},
+		{"IFD de GPS en el último byte", jpegConExif(tiffConGPS(79, 56, 1)), borraPuntero, false},
+		{"IFD de GPS con más entradas que bytes", jpegConExif(tiffConGPS(38, 56, 40)), borraPuntero, false},
+		{"IFD de GPS en cero", jpegConExif(tiffConGPS(0, 56, 1)), borraPuntero, false},
+		{"IFD0 truncado antes del puntero", jpegConExif(tiffConGPS(38, 56, 1)[:20]), sinCambios, false},
+		{"sin EXIF", []byte{0xFF, 0xD8, 0xFF, 0xD9}, sinCambios, false},
+		{"no es JPEG", []byte("hola"), sinCambios, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			original := bytes.Clone(tt.data)
+			got := stripJPEGGPS(tt.data)
+			if len(got) != len(original) {
+				t.Fatalf("cambió el tamaño: %d, antes %d", len(got), len(original))
+			}
+			if tt.resultado == sinCambios {
+				if !bytes.Equal(got, original) {
+					t.Fatal("se modificó un archivo sin GPS que leer")
+				}
+				return
+			}
+			tiff := exifTIFF(got)
+			if o := jpegOrientation(got); o != 6 {
+				t.Errorf("orientación = %d, se debe conservar 6", o)
+			}
+			puntero := tiff[22:34]
+			if tt.resultado == borraPuntero {
+				if !bytes.Equal(puntero, make([]byte, 12)) {
+					t.Errorf("la entrada GPSInfo del IFD0 quedó como %x", puntero)
+				}
+				if !bytes.Equal(tiff[34:], exifTIFF(original)[34:]) {
+					t.Error("se modificó el EXIF fuera del IFD0")
+				}
+				return
+			}
+			if n := binary.LittleEndian.Uint16(tiff[38:]); n != 0 {
+				t.Errorf("el IFD de GPS quedó con %d entradas", n)
+			}
+			if !bytes.Equal(tiff[40:52], make([]byte, 12)) {
+				t.Error("no se borró la entrada de la latitud")
+			}
+			if borrados := bytes.Equal(tiff[56:80], make([]byte, 24)); borrados != tt.borraValores {
+				t.Errorf("valores de la latitud borrados = %v, se esperaba %v", borrados, tt.borraValores)
+			}
+		})
+	}
+}
+
+// pngConChunks arma un PNG con la firma y los chunks indicados (el CRC no se revisa al quitar el EXIF)
+func pngConChunks(tipos ...string) []byte {
+	data := []byte("\x89PNG\r\n\x1a\n")
+	for _, tipo := range tipos {
+		datos := []byte("gps:" + tipo)
+		data = binary.BigEndian.AppendUint32(data, uint32(len(datos)))
+		data = append(data, tipo...)
+		data = append(data, datos...)
+		data = append(data, 0, 0, 0, 0)
+	}
+	return data
+}
+
+func TestStripPNGExif(t *testing.T) {
+	tests := []struct {
+		nombre string
+		data   []byte
+		want   []byte
+	}{
+		{"quita eXIf", pngConChunks("IHDR", "eXIf", "IDAT", "IEND"), pngConChunks("IHDR", "IDAT", "IEND")},
+		{"sin eXIf", pngConChunks("IHDR", "IDAT", "IEND"), pngConChunks("IHDR", "IDAT", "IEND")},
+		{"chunk truncado al final", append(pngConChunks("IHDR", "eXIf"), 0, 0, 9), append(pngConChunks("IHDR"), 0, 0, 9)},
+		{"no es PNG", []byte("hola"), []byte("hola")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			if got := stripPNGExif(tt.data); !bytes.Equal(got, tt.want) {
+				t.Errorf("stripPNGExif = %q, se esperaba %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// webpConChunks arma un WebP extendido con VP8X (bandera EXIF prendida) y los chunks indicados
+func webpConChunks(flags byte, tipos ...string) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WEBP")
+	data = append(data, "VP8X"...)
+	data = binary.LittleEndian.AppendUint32(data, 10)
+	data = append(data, flags, 0, 0, 0, 1, 0, 0, 1, 0, 0)
+	for _, tipo := range tipos {
+		// Datos de largo impar para probar el relleno
+		datos := []byte("gps")
+		data = append(data, tipo...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(datos)))
+		data = append(data, datos...)
+		data = append(data, 0)
+	}
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+func TestStripWebPExif(t *testing.T) {
+	tests := []struct {
+		nombre string
+		data   []byte
+		want   []byte
+	}{
+		{"quita EXIF y su bandera", webpConChunks(0x08|0x10, "VP8L", "EXIF"), webpConChunks(0x10, "VP8L")},
+		{"EXIF antes de la imagen", webpConChunks(0x08, "EXIF", "VP8L", "XMP "), webpConChunks(0, "VP8L", "XMP ")},
+		{"sin EXIF", webpConChunks(0, "VP8L"), webpConChunks(0, "VP8L")},
+		{"no es WebP", []byte("hola"), []byte("hola")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			if got := stripWebPExif(tt.data); !bytes.Equal(got, tt.want) {
+				t.Errorf("stripWebPExif = %q, se esperaba %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerarVariantesLimitaPixeles(t *testing.T) {
+	// Un PNG de unos bytes que declara 100000x100000 pixeles, no se debe intentar decodificar
+	ihdr := binary.BigEndian.AppendUint32(nil, 100000)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 100000)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	data = append(data, chunk...)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(chunk))
+	if _, _, err := generarVariantes(data); !errors.Is(err, ErrImagenDemasiadoGrande) {
+		t.Errorf("error = %v, se esperaba ErrImagenDemasiadoGrande", err)
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	if o := jpegOrientation(jpegConExif(tiffConGPS(38, 56, 1))); o != 6 {
+		t.Errorf("orientación = %d, se esperaba 6", o)
+	}
+	if o := jpegOrientation([]byte{0xFF, 0xD8, 0xFF, 0xD9}); o != 1 {
+		t.Errorf("sin EXIF la orientación = %d, se esperaba 1", o)
+	}
+}
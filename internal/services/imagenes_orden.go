@@ -0,0 +1,179 @@
+package services
+
+import (
+	"backend/internal/database"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidImageOrder se regresa cuando la lista para reordenar no trae exactamente las imagenes del registro
+var ErrInvalidImageOrder = errors.New("invalid image order")
+
+// bloquearPadre bloquea la propiedad o prospecto dueño de las imagenes. Todo lo que cambia la imagen principal
+// o las posiciones pasa por aqui, asi dos peticiones sobre la misma galeria se ejecutan una despues de la otra.
+func bloquearPadre(tx *sql.Tx, tabla *tablaImagenes, idPadre int) error {
+	exists, err := database.RowExists(tx, tabla.TablaPadre, tabla.IDPadre, idPadre)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrResourceNotFound
+	}
+	return nil
+}
+
+// bloquearImagen bloquea primero al padre y despues a la imagen, regresa el padre y si la imagen es la principal
+func bloquearImagen(tx *sql.Tx, tabla *tablaImagenes, id int) (int, bool, error) {
+	var idPadre int
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id_imagen = ?", tabla.ColumnaPadre, tabla.Tabla)
+	if err := tx.QueryRow(query, id).Scan(&idPadre); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, ErrResourceNotFound
+		}
+		return 0, false, err
+	}
+	if err := bloquearPadre(tx, tabla, idPadre); err != nil {
+		return 0, false, err
+	}
+
+	// Se vuelve a leer con el padre bloqueado por si la imagen se borró mientras tanto
+	var principal sql.NullBool
+	query = fmt.Sprintf("SELECT principal FROM %s WHERE id_imagen = ? AND %s = ? FOR UPDATE", tabla.Tabla, tabla.ColumnaPadre)
+	if err := tx.QueryRow(query, id, idPadre).Scan(&principal); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, ErrResourceNotFound
+		}
+		return 0, false, err
+	}
+	return idPadre, principal.Bool, nil
+}
+
+// prepararNuevaImagen calcula la posición (al final de la galeria) y si la imagen que se va a insertar queda como principal.
+// Si se pide como principal se quita la anterior, si el registro no tiene principal la nueva lo es aunque no se pida.
+func prepararNuevaImagen(tx *sql.Tx, tabla *tablaImagenes, idPadre int, principal bool) (bool, int, error) {
+	if err := bloquearPadre(tx, tabla, idPadre); err != nil {
+		return false, 0, err
+	}
+
+	var posicion, principales int
+	query := fmt.Sprintf("SELECT COALESCE(MAX(posicion), 0) + 1, COALESCE(SUM(principal = 1), 0) FROM %s WHERE %s = ?", tabla.Tabla, tabla.ColumnaPadre)
+	if err := tx.QueryRow(query, idPadre).Scan(&posicion, &principales); err != nil {
+		return false, 0, err
+	}
+
+	if principal && principales > 0 {
+		query = fmt.Sprintf("UPDATE %s SET principal = 0 WHERE %s = ? AND principal = 1", tabla.Tabla, tabla.ColumnaPadre)
+		if _, err := tx.Exec(query, idPadre); err != nil {
+			return false, 0, err
+		}
+	}
+	return principal || principales == 0, posicion, nil
+}
+
+// marcarPrincipal deja a la imagen como la unica principal de su registro
+func marcarPrincipal(db *sql.DB, tabla *tablaImagenes, id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	idPadre, principal, err := bloquearImagen(tx, tabla, id)
+	if err != nil {
+		return err
+	}
+	if principal {
+		return tx.Commit()
+	}
+
+	// Primero se quita la anterior, el indice unico de principal no permite dos a la vez
+	query := fmt.Sprintf("UPDATE %s SET principal = 0 WHERE %s = ? AND principal = 1", tabla.Tabla, tabla.ColumnaPadre)
+	if _, err := tx.Exec(query, idPadre); err != nil {
+		return err
+	}
+	query = fmt.Sprintf("UPDATE %s SET principal = 1 WHERE id_imagen = ?", tabla.Tabla)
+	if _, err := tx.Exec(query, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// reordenarImagenes asigna las posiciones de la galeria en el orden de ids, la lista debe traer todas las imagenes del registro
+func reordenarImagenes(db *sql.DB, tabla *tablaImagenes, idPadre int, ids []int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := bloquearPadre(tx, tabla, idPadre); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT id_imagen FROM %s WHERE %s = ? FOR UPDATE", tabla.Tabla, tabla.ColumnaPadre), idPadre)
+	if err != nil {
+		return err
+	}
+	pendientes := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		pendientes[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(ids) != len(pendientes) {
+		return fmt.Errorf("%w: se esperaban %d imágenes", ErrInvalidImageOrder, len(pendientes))
+	}
+	for _, id := range ids {
+		if !pendientes[id] {
+			return fmt.Errorf("%w: la imagen %d no pertenece al registro o está repetida", ErrInvalidImageOrder, id)
+		}
+		delete(pendientes, id)
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET posicion = ? WHERE id_imagen = ?", tabla.Tabla)
+	for i, id := range ids {
+		if _, err := tx.Exec(query, i+1, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// eliminarImagen borra la imagen y sus variantes en una transacción, regresa ErrResourceNotFound si no existe.
+// Si era la principal, la siguiente de la galeria toma su lugar.
+func eliminarImagen(db *sql.DB, tabla *tablaImagenes, id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	idPadre, principal, err := bloquearImagen(tx, tabla, id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id_imagen = ?", tabla.TablaVariantes), id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id_imagen = ?", tabla.Tabla), id); err != nil {
+		return err
+	}
+
+	if principal {
+		query := fmt.Sprintf("UPDATE %s SET principal = 1 WHERE %s = ? ORDER BY posicion, id_imagen LIMIT 1", tabla.Tabla, tabla.ColumnaPadre)
+		if _, err := tx.Exec(query, idPadre); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
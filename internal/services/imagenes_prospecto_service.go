@@ -21,9 +21,9 @@ func NewImagenesProspectoService(db *sql.DB) *ImagenesProspectoService {
 // Recupera una imagen por su ID
 func (service *ImagenesProspectoService) GetImagen(id int) (*models.ImagenProspecto, error) {
 	var imagen models.ImagenProspecto
-	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, id_prospecto FROM ImagenesProspecto WHERE id_imagen = ?"
+	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, posicion, id_prospecto FROM ImagenesProspecto WHERE id_imagen = ?"
 	row := service.DB.QueryRow(query, id)
-	err := row.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.IDProspecto)
+	err := row.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.Posicion, &imagen.IDProspecto)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Println("No se encontró la imagen")
@@ -37,9 +37,10 @@ func (service *ImagenesProspectoService) GetImagen(id int) (*models.ImagenProspe
 
 func (service *ImagenesProspectoService) GetImagenPrincipal(id int) (*models.ImagenProspecto, error) {
 	var imagen models.ImagenProspecto
-	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, id_prospecto FROM ImagenesProspecto WHERE id_prospecto = ? AND principal = 1"
+	var placeholder sql.NullString
+	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, posicion, id_prospecto, placeholder FROM ImagenesProspecto WHERE id_prospecto = ? AND principal = 1"
 	row := service.DB.QueryRow(query, id)
-	err := row.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.IDProspecto)
+	err := row.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.Posicion, &imagen.IDProspecto, &placeholder)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Println("No se encontró la imagen")
@@ -48,13 +49,20 @@ func (service *ImagenesProspectoService) GetImagenPrincipal(id int) (*models.Ima
 		log.Println("Error recuperando la imagen:", err)
 		return nil, err
 	}
+	imagen.Placeholder = placeholder.String
+
+	variantes, err := cargarVariantes(service.DB, tablaImagenesProspecto, []int{imagen.IDImagen})
+	if err != nil {
+		return nil, err
+	}
+	imagen.Variantes = variantes[imagen.IDImagen]
 	return &imagen, nil
 }
 
-// Recupera todas las imágenes de una propiedad
+// Recupera todas las imágenes de un prospecto en el orden de la galeria
 func (service *ImagenesProspectoService) GetImagenesByProspecto(idPropiedad int) ([]*models.ImagenProspecto, error) {
 	var imagenes []*models.ImagenProspecto
-	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, id_prospecto FROM ImagenesProspecto WHERE id_prospecto = ?"
+	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, posicion, id_prospecto, placeholder FROM ImagenesProspecto WHERE id_prospecto = ? ORDER BY posicion, id_imagen"
 	rows, err := service.DB.Query(query, idPropiedad)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -66,94 +74,146 @@ func (service *ImagenesProspectoService) GetImagenesByProspecto(idPropiedad int)
 	}
 	defer rows.Close()
 
+	var ids []int
 	for rows.Next() {
 		var imagen models.ImagenProspecto
-		err := rows.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.IDProspecto)
+		var placeholder sql.NullString
+		err := rows.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.Posicion, &imagen.IDProspecto, &placeholder)
 		if err != nil {
 			log.Println("Error procesando fila de imagen:", err)
 			return nil, err
 		}
+		imagen.Placeholder = placeholder.String
 		imagenes = append(imagenes, &imagen)
+		ids = append(ids, imagen.IDImagen)
 	}
 
 	if err = rows.Err(); err != nil {
 		log.Println("Error iterando filas:", err)
 		return nil, err
 	}
+
+	variantes, err := cargarVariantes(service.DB, tablaImagenesProspecto, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, imagen := range imagenes {
+		imagen.Variantes = variantes[imagen.IDImagen]
+	}
 	return imagenes, nil
 }
 
-// Inserta una nueva imagen en la base de datos
+// Inserta una nueva imagen al final de la galeria, si es la primera del prospecto queda como principal
 func (service *ImagenesProspectoService) InsertImagen(imagen *models.ImagenProspecto) (int, error) {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("ImagenesProspecto", "id_imagen")
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error obteniendo último ID:", err)
+		log.Println("Error starting transaction:", err)
 		return 0, err
 	}
-	imagen.IDImagen = lastId + 1
+	defer tx.Rollback()
 
-	lastIdProspecto, err := utils.GetLastId("Citas", "id_citas")
+	imagen.Principal, imagen.Posicion, err = prepararNuevaImagen(tx, tablaImagenesProspecto, imagen.IDProspecto, imagen.Principal)
 	if err != nil {
-		log.Println("Error obteniendo último ID:", err)
+		log.Println("Error insertando imagen:", err)
 		return 0, err
 	}
-	imagen.IDProspecto = lastIdProspecto
 
-	query := "INSERT INTO ImagenesProspecto(id_imagen, ruta_imagen, descripcion_imagen, principal, id_prospecto) VALUES(?,?,?,?,?)"
-	result, err := service.DB.Exec(query, imagen.IDImagen, imagen.RutaImagen, imagen.Descripcion, imagen.Principal, imagen.IDProspecto)
+	query := "INSERT INTO ImagenesProspecto(ruta_imagen, descripcion_imagen, principal, posicion, id_prospecto) VALUES(?,?,?,?,?)"
+	id, err := database.Insert(tx, query, imagen.RutaImagen, imagen.Descripcion, imagen.Principal, imagen.Posicion, imagen.IDProspecto)
 	if err != nil {
 		log.Println("Error insertando imagen:", err)
 		return 0, err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
-		return 0, err
-	}
-	if rows != 1 {
-		log.Println("Error insertando imagen, no se afectaron filas")
+	if err := tx.Commit(); err != nil {
+		log.Println("Error insertando imagen:", err)
 		return 0, err
 	}
+	imagen.IDImagen = id
 	return imagen.IDImagen, nil
 }
 
-// Actualiza una imagen existente por su ID
+// Actualiza la descripción de una imagen, la principal y el orden se cambian con SetImagenPrincipal y ReordenarImagenes.
+// La ruta no se cambia: es la llave del archivo en el storage y con ella se descarga y se borra.
 func (service *ImagenesProspectoService) UpdateImagen(imagen *models.ImagenProspecto, id int) error {
-	query := "UPDATE ImagenesProspecto SET ruta_imagen = ?, descripcion_imagen = ?, principal = ?, id_prospecto = ? WHERE id_imagen = ?"
-	result, err := service.DB.Exec(query, imagen.RutaImagen, imagen.Descripcion, imagen.Principal, imagen.IDProspecto, id)
+	query := "UPDATE ImagenesProspecto SET descripcion_imagen = ? WHERE id_imagen = ?"
+	err := database.ExecExisting(service.DB, "ImagenesProspecto", "id_imagen", id, query, imagen.Descripcion, id)
 	if err != nil {
 		log.Println("Error actualizando imagen:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
+	return nil
+}
+
+// Deja la imagen como la principal de su prospecto y quita la anterior
+func (service *ImagenesProspectoService) SetImagenPrincipal(id int) error {
+	if err := marcarPrincipal(service.DB, tablaImagenesProspecto, id); err != nil {
+		log.Println("Error cambiando la imagen principal:", err)
 		return err
 	}
-	if rows == 0 {
-		log.Println("Error actualizando imagen, no se afectaron filas")
+	return nil
+}
+
+// Cambia el orden de la galeria de un prospecto, ids debe traer todas sus imágenes
+func (service *ImagenesProspectoService) ReordenarImagenes(idProspecto int, ids []int) error {
+	if err := reordenarImagenes(service.DB, tablaImagenesProspecto, idProspecto, ids); err != nil {
+		log.Println("Error reordenando imágenes:", err)
 		return err
 	}
 	return nil
 }
 
-// Elimina una imagen por su ID
+// Elimina una imagen por su ID junto con sus variantes, si era la principal se promueve la siguiente
 func (service *ImagenesProspectoService) DeleteImagen(id int) error {
-	query := "DELETE FROM ImagenesProspecto WHERE id_imagen = ?"
-	result, err := service.DB.Exec(query, id)
-	if err != nil {
+	if err := eliminarImagen(service.DB, tablaImagenesProspecto, id); err != nil {
 		log.Println("Error eliminando imagen:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
+	return nil
+}
+
+// Inserta una imagen cuyo archivo ya se guardo en el storage, queda pendiente de generar sus variantes
+func (service *ImagenesProspectoService) InsertImagenArchivo(imagen *models.ImagenProspecto, archivo *models.Archivo) (int, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	imagen.Principal, imagen.Posicion, err = prepararNuevaImagen(tx, tablaImagenesProspecto, imagen.IDProspecto, imagen.Principal)
 	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
-		return err
+		log.Println("Error insertando imagen:", err)
+		return 0, err
 	}
-	if rows == 0 {
-		log.Println("Error eliminando imagen, no se afectaron filas")
-		return err
+
+	imagen.RutaImagen = archivo.Ruta
+	query := "INSERT INTO ImagenesProspecto(ruta_imagen, descripcion_imagen, principal, posicion, id_prospecto, nombre_archivo, tipo_mime, tamano_bytes, checksum_sha256, estado_variantes) VALUES(?,?,?,?,?,?,?,?,?,'pendiente')"
+	id, err := database.Insert(tx, query, imagen.RutaImagen, imagen.Descripcion, imagen.Principal, imagen.Posicion, imagen.IDProspecto,
+		archivo.NombreOriginal, archivo.TipoMIME, archivo.TamanoBytes, archivo.Checksum)
+	if err != nil {
+		log.Println("Error insertando imagen:", err)
+		return 0, err
 	}
-	return nil
+	if err := tx.Commit(); err != nil {
+		log.Println("Error insertando imagen:", err)
+		return 0, err
+	}
+	imagen.IDImagen = id
+	return imagen.IDImagen, nil
+}
+
+// Recupera el archivo de una imagen, regresa nil si la imagen no tiene un archivo subido
+func (service *ImagenesProspectoService) GetArchivoImagen(id int) (*models.Archivo, error) {
+	query := "SELECT ruta_imagen, nombre_archivo, tipo_mime, tamano_bytes, checksum_sha256 FROM ImagenesProspecto WHERE id_imagen = ? AND checksum_sha256 IS NOT NULL"
+	return getArchivo(service.DB, query, id)
+}
+
+// Recupera una variante de la imagen por su nombre de archivo, por ejemplo "medium.webp"
+func (service *ImagenesProspectoService) GetArchivoVariante(id int, variante string) (*models.Archivo, error) {
+	return getArchivoVariante(service.DB, tablaImagenesProspecto, id, variante)
+}
+
+// Recupera las rutas del archivo original y de las variantes, se usan para borrarlos del storage
+func (service *ImagenesProspectoService) GetRutasArchivos(id int) ([]string, error) {
+	return rutasImagen(service.DB, tablaImagenesProspecto, id)
 }
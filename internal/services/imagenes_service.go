@@ -21,9 +21,9 @@ func NewImagenesService(db *sql.DB) *ImagenesService {
 // Recupera una imagen por su ID
 func (service *ImagenesService) GetImagen(id int) (*models.Imagen, error) {
 	var imagen models.Imagen
-	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, id_propiedad FROM Imagenes WHERE id_imagen = ?"
+	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, posicion, id_propiedad FROM Imagenes WHERE id_imagen = ?"
 	row := service.DB.QueryRow(query, id)
-	err := row.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.IDPropiedad)
+	err := row.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.Posicion, &imagen.IDPropiedad)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Println("No se encontró la imagen")
@@ -37,9 +37,10 @@ func (service *ImagenesService) GetImagen(id int) (*models.Imagen, error) {
 
 func (service *ImagenesService) GetImagenPrincipal(id int) (*models.Imagen, error) {
 	var imagen models.Imagen
-	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, id_propiedad FROM Imagenes WHERE id_propiedad = ? AND principal = 1"
+	var placeholder sql.NullString
+	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, posicion, id_propiedad, placeholder FROM Imagenes WHERE id_propiedad = ? AND principal = 1"
 	row := service.DB.QueryRow(query, id)
-	err := row.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.IDPropiedad)
+	err := row.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.Posicion, &imagen.IDPropiedad, &placeholder)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Println("No se encontró la imagen")
@@ -48,112 +49,204 @@ func (service *ImagenesService) GetImagenPrincipal(id int) (*models.Imagen, erro
 		log.Println("Error recuperando la imagen:", err)
 		return nil, err
 	}
+	imagen.Placeholder = placeholder.String
+
+	variantes, err := cargarVariantes(service.DB, tablaImagenesPropiedad, []int{imagen.IDImagen})
+	if err != nil {
+		return nil, err
+	}
+	imagen.Variantes = variantes[imagen.IDImagen]
 	return &imagen, nil
 }
 
-// Recupera todas las imágenes de una propiedad
-func (service *ImagenesService) GetImagenesByPropiedad(idPropiedad int) ([]*models.Imagen, error) {
-	var imagenes []*models.Imagen
-	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, id_propiedad FROM Imagenes WHERE id_propiedad = ?"
-	rows, err := service.DB.Query(query, idPropiedad)
+// Recupera todas las imágenes de una propiedad en el orden de la galeria
+func (service *ImagenesService) GetImagenesByPropiedad(idPropiedad int, page *models.PageRequest) (*models.Page[*models.Imagen], error) {
+	cursor, err := normalizePage(page)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Println("No se encontraron imágenes")
-			return nil, nil
+		return nil, err
+	}
+
+	conditions := []string{"id_propiedad = ?"}
+	args := []interface{}{idPropiedad}
+	total, err := countRows(service.DB, "SELECT COUNT(*) FROM Imagenes"+whereClause(conditions), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	order := pageOrder{Column: "posicion", ID: "id_imagen"}
+	if cursor != nil {
+		condition, cursorArgs, err := keysetCondition(cursor, order)
+		if err != nil {
+			return nil, err
 		}
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+	limit, limitArgs := limitClause(page)
+	args = append(args, limitArgs...)
+
+	var imagenes []*models.Imagen
+	query := "SELECT id_imagen, ruta_imagen, descripcion_imagen, principal, posicion, id_propiedad, placeholder FROM Imagenes" +
+		whereClause(conditions) + " ORDER BY posicion, id_imagen" + limit
+	rows, err := service.DB.Query(query, args...)
+	if err != nil {
 		log.Println("Error recuperando imágenes:", err)
 		return nil, err
 	}
 	defer rows.Close()
 
+	var ids []int
 	for rows.Next() {
 		var imagen models.Imagen
-		err := rows.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.IDPropiedad)
+		var placeholder sql.NullString
+		err := rows.Scan(&imagen.IDImagen, &imagen.RutaImagen, &imagen.Descripcion, &imagen.Principal, &imagen.Posicion, &imagen.IDPropiedad, &placeholder)
 		if err != nil {
 			log.Println("Error procesando fila de imagen:", err)
 			return nil, err
 		}
+		imagen.Placeholder = placeholder.String
 		imagenes = append(imagenes, &imagen)
+		ids = append(ids, imagen.IDImagen)
 	}
 
 	if err = rows.Err(); err != nil {
 		log.Println("Error iterando filas:", err)
 		return nil, err
 	}
-	return imagenes, nil
+
+	variantes, err := cargarVariantes(service.DB, tablaImagenesPropiedad, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, imagen := range imagenes {
+		imagen.Variantes = variantes[imagen.IDImagen]
+	}
+	return buildPage(imagenes, total, page, order, func(imagen *models.Imagen) (int, interface{}) {
+		return imagen.IDImagen, imagen.Posicion
+	}), nil
 }
 
-// Inserta una nueva imagen en la base de datos
+// Inserta una nueva imagen al final de la galeria, si es la primera de la propiedad queda como principal
 func (service *ImagenesService) InsertImagen(imagen *models.Imagen) (int, error) {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Imagenes", "id_imagen")
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error obteniendo último ID:", err)
+		log.Println("Error starting transaction:", err)
 		return 0, err
 	}
-	imagen.IDImagen = lastId + 1
+	defer tx.Rollback()
 
-	lastIdPropiedad, err := utils.GetLastId("Propiedades", "id_propiedad")
+	id, err := insertImagenTx(tx, imagen)
 	if err != nil {
-		log.Println("Error obteniendo último ID:", err)
 		return 0, err
 	}
-	imagen.IDPropiedad = lastIdPropiedad
-
-	query := "INSERT INTO Imagenes(id_imagen, ruta_imagen, descripcion_imagen, principal, id_propiedad) VALUES(?,?,?,?,?)"
-	result, err := service.DB.Exec(query, imagen.IDImagen, imagen.RutaImagen, imagen.Descripcion, imagen.Principal, imagen.IDPropiedad)
-	if err != nil {
+	if err := tx.Commit(); err != nil {
 		log.Println("Error insertando imagen:", err)
 		return 0, err
 	}
-	rows, err := result.RowsAffected()
+	imagen.IDImagen = id
+	return imagen.IDImagen, nil
+}
+
+// helper function que inserta una imagen dentro de una transacción y regresa el id generado por la base de datos
+func insertImagenTx(tx *sql.Tx, imagen *models.Imagen) (int, error) {
+	var err error
+	imagen.Principal, imagen.Posicion, err = prepararNuevaImagen(tx, tablaImagenesPropiedad, imagen.IDPropiedad, imagen.Principal)
 	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
+		log.Println("Error insertando imagen:", err)
 		return 0, err
 	}
-	if rows != 1 {
-		log.Println("Error insertando imagen, no se afectaron filas")
+
+	query := "INSERT INTO Imagenes(ruta_imagen, descripcion_imagen, principal, posicion, id_propiedad) VALUES(?,?,?,?,?)"
+	id, err := database.Insert(tx, query, imagen.RutaImagen, imagen.Descripcion, imagen.Principal, imagen.Posicion, imagen.IDPropiedad)
+	if err != nil {
+		log.Println("Error insertando imagen:", err)
 		return 0, err
 	}
-	return imagen.IDImagen, nil
+	return id, nil
 }
 
-// Actualiza una imagen existente por su ID
+// Actualiza la descripción de una imagen, la principal y el orden se cambian con SetImagenPrincipal y ReordenarImagenes.
+// La ruta no se cambia: es la llave del archivo en el storage y con ella se descarga y se borra.
 func (service *ImagenesService) UpdateImagen(imagen *models.Imagen, id int) error {
-	query := "UPDATE Imagenes SET ruta_imagen = ?, descripcion_imagen = ?, principal = ?, id_propiedad = ? WHERE id_imagen = ?"
-	result, err := service.DB.Exec(query, imagen.RutaImagen, imagen.Descripcion, imagen.Principal, imagen.IDPropiedad, id)
+	query := "UPDATE Imagenes SET descripcion_imagen = ? WHERE id_imagen = ?"
+	err := database.ExecExisting(service.DB, "Imagenes", "id_imagen", id, query, imagen.Descripcion, id)
 	if err != nil {
 		log.Println("Error actualizando imagen:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
+	return nil
+}
+
+// Deja la imagen como la principal de su propiedad y quita la anterior
+func (service *ImagenesService) SetImagenPrincipal(id int) error {
+	if err := marcarPrincipal(service.DB, tablaImagenesPropiedad, id); err != nil {
+		log.Println("Error cambiando la imagen principal:", err)
 		return err
 	}
-	if rows == 0 {
-		log.Println("Error actualizando imagen, no se afectaron filas")
+	return nil
+}
+
+// Cambia el orden de la galeria de una propiedad, ids debe traer todas sus imágenes
+func (service *ImagenesService) ReordenarImagenes(idPropiedad int, ids []int) error {
+	if err := reordenarImagenes(service.DB, tablaImagenesPropiedad, idPropiedad, ids); err != nil {
+		log.Println("Error reordenando imágenes:", err)
 		return err
 	}
 	return nil
 }
 
-// Elimina una imagen por su ID
+// Elimina una imagen por su ID junto con sus variantes, si era la principal se promueve la siguiente
 func (service *ImagenesService) DeleteImagen(id int) error {
-	query := "DELETE FROM Imagenes WHERE id_imagen = ?"
-	result, err := service.DB.Exec(query, id)
-	if err != nil {
+	if err := eliminarImagen(service.DB, tablaImagenesPropiedad, id); err != nil {
 		log.Println("Error eliminando imagen:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
+	return nil
+}
+
+// Inserta una imagen cuyo archivo ya se guardo en el storage, queda pendiente de generar sus variantes
+func (service *ImagenesService) InsertImagenArchivo(imagen *models.Imagen, archivo *models.Archivo) (int, error) {
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error verificando filas afectadas:", err)
-		return err
+		log.Println("Error starting transaction:", err)
+		return 0, err
 	}
-	if rows == 0 {
-		log.Println("Error eliminando imagen, no se afectaron filas")
-		return err
+	defer tx.Rollback()
+
+	imagen.Principal, imagen.Posicion, err = prepararNuevaImagen(tx, tablaImagenesPropiedad, imagen.IDPropiedad, imagen.Principal)
+	if err != nil {
+		log.Println("Error insertando imagen:", err)
+		return 0, err
 	}
-	return nil
+
+	imagen.RutaImagen = archivo.Ruta
+	query := "INSERT INTO Imagenes(ruta_imagen, descripcion_imagen, principal, posicion, id_propiedad, nombre_archivo, tipo_mime, tamano_bytes, checksum_sha256, estado_variantes) VALUES(?,?,?,?,?,?,?,?,?,'pendiente')"
+	id, err := database.Insert(tx, query, imagen.RutaImagen, imagen.Descripcion, imagen.Principal, imagen.Posicion, imagen.IDPropiedad,
+		archivo.NombreOriginal, archivo.TipoMIME, archivo.TamanoBytes, archivo.Checksum)
+	if err != nil {
+		log.Println("Error insertando imagen:", err)
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error insertando imagen:", err)
+		return 0, err
+	}
+	imagen.IDImagen = id
+	return imagen.IDImagen, nil
+}
+
+// Recupera el archivo de una imagen, regresa nil si la imagen no tiene un archivo subido
+func (service *ImagenesService) GetArchivoImagen(id int) (*models.Archivo, error) {
+	query := "SELECT ruta_imagen, nombre_archivo, tipo_mime, tamano_bytes, checksum_sha256 FROM Imagenes WHERE id_imagen = ? AND checksum_sha256 IS NOT NULL"
+	return getArchivo(service.DB, query, id)
+}
+
+// Recupera una variante de la imagen por su nombre de archivo, por ejemplo "medium.webp"
+func (service *ImagenesService) GetArchivoVariante(id int, variante string) (*models.Archivo, error) {
+	return getArchivoVariante(service.DB, tablaImagenesPropiedad, id, variante)
+}
+
+// Recupera las rutas del archivo original y de las variantes, se usan para borrarlos del storage
+func (service *ImagenesService) GetRutasArchivos(id int) ([]string, error) {
+	return rutasImagen(service.DB, tablaImagenesPropiedad, id)
 }
@@ -13,21 +13,23 @@ import (
 	"backend/internal/models"
 )
 
-func GenerateToken(user *models.User) (string, error) {
+func GenerateToken(user *models.User, sessionID int) (string, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		log.Fatal("JWT_SECRET environment variable is not set")
 		return "", errors.New("JWT secret not set")
 	}
-	expiration := time.Now().Add(24 * time.Hour)
+	expiration := time.Now().Add(AccessTokenDuration)
 
 	if user.Email == "" || user.Role == "" || user.Nombre == "" {
 		return "", errors.New("email, role and name must be provided")
 	}
 
 	claims := &models.JWTClaims{
-		Username: user.Nombre,
-		Email:    user.Email,
+		UserID:    user.ID,
+		SessionID: sessionID,
+		Username:  user.Nombre,
+		Email:     user.Email,
 		Role:      user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiration),
@@ -49,7 +51,8 @@ func GenerateToken(user *models.User) (string, error) {
 	return tokenString, nil
 }
 
-func JwtAuthorization() gin.HandlerFunc {
+// JwtAuthorization valida el JWT de la cookie y que su sesion no haya sido revocada
+func JwtAuthorization(sessionService *SessionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var token string
 		if cookieToken, err := c.Cookie("JWTtoken"); err == nil && cookieToken != "" {
@@ -83,6 +86,26 @@ func JwtAuthorization() gin.HandlerFunc {
 			return
 		}
 
+		active, err := sessionService.IsSessionActive(claims.SessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to validate session",
+			})
+			c.Abort()
+			return
+		}
+		if !active {
+			log.Println("Session revoked or expired:", claims.SessionID)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "Session revoked",
+				"message": "Please login again",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("id_usuario", claims.UserID)
+		c.Set("session_id", claims.SessionID)
 		c.Set("email", claims.Email)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
@@ -119,51 +142,3 @@ func validateJWTToken(tokenString string) (*models.JWTClaims, error) {
 	log.Println("Invalid token")
 	return nil, errors.New("invalid token")
 }
-
-func ValidateUserAdmin() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var token string
-		if cookieToken, err := c.Cookie("JWTtoken"); err == nil && cookieToken != "" {
-			token = cookieToken
-		} else {
-			log.Println("No token found in cookies")
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Authorization token not found",
-				"message": "Please provide a valid token by login or refresh your token",
-			})
-			c.Abort()
-			return
-		}
-
-		role, err := getRoleFromToken(token)
-		if err != nil {
-			log.Println("Error getting role from token:", err)
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Invalid token",
-				"message": "Please provide a valid token",
-			})
-			c.Abort()
-			return
-		}
-
-		if role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":   "Forbidden",
-				"message": "You do not have permission to access this resource",
-			})
-			c.Abort()
-			return
-		}
-
-		c.Next()
-	}
-}
-
-func getRoleFromToken(tokenString string) (string, error) {
-	claims, err := validateJWTToken(tokenString)
-	if err != nil {
-		return "", err
-	}
-
-	return claims.Role, nil
-}
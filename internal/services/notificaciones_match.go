@@ -0,0 +1,177 @@
+package services
+
+import (
+	"backend/internal/scheduler"
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+)
+
+// Motivo por el que se avisa al agente de una propiedad
+const (
+	MotivoNueva      = "nueva"
+	MotivoBajaPrecio = "baja_precio"
+)
+
+const (
+	notificacionesPorRevision = 200
+	intentosNotificacion      = 5
+)
+
+// NotificacionesMatchService le avisa a cada agente por correo de las propiedades nuevas o con precio más bajo
+// que le pueden interesar a sus prospectos. Los avisos se encolan en Notificaciones_Match al crear la propiedad
+// o bajarle el precio, y el scheduler los junta en un solo correo por agente.
+type NotificacionesMatchService struct {
+	DB    *sql.DB
+	Email *EmailService
+}
+
+// Constructor para NotificacionesMatchService
+func NewNotificacionesMatchService(db *sql.DB, email *EmailService) *NotificacionesMatchService {
+	return &NotificacionesMatchService{
+		DB:    db,
+		Email: email,
+	}
+}
+
+// Ejecutar cancela los avisos que ya no aplican y manda los pendientes, lo llama el scheduler cada minuto
+func (service *NotificacionesMatchService) Ejecutar() error {
+	if err := service.cancelarObsoletas(); err != nil {
+		return err
+	}
+	return service.enviarPendientes()
+}
+
+// cancelarObsoletas cancela los avisos de propiedades borradas, que ya no están disponibles o que cambiaron de precio
+// (si bajó otra vez ya hay otro aviso), y de prospectos que cerraron o cambiaron de agente.
+// También regresa a pendiente los que se quedaron en 'enviando' por un reinicio.
+func (service *NotificacionesMatchService) cancelarObsoletas() error {
+	query := `UPDATE Notificaciones_Match
+		LEFT JOIN Propiedades ON Propiedades.id_propiedad = Notificaciones_Match.id_propiedad
+		LEFT JOIN Estado_Propiedades ON Estado_Propiedades.id_propiedad = Notificaciones_Match.id_propiedad
+		LEFT JOIN Prospecto ON Prospecto.id_cliente = Notificaciones_Match.id_cliente
+		SET Notificaciones_Match.estado = 'cancelado'
+		WHERE Notificaciones_Match.estado = 'pendiente'
+			AND (Propiedades.id_propiedad IS NULL OR Propiedades.precio <> Notificaciones_Match.precio
+				OR COALESCE(Estado_Propiedades.estado, '') <> ?
+				OR Prospecto.id_cliente IS NULL OR COALESCE(Prospecto.usuario, '') <> Notificaciones_Match.usuario
+				OR Prospecto.etapa NOT IN (SELECT clave FROM Etapas_Prospecto WHERE tipo = 'abierta'))`
+	if _, err := service.DB.Exec(query, EstadoDisponible); err != nil {
+		log.Println("Error cancelling notificaciones:", err)
+		return err
+	}
+	return service.bandeja().Liberar()
+}
+
+// notificacionMatch es un aviso pendiente con los datos de la propiedad y del prospecto
+type notificacionMatch struct {
+	ID             int
+	Usuario        string
+	Motivo         string
+	Precio         float64
+	PrecioAnterior sql.NullFloat64
+	Puntaje        int
+	IDPropiedad    int
+	Titulo         string
+	Ciudad         string
+	Colonia        string
+	IDCliente      int
+	Prospecto      string
+	Telefono       string
+}
+
+func (service *NotificacionesMatchService) enviarPendientes() error {
+	query := `SELECT Notificaciones_Match.id_notificacion, Notificaciones_Match.usuario, Notificaciones_Match.motivo,
+			Notificaciones_Match.precio, Notificaciones_Match.precio_anterior, Notificaciones_Match.puntaje,
+			Propiedades.id_propiedad, Propiedades.titulo, Propiedades.ciudad, Propiedades.colonia,
+			Prospecto.id_cliente, Prospecto.nombre_prospecto, Prospecto.apellido_paterno_prospecto, Prospecto.telefono_prospecto
+		FROM Notificaciones_Match
+		INNER JOIN Propiedades ON Propiedades.id_propiedad = Notificaciones_Match.id_propiedad
+		INNER JOIN Prospecto ON Prospecto.id_cliente = Notificaciones_Match.id_cliente
+		WHERE Notificaciones_Match.estado = 'pendiente'
+		ORDER BY Notificaciones_Match.usuario, Notificaciones_Match.puntaje DESC, Notificaciones_Match.id_notificacion
+		LIMIT ?`
+	rows, err := service.DB.Query(query, notificacionesPorRevision)
+	if err != nil {
+		log.Println("Error fetching notificaciones:", err)
+		return err
+	}
+
+	porAgente := map[string][]notificacionMatch{}
+	var agentes []string
+	for rows.Next() {
+		var n notificacionMatch
+		var titulo, ciudad, colonia, nombre, apellido, telefono sql.NullString
+		err := rows.Scan(&n.ID, &n.Usuario, &n.Motivo, &n.Precio, &n.PrecioAnterior, &n.Puntaje,
+			&n.IDPropiedad, &titulo, &ciudad, &colonia, &n.IDCliente, &nombre, &apellido, &telefono)
+		if err != nil {
+			rows.Close()
+			log.Println("Error scanning notificacion:", err)
+			return err
+		}
+		n.Titulo = titulo.String
+		n.Ciudad = ciudad.String
+		n.Colonia = colonia.String
+		n.Prospecto = strings.TrimSpace(nombre.String + " " + apellido.String)
+		n.Telefono = telefono.String
+		if _, ok := porAgente[n.Usuario]; !ok {
+			agentes = append(agentes, n.Usuario)
+		}
+		porAgente[n.Usuario] = append(porAgente[n.Usuario], n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return err
+	}
+
+	for _, agente := range agentes {
+		service.enviar(agente, porAgente[agente])
+	}
+	return nil
+}
+
+// enviar reclama los avisos del agente y se los manda en un solo correo, los que otra replica ya reclamó se quedan fuera
+func (service *NotificacionesMatchService) enviar(agente string, pendientes []notificacionMatch) {
+	id := func(n notificacionMatch) int { return n.ID }
+	scheduler.Enviar(service.bandeja(), pendientes, id, func(reclamadas []notificacionMatch) (string, error) {
+		asunto, cuerpo := mensajeMatches(reclamadas)
+		return agente, service.Email.SendHTML(agente, asunto, cuerpo)
+	})
+}
+
+func (service *NotificacionesMatchService) bandeja() *scheduler.Bandeja {
+	return bandejaCorreos(service.DB, "Notificaciones_Match", "id_notificacion", "", intentosNotificacion)
+}
+
+// mensajeMatches arma el correo con una fila por prospecto y propiedad
+func mensajeMatches(notificaciones []notificacionMatch) (string, string) {
+	var filas strings.Builder
+	for _, n := range notificaciones {
+		motivo := "Nueva"
+		if n.Motivo == MotivoBajaPrecio {
+			motivo = "Bajó de precio"
+			if n.PrecioAnterior.Valid {
+				motivo = fmt.Sprintf("Bajó de $%.2f", n.PrecioAnterior.Float64)
+			}
+		}
+		prospecto := html.EscapeString(n.Prospecto)
+		if n.Telefono != "" {
+			prospecto += " (" + html.EscapeString(n.Telefono) + ")"
+		}
+		ubicacion := strings.Trim(n.Colonia+", "+n.Ciudad, ", ")
+		fmt.Fprintf(&filas, "<tr><td>%s</td><td>%s<br>%s</td><td>$%.2f</td><td>%s</td><td>%d%%</td></tr>",
+			prospecto, html.EscapeString(n.Titulo), html.EscapeString(ubicacion), n.Precio, html.EscapeString(motivo), n.Puntaje)
+	}
+
+	asunto := "Propiedades para tus prospectos"
+	if len(notificaciones) == 1 {
+		asunto = fmt.Sprintf("Propiedad para %s: %s", notificaciones[0].Prospecto, notificaciones[0].Titulo)
+	}
+	cuerpo := fmt.Sprintf(`<html><body><p>Estas propiedades cumplen lo que buscan tus prospectos:</p>
+<table border="1" cellpadding="4" cellspacing="0"><tr><th>Prospecto</th><th>Propiedad</th><th>Precio</th><th>Motivo</th><th>Coincidencia</th></tr>%s</table>
+</body></html>`, filas.String())
+	return asunto, cuerpo
+}
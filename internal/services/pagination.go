@@ -0,0 +1,150 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"backend/internal/models"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ErrInvalidPage se regresa cuando los parametros de paginacion no son validos
+var ErrInvalidPage = errors.New("invalid pagination parameters")
+
+// pageCursor es el contenido del cursor, el ultimo id entregado, el valor de la columna de orden cuando no es el id
+// (nil si la columna era NULL) y el orden con el que se genero, para no continuar un listado con otro orden
+type pageCursor struct {
+	ID    int         `json:"id"`
+	Value interface{} `json:"v,omitempty"`
+	Sort  string      `json:"s"`
+	Desc  bool        `json:"o,omitempty"`
+}
+
+// pageOrder es el orden de un listado, Column va vacia cuando solo se ordena por el id
+type pageOrder struct {
+	Column string
+	ID     string
+	Desc   bool
+}
+
+// sortKey es la columna que identifica el orden dentro del cursor
+func (order pageOrder) sortKey() string {
+	if order.Column == "" {
+		return order.ID
+	}
+	return order.Column
+}
+
+// normalizePage aplica los valores por defecto y decodifica el cursor, regresa nil si no viene cursor
+func normalizePage(page *models.PageRequest) (*pageCursor, error) {
+	if page.Limit <= 0 {
+		page.Limit = DefaultPageLimit
+	}
+	if page.Limit > MaxPageLimit {
+		page.Limit = MaxPageLimit
+	}
+	if page.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidPage)
+	}
+	if page.Cursor == "" {
+		return nil, nil
+	}
+	page.Offset = 0
+
+	raw, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidPage)
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID <= 0 {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidPage)
+	}
+	return &cursor, nil
+}
+
+func encodeCursor(id int, value interface{}, order pageOrder) string {
+	raw, err := json.Marshal(pageCursor{ID: id, Value: value, Sort: order.sortKey(), Desc: order.Desc})
+	if err != nil {
+		log.Println("Error encoding cursor:", err)
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// keysetCondition arma la condicion para continuar despues del cursor, las columnas vienen de listas fijas del servicio.
+// MySQL pone los NULL primero en ASC y al final en DESC, un cursor con valor nil se paro dentro de los NULL.
+func keysetCondition(cursor *pageCursor, order pageOrder) (string, []interface{}, error) {
+	if cursor.Sort != order.sortKey() || cursor.Desc != order.Desc {
+		return "", nil, fmt.Errorf("%w: cursor does not match the requested order", ErrInvalidPage)
+	}
+	op := ">"
+	if order.Desc {
+		op = "<"
+	}
+	col, id := order.Column, order.ID
+	if col == "" || col == id {
+		return id + " " + op + " ?", []interface{}{cursor.ID}, nil
+	}
+	switch {
+	case cursor.Value == nil && order.Desc:
+		return fmt.Sprintf("(%s IS NULL AND %s < ?)", col, id), []interface{}{cursor.ID}, nil
+	case cursor.Value == nil:
+		return fmt.Sprintf("((%s IS NULL AND %s > ?) OR %s IS NOT NULL)", col, id, col), []interface{}{cursor.ID}, nil
+	case order.Desc:
+		return fmt.Sprintf("(%s < ? OR (%s = ? AND %s < ?) OR %s IS NULL)", col, col, id, col),
+			[]interface{}{cursor.Value, cursor.Value, cursor.ID}, nil
+	}
+	return fmt.Sprintf("(%s > ? OR (%s = ? AND %s > ?))", col, col, id),
+		[]interface{}{cursor.Value, cursor.Value, cursor.ID}, nil
+}
+
+// limitClause regresa el LIMIT/OFFSET de la pagina, pide un elemento extra para saber si hay pagina siguiente
+func limitClause(page *models.PageRequest) (string, []interface{}) {
+	return " LIMIT ? OFFSET ?", []interface{}{page.Limit + 1, page.Offset}
+}
+
+// countRows ejecuta la consulta de total de un listado
+func countRows(db *sql.DB, query string, args ...interface{}) (int, error) {
+	var total int
+	if err := db.QueryRow(query, args...).Scan(&total); err != nil {
+		log.Println("Error counting rows:", err)
+		return 0, err
+	}
+	return total, nil
+}
+
+// buildPage recorta el elemento extra y calcula el cursor de la siguiente pagina a partir del ultimo elemento
+func buildPage[T any](items []T, total int, page *models.PageRequest, order pageOrder, cursorOf func(T) (int, interface{})) *models.Page[T] {
+	result := &models.Page[T]{
+		Data:   items,
+		Total:  total,
+		Limit:  page.Limit,
+		Offset: page.Offset,
+	}
+	if len(items) > page.Limit {
+		result.Data = items[:page.Limit]
+		id, value := cursorOf(result.Data[page.Limit-1])
+		result.NextCursor = encodeCursor(id, value, order)
+	}
+	if result.Data == nil {
+		result.Data = []T{}
+	}
+	return result
+}
+
+// whereClause une las condiciones de un listado con AND
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
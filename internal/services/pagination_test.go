@@ -0,0 +1,70 @@
+package services
+
+import (
+	"backend/internal/models"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCursorConservaElOrden(t *testing.T) {
+	order := pageOrder{Column: "Propiedades.precio", ID: "Propiedades.id_propiedad", Desc: true}
+	page := &models.PageRequest{Limit: 1}
+	resultado := buildPage([]int{7, 8}, 2, page, order, func(id int) (int, interface{}) {
+		return id, "1500000.00"
+	})
+	if resultado.NextCursor == "" {
+		t.Fatal("se esperaba next_cursor")
+	}
+	cursor, err := normalizePage(&models.PageRequest{Cursor: resultado.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pageCursor{ID: 7, Value: "1500000.00", Sort: "Propiedades.precio", Desc: true}
+	if *cursor != want {
+		t.Errorf("cursor = %+v, se esperaba %+v", *cursor, want)
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	precio := pageOrder{Column: "precio", ID: "id"}
+	precioDesc := pageOrder{Column: "precio", ID: "id", Desc: true}
+	tests := []struct {
+		nombre    string
+		cursor    pageCursor
+		order     pageOrder
+		condicion string
+		args      []interface{}
+		invalido  bool
+	}{
+		{"solo por id", pageCursor{ID: 5, Sort: "id"}, pageOrder{ID: "id"}, "id > ?", []interface{}{5}, false},
+		{"ascendente", pageCursor{ID: 5, Value: "10", Sort: "precio"}, precio,
+			"(precio > ? OR (precio = ? AND id > ?))", []interface{}{"10", "10", 5}, false},
+		{"descendente sigue con los NULL", pageCursor{ID: 5, Value: "10", Sort: "precio", Desc: true}, precioDesc,
+			"(precio < ? OR (precio = ? AND id < ?) OR precio IS NULL)", []interface{}{"10", "10", 5}, false},
+		{"ascendente dentro de los NULL", pageCursor{ID: 5, Sort: "precio"}, precio,
+			"((precio IS NULL AND id > ?) OR precio IS NOT NULL)", []interface{}{5}, false},
+		{"descendente dentro de los NULL", pageCursor{ID: 5, Sort: "precio", Desc: true}, precioDesc,
+			"(precio IS NULL AND id < ?)", []interface{}{5}, false},
+		{"otra columna", pageCursor{ID: 5, Value: "3", Sort: "num_recamaras"}, precio, "", nil, true},
+		{"otra dirección", pageCursor{ID: 5, Value: "10", Sort: "precio"}, precioDesc, "", nil, true},
+		{"cursor sin orden", pageCursor{ID: 5}, pageOrder{ID: "id"}, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nombre, func(t *testing.T) {
+			condicion, args, err := keysetCondition(&tt.cursor, tt.order)
+			if tt.invalido {
+				if !errors.Is(err, ErrInvalidPage) {
+					t.Fatalf("error = %v, se esperaba ErrInvalidPage", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if condicion != tt.condicion || !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("keysetCondition = %q %v, se esperaba %q %v", condicion, args, tt.condicion, tt.args)
+			}
+		})
+	}
+}
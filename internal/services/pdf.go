@@ -0,0 +1,308 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Hoja carta en puntos (1/72 de pulgada)
+const (
+	anchoPaginaPDF   = 612.0
+	altoPaginaPDF    = 792.0
+	margenPDF        = 72.0
+	tamanoTextoPDF   = 11.0
+	tamanoTituloPDF  = 14.0
+	tamanoPiePDF     = 8.0
+	interlineadoPDF  = 1.45
+	anchoNegritasPDF = 1.1 // Helvetica-Bold es un poco más ancha, se usa para no pasarse del margen
+)
+
+// anchosHelvetica son los anchos de Helvetica del espacio (32) a la tilde (126) en milésimas del tamaño de letra
+var anchosHelvetica = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// winAnsiEspeciales son los caracteres fuera de Latin-1 que tiene WinAnsiEncoding
+var winAnsiEspeciales = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+}
+
+// winAnsi convierte el texto a WinAnsiEncoding, lo que no existe en esa codificación queda como "?"
+func winAnsi(texto string) []byte {
+	salida := make([]byte, 0, len(texto))
+	for _, r := range texto {
+		switch {
+		case r == '\t':
+			salida = append(salida, ' ')
+		case r >= 0x20 && r <= 0x7e, r >= 0xa0 && r <= 0xff:
+			salida = append(salida, byte(r))
+		default:
+			if b, ok := winAnsiEspeciales[r]; ok {
+				salida = append(salida, b)
+			} else {
+				salida = append(salida, '?')
+			}
+		}
+	}
+	return salida
+}
+
+// anchoTexto mide el texto en puntos, las letras acentuadas miden lo mismo que sin acento
+func anchoTexto(texto string, tamano float64, negritas bool) float64 {
+	var total int
+	for _, r := range quitarAcentos.Replace(texto) {
+		switch {
+		case r >= 32 && r <= 126:
+			total += anchosHelvetica[r-32]
+		case r == 'Á' || r == 'É' || r == 'Ó' || r == 'Ú' || r == 'Ñ':
+			total += 722
+		case r == 'Í':
+			total += 278
+		default:
+			total += 556
+		}
+	}
+	ancho := float64(total) * tamano / 1000
+	if negritas {
+		ancho *= anchoNegritasPDF
+	}
+	return ancho
+}
+
+// cadenaPDF escribe el texto como cadena literal de PDF
+func cadenaPDF(texto string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, c := range winAnsi(texto) {
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// documentoPDF arma un PDF de texto en hoja carta con Helvetica. No lleva fecha de creación ni identificadores
+// aleatorios: el mismo contenido siempre da los mismos bytes, así un contrato se puede regenerar idéntico.
+type documentoPDF struct {
+	titulo   string
+	paginas  []*bytes.Buffer
+	imagenes []imagenPDF
+	y        float64
+}
+
+// imagenPDF es una imagen en escala de grises de 8 bits, ya comprimida
+type imagenPDF struct {
+	ancho, alto int
+	datos       []byte
+}
+
+func nuevoPDF(titulo string) *documentoPDF {
+	d := &documentoPDF{titulo: titulo}
+	d.nuevaPagina()
+	return d
+}
+
+func (d *documentoPDF) nuevaPagina() {
+	d.paginas = append(d.paginas, &bytes.Buffer{})
+	d.y = altoPaginaPDF - margenPDF
+}
+
+func (d *documentoPDF) pagina() *bytes.Buffer {
+	return d.paginas[len(d.paginas)-1]
+}
+
+// espacio baja el cursor, si ya no cabe nada en la página empieza otra
+func (d *documentoPDF) espacio(puntos float64) {
+	d.y -= puntos
+	if d.y < margenPDF {
+		d.nuevaPagina()
+	}
+}
+
+// linea escribe una línea de texto que ya cabe en el ancho de la página
+func (d *documentoPDF) linea(texto string, tamano float64, negritas, centrada bool) {
+	alto := tamano * interlineadoPDF
+	if d.y-alto < margenPDF {
+		d.nuevaPagina()
+	}
+	d.y -= alto
+	x := margenPDF
+	if centrada {
+		x = (anchoPaginaPDF - anchoTexto(texto, tamano, negritas)) / 2
+	}
+	fuente := "F1"
+	if negritas {
+		fuente = "F2"
+	}
+	fmt.Fprintf(d.pagina(), "BT /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", fuente, tamano, x, d.y, cadenaPDF(texto))
+}
+
+// encabezado escribe un título centrado en negritas
+func (d *documentoPDF) encabezado(texto string) {
+	for _, l := range partirLineas(texto, tamanoTituloPDF, true) {
+		d.linea(l, tamanoTituloPDF, true, true)
+	}
+	d.espacio(tamanoTextoPDF * 0.5)
+}
+
+// parrafo escribe el texto partido al ancho de la página, cada salto de línea del texto se respeta
+func (d *documentoPDF) parrafo(texto string, negritas bool) {
+	for _, renglon := range strings.Split(texto, "\n") {
+		lineas := partirLineas(renglon, tamanoTextoPDF, negritas)
+		if len(lineas) == 0 {
+			lineas = []string{""}
+		}
+		for _, l := range lineas {
+			d.linea(l, tamanoTextoPDF, negritas, false)
+		}
+	}
+	d.espacio(tamanoTextoPDF * 0.6)
+}
+
+// imagen dibuja la imagen en escala de grises a un punto por pixel, reducida si no cabe en el ancho y el alto máximos.
+// Lo transparente queda blanco, como el papel.
+func (d *documentoPDF) imagen(img image.Image, anchoMax, altoMax float64) error {
+	limites := img.Bounds()
+	gris := make([]byte, 0, limites.Dx()*limites.Dy())
+	for y := limites.Min.Y; y < limites.Max.Y; y++ {
+		for x := limites.Min.X; x < limites.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			blanco := 0xffff - a
+			gris = append(gris, byte((19595*(r+blanco)+38470*(g+blanco)+7471*(b+blanco)+1<<15)>>24))
+		}
+	}
+	var comprimido bytes.Buffer
+	w := zlib.NewWriter(&comprimido)
+	if _, err := w.Write(gris); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	ancho, alto := float64(limites.Dx()), float64(limites.Dy())
+	escala := min(1, anchoMax/ancho, altoMax/alto)
+	ancho, alto = ancho*escala, alto*escala
+	if d.y-alto < margenPDF {
+		d.nuevaPagina()
+	}
+	d.y -= alto
+	fmt.Fprintf(d.pagina(), "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", ancho, alto, margenPDF, d.y, len(d.imagenes))
+	d.imagenes = append(d.imagenes, imagenPDF{ancho: limites.Dx(), alto: limites.Dy(), datos: comprimido.Bytes()})
+	return nil
+}
+
+// partirLineas acomoda las palabras en líneas del ancho útil de la página; una palabra más larga que la línea se corta
+func partirLineas(texto string, tamano float64, negritas bool) []string {
+	anchoUtil := anchoPaginaPDF - 2*margenPDF
+	var lineas []string
+	var actual string
+	for _, palabra := range strings.Fields(texto) {
+		for anchoTexto(palabra, tamano, negritas) > anchoUtil {
+			if actual != "" {
+				lineas = append(lineas, actual)
+				actual = ""
+			}
+			corte := []rune(palabra)
+			n := len(corte) - 1
+			for n > 1 && anchoTexto(string(corte[:n]), tamano, negritas) > anchoUtil {
+				n--
+			}
+			lineas = append(lineas, string(corte[:n]))
+			palabra = string(corte[n:])
+		}
+		candidata := palabra
+		if actual != "" {
+			candidata = actual + " " + palabra
+		}
+		if anchoTexto(candidata, tamano, negritas) > anchoUtil {
+			lineas = append(lineas, actual)
+			candidata = palabra
+		}
+		actual = candidata
+	}
+	if actual != "" {
+		lineas = append(lineas, actual)
+	}
+	return lineas
+}
+
+// Bytes arma el archivo con el pie "Página n de m" en cada página
+func (d *documentoPDF) Bytes() ([]byte, error) {
+	var salida bytes.Buffer
+	var offsets []int
+	objeto := func(contenido string) {
+		offsets = append(offsets, salida.Len())
+		fmt.Fprintf(&salida, "%d 0 obj\n%s\nendobj\n", len(offsets), contenido)
+	}
+	flujo := func(diccionario string, datos []byte) {
+		if diccionario != "" {
+			diccionario = " " + diccionario
+		}
+		offsets = append(offsets, salida.Len())
+		fmt.Fprintf(&salida, "%d 0 obj\n<<%s /Length %d /Filter /FlateDecode >>\nstream\n", len(offsets), diccionario, len(datos))
+		salida.Write(datos)
+		salida.WriteString("\nendstream\nendobj\n")
+	}
+
+	salida.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// Los objetos 1 a 5 son fijos, las páginas empiezan en el 6 con su contenido en el siguiente y las imágenes van al final
+	var kids []string
+	for i := range d.paginas {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 6+2*i))
+	}
+	recursos := "/Font << /F1 3 0 R /F2 4 0 R >>"
+	if len(d.imagenes) > 0 {
+		var xobjects []string
+		for i := range d.imagenes {
+			xobjects = append(xobjects, fmt.Sprintf("/Im%d %d 0 R", i, 6+2*len(d.paginas)+i))
+		}
+		recursos += " /XObject << " + strings.Join(xobjects, " ") + " >>"
+	}
+	objeto("<< /Type /Catalog /Pages 2 0 R >>")
+	objeto(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.paginas)))
+	objeto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	objeto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	objeto(fmt.Sprintf("<< /Title %s /Producer (InmoSoft) >>", cadenaPDF(d.titulo)))
+
+	for i, pagina := range d.paginas {
+		pie := fmt.Sprintf("Página %d de %d", i+1, len(d.paginas))
+		contenido := pagina.String() + fmt.Sprintf("BT /F1 %.1f Tf %.2f %.2f Td %s Tj ET\n",
+			tamanoPiePDF, anchoPaginaPDF-margenPDF-anchoTexto(pie, tamanoPiePDF, false), margenPDF/2, cadenaPDF(pie))
+
+		var comprimido bytes.Buffer
+		w := zlib.NewWriter(&comprimido)
+		if _, err := w.Write([]byte(contenido)); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		objeto(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << %s >> /Contents %d 0 R >>",
+			anchoPaginaPDF, altoPaginaPDF, recursos, 7+2*i))
+		flujo("", comprimido.Bytes())
+	}
+	for _, img := range d.imagenes {
+		flujo(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8",
+			img.ancho, img.alto), img.datos)
+	}
+
+	xref := salida.Len()
+	fmt.Fprintf(&salida, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&salida, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&salida, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return salida.Bytes(), nil
+}
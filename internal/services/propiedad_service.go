@@ -4,7 +4,10 @@ import (
 	"backend/internal/database"
 	"backend/internal/models"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"slices"
 	"strings"
 )
 
@@ -19,104 +22,220 @@ func NewPropiedadService(db *sql.DB) *PropiedadService {
 	}
 }
 
+// Valores permitidos para las columnas SET de Propiedades, deben coincidir con mysql/init.sql
+var propiedadSetValues = map[string][]string{
+	"gas":         {"estacionario", "natural"},
+	"comodidades": {"clima", "calefaccion", "hidroneumatico", "aljibe", "tinaco"},
+	"extras":      {"alberca", "jardin", "techada", "cocineta", "cuarto_servicio"},
+	"utilidades":  {"agua", "luz", "internet"},
+}
+
+// Campos por los que se puede ordenar la busqueda, la llave es el valor que llega en el query string
+var propiedadSortFields = map[string]string{
+	"id_propiedad":  "Propiedades.id_propiedad",
+	"precio":        "Propiedades.precio",
+	"num_recamaras": "Propiedades.num_recamaras",
+	"num_banos":     "Propiedades.num_banos",
+	"fecha_alta":    "Propiedades.fecha_alta",
+}
+
+// ErrInvalidFilter se regresa cuando algun filtro de la busqueda no es valido
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// ErrPropiedadConRegistros se regresa al borrar una propiedad que todavía tiene imágenes, documentos o contratos
+var ErrPropiedadConRegistros = errors.New("propiedad still has records")
+
 // Funcion que recupera todas las propiedades de la base de datos, solo recupera los campos necesarios para mostrar en el menú, el resto de los campos se recuperan en otra función
-func (service *PropiedadService) GetAllPropiedades() ([]*models.MenuPropiedades, error) {
-	var propiedades []*models.MenuPropiedades
-	query := "SELECT Propiedades.id_propiedad, Propiedades.titulo, Propiedades.precio, Propiedades.num_recamaras, Estado_Propiedades.tipo_transaccion, Estado_Propiedades.estado FROM Propiedades, Estado_Propiedades WHERE Propiedades.id_propiedad = Estado_Propiedades.id_propiedad"
-	rows, err := service.DB.Query(query)
+func (service *PropiedadService) GetAllPropiedades(page *models.PageRequest) (*models.Page[*models.MenuPropiedades], error) {
+	return service.SearchPropiedades(&models.PropiedadFiltro{}, page)
+}
+
+// GET /propiedades/search
+// Funcion que recupera las propiedades que cumplen con los filtros, todos los filtros son opcionales
+func (service *PropiedadService) SearchPropiedades(filtro *models.PropiedadFiltro, page *models.PageRequest) (*models.Page[*models.MenuPropiedades], error) {
+	cursor, err := normalizePage(page)
+	if err != nil {
+		return nil, err
+	}
+	conditions, args, err := buildPropiedadFilter(filtro)
+	if err != nil {
+		return nil, err
+	}
+	sortColumn, desc, err := buildPropiedadOrder(filtro)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Println("No rows found")
-			return nil, nil
-		}
-		log.Println("Error fetching all propiedades:", err)
 		return nil, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var propiedad models.MenuPropiedades
-		err := rows.Scan(&propiedad.IDPropiedad, &propiedad.Titulo, &propiedad.Precio, &propiedad.Habitaciones, &propiedad.TipoTransaccion, &propiedad.Estado)
+	from := `
+		FROM Propiedades
+		INNER JOIN Estado_Propiedades ON Propiedades.id_propiedad = Estado_Propiedades.id_propiedad`
+
+	total, err := countRows(service.DB, "SELECT COUNT(*)"+from+whereClause(conditions), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	order := pageOrder{Column: sortColumn, ID: "Propiedades.id_propiedad", Desc: desc}
+	if cursor != nil {
+		condition, cursorArgs, err := keysetCondition(cursor, order)
 		if err != nil {
-			log.Println("Error scanning propiedad:", err)
 			return nil, err
 		}
-		propiedades = append(propiedades, &propiedad)
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
 	}
-
-	if err = rows.Err(); err != nil {
-		log.Println("Error with rows:", err)
-		return nil, err
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
 	}
-	return propiedades, nil
-}
+	orderBy := " ORDER BY " + sortColumn + " " + direction
+	if sortColumn != "Propiedades.id_propiedad" {
+		// El id desempata para que el orden sea estable entre paginas
+		orderBy += ", Propiedades.id_propiedad " + direction
+	}
+	limit, limitArgs := limitClause(page)
+	args = append(args, limitArgs...)
 
-func (service *PropiedadService) GetAllPropiedadesByPrice() ([]*models.MenuPropiedades, error) {
-	var propiedades []*models.MenuPropiedades
 	query := `
-		SELECT Propiedades.id_propiedad, Propiedades.titulo, Propiedades.precio, Propiedades.num_recamaras, 
-		       Estado_Propiedades.tipo_transaccion, Estado_Propiedades.estado 
-		FROM Propiedades, Estado_Propiedades 
-		WHERE Propiedades.id_propiedad = Estado_Propiedades.id_propiedad
-		ORDER BY Propiedades.precio DESC` // Orden descendente por precio
+		SELECT Propiedades.id_propiedad, Propiedades.titulo, Propiedades.precio, Propiedades.num_recamaras,
+		       Estado_Propiedades.tipo_transaccion, Estado_Propiedades.estado, ` + sortColumn +
+		from + whereClause(conditions) + orderBy + limit
 
-	rows, err := service.DB.Query(query)
+	rows, err := service.DB.Query(query, args...)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Println("No rows found")
-			return nil, nil
-		}
-		log.Println("Error fetching all propiedades:", err)
+		log.Println("Error fetching propiedades:", err)
 		return nil, err
 	}
 	defer rows.Close()
 
+	var propiedades []*models.MenuPropiedades
+	sortValues := map[*models.MenuPropiedades]sql.NullString{}
 	for rows.Next() {
 		var propiedad models.MenuPropiedades
-		err := rows.Scan(&propiedad.IDPropiedad, &propiedad.Titulo, &propiedad.Precio, &propiedad.Habitaciones, &propiedad.TipoTransaccion, &propiedad.Estado)
+		var sortValue sql.NullString
+		err := rows.Scan(&propiedad.IDPropiedad, &propiedad.Titulo, &propiedad.Precio, &propiedad.Habitaciones, &propiedad.TipoTransaccion, &propiedad.Estado, &sortValue)
 		if err != nil {
 			log.Println("Error scanning propiedad:", err)
 			return nil, err
 		}
 		propiedades = append(propiedades, &propiedad)
+		sortValues[&propiedad] = sortValue
 	}
 
 	if err = rows.Err(); err != nil {
 		log.Println("Error with rows:", err)
 		return nil, err
 	}
-	return propiedades, nil
+
+	return buildPage(propiedades, total, page, order, func(propiedad *models.MenuPropiedades) (int, interface{}) {
+		if value := sortValues[propiedad]; value.Valid && sortColumn != "Propiedades.id_propiedad" {
+			return propiedad.IDPropiedad, value.String
+		}
+		return propiedad.IDPropiedad, nil
+	}), nil
 }
 
-func (service *PropiedadService) GetAllPropiedadesByBedrooms() ([]*models.MenuPropiedades, error) {
-	var propiedades []*models.MenuPropiedades
-	query := "SELECT Propiedades.id_propiedad, Propiedades.titulo, Propiedades.precio, Propiedades.num_recamaras, Estado_Propiedades.tipo_transaccion, Estado_Propiedades.estado FROM Propiedades, Estado_Propiedades WHERE Propiedades.id_propiedad = Estado_Propiedades.id_propiedad ORDER BY Propiedades.num_recamaras DESC"
-	rows, err := service.DB.Query(query)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Println("No rows found")
-			return nil, nil
+// helper function que arma las condiciones de la busqueda de propiedades, los valores siempre van como parametros
+func buildPropiedadFilter(filtro *models.PropiedadFiltro) ([]string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filtro.PrecioMin != nil {
+		conditions = append(conditions, "Propiedades.precio >= ?")
+		args = append(args, *filtro.PrecioMin)
+	}
+	if filtro.PrecioMax != nil {
+		conditions = append(conditions, "Propiedades.precio <= ?")
+		args = append(args, *filtro.PrecioMax)
+	}
+	if filtro.PrecioMin != nil && filtro.PrecioMax != nil && *filtro.PrecioMin > *filtro.PrecioMax {
+		return nil, nil, fmt.Errorf("%w: precio_min is greater than precio_max", ErrInvalidFilter)
+	}
+	if filtro.MinRecamaras != nil {
+		conditions = append(conditions, "Propiedades.num_recamaras >= ?")
+		args = append(args, *filtro.MinRecamaras)
+	}
+	if filtro.MinBanos != nil {
+		conditions = append(conditions, "Propiedades.num_banos >= ?")
+		args = append(args, *filtro.MinBanos)
+	}
+	if filtro.Ciudad != "" {
+		conditions = append(conditions, "Propiedades.ciudad = ?")
+		args = append(args, filtro.Ciudad)
+	}
+	if filtro.Colonia != "" {
+		conditions = append(conditions, "Propiedades.colonia = ?")
+		args = append(args, filtro.Colonia)
+	}
+	if filtro.IDTipoPropiedad != nil {
+		conditions = append(conditions, "Propiedades.id_tipo_propiedad = ?")
+		args = append(args, *filtro.IDTipoPropiedad)
+	}
+	if filtro.TipoTransaccion != "" {
+		conditions = append(conditions, "Estado_Propiedades.tipo_transaccion = ?")
+		args = append(args, filtro.TipoTransaccion)
+	}
+	if filtro.Estado != "" {
+		conditions = append(conditions, "Estado_Propiedades.estado = ?")
+		args = append(args, filtro.Estado)
+	}
+
+	sets := []struct {
+		column string
+		values []string
+	}{
+		{"gas", filtro.Gas},
+		{"comodidades", filtro.Comodidades},
+		{"extras", filtro.Extras},
+		{"utilidades", filtro.Utilidades},
+	}
+	for _, set := range sets {
+		for _, value := range splitSetValues(set.values) {
+			if !slices.Contains(propiedadSetValues[set.column], value) {
+				return nil, nil, fmt.Errorf("%w: %q is not a valid value for %s", ErrInvalidFilter, value, set.column)
+			}
+			// La columna es fija y el valor va como parametro, FIND_IN_SET exige que la propiedad tenga el valor
+			conditions = append(conditions, "FIND_IN_SET(?, Propiedades."+set.column+") > 0")
+			args = append(args, value)
 		}
-		log.Println("Error fetching all propiedades:", err)
-		return nil, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var propiedad models.MenuPropiedades
-		err := rows.Scan(&propiedad.IDPropiedad, &propiedad.Titulo, &propiedad.Precio, &propiedad.Habitaciones, &propiedad.TipoTransaccion, &propiedad.Estado)
-		if err != nil {
-			log.Println("Error scanning propiedad:", err)
-			return nil, err
+	return conditions, args, nil
+}
+
+// helper function que valida el campo y la dirección del orden usando solo los campos permitidos
+func buildPropiedadOrder(filtro *models.PropiedadFiltro) (string, bool, error) {
+	column := propiedadSortFields["id_propiedad"]
+	if filtro.OrdenarPor != "" {
+		var ok bool
+		column, ok = propiedadSortFields[filtro.OrdenarPor]
+		if !ok {
+			return "", false, fmt.Errorf("%w: cannot sort by %q", ErrInvalidFilter, filtro.OrdenarPor)
 		}
-		propiedades = append(propiedades, &propiedad)
 	}
 
-	if err = rows.Err(); err != nil {
-		log.Println("Error with rows:", err)
-		return nil, err
+	switch strings.ToLower(filtro.Orden) {
+	case "", "asc":
+		return column, false, nil
+	case "desc":
+		return column, true, nil
+	default:
+		return "", false, fmt.Errorf("%w: order must be asc or desc", ErrInvalidFilter)
+	}
+}
+
+// helper function que acepta valores repetidos (?extras=alberca&extras=jardin) o separados por coma (?extras=alberca,jardin)
+func splitSetValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part != "" {
+				result = append(result, part)
+			}
+		}
 	}
-	return propiedades, nil
+	return result
 }
 
 // GET /propiedad/:id
@@ -150,21 +269,79 @@ func (service *PropiedadService) GetPropiedad(id int) (*models.Propiedad, error)
 	return &propiedad, nil
 }
 
-func (service *PropiedadService) InsertPropiedad(propiedad *models.Propiedad, estado *models.EstadoPropiedades) (int, int, error) {
-	utils := database.NewDbUtilities(service.DB)
-	lastID, err := utils.GetLastId("Propiedades", "id_propiedad")
-	if err != nil {
-		log.Println("Error getting last ID:", err)
+// InsertPropiedad inserta la propiedad y su estado inicial en una sola transacción
+func (service *PropiedadService) InsertPropiedad(propiedad *models.Propiedad, estado *models.EstadoPropiedades, usuario string) (int, int, error) {
+	completa := &models.PropiedadCompleta{Propiedad: *propiedad, EstadoPropiedades: *estado}
+	if err := service.CreatePropiedadCompleta(completa, usuario); err != nil {
 		return 0, 0, err
 	}
-	propiedad.IDPropiedad = lastID + 1
+	*propiedad = completa.Propiedad
+	*estado = completa.EstadoPropiedades
+	return propiedad.IDPropiedad, estado.IDEstadoPropiedades, nil
+}
+
+// POST /propiedades/create/completa
+// CreatePropiedadCompleta inserta la propiedad, su estado inicial, sus imágenes y sus documentos anexos dentro de una transacción,
+// si cualquier insert falla se hace rollback de todo. Los ids generados se escriben en la misma estructura.
+func (service *PropiedadService) CreatePropiedadCompleta(completa *models.PropiedadCompleta, usuario string) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	propiedad := &completa.Propiedad
+	propiedad.IDPropiedad, err = insertPropiedadTx(tx, propiedad)
+	if err != nil {
+		return err
+	}
+
+	estado := &completa.EstadoPropiedades
+	estado.IDPropiedad = propiedad.IDPropiedad
+	estado.IDEstadoPropiedades, err = insertEstadoPropiedadTx(tx, estado, usuario)
+	if err != nil {
+		return err
+	}
 
-	query := "INSERT INTO Propiedades(id_propiedad, titulo, fecha_alta, direccion, colonia, ciudad, referencia, " +
+	for i := range completa.Imagenes {
+		imagen := &completa.Imagenes[i]
+		imagen.IDPropiedad = propiedad.IDPropiedad
+		imagen.IDImagen, err = insertImagenTx(tx, imagen)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range completa.DocumentosAnexos {
+		documento := &completa.DocumentosAnexos[i]
+		documento.IDPropiedad = propiedad.IDPropiedad
+		documento.IDDocumentoAnexo, err = insertDocumentoAnexoTx(tx, documento)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Los prospectos a los que les interesa quedan pendientes de avisar a su agente
+	if err := encolarMatches(tx, propiedad.IDPropiedad, MotivoNueva, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing propiedad:", err)
+		return err
+	}
+	return nil
+}
+
+// helper function que inserta la propiedad dentro de una transacción y regresa el id generado por la base de datos
+func insertPropiedadTx(tx *sql.Tx, propiedad *models.Propiedad) (int, error) {
+	query := "INSERT INTO Propiedades(titulo, fecha_alta, direccion, colonia, ciudad, referencia, " +
 		"precio, mts_construccion, mts_terreno, habitada, amueblada, " +
 		"num_plantas, num_recamaras, num_banos, size_cochera, mts_jardin, " +
 		"gas, comodidades, extras, utilidades, observaciones, id_tipo_propiedad, " +
-		"id_propietario, usuario) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
-	result, err := service.DB.Exec(query, propiedad.IDPropiedad, propiedad.Titulo, propiedad.FechaAlta,
+		"id_propietario, usuario) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
+	result, err := tx.Exec(query, propiedad.Titulo, propiedad.FechaAlta,
 		propiedad.Direccion, propiedad.Colonia, propiedad.Ciudad, propiedad.Referencia,
 		propiedad.Precio, propiedad.MtsConstruccion, propiedad.MtsTerreno, propiedad.Habitada, propiedad.Amueblada,
 		propiedad.NumPlantas, propiedad.NumRecamaras, propiedad.NumBanos, propiedad.SizeCochera, propiedad.MtsJardin,
@@ -172,58 +349,41 @@ func (service *PropiedadService) InsertPropiedad(propiedad *models.Propiedad, es
 		strings.Join(propiedad.Utilidades, ","), propiedad.Observaciones, propiedad.IDTipoPropiedad, propiedad.IDPropietario, propiedad.IDUsuario)
 	if err != nil {
 		log.Println("Error inserting propiedad:", err)
-		return 0, 0, err
+		return 0, err
 	}
-	rows, err := result.RowsAffected()
+	id, err := result.LastInsertId()
 	if err != nil {
-		log.Println("Error getting rows affected:", err)
-		return 0, 0, err
+		log.Println("Error getting propiedad ID:", err)
+		return 0, err
 	}
-	if rows != 1 {
-
-		log.Println("Error inserting estado: no rows affected")
-		return 0, 0, err
-	}
-
-	estado.IDPropiedad = propiedad.IDPropiedad
-	estado.IDEstadoPropiedades = lastID + 1
-	query = "INSERT INTO Estado_Propiedades (id_estado_propiedades, tipo_transaccion, estado, fecha_cambio_estado, id_propiedad) VALUES (?, ?, ?, ?, ?)"
-	result, err = service.DB.Exec(query, estado.IDEstadoPropiedades, estado.TipoTransaccion, estado.Estado, estado.FechaTransaccion, estado.IDPropiedad)
-	if err != nil {
-		log.Println("Error inserting estado de la propiedad:", err)
-		return 0, 0, err
-	}
-	rows, err = result.RowsAffected()
-	if err != nil {
-		log.Println("Error getting rows affected:", err)
-		return 0, 0, err
-	}
-	if rows != 1 {
-		log.Println("Error inserting estado: no rows affected")
-		return 0, 0, err
-	}
-	return propiedad.IDPropiedad, estado.IDEstadoPropiedades, nil
+	return int(id), nil
 }
 
-// UpdatePropiedad updates a Propiedad in the database
+// UpdatePropiedad updates a Propiedad in the database, si baja el precio se avisa a los prospectos interesados
 func (service *PropiedadService) UpdatePropiedad(propiedad *models.Propiedad, id int) error {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Propiedades", "id_propiedad")
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error getting last ID:", err)
+		log.Println("Error starting transaction:", err)
 		return err
 	}
-	println(lastId)
-	if id <= 0 || id > lastId {
-		log.Println("Invalid propiedad ID:", id)
+	defer tx.Rollback()
+
+	var precioAnterior float64
+	err = tx.QueryRow("SELECT precio FROM Propiedades WHERE id_propiedad = ? FOR UPDATE", id).Scan(&precioAnterior)
+	if err == sql.ErrNoRows {
+		return ErrResourceNotFound
+	}
+	if err != nil {
+		log.Println("Error updating propiedad:", err)
 		return err
 	}
+
 	query := "UPDATE Propiedades SET titulo=?, fecha_alta=?, direccion=?, colonia=?, ciudad=?, referencia=?, " +
 		"precio=?, mts_construccion=?, mts_terreno=?, habitada=?, amueblada=?, " +
 		"num_plantas=?, num_recamaras=?, num_banos=?, size_cochera=?, mts_jardin=?, " +
 		"gas=?, comodidades=?, extras=?, utilidades=?, observaciones=?, id_tipo_propiedad=?, " +
 		"id_propietario=?, usuario=? WHERE id_propiedad=?"
-	result, err := service.DB.Exec(query, propiedad.Titulo, propiedad.FechaAlta,
+	_, err = tx.Exec(query, propiedad.Titulo, propiedad.FechaAlta,
 		propiedad.Direccion, propiedad.Colonia, propiedad.Ciudad, propiedad.Referencia,
 		propiedad.Precio, propiedad.MtsConstruccion, propiedad.MtsTerreno, propiedad.Habitada, propiedad.Amueblada,
 		propiedad.NumPlantas, propiedad.NumRecamaras, propiedad.NumBanos, propiedad.SizeCochera, propiedad.MtsJardin,
@@ -233,13 +393,14 @@ func (service *PropiedadService) UpdatePropiedad(propiedad *models.Propiedad, id
 		log.Println("Error updating propiedad:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error getting rows affected:", err)
-		return err
+	if propiedad.Precio < precioAnterior {
+		if err := encolarMatches(tx, id, MotivoBajaPrecio, &precioAnterior); err != nil {
+			return err
+		}
 	}
-	if rows != 1 {
-		log.Println("Error updating propiedad: no rows affected")
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
 		return err
 	}
 	return nil
@@ -247,31 +408,58 @@ func (service *PropiedadService) UpdatePropiedad(propiedad *models.Propiedad, id
 
 // DeletePropiedad deletes a Propiedad from the database
 func (service *PropiedadService) DeletePropiedad(id int) error {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Propiedades", "id_propiedad")
-	println(lastId)
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error getting last ID:", err)
+		log.Println("Error starting transaction:", err)
 		return err
 	}
-	if id <= 0 || id > lastId {
-		log.Println("Invalid propiedad ID:", id)
+	defer tx.Rollback()
+
+	exists, err := database.RowExists(tx, "Propiedades", "id_propiedad", id)
+	if err != nil {
+		log.Println("Error checking propiedad:", err)
 		return err
 	}
+	if !exists {
+		return ErrResourceNotFound
+	}
 
-	query := "DELETE FROM Propiedades WHERE id_propiedad=?"
-	result, err := service.DB.Exec(query, id)
+	// Las imágenes, documentos y contratos tienen archivos en el storage y los contratos su cobranza, no se borran
+	// junto con la propiedad. La propiedad ya está bloqueada, no se le pueden agregar hasta que termine la transacción.
+	var imagenes, documentos, contratos int
+	err = tx.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM Imagenes WHERE id_propiedad = ?),
+		(SELECT COUNT(*) FROM Documentos_Anexos WHERE id_propiedad = ?),
+		(SELECT COUNT(*) FROM Contratos WHERE id_propiedad = ?)`, id, id, id).Scan(&imagenes, &documentos, &contratos)
 	if err != nil {
-		log.Println("Error deleting propiedad:", err)
+		log.Println("Error counting registros de la propiedad:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error getting rows affected:", err)
+	if imagenes+documentos+contratos > 0 {
+		return fmt.Errorf("%w: tiene %d imágenes, %d documentos y %d contratos, se deben eliminar antes de borrarla",
+			ErrPropiedadConRegistros, imagenes, documentos, contratos)
+	}
+
+	// the estado rows reference the propiedad, so they go first
+	if _, err := tx.Exec("DELETE FROM Estado_Propiedades WHERE id_propiedad=?", id); err != nil {
+		log.Println("Error deleting estado de la propiedad:", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM Citas_Propiedades WHERE id_propiedad=?", id); err != nil {
+		log.Println("Error deleting visitas de la propiedad:", err)
+		return err
+	}
+	if _, err := tx.Exec("UPDATE Notificaciones_Match SET estado = 'cancelado' WHERE id_propiedad = ? AND estado = 'pendiente'", id); err != nil {
+		log.Println("Error canceling avisos de la propiedad:", err)
 		return err
 	}
-	if rows == 0 {
-		log.Println("Error deleting propiedad: no rows affected")
+	if _, err := tx.Exec("DELETE FROM Propiedades WHERE id_propiedad=?", id); err != nil {
+		log.Println("Error deleting propiedad:", err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
 		return err
 	}
 	return nil
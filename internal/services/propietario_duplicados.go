@@ -0,0 +1,112 @@
+package services
+
+import (
+	"backend/internal/models"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// GET /propietarios/duplicados?id=&minimo=70
+// Pares de propietarios que parecen la misma persona por correo, teléfono o nombre
+func (service *PropietarioService) GetDuplicados(filtro *models.FiltroDuplicados) ([]*models.ParDuplicados, error) {
+	minimo, err := normalizarFiltroDuplicados(filtro)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := service.DB.Query(`SELECT id_propietario, nombre_propietario, apellido_paterno_propietario, apellido_materno_propietario,
+		telefono_propietario, correo_propietario FROM Propietario ORDER BY id_propietario`)
+	if err != nil {
+		log.Println("Error fetching propietarios:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contactos []contacto
+	for rows.Next() {
+		var c contacto
+		var nombre, apellidoP, apellidoM, telefono, correo sql.NullString
+		if err := rows.Scan(&c.ID, &nombre, &apellidoP, &apellidoM, &telefono, &correo); err != nil {
+			log.Println("Error scanning propietario:", err)
+			return nil, err
+		}
+		c.Nombre = strings.Join(strings.Fields(nombre.String+" "+apellidoP.String+" "+apellidoM.String), " ")
+		c.Telefono = telefono.String
+		c.Correo = correo.String
+		contactos = append(contactos, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return buscarDuplicados(contactos, filtro.ID, minimo), nil
+}
+
+// POST /propietarios/fusionar
+// Fusionar pasa las propiedades del duplicado al propietario que se conserva y borra el duplicado en una transacción.
+// El que se conserva mantiene sus datos y solo toma del duplicado los que le faltan.
+func (service *PropietarioService) Fusionar(fusion *models.Fusion) (*models.Propietario, error) {
+	if fusion.IDConservar == fusion.IDDuplicado {
+		return nil, fmt.Errorf("%w: no se puede fusionar un propietario consigo mismo", ErrInvalidContacto)
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Se bloquean en orden de id para que dos fusiones cruzadas no se esperen entre sí
+	bloqueados := map[int]*models.Propietario{}
+	for _, id := range []int{min(fusion.IDConservar, fusion.IDDuplicado), max(fusion.IDConservar, fusion.IDDuplicado)} {
+		var p models.Propietario
+		var nombre, apellidoP, apellidoM, telefono, correo sql.NullString
+		query := `SELECT id_propietario, nombre_propietario, apellido_paterno_propietario, apellido_materno_propietario,
+			telefono_propietario, correo_propietario FROM Propietario WHERE id_propietario = ? FOR UPDATE`
+		err := tx.QueryRow(query, id).Scan(&p.IDPropietario, &nombre, &apellidoP, &apellidoM, &telefono, &correo)
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		if err != nil {
+			log.Println("Error fetching propietario:", err)
+			return nil, err
+		}
+		p.Nombre, p.ApellidoP, p.ApellidoM = nombre.String, apellidoP.String, apellidoM.String
+		p.Telefono, p.Correo = telefono.String, correo.String
+		bloqueados[id] = &p
+	}
+	conservar, duplicado := bloqueados[fusion.IDConservar], bloqueados[fusion.IDDuplicado]
+
+	conservar.Nombre = primeroNoVacio(conservar.Nombre, duplicado.Nombre)
+	conservar.ApellidoP = primeroNoVacio(conservar.ApellidoP, duplicado.ApellidoP)
+	conservar.ApellidoM = primeroNoVacio(conservar.ApellidoM, duplicado.ApellidoM)
+	conservar.Telefono = primeroNoVacio(conservar.Telefono, duplicado.Telefono)
+	conservar.Correo = primeroNoVacio(conservar.Correo, duplicado.Correo)
+	query := `UPDATE Propietario SET nombre_propietario = ?, apellido_paterno_propietario = ?, apellido_materno_propietario = ?,
+		telefono_propietario = ?, correo_propietario = ? WHERE id_propietario = ?`
+	if _, err := tx.Exec(query, conservar.Nombre, conservar.ApellidoP, conservar.ApellidoM, conservar.Telefono, conservar.Correo,
+		conservar.IDPropietario); err != nil {
+		log.Println("Error merging propietario:", err)
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE Propiedades SET id_propietario = ? WHERE id_propietario = ?", conservar.IDPropietario, duplicado.IDPropietario); err != nil {
+		log.Println("Error merging propiedades:", err)
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE Partes_Contrato SET id_propietario = ? WHERE id_propietario = ?", conservar.IDPropietario, duplicado.IDPropietario); err != nil {
+		log.Println("Error merging partes de contrato:", err)
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM Propietario WHERE id_propietario = ?", duplicado.IDPropietario); err != nil {
+		log.Println("Error deleting propietario:", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		return nil, err
+	}
+	return conservar, nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"backend/internal/models"
+	"database/sql"
+	"log"
+	"strings"
+)
+
+// escaparLike escapa los comodines de LIKE para buscar el texto tal cual
+var escaparLike = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// GET /propietarios/all
+func (service *PropietarioService) GetAllPropietarios(page *models.PageRequest) (*models.Page[*models.PropietarioListado], error) {
+	return service.SearchPropietarios(&models.PropietarioFiltro{}, page)
+}
+
+// GET /propietarios/search?q=&con_propiedades=
+// Funcion que busca propietarios por nombre, correo o teléfono, ordenados por id
+func (service *PropietarioService) SearchPropietarios(filtro *models.PropietarioFiltro, page *models.PageRequest) (*models.Page[*models.PropietarioListado], error) {
+	cursor, err := normalizePage(page)
+	if err != nil {
+		return nil, err
+	}
+
+	var conditions []string
+	var args []interface{}
+	if q := strings.TrimSpace(filtro.Q); q != "" {
+		patron := "%" + escaparLike.Replace(q) + "%"
+		condition := `(CONCAT_WS(' ', Propietario.nombre_propietario, Propietario.apellido_paterno_propietario, Propietario.apellido_materno_propietario) LIKE ?
+			OR Propietario.correo_propietario LIKE ? OR Propietario.telefono_propietario LIKE ?`
+		args = append(args, patron, patron, patron)
+		// Un teléfono se busca también como se guarda, en E.164
+		if telefono, err := normalizarTelefono(q); err == nil {
+			condition += " OR Propietario.telefono_propietario = ?"
+			args = append(args, telefono)
+		}
+		conditions = append(conditions, condition+")")
+	}
+	if filtro.ConPropiedades != nil {
+		condition := "EXISTS (SELECT 1 FROM Propiedades WHERE Propiedades.id_propietario = Propietario.id_propietario)"
+		if !*filtro.ConPropiedades {
+			condition = "NOT " + condition
+		}
+		conditions = append(conditions, condition)
+	}
+
+	total, err := countRows(service.DB, "SELECT COUNT(*) FROM Propietario"+whereClause(conditions), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	order := pageOrder{ID: "Propietario.id_propietario"}
+	if cursor != nil {
+		condition, cursorArgs, err := keysetCondition(cursor, order)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+	limit, limitArgs := limitClause(page)
+	args = append(args, limitArgs...)
+
+	query := `SELECT Propietario.id_propietario, Propietario.nombre_propietario, Propietario.apellido_paterno_propietario,
+			Propietario.apellido_materno_propietario, Propietario.telefono_propietario, Propietario.correo_propietario,
+			(SELECT COUNT(*) FROM Propiedades WHERE Propiedades.id_propietario = Propietario.id_propietario)
+		FROM Propietario` + whereClause(conditions) + " ORDER BY Propietario.id_propietario" + limit
+	rows, err := service.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching propietarios:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var propietarios []*models.PropietarioListado
+	for rows.Next() {
+		var p models.PropietarioListado
+		var nombre, apellidoP, apellidoM, telefono, correo sql.NullString
+		if err := rows.Scan(&p.IDPropietario, &nombre, &apellidoP, &apellidoM, &telefono, &correo, &p.NumPropiedades); err != nil {
+			log.Println("Error scanning propietario:", err)
+			return nil, err
+		}
+		p.Nombre, p.ApellidoP, p.ApellidoM = nombre.String, apellidoP.String, apellidoM.String
+		p.Telefono, p.Correo = telefono.String, correo.String
+		propietarios = append(propietarios, &p)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+
+	return buildPage(propietarios, total, page, order, func(p *models.PropietarioListado) (int, interface{}) {
+		return p.IDPropietario, nil
+	}), nil
+}
+
+// GET /propietarios/:id/propiedades
+// Funcion que regresa las propiedades del propietario con su estado actual y cuántas hay en cada estado
+func (service *PropietarioService) GetPortafolio(id int) (*models.PortafolioPropietario, error) {
+	propietario, err := service.GetPropietario(id)
+	if err != nil {
+		return nil, err
+	}
+	if propietario == nil {
+		return nil, ErrResourceNotFound
+	}
+
+	query := `SELECT Propiedades.id_propiedad, Propiedades.titulo, Propiedades.direccion, Propiedades.colonia, Propiedades.ciudad,
+			Propiedades.precio, Estado_Propiedades.tipo_transaccion, Estado_Propiedades.estado, Estado_Propiedades.fecha_cambio_estado
+		FROM Propiedades
+		LEFT JOIN Estado_Propiedades ON Estado_Propiedades.id_propiedad = Propiedades.id_propiedad
+		WHERE Propiedades.id_propietario = ?
+		ORDER BY Propiedades.id_propiedad`
+	rows, err := service.DB.Query(query, id)
+	if err != nil {
+		log.Println("Error fetching propiedades del propietario:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	portafolio := &models.PortafolioPropietario{
+		Propietario: *propietario,
+		Propiedades: []*models.PropiedadPortafolio{},
+		Resumen:     map[string]int{},
+	}
+	for rows.Next() {
+		var p models.PropiedadPortafolio
+		var titulo, direccion, colonia, ciudad, transaccion, estado sql.NullString
+		var fecha sql.NullTime
+		if err := rows.Scan(&p.IDPropiedad, &titulo, &direccion, &colonia, &ciudad, &p.Precio, &transaccion, &estado, &fecha); err != nil {
+			log.Println("Error scanning propiedad:", err)
+			return nil, err
+		}
+		p.Titulo, p.Direccion, p.Colonia, p.Ciudad = titulo.String, direccion.String, colonia.String, ciudad.String
+		p.TipoTransaccion = transaccion.String
+		p.Estado = estado.String
+		if !estado.Valid {
+			p.Estado = "sin_estado"
+		}
+		if fecha.Valid {
+			p.FechaCambioEstado = &fecha.Time
+		}
+		portafolio.Propiedades = append(portafolio.Propiedades, &p)
+		portafolio.Resumen[p.Estado]++
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return portafolio, nil
+}
@@ -4,9 +4,14 @@ import (
 	"backend/internal/models"
 	"backend/internal/database"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 )
 
+// ErrPropietarioConPropiedades se regresa al borrar un propietario que todavía tiene propiedades
+var ErrPropietarioConPropiedades = errors.New("propietario still has propiedades")
+
 type PropietarioService struct {
 	DB *sql.DB
 }
@@ -36,92 +41,72 @@ func (service *PropietarioService) GetPropietario(id int) (*models.Propietario,
 }
 
 // POST /propietario
-// Funcion que inserta un nuevo propietario en la base de datos
+// Funcion que inserta un nuevo propietario en la base de datos, el teléfono se guarda en E.164 y el correo en minúsculas
 func (service *PropietarioService) CreatePropietario(propietario *models.Propietario) (int, error) {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Propietario", "id_propietario")
-	if err != nil {
-		log.Println("Error gettin last Id in Propietario table:", err)
+	if err := normalizarContacto(&propietario.Telefono, &propietario.Correo); err != nil {
 		return 0, err
 	}
-	propietario.IDPropietario = lastId + 1
-	query := "INSERT INTO Propietario (id_propietario, nombre, apellido_p, apellido_m, telefono, correo) VALUES (?, ?, ?, ?, ?)"
-	result, err := service.DB.Exec(query, propietario.IDPropietario, propietario.Nombre, propietario.ApellidoP, propietario.ApellidoM, propietario.Telefono, propietario.Correo)
+	query := "INSERT INTO Propietario (nombre_propietario, apellido_paterno_propietario, apellido_materno_propietario, telefono_propietario, correo_propietario) VALUES (?, ?, ?, ?, ?)"
+	id, err := database.Insert(service.DB, query, propietario.Nombre, propietario.ApellidoP, propietario.ApellidoM, propietario.Telefono, propietario.Correo)
 	if err != nil {
 		log.Println("Error inserting propietario:", err)
 		return 0, err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error getting rows affected:", err)
-		return 0, err
-	}
-	if (rows != 0) {
-		log.Println("No rows affected")
-		return 0, nil
-	}
-
+	propietario.IDPropietario = id
 	return propietario.IDPropietario, nil
 }
 
 // PUT /propietario
 // Funcion que actualiza la informacion de un propietario en la base de datos
 func (service *PropietarioService) UpdatePropietario(propietario *models.Propietario) error {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Propietario", "id_propietario")
-	if err != nil {
-		log.Println("Error gettin last Id in Propietario table:", err)
+	if err := normalizarContacto(&propietario.Telefono, &propietario.Correo); err != nil {
 		return err
 	}
-	if(propietario.IDPropietario > lastId && propietario.IDPropietario < 0) {
-		log.Println("Propietario ID not found")
-		return nil
-	}
-	query := "UPDATE Propietario SET nombre = ?, apellido_p = ?, apellido_m = ?, telefono = ?, correo = ? WHERE id_propietario = ?"
-	result, err := service.DB.Exec(query, propietario.Nombre, propietario.ApellidoP, propietario.ApellidoM, propietario.Telefono, propietario.Correo, propietario.IDPropietario)
+	query := "UPDATE Propietario SET nombre_propietario = ?, apellido_paterno_propietario = ?, apellido_materno_propietario = ?, telefono_propietario = ?, correo_propietario = ? WHERE id_propietario = ?"
+	err := database.ExecExisting(service.DB, "Propietario", "id_propietario", propietario.IDPropietario, query, propietario.Nombre, propietario.ApellidoP, propietario.ApellidoM, propietario.Telefono, propietario.Correo, propietario.IDPropietario)
 	if err != nil {
 		log.Println("Error updating propietario:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error getting rows affected:", err)
-		return err
-	}
-	if (rows != 0) {
-		log.Println("No rows affected")
-		return nil
-	}
 	return nil
 }
 
 // DELETE /propietario/:id
-// Funcion que elimina un propietario de la base de datos
+// Funcion que elimina un propietario de la base de datos, no lo borra si todavía tiene propiedades
 func (service *PropietarioService) DeletePropietario(id int) error {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Propietario", "id_propietario")
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error gettin last Id in Propietario table:", err)
+		log.Println("Error starting transaction:", err)
 		return err
 	}
-	if(id > lastId && id < 0) {
-		log.Println("Propietario ID not found")
-		return nil
-	}
-	query := "DELETE FROM Propietario WHERE id_propietario = ?"
-	result, err := service.DB.Exec(query, id)
+	defer tx.Rollback()
+
+	exists, err := database.RowExists(tx, "Propietario", "id_propietario", id)
 	if err != nil {
-		log.Println("Error deleting propietario:", err)
+		log.Println("Error checking propietario:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error getting rows affected:", err)
+	if !exists {
+		return ErrResourceNotFound
+	}
+
+	// El propietario ya está bloqueado, la llave foránea no deja asignarle una propiedad hasta que termine la transacción
+	var propiedades int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM Propiedades WHERE id_propietario = ?", id).Scan(&propiedades); err != nil {
+		log.Println("Error counting propiedades:", err)
 		return err
 	}
-	if rows == 0 {
-		log.Println("No rows affected")
-		return nil
+	if propiedades > 0 {
+		return fmt.Errorf("%w: tiene %d propiedades, se deben pasar a otro propietario (o fusionarlo) antes de borrarlo", ErrPropietarioConPropiedades, propiedades)
+	}
+
+	if _, err := tx.Exec("DELETE FROM Propietario WHERE id_propietario = ?", id); err != nil {
+		log.Println("Error deleting propietario:", err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		return err
 	}
 	return nil
-}
\ No newline at end of file
+}
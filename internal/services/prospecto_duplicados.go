@@ -0,0 +1,151 @@
+package services
+
+import (
+	"backend/internal/models"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// GET /prospectos/duplicados?id=&minimo=70
+// Pares de prospectos que parecen la misma persona por correo, teléfono o nombre
+func (service *ProspectoService) GetDuplicados(filtro *models.FiltroDuplicados) ([]*models.ParDuplicados, error) {
+	minimo, err := normalizarFiltroDuplicados(filtro)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := service.DB.Query(`SELECT id_cliente, nombre_prospecto, apellido_paterno_prospecto, apellido_materno_prospecto,
+		telefono_prospecto, correo_prospecto FROM Prospecto ORDER BY id_cliente`)
+	if err != nil {
+		log.Println("Error fetching prospectos:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contactos []contacto
+	for rows.Next() {
+		var c contacto
+		var nombre, apellidoP, apellidoM, telefono, correo sql.NullString
+		if err := rows.Scan(&c.ID, &nombre, &apellidoP, &apellidoM, &telefono, &correo); err != nil {
+			log.Println("Error scanning prospecto:", err)
+			return nil, err
+		}
+		c.Nombre = strings.Join(strings.Fields(nombre.String+" "+apellidoP.String+" "+apellidoM.String), " ")
+		c.Telefono = telefono.String
+		c.Correo = correo.String
+		contactos = append(contactos, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return buscarDuplicados(contactos, filtro.ID, minimo), nil
+}
+
+// POST /prospectos/fusionar
+// Fusionar pasa las citas, imágenes, actividades y avisos del duplicado al prospecto que se conserva y borra el duplicado,
+// todo en una transacción. El que se conserva mantiene sus datos y su etapa, solo toma del duplicado lo que le falta.
+func (service *ProspectoService) Fusionar(fusion *models.Fusion, autor string) (*models.Prospecto, error) {
+	if fusion.IDConservar == fusion.IDDuplicado {
+		return nil, fmt.Errorf("%w: no se puede fusionar un prospecto consigo mismo", ErrInvalidProspecto)
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Se bloquean en orden de id para que dos fusiones cruzadas no se esperen entre sí
+	bloqueados := map[int]*models.Prospecto{}
+	for _, id := range []int{min(fusion.IDConservar, fusion.IDDuplicado), max(fusion.IDConservar, fusion.IDDuplicado)} {
+		prospecto, err := scanProspecto(tx.QueryRow("SELECT "+columnasProspecto+" FROM Prospecto WHERE id_cliente = ? FOR UPDATE", id))
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		if err != nil {
+			log.Println("Error fetching prospecto:", err)
+			return nil, err
+		}
+		bloqueados[id] = prospecto
+	}
+	conservar, duplicado := bloqueados[fusion.IDConservar], bloqueados[fusion.IDDuplicado]
+
+	origen := conservar.Origen
+	if origen == OrigenOtro {
+		origen = duplicado.Origen
+	}
+	criterios := conservar.Criterios
+	if criteriosVacios(criterios) {
+		criterios = duplicado.Criterios
+	}
+	fechaAlta := conservar.FechaAlta
+	if fechaAlta == nil || (duplicado.FechaAlta != nil && duplicado.FechaAlta.Before(*fechaAlta)) {
+		fechaAlta = duplicado.FechaAlta
+	}
+	args := []interface{}{primeroNoVacio(conservar.Nombre, duplicado.Nombre), primeroNoVacio(conservar.ApellidoP, duplicado.ApellidoP),
+		primeroNoVacio(conservar.ApellidoM, duplicado.ApellidoM), primeroNoVacio(conservar.Telefono, duplicado.Telefono),
+		primeroNoVacio(conservar.Correo, duplicado.Correo), nullIfEmpty(primeroNoVacio(conservar.Usuario, duplicado.Usuario)), origen, fechaAlta}
+	args = append(args, valoresCriterios(criterios)...)
+	query := `UPDATE Prospecto SET nombre_prospecto=?, apellido_paterno_prospecto=?, apellido_materno_prospecto=?, telefono_prospecto=?,
+		correo_prospecto=?, usuario=?, origen=?, fecha_alta=?, tipo_transaccion=?, id_tipo_propiedad=?, ciudad=?, colonia=?,
+		presupuesto_min=?, presupuesto_max=?, num_recamaras_min=?, num_banos_min=?, extras=? WHERE id_cliente=?`
+	if _, err := tx.Exec(query, append(args, conservar.IdCliente)...); err != nil {
+		log.Println("Error merging prospecto:", err)
+		return nil, err
+	}
+
+	// Las imágenes del duplicado van al final de la galería y solo queda una principal
+	var tienePrincipal bool
+	var ultimaPosicion int
+	err = tx.QueryRow("SELECT COALESCE(MAX(principal = 1), 0), COALESCE(MAX(posicion), -1) FROM ImagenesProspecto WHERE id_prospecto = ?",
+		conservar.IdCliente).Scan(&tienePrincipal, &ultimaPosicion)
+	if err != nil {
+		log.Println("Error fetching imagenes prospecto:", err)
+		return nil, err
+	}
+	if tienePrincipal {
+		if _, err := tx.Exec("UPDATE ImagenesProspecto SET principal = 0 WHERE id_prospecto = ?", duplicado.IdCliente); err != nil {
+			log.Println("Error merging imagenes prospecto:", err)
+			return nil, err
+		}
+	}
+
+	reasignar := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE ImagenesProspecto SET id_prospecto = ?, posicion = posicion + ? WHERE id_prospecto = ?",
+			[]interface{}{conservar.IdCliente, ultimaPosicion + 1, duplicado.IdCliente}},
+		{"UPDATE Citas SET id_cliente = ? WHERE id_cliente = ?", []interface{}{conservar.IdCliente, duplicado.IdCliente}},
+		{"UPDATE Actividades_Prospecto SET id_cliente = ? WHERE id_cliente = ?", []interface{}{conservar.IdCliente, duplicado.IdCliente}},
+		{"UPDATE Contratos SET id_cliente = ? WHERE id_cliente = ?", []interface{}{conservar.IdCliente, duplicado.IdCliente}},
+		{"UPDATE Partes_Contrato SET id_cliente = ? WHERE id_cliente = ?", []interface{}{conservar.IdCliente, duplicado.IdCliente}},
+		// Si los dos ya tenían el aviso de la misma propiedad se queda el del que se conserva
+		{"UPDATE IGNORE Notificaciones_Match SET id_cliente = ? WHERE id_cliente = ?", []interface{}{conservar.IdCliente, duplicado.IdCliente}},
+		{"DELETE FROM Notificaciones_Match WHERE id_cliente = ?", []interface{}{duplicado.IdCliente}},
+		{"DELETE FROM Prospecto WHERE id_cliente = ?", []interface{}{duplicado.IdCliente}},
+	}
+	for _, r := range reasignar {
+		if _, err := tx.Exec(r.query, r.args...); err != nil {
+			log.Println("Error merging prospecto:", err)
+			return nil, err
+		}
+	}
+
+	nombre := strings.TrimSpace(duplicado.Nombre + " " + duplicado.ApellidoP)
+	titulo := fmt.Sprintf("Se fusionó el prospecto #%d (%s)", duplicado.IdCliente, nombre)
+	descripcion := strings.Join(strings.Fields(strings.Join([]string{duplicado.Telefono, duplicado.Correo}, " ")), ", ")
+	if err := registrarActividad(tx, conservar.IdCliente, ActividadFusion, titulo, descripcion, autor, time.Now().UTC(), nil); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		return nil, err
+	}
+	return service.GetProspecto(conservar.IdCliente)
+}
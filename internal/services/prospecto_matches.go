@@ -0,0 +1,367 @@
+package services
+
+import (
+	"backend/internal/models"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Puntos de cada criterio, solo cuentan los que el prospecto llenó y el puntaje es el porcentaje de los puntos posibles
+const (
+	pesoPresupuesto   = 30
+	pesoCiudad        = 15
+	pesoColonia       = 10
+	pesoTipoPropiedad = 15
+	pesoRecamaras     = 10
+	pesoBanos         = 5
+	pesoExtras        = 15
+)
+
+// Criterios que aparecen en coincide y no_coincide
+const (
+	CriterioPresupuesto   = "presupuesto"
+	CriterioCiudad        = "ciudad"
+	CriterioColonia       = "colonia"
+	CriterioTipoPropiedad = "tipo_propiedad"
+	CriterioRecamaras     = "num_recamaras"
+	CriterioBanos         = "num_banos"
+	CriterioExtras        = "extras"
+)
+
+const (
+	puntajeMinimoDefault = 60
+	matchesDefault       = 20
+	matchesMax           = 100
+	// Una propiedad que se pasa del presupuesto máximo por más de esto ya no es match, hasta ahí cuenta a medias
+	toleranciaPresupuesto = 0.10
+)
+
+// quitarAcentos sirve para comparar ciudades y colonias capturadas con y sin acentos
+var quitarAcentos = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n")
+
+func normalizarTexto(texto string) string {
+	return quitarAcentos.Replace(strings.ToLower(strings.Join(strings.Fields(texto), " ")))
+}
+
+// propiedadMatch son los datos de la propiedad que se comparan con los criterios
+type propiedadMatch struct {
+	models.MenuPropiedades
+	Ciudad          string
+	Colonia         string
+	NumBanos        int
+	IDTipoPropiedad int
+	Extras          []string
+}
+
+// puntuar compara la propiedad con los criterios del prospecto. Regresa false si la propiedad queda descartada:
+// es de otro tipo de transacción, se pasa del presupuesto más de la tolerancia o el prospecto no tiene criterios.
+func puntuar(criterios *models.CriteriosBusqueda, propiedad *propiedadMatch) (models.PuntajeMatch, bool) {
+	var puntaje models.PuntajeMatch
+	if criteriosVacios(criterios) {
+		return puntaje, false
+	}
+	if criterios.TipoTransaccion != "" && criterios.TipoTransaccion != propiedad.TipoTransaccion {
+		return puntaje, false
+	}
+
+	var posibles, obtenidos float64
+	evaluar := func(criterio string, peso int, fraccion float64) {
+		posibles += float64(peso)
+		obtenidos += float64(peso) * fraccion
+		if fraccion == 1 {
+			puntaje.Coincide = append(puntaje.Coincide, criterio)
+		} else {
+			puntaje.NoCoincide = append(puntaje.NoCoincide, criterio)
+		}
+	}
+	coincide := func(ok bool) float64 {
+		if ok {
+			return 1
+		}
+		return 0
+	}
+
+	if criterios.PresupuestoMin != nil || criterios.PresupuestoMax != nil {
+		fraccion := 1.0
+		switch {
+		case criterios.PresupuestoMax != nil && propiedad.Precio > *criterios.PresupuestoMax*(1+toleranciaPresupuesto):
+			return puntaje, false
+		case criterios.PresupuestoMax != nil && propiedad.Precio > *criterios.PresupuestoMax:
+			fraccion = 0.5
+		case criterios.PresupuestoMin != nil && propiedad.Precio < *criterios.PresupuestoMin:
+			fraccion = 0.5
+		}
+		evaluar(CriterioPresupuesto, pesoPresupuesto, fraccion)
+	}
+	if criterios.Ciudad != "" {
+		evaluar(CriterioCiudad, pesoCiudad, coincide(normalizarTexto(criterios.Ciudad) == normalizarTexto(propiedad.Ciudad)))
+	}
+	if criterios.Colonia != "" {
+		evaluar(CriterioColonia, pesoColonia, coincide(normalizarTexto(criterios.Colonia) == normalizarTexto(propiedad.Colonia)))
+	}
+	if criterios.IDTipoPropiedad != nil {
+		evaluar(CriterioTipoPropiedad, pesoTipoPropiedad, coincide(*criterios.IDTipoPropiedad == propiedad.IDTipoPropiedad))
+	}
+	if criterios.RecamarasMin != nil {
+		// Una recámara menos de las que busca cuenta a medias
+		fraccion := coincide(propiedad.Habitaciones >= *criterios.RecamarasMin)
+		if propiedad.Habitaciones == *criterios.RecamarasMin-1 {
+			fraccion = 0.5
+		}
+		evaluar(CriterioRecamaras, pesoRecamaras, fraccion)
+	}
+	if criterios.BanosMin != nil {
+		evaluar(CriterioBanos, pesoBanos, coincide(propiedad.NumBanos >= *criterios.BanosMin))
+	}
+	if len(criterios.Extras) > 0 {
+		tiene := 0
+		for _, extra := range criterios.Extras {
+			for _, e := range propiedad.Extras {
+				if e == extra {
+					tiene++
+					break
+				}
+			}
+		}
+		evaluar(CriterioExtras, pesoExtras, float64(tiene)/float64(len(criterios.Extras)))
+	}
+
+	if posibles == 0 {
+		// Solo tiene el tipo de transacción, todas las propiedades de ese tipo le quedan igual
+		puntaje.Puntaje = 100
+	} else {
+		puntaje.Puntaje = int(math.Round(obtenidos / posibles * 100))
+	}
+	if puntaje.Coincide == nil {
+		puntaje.Coincide = []string{}
+	}
+	if puntaje.NoCoincide == nil {
+		puntaje.NoCoincide = []string{}
+	}
+	return puntaje, true
+}
+
+// normalizarFiltroMatches aplica el puntaje mínimo y el límite por defecto
+func normalizarFiltroMatches(filtro *models.FiltroMatches) (int, int, error) {
+	minimo := puntajeMinimoDefault
+	if filtro.Minimo != nil {
+		minimo = *filtro.Minimo
+	}
+	if minimo < 0 || minimo > 100 {
+		return 0, 0, fmt.Errorf("%w: minimo debe estar entre 0 y 100", ErrInvalidFilter)
+	}
+	limite := filtro.Limite
+	if limite < 0 {
+		return 0, 0, fmt.Errorf("%w: limite no puede ser negativo", ErrInvalidFilter)
+	}
+	if limite == 0 {
+		limite = matchesDefault
+	}
+	if limite > matchesMax {
+		limite = matchesMax
+	}
+	return minimo, limite, nil
+}
+
+// cargarPropiedadesMatch lee las propiedades que cumplen la condición, la condición siempre es una constante del servicio
+func cargarPropiedadesMatch(db queryer, condicion string, args ...interface{}) ([]*propiedadMatch, error) {
+	query := `SELECT Propiedades.id_propiedad, Propiedades.titulo, Propiedades.precio, Propiedades.num_recamaras,
+			Estado_Propiedades.tipo_transaccion, Estado_Propiedades.estado, Propiedades.ciudad, Propiedades.colonia,
+			Propiedades.num_banos, Propiedades.id_tipo_propiedad, Propiedades.extras
+		FROM Propiedades
+		LEFT JOIN Estado_Propiedades ON Propiedades.id_propiedad = Estado_Propiedades.id_propiedad
+		WHERE ` + condicion
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching propiedades:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var propiedades []*propiedadMatch
+	for rows.Next() {
+		var p propiedadMatch
+		var transaccion, estado, ciudad, colonia, extras sql.NullString
+		err := rows.Scan(&p.IDPropiedad, &p.Titulo, &p.Precio, &p.Habitaciones, &transaccion, &estado, &ciudad, &colonia,
+			&p.NumBanos, &p.IDTipoPropiedad, &extras)
+		if err != nil {
+			log.Println("Error scanning propiedad:", err)
+			return nil, err
+		}
+		p.TipoTransaccion = transaccion.String
+		p.Estado = estado.String
+		p.Ciudad = ciudad.String
+		p.Colonia = colonia.String
+		p.Extras = parseStringSet(extras.String)
+		propiedades = append(propiedades, &p)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return propiedades, nil
+}
+
+// GET /prospectos/:id/matches?minimo=60&limite=20
+// Propiedades disponibles que cumplen los criterios del prospecto, de mayor a menor puntaje
+func (service *ProspectoService) GetMatches(id int, filtro *models.FiltroMatches) ([]*models.MatchPropiedad, error) {
+	minimo, limite, err := normalizarFiltroMatches(filtro)
+	if err != nil {
+		return nil, err
+	}
+	prospecto, err := service.GetProspecto(id)
+	if err != nil {
+		return nil, err
+	}
+	if prospecto == nil {
+		return nil, ErrResourceNotFound
+	}
+	matches := []*models.MatchPropiedad{}
+	criterios := prospecto.Criterios
+	if criteriosVacios(criterios) {
+		return matches, nil
+	}
+
+	// Los descartes seguros se hacen en la consulta, el resto se puntúa aquí
+	condicion := "Estado_Propiedades.estado = ?"
+	args := []interface{}{EstadoDisponible}
+	if criterios.TipoTransaccion != "" {
+		condicion += " AND Estado_Propiedades.tipo_transaccion = ?"
+		args = append(args, criterios.TipoTransaccion)
+	}
+	if criterios.PresupuestoMax != nil {
+		condicion += " AND Propiedades.precio <= ?"
+		args = append(args, *criterios.PresupuestoMax*(1+toleranciaPresupuesto))
+	}
+	propiedades, err := cargarPropiedadesMatch(service.DB, condicion, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, propiedad := range propiedades {
+		puntaje, ok := puntuar(criterios, propiedad)
+		if !ok || puntaje.Puntaje < minimo {
+			continue
+		}
+		matches = append(matches, &models.MatchPropiedad{Propiedad: propiedad.MenuPropiedades, Ciudad: propiedad.Ciudad,
+			Colonia: propiedad.Colonia, PuntajeMatch: puntaje})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Puntaje != matches[j].Puntaje {
+			return matches[i].Puntaje > matches[j].Puntaje
+		}
+		return matches[i].Propiedad.Precio < matches[j].Propiedad.Precio
+	})
+	if len(matches) > limite {
+		matches = matches[:limite]
+	}
+	return matches, nil
+}
+
+// GET /propiedades/:id/interesados?minimo=60&limite=20
+// Prospectos en etapas abiertas a los que les puede interesar la propiedad, de mayor a menor puntaje
+func (service *ProspectoService) GetInteresados(idPropiedad int, filtro *models.FiltroMatches) ([]*models.InteresadoPropiedad, error) {
+	minimo, limite, err := normalizarFiltroMatches(filtro)
+	if err != nil {
+		return nil, err
+	}
+	propiedades, err := cargarPropiedadesMatch(service.DB, "Propiedades.id_propiedad = ?", idPropiedad)
+	if err != nil {
+		return nil, err
+	}
+	if len(propiedades) == 0 {
+		return nil, ErrResourceNotFound
+	}
+
+	interesados, err := interesadosPropiedad(service.DB, propiedades[0], minimo)
+	if err != nil {
+		return nil, err
+	}
+	if len(interesados) > limite {
+		interesados = interesados[:limite]
+	}
+	return interesados, nil
+}
+
+// interesadosPropiedad puntúa la propiedad contra los prospectos de etapas abiertas que tienen criterios
+func interesadosPropiedad(db queryer, propiedad *propiedadMatch, minimo int) ([]*models.InteresadoPropiedad, error) {
+	query := "SELECT " + columnasProspecto + ` FROM Prospecto
+		WHERE etapa IN (SELECT clave FROM Etapas_Prospecto WHERE tipo = 'abierta')
+			AND (tipo_transaccion IS NULL OR tipo_transaccion = ?)
+			AND (presupuesto_max IS NULL OR presupuesto_max * ? >= ?)`
+	rows, err := db.Query(query, propiedad.TipoTransaccion, 1+toleranciaPresupuesto, propiedad.Precio)
+	if err != nil {
+		log.Println("Error fetching prospectos:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	interesados := []*models.InteresadoPropiedad{}
+	for rows.Next() {
+		prospecto, err := scanProspecto(rows)
+		if err != nil {
+			log.Println("Error scanning prospecto:", err)
+			return nil, err
+		}
+		puntaje, ok := puntuar(prospecto.Criterios, propiedad)
+		if !ok || puntaje.Puntaje < minimo {
+			continue
+		}
+		interesados = append(interesados, &models.InteresadoPropiedad{
+			IdCliente:    prospecto.IdCliente,
+			Nombre:       strings.TrimSpace(prospecto.Nombre + " " + prospecto.ApellidoP),
+			Telefono:     prospecto.Telefono,
+			Correo:       prospecto.Correo,
+			Usuario:      prospecto.Usuario,
+			Etapa:        prospecto.Etapa,
+			PuntajeMatch: puntaje,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+
+	sort.SliceStable(interesados, func(i, j int) bool {
+		if interesados[i].Puntaje != interesados[j].Puntaje {
+			return interesados[i].Puntaje > interesados[j].Puntaje
+		}
+		return interesados[i].IdCliente < interesados[j].IdCliente
+	})
+	return interesados, nil
+}
+
+// encolarMatches deja pendiente de avisar a su agente cada prospecto al que le interesa la propiedad.
+// Se llama en la misma transacción que crea la propiedad o le baja el precio; los prospectos sin agente no se avisan
+// y el UNIQUE evita avisar dos veces del mismo precio.
+func encolarMatches(tx *sql.Tx, idPropiedad int, motivo string, precioAnterior *float64) error {
+	propiedades, err := cargarPropiedadesMatch(tx, "Propiedades.id_propiedad = ? AND Estado_Propiedades.estado = ?", idPropiedad, EstadoDisponible)
+	if err != nil || len(propiedades) == 0 {
+		return err
+	}
+	propiedad := propiedades[0]
+	interesados, err := interesadosPropiedad(tx, propiedad, puntajeMinimoDefault)
+	if err != nil {
+		return err
+	}
+
+	ahora := time.Now().UTC()
+	query := `INSERT IGNORE INTO Notificaciones_Match (id_propiedad, id_cliente, usuario, motivo, precio, precio_anterior, puntaje, estado, intentos, creado_en)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 'pendiente', 0, ?)`
+	for _, interesado := range interesados {
+		if interesado.Usuario == "" {
+			continue
+		}
+		if _, err := tx.Exec(query, idPropiedad, interesado.IdCliente, interesado.Usuario, motivo, propiedad.Precio, precioAnterior,
+			interesado.Puntaje, ahora); err != nil {
+			log.Println("Error queueing notificacion:", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,477 @@
+package services
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Tipos de etapa del pipeline, las ganadas y perdidas cierran al prospecto
+const (
+	EtapaAbierta = "abierta"
+	EtapaGanada  = "ganada"
+	EtapaPerdida = "perdida"
+)
+
+// Tipos de actividad de la línea de tiempo, las citas salen de la tabla Citas
+const (
+	ActividadNota       = "nota"
+	ActividadLlamada    = "llamada"
+	ActividadCorreo     = "correo"
+	ActividadEtapa      = "etapa"
+	ActividadAsignacion = "asignacion"
+	ActividadFusion     = "fusion"
+	ActividadCita       = "cita"
+)
+
+const (
+	prospectosPorColumnaDefault = 50
+	prospectosPorColumnaMax     = 200
+)
+
+// ErrEtapaExists se regresa al crear una etapa con una clave que ya existe
+var ErrEtapaExists = errors.New("etapa already exists")
+
+var claveEtapaValida = regexp.MustCompile(`^[a-z0-9_-]{1,45}$`)
+
+// etapaActiva regresa el tipo de la etapa, ErrInvalidProspecto si no existe o esta inactiva
+func etapaActiva(db queryRower, clave string) (string, error) {
+	var tipo string
+	var activa bool
+	err := db.QueryRow("SELECT tipo, activa FROM Etapas_Prospecto WHERE clave = ?", clave).Scan(&tipo, &activa)
+	if err == sql.ErrNoRows || (err == nil && !activa) {
+		return "", fmt.Errorf("%w: la etapa %s no existe o está inactiva", ErrInvalidProspecto, clave)
+	}
+	if err != nil {
+		log.Println("Error fetching etapa:", err)
+		return "", err
+	}
+	return tipo, nil
+}
+
+// validarAgente revisa que el agente asignado exista
+func validarAgente(db queryRower, usuario string) error {
+	if usuario == "" {
+		return nil
+	}
+	var found int
+	err := db.QueryRow("SELECT 1 FROM Usuarios WHERE usuario = ?", usuario).Scan(&found)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: el agente %s no existe", ErrInvalidProspecto, usuario)
+	}
+	if err != nil {
+		log.Println("Error checking usuario:", err)
+		return err
+	}
+	return nil
+}
+
+// registrarActividad agrega un evento a la línea de tiempo del prospecto
+func registrarActividad(db database.Execer, idCliente int, tipo, titulo, descripcion, usuario string, fecha time.Time, idCita *int) error {
+	query := `INSERT INTO Actividades_Prospecto (id_cliente, tipo, titulo, descripcion, usuario, fecha, id_cita)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	if _, err := db.Exec(query, idCliente, tipo, truncate(titulo, 255), nullIfEmpty(descripcion), nullIfEmpty(usuario), fecha, idCita); err != nil {
+		log.Println("Error inserting actividad:", err)
+		return err
+	}
+	return nil
+}
+
+// GET /prospectos/etapas
+// GetEtapas regresa todas las etapas en el orden del tablero, también las inactivas
+func (service *ProspectoService) GetEtapas() ([]*models.EtapaProspecto, error) {
+	rows, err := service.DB.Query("SELECT clave, nombre, orden, tipo, activa FROM Etapas_Prospecto ORDER BY orden, clave")
+	if err != nil {
+		log.Println("Error fetching etapas:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var etapas []*models.EtapaProspecto
+	for rows.Next() {
+		var etapa models.EtapaProspecto
+		var activa bool
+		if err := rows.Scan(&etapa.Clave, &etapa.Nombre, &etapa.Orden, &etapa.Tipo, &activa); err != nil {
+			log.Println("Error scanning etapa:", err)
+			return nil, err
+		}
+		etapa.Activa = &activa
+		etapas = append(etapas, &etapa)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return etapas, nil
+}
+
+func validarEtapa(etapa *models.EtapaProspecto) error {
+	if !claveEtapaValida.MatchString(etapa.Clave) {
+		return fmt.Errorf("%w: la clave solo lleva minúsculas, números, - y _ (máximo 45)", ErrInvalidProspecto)
+	}
+	if etapa.Tipo != EtapaAbierta && etapa.Tipo != EtapaGanada && etapa.Tipo != EtapaPerdida {
+		return fmt.Errorf("%w: tipo debe ser abierta, ganada o perdida", ErrInvalidProspecto)
+	}
+	if strings.TrimSpace(etapa.Nombre) == "" || len(etapa.Nombre) > 100 {
+		return fmt.Errorf("%w: nombre es obligatorio, máximo 100 caracteres", ErrInvalidProspecto)
+	}
+	if etapa.Activa == nil {
+		activa := true
+		etapa.Activa = &activa
+	}
+	return nil
+}
+
+// POST /prospectos/etapas
+// CreateEtapa agrega una etapa al pipeline, ErrEtapaExists si la clave ya existe
+func (service *ProspectoService) CreateEtapa(etapa *models.EtapaProspecto) error {
+	if err := validarEtapa(etapa); err != nil {
+		return err
+	}
+	query := "INSERT IGNORE INTO Etapas_Prospecto (clave, nombre, orden, tipo, activa) VALUES (?, ?, ?, ?, ?)"
+	result, err := service.DB.Exec(query, etapa.Clave, etapa.Nombre, etapa.Orden, etapa.Tipo, *etapa.Activa)
+	if err != nil {
+		log.Println("Error inserting etapa:", err)
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrEtapaExists
+	}
+	return nil
+}
+
+// PUT /prospectos/etapas/:clave
+// UpdateEtapa cambia el nombre, orden, tipo o si está activa; los prospectos que ya están en la etapa se quedan
+func (service *ProspectoService) UpdateEtapa(clave string, etapa *models.EtapaProspecto) error {
+	etapa.Clave = clave
+	if err := validarEtapa(etapa); err != nil {
+		return err
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRow("SELECT 1 FROM Etapas_Prospecto WHERE clave = ? FOR UPDATE", clave).Scan(&found)
+	if err == sql.ErrNoRows {
+		return ErrResourceNotFound
+	}
+	if err != nil {
+		log.Println("Error fetching etapa:", err)
+		return err
+	}
+	query := "UPDATE Etapas_Prospecto SET nombre = ?, orden = ?, tipo = ?, activa = ? WHERE clave = ?"
+	if _, err := tx.Exec(query, etapa.Nombre, etapa.Orden, etapa.Tipo, *etapa.Activa, clave); err != nil {
+		log.Println("Error updating etapa:", err)
+		return err
+	}
+	// Sin una etapa abierta activa no se podrían crear prospectos
+	var abiertas int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM Etapas_Prospecto WHERE tipo = 'abierta' AND activa = 1").Scan(&abiertas); err != nil {
+		log.Println("Error counting etapas:", err)
+		return err
+	}
+	if abiertas == 0 {
+		return fmt.Errorf("%w: debe quedar al menos una etapa abierta activa", ErrInvalidProspecto)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error updating etapa:", err)
+		return err
+	}
+	return nil
+}
+
+// PUT /prospectos/:id/etapa
+// CambiarEtapa mueve al prospecto a otra etapa activa y lo registra en la línea de tiempo
+func (service *ProspectoService) CambiarEtapa(id int, cambio *models.CambioEtapaProspecto, usuario string) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var anterior string
+	err = tx.QueryRow("SELECT etapa FROM Prospecto WHERE id_cliente = ? FOR UPDATE", id).Scan(&anterior)
+	if err == sql.ErrNoRows {
+		return ErrResourceNotFound
+	}
+	if err != nil {
+		log.Println("Error fetching prospecto:", err)
+		return err
+	}
+	if anterior == cambio.Etapa {
+		return nil
+	}
+	if _, err := etapaActiva(tx, cambio.Etapa); err != nil {
+		return err
+	}
+
+	ahora := time.Now().UTC()
+	if _, err := tx.Exec("UPDATE Prospecto SET etapa = ?, etapa_desde = ? WHERE id_cliente = ?", cambio.Etapa, ahora, id); err != nil {
+		log.Println("Error updating etapa:", err)
+		return err
+	}
+	titulo := fmt.Sprintf("Cambió de %s a %s", anterior, cambio.Etapa)
+	if err := registrarActividad(tx, id, ActividadEtapa, titulo, cambio.Comentario, usuario, ahora, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error updating etapa:", err)
+		return err
+	}
+	return nil
+}
+
+// POST /prospectos/:id/actividades
+// RegistrarActividad agrega una nota, llamada o correo a la línea de tiempo
+func (service *ProspectoService) RegistrarActividad(id int, actividad *models.NuevaActividad, usuario string) (*models.ActividadProspecto, error) {
+	if actividad.Tipo != ActividadNota && actividad.Tipo != ActividadLlamada && actividad.Tipo != ActividadCorreo {
+		return nil, fmt.Errorf("%w: tipo debe ser nota, llamada o correo", ErrInvalidProspecto)
+	}
+	fecha := time.Now().UTC()
+	if actividad.Fecha != nil {
+		if actividad.Fecha.After(fecha) {
+			return nil, fmt.Errorf("%w: la fecha no puede ser futura, para eso se agenda una cita", ErrInvalidProspecto)
+		}
+		fecha = actividad.Fecha.UTC()
+	}
+	titulo := strings.TrimSpace(actividad.Titulo)
+	if titulo == "" {
+		titulo = strings.ToUpper(actividad.Tipo[:1]) + actividad.Tipo[1:]
+	}
+
+	var found int
+	err := service.DB.QueryRow("SELECT 1 FROM Prospecto WHERE id_cliente = ?", id).Scan(&found)
+	if err == sql.ErrNoRows {
+		return nil, ErrResourceNotFound
+	}
+	if err != nil {
+		log.Println("Error checking prospecto:", err)
+		return nil, err
+	}
+
+	query := `INSERT INTO Actividades_Prospecto (id_cliente, tipo, titulo, descripcion, usuario, fecha)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := service.DB.Exec(query, id, actividad.Tipo, truncate(titulo, 255), actividad.Descripcion, nullIfEmpty(usuario), fecha)
+	if err != nil {
+		log.Println("Error inserting actividad:", err)
+		return nil, err
+	}
+	idActividad, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	nueva := int(idActividad)
+	return &models.ActividadProspecto{
+		IDActividad: &nueva,
+		Tipo:        actividad.Tipo,
+		Fecha:       fecha,
+		Titulo:      titulo,
+		Descripcion: actividad.Descripcion,
+		Usuario:     usuario,
+	}, nil
+}
+
+// GET /prospectos/:id/actividades
+// GetActividades regresa la línea de tiempo del prospecto de lo mas reciente a lo mas antiguo: las actividades
+// registradas, sus citas con el resultado y los recordatorios que se le mandaron. Solo se pagina con limit y offset.
+func (service *ProspectoService) GetActividades(id int, page *models.PageRequest) (*models.Page[*models.ActividadProspecto], error) {
+	if page.Cursor != "" {
+		return nil, fmt.Errorf("%w: la línea de tiempo se pagina con limit y offset", ErrInvalidPage)
+	}
+	if _, err := normalizePage(page); err != nil {
+		return nil, err
+	}
+	var found int
+	err := service.DB.QueryRow("SELECT 1 FROM Prospecto WHERE id_cliente = ?", id).Scan(&found)
+	if err == sql.ErrNoRows {
+		return nil, ErrResourceNotFound
+	}
+	if err != nil {
+		log.Println("Error checking prospecto:", err)
+		return nil, err
+	}
+
+	union := `
+		SELECT id_actividad, tipo, fecha, titulo, descripcion, usuario, id_cita
+		FROM Actividades_Prospecto WHERE id_cliente = ?
+		UNION ALL
+		SELECT NULL, 'cita', inicio, titulo_cita,
+			CONCAT_WS(': ', resultado, COALESCE(notas_resultado, descripcion_cita)), usuario, id_citas
+		FROM Citas WHERE id_cliente = ?
+		UNION ALL
+		SELECT NULL, 'correo', Recordatorios_Cita.enviado_en, CONCAT('Recordatorio ', Recordatorios_Cita.tipo, ': ', Citas.titulo_cita),
+			Recordatorios_Cita.correo, NULL, Recordatorios_Cita.id_cita
+		FROM Recordatorios_Cita
+		INNER JOIN Citas ON Citas.id_citas = Recordatorios_Cita.id_cita
+		WHERE Citas.id_cliente = ? AND Recordatorios_Cita.destinatario = 'prospecto' AND Recordatorios_Cita.estado = 'enviado'`
+	args := []interface{}{id, id, id}
+
+	total, err := countRows(service.DB, "SELECT COUNT(*) FROM ("+union+") AS linea", args...)
+	if err != nil {
+		return nil, err
+	}
+	limit, limitArgs := limitClause(page)
+	rows, err := service.DB.Query("SELECT * FROM ("+union+") AS linea ORDER BY fecha DESC"+limit, append(args, limitArgs...)...)
+	if err != nil {
+		log.Println("Error fetching actividades:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actividades []*models.ActividadProspecto
+	for rows.Next() {
+		var actividad models.ActividadProspecto
+		var idActividad, idCita sql.NullInt64
+		var titulo, descripcion, usuario sql.NullString
+		if err := rows.Scan(&idActividad, &actividad.Tipo, &actividad.Fecha, &titulo, &descripcion, &usuario, &idCita); err != nil {
+			log.Println("Error scanning actividad:", err)
+			return nil, err
+		}
+		if idActividad.Valid {
+			n := int(idActividad.Int64)
+			actividad.IDActividad = &n
+		}
+		if idCita.Valid {
+			n := int(idCita.Int64)
+			actividad.IDCita = &n
+		}
+		actividad.Titulo = titulo.String
+		actividad.Descripcion = descripcion.String
+		actividad.Usuario = usuario.String
+		actividades = append(actividades, &actividad)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	// La línea de tiempo mezcla tres tablas, no tiene cursor
+	resultado := buildPage(actividades, total, page, pageOrder{}, func(actividad *models.ActividadProspecto) (int, interface{}) {
+		return 0, nil
+	})
+	resultado.NextCursor = ""
+	return resultado, nil
+}
+
+// GET /prospectos/pipeline
+// GetPipeline regresa el tablero: una columna por etapa activa (y por las inactivas que todavía tienen prospectos)
+// con el total y los prospectos que llevan menos tiempo en ella
+func (service *ProspectoService) GetPipeline(filtro *models.FiltroPipeline) ([]*models.ColumnaPipeline, error) {
+	if filtro.Limite <= 0 {
+		filtro.Limite = prospectosPorColumnaDefault
+	}
+	if filtro.Limite > prospectosPorColumnaMax {
+		filtro.Limite = prospectosPorColumnaMax
+	}
+	var conditions []string
+	var args []interface{}
+	if filtro.Usuario != "" {
+		conditions = append(conditions, "Prospecto.usuario = ?")
+		args = append(args, filtro.Usuario)
+	}
+	if filtro.Origen != "" {
+		if err := validarOrigen(filtro.Origen); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, "Prospecto.origen = ?")
+		args = append(args, filtro.Origen)
+	}
+
+	etapas, err := service.GetEtapas()
+	if err != nil {
+		return nil, err
+	}
+	totales := map[string]int{}
+	rows, err := service.DB.Query("SELECT etapa, COUNT(*) FROM Prospecto"+whereClause(conditions)+" GROUP BY etapa", args...)
+	if err != nil {
+		log.Println("Error counting pipeline:", err)
+		return nil, err
+	}
+	for rows.Next() {
+		var etapa string
+		var total int
+		if err := rows.Scan(&etapa, &total); err != nil {
+			rows.Close()
+			log.Println("Error scanning pipeline:", err)
+			return nil, err
+		}
+		totales[etapa] = total
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+
+	var columnas []*models.ColumnaPipeline
+	porEtapa := map[string]*models.ColumnaPipeline{}
+	for _, etapa := range etapas {
+		if !*etapa.Activa && totales[etapa.Clave] == 0 {
+			continue
+		}
+		columna := &models.ColumnaPipeline{Etapa: *etapa, Total: totales[etapa.Clave], Prospectos: []*models.ProspectoPipeline{}}
+		columnas = append(columnas, columna)
+		porEtapa[etapa.Clave] = columna
+	}
+
+	query := `SELECT id_cliente, nombre_prospecto, apellido_paterno_prospecto, telefono_prospecto, correo_prospecto, usuario, origen,
+			presupuesto_max, etapa, etapa_desde, proxima_cita
+		FROM (
+			SELECT Prospecto.*, ROW_NUMBER() OVER (PARTITION BY Prospecto.etapa ORDER BY Prospecto.etapa_desde DESC, Prospecto.id_cliente DESC) AS posicion,
+				(SELECT MIN(Citas.inicio) FROM Citas WHERE Citas.id_cliente = Prospecto.id_cliente AND Citas.inicio > ?) AS proxima_cita
+			FROM Prospecto` + whereClause(conditions) + `
+		) AS tablero
+		WHERE posicion <= ?
+		ORDER BY etapa, posicion`
+	rows, err = service.DB.Query(query, append(append([]interface{}{time.Now().UTC()}, args...), filtro.Limite)...)
+	if err != nil {
+		log.Println("Error fetching pipeline:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tarjeta models.ProspectoPipeline
+		var nombre, apellido, telefono, correo, usuario, origen sql.NullString
+		var presupuesto sql.NullFloat64
+		var proxima sql.NullTime
+		var etapa string
+		err := rows.Scan(&tarjeta.IdCliente, &nombre, &apellido, &telefono, &correo, &usuario, &origen, &presupuesto, &etapa,
+			&tarjeta.EtapaDesde, &proxima)
+		if err != nil {
+			log.Println("Error scanning pipeline:", err)
+			return nil, err
+		}
+		tarjeta.Nombre = strings.TrimSpace(nombre.String + " " + apellido.String)
+		tarjeta.Telefono = telefono.String
+		tarjeta.Correo = correo.String
+		tarjeta.Usuario = usuario.String
+		tarjeta.Origen = origen.String
+		if presupuesto.Valid {
+			tarjeta.PresupuestoMax = &presupuesto.Float64
+		}
+		if proxima.Valid {
+			tarjeta.ProximaCita = &proxima.Time
+		}
+		if columna := porEtapa[etapa]; columna != nil {
+			columna.Prospectos = append(columna.Prospectos, &tarjeta)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return nil, err
+	}
+	return columnas, nil
+}
@@ -4,9 +4,27 @@ import (
 	"backend/internal/database"
 	"backend/internal/models"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"slices"
+	"strings"
+	"time"
 )
 
+// Origen de un prospecto
+const (
+	OrigenPortal        = "portal"
+	OrigenReferido      = "referido"
+	OrigenVisitaDirecta = "visita_directa"
+	OrigenOtro          = "otro"
+)
+
+var origenesProspecto = []string{OrigenPortal, OrigenReferido, OrigenVisitaDirecta, OrigenOtro}
+
+// ErrInvalidProspecto se regresa cuando la etapa, el origen o los criterios no son validos
+var ErrInvalidProspecto = errors.New("invalid prospecto")
+
 type ProspectoService struct {
 	DB *sql.DB
 }
@@ -18,11 +36,71 @@ func NewProspectoService(db *sql.DB) *ProspectoService {
 	}
 }
 
-func (service *ProspectoService) GetProspecto(id int) (*models.Prospecto, error) {
+// columnasProspecto son las columnas que lee scanProspecto
+const columnasProspecto = `id_cliente, nombre_prospecto, apellido_paterno_prospecto, apellido_materno_prospecto, telefono_prospecto, correo_prospecto,
+	etapa, usuario, origen, fecha_alta, etapa_desde, tipo_transaccion, id_tipo_propiedad, ciudad, colonia,
+	presupuesto_min, presupuesto_max, num_recamaras_min, num_banos_min, extras`
+
+// fila la cumplen *sql.Row y *sql.Rows
+type fila interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProspecto(row fila) (*models.Prospecto, error) {
 	var prospecto models.Prospecto
-	query := "SELECT * FROM Prospecto WHERE id_cliente = ?"
-	row := service.DB.QueryRow(query, id)
-	err := row.Scan(&prospecto.IdCliente, &prospecto.Nombre, &prospecto.ApellidoP, &prospecto.ApellidoM, &prospecto.Telefono, &prospecto.Correo)
+	var nombre, apellidoP, apellidoM, telefono, correo, usuario, origen, transaccion, ciudad, colonia, extras sql.NullString
+	var fechaAlta, etapaDesde sql.NullTime
+	var tipoPropiedad, recamaras, banos sql.NullInt64
+	var presupuestoMin, presupuestoMax sql.NullFloat64
+	err := row.Scan(&prospecto.IdCliente, &nombre, &apellidoP, &apellidoM, &telefono, &correo,
+		&prospecto.Etapa, &usuario, &origen, &fechaAlta, &etapaDesde, &transaccion, &tipoPropiedad, &ciudad, &colonia,
+		&presupuestoMin, &presupuestoMax, &recamaras, &banos, &extras)
+	if err != nil {
+		return nil, err
+	}
+	prospecto.Nombre = nombre.String
+	prospecto.ApellidoP = apellidoP.String
+	prospecto.ApellidoM = apellidoM.String
+	prospecto.Telefono = telefono.String
+	prospecto.Correo = correo.String
+	prospecto.Usuario = usuario.String
+	prospecto.Origen = origen.String
+	if fechaAlta.Valid {
+		prospecto.FechaAlta = &fechaAlta.Time
+	}
+	if etapaDesde.Valid {
+		prospecto.EtapaDesde = &etapaDesde.Time
+	}
+
+	criterios := models.CriteriosBusqueda{TipoTransaccion: transaccion.String, Ciudad: ciudad.String, Colonia: colonia.String,
+		Extras: parseStringSet(extras.String)}
+	if tipoPropiedad.Valid {
+		id := int(tipoPropiedad.Int64)
+		criterios.IDTipoPropiedad = &id
+	}
+	if presupuestoMin.Valid {
+		criterios.PresupuestoMin = &presupuestoMin.Float64
+	}
+	if presupuestoMax.Valid {
+		criterios.PresupuestoMax = &presupuestoMax.Float64
+	}
+	if recamaras.Valid {
+		n := int(recamaras.Int64)
+		criterios.RecamarasMin = &n
+	}
+	if banos.Valid {
+		n := int(banos.Int64)
+		criterios.BanosMin = &n
+	}
+	if !criteriosVacios(&criterios) {
+		prospecto.Criterios = &criterios
+	}
+	return &prospecto, nil
+}
+
+func (service *ProspectoService) GetProspecto(id int) (*models.Prospecto, error) {
+	query := "SELECT " + columnasProspecto + " FROM Prospecto WHERE id_cliente = ?"
+	prospecto, err := scanProspecto(service.DB.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Println("No rows found")
@@ -31,63 +109,203 @@ func (service *ProspectoService) GetProspecto(id int) (*models.Prospecto, error)
 		log.Println("Error fetching prospecto:", err)
 		return nil, err
 	}
-	return &prospecto, nil
+	return prospecto, nil
 }
 
+// validarCriterios revisa el presupuesto y los filtros que luego se usan para buscar propiedades
+func validarCriterios(db queryRower, criterios *models.CriteriosBusqueda) error {
+	if criterios == nil {
+		return nil
+	}
+	if criterios.TipoTransaccion != "" && criterios.TipoTransaccion != TransaccionVenta && criterios.TipoTransaccion != TransaccionRenta {
+		return fmt.Errorf("%w: tipo_transaccion debe ser venta o renta", ErrInvalidProspecto)
+	}
+	if (criterios.PresupuestoMin != nil && *criterios.PresupuestoMin < 0) || (criterios.PresupuestoMax != nil && *criterios.PresupuestoMax < 0) {
+		return fmt.Errorf("%w: el presupuesto no puede ser negativo", ErrInvalidProspecto)
+	}
+	if criterios.PresupuestoMin != nil && criterios.PresupuestoMax != nil && *criterios.PresupuestoMin > *criterios.PresupuestoMax {
+		return fmt.Errorf("%w: presupuesto_min es mayor que presupuesto_max", ErrInvalidProspecto)
+	}
+	if (criterios.RecamarasMin != nil && *criterios.RecamarasMin < 0) || (criterios.BanosMin != nil && *criterios.BanosMin < 0) {
+		return fmt.Errorf("%w: recamaras y baños no pueden ser negativos", ErrInvalidProspecto)
+	}
+	for _, extra := range criterios.Extras {
+		if !slices.Contains(propiedadSetValues["extras"], extra) {
+			return fmt.Errorf("%w: %q no es un extra valido", ErrInvalidProspecto, extra)
+		}
+	}
+	if criterios.IDTipoPropiedad != nil {
+		var found int
+		err := db.QueryRow("SELECT 1 FROM Tipo_Propiedad WHERE id_tipo_propiedad = ?", *criterios.IDTipoPropiedad).Scan(&found)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: el tipo de propiedad %d no existe", ErrInvalidProspecto, *criterios.IDTipoPropiedad)
+		}
+		if err != nil {
+			log.Println("Error checking tipo propiedad:", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// valoresCriterios regresa las columnas de los criterios: tipo_transaccion, id_tipo_propiedad, ciudad, colonia,
+// presupuesto_min, presupuesto_max, num_recamaras_min, num_banos_min y extras
+func valoresCriterios(criterios *models.CriteriosBusqueda) []interface{} {
+	if criterios == nil {
+		criterios = &models.CriteriosBusqueda{}
+	}
+	return []interface{}{nullIfEmpty(criterios.TipoTransaccion), criterios.IDTipoPropiedad, nullIfEmpty(criterios.Ciudad),
+		nullIfEmpty(criterios.Colonia), criterios.PresupuestoMin, criterios.PresupuestoMax, criterios.RecamarasMin, criterios.BanosMin,
+		nullIfEmpty(strings.Join(criterios.Extras, ","))}
+}
+
+// criteriosVacios indica si el prospecto no tiene ningún criterio con el que buscarle propiedades
+func criteriosVacios(criterios *models.CriteriosBusqueda) bool {
+	return criterios == nil || (criterios.TipoTransaccion == "" && criterios.IDTipoPropiedad == nil && criterios.Ciudad == "" &&
+		criterios.Colonia == "" && criterios.PresupuestoMin == nil && criterios.PresupuestoMax == nil &&
+		criterios.RecamarasMin == nil && criterios.BanosMin == nil && len(criterios.Extras) == 0)
+}
+
+func validarOrigen(origen string) error {
+	for _, o := range origenesProspecto {
+		if o == origen {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: origen debe ser portal, referido, visita_directa u otro", ErrInvalidProspecto)
+}
+
+// InsertProspecto crea el prospecto en la etapa indicada o en la primera etapa abierta,
+// el teléfono se guarda en E.164 y el correo en minúsculas
 func (service *ProspectoService) InsertProspecto(prospecto *models.Prospecto) (int, error) {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Prospecto", "id_cliente")
-	if err != nil {
-		log.Println("Error getting last Id:", err)
+	if err := normalizarContacto(&prospecto.Telefono, &prospecto.Correo); err != nil {
+		return 0, err
+	}
+	if prospecto.Origen == "" {
+		prospecto.Origen = OrigenOtro
+	}
+	if err := validarOrigen(prospecto.Origen); err != nil {
 		return 0, err
 	}
-	prospecto.IdCliente = lastId + 1
 
-	query := "INSERT INTO Prospecto(id_cliente, nombre_prospecto, apellido_paterno_prospecto, apellido_materno_prospecto, telefono_prospecto, correo_prospecto) VALUES(?,?,?,?,?,?)"
-	result, err := service.DB.Exec(query, prospecto.IdCliente, prospecto.Nombre, prospecto.ApellidoP, prospecto.ApellidoM, prospecto.Telefono, prospecto.Correo)
+	tx, err := service.DB.Begin()
 	if err != nil {
-		log.Println("Error inserting prospecto:", err)
+		log.Println("Error starting transaction:", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := validarCriterios(tx, prospecto.Criterios); err != nil {
+		return 0, err
+	}
+	if err := validarAgente(tx, prospecto.Usuario); err != nil {
 		return 0, err
 	}
-	rows, err := result.RowsAffected()
+	if prospecto.Etapa == "" {
+		err := tx.QueryRow("SELECT clave FROM Etapas_Prospecto WHERE activa = 1 AND tipo = 'abierta' ORDER BY orden, clave LIMIT 1").Scan(&prospecto.Etapa)
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("%w: no hay etapas abiertas activas", ErrInvalidProspecto)
+		}
+		if err != nil {
+			log.Println("Error fetching etapa inicial:", err)
+			return 0, err
+		}
+	} else if _, err := etapaActiva(tx, prospecto.Etapa); err != nil {
+		return 0, err
+	}
+
+	ahora := time.Now().UTC()
+	args := []interface{}{prospecto.Nombre, prospecto.ApellidoP, prospecto.ApellidoM, prospecto.Telefono, prospecto.Correo,
+		prospecto.Etapa, nullIfEmpty(prospecto.Usuario), prospecto.Origen, ahora, ahora}
+	args = append(args, valoresCriterios(prospecto.Criterios)...)
+	query := `INSERT INTO Prospecto(nombre_prospecto, apellido_paterno_prospecto, apellido_materno_prospecto, telefono_prospecto, correo_prospecto,
+		etapa, usuario, origen, fecha_alta, etapa_desde, tipo_transaccion, id_tipo_propiedad, ciudad, colonia,
+		presupuesto_min, presupuesto_max, num_recamaras_min, num_banos_min, extras) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+	id, err := database.Insert(tx, query, args...)
 	if err != nil {
-		log.Println("Error getting rows affected:", err)
+		log.Println("Error inserting prospecto:", err)
 		return 0, err
 	}
-	if rows != 1 {
-		log.Println("Error inserting prospecto, no rows affected")
+	if err := tx.Commit(); err != nil {
+		log.Println("Error inserting prospecto:", err)
 		return 0, err
 	}
+	prospecto.IdCliente = id
+	prospecto.FechaAlta, prospecto.EtapaDesde = &ahora, &ahora
 	return prospecto.IdCliente, nil
 }
 
-func (service *ProspectoService) UpdateProspecto(prospecto *models.Prospecto, id int) error {
-	utils := database.NewDbUtilities(service.DB)
-	lastId, err := utils.GetLastId("Prospecto", "id_cliente")
-	if err != nil {
-		log.Println("Error getting last ID:", err)
+// UpdateProspecto actualiza los datos de contacto. El agente, el origen y los criterios solo cambian si se mandan
+// y la etapa no cambia aquí; si cambia el agente queda en la línea de tiempo.
+func (service *ProspectoService) UpdateProspecto(prospecto *models.Prospecto, id int, autor string) error {
+	if err := normalizarContacto(&prospecto.Telefono, &prospecto.Correo); err != nil {
 		return err
 	}
-	println(lastId)
-	if id <= 0 || id > lastId {
-		log.Println("Invalid prospecto ID:", id)
+	if prospecto.Origen != "" {
+		if err := validarOrigen(prospecto.Origen); err != nil {
+			return err
+		}
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
 		return err
 	}
-	println(id)
-	query := "UPDATE Prospecto SET nombre_prospecto=?, apellido_paterno_prospecto=?, apellido_materno_prospecto=?, telefono_prospecto=?, correo_prospecto=? WHERE id_cliente=?"
-	result, err := service.DB.Exec(query, prospecto.Nombre, prospecto.ApellidoP, prospecto.ApellidoM, prospecto.Telefono, prospecto.Correo, id)
+	defer tx.Rollback()
+
+	var anterior sql.NullString
+	err = tx.QueryRow("SELECT usuario FROM Prospecto WHERE id_cliente = ? FOR UPDATE", id).Scan(&anterior)
+	if err == sql.ErrNoRows {
+		return ErrResourceNotFound
+	}
 	if err != nil {
 		log.Println("Error updating prospecto:", err)
 		return err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		log.Println("Error getting rows affected:", err)
+	if err := validarCriterios(tx, prospecto.Criterios); err != nil {
+		return err
+	}
+	if err := validarAgente(tx, prospecto.Usuario); err != nil {
+		return err
+	}
+
+	query := "UPDATE Prospecto SET nombre_prospecto=?, apellido_paterno_prospecto=?, apellido_materno_prospecto=?, telefono_prospecto=?, correo_prospecto=? WHERE id_cliente=?"
+	if _, err := tx.Exec(query, prospecto.Nombre, prospecto.ApellidoP, prospecto.ApellidoM, prospecto.Telefono, prospecto.Correo, id); err != nil {
+		log.Println("Error updating prospecto:", err)
 		return err
 	}
-	if rows != 1 {
-		log.Println("Error updating prospecto: no rows affected")
+	if prospecto.Origen != "" {
+		if _, err := tx.Exec("UPDATE Prospecto SET origen=? WHERE id_cliente=?", prospecto.Origen, id); err != nil {
+			log.Println("Error updating prospecto:", err)
+			return err
+		}
+	}
+	if prospecto.Criterios != nil {
+		query := `UPDATE Prospecto SET tipo_transaccion=?, id_tipo_propiedad=?, ciudad=?, colonia=?,
+			presupuesto_min=?, presupuesto_max=?, num_recamaras_min=?, num_banos_min=?, extras=? WHERE id_cliente=?`
+		if _, err := tx.Exec(query, append(valoresCriterios(prospecto.Criterios), id)...); err != nil {
+			log.Println("Error updating prospecto:", err)
+			return err
+		}
+	}
+	if prospecto.Usuario != "" && prospecto.Usuario != anterior.String {
+		if _, err := tx.Exec("UPDATE Prospecto SET usuario=? WHERE id_cliente=?", prospecto.Usuario, id); err != nil {
+			log.Println("Error updating prospecto:", err)
+			return err
+		}
+		titulo := "Asignado a " + prospecto.Usuario
+		if anterior.Valid {
+			titulo = fmt.Sprintf("Reasignado de %s a %s", anterior.String, prospecto.Usuario)
+		}
+		if err := registrarActividad(tx, id, ActividadAsignacion, titulo, "", autor, time.Now().UTC(), nil); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error updating prospecto:", err)
 		return err
 	}
+	prospecto.IdCliente = id
 	return nil
 }
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"backend/internal/scheduler"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+)
+
+// Recordatorios que se mandan antes de cada cita
+const (
+	Recordatorio24h = "24h"
+	Recordatorio1h  = "1h"
+)
+
+const (
+	DestinatarioAgente    = "agente"
+	DestinatarioProspecto = "prospecto"
+)
+
+const (
+	recordatoriosPorRevision = 100
+	intentosRecordatorio     = 5
+	// Un correo que lleva mas de este tiempo en 'enviando' se quedo a medias (se reinicio el servidor) y se vuelve a mandar
+	envioExpirado = 10 * time.Minute
+)
+
+// bandejaCorreos arma la bandeja de una tabla de correos de las tareas programadas, sin SMTP no cuenta como intento
+func bandejaCorreos(db *sql.DB, tabla, columnaID, columnaCorreo string, intentos int) *scheduler.Bandeja {
+	return &scheduler.Bandeja{
+		DB:            db,
+		Tabla:         tabla,
+		ColumnaID:     columnaID,
+		ColumnaCorreo: columnaCorreo,
+		Intentos:      intentos,
+		Expira:        envioExpirado,
+		SinIntento:    func(err error) bool { return errors.Is(err, ErrEmailNotConfigured) },
+	}
+}
+
+// anticipacionRecordatorios va de mayor a menor, el de 24h solo se programa si todavía falta mas de 1h para la cita
+var anticipacionRecordatorios = []struct {
+	Tipo  string
+	Antes time.Duration
+	// Minimo es lo que debe faltar para la cita para que todavía se mande
+	Minimo time.Duration
+}{
+	{Tipo: Recordatorio24h, Antes: 24 * time.Hour, Minimo: time.Hour},
+	{Tipo: Recordatorio1h, Antes: time.Hour, Minimo: 0},
+}
+
+// RecordatoriosService manda los recordatorios de citas al agente y al prospecto. Cada recordatorio queda en
+// Recordatorios_Cita antes de mandarse, asi un reinicio no los pierde y el UNIQUE evita programarlos dos veces.
+type RecordatoriosService struct {
+	DB          *sql.DB
+	Email       *EmailService
+	ZonaDefault *time.Location
+}
+
+// Constructor para RecordatoriosService
+func NewRecordatoriosService(db *sql.DB, email *EmailService, zonaDefault *time.Location) *RecordatoriosService {
+	if zonaDefault == nil {
+		zonaDefault = time.UTC
+	}
+	return &RecordatoriosService{
+		DB:          db,
+		Email:       email,
+		ZonaDefault: zonaDefault,
+	}
+}
+
+// Ejecutar programa los recordatorios que ya tocan, cancela los de citas que se movieron o borraron y manda los pendientes.
+// Lo llama el scheduler cada minuto.
+func (service *RecordatoriosService) Ejecutar() error {
+	ahora := time.Now().UTC()
+	if err := service.programar(ahora); err != nil {
+		return err
+	}
+	if err := service.cancelarObsoletos(ahora); err != nil {
+		return err
+	}
+	return service.enviarPendientes(ahora)
+}
+
+// programar crea los recordatorios cuya hora ya llegó. Si el servidor estuvo apagado cuando tocaba el de 24h
+// se manda al arrancar, siempre que falte mas de una hora para la cita. Las series se programan aparte por ocurrencia.
+func (service *RecordatoriosService) programar(ahora time.Time) error {
+	for _, r := range anticipacionRecordatorios {
+		desde := ahora.Add(r.Minimo)
+		hasta := ahora.Add(r.Antes)
+		minutos := int(r.Antes / time.Minute)
+		query := `INSERT IGNORE INTO Recordatorios_Cita (id_cita, tipo, destinatario, correo, inicio_cita, programado_para, estado, intentos)
+			SELECT Citas.id_citas, ?, 'agente', Citas.usuario, Citas.inicio, Citas.inicio - INTERVAL ? MINUTE, 'pendiente', 0
+			FROM Citas
+			WHERE Citas.frecuencia IS NULL AND Citas.inicio > ? AND Citas.inicio <= ?
+			UNION ALL
+			SELECT Citas.id_citas, ?, 'prospecto', Prospecto.correo_prospecto, Citas.inicio, Citas.inicio - INTERVAL ? MINUTE, 'pendiente', 0
+			FROM Citas
+			INNER JOIN Prospecto ON Prospecto.id_cliente = Citas.id_cliente
+			WHERE Citas.frecuencia IS NULL AND Citas.inicio > ? AND Citas.inicio <= ? AND COALESCE(Prospecto.correo_prospecto, '') <> ''`
+		if _, err := service.DB.Exec(query, r.Tipo, minutos, desde, hasta, r.Tipo, minutos, desde, hasta); err != nil {
+			log.Println("Error scheduling recordatorios:", err)
+			return err
+		}
+	}
+	return service.programarSeries(ahora)
+}
+
+// ocurrenciaPorRecordar es un recordatorio que ya toca para una ocurrencia de una serie
+type ocurrenciaPorRecordar struct {
+	Tipo   string
+	Antes  time.Duration
+	Inicio time.Time
+}
+
+// porRecordar regresa los recordatorios que ya tocan para las ocurrencias de la serie, con las mismas ventanas que las
+// citas normales. Las exceptuadas no llevan y las editadas aparte tampoco, esas tienen los suyos como cita normal.
+func (s *serie) porRecordar(ahora time.Time, editadas map[int64]bool) []ocurrenciaPorRecordar {
+	var resultado []ocurrenciaPorRecordar
+	for _, r := range anticipacionRecordatorios {
+		desde := ahora.Add(r.Minimo)
+		hasta := ahora.Add(r.Antes)
+		for _, ocurrencia := range s.ocurrencias(desde, hasta.Add(time.Minute)) {
+			if !ocurrencia.Inicio.After(desde) || ocurrencia.Inicio.After(hasta) || editadas[ocurrencia.Inicio.Unix()] {
+				continue
+			}
+			resultado = append(resultado, ocurrenciaPorRecordar{Tipo: r.Tipo, Antes: r.Antes, Inicio: ocurrencia.Inicio})
+		}
+	}
+	return resultado
+}
+
+// programarSeries crea un recordatorio por cada ocurrencia de las series que ya toca, con el inicio de la ocurrencia
+func (service *RecordatoriosService) programarSeries(ahora time.Time) error {
+	series, err := cargarSeries(service.DB, service.ZonaDefault, "Citas.inicio <= ? AND Citas.fin_serie > ?",
+		ahora.Add(anticipacionRecordatorios[0].Antes), ahora)
+	if err != nil || len(series) == 0 {
+		return err
+	}
+
+	query := `INSERT IGNORE INTO Recordatorios_Cita (id_cita, tipo, destinatario, correo, inicio_cita, programado_para, estado, intentos)
+		SELECT Citas.id_citas, ?, 'agente', Citas.usuario, ?, ?, 'pendiente', 0
+		FROM Citas
+		WHERE Citas.id_citas = ?
+		UNION ALL
+		SELECT Citas.id_citas, ?, 'prospecto', Prospecto.correo_prospecto, ?, ?, 'pendiente', 0
+		FROM Citas
+		INNER JOIN Prospecto ON Prospecto.id_cliente = Citas.id_cliente
+		WHERE Citas.id_citas = ? AND COALESCE(Prospecto.correo_prospecto, '') <> ''`
+	for _, s := range series {
+		if len(s.porRecordar(ahora, nil)) == 0 {
+			continue
+		}
+		fechas, err := ocurrenciasEditadas(service.DB, s.IDCita)
+		if err != nil {
+			return err
+		}
+		editadas := map[int64]bool{}
+		for _, fecha := range fechas {
+			editadas[fecha.Unix()] = true
+		}
+		for _, o := range s.porRecordar(ahora, editadas) {
+			programado := o.Inicio.Add(-o.Antes)
+			if _, err := service.DB.Exec(query, o.Tipo, o.Inicio, programado, s.IDCita, o.Tipo, o.Inicio, programado, s.IDCita); err != nil {
+				log.Println("Error scheduling recordatorios:", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cancelarObsoletos cancela los pendientes de citas borradas, movidas o que ya empezaron,
+// y regresa a pendiente los que se quedaron en 'enviando' por un reinicio
+func (service *RecordatoriosService) cancelarObsoletos(ahora time.Time) error {
+	query := `UPDATE Recordatorios_Cita
+		LEFT JOIN Citas ON Citas.id_citas = Recordatorios_Cita.id_cita
+		SET Recordatorios_Cita.estado = 'cancelado'
+		WHERE Recordatorios_Cita.estado = 'pendiente'
+			AND (Citas.id_citas IS NULL OR (Citas.frecuencia IS NULL AND Citas.inicio <> Recordatorios_Cita.inicio_cita)
+				OR Recordatorios_Cita.inicio_cita <= ?)`
+	if _, err := service.DB.Exec(query, ahora); err != nil {
+		log.Println("Error cancelling recordatorios:", err)
+		return err
+	}
+	if err := service.cancelarOcurrencias(); err != nil {
+		return err
+	}
+	return service.bandeja().Liberar()
+}
+
+// cancelarOcurrencias cancela los pendientes de ocurrencias que ya no existen porque la serie cambió o se exceptuaron
+func (service *RecordatoriosService) cancelarOcurrencias() error {
+	series, err := cargarSeries(service.DB, service.ZonaDefault,
+		"Citas.id_citas IN (SELECT id_cita FROM Recordatorios_Cita WHERE estado = 'pendiente')")
+	if err != nil || len(series) == 0 {
+		return err
+	}
+	porID := map[int]*serie{}
+	for _, s := range series {
+		porID[s.IDCita] = s
+	}
+
+	rows, err := service.DB.Query(`SELECT Recordatorios_Cita.id_recordatorio, Recordatorios_Cita.id_cita, Recordatorios_Cita.inicio_cita
+		FROM Recordatorios_Cita
+		INNER JOIN Citas ON Citas.id_citas = Recordatorios_Cita.id_cita
+		WHERE Recordatorios_Cita.estado = 'pendiente' AND Citas.frecuencia IS NOT NULL`)
+	if err != nil {
+		log.Println("Error fetching recordatorios:", err)
+		return err
+	}
+	var obsoletos []int
+	for rows.Next() {
+		var id, idCita int
+		var inicio time.Time
+		if err := rows.Scan(&id, &idCita, &inicio); err != nil {
+			rows.Close()
+			log.Println("Error scanning recordatorio:", err)
+			return err
+		}
+		if s := porID[idCita]; s != nil && (!s.contiene(inicio) || s.exceptuada(inicio)) {
+			obsoletos = append(obsoletos, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return err
+	}
+
+	for _, id := range obsoletos {
+		if _, err := service.DB.Exec("UPDATE Recordatorios_Cita SET estado = 'cancelado' WHERE id_recordatorio = ? AND estado = 'pendiente'", id); err != nil {
+			log.Println("Error cancelling recordatorio:", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// recordatorio es un recordatorio pendiente con los datos de su cita
+type recordatorio struct {
+	ID              int
+	IDCita          int
+	Tipo            string
+	Destinatario    string
+	Correo          string
+	Titulo          string
+	Descripcion     string
+	Inicio          time.Time
+	Fin             time.Time
+	Usuario         string
+	NombreUsuario   string
+	NombreProspecto string
+	Telefono        string
+}
+
+func (service *RecordatoriosService) enviarPendientes(ahora time.Time) error {
+	query := `SELECT Recordatorios_Cita.id_recordatorio, Recordatorios_Cita.id_cita, Recordatorios_Cita.tipo, Recordatorios_Cita.destinatario,
+			Recordatorios_Cita.correo, Citas.titulo_cita, Citas.descripcion_cita, Recordatorios_Cita.inicio_cita,
+			Recordatorios_Cita.inicio_cita + INTERVAL TIMESTAMPDIFF(MINUTE, Citas.inicio, Citas.fin) MINUTE, Citas.usuario, Usuarios.nombre_usuario,
+			Prospecto.nombre_prospecto, Prospecto.apellido_paterno_prospecto, Prospecto.telefono_prospecto
+		FROM Recordatorios_Cita
+		INNER JOIN Citas ON Citas.id_citas = Recordatorios_Cita.id_cita
+			AND (Citas.frecuencia IS NOT NULL OR Citas.inicio = Recordatorios_Cita.inicio_cita)
+		INNER JOIN Prospecto ON Prospecto.id_cliente = Citas.id_cliente
+		LEFT JOIN Usuarios ON Usuarios.usuario = Citas.usuario
+		WHERE Recordatorios_Cita.estado = 'pendiente' AND Recordatorios_Cita.inicio_cita > ?
+		ORDER BY Recordatorios_Cita.programado_para
+		LIMIT ?`
+	rows, err := service.DB.Query(query, ahora, recordatoriosPorRevision)
+	if err != nil {
+		log.Println("Error fetching recordatorios:", err)
+		return err
+	}
+
+	var pendientes []recordatorio
+	for rows.Next() {
+		var r recordatorio
+		var titulo, descripcion, nombreUsuario, nombre, apellido, telefono sql.NullString
+		err := rows.Scan(&r.ID, &r.IDCita, &r.Tipo, &r.Destinatario, &r.Correo, &titulo, &descripcion, &r.Inicio, &r.Fin, &r.Usuario,
+			&nombreUsuario, &nombre, &apellido, &telefono)
+		if err != nil {
+			rows.Close()
+			log.Println("Error scanning recordatorio:", err)
+			return err
+		}
+		r.Titulo = titulo.String
+		r.Descripcion = descripcion.String
+		r.NombreUsuario = nombreUsuario.String
+		r.NombreProspecto = strings.TrimSpace(nombre.String + " " + apellido.String)
+		r.Telefono = telefono.String
+		pendientes = append(pendientes, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error with rows:", err)
+		return err
+	}
+
+	for _, r := range pendientes {
+		service.enviar(r)
+	}
+	return nil
+}
+
+// enviar reclama el recordatorio antes de mandarlo, si otra replica ya lo reclamó no hace nada. Sin SMTP configurado
+// se queda pendiente hasta que empiece la cita
+func (service *RecordatoriosService) enviar(r recordatorio) {
+	scheduler.Enviar(service.bandeja(), []recordatorio{r}, func(r recordatorio) int { return r.ID }, func([]recordatorio) (string, error) {
+		asunto, cuerpo := service.mensaje(r)
+		return r.Correo, service.Email.SendHTML(r.Correo, asunto, cuerpo)
+	})
+}
+
+func (service *RecordatoriosService) bandeja() *scheduler.Bandeja {
+	return bandejaCorreos(service.DB, "Recordatorios_Cita", "id_recordatorio", "", intentosRecordatorio)
+}
+
+// mensaje arma el asunto y el cuerpo del recordatorio, las horas van en la zona del agente
+func (service *RecordatoriosService) mensaje(r recordatorio) (string, string) {
+	loc := service.ZonaDefault
+	var zona sql.NullString
+	if err := service.DB.QueryRow("SELECT zona_horaria FROM Usuarios WHERE usuario = ?", r.Usuario).Scan(&zona); err == nil && zona.String != "" {
+		if l, err := time.LoadLocation(zona.String); err == nil {
+			loc = l
+		}
+	}
+
+	cuando := "mañana"
+	if r.Tipo == Recordatorio1h {
+		cuando = "en una hora"
+	}
+	hora := fmt.Sprintf("%s a %s (%s)", r.Inicio.In(loc).Format("02/01/2006 15:04"), r.Fin.In(loc).Format("15:04"), loc.String())
+
+	var detalle string
+	if r.Destinatario == DestinatarioAgente {
+		detalle = fmt.Sprintf("<p>Prospecto: %s", html.EscapeString(r.NombreProspecto))
+		if r.Telefono != "" {
+			detalle += " (" + html.EscapeString(r.Telefono) + ")"
+		}
+		detalle += "</p>"
+	} else if r.NombreUsuario != "" {
+		detalle = fmt.Sprintf("<p>Te atiende: %s</p>", html.EscapeString(r.NombreUsuario))
+	}
+
+	asunto := fmt.Sprintf("Recordatorio: %s %s", r.Titulo, cuando)
+	cuerpo := fmt.Sprintf("<html><body><p>Te recordamos que tienes una cita %s.</p><p><b>%s</b><br>%s</p>%s<p>%s</p></body></html>",
+		cuando, html.EscapeString(r.Titulo), html.EscapeString(hora), detalle, html.EscapeString(r.Descripcion))
+	return asunto, cuerpo
+}
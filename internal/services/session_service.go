@@ -0,0 +1,237 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"backend/internal/models"
+)
+
+const (
+	// AccessTokenDuration es la vida del JWT, corta porque se revalida con el refresh token
+	AccessTokenDuration = 15 * time.Minute
+	// RefreshTokenDuration es la vida maxima de una sesion sin volver a hacer login
+	RefreshTokenDuration = 7 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrSessionRevoked      = errors.New("session revoked")
+)
+
+type SessionService struct {
+	DB *sql.DB
+}
+
+// Constructor for the SessionService
+func NewSessionService(db *sql.DB) *SessionService {
+	return &SessionService{
+		DB: db,
+	}
+}
+
+// Crea una sesion para el usuario y regresa su id junto con el primer refresh token
+func (service *SessionService) CreateSession(userID int, ip string, userAgent string) (int, string, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec("INSERT INTO Sesiones (id_usuario, creado_en, expira_en, ip, user_agent) VALUES (?, ?, ?, ?, ?)",
+		userID, now, now.Add(RefreshTokenDuration), ip, truncate(userAgent, 255))
+	if err != nil {
+		log.Println("Error creating session:", err)
+		return 0, "", err
+	}
+	sessionID, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error getting session ID:", err)
+		return 0, "", err
+	}
+
+	refreshToken, err := insertRefreshToken(tx, int(sessionID), now)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing session:", err)
+		return 0, "", err
+	}
+	return int(sessionID), refreshToken, nil
+}
+
+// Cambia un refresh token por uno nuevo dentro de la misma sesion, el token usado ya no sirve.
+// Si alguien presenta un token que ya se habia usado se revoca la sesion completa.
+func (service *SessionService) RotateRefreshToken(refreshToken string) (*models.User, int, string, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return nil, 0, "", err
+	}
+	defer tx.Rollback()
+
+	var tokenID, sessionID int
+	var tokenExpira time.Time
+	var usadoEn, revocadoEn sql.NullTime
+	query := `
+		SELECT Refresh_Tokens.id_refresh_token, Refresh_Tokens.id_sesion, Refresh_Tokens.expira_en, Refresh_Tokens.usado_en, Sesiones.revocado_en
+		FROM Refresh_Tokens
+		INNER JOIN Sesiones ON Sesiones.id_sesion = Refresh_Tokens.id_sesion
+		WHERE Refresh_Tokens.token_hash = ?
+		FOR UPDATE`
+	err = tx.QueryRow(query, hashToken(refreshToken)).Scan(&tokenID, &sessionID, &tokenExpira, &usadoEn, &revocadoEn)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, "", ErrInvalidRefreshToken
+		}
+		log.Println("Error fetching refresh token:", err)
+		return nil, 0, "", err
+	}
+
+	now := time.Now()
+	if revocadoEn.Valid {
+		return nil, 0, "", ErrSessionRevoked
+	}
+	if usadoEn.Valid {
+		log.Printf("Refresh token reuse detected, revoking session %d", sessionID)
+		if _, err := tx.Exec("UPDATE Sesiones SET revocado_en = ? WHERE id_sesion = ?", now, sessionID); err != nil {
+			log.Println("Error revoking session:", err)
+			return nil, 0, "", err
+		}
+		if err := tx.Commit(); err != nil {
+			log.Println("Error committing session revocation:", err)
+			return nil, 0, "", err
+		}
+		return nil, 0, "", ErrRefreshTokenReused
+	}
+	if now.After(tokenExpira) {
+		return nil, 0, "", ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.Exec("UPDATE Refresh_Tokens SET usado_en = ? WHERE id_refresh_token = ?", now, tokenID); err != nil {
+		log.Println("Error marking refresh token as used:", err)
+		return nil, 0, "", err
+	}
+	newToken, err := insertRefreshToken(tx, sessionID, now)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	// La sesion se extiende mientras el usuario siga usandola
+	if _, err := tx.Exec("UPDATE Sesiones SET expira_en = ? WHERE id_sesion = ?", now.Add(RefreshTokenDuration), sessionID); err != nil {
+		log.Println("Error extending session:", err)
+		return nil, 0, "", err
+	}
+
+	user := &models.User{}
+	query = `
+		SELECT Usuarios.id_usuario, Usuarios.usuario, Usuarios.nombre_usuario, Usuarios.role
+		FROM Usuarios
+		INNER JOIN Sesiones ON Sesiones.id_usuario = Usuarios.id_usuario
+		WHERE Sesiones.id_sesion = ?`
+	if err := tx.QueryRow(query, sessionID).Scan(&user.ID, &user.Email, &user.Nombre, &user.Role); err != nil {
+		log.Println("Error fetching session user:", err)
+		return nil, 0, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing refresh token rotation:", err)
+		return nil, 0, "", err
+	}
+	return user, sessionID, newToken, nil
+}
+
+// Indica si la sesion sigue vigente, lo consulta el middleware en cada peticion
+func (service *SessionService) IsSessionActive(sessionID int) (bool, error) {
+	var expiraEn time.Time
+	var revocadoEn sql.NullTime
+	err := service.DB.QueryRow("SELECT expira_en, revocado_en FROM Sesiones WHERE id_sesion = ?", sessionID).Scan(&expiraEn, &revocadoEn)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		log.Println("Error fetching session:", err)
+		return false, err
+	}
+	return !revocadoEn.Valid && time.Now().Before(expiraEn), nil
+}
+
+// Revoca una sesion, los JWT emitidos para ella dejan de ser aceptados
+func (service *SessionService) RevokeSession(sessionID int) error {
+	_, err := service.DB.Exec("UPDATE Sesiones SET revocado_en = ? WHERE id_sesion = ? AND revocado_en IS NULL", time.Now(), sessionID)
+	if err != nil {
+		log.Println("Error revoking session:", err)
+		return err
+	}
+	return nil
+}
+
+// Revoca la sesion a la que pertenece el refresh token
+func (service *SessionService) RevokeSessionByRefreshToken(refreshToken string) error {
+	var sessionID int
+	err := service.DB.QueryRow("SELECT id_sesion FROM Refresh_Tokens WHERE token_hash = ?", hashToken(refreshToken)).Scan(&sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidRefreshToken
+		}
+		log.Println("Error fetching refresh token:", err)
+		return err
+	}
+	return service.RevokeSession(sessionID)
+}
+
+// Revoca todas las sesiones abiertas de un usuario, se usa para dar de baja a un agente de inmediato
+func (service *SessionService) RevokeUserSessions(userID int) (int, error) {
+	result, err := service.DB.Exec("UPDATE Sesiones SET revocado_en = ? WHERE id_usuario = ? AND revocado_en IS NULL", time.Now(), userID)
+	if err != nil {
+		log.Println("Error revoking user sessions:", err)
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		return 0, err
+	}
+	log.Printf("Revoked %d sessions for user ID %d", rows, userID)
+	return int(rows), nil
+}
+
+// helper function que genera un refresh token opaco y guarda su hash
+func insertRefreshToken(tx *sql.Tx, sessionID int, now time.Time) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		log.Println("Error generating refresh token:", err)
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	_, err := tx.Exec("INSERT INTO Refresh_Tokens (token_hash, id_sesion, creado_en, expira_en) VALUES (?, ?, ?, ?)",
+		hashToken(token), sessionID, now, now.Add(RefreshTokenDuration))
+	if err != nil {
+		log.Println("Error inserting refresh token:", err)
+		return "", err
+	}
+	return token, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(value string, max int) string {
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
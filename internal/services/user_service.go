@@ -14,13 +14,15 @@ import (
 type UserService struct {
 	DB *sql.DB
 	EmailService *EmailService
+	SessionService *SessionService
 }
 
 // Constructor for the UserService
-func NewUserService(db *sql.DB, emailService *EmailService) *UserService {
+func NewUserService(db *sql.DB, emailService *EmailService, sessionService *SessionService) *UserService {
 	return &UserService{
 		DB: db,
 		EmailService: emailService,
+		SessionService: sessionService,
 	}
 }
 
@@ -39,11 +41,11 @@ func (service *UserService) GetUserByID(id int) (*models.UserResponse, error) {
 	return user.ToResponse(), nil
 }
 
-// Function to retrieve a user by email and password
-func (service *UserService) Login(email string, password string) (*models.UserResponse, string, error) {
+// Function to retrieve a user by email and password, opens a new session and returns its access and refresh tokens
+func (service *UserService) Login(email string, password string, ip string, userAgent string) (*models.UserResponse, string, string, error) {
 	if email == "" || password == "" {
 		log.Println("Email and password must be provided")
-		return nil, "", errors.New("email and password must be provided")
+		return nil, "", "", errors.New("email and password must be provided")
 	}
 
 	user := &models.User{}
@@ -52,22 +54,65 @@ func (service *UserService) Login(email string, password string) (*models.UserRe
 
 	if err != nil {
 		log.Println("Error fetching user:", err)
-		return nil, "", errors.New("no such user found")
+		return nil, "", "", errors.New("no such user found")
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
 		log.Println("Password mismatch:", err)
-		return nil, "", errors.New("invalid credentials")
+		return nil, "", "", errors.New("invalid credentials")
 	}
 
-	token, err := GenerateToken(user)
+	sessionID, refreshToken, err := service.SessionService.CreateSession(user.ID, ip, userAgent)
+	if err != nil {
+		log.Println("Error creating session:", err)
+		return nil, "", "", errors.New("failed to create session")
+	}
+
+	token, err := GenerateToken(user, sessionID)
 	if err != nil {
 		log.Println("Error generating token:", err)
-		return nil, "", errors.New("failed to generate token")
+		return nil, "", "", errors.New("failed to generate token")
 	}
 
-	return user.ToResponse(), token, nil
+	return user.ToResponse(), token, refreshToken, nil
+}
+
+// Function that exchanges a refresh token for a new access token and a new refresh token
+func (service *UserService) Refresh(refreshToken string) (*models.UserResponse, string, string, error) {
+	if refreshToken == "" {
+		return nil, "", "", ErrInvalidRefreshToken
+	}
+
+	user, sessionID, newRefreshToken, err := service.SessionService.RotateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	token, err := GenerateToken(user, sessionID)
+	if err != nil {
+		log.Println("Error generating token:", err)
+		return nil, "", "", errors.New("failed to generate token")
+	}
+
+	return user.ToResponse(), token, newRefreshToken, nil
+}
+
+// Function that closes the session of the refresh token, or of the access token when there is no refresh token
+func (service *UserService) Logout(refreshToken string, accessToken string) error {
+	if refreshToken != "" {
+		return service.SessionService.RevokeSessionByRefreshToken(refreshToken)
+	}
+	claims, err := validateJWTToken(accessToken)
+	if err != nil {
+		return ErrInvalidRefreshToken
+	}
+	return service.SessionService.RevokeSession(claims.SessionID)
+}
+
+// Function that revokes every open session of a user
+func (service *UserService) RevokeUserSessions(id int) (int, error) {
+	return service.SessionService.RevokeUserSessions(id)
 }
 
 func (service *UserService) CreateUser(user *models.User) (*models.UserResponse, error) {
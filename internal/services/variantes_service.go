@@ -0,0 +1,320 @@
+package services
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// tablaImagenes describe una tabla de imagenes con variantes, asi el mismo worker sirve para Imagenes e ImagenesProspecto
+type tablaImagenes struct {
+	Tabla          string
+	TablaVariantes string
+	// URL de descarga de una variante, recibe el id de la imagen y "nombre.formato"
+	URL string
+	// Registro dueño de las imagenes (propiedad o prospecto), ColumnaPadre es la llave foranea en Tabla
+	TablaPadre   string
+	IDPadre      string
+	ColumnaPadre string
+}
+
+var (
+	tablaImagenesPropiedad = &tablaImagenes{
+		Tabla: "Imagenes", TablaVariantes: "Imagenes_Variantes", URL: "/api/v1/imagenes/archivo/%d/%s",
+		TablaPadre: "Propiedades", IDPadre: "id_propiedad", ColumnaPadre: "id_propiedad",
+	}
+	tablaImagenesProspecto = &tablaImagenes{
+		Tabla: "ImagenesProspecto", TablaVariantes: "ImagenesProspecto_Variantes", URL: "/api/v1/imagenesProspecto/archivo/%d/%s",
+		TablaPadre: "Prospecto", IDPadre: "id_cliente", ColumnaPadre: "id_prospecto",
+	}
+)
+
+var mimeFormatos = map[string]string{
+	"jpg":  "image/jpeg",
+	"webp": "image/webp",
+}
+
+const (
+	intervaloVariantes = time.Minute
+	// Una imagen que lleva mas de este tiempo en 'procesando' se quedo a medias (se reinicio el servidor) y se vuelve a tomar
+	procesamientoExpirado = 10 * time.Minute
+	pendientesPorRevision = 50
+)
+
+type trabajoVariantes struct {
+	tabla *tablaImagenes
+	id    int
+}
+
+// VariantesService genera en segundo plano las variantes (small, medium, large) y el placeholder de las imagenes subidas
+type VariantesService struct {
+	DB       *sql.DB
+	Archivos *ArchivosService
+	cola     chan trabajoVariantes
+}
+
+// Constructor para VariantesService
+func NewVariantesService(db *sql.DB, archivos *ArchivosService) *VariantesService {
+	return &VariantesService{
+		DB:       db,
+		Archivos: archivos,
+		cola:     make(chan trabajoVariantes, 100),
+	}
+}
+
+// EncolarImagen avisa al worker que hay una imagen de propiedad nueva
+func (service *VariantesService) EncolarImagen(id int) {
+	service.encolar(tablaImagenesPropiedad, id)
+}
+
+// EncolarImagenProspecto avisa al worker que hay una imagen de prospecto nueva
+func (service *VariantesService) EncolarImagenProspecto(id int) {
+	service.encolar(tablaImagenesProspecto, id)
+}
+
+// Si la cola esta llena no se bloquea la petición, la imagen sigue 'pendiente' y la toma la revisión periodica
+func (service *VariantesService) encolar(tabla *tablaImagenes, id int) {
+	select {
+	case service.cola <- trabajoVariantes{tabla: tabla, id: id}:
+	default:
+		log.Println("Cola de variantes llena, la imagen", id, "se procesara en la siguiente revisión")
+	}
+}
+
+// Start arranca el worker, tambien revisa cada minuto las imagenes pendientes que no llegaron por la cola
+func (service *VariantesService) Start() {
+	go service.run()
+}
+
+func (service *VariantesService) run() {
+	ticker := time.NewTicker(intervaloVariantes)
+	defer ticker.Stop()
+
+	service.procesarPendientes()
+	for {
+		select {
+		case trabajo := <-service.cola:
+			service.procesar(trabajo.tabla, trabajo.id)
+		case <-ticker.C:
+			service.procesarPendientes()
+		}
+	}
+}
+
+func (service *VariantesService) procesarPendientes() {
+	for _, tabla := range []*tablaImagenes{tablaImagenesPropiedad, tablaImagenesProspecto} {
+		query := fmt.Sprintf("SELECT id_imagen FROM %s WHERE estado_variantes = 'pendiente' OR (estado_variantes = 'procesando' AND variantes_actualizado_en < ?) ORDER BY id_imagen LIMIT %d",
+			tabla.Tabla, pendientesPorRevision)
+		rows, err := service.DB.Query(query, time.Now().Add(-procesamientoExpirado))
+		if err != nil {
+			log.Println("Error buscando imagenes pendientes:", err)
+			continue
+		}
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				log.Println("Error procesando fila de imagen pendiente:", err)
+				break
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		for _, id := range ids {
+			service.procesar(tabla, id)
+		}
+	}
+}
+
+// procesar toma la imagen si nadie mas la tomo, genera sus variantes y las registra
+func (service *VariantesService) procesar(tabla *tablaImagenes, id int) {
+	ruta, ok, err := service.tomar(tabla, id)
+	if err != nil {
+		log.Println("Error tomando imagen para variantes:", err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	if err := service.generar(tabla, id, ruta); err != nil {
+		log.Printf("Error generando variantes de %s %d: %v", tabla.Tabla, id, err)
+		query := fmt.Sprintf("UPDATE %s SET estado_variantes = 'error', variantes_actualizado_en = ? WHERE id_imagen = ?", tabla.Tabla)
+		if _, err := service.DB.Exec(query, time.Now(), id); err != nil {
+			log.Println("Error marcando imagen con error:", err)
+		}
+	}
+}
+
+// tomar marca la imagen como 'procesando', el UPDATE condicionado evita que dos servidores procesen la misma imagen
+func (service *VariantesService) tomar(tabla *tablaImagenes, id int) (string, bool, error) {
+	now := time.Now()
+	query := fmt.Sprintf("UPDATE %s SET estado_variantes = 'procesando', variantes_actualizado_en = ? "+
+		"WHERE id_imagen = ? AND checksum_sha256 IS NOT NULL "+
+		"AND (estado_variantes = 'pendiente' OR (estado_variantes = 'procesando' AND variantes_actualizado_en < ?))", tabla.Tabla)
+	result, err := service.DB.Exec(query, now, id, now.Add(-procesamientoExpirado))
+	if err != nil {
+		return "", false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows != 1 {
+		return "", false, err
+	}
+
+	var ruta string
+	query = fmt.Sprintf("SELECT ruta_imagen FROM %s WHERE id_imagen = ?", tabla.Tabla)
+	if err := service.DB.QueryRow(query, id).Scan(&ruta); err != nil {
+		return "", false, err
+	}
+	return ruta, true, nil
+}
+
+func (service *VariantesService) generar(tabla *tablaImagenes, id int, ruta string) error {
+	reader, err := service.Archivos.Open(ruta)
+	if err != nil {
+		return err
+	}
+	original, err := io.ReadAll(io.LimitReader(reader, ArchivoImagen.MaxBytes+1))
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	variantes, placeholder, err := generarVariantes(original)
+	if err != nil {
+		return err
+	}
+
+	// Las rutas son fijas por imagen, si se vuelve a procesar se sobreescriben los mismos archivos
+	base := strings.TrimSuffix(ruta, path.Ext(ruta))
+	archivos := make([]*models.Archivo, len(variantes))
+	for i, variante := range variantes {
+		archivos[i], err = service.Archivos.SaveBytes(fmt.Sprintf("%s_%s.%s", base, variante.Nombre, variante.Formato), mimeFormatos[variante.Formato], variante.Datos)
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	exists, err := database.RowExists(tx, tabla.Tabla, "id_imagen", id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// La imagen se borro mientras se procesaba
+		for _, archivo := range archivos {
+			service.Archivos.Remove(archivo.Ruta)
+		}
+		return nil
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id_imagen = ?", tabla.TablaVariantes), id); err != nil {
+		return err
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (id_imagen, nombre, formato, ancho, alto, ruta, tipo_mime, tamano_bytes, checksum_sha256) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", tabla.TablaVariantes)
+	for i, variante := range variantes {
+		archivo := archivos[i]
+		if _, err := tx.Exec(insert, id, variante.Nombre, variante.Formato, variante.Ancho, variante.Alto, archivo.Ruta, archivo.TipoMIME, archivo.TamanoBytes, archivo.Checksum); err != nil {
+			return err
+		}
+	}
+	update := fmt.Sprintf("UPDATE %s SET estado_variantes = 'listo', placeholder = ?, variantes_actualizado_en = ? WHERE id_imagen = ?", tabla.Tabla)
+	if _, err := tx.Exec(update, placeholder, time.Now(), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// cargarVariantes regresa las variantes de varias imagenes en una sola consulta, agrupadas por id de imagen
+func cargarVariantes(db *sql.DB, tabla *tablaImagenes, ids []int) (map[int][]models.VarianteImagen, error) {
+	variantes := make(map[int][]models.VarianteImagen)
+	if len(ids) == 0 {
+		return variantes, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	query := fmt.Sprintf("SELECT id_imagen, nombre, formato, ancho, alto FROM %s WHERE id_imagen IN (%s) ORDER BY id_imagen, ancho, formato",
+		tabla.TablaVariantes, strings.Join(placeholders, ", "))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Error recuperando variantes:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var variante models.VarianteImagen
+		if err := rows.Scan(&id, &variante.Nombre, &variante.Formato, &variante.Ancho, &variante.Alto); err != nil {
+			log.Println("Error procesando fila de variante:", err)
+			return nil, err
+		}
+		variante.URL = fmt.Sprintf(tabla.URL, id, variante.Nombre+"."+variante.Formato)
+		variantes[id] = append(variantes[id], variante)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterando filas:", err)
+		return nil, err
+	}
+	return variantes, nil
+}
+
+// getArchivoVariante recupera una variante por su nombre de archivo ("small.webp"), regresa nil si no existe
+func getArchivoVariante(db *sql.DB, tabla *tablaImagenes, id int, variante string) (*models.Archivo, error) {
+	nombre, formato, ok := strings.Cut(variante, ".")
+	if !ok {
+		return nil, nil
+	}
+	query := fmt.Sprintf("SELECT ruta, NULL, tipo_mime, tamano_bytes, checksum_sha256 FROM %s WHERE id_imagen = ? AND nombre = ? AND formato = ?", tabla.TablaVariantes)
+	var archivo models.Archivo
+	var nombreArchivo sql.NullString
+	err := db.QueryRow(query, id, nombre, formato).Scan(&archivo.Ruta, &nombreArchivo, &archivo.TipoMIME, &archivo.TamanoBytes, &archivo.Checksum)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Println("Error recuperando variante:", err)
+		return nil, err
+	}
+	return &archivo, nil
+}
+
+// rutasImagen regresa el archivo original y los de las variantes para borrarlos del storage junto con la imagen
+func rutasImagen(db *sql.DB, tabla *tablaImagenes, id int) ([]string, error) {
+	query := fmt.Sprintf("SELECT ruta_imagen FROM %s WHERE id_imagen = ? AND checksum_sha256 IS NOT NULL UNION ALL SELECT ruta FROM %s WHERE id_imagen = ?",
+		tabla.Tabla, tabla.TablaVariantes)
+	rows, err := db.Query(query, id, id)
+	if err != nil {
+		log.Println("Error recuperando archivos de la imagen:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rutas []string
+	for rows.Next() {
+		var ruta string
+		if err := rows.Scan(&ruta); err != nil {
+			log.Println("Error procesando fila de archivo:", err)
+			return nil, err
+		}
+		rutas = append(rutas, ruta)
+	}
+	return rutas, rows.Err()
+}
@@ -21,7 +21,7 @@ USE `inmosoftDB` ;
 -- Table `inmosoftDB`.`Tipo_Propiedad`
 -- -----------------------------------------------------
 CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Tipo_Propiedad` (
-  `id_tipo_propiedad` INT NOT NULL,
+  `id_tipo_propiedad` INT NOT NULL AUTO_INCREMENT,
   `tipo_propiedad` VARCHAR(45) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   PRIMARY KEY (`id_tipo_propiedad`))
 ENGINE = InnoDB;
@@ -31,7 +31,7 @@ ENGINE = InnoDB;
 -- Table `inmosoftDB`.`Propietario`
 -- -----------------------------------------------------
 CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Propietario` (
-  `id_propietario` INT NOT NULL,
+  `id_propietario` INT NOT NULL AUTO_INCREMENT,
   `nombre_propietario` VARCHAR(45) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `apellido_paterno_propietario` VARCHAR(45) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `apellido_materno_propietario` VARCHAR(45) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
@@ -54,8 +54,11 @@ CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Usuarios` (
   `actualizado_en` DATETIME NULL,
   `borrado_en` DATETIME NULL,
   `verificado` TINYINT NULL DEFAULT 0,
+  `zona_horaria` VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `token_calendario` CHAR(64) NULL,
   PRIMARY KEY (`id_usuario`),
-  UNIQUE INDEX `usuario_UNIQUE` (`usuario` ASC) VISIBLE)
+  UNIQUE INDEX `usuario_UNIQUE` (`usuario` ASC) VISIBLE,
+  UNIQUE INDEX `token_calendario_UNIQUE` (`token_calendario` ASC) VISIBLE)
 ENGINE = InnoDB;
 
 -- -----------------------------------------------------
@@ -110,11 +113,11 @@ CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Propiedades` (
   `observaciones` TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci   NULL,
   `id_tipo_propiedad` INT NOT NULL,
   `id_propietario` INT NOT NULL,
-  `id_usuario` INT NOT NULL,
+  `usuario` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
   PRIMARY KEY (`id_propiedad`),
   INDEX `fk_Propiedades_Tipo_propiedad2_idx` (`id_tipo_propiedad` ASC) VISIBLE,
   INDEX `fk_Propiedades_Propietario2_idx` (`id_propietario` ASC) VISIBLE,
-  INDEX `fk_Propiedades_Usuarios1_idx` (`id_usuario` ASC) VISIBLE,
+  INDEX `fk_Propiedades_Usuarios1_idx` (`usuario` ASC) VISIBLE,
   CONSTRAINT `fk_Propiedades_Tipo_propiedad2`
     FOREIGN KEY (`id_tipo_propiedad`)
     REFERENCES `inmosoftDB`.`Tipo_Propiedad` (`id_tipo_propiedad`)
@@ -126,8 +129,8 @@ CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Propiedades` (
     ON DELETE NO ACTION
     ON UPDATE NO ACTION,
   CONSTRAINT `fk_Propiedades_Usuarios1`
-    FOREIGN KEY (`id_usuario`)
-    REFERENCES `inmosoftDB`.`Usuarios` (`id_usuario`)
+    FOREIGN KEY (`usuario`)
+    REFERENCES `inmosoftDB`.`Usuarios` (`usuario`)
     ON DELETE NO ACTION
     ON UPDATE NO ACTION)
 ENGINE = InnoDB;
@@ -141,9 +144,20 @@ CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Imagenes` (
   `ruta_imagen` VARCHAR(2048) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `descripcion_imagen` VARCHAR(500) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `principal` TINYINT NULL,
+  `posicion` INT NOT NULL DEFAULT 0,
   `id_propiedad` INT NOT NULL,
+  `nombre_archivo` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `tipo_mime` VARCHAR(100) NULL,
+  `tamano_bytes` BIGINT NULL,
+  `checksum_sha256` CHAR(64) NULL,
+  `estado_variantes` ENUM('pendiente', 'procesando', 'listo', 'error') NULL,
+  `variantes_actualizado_en` DATETIME NULL,
+  `placeholder` TEXT NULL,
+  `id_propiedad_principal` INT GENERATED ALWAYS AS (IF(`principal` = 1, `id_propiedad`, NULL)) STORED,
   PRIMARY KEY (`id_imagen`),
   INDEX `fk_Imagenes_Propiedades1_idx` (`id_propiedad` ASC) VISIBLE,
+  UNIQUE INDEX `uq_Imagenes_principal` (`id_propiedad_principal` ASC) VISIBLE,
+  INDEX `idx_Imagenes_posicion` (`id_propiedad` ASC, `posicion` ASC) VISIBLE,
   CONSTRAINT `fk_Imagenes_Propiedades1`
     FOREIGN KEY (`id_propiedad`)
     REFERENCES `inmosoftDB`.`Propiedades` (`id_propiedad`)
@@ -160,9 +174,20 @@ CREATE TABLE IF NOT EXISTS `inmosoftDB`.`ImagenesProspecto` (
   `ruta_imagen` VARCHAR(2048) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `descripcion_imagen` VARCHAR(500) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `principal` TINYINT NULL,
+  `posicion` INT NOT NULL DEFAULT 0,
   `id_prospecto` INT NOT NULL,
+  `nombre_archivo` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `tipo_mime` VARCHAR(100) NULL,
+  `tamano_bytes` BIGINT NULL,
+  `checksum_sha256` CHAR(64) NULL,
+  `estado_variantes` ENUM('pendiente', 'procesando', 'listo', 'error') NULL,
+  `variantes_actualizado_en` DATETIME NULL,
+  `placeholder` TEXT NULL,
+  `id_prospecto_principal` INT GENERATED ALWAYS AS (IF(`principal` = 1, `id_prospecto`, NULL)) STORED,
   PRIMARY KEY (`id_imagen`),
   INDEX `fk_Imagenes_Prospectos1_idx` (`id_prospecto` ASC) VISIBLE,
+  UNIQUE INDEX `uq_ImagenesProspecto_principal` (`id_prospecto_principal` ASC) VISIBLE,
+  INDEX `idx_ImagenesProspecto_posicion` (`id_prospecto` ASC, `posicion` ASC) VISIBLE,
   CONSTRAINT `fk_Imagenes_Prospectos1`
     FOREIGN KEY (`id_prospecto`)
     REFERENCES `inmosoftDB`.`Prospecto` (`id_cliente`)
@@ -175,12 +200,12 @@ ENGINE = InnoDB;
 -- -----------------------------------------------------
   CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Estado_Propiedades` (
     `id_estado_propiedades` INT NOT NULL AUTO_INCREMENT,
-    `tipo_transaccion` VARCHAR(255) NOT NULL,
-    `estado` VARCHAR(255) NOT NULL,
-    `fecha_cambio_estado` VARCHAR(100) NULL,
+    `tipo_transaccion` ENUM('venta', 'renta') NOT NULL,
+    `estado` ENUM('disponible', 'apartada', 'vendida', 'rentada') NOT NULL,
+    `fecha_cambio_estado` DATETIME NULL,
     `id_propiedad` INT NOT NULL,
     PRIMARY KEY (`id_estado_propiedades`),
-    INDEX `fk_Estado_Propiedades_Propiedades1_idx` (`id_propiedad` ASC) VISIBLE,
+    UNIQUE INDEX `fk_Estado_Propiedades_Propiedades1_idx` (`id_propiedad` ASC) VISIBLE,
     CONSTRAINT `fk_Estado_Propiedades_Propiedades1`
       FOREIGN KEY (`id_propiedad`)
       REFERENCES `inmosoftDB`.`Propiedades` (`id_propiedad`)
@@ -189,6 +214,24 @@ ENGINE = InnoDB;
   ENGINE = InnoDB;
 
 
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Historial_Estado_Propiedades`
+-- Solo se inserta, no tiene llave foranea para que el historial se conserve aunque se borre la propiedad
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Historial_Estado_Propiedades` (
+  `id_historial` INT NOT NULL AUTO_INCREMENT,
+  `id_propiedad` INT NOT NULL,
+  `estado_anterior` ENUM('disponible', 'apartada', 'vendida', 'rentada') NULL,
+  `estado_nuevo` ENUM('disponible', 'apartada', 'vendida', 'rentada') NOT NULL,
+  `tipo_transaccion` ENUM('venta', 'renta') NOT NULL,
+  `usuario` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `comentario` VARCHAR(500) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `fecha_cambio` DATETIME NOT NULL,
+  PRIMARY KEY (`id_historial`),
+  INDEX `idx_Historial_Estado_Propiedades_propiedad` (`id_propiedad` ASC, `fecha_cambio` ASC) VISIBLE)
+ENGINE = InnoDB;
+
+
 -- -----------------------------------------------------
 -- Table `inmosoftDB`.`Contratos`
 -- -----------------------------------------------------
@@ -199,12 +242,50 @@ CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Contratos` (
   `tipo` VARCHAR(45) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `ruta_pdf` VARCHAR(255)CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `id_propiedad` INT NOT NULL,
+  `nombre_archivo` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `tipo_mime` VARCHAR(100) NULL,
+  `tamano_bytes` BIGINT NULL,
+  `checksum_sha256` CHAR(64) NULL,
+  `id_version_plantilla` INT NULL,
+  `id_cliente` INT NULL,
+  `datos_plantilla` JSON NULL,
+  `generado_por` VARCHAR(100) NULL,
+  `generado_en` DATETIME NULL,
+  `estado` ENUM('borrador', 'firmado', 'vigente', 'vencido', 'rescindido') NOT NULL DEFAULT 'borrador',
+  `fecha_inicio` DATE NULL,
+  `fecha_fin` DATE NULL,
+  `monto` DOUBLE NULL,
+  `deposito` DOUBLE NULL,
+  `firmado_en` DATETIME NULL,
+  `rescindido_en` DATETIME NULL,
+  `motivo_rescision` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `ruta_pdf_firmado` VARCHAR(255) NULL,
+  `tamano_firmado` BIGINT NULL,
+  `checksum_firmado` CHAR(64) NULL,
+  `dias_gracia` TINYINT UNSIGNED NULL,
+  `recargo_fijo` DOUBLE NULL,
+  `recargo_porcentaje` DOUBLE NULL,
+  `cobranza_desde` DATE NULL,
+  `agente_cierre` VARCHAR(100) NULL,
   PRIMARY KEY (`id_contrato`),
   INDEX `fk_Contratos_Propiedades2_idx` (`id_propiedad` ASC) VISIBLE,
+  INDEX `fk_Contratos_Versiones_Plantilla1_idx` (`id_version_plantilla` ASC) VISIBLE,
+  INDEX `fk_Contratos_Prospecto1_idx` (`id_cliente` ASC) VISIBLE,
+  INDEX `idx_Contratos_estado` (`estado` ASC, `fecha_fin` ASC) VISIBLE,
   CONSTRAINT `fk_Contratos_Propiedades2`
     FOREIGN KEY (`id_propiedad`)
     REFERENCES `inmosoftDB`.`Propiedades` (`id_propiedad`)
     ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Contratos_Versiones_Plantilla1`
+    FOREIGN KEY (`id_version_plantilla`)
+    REFERENCES `inmosoftDB`.`Versiones_Plantilla` (`id_version`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Contratos_Prospecto1`
+    FOREIGN KEY (`id_cliente`)
+    REFERENCES `inmosoftDB`.`Prospecto` (`id_cliente`)
+    ON DELETE SET NULL
     ON UPDATE NO ACTION)
 ENGINE = InnoDB;
 
@@ -219,7 +300,23 @@ CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Prospecto` (
   `apellido_materno_prospecto` VARCHAR(45) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `telefono_prospecto` VARCHAR(45) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `correo_prospecto` VARCHAR(45) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
-  PRIMARY KEY (`id_cliente`))
+  `etapa` VARCHAR(45) NOT NULL DEFAULT 'nuevo',
+  `usuario` VARCHAR(100) NULL,
+  `origen` ENUM('portal', 'referido', 'visita_directa', 'otro') NOT NULL DEFAULT 'otro',
+  `fecha_alta` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `etapa_desde` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `tipo_transaccion` ENUM('venta', 'renta') NULL,
+  `id_tipo_propiedad` INT NULL,
+  `ciudad` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `colonia` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `presupuesto_min` DOUBLE NULL,
+  `presupuesto_max` DOUBLE NULL,
+  `num_recamaras_min` INT NULL,
+  `num_banos_min` INT NULL,
+  `extras` SET('alberca', 'jardin', 'techada', 'cocineta', 'cuarto_servicio') NULL,
+  PRIMARY KEY (`id_cliente`),
+  INDEX `idx_Prospecto_etapa` (`etapa` ASC, `etapa_desde` ASC) VISIBLE,
+  INDEX `idx_Prospecto_usuario` (`usuario` ASC) VISIBLE)
 ENGINE = InnoDB;
 
 
@@ -229,17 +326,33 @@ ENGINE = InnoDB;
 CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Citas` (
   `id_citas` INT NOT NULL AUTO_INCREMENT,
   `titulo_cita` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
-  `fecha_cita` VARCHAR(100) NULL,
-  `hora_cita` INT NULL,
+  `inicio` DATETIME NOT NULL,
+  `fin` DATETIME NOT NULL,
+  `secuencia` INT NOT NULL DEFAULT 0,
   `descripcion_cita` VARCHAR(2000) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
-  `id_usuario` INT NOT NULL,
+  `usuario` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
   `id_cliente` INT NOT NULL,
+  `frecuencia` ENUM('diaria', 'semanal', 'mensual') NULL,
+  `intervalo` INT NOT NULL DEFAULT 1,
+  `conteo` INT NULL,
+  `hasta` DATETIME NULL,
+  `zona_serie` VARCHAR(64) NULL,
+  `fin_serie` DATETIME NULL,
+  `id_cita_serie` INT NULL,
+  `ocurrencia` DATETIME NULL,
+  `resultado` ENUM('interesado', 'no_interesado', 'oferta', 'no_asistio') NULL,
+  `notas_resultado` TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `resultado_registrado_en` DATETIME NULL,
+  `resultado_registrado_por` VARCHAR(100) NULL,
   PRIMARY KEY (`id_citas`),
-  INDEX `fk_Citas_Usuarios1_idx` (`id_usuario` ASC) VISIBLE,
-  INDEX `fk_Citas_Prospecto1_idx` (`id_cliente` ASC) VISIBLE,
+  INDEX `fk_Citas_Usuarios1_idx` (`usuario` ASC) VISIBLE,
+  INDEX `fk_Citas_Prospecto1_idx` (`id_cliente` ASC, `inicio` ASC) VISIBLE,
+  INDEX `idx_Citas_inicio` (`inicio` ASC) VISIBLE,
+  INDEX `idx_Citas_serie` (`frecuencia` ASC, `fin_serie` ASC) VISIBLE,
+  INDEX `idx_Citas_id_cita_serie` (`id_cita_serie` ASC, `ocurrencia` ASC) VISIBLE,
   CONSTRAINT `fk_Citas_Usuarios1`
-    FOREIGN KEY (`id_usuario`)
-    REFERENCES `inmosoftDB`.`Usuarios` (`id_usuario`)
+    FOREIGN KEY (`usuario`)
+    REFERENCES `inmosoftDB`.`Usuarios` (`usuario`)
     ON DELETE NO ACTION
     ON UPDATE NO ACTION,
   CONSTRAINT `fk_Citas_Prospecto1`
@@ -259,6 +372,10 @@ CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Documentos_Anexos` (
   `ruta_documento` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `descripcion_documento_anexo` VARCHAR(45) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci  NULL,
   `id_propiedad` INT NOT NULL,
+  `nombre_archivo` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `tipo_mime` VARCHAR(100) NULL,
+  `tamano_bytes` BIGINT NULL,
+  `checksum_sha256` CHAR(64) NULL,
   PRIMARY KEY (`id_documento_anexo`),
   INDEX `fk_Documentos_Anexos_Propiedades2_idx` (`id_propiedad` ASC) VISIBLE,
   CONSTRAINT `fk_Documentos_Anexos_Propiedades2`
@@ -269,6 +386,600 @@ CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Documentos_Anexos` (
 ENGINE = InnoDB;
 
 
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Sesiones`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Sesiones` (
+  `id_sesion` INT NOT NULL AUTO_INCREMENT,
+  `id_usuario` INT NOT NULL,
+  `creado_en` DATETIME NOT NULL,
+  `expira_en` DATETIME NOT NULL,
+  `revocado_en` DATETIME NULL,
+  `ip` VARCHAR(45) NULL,
+  `user_agent` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_sesion`),
+  INDEX `fk_Sesiones_Usuarios1_idx` (`id_usuario` ASC) VISIBLE,
+  CONSTRAINT `fk_Sesiones_Usuarios1`
+    FOREIGN KEY (`id_usuario`)
+    REFERENCES `inmosoftDB`.`Usuarios` (`id_usuario`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Refresh_Tokens`
+-- Solo se guarda el SHA-256 del token, el token en claro solo lo tiene el cliente
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Refresh_Tokens` (
+  `id_refresh_token` INT NOT NULL AUTO_INCREMENT,
+  `token_hash` CHAR(64) NOT NULL,
+  `id_sesion` INT NOT NULL,
+  `creado_en` DATETIME NOT NULL,
+  `expira_en` DATETIME NOT NULL,
+  `usado_en` DATETIME NULL,
+  PRIMARY KEY (`id_refresh_token`),
+  UNIQUE INDEX `token_hash_UNIQUE` (`token_hash` ASC) VISIBLE,
+  INDEX `fk_Refresh_Tokens_Sesiones1_idx` (`id_sesion` ASC) VISIBLE,
+  CONSTRAINT `fk_Refresh_Tokens_Sesiones1`
+    FOREIGN KEY (`id_sesion`)
+    REFERENCES `inmosoftDB`.`Sesiones` (`id_sesion`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Imagenes_Variantes`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Imagenes_Variantes` (
+  `id_variante` INT NOT NULL AUTO_INCREMENT,
+  `id_imagen` INT NOT NULL,
+  `nombre` VARCHAR(20) NOT NULL,
+  `formato` VARCHAR(10) NOT NULL,
+  `ancho` INT NOT NULL,
+  `alto` INT NOT NULL,
+  `ruta` VARCHAR(255) NOT NULL,
+  `tipo_mime` VARCHAR(100) NOT NULL,
+  `tamano_bytes` BIGINT NOT NULL,
+  `checksum_sha256` CHAR(64) NOT NULL,
+  PRIMARY KEY (`id_variante`),
+  UNIQUE INDEX `uq_Imagenes_Variantes_imagen_nombre_formato` (`id_imagen` ASC, `nombre` ASC, `formato` ASC) VISIBLE,
+  CONSTRAINT `fk_Imagenes_Variantes_Imagenes1`
+    FOREIGN KEY (`id_imagen`)
+    REFERENCES `inmosoftDB`.`Imagenes` (`id_imagen`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`ImagenesProspecto_Variantes`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`ImagenesProspecto_Variantes` (
+  `id_variante` INT NOT NULL AUTO_INCREMENT,
+  `id_imagen` INT NOT NULL,
+  `nombre` VARCHAR(20) NOT NULL,
+  `formato` VARCHAR(10) NOT NULL,
+  `ancho` INT NOT NULL,
+  `alto` INT NOT NULL,
+  `ruta` VARCHAR(255) NOT NULL,
+  `tipo_mime` VARCHAR(100) NOT NULL,
+  `tamano_bytes` BIGINT NOT NULL,
+  `checksum_sha256` CHAR(64) NOT NULL,
+  PRIMARY KEY (`id_variante`),
+  UNIQUE INDEX `uq_ImagenesProspecto_Variantes_imagen_nombre_formato` (`id_imagen` ASC, `nombre` ASC, `formato` ASC) VISIBLE,
+  CONSTRAINT `fk_ImagenesProspecto_Variantes_ImagenesProspecto1`
+    FOREIGN KEY (`id_imagen`)
+    REFERENCES `inmosoftDB`.`ImagenesProspecto` (`id_imagen`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Horarios_Agente`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Horarios_Agente` (
+  `id_horario` INT NOT NULL AUTO_INCREMENT,
+  `usuario` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `dia_semana` TINYINT NOT NULL,
+  `hora_inicio` TIME NOT NULL,
+  `hora_fin` TIME NOT NULL,
+  PRIMARY KEY (`id_horario`),
+  INDEX `fk_Horarios_Agente_Usuarios1_idx` (`usuario` ASC, `dia_semana` ASC) VISIBLE,
+  CONSTRAINT `fk_Horarios_Agente_Usuarios1`
+    FOREIGN KEY (`usuario`)
+    REFERENCES `inmosoftDB`.`Usuarios` (`usuario`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Recordatorios_Cita`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Recordatorios_Cita` (
+  `id_recordatorio` INT NOT NULL AUTO_INCREMENT,
+  `id_cita` INT NOT NULL,
+  `tipo` ENUM('24h', '1h') NOT NULL,
+  `destinatario` ENUM('agente', 'prospecto') NOT NULL,
+  `correo` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `inicio_cita` DATETIME NOT NULL,
+  `programado_para` DATETIME NOT NULL,
+  `estado` ENUM('pendiente', 'enviando', 'enviado', 'cancelado', 'fallido') NOT NULL DEFAULT 'pendiente',
+  `intentos` INT NOT NULL DEFAULT 0,
+  `reclamado_en` DATETIME NULL,
+  `enviado_en` DATETIME NULL,
+  `ultimo_error` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_recordatorio`),
+  UNIQUE INDEX `recordatorio_UNIQUE` (`id_cita` ASC, `tipo` ASC, `destinatario` ASC, `inicio_cita` ASC) VISIBLE,
+  INDEX `idx_Recordatorios_Cita_estado` (`estado` ASC, `programado_para` ASC) VISIBLE)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Excepciones_Cita`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Excepciones_Cita` (
+  `id_cita` INT NOT NULL,
+  `ocurrencia` DATETIME NOT NULL,
+  PRIMARY KEY (`id_cita`, `ocurrencia`),
+  CONSTRAINT `fk_Excepciones_Cita_Citas1`
+    FOREIGN KEY (`id_cita`)
+    REFERENCES `inmosoftDB`.`Citas` (`id_citas`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Citas_Propiedades`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Citas_Propiedades` (
+  `id_cita` INT NOT NULL,
+  `id_propiedad` INT NOT NULL,
+  `orden` INT NOT NULL DEFAULT 0,
+  `resultado` ENUM('interesado', 'no_interesado', 'oferta', 'no_asistio') NULL,
+  `notas` TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_cita`, `id_propiedad`),
+  INDEX `fk_Citas_Propiedades_Propiedades1_idx` (`id_propiedad` ASC) VISIBLE,
+  CONSTRAINT `fk_Citas_Propiedades_Citas1`
+    FOREIGN KEY (`id_cita`)
+    REFERENCES `inmosoftDB`.`Citas` (`id_citas`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Citas_Propiedades_Propiedades1`
+    FOREIGN KEY (`id_propiedad`)
+    REFERENCES `inmosoftDB`.`Propiedades` (`id_propiedad`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Etapas_Prospecto`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Etapas_Prospecto` (
+  `clave` VARCHAR(45) NOT NULL,
+  `nombre` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `orden` INT NOT NULL DEFAULT 0,
+  `tipo` ENUM('abierta', 'ganada', 'perdida') NOT NULL,
+  `activa` TINYINT NOT NULL DEFAULT 1,
+  PRIMARY KEY (`clave`))
+ENGINE = InnoDB;
+
+INSERT IGNORE INTO `inmosoftDB`.`Etapas_Prospecto` (`clave`, `nombre`, `orden`, `tipo`) VALUES
+('nuevo', 'Nuevo', 10, 'abierta'),
+('contactado', 'Contactado', 20, 'abierta'),
+('visita', 'Visita', 30, 'abierta'),
+('oferta', 'Oferta', 40, 'abierta'),
+('cerrado-ganado', 'Cerrado ganado', 50, 'ganada'),
+('cerrado-perdido', 'Cerrado perdido', 60, 'perdida');
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Actividades_Prospecto`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Actividades_Prospecto` (
+  `id_actividad` INT NOT NULL AUTO_INCREMENT,
+  `id_cliente` INT NOT NULL,
+  `tipo` ENUM('nota', 'llamada', 'correo', 'etapa', 'asignacion', 'fusion') NOT NULL,
+  `titulo` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `descripcion` TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `usuario` VARCHAR(100) NULL,
+  `fecha` DATETIME NOT NULL,
+  `id_cita` INT NULL,
+  PRIMARY KEY (`id_actividad`),
+  INDEX `fk_Actividades_Prospecto_Prospecto1_idx` (`id_cliente` ASC, `fecha` ASC) VISIBLE,
+  CONSTRAINT `fk_Actividades_Prospecto_Prospecto1`
+    FOREIGN KEY (`id_cliente`)
+    REFERENCES `inmosoftDB`.`Prospecto` (`id_cliente`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Notificaciones_Match`
+-- Avisos al agente de propiedades nuevas o con precio más bajo para sus prospectos, los manda el scheduler
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Notificaciones_Match` (
+  `id_notificacion` INT NOT NULL AUTO_INCREMENT,
+  `id_propiedad` INT NOT NULL,
+  `id_cliente` INT NOT NULL,
+  `usuario` VARCHAR(100) NOT NULL,
+  `motivo` ENUM('nueva', 'baja_precio') NOT NULL,
+  `precio` DOUBLE NOT NULL,
+  `precio_anterior` DOUBLE NULL,
+  `puntaje` INT NOT NULL,
+  `estado` ENUM('pendiente', 'enviando', 'enviado', 'cancelado', 'fallido') NOT NULL DEFAULT 'pendiente',
+  `intentos` INT NOT NULL DEFAULT 0,
+  `creado_en` DATETIME NOT NULL,
+  `reclamado_en` DATETIME NULL,
+  `enviado_en` DATETIME NULL,
+  `ultimo_error` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_notificacion`),
+  UNIQUE INDEX `notificacion_UNIQUE` (`id_propiedad` ASC, `id_cliente` ASC, `motivo` ASC, `precio` ASC) VISIBLE,
+  INDEX `idx_Notificaciones_Match_estado` (`estado` ASC, `usuario` ASC) VISIBLE)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Plantillas_Contrato`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Plantillas_Contrato` (
+  `id_plantilla` INT NOT NULL AUTO_INCREMENT,
+  `nombre` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `tipo` ENUM('renta', 'venta') NOT NULL,
+  `activa` TINYINT NOT NULL DEFAULT 1,
+  PRIMARY KEY (`id_plantilla`))
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Versiones_Plantilla`
+-- El texto de cada versión no se modifica, así los contratos generados con ella se pueden regenerar idénticos
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Versiones_Plantilla` (
+  `id_version` INT NOT NULL AUTO_INCREMENT,
+  `id_plantilla` INT NOT NULL,
+  `version` INT NOT NULL,
+  `contenido` MEDIUMTEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `nota` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `creado_por` VARCHAR(100) NULL,
+  `creado_en` DATETIME NOT NULL,
+  PRIMARY KEY (`id_version`),
+  UNIQUE INDEX `version_UNIQUE` (`id_plantilla` ASC, `version` ASC) VISIBLE,
+  CONSTRAINT `fk_Versiones_Plantilla_Plantillas_Contrato1`
+    FOREIGN KEY (`id_plantilla`)
+    REFERENCES `inmosoftDB`.`Plantillas_Contrato` (`id_plantilla`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+INSERT IGNORE INTO `inmosoftDB`.`Plantillas_Contrato` (`id_plantilla`, `nombre`, `tipo`) VALUES
+(1, 'Arrendamiento de casa habitación', 'renta'),
+(2, 'Compraventa de inmueble', 'venta');
+
+INSERT IGNORE INTO `inmosoftDB`.`Versiones_Plantilla` (`id_version`, `id_plantilla`, `version`, `contenido`, `creado_en`) VALUES
+(1, 1, 1, '# CONTRATO DE ARRENDAMIENTO
+
+Contrato número {{contrato.numero}} que celebran por una parte {{propietario.nombre}}, a quien en lo sucesivo se le denominará "EL ARRENDADOR", y por la otra {{cliente.nombre}}, a quien en lo sucesivo se le denominará "EL ARRENDATARIO", en {{propiedad.ciudad}} el {{fecha}}, al tenor de las siguientes cláusulas:
+
+# CLÁUSULAS
+
+PRIMERA. EL ARRENDADOR da en arrendamiento a EL ARRENDATARIO el inmueble ubicado en {{propiedad.domicilio}}, que EL ARRENDATARIO recibe en buen estado y se obliga a destinar únicamente a casa habitación.
+
+SEGUNDA. La renta mensual es de {{precio}}, que EL ARRENDATARIO pagará por adelantado dentro de los primeros cinco días de cada mes.
+
+TERCERA. La vigencia del contrato es del {{fecha_inicio}} al {{fecha_fin}}. Al terminar, EL ARRENDATARIO entregará el inmueble en el estado en que lo recibió, salvo el desgaste por el uso normal.
+
+CUARTA. EL ARRENDATARIO no podrá subarrendar ni ceder sus derechos sobre el inmueble sin el consentimiento por escrito de EL ARRENDADOR.
+
+{{clausulas}}
+
+Leído el presente contrato y enteradas las partes de su contenido y alcance, lo firman de conformidad.', UTC_TIMESTAMP()),
+(2, 2, 1, '# CONTRATO DE COMPRAVENTA
+
+Contrato número {{contrato.numero}} que celebran por una parte {{propietario.nombre}}, a quien en lo sucesivo se le denominará "EL VENDEDOR", y por la otra {{cliente.nombre}}, a quien en lo sucesivo se le denominará "EL COMPRADOR", en {{propiedad.ciudad}} el {{fecha}}, al tenor de las siguientes cláusulas:
+
+# CLÁUSULAS
+
+PRIMERA. EL VENDEDOR vende a EL COMPRADOR, quien adquiere para sí, el inmueble ubicado en {{propiedad.domicilio}}, libre de todo gravamen y al corriente en el pago de sus contribuciones.
+
+SEGUNDA. El precio de la compraventa es de {{precio}}, que EL COMPRADOR pagará a más tardar el {{fecha_inicio}}, fecha en la que EL VENDEDOR entregará la posesión del inmueble.
+
+TERCERA. Los gastos, impuestos y honorarios de la escrituración correrán por cuenta de EL COMPRADOR, salvo el impuesto sobre la renta que corresponda a EL VENDEDOR.
+
+{{clausulas}}
+
+Leído el presente contrato y enteradas las partes de su contenido y alcance, lo firman de conformidad.', UTC_TIMESTAMP());
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Partes_Contrato`
+-- Quién firma el contrato, el nombre y contacto se copian para que no cambien si se edita el propietario o prospecto
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Partes_Contrato` (
+  `id_parte` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `rol` ENUM('propietario', 'cliente', 'fiador') NOT NULL,
+  `id_propietario` INT NULL,
+  `id_cliente` INT NULL,
+  `nombre` VARCHAR(150) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `correo` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `telefono` VARCHAR(20) NULL,
+  PRIMARY KEY (`id_parte`),
+  UNIQUE INDEX `parte_UNIQUE` (`id_contrato` ASC, `rol` ASC) VISIBLE,
+  INDEX `fk_Partes_Contrato_Propietario1_idx` (`id_propietario` ASC) VISIBLE,
+  INDEX `fk_Partes_Contrato_Prospecto1_idx` (`id_cliente` ASC) VISIBLE,
+  CONSTRAINT `fk_Partes_Contrato_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Partes_Contrato_Propietario1`
+    FOREIGN KEY (`id_propietario`)
+    REFERENCES `inmosoftDB`.`Propietario` (`id_propietario`)
+    ON DELETE SET NULL
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Partes_Contrato_Prospecto1`
+    FOREIGN KEY (`id_cliente`)
+    REFERENCES `inmosoftDB`.`Prospecto` (`id_cliente`)
+    ON DELETE SET NULL
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Avisos_Vencimiento`
+-- Avisos al agente de los contratos que vencen en los próximos 60 días, uno por fecha de fin, los manda el scheduler
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Avisos_Vencimiento` (
+  `id_aviso` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `fecha_fin` DATE NOT NULL,
+  `usuario` VARCHAR(100) NOT NULL,
+  `estado` ENUM('pendiente', 'enviando', 'enviado', 'cancelado', 'fallido') NOT NULL DEFAULT 'pendiente',
+  `intentos` INT NOT NULL DEFAULT 0,
+  `creado_en` DATETIME NOT NULL,
+  `reclamado_en` DATETIME NULL,
+  `enviado_en` DATETIME NULL,
+  `ultimo_error` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_aviso`),
+  UNIQUE INDEX `aviso_UNIQUE` (`id_contrato` ASC, `fecha_fin` ASC) VISIBLE,
+  INDEX `idx_Avisos_Vencimiento_estado` (`estado` ASC, `usuario` ASC) VISIBLE,
+  CONSTRAINT `fk_Avisos_Vencimiento_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Firmas_Contrato`
+-- Solicitud de firma electrónica de cada parte, del token del enlace solo se guarda el hash
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Firmas_Contrato` (
+  `id_firma` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `id_parte` INT NULL,
+  `rol` ENUM('propietario', 'cliente', 'fiador') NOT NULL,
+  `nombre` VARCHAR(150) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `correo` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `estado` ENUM('pendiente', 'firmada', 'cancelada') NOT NULL DEFAULT 'pendiente',
+  `checksum_documento` CHAR(64) NOT NULL,
+  `enviado_en` DATETIME NOT NULL,
+  `expira_en` DATETIME NOT NULL,
+  `firmado_en` DATETIME NULL,
+  `tipo_firma` ENUM('escrita', 'dibujada') NULL,
+  `firma_texto` VARCHAR(150) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `firma_imagen` MEDIUMBLOB NULL,
+  `ip` VARCHAR(45) NULL,
+  `user_agent` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_firma`),
+  UNIQUE INDEX `token_hash_UNIQUE` (`token_hash` ASC) VISIBLE,
+  INDEX `idx_Firmas_Contrato_estado` (`id_contrato` ASC, `estado` ASC) VISIBLE,
+  INDEX `fk_Firmas_Contrato_Partes_Contrato1_idx` (`id_parte` ASC) VISIBLE,
+  CONSTRAINT `fk_Firmas_Contrato_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Firmas_Contrato_Partes_Contrato1`
+    FOREIGN KEY (`id_parte`)
+    REFERENCES `inmosoftDB`.`Partes_Contrato` (`id_parte`)
+    ON DELETE SET NULL
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Eventos_Firma`
+-- Bitácora de las firmas: envíos, aperturas del enlace, firmas y cancelaciones con IP, navegador y SHA-256 del documento
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Eventos_Firma` (
+  `id_evento` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `id_firma` INT NULL,
+  `evento` ENUM('enviada', 'reenviada', 'vista', 'firmada', 'cancelada', 'completada') NOT NULL,
+  `ip` VARCHAR(45) NULL,
+  `user_agent` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `checksum_documento` CHAR(64) NULL,
+  `detalle` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `creado_en` DATETIME NOT NULL,
+  PRIMARY KEY (`id_evento`),
+  INDEX `idx_Eventos_Firma_contrato` (`id_contrato` ASC, `creado_en` ASC) VISIBLE,
+  INDEX `fk_Eventos_Firma_Firmas_Contrato1_idx` (`id_firma` ASC) VISIBLE,
+  CONSTRAINT `fk_Eventos_Firma_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Eventos_Firma_Firmas_Contrato1`
+    FOREIGN KEY (`id_firma`)
+    REFERENCES `inmosoftDB`.`Firmas_Contrato` (`id_firma`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Cargos_Renta`
+-- Cargos de los contratos de renta: la renta de cada mes, el depósito y los recargos, los genera el scheduler
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Cargos_Renta` (
+  `id_cargo` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `tipo` ENUM('renta', 'deposito', 'recargo') NOT NULL,
+  `periodo` DATE NOT NULL,
+  `concepto` VARCHAR(150) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `monto` DECIMAL(12,2) NOT NULL,
+  `fecha_vencimiento` DATE NOT NULL,
+  `creado_en` DATETIME NOT NULL,
+  `condonado_en` DATETIME NULL,
+  `condonado_por` VARCHAR(100) NULL,
+  `motivo_condonacion` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_cargo`),
+  UNIQUE INDEX `cargo_UNIQUE` (`id_contrato` ASC, `tipo` ASC, `periodo` ASC) VISIBLE,
+  INDEX `idx_Cargos_Renta_vencimiento` (`id_contrato` ASC, `fecha_vencimiento` ASC) VISIBLE,
+  CONSTRAINT `fk_Cargos_Renta_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Pagos_Renta`
+-- Pagos de los inquilinos, no se borran: un pago registrado por error se cancela con un motivo
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Pagos_Renta` (
+  `id_pago` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `fecha` DATE NOT NULL,
+  `monto` DECIMAL(12,2) NOT NULL,
+  `metodo` ENUM('efectivo', 'transferencia', 'tarjeta') NOT NULL,
+  `referencia` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `notas` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `registrado_por` VARCHAR(100) NULL,
+  `creado_en` DATETIME NOT NULL,
+  `cancelado_en` DATETIME NULL,
+  `cancelado_por` VARCHAR(100) NULL,
+  `motivo_cancelacion` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_pago`),
+  INDEX `idx_Pagos_Renta_fecha` (`id_contrato` ASC, `fecha` ASC) VISIBLE,
+  CONSTRAINT `fk_Pagos_Renta_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Avisos_Adeudo`
+-- Avisos al inquilino de las rentas y depósitos que pasaron los días de gracia sin pagarse, uno por cargo
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Avisos_Adeudo` (
+  `id_aviso` INT NOT NULL AUTO_INCREMENT,
+  `id_cargo` INT NOT NULL,
+  `id_contrato` INT NOT NULL,
+  `correo` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `estado` ENUM('pendiente', 'enviando', 'enviado', 'cancelado', 'fallido') NOT NULL DEFAULT 'pendiente',
+  `intentos` INT NOT NULL DEFAULT 0,
+  `creado_en` DATETIME NOT NULL,
+  `reclamado_en` DATETIME NULL,
+  `enviado_en` DATETIME NULL,
+  `ultimo_error` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_aviso`),
+  UNIQUE INDEX `aviso_cargo_UNIQUE` (`id_cargo` ASC) VISIBLE,
+  INDEX `idx_Avisos_Adeudo_estado` (`id_contrato` ASC, `estado` ASC) VISIBLE,
+  CONSTRAINT `fk_Avisos_Adeudo_Cargos_Renta1`
+    FOREIGN KEY (`id_cargo`)
+    REFERENCES `inmosoftDB`.`Cargos_Renta` (`id_cargo`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Avisos_Adeudo_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Reglas_Comision`
+-- Comisión de la inmobiliaria: general por transacción, por tipo de propiedad o de un contrato. La clave evita duplicados.
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Reglas_Comision` (
+  `id_regla` INT NOT NULL AUTO_INCREMENT,
+  `clave` VARCHAR(40) NOT NULL,
+  `id_contrato` INT NULL,
+  `id_tipo_propiedad` INT NULL,
+  `tipo_transaccion` ENUM('renta', 'venta') NOT NULL,
+  `porcentaje` DOUBLE NULL,
+  `meses` DOUBLE NULL,
+  `porcentaje_captador` DOUBLE NOT NULL DEFAULT 50,
+  `actualizado_por` VARCHAR(100) NULL,
+  `actualizado_en` DATETIME NOT NULL,
+  PRIMARY KEY (`id_regla`),
+  UNIQUE INDEX `clave_UNIQUE` (`clave` ASC) VISIBLE,
+  INDEX `fk_Reglas_Comision_Contratos1_idx` (`id_contrato` ASC) VISIBLE,
+  INDEX `fk_Reglas_Comision_Tipo_Propiedad1_idx` (`id_tipo_propiedad` ASC) VISIBLE,
+  CONSTRAINT `fk_Reglas_Comision_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Reglas_Comision_Tipo_Propiedad1`
+    FOREIGN KEY (`id_tipo_propiedad`)
+    REFERENCES `inmosoftDB`.`Tipo_Propiedad` (`id_tipo_propiedad`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Envios_Estado_Propietario`
+-- Estados de cuenta mensuales que se mandan a los propietarios, uno por propietario y mes
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Envios_Estado_Propietario` (
+  `id_envio` INT NOT NULL AUTO_INCREMENT,
+  `id_propietario` INT NOT NULL,
+  `periodo` DATE NOT NULL,
+  `correo` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `estado` ENUM('pendiente', 'enviando', 'enviado', 'cancelado', 'fallido') NOT NULL DEFAULT 'pendiente',
+  `intentos` INT NOT NULL DEFAULT 0,
+  `creado_en` DATETIME NOT NULL,
+  `reclamado_en` DATETIME NULL,
+  `enviado_en` DATETIME NULL,
+  `ultimo_error` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_envio`),
+  UNIQUE INDEX `envio_periodo_UNIQUE` (`id_propietario` ASC, `periodo` ASC) VISIBLE,
+  INDEX `idx_Envios_Estado_Propietario_estado` (`estado` ASC) VISIBLE,
+  CONSTRAINT `fk_Envios_Estado_Propietario_Propietario1`
+    FOREIGN KEY (`id_propietario`)
+    REFERENCES `inmosoftDB`.`Propietario` (`id_propietario`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Tareas_Programadas`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Tareas_Programadas` (
+  `nombre` VARCHAR(100) NOT NULL,
+  `duenio` VARCHAR(255) NOT NULL,
+  `lease_hasta` DATETIME NOT NULL,
+  `ultima_ejecucion` DATETIME NULL,
+  PRIMARY KEY (`nombre`))
+ENGINE = InnoDB;
+
+
 SET SQL_MODE=@OLD_SQL_MODE;
 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
@@ -1,4 +1,4 @@
-insert into Usuarios (id_usuario, usuario, nombre_usuario, password_usuario, role) values(1, 'admin@prueba.com', 'Admin', '$2a$10$7HlADYe6QdYgtbK9lDOxAe1WxwwvMYXMJyIyFq4oPlDDlFbyxun4S', 'admin');
+insert into Usuarios (id_usuario, usuario, nombre_usuario, password_usuario, role, zona_horaria) values(1, 'admin@prueba.com', 'Admin', '$2a$10$7HlADYe6QdYgtbK9lDOxAe1WxwwvMYXMJyIyFq4oPlDDlFbyxun4S', 'admin', 'America/Mexico_City');
 
 
 INSERT INTO `inmosoftDB`.`Tipo_Propiedad` values (1, 'casa');
@@ -36,7 +36,7 @@ VALUES
 (1, 'Casa Sorrento Residencial', '2024-10-11', 'Los Pastores S/N, Los Valdez, Fraccionamiento Sorrento, Saltillo', 'Fraccionamiento Sorrento', 'Saltillo', 'Frente al parque', 3463000, 
  144, 173, 1, 1, 2, 4, 3, 2, 60, 'natural', 'clima,aljibe', 
  'alberca,jardin,techada', 'agua,luz,internet', 
- 'El Modelo Bari II es la eleccion perfecta para quienes buscan una combinacion de estilo contemporaneo y funcionalidad en su nuevo hogar. Disenado para maximizar el confort y la comodidad, este modelo se adapta a las necesidades de familias modernas.', 1, 1, 'Admin');
+ 'El Modelo Bari II es la eleccion perfecta para quienes buscan una combinacion de estilo contemporaneo y funcionalidad en su nuevo hogar. Disenado para maximizar el confort y la comodidad, este modelo se adapta a las necesidades de familias modernas.', 1, 1, 'admin@prueba.com');
 
 -- Insert 2
 INSERT INTO `inmosoftDB`.`Propiedades` 
@@ -48,7 +48,7 @@ VALUES
 (2, 'Casa Nueva en Privadas Mirasierra Blvd Mirasierra', '2024-10-12', 'BLVD CEDROS 3ERA ETAPA NUEVA MIRASIERRA, Nazario S Ortiz Garza, Saltillo', 'Mirasierra', 'Saltillo', 'Cerca de la escuela', 2383000, 
  150, 300, 0, 0, 1, 2, 1, 1, 30, 'estacionario', 'clima,calefaccion', 
  'techada,cocineta', 'agua,luz', 
- 'Casas totalmente nuevas en Privanzas MiraSierra Cerca de todo lo que necesitas EN TOTAL tenemos 4 modelos Desde $2,384,000 hasta $2,550,000 Se acepta COFINAVIT E INFONAVIT y credito bancario. Muy exclusivo y privado con caseta y acceso controlado.', 1, 2, 'Admin');
+ 'Casas totalmente nuevas en Privanzas MiraSierra Cerca de todo lo que necesitas EN TOTAL tenemos 4 modelos Desde $2,384,000 hasta $2,550,000 Se acepta COFINAVIT E INFONAVIT y credito bancario. Muy exclusivo y privado con caseta y acceso controlado.', 1, 2, 'admin@prueba.com');
 
 -- Insert 3
 INSERT INTO `inmosoftDB`.`Propiedades` 
@@ -60,7 +60,7 @@ VALUES
 (3, 'Casa de una planta', '2024-10-13', 'Residencial San Alberto, Residencial San Alberto, Saltillo', 'San Alberto', 'Saltillo', 'Cerca del H-E-B', 10590000, 
  180, 350, 1, 0, 2, 3, 2, 2, 50, 'natural', 'calefaccion,hidroneumatico', 
  'jardin,cuarto_servicio', 'agua,luz,internet', 
- 'Casa de una planta en venta en Residencial San Alberto Al norte de la Ciudad de Saltillo, Coahuila. Fraccionamiento muy seguro y privado. Recibidor, 1/2 bano de visitas, Sala, comedor, cocina integral con barra desayunador con cubierta de granito, amplia terraza exterior con asador y otro medio bano, bodega exterior, 2 recamaras muy amplias con bano - vestidor compartido (suficientemente amplio para adaptarse otro bano) una de las recamaras con closet, lavanderia, bodega interior y otra exterior, jardin en la cochera que es techada para 2 autos y pasillo de servicio.', 1, 3, 'Admin');
+ 'Casa de una planta en venta en Residencial San Alberto Al norte de la Ciudad de Saltillo, Coahuila. Fraccionamiento muy seguro y privado. Recibidor, 1/2 bano de visitas, Sala, comedor, cocina integral con barra desayunador con cubierta de granito, amplia terraza exterior con asador y otro medio bano, bodega exterior, 2 recamaras muy amplias con bano - vestidor compartido (suficientemente amplio para adaptarse otro bano) una de las recamaras con closet, lavanderia, bodega interior y otra exterior, jardin en la cochera que es techada para 2 autos y pasillo de servicio.', 1, 3, 'admin@prueba.com');
 
 -- Insert 4
 INSERT INTO `inmosoftDB`.`Propiedades` 
@@ -72,7 +72,7 @@ VALUES
 (4, 'Casa en Fraccionamiento Nuestra Sra de Fatima', '2024-10-14', 'Fracc. Nuestra Sra de Fatima, Nuestra Senora de Fatima, Saltillo', 'Nuestra Senora de Fatima', 'Saltillo', 'Junto al mercado', 4520000, 
  170, 320, 0, 1, 1, 2, 1, 1, 40, 'estacionario', 'clima', 
  'techada', 'agua', 
- 'Casa en venta en Fracc Nuestra Senora de Fatima Fraccionamiento cerrado con ubicacion privilegiada, cercano a centros comerciales, escuelas, universidades y hospitales, facil acceso a Carretera Saltillo-Monterrey', 2, 1, 'Admin');
+ 'Casa en venta en Fracc Nuestra Senora de Fatima Fraccionamiento cerrado con ubicacion privilegiada, cercano a centros comerciales, escuelas, universidades y hospitales, facil acceso a Carretera Saltillo-Monterrey', 2, 1, 'admin@prueba.com');
 
 -- Insert 5
 INSERT INTO `inmosoftDB`.`Propiedades` 
@@ -84,7 +84,7 @@ VALUES
 (5, 'Casa en Venta en Col. Jardines del Lago Saltillo', '2024-10-15', 'Col. Jardines del LAGO, Jardines del Lago, Saltillo', 'Jardines de Lago', 'Saltillo', 'Junto a la iglesia', 4700000, 
  200, 400, 1, 0, 2, 4, 3, 3, 80, 'natural', 'clima,calefaccion', 
  'alberca,jardin', 'agua,luz,internet', 
- 'Disfruta de la comodidad y el lujo en esta casa de un solo piso en Col. Jardines de Lago. Con 328m2 de terreno y 300m2 de construccion, cuenta con 3 recamaras, 2.5 banos, area de juegos con chimenea, cocina equipada, cuarto de servicio, cochera techada y fraccionamiento privado. ¡No pierdas esta oportunidad! Precio: $4,700,000.00. #CasaEnVenta #JardinesDelLago #Saltillo #CasaDeUnPiso #FraccionamientoPrivado', 1, 2, 'Admin');
+ 'Disfruta de la comodidad y el lujo en esta casa de un solo piso en Col. Jardines de Lago. Con 328m2 de terreno y 300m2 de construccion, cuenta con 3 recamaras, 2.5 banos, area de juegos con chimenea, cocina equipada, cuarto de servicio, cochera techada y fraccionamiento privado. ¡No pierdas esta oportunidad! Precio: $4,700,000.00. #CasaEnVenta #JardinesDelLago #Saltillo #CasaDeUnPiso #FraccionamientoPrivado', 1, 2, 'admin@prueba.com');
 
 select * from Propiedades;
 
@@ -94,6 +94,10 @@ INSERT INTO `inmosoftDB`.`Estado_Propiedades` values (3, 'venta', 'vendida', nul
 INSERT INTO `inmosoftDB`.`Estado_Propiedades` values (4, 'renta', 'disponible', null, 4);
 INSERT INTO `inmosoftDB`.`Estado_Propiedades` values (5, 'venta', 'disponible', null, 5);
 
+INSERT INTO `inmosoftDB`.`Historial_Estado_Propiedades` (`id_propiedad`, `estado_anterior`, `estado_nuevo`, `tipo_transaccion`, `usuario`, `fecha_cambio`)
+SELECT e.id_propiedad, NULL, e.estado, e.tipo_transaccion, p.usuario, NOW()
+FROM `inmosoftDB`.`Estado_Propiedades` e INNER JOIN `inmosoftDB`.`Propiedades` p ON p.id_propiedad = e.id_propiedad;
+
 select * from Estado_Propiedades;
 
 INSERT INTO `inmosoftDB`.`Prospecto` 
@@ -107,16 +111,17 @@ VALUES
 (6, 'Elena', 'Gutierrez', 'Diaz', '555-1357', 'elena.gutierrez@example.com'),
 (7, 'Josefa', 'Mendoza', 'Fernandez', '555-9876', 'josefa.mendoza@example.com');
 
+-- Las citas se guardan en UTC, las 17:00 en America/Mexico_City son las 23:00 UTC
 INSERT INTO `inmosoftDB`.`Citas` 
-(`id_citas`, `titulo_cita`, `fecha_cita`, `hora_cita`, `descripcion_cita`, `usuario`, `id_cliente`) 
+(`id_citas`, `titulo_cita`, `inicio`, `fin`, `descripcion_cita`, `usuario`, `id_cliente`) 
 VALUES 
-(1, 'Primera visita de inspeccion', '2024-12-12', 1700, 'Primera inspeccion para revisar el estado de la propiedad.', 'Admin', 1),
-(2, 'Negociacion', '2024-12-12', 1000, 'Seguimiento a observaciones de la primera inspeccion.', 'Admin', 2),
-(3, 'Revision de documentos', '2024-12-15', 1500, 'Revision de papelería necesaria para el proceso.', 'Admin', 3),
-(4, 'Confirmacion de oferta', '2024-12-15', 1100, 'Confirmar la oferta presentada por el cliente.', 'Admin', 4),
-(5, 'Visita para negociacion', '2024-12-15', 1400, 'Negociacion de condiciones finales.', 'Admin', 5),
-(6, 'Revision final de contrato', '2024-12-15', 1600, 'Revisar el contrato antes de la firma final.', 'Admin', 6),
-(7, 'Firma de contrato', '2024-12-18', 1200, 'Firma oficial del contrato con el cliente.', 'Admin', 7);
+(1, 'Primera visita de inspeccion', '2024-12-12 23:00:00', '2024-12-13 00:00:00', 'Primera inspeccion para revisar el estado de la propiedad.', 'admin@prueba.com', 1),
+(2, 'Negociacion', '2024-12-12 16:00:00', '2024-12-12 17:00:00', 'Seguimiento a observaciones de la primera inspeccion.', 'admin@prueba.com', 2),
+(3, 'Revision de documentos', '2024-12-15 21:00:00', '2024-12-15 22:00:00', 'Revision de papelería necesaria para el proceso.', 'admin@prueba.com', 3),
+(4, 'Confirmacion de oferta', '2024-12-15 17:00:00', '2024-12-15 18:00:00', 'Confirmar la oferta presentada por el cliente.', 'admin@prueba.com', 4),
+(5, 'Visita para negociacion', '2024-12-15 20:00:00', '2024-12-15 21:00:00', 'Negociacion de condiciones finales.', 'admin@prueba.com', 5),
+(6, 'Revision final de contrato', '2024-12-15 22:00:00', '2024-12-15 23:00:00', 'Revisar el contrato antes de la firma final.', 'admin@prueba.com', 6),
+(7, 'Firma de contrato', '2024-12-18 18:00:00', '2024-12-18 19:00:00', 'Firma oficial del contrato con el cliente.', 'admin@prueba.com', 7);
 
 INSERT INTO `inmosoftDB`.`ImagenesProspecto`
 (`id_imagen`, `ruta_imagen`, `descripcion_imagen`, `principal`, `id_prospecto`)
@@ -0,0 +1,21 @@
+-- -----------------------------------------------------
+-- Agrega los datos del archivo subido (nombre, tipo, tamaño y checksum) a las imágenes, los contratos y los documentos anexos.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Imagenes`
+  ADD COLUMN `nombre_archivo` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL AFTER `id_propiedad`,
+  ADD COLUMN `tipo_mime` VARCHAR(100) NULL AFTER `nombre_archivo`,
+  ADD COLUMN `tamano_bytes` BIGINT NULL AFTER `tipo_mime`,
+  ADD COLUMN `checksum_sha256` CHAR(64) NULL AFTER `tamano_bytes`;
+
+ALTER TABLE `inmosoftDB`.`Contratos`
+  ADD COLUMN `nombre_archivo` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL AFTER `id_propiedad`,
+  ADD COLUMN `tipo_mime` VARCHAR(100) NULL AFTER `nombre_archivo`,
+  ADD COLUMN `tamano_bytes` BIGINT NULL AFTER `tipo_mime`,
+  ADD COLUMN `checksum_sha256` CHAR(64) NULL AFTER `tamano_bytes`;
+
+ALTER TABLE `inmosoftDB`.`Documentos_Anexos`
+  ADD COLUMN `nombre_archivo` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL AFTER `id_propiedad`,
+  ADD COLUMN `tipo_mime` VARCHAR(100) NULL AFTER `nombre_archivo`,
+  ADD COLUMN `tamano_bytes` BIGINT NULL AFTER `tipo_mime`,
+  ADD COLUMN `checksum_sha256` CHAR(64) NULL AFTER `tamano_bytes`;
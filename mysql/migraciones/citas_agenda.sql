@@ -0,0 +1,21 @@
+-- -----------------------------------------------------
+-- Agrega la duración de las citas y el horario de trabajo de los agentes.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Citas`
+  ADD COLUMN `duracion_minutos` INT NOT NULL DEFAULT 60 AFTER `hora_cita`;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Horarios_Agente` (
+  `id_horario` INT NOT NULL AUTO_INCREMENT,
+  `usuario` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `dia_semana` TINYINT NOT NULL,
+  `hora_inicio` TIME NOT NULL,
+  `hora_fin` TIME NOT NULL,
+  PRIMARY KEY (`id_horario`),
+  INDEX `fk_Horarios_Agente_Usuarios1_idx` (`usuario` ASC, `dia_semana` ASC) VISIBLE,
+  CONSTRAINT `fk_Horarios_Agente_Usuarios1`
+    FOREIGN KEY (`usuario`)
+    REFERENCES `inmosoftDB`.`Usuarios` (`usuario`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
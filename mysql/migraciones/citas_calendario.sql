@@ -0,0 +1,10 @@
+-- -----------------------------------------------------
+-- Agrega el token del feed ICS de los agentes y la secuencia de las invitaciones de las citas.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Usuarios`
+  ADD COLUMN `token_calendario` CHAR(64) NULL AFTER `zona_horaria`,
+  ADD UNIQUE INDEX `token_calendario_UNIQUE` (`token_calendario` ASC) VISIBLE;
+
+ALTER TABLE `inmosoftDB`.`Citas`
+  ADD COLUMN `secuencia` INT NOT NULL DEFAULT 0 AFTER `fin`;
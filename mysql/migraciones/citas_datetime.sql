@@ -0,0 +1,38 @@
+-- -----------------------------------------------------
+-- Migra Citas de fecha_cita (VARCHAR yyyy-mm-dd) y hora_cita (INT HHMM) a inicio/fin DATETIME en UTC
+-- y agrega la zona horaria de los agentes. Solo es para bases creadas antes del cambio, una base nueva
+-- ya se crea con init.sql. Esta carpeta no se ejecuta al iniciar el contenedor.
+-- Va después de citas_agenda.sql, el fin se calcula con duracion_minutos.
+--
+-- @offset_citas es el desfase con el que se capturaron las citas existentes, '-06:00' es America/Mexico_City
+-- sin horario de verano. Con las tablas de zonas de MySQL cargadas también se puede usar 'America/Mexico_City'.
+-- -----------------------------------------------------
+SET @offset_citas = '-06:00';
+
+ALTER TABLE `inmosoftDB`.`Usuarios`
+  ADD COLUMN `zona_horaria` VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL AFTER `verificado`;
+
+ALTER TABLE `inmosoftDB`.`Citas`
+  ADD COLUMN `inicio` DATETIME NULL AFTER `titulo_cita`,
+  ADD COLUMN `fin` DATETIME NULL AFTER `inicio`;
+
+UPDATE `inmosoftDB`.`Citas`
+SET `inicio` = CONVERT_TZ(
+      TIMESTAMP(STR_TO_DATE(`fecha_cita`, '%Y-%m-%d'), SEC_TO_TIME((`hora_cita` DIV 100) * 3600 + (`hora_cita` MOD 100) * 60)),
+      @offset_citas, '+00:00');
+
+UPDATE `inmosoftDB`.`Citas`
+SET `fin` = `inicio` + INTERVAL `duracion_minutos` MINUTE;
+
+-- Las citas que no se pudieron convertir quedan en inicio NULL, hay que revisarlas antes de continuar
+SELECT `id_citas`, `fecha_cita`, `hora_cita` FROM `inmosoftDB`.`Citas` WHERE `inicio` IS NULL;
+
+ALTER TABLE `inmosoftDB`.`Citas`
+  MODIFY `inicio` DATETIME NOT NULL,
+  MODIFY `fin` DATETIME NOT NULL,
+  DROP COLUMN `fecha_cita`,
+  DROP COLUMN `hora_cita`,
+  DROP COLUMN `duracion_minutos`,
+  DROP INDEX `fk_Citas_Prospecto1_idx`,
+  ADD INDEX `fk_Citas_Prospecto1_idx` (`id_cliente` ASC, `inicio` ASC) VISIBLE,
+  ADD INDEX `idx_Citas_inicio` (`inicio` ASC) VISIBLE;
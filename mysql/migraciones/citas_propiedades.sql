@@ -0,0 +1,29 @@
+-- -----------------------------------------------------
+-- Agrega las propiedades de cada cita y el resultado de las visitas.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Citas`
+  ADD COLUMN `resultado` ENUM('interesado', 'no_interesado', 'oferta', 'no_asistio') NULL AFTER `ocurrencia`,
+  ADD COLUMN `notas_resultado` TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL AFTER `resultado`,
+  ADD COLUMN `resultado_registrado_en` DATETIME NULL AFTER `notas_resultado`,
+  ADD COLUMN `resultado_registrado_por` VARCHAR(100) NULL AFTER `resultado_registrado_en`;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Citas_Propiedades` (
+  `id_cita` INT NOT NULL,
+  `id_propiedad` INT NOT NULL,
+  `orden` INT NOT NULL DEFAULT 0,
+  `resultado` ENUM('interesado', 'no_interesado', 'oferta', 'no_asistio') NULL,
+  `notas` TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_cita`, `id_propiedad`),
+  INDEX `fk_Citas_Propiedades_Propiedades1_idx` (`id_propiedad` ASC) VISIBLE,
+  CONSTRAINT `fk_Citas_Propiedades_Citas1`
+    FOREIGN KEY (`id_cita`)
+    REFERENCES `inmosoftDB`.`Citas` (`id_citas`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Citas_Propiedades_Propiedades1`
+    FOREIGN KEY (`id_propiedad`)
+    REFERENCES `inmosoftDB`.`Propiedades` (`id_propiedad`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
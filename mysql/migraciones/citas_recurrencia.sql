@@ -0,0 +1,26 @@
+-- -----------------------------------------------------
+-- Agrega las series de citas (recurrencia) y sus excepciones.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Citas`
+  ADD COLUMN `frecuencia` ENUM('diaria', 'semanal', 'mensual') NULL AFTER `id_cliente`,
+  ADD COLUMN `intervalo` INT NOT NULL DEFAULT 1 AFTER `frecuencia`,
+  ADD COLUMN `conteo` INT NULL AFTER `intervalo`,
+  ADD COLUMN `hasta` DATETIME NULL AFTER `conteo`,
+  ADD COLUMN `zona_serie` VARCHAR(64) NULL AFTER `hasta`,
+  ADD COLUMN `fin_serie` DATETIME NULL AFTER `zona_serie`,
+  ADD COLUMN `id_cita_serie` INT NULL AFTER `fin_serie`,
+  ADD COLUMN `ocurrencia` DATETIME NULL AFTER `id_cita_serie`,
+  ADD INDEX `idx_Citas_serie` (`frecuencia` ASC, `fin_serie` ASC) VISIBLE,
+  ADD INDEX `idx_Citas_id_cita_serie` (`id_cita_serie` ASC, `ocurrencia` ASC) VISIBLE;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Excepciones_Cita` (
+  `id_cita` INT NOT NULL,
+  `ocurrencia` DATETIME NOT NULL,
+  PRIMARY KEY (`id_cita`, `ocurrencia`),
+  CONSTRAINT `fk_Excepciones_Cita_Citas1`
+    FOREIGN KEY (`id_cita`)
+    REFERENCES `inmosoftDB`.`Citas` (`id_citas`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
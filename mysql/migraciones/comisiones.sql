@@ -0,0 +1,56 @@
+-- -----------------------------------------------------
+-- Agrega las comisiones: reglas por contrato o tipo de propiedad, el agente que cerró el contrato y los envíos de los
+-- estados de cuenta de los propietarios.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Contratos`
+  ADD COLUMN `agente_cierre` VARCHAR(100) NULL AFTER `cobranza_desde`;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Reglas_Comision` (
+  `id_regla` INT NOT NULL AUTO_INCREMENT,
+  `clave` VARCHAR(40) NOT NULL,
+  `id_contrato` INT NULL,
+  `id_tipo_propiedad` INT NULL,
+  `tipo_transaccion` ENUM('renta', 'venta') NOT NULL,
+  `porcentaje` DOUBLE NULL,
+  `meses` DOUBLE NULL,
+  `porcentaje_captador` DOUBLE NOT NULL DEFAULT 50,
+  `actualizado_por` VARCHAR(100) NULL,
+  `actualizado_en` DATETIME NOT NULL,
+  PRIMARY KEY (`id_regla`),
+  UNIQUE INDEX `clave_UNIQUE` (`clave` ASC) VISIBLE,
+  INDEX `fk_Reglas_Comision_Contratos1_idx` (`id_contrato` ASC) VISIBLE,
+  INDEX `fk_Reglas_Comision_Tipo_Propiedad1_idx` (`id_tipo_propiedad` ASC) VISIBLE,
+  CONSTRAINT `fk_Reglas_Comision_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Reglas_Comision_Tipo_Propiedad1`
+    FOREIGN KEY (`id_tipo_propiedad`)
+    REFERENCES `inmosoftDB`.`Tipo_Propiedad` (`id_tipo_propiedad`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Envios_Estado_Propietario` (
+  `id_envio` INT NOT NULL AUTO_INCREMENT,
+  `id_propietario` INT NOT NULL,
+  `periodo` DATE NOT NULL,
+  `correo` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `estado` ENUM('pendiente', 'enviando', 'enviado', 'cancelado', 'fallido') NOT NULL DEFAULT 'pendiente',
+  `intentos` INT NOT NULL DEFAULT 0,
+  `creado_en` DATETIME NOT NULL,
+  `reclamado_en` DATETIME NULL,
+  `enviado_en` DATETIME NULL,
+  `ultimo_error` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_envio`),
+  UNIQUE INDEX `envio_periodo_UNIQUE` (`id_propietario` ASC, `periodo` ASC) VISIBLE,
+  INDEX `idx_Envios_Estado_Propietario_estado` (`estado` ASC) VISIBLE,
+  CONSTRAINT `fk_Envios_Estado_Propietario_Propietario1`
+    FOREIGN KEY (`id_propietario`)
+    REFERENCES `inmosoftDB`.`Propietario` (`id_propietario`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
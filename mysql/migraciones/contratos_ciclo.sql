@@ -0,0 +1,65 @@
+-- -----------------------------------------------------
+-- Agrega el estado, las fechas y los importes de los contratos, sus partes y los avisos de vencimiento.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Contratos`
+  ADD COLUMN `estado` ENUM('borrador', 'firmado', 'vigente', 'vencido', 'rescindido') NOT NULL DEFAULT 'borrador' AFTER `generado_en`,
+  ADD COLUMN `fecha_inicio` DATE NULL AFTER `estado`,
+  ADD COLUMN `fecha_fin` DATE NULL AFTER `fecha_inicio`,
+  ADD COLUMN `monto` DOUBLE NULL AFTER `fecha_fin`,
+  ADD COLUMN `deposito` DOUBLE NULL AFTER `monto`,
+  ADD COLUMN `firmado_en` DATETIME NULL AFTER `deposito`,
+  ADD COLUMN `rescindido_en` DATETIME NULL AFTER `firmado_en`,
+  ADD COLUMN `motivo_rescision` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL AFTER `rescindido_en`,
+  ADD INDEX `idx_Contratos_estado` (`estado` ASC, `fecha_fin` ASC) VISIBLE;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Partes_Contrato` (
+  `id_parte` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `rol` ENUM('propietario', 'cliente', 'fiador') NOT NULL,
+  `id_propietario` INT NULL,
+  `id_cliente` INT NULL,
+  `nombre` VARCHAR(150) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `correo` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `telefono` VARCHAR(20) NULL,
+  PRIMARY KEY (`id_parte`),
+  UNIQUE INDEX `parte_UNIQUE` (`id_contrato` ASC, `rol` ASC) VISIBLE,
+  INDEX `fk_Partes_Contrato_Propietario1_idx` (`id_propietario` ASC) VISIBLE,
+  INDEX `fk_Partes_Contrato_Prospecto1_idx` (`id_cliente` ASC) VISIBLE,
+  CONSTRAINT `fk_Partes_Contrato_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Partes_Contrato_Propietario1`
+    FOREIGN KEY (`id_propietario`)
+    REFERENCES `inmosoftDB`.`Propietario` (`id_propietario`)
+    ON DELETE SET NULL
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Partes_Contrato_Prospecto1`
+    FOREIGN KEY (`id_cliente`)
+    REFERENCES `inmosoftDB`.`Prospecto` (`id_cliente`)
+    ON DELETE SET NULL
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Avisos_Vencimiento` (
+  `id_aviso` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `fecha_fin` DATE NOT NULL,
+  `usuario` VARCHAR(100) NOT NULL,
+  `estado` ENUM('pendiente', 'enviando', 'enviado', 'cancelado', 'fallido') NOT NULL DEFAULT 'pendiente',
+  `intentos` INT NOT NULL DEFAULT 0,
+  `creado_en` DATETIME NOT NULL,
+  `reclamado_en` DATETIME NULL,
+  `enviado_en` DATETIME NULL,
+  `ultimo_error` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_aviso`),
+  UNIQUE INDEX `aviso_UNIQUE` (`id_contrato` ASC, `fecha_fin` ASC) VISIBLE,
+  INDEX `idx_Avisos_Vencimiento_estado` (`estado` ASC, `usuario` ASC) VISIBLE,
+  CONSTRAINT `fk_Avisos_Vencimiento_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
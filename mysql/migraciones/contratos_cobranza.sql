@@ -0,0 +1,82 @@
+-- -----------------------------------------------------
+-- Agrega la cobranza de las rentas: recargos en los términos del contrato, cargos, pagos y avisos de adeudo.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Contratos`
+  ADD COLUMN `dias_gracia` TINYINT UNSIGNED NULL AFTER `checksum_firmado`,
+  ADD COLUMN `recargo_fijo` DOUBLE NULL AFTER `dias_gracia`,
+  ADD COLUMN `recargo_porcentaje` DOUBLE NULL AFTER `recargo_fijo`,
+  ADD COLUMN `cobranza_desde` DATE NULL AFTER `recargo_porcentaje`;
+
+-- Las rentas que ya estaban firmadas se cobran desde hoy, lo anterior se cobró fuera del sistema
+UPDATE `inmosoftDB`.`Contratos` SET `cobranza_desde` = CURDATE() WHERE `estado` <> 'borrador';
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Cargos_Renta` (
+  `id_cargo` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `tipo` ENUM('renta', 'deposito', 'recargo') NOT NULL,
+  `periodo` DATE NOT NULL,
+  `concepto` VARCHAR(150) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `monto` DECIMAL(12,2) NOT NULL,
+  `fecha_vencimiento` DATE NOT NULL,
+  `creado_en` DATETIME NOT NULL,
+  `condonado_en` DATETIME NULL,
+  `condonado_por` VARCHAR(100) NULL,
+  `motivo_condonacion` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_cargo`),
+  UNIQUE INDEX `cargo_UNIQUE` (`id_contrato` ASC, `tipo` ASC, `periodo` ASC) VISIBLE,
+  INDEX `idx_Cargos_Renta_vencimiento` (`id_contrato` ASC, `fecha_vencimiento` ASC) VISIBLE,
+  CONSTRAINT `fk_Cargos_Renta_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Pagos_Renta` (
+  `id_pago` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `fecha` DATE NOT NULL,
+  `monto` DECIMAL(12,2) NOT NULL,
+  `metodo` ENUM('efectivo', 'transferencia', 'tarjeta') NOT NULL,
+  `referencia` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `notas` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `registrado_por` VARCHAR(100) NULL,
+  `creado_en` DATETIME NOT NULL,
+  `cancelado_en` DATETIME NULL,
+  `cancelado_por` VARCHAR(100) NULL,
+  `motivo_cancelacion` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_pago`),
+  INDEX `idx_Pagos_Renta_fecha` (`id_contrato` ASC, `fecha` ASC) VISIBLE,
+  CONSTRAINT `fk_Pagos_Renta_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Avisos_Adeudo` (
+  `id_aviso` INT NOT NULL AUTO_INCREMENT,
+  `id_cargo` INT NOT NULL,
+  `id_contrato` INT NOT NULL,
+  `correo` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `estado` ENUM('pendiente', 'enviando', 'enviado', 'cancelado', 'fallido') NOT NULL DEFAULT 'pendiente',
+  `intentos` INT NOT NULL DEFAULT 0,
+  `creado_en` DATETIME NOT NULL,
+  `reclamado_en` DATETIME NULL,
+  `enviado_en` DATETIME NULL,
+  `ultimo_error` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_aviso`),
+  UNIQUE INDEX `aviso_cargo_UNIQUE` (`id_cargo` ASC) VISIBLE,
+  INDEX `idx_Avisos_Adeudo_estado` (`id_contrato` ASC, `estado` ASC) VISIBLE,
+  CONSTRAINT `fk_Avisos_Adeudo_Cargos_Renta1`
+    FOREIGN KEY (`id_cargo`)
+    REFERENCES `inmosoftDB`.`Cargos_Renta` (`id_cargo`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Avisos_Adeudo_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
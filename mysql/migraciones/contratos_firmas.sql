@@ -0,0 +1,67 @@
+-- -----------------------------------------------------
+-- Agrega la firma electrónica de contratos: solicitudes por parte, bitácora y el PDF firmado.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Contratos`
+  ADD COLUMN `ruta_pdf_firmado` VARCHAR(255) NULL AFTER `motivo_rescision`,
+  ADD COLUMN `tamano_firmado` BIGINT NULL AFTER `ruta_pdf_firmado`,
+  ADD COLUMN `checksum_firmado` CHAR(64) NULL AFTER `tamano_firmado`;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Firmas_Contrato` (
+  `id_firma` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `id_parte` INT NULL,
+  `rol` ENUM('propietario', 'cliente', 'fiador') NOT NULL,
+  `nombre` VARCHAR(150) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `correo` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `estado` ENUM('pendiente', 'firmada', 'cancelada') NOT NULL DEFAULT 'pendiente',
+  `checksum_documento` CHAR(64) NOT NULL,
+  `enviado_en` DATETIME NOT NULL,
+  `expira_en` DATETIME NOT NULL,
+  `firmado_en` DATETIME NULL,
+  `tipo_firma` ENUM('escrita', 'dibujada') NULL,
+  `firma_texto` VARCHAR(150) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `firma_imagen` MEDIUMBLOB NULL,
+  `ip` VARCHAR(45) NULL,
+  `user_agent` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_firma`),
+  UNIQUE INDEX `token_hash_UNIQUE` (`token_hash` ASC) VISIBLE,
+  INDEX `idx_Firmas_Contrato_estado` (`id_contrato` ASC, `estado` ASC) VISIBLE,
+  INDEX `fk_Firmas_Contrato_Partes_Contrato1_idx` (`id_parte` ASC) VISIBLE,
+  CONSTRAINT `fk_Firmas_Contrato_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Firmas_Contrato_Partes_Contrato1`
+    FOREIGN KEY (`id_parte`)
+    REFERENCES `inmosoftDB`.`Partes_Contrato` (`id_parte`)
+    ON DELETE SET NULL
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Eventos_Firma` (
+  `id_evento` INT NOT NULL AUTO_INCREMENT,
+  `id_contrato` INT NOT NULL,
+  `id_firma` INT NULL,
+  `evento` ENUM('enviada', 'reenviada', 'vista', 'firmada', 'cancelada', 'completada') NOT NULL,
+  `ip` VARCHAR(45) NULL,
+  `user_agent` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `checksum_documento` CHAR(64) NULL,
+  `detalle` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `creado_en` DATETIME NOT NULL,
+  PRIMARY KEY (`id_evento`),
+  INDEX `idx_Eventos_Firma_contrato` (`id_contrato` ASC, `creado_en` ASC) VISIBLE,
+  INDEX `fk_Eventos_Firma_Firmas_Contrato1_idx` (`id_firma` ASC) VISIBLE,
+  CONSTRAINT `fk_Eventos_Firma_Contratos1`
+    FOREIGN KEY (`id_contrato`)
+    REFERENCES `inmosoftDB`.`Contratos` (`id_contrato`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_Eventos_Firma_Firmas_Contrato1`
+    FOREIGN KEY (`id_firma`)
+    REFERENCES `inmosoftDB`.`Firmas_Contrato` (`id_firma`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
@@ -0,0 +1,85 @@
+-- -----------------------------------------------------
+-- Agrega las plantillas de contrato con sus versiones y los datos con los que se generó cada contrato.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Plantillas_Contrato` (
+  `id_plantilla` INT NOT NULL AUTO_INCREMENT,
+  `nombre` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `tipo` ENUM('renta', 'venta') NOT NULL,
+  `activa` TINYINT NOT NULL DEFAULT 1,
+  PRIMARY KEY (`id_plantilla`))
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Versiones_Plantilla` (
+  `id_version` INT NOT NULL AUTO_INCREMENT,
+  `id_plantilla` INT NOT NULL,
+  `version` INT NOT NULL,
+  `contenido` MEDIUMTEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `nota` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `creado_por` VARCHAR(100) NULL,
+  `creado_en` DATETIME NOT NULL,
+  PRIMARY KEY (`id_version`),
+  UNIQUE INDEX `version_UNIQUE` (`id_plantilla` ASC, `version` ASC) VISIBLE,
+  CONSTRAINT `fk_Versiones_Plantilla_Plantillas_Contrato1`
+    FOREIGN KEY (`id_plantilla`)
+    REFERENCES `inmosoftDB`.`Plantillas_Contrato` (`id_plantilla`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+INSERT IGNORE INTO `inmosoftDB`.`Plantillas_Contrato` (`id_plantilla`, `nombre`, `tipo`) VALUES
+(1, 'Arrendamiento de casa habitación', 'renta'),
+(2, 'Compraventa de inmueble', 'venta');
+
+INSERT IGNORE INTO `inmosoftDB`.`Versiones_Plantilla` (`id_version`, `id_plantilla`, `version`, `contenido`, `creado_en`) VALUES
+(1, 1, 1, '# CONTRATO DE ARRENDAMIENTO
+
+Contrato número {{contrato.numero}} que celebran por una parte {{propietario.nombre}}, a quien en lo sucesivo se le denominará "EL ARRENDADOR", y por la otra {{cliente.nombre}}, a quien en lo sucesivo se le denominará "EL ARRENDATARIO", en {{propiedad.ciudad}} el {{fecha}}, al tenor de las siguientes cláusulas:
+
+# CLÁUSULAS
+
+PRIMERA. EL ARRENDADOR da en arrendamiento a EL ARRENDATARIO el inmueble ubicado en {{propiedad.domicilio}}, que EL ARRENDATARIO recibe en buen estado y se obliga a destinar únicamente a casa habitación.
+
+SEGUNDA. La renta mensual es de {{precio}}, que EL ARRENDATARIO pagará por adelantado dentro de los primeros cinco días de cada mes.
+
+TERCERA. La vigencia del contrato es del {{fecha_inicio}} al {{fecha_fin}}. Al terminar, EL ARRENDATARIO entregará el inmueble en el estado en que lo recibió, salvo el desgaste por el uso normal.
+
+CUARTA. EL ARRENDATARIO no podrá subarrendar ni ceder sus derechos sobre el inmueble sin el consentimiento por escrito de EL ARRENDADOR.
+
+{{clausulas}}
+
+Leído el presente contrato y enteradas las partes de su contenido y alcance, lo firman de conformidad.', UTC_TIMESTAMP()),
+(2, 2, 1, '# CONTRATO DE COMPRAVENTA
+
+Contrato número {{contrato.numero}} que celebran por una parte {{propietario.nombre}}, a quien en lo sucesivo se le denominará "EL VENDEDOR", y por la otra {{cliente.nombre}}, a quien en lo sucesivo se le denominará "EL COMPRADOR", en {{propiedad.ciudad}} el {{fecha}}, al tenor de las siguientes cláusulas:
+
+# CLÁUSULAS
+
+PRIMERA. EL VENDEDOR vende a EL COMPRADOR, quien adquiere para sí, el inmueble ubicado en {{propiedad.domicilio}}, libre de todo gravamen y al corriente en el pago de sus contribuciones.
+
+SEGUNDA. El precio de la compraventa es de {{precio}}, que EL COMPRADOR pagará a más tardar el {{fecha_inicio}}, fecha en la que EL VENDEDOR entregará la posesión del inmueble.
+
+TERCERA. Los gastos, impuestos y honorarios de la escrituración correrán por cuenta de EL COMPRADOR, salvo el impuesto sobre la renta que corresponda a EL VENDEDOR.
+
+{{clausulas}}
+
+Leído el presente contrato y enteradas las partes de su contenido y alcance, lo firman de conformidad.', UTC_TIMESTAMP());
+
+ALTER TABLE `inmosoftDB`.`Contratos`
+  ADD COLUMN `id_version_plantilla` INT NULL AFTER `checksum_sha256`,
+  ADD COLUMN `id_cliente` INT NULL AFTER `id_version_plantilla`,
+  ADD COLUMN `datos_plantilla` JSON NULL AFTER `id_cliente`,
+  ADD COLUMN `generado_por` VARCHAR(100) NULL AFTER `datos_plantilla`,
+  ADD COLUMN `generado_en` DATETIME NULL AFTER `generado_por`,
+  ADD INDEX `fk_Contratos_Versiones_Plantilla1_idx` (`id_version_plantilla` ASC) VISIBLE,
+  ADD INDEX `fk_Contratos_Prospecto1_idx` (`id_cliente` ASC) VISIBLE,
+  ADD CONSTRAINT `fk_Contratos_Versiones_Plantilla1`
+    FOREIGN KEY (`id_version_plantilla`)
+    REFERENCES `inmosoftDB`.`Versiones_Plantilla` (`id_version`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  ADD CONSTRAINT `fk_Contratos_Prospecto1`
+    FOREIGN KEY (`id_cliente`)
+    REFERENCES `inmosoftDB`.`Prospecto` (`id_cliente`)
+    ON DELETE SET NULL
+    ON UPDATE NO ACTION;
@@ -0,0 +1,51 @@
+-- -----------------------------------------------------
+-- Limita los estados de las propiedades a los de la máquina de estados y agrega su historial.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- Si la base tiene id_usuario en Propiedades corre después de usuario_agente.sql.
+-- -----------------------------------------------------
+-- Los estados se capturaban a mano, se normalizan y los que no se reconocen vuelven a disponible
+UPDATE `inmosoftDB`.`Estado_Propiedades`
+  SET `tipo_transaccion` = LOWER(TRIM(`tipo_transaccion`)), `estado` = LOWER(TRIM(`estado`));
+
+UPDATE `inmosoftDB`.`Estado_Propiedades` SET `estado` = 'disponible'
+  WHERE `estado` NOT IN ('disponible', 'apartada', 'vendida', 'rentada')
+     OR (`tipo_transaccion` = 'venta' AND `estado` = 'rentada')
+     OR (`tipo_transaccion` = 'renta' AND `estado` = 'vendida');
+
+UPDATE `inmosoftDB`.`Estado_Propiedades` SET `tipo_transaccion` = 'venta', `estado` = 'disponible'
+  WHERE `tipo_transaccion` NOT IN ('venta', 'renta');
+
+UPDATE `inmosoftDB`.`Estado_Propiedades` SET `fecha_cambio_estado` = NULL
+  WHERE `fecha_cambio_estado` NOT REGEXP '^[0-9]{4}-[0-9]{2}-[0-9]{2}( [0-9]{2}:[0-9]{2}(:[0-9]{2})?)?$';
+
+-- Cada propiedad queda con un solo estado, el último que se registró
+DELETE e FROM `inmosoftDB`.`Estado_Propiedades` e
+  JOIN `inmosoftDB`.`Estado_Propiedades` m
+    ON m.`id_propiedad` = e.`id_propiedad` AND m.`id_estado_propiedades` > e.`id_estado_propiedades`;
+
+ALTER TABLE `inmosoftDB`.`Estado_Propiedades`
+  MODIFY COLUMN `tipo_transaccion` ENUM('venta', 'renta') NOT NULL,
+  MODIFY COLUMN `estado` ENUM('disponible', 'apartada', 'vendida', 'rentada') NOT NULL,
+  MODIFY COLUMN `fecha_cambio_estado` DATETIME NULL,
+  DROP INDEX `fk_Estado_Propiedades_Propiedades1_idx`,
+  ADD UNIQUE INDEX `fk_Estado_Propiedades_Propiedades1_idx` (`id_propiedad` ASC) VISIBLE;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Historial_Estado_Propiedades` (
+  `id_historial` INT NOT NULL AUTO_INCREMENT,
+  `id_propiedad` INT NOT NULL,
+  `estado_anterior` ENUM('disponible', 'apartada', 'vendida', 'rentada') NULL,
+  `estado_nuevo` ENUM('disponible', 'apartada', 'vendida', 'rentada') NOT NULL,
+  `tipo_transaccion` ENUM('venta', 'renta') NOT NULL,
+  `usuario` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `comentario` VARCHAR(500) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `fecha_cambio` DATETIME NOT NULL,
+  PRIMARY KEY (`id_historial`),
+  INDEX `idx_Historial_Estado_Propiedades_propiedad` (`id_propiedad` ASC, `fecha_cambio` ASC) VISIBLE)
+ENGINE = InnoDB;
+
+-- El historial empieza con el estado actual de cada propiedad, a nombre de su agente
+INSERT INTO `inmosoftDB`.`Historial_Estado_Propiedades` (`id_propiedad`, `estado_anterior`, `estado_nuevo`, `tipo_transaccion`, `usuario`, `fecha_cambio`)
+SELECT e.`id_propiedad`, NULL, e.`estado`, e.`tipo_transaccion`, p.`usuario`, COALESCE(e.`fecha_cambio_estado`, NOW())
+FROM `inmosoftDB`.`Estado_Propiedades` e
+  INNER JOIN `inmosoftDB`.`Propiedades` p ON p.`id_propiedad` = e.`id_propiedad`
+WHERE NOT EXISTS (SELECT 1 FROM `inmosoftDB`.`Historial_Estado_Propiedades` h WHERE h.`id_propiedad` = e.`id_propiedad`);
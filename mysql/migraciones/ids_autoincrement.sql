@@ -0,0 +1,14 @@
+-- -----------------------------------------------------
+-- Hace que la base genere los id de Tipo_Propiedad y Propietario, antes la API los calculaba con MAX(id)+1.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+-- Las columnas son referenciadas por llaves foráneas, MySQL no deja cambiarlas con las revisiones activas
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+
+ALTER TABLE `inmosoftDB`.`Tipo_Propiedad`
+  MODIFY COLUMN `id_tipo_propiedad` INT NOT NULL AUTO_INCREMENT;
+
+ALTER TABLE `inmosoftDB`.`Propietario`
+  MODIFY COLUMN `id_propietario` INT NOT NULL AUTO_INCREMENT;
+
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
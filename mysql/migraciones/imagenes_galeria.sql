@@ -0,0 +1,54 @@
+-- -----------------------------------------------------
+-- Agrega el orden de la galería y limita a una imagen principal por propiedad y por prospecto.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- Va después de imagenes_variantes.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Imagenes`
+  ADD COLUMN `posicion` INT NOT NULL DEFAULT 0 AFTER `principal`;
+
+ALTER TABLE `inmosoftDB`.`ImagenesProspecto`
+  ADD COLUMN `posicion` INT NOT NULL DEFAULT 0 AFTER `principal`;
+
+-- La galería queda en el orden en que se subieron las imágenes, empezando en 1
+UPDATE `inmosoftDB`.`Imagenes` i
+  JOIN (SELECT `id_imagen`, ROW_NUMBER() OVER (PARTITION BY `id_propiedad` ORDER BY `id_imagen`) AS `posicion`
+        FROM `inmosoftDB`.`Imagenes`) o ON o.`id_imagen` = i.`id_imagen`
+  SET i.`posicion` = o.`posicion`;
+
+UPDATE `inmosoftDB`.`ImagenesProspecto` i
+  JOIN (SELECT `id_imagen`, ROW_NUMBER() OVER (PARTITION BY `id_prospecto` ORDER BY `id_imagen`) AS `posicion`
+        FROM `inmosoftDB`.`ImagenesProspecto`) o ON o.`id_imagen` = i.`id_imagen`
+  SET i.`posicion` = o.`posicion`;
+
+-- Si había varias principales se queda la más antigua, y si no había ninguna la primera de la galería
+UPDATE `inmosoftDB`.`Imagenes` i
+  JOIN (SELECT `id_propiedad`, MIN(`id_imagen`) AS `id_imagen` FROM `inmosoftDB`.`Imagenes`
+        WHERE `principal` = 1 GROUP BY `id_propiedad`) p ON p.`id_propiedad` = i.`id_propiedad`
+  SET i.`principal` = 0
+  WHERE i.`principal` = 1 AND i.`id_imagen` <> p.`id_imagen`;
+
+UPDATE `inmosoftDB`.`Imagenes` i
+  JOIN (SELECT `id_propiedad`, MIN(`id_imagen`) AS `id_imagen` FROM `inmosoftDB`.`Imagenes`
+        GROUP BY `id_propiedad` HAVING COALESCE(SUM(`principal` = 1), 0) = 0) p ON p.`id_imagen` = i.`id_imagen`
+  SET i.`principal` = 1;
+
+UPDATE `inmosoftDB`.`ImagenesProspecto` i
+  JOIN (SELECT `id_prospecto`, MIN(`id_imagen`) AS `id_imagen` FROM `inmosoftDB`.`ImagenesProspecto`
+        WHERE `principal` = 1 GROUP BY `id_prospecto`) p ON p.`id_prospecto` = i.`id_prospecto`
+  SET i.`principal` = 0
+  WHERE i.`principal` = 1 AND i.`id_imagen` <> p.`id_imagen`;
+
+UPDATE `inmosoftDB`.`ImagenesProspecto` i
+  JOIN (SELECT `id_prospecto`, MIN(`id_imagen`) AS `id_imagen` FROM `inmosoftDB`.`ImagenesProspecto`
+        GROUP BY `id_prospecto` HAVING COALESCE(SUM(`principal` = 1), 0) = 0) p ON p.`id_imagen` = i.`id_imagen`
+  SET i.`principal` = 1;
+
+ALTER TABLE `inmosoftDB`.`Imagenes`
+  ADD COLUMN `id_propiedad_principal` INT GENERATED ALWAYS AS (IF(`principal` = 1, `id_propiedad`, NULL)) STORED AFTER `placeholder`,
+  ADD UNIQUE INDEX `uq_Imagenes_principal` (`id_propiedad_principal` ASC) VISIBLE,
+  ADD INDEX `idx_Imagenes_posicion` (`id_propiedad` ASC, `posicion` ASC) VISIBLE;
+
+ALTER TABLE `inmosoftDB`.`ImagenesProspecto`
+  ADD COLUMN `id_prospecto_principal` INT GENERATED ALWAYS AS (IF(`principal` = 1, `id_prospecto`, NULL)) STORED AFTER `placeholder`,
+  ADD UNIQUE INDEX `uq_ImagenesProspecto_principal` (`id_prospecto_principal` ASC) VISIBLE,
+  ADD INDEX `idx_ImagenesProspecto_posicion` (`id_prospecto` ASC, `posicion` ASC) VISIBLE;
@@ -0,0 +1,62 @@
+-- -----------------------------------------------------
+-- Agrega las variantes y el placeholder de las imágenes de propiedades y de prospectos.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- Va después de archivos.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Imagenes`
+  ADD COLUMN `estado_variantes` ENUM('pendiente', 'procesando', 'listo', 'error') NULL AFTER `checksum_sha256`,
+  ADD COLUMN `variantes_actualizado_en` DATETIME NULL AFTER `estado_variantes`,
+  ADD COLUMN `placeholder` TEXT NULL AFTER `variantes_actualizado_en`;
+
+ALTER TABLE `inmosoftDB`.`ImagenesProspecto`
+  ADD COLUMN `nombre_archivo` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL AFTER `id_prospecto`,
+  ADD COLUMN `tipo_mime` VARCHAR(100) NULL AFTER `nombre_archivo`,
+  ADD COLUMN `tamano_bytes` BIGINT NULL AFTER `tipo_mime`,
+  ADD COLUMN `checksum_sha256` CHAR(64) NULL AFTER `tamano_bytes`,
+  ADD COLUMN `estado_variantes` ENUM('pendiente', 'procesando', 'listo', 'error') NULL AFTER `checksum_sha256`,
+  ADD COLUMN `variantes_actualizado_en` DATETIME NULL AFTER `estado_variantes`,
+  ADD COLUMN `placeholder` TEXT NULL AFTER `variantes_actualizado_en`;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Imagenes_Variantes` (
+  `id_variante` INT NOT NULL AUTO_INCREMENT,
+  `id_imagen` INT NOT NULL,
+  `nombre` VARCHAR(20) NOT NULL,
+  `formato` VARCHAR(10) NOT NULL,
+  `ancho` INT NOT NULL,
+  `alto` INT NOT NULL,
+  `ruta` VARCHAR(255) NOT NULL,
+  `tipo_mime` VARCHAR(100) NOT NULL,
+  `tamano_bytes` BIGINT NOT NULL,
+  `checksum_sha256` CHAR(64) NOT NULL,
+  PRIMARY KEY (`id_variante`),
+  UNIQUE INDEX `uq_Imagenes_Variantes_imagen_nombre_formato` (`id_imagen` ASC, `nombre` ASC, `formato` ASC) VISIBLE,
+  CONSTRAINT `fk_Imagenes_Variantes_Imagenes1`
+    FOREIGN KEY (`id_imagen`)
+    REFERENCES `inmosoftDB`.`Imagenes` (`id_imagen`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`ImagenesProspecto_Variantes` (
+  `id_variante` INT NOT NULL AUTO_INCREMENT,
+  `id_imagen` INT NOT NULL,
+  `nombre` VARCHAR(20) NOT NULL,
+  `formato` VARCHAR(10) NOT NULL,
+  `ancho` INT NOT NULL,
+  `alto` INT NOT NULL,
+  `ruta` VARCHAR(255) NOT NULL,
+  `tipo_mime` VARCHAR(100) NOT NULL,
+  `tamano_bytes` BIGINT NOT NULL,
+  `checksum_sha256` CHAR(64) NOT NULL,
+  PRIMARY KEY (`id_variante`),
+  UNIQUE INDEX `uq_ImagenesProspecto_Variantes_imagen_nombre_formato` (`id_imagen` ASC, `nombre` ASC, `formato` ASC) VISIBLE,
+  CONSTRAINT `fk_ImagenesProspecto_Variantes_ImagenesProspecto1`
+    FOREIGN KEY (`id_imagen`)
+    REFERENCES `inmosoftDB`.`ImagenesProspecto` (`id_imagen`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+-- Las imágenes que ya tienen archivo en el storage quedan en cola para el worker
+UPDATE `inmosoftDB`.`Imagenes` SET `estado_variantes` = 'pendiente'
+  WHERE `checksum_sha256` IS NOT NULL AND `estado_variantes` IS NULL;
@@ -0,0 +1,6 @@
+-- -----------------------------------------------------
+-- Agrega el tipo de actividad que registra la fusión de prospectos duplicados.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Actividades_Prospecto`
+  MODIFY COLUMN `tipo` ENUM('nota', 'llamada', 'correo', 'etapa', 'asignacion', 'fusion') NOT NULL;
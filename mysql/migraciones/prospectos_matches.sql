@@ -0,0 +1,26 @@
+-- -----------------------------------------------------
+-- Agrega los extras que busca el prospecto y la cola de avisos de propiedades para los agentes.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Prospecto`
+  ADD COLUMN `extras` SET('alberca', 'jardin', 'techada', 'cocineta', 'cuarto_servicio') NULL AFTER `num_banos_min`;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Notificaciones_Match` (
+  `id_notificacion` INT NOT NULL AUTO_INCREMENT,
+  `id_propiedad` INT NOT NULL,
+  `id_cliente` INT NOT NULL,
+  `usuario` VARCHAR(100) NOT NULL,
+  `motivo` ENUM('nueva', 'baja_precio') NOT NULL,
+  `precio` DOUBLE NOT NULL,
+  `precio_anterior` DOUBLE NULL,
+  `puntaje` INT NOT NULL,
+  `estado` ENUM('pendiente', 'enviando', 'enviado', 'cancelado', 'fallido') NOT NULL DEFAULT 'pendiente',
+  `intentos` INT NOT NULL DEFAULT 0,
+  `creado_en` DATETIME NOT NULL,
+  `reclamado_en` DATETIME NULL,
+  `enviado_en` DATETIME NULL,
+  `ultimo_error` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_notificacion`),
+  UNIQUE INDEX `notificacion_UNIQUE` (`id_propiedad` ASC, `id_cliente` ASC, `motivo` ASC, `precio` ASC) VISIBLE,
+  INDEX `idx_Notificaciones_Match_estado` (`estado` ASC, `usuario` ASC) VISIBLE)
+ENGINE = InnoDB;
@@ -0,0 +1,55 @@
+-- -----------------------------------------------------
+-- Agrega el pipeline de prospectos: etapa, agente, origen, criterios de búsqueda y la línea de tiempo.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Prospecto`
+  ADD COLUMN `etapa` VARCHAR(45) NOT NULL DEFAULT 'nuevo' AFTER `correo_prospecto`,
+  ADD COLUMN `usuario` VARCHAR(100) NULL AFTER `etapa`,
+  ADD COLUMN `origen` ENUM('portal', 'referido', 'visita_directa', 'otro') NOT NULL DEFAULT 'otro' AFTER `usuario`,
+  ADD COLUMN `fecha_alta` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER `origen`,
+  ADD COLUMN `etapa_desde` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER `fecha_alta`,
+  ADD COLUMN `tipo_transaccion` ENUM('venta', 'renta') NULL AFTER `etapa_desde`,
+  ADD COLUMN `id_tipo_propiedad` INT NULL AFTER `tipo_transaccion`,
+  ADD COLUMN `ciudad` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL AFTER `id_tipo_propiedad`,
+  ADD COLUMN `colonia` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL AFTER `ciudad`,
+  ADD COLUMN `presupuesto_min` DOUBLE NULL AFTER `colonia`,
+  ADD COLUMN `presupuesto_max` DOUBLE NULL AFTER `presupuesto_min`,
+  ADD COLUMN `num_recamaras_min` INT NULL AFTER `presupuesto_max`,
+  ADD COLUMN `num_banos_min` INT NULL AFTER `num_recamaras_min`,
+  ADD INDEX `idx_Prospecto_etapa` (`etapa` ASC, `etapa_desde` ASC) VISIBLE,
+  ADD INDEX `idx_Prospecto_usuario` (`usuario` ASC) VISIBLE;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Etapas_Prospecto` (
+  `clave` VARCHAR(45) NOT NULL,
+  `nombre` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `orden` INT NOT NULL DEFAULT 0,
+  `tipo` ENUM('abierta', 'ganada', 'perdida') NOT NULL,
+  `activa` TINYINT NOT NULL DEFAULT 1,
+  PRIMARY KEY (`clave`))
+ENGINE = InnoDB;
+
+INSERT IGNORE INTO `inmosoftDB`.`Etapas_Prospecto` (`clave`, `nombre`, `orden`, `tipo`) VALUES
+('nuevo', 'Nuevo', 10, 'abierta'),
+('contactado', 'Contactado', 20, 'abierta'),
+('visita', 'Visita', 30, 'abierta'),
+('oferta', 'Oferta', 40, 'abierta'),
+('cerrado-ganado', 'Cerrado ganado', 50, 'ganada'),
+('cerrado-perdido', 'Cerrado perdido', 60, 'perdida');
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Actividades_Prospecto` (
+  `id_actividad` INT NOT NULL AUTO_INCREMENT,
+  `id_cliente` INT NOT NULL,
+  `tipo` ENUM('nota', 'llamada', 'correo', 'etapa', 'asignacion') NOT NULL,
+  `titulo` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `descripcion` TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  `usuario` VARCHAR(100) NULL,
+  `fecha` DATETIME NOT NULL,
+  `id_cita` INT NULL,
+  PRIMARY KEY (`id_actividad`),
+  INDEX `fk_Actividades_Prospecto_Prospecto1_idx` (`id_cliente` ASC, `fecha` ASC) VISIBLE,
+  CONSTRAINT `fk_Actividades_Prospecto_Prospecto1`
+    FOREIGN KEY (`id_cliente`)
+    REFERENCES `inmosoftDB`.`Prospecto` (`id_cliente`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
@@ -0,0 +1,36 @@
+-- -----------------------------------------------------
+-- Tablas de los recordatorios de citas y de los leases del scheduler.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Recordatorios_Cita`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Recordatorios_Cita` (
+  `id_recordatorio` INT NOT NULL AUTO_INCREMENT,
+  `id_cita` INT NOT NULL,
+  `tipo` ENUM('24h', '1h') NOT NULL,
+  `destinatario` ENUM('agente', 'prospecto') NOT NULL,
+  `correo` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `inicio_cita` DATETIME NOT NULL,
+  `programado_para` DATETIME NOT NULL,
+  `estado` ENUM('pendiente', 'enviando', 'enviado', 'cancelado', 'fallido') NOT NULL DEFAULT 'pendiente',
+  `intentos` INT NOT NULL DEFAULT 0,
+  `reclamado_en` DATETIME NULL,
+  `enviado_en` DATETIME NULL,
+  `ultimo_error` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_recordatorio`),
+  UNIQUE INDEX `recordatorio_UNIQUE` (`id_cita` ASC, `tipo` ASC, `destinatario` ASC, `inicio_cita` ASC) VISIBLE,
+  INDEX `idx_Recordatorios_Cita_estado` (`estado` ASC, `programado_para` ASC) VISIBLE)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `inmosoftDB`.`Tareas_Programadas`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Tareas_Programadas` (
+  `nombre` VARCHAR(100) NOT NULL,
+  `duenio` VARCHAR(255) NOT NULL,
+  `lease_hasta` DATETIME NOT NULL,
+  `ultima_ejecucion` DATETIME NULL,
+  PRIMARY KEY (`nombre`))
+ENGINE = InnoDB;
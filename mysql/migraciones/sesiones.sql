@@ -0,0 +1,37 @@
+-- -----------------------------------------------------
+-- Agrega las sesiones del servidor y los refresh tokens que rotan con cada uso.
+-- Solo es para bases creadas antes del cambio, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Sesiones` (
+  `id_sesion` INT NOT NULL AUTO_INCREMENT,
+  `id_usuario` INT NOT NULL,
+  `creado_en` DATETIME NOT NULL,
+  `expira_en` DATETIME NOT NULL,
+  `revocado_en` DATETIME NULL,
+  `ip` VARCHAR(45) NULL,
+  `user_agent` VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+  PRIMARY KEY (`id_sesion`),
+  INDEX `fk_Sesiones_Usuarios1_idx` (`id_usuario` ASC) VISIBLE,
+  CONSTRAINT `fk_Sesiones_Usuarios1`
+    FOREIGN KEY (`id_usuario`)
+    REFERENCES `inmosoftDB`.`Usuarios` (`id_usuario`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `inmosoftDB`.`Refresh_Tokens` (
+  `id_refresh_token` INT NOT NULL AUTO_INCREMENT,
+  `token_hash` CHAR(64) NOT NULL,
+  `id_sesion` INT NOT NULL,
+  `creado_en` DATETIME NOT NULL,
+  `expira_en` DATETIME NOT NULL,
+  `usado_en` DATETIME NULL,
+  PRIMARY KEY (`id_refresh_token`),
+  UNIQUE INDEX `token_hash_UNIQUE` (`token_hash` ASC) VISIBLE,
+  INDEX `fk_Refresh_Tokens_Sesiones1_idx` (`id_sesion` ASC) VISIBLE,
+  CONSTRAINT `fk_Refresh_Tokens_Sesiones1`
+    FOREIGN KEY (`id_sesion`)
+    REFERENCES `inmosoftDB`.`Sesiones` (`id_sesion`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
@@ -0,0 +1,44 @@
+-- -----------------------------------------------------
+-- Cambia el agente de Propiedades y Citas de id_usuario a usuario (el correo), que es lo que usa la API para
+-- los permisos, los listados y los correos.
+-- Solo es para bases creadas con el init.sql que tenía id_usuario, una base nueva ya se crea con init.sql.
+-- -----------------------------------------------------
+ALTER TABLE `inmosoftDB`.`Propiedades`
+  ADD COLUMN `usuario` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL AFTER `id_usuario`;
+
+UPDATE `inmosoftDB`.`Propiedades` p
+  INNER JOIN `inmosoftDB`.`Usuarios` u ON u.`id_usuario` = p.`id_usuario`
+  SET p.`usuario` = u.`usuario`;
+
+ALTER TABLE `inmosoftDB`.`Propiedades` DROP FOREIGN KEY `fk_Propiedades_Usuarios1`;
+
+ALTER TABLE `inmosoftDB`.`Propiedades`
+  DROP INDEX `fk_Propiedades_Usuarios1_idx`,
+  DROP COLUMN `id_usuario`,
+  MODIFY COLUMN `usuario` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  ADD INDEX `fk_Propiedades_Usuarios1_idx` (`usuario` ASC) VISIBLE,
+  ADD CONSTRAINT `fk_Propiedades_Usuarios1`
+    FOREIGN KEY (`usuario`)
+    REFERENCES `inmosoftDB`.`Usuarios` (`usuario`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION;
+
+ALTER TABLE `inmosoftDB`.`Citas`
+  ADD COLUMN `usuario` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL AFTER `id_usuario`;
+
+UPDATE `inmosoftDB`.`Citas` c
+  INNER JOIN `inmosoftDB`.`Usuarios` u ON u.`id_usuario` = c.`id_usuario`
+  SET c.`usuario` = u.`usuario`;
+
+ALTER TABLE `inmosoftDB`.`Citas` DROP FOREIGN KEY `fk_Citas_Usuarios1`;
+
+ALTER TABLE `inmosoftDB`.`Citas`
+  DROP INDEX `fk_Citas_Usuarios1_idx`,
+  DROP COLUMN `id_usuario`,
+  MODIFY COLUMN `usuario` VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  ADD INDEX `fk_Citas_Usuarios1_idx` (`usuario` ASC) VISIBLE,
+  ADD CONSTRAINT `fk_Citas_Usuarios1`
+    FOREIGN KEY (`usuario`)
+    REFERENCES `inmosoftDB`.`Usuarios` (`usuario`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION;